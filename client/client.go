@@ -0,0 +1,231 @@
+// Package client is a Go client for the users API. It speaks version 1 of
+// the API, authenticates with an API key and retries requests that are
+// safe to repeat when the service is briefly unavailable.
+//
+//	users := client.New("https://users.example.com", client.WithAPIKey(key))
+//	user, err := users.GetUser(ctx, id)
+//	if errors.Is(err, client.ErrNotFound) {
+//		...
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UsersClient calls the users API. It is safe for concurrent use.
+type UsersClient struct {
+	baseURL    string
+	httpClient *http.Client
+	apiKey     string
+	tenant     string
+	userAgent  string
+
+	maxAttempts         int
+	baseDelay, maxDelay time.Duration
+}
+
+// Option configures the client built by New.
+type Option func(*UsersClient)
+
+// WithAPIKey authenticates every request with key.
+func WithAPIKey(key string) Option {
+	return func(c *UsersClient) { c.apiKey = key }
+}
+
+// WithTenant sends requests to tenant. Requests authenticated with an API
+// key are always scoped to the key's tenant.
+func WithTenant(tenant string) Option {
+	return func(c *UsersClient) { c.tenant = tenant }
+}
+
+// WithHTTPClient sends requests through hc instead of a client with a 30
+// second timeout.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *UsersClient) { c.httpClient = hc }
+}
+
+// WithUserAgent identifies the calling service in the User-Agent header.
+func WithUserAgent(ua string) Option {
+	return func(c *UsersClient) { c.userAgent = ua }
+}
+
+// WithRetries makes a request that may be retried run at most maxAttempts
+// times, waiting a jittered exponential backoff between baseDelay and
+// maxDelay, or as long as the service asks with Retry-After. One attempt
+// disables retries.
+func WithRetries(maxAttempts int, baseDelay, maxDelay time.Duration) Option {
+	return func(c *UsersClient) {
+		c.maxAttempts, c.baseDelay, c.maxDelay = maxAttempts, baseDelay, maxDelay
+	}
+}
+
+// New returns a client for the API at baseURL, e.g.
+// "https://users.example.com".
+func New(baseURL string, opts ...Option) *UsersClient {
+	c := &UsersClient{
+		baseURL:     strings.TrimRight(baseURL, "/") + "/api/v1",
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		userAgent:   "users-go-client",
+		maxAttempts: 3,
+		baseDelay:   100 * time.Millisecond,
+		maxDelay:    5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.maxAttempts < 1 {
+		c.maxAttempts = 1
+	}
+	return c
+}
+
+// request is one API call.
+type request struct {
+	method string
+	path   string
+	body   any
+	header http.Header
+}
+
+// do sends req, retrying it while it is safe to, and decodes the response
+// into out unless out is nil. It returns the response headers.
+func (c *UsersClient) do(ctx context.Context, req request, out any) (http.Header, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, err
+		}
+	}
+	retryable := isIdempotent(req.method) || req.header.Get("Idempotency-Key") != ""
+
+	for attempt := 1; ; attempt++ {
+		header, wait, err := c.send(ctx, req, body, out)
+		if err == nil || !retryable || attempt >= c.maxAttempts || !shouldRetry(ctx, err) {
+			return header, err
+		}
+		if wait <= 0 {
+			wait = c.backoff(attempt)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return header, err
+		case <-timer.C:
+		}
+	}
+}
+
+// send makes one attempt. wait is the delay the service asked for with
+// Retry-After.
+func (c *UsersClient) send(ctx context.Context, req request, body []byte, out any) (header http.Header, wait time.Duration, err error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, c.baseURL+req.path, reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	for name, values := range req.header {
+		httpReq.Header[name] = values
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if c.tenant != "" {
+		httpReq.Header.Set("X-Tenant-ID", c.tenant)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return resp.Header, retryAfter(resp.Header), decodeError(resp)
+	}
+	if out == nil {
+		return resp.Header, 0, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.Header, 0, fmt.Errorf("decoding %s %s response: %w", req.method, req.path, err)
+	}
+	return resp.Header, 0, nil
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// shouldRetry reports whether err is likely to go away: a failed
+// connection or a response saying the service is overloaded or down.
+func shouldRetry(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	switch apiErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (c *UsersClient) backoff(attempt int) time.Duration {
+	ceiling := c.baseDelay << (attempt - 1)
+	if ceiling > c.maxDelay || ceiling <= 0 {
+		ceiling = c.maxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return mathrand.N(ceiling) + 1
+}
+
+// maxRetryAfter caps how long a Retry-After header makes the client wait.
+const maxRetryAfter = time.Minute
+
+func retryAfter(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return min(time.Duration(seconds)*time.Second, maxRetryAfter)
+}
+
+// newIdempotencyKey returns a random key that makes a POST safe to retry.
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Errors matched by an *Error through errors.Is, by status code.
+var (
+	ErrInvalid         = errors.New("invalid request")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrForbidden       = errors.New("forbidden")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrVersionConflict = errors.New("version conflict")
+	ErrRateLimited     = errors.New("rate limited")
+	ErrUnavailable     = errors.New("service unavailable")
+)
+
+var statusErrors = map[int]error{
+	http.StatusBadRequest:          ErrInvalid,
+	http.StatusUnprocessableEntity: ErrInvalid,
+	http.StatusUnauthorized:        ErrUnauthorized,
+	http.StatusForbidden:           ErrForbidden,
+	http.StatusNotFound:            ErrNotFound,
+	http.StatusConflict:            ErrConflict,
+	http.StatusPreconditionFailed:  ErrVersionConflict,
+	http.StatusTooManyRequests:     ErrRateLimited,
+	http.StatusServiceUnavailable:  ErrUnavailable,
+}
+
+// Problem codes of the errors callers most often handle. See the Errors
+// section of the README for the full list.
+const (
+	CodeValidation      = "validation-error"
+	CodeEmailTaken      = "email-taken"
+	CodeUsernameTaken   = "username-taken"
+	CodeVersionConflict = "version-conflict"
+)
+
+// FieldError is one invalid field of a rejected request. Code, such as
+// "EMAIL_INVALID", is stable; Message is meant for humans.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is a failed API call, decoded from the problem details the service
+// answers with.
+type Error struct {
+	StatusCode int    `json:"status"`
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	Detail     string `json:"detail"`
+	Instance   string `json:"instance"`
+	// Errors lists the invalid fields of a validation error.
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Title
+	}
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("users API: %d %s", e.StatusCode, msg)
+}
+
+// Code returns the problem code, such as CodeEmailTaken, or "" for
+// problems that carry no more than their status.
+func (e *Error) Code() string {
+	if i := strings.LastIndex(e.Type, "/problems/"); i >= 0 {
+		return e.Type[i+len("/problems/"):]
+	}
+	return ""
+}
+
+// Is matches the sentinel for the status code, so callers can write
+// errors.Is(err, client.ErrNotFound).
+func (e *Error) Is(target error) bool {
+	return statusErrors[e.StatusCode] == target
+}
+
+// decodeError reads the problem details of a failed response, keeping the
+// raw body as the detail when it is not one.
+func decodeError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	apiErr := &Error{}
+	if json.Unmarshal(body, apiErr) != nil {
+		apiErr = &Error{Detail: strings.TrimSpace(string(body))}
+	}
+	apiErr.StatusCode = resp.StatusCode
+	return apiErr
+}
@@ -0,0 +1,216 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// User statuses.
+const (
+	StatusPending   = "pending"
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+	StatusMerged    = "merged"
+)
+
+// User is a user as the API returns it.
+type User struct {
+	ID        string `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username,omitempty"`
+	Age       uint   `json:"age"`
+	// Birthdate is a date such as "1990-04-01".
+	Birthdate    string   `json:"birthdate,omitempty"`
+	Email        string   `json:"email"`
+	PendingEmail string   `json:"pending_email,omitempty"`
+	Locale       string   `json:"locale,omitempty"`
+	Timezone     string   `json:"timezone,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	Status       string   `json:"status"`
+	MergedInto   string   `json:"merged_into,omitempty"`
+
+	Created   time.Time `json:"created"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Version changes with every update; UpdateUser takes it to detect
+	// concurrent changes.
+	Version int `json:"version"`
+
+	AnonymizedAt *time.Time `json:"anonymized_at,omitempty"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+	LastSeenAt   *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// NewUser is what CreateUser needs to create a user.
+type NewUser struct {
+	// ID is the ID to create the user with, generated by the service when
+	// empty. Creating a user again with the same ID and email returns the
+	// existing user.
+	ID        string `json:"id,omitempty"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username,omitempty"`
+	Email     string `json:"email"`
+	Birthdate string `json:"birthdate,omitempty"`
+	Locale    string `json:"locale,omitempty"`
+	Timezone  string `json:"timezone,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Password  string `json:"password,omitempty"`
+}
+
+// UserUpdate changes the fields that are set and leaves the others alone.
+// Birthdate, Locale and Timezone set to "" clear them.
+type UserUpdate struct {
+	FirstName *string `json:"first_name,omitempty"`
+	LastName  *string `json:"last_name,omitempty"`
+	Username  *string `json:"username,omitempty"`
+	Birthdate *string `json:"birthdate,omitempty"`
+	Email     *string `json:"email,omitempty"`
+	Locale    *string `json:"locale,omitempty"`
+	Timezone  *string `json:"timezone,omitempty"`
+}
+
+// String returns a pointer to s, for filling in a UserUpdate.
+func String(s string) *string {
+	return &s
+}
+
+// ListOptions filter and page ListUsers. Zero values do not filter.
+type ListOptions struct {
+	Email    string
+	Username string
+	Status   string
+	// TagsAny matches users with any of the tags, TagsAll those with all.
+	TagsAny       []string
+	TagsAll       []string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	// Limit defaults to the service's page size.
+	Limit  int
+	Offset int
+}
+
+func (o ListOptions) query() url.Values {
+	q := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+	set("email", o.Email)
+	set("username", o.Username)
+	set("status", o.Status)
+	set("tags_any", strings.Join(o.TagsAny, ","))
+	set("tags_all", strings.Join(o.TagsAll, ","))
+	if !o.CreatedAfter.IsZero() {
+		q.Set("created_after", o.CreatedAfter.Format(time.RFC3339))
+	}
+	if !o.CreatedBefore.IsZero() {
+		q.Set("created_before", o.CreatedBefore.Format(time.RFC3339))
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		q.Set("offset", strconv.Itoa(o.Offset))
+	}
+	return q
+}
+
+// UserPage is one page of a user list.
+type UserPage struct {
+	Users []User
+	// Total is the number of users matching across all pages, or -1 when
+	// the service did not say.
+	Total int64
+}
+
+// AnyVersion makes UpdateUser overwrite the user whatever its version.
+const AnyVersion = -1
+
+// CreateUser creates a user. The request carries an idempotency key, so it
+// is retried without risking a second user.
+func (c *UsersClient) CreateUser(ctx context.Context, user NewUser) (*User, error) {
+	var created User
+	req := request{
+		method: http.MethodPost,
+		path:   "/users",
+		body:   user,
+		header: http.Header{"Idempotency-Key": {newIdempotencyKey()}},
+	}
+	if _, err := c.do(ctx, req, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetUser returns the user with id.
+func (c *UsersClient) GetUser(ctx context.Context, id string) (*User, error) {
+	var user User
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/users/" + url.PathEscape(id)}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListUsers returns a page of the users matching opts.
+func (c *UsersClient) ListUsers(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	return c.listUsers(ctx, "/users", opts.query())
+}
+
+// SearchUsers returns a page of the users matching text, best match first.
+// Only the paging fields of opts apply.
+func (c *UsersClient) SearchUsers(ctx context.Context, text string, opts ListOptions) (*UserPage, error) {
+	q := ListOptions{Limit: opts.Limit, Offset: opts.Offset}.query()
+	q.Set("q", text)
+	return c.listUsers(ctx, "/users/search", q)
+}
+
+func (c *UsersClient) listUsers(ctx context.Context, path string, q url.Values) (*UserPage, error) {
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	page := &UserPage{Total: -1}
+	header, err := c.do(ctx, request{method: http.MethodGet, path: path}, &page.Users)
+	if err != nil {
+		return nil, err
+	}
+	if total, err := strconv.ParseInt(header.Get("X-Total-Count"), 10, 64); err == nil {
+		page.Total = total
+	}
+	return page, nil
+}
+
+// UpdateUser applies update to the user with id if it still has version,
+// and returns the updated user. It fails with ErrVersionConflict when the
+// user changed in the meantime; AnyVersion skips the check. Updates are
+// not retried, since a retry after a lost response would conflict with
+// the update itself.
+func (c *UsersClient) UpdateUser(ctx context.Context, id string, version int, update UserUpdate) (*User, error) {
+	ifMatch := "*"
+	if version != AnyVersion {
+		ifMatch = `"` + strconv.Itoa(version) + `"`
+	}
+	var user User
+	req := request{
+		method: http.MethodPatch,
+		path:   "/users/" + url.PathEscape(id),
+		body:   update,
+		header: http.Header{"If-Match": {ifMatch}},
+	}
+	if _, err := c.do(ctx, req, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeleteUser deletes the user with id.
+func (c *UsersClient) DeleteUser(ctx context.Context, id string) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: "/users/" + url.PathEscape(id)}, nil)
+	return err
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// backend is what the CLI commands need, implemented either on top of the
+// database service or the HTTP API.
+type backend interface {
+	CreateUser(ctx context.Context, user *models.User) (*models.User, error)
+	GetUser(ctx context.Context, id string) (*models.User, error)
+	ListUsers(ctx context.Context, filter database.UserFilter, page database.Page) ([]models.User, error)
+	DeleteUser(ctx context.Context, id string) error
+}
+
+type dbBackend struct {
+	db database.UserRepository
+}
+
+func newDBBackend() (*dbBackend, error) {
+	db, err := database.New()
+	if err != nil {
+		return nil, err
+	}
+	return &dbBackend{db: db}, nil
+}
+
+func (b *dbBackend) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	return b.db.CreateUser(ctx, user)
+}
+
+func (b *dbBackend) GetUser(ctx context.Context, id string) (*models.User, error) {
+	return b.db.GetUserByID(ctx, id)
+}
+
+func (b *dbBackend) ListUsers(ctx context.Context, filter database.UserFilter, page database.Page) ([]models.User, error) {
+	return b.db.ListUsers(ctx, filter, page)
+}
+
+func (b *dbBackend) DeleteUser(ctx context.Context, id string) error {
+	_, err := b.db.DeleteUserByID(ctx, id)
+	return err
+}
+
+type httpBackend struct {
+	baseURL string
+	client  *http.Client
+}
+
+func newHTTPBackend(baseURL string) *httpBackend {
+	return &httpBackend{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (b *httpBackend) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, b.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Tenant-ID", tenant.FromContext(ctx))
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+		// Errors are problem details; fall back to the raw body otherwise
+		var problem struct {
+			Detail string `json:"detail"`
+		}
+		if json.Unmarshal(msg, &problem) == nil && problem.Detail != "" {
+			msg = []byte(problem.Detail)
+		}
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (b *httpBackend) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	var created models.User
+	if err := b.do(ctx, http.MethodPost, "/api/v1/users", user, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (b *httpBackend) GetUser(ctx context.Context, id string) (*models.User, error) {
+	var user models.User
+	if err := b.do(ctx, http.MethodGet, "/api/v1/users/"+url.PathEscape(id), nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (b *httpBackend) ListUsers(ctx context.Context, filter database.UserFilter, page database.Page) ([]models.User, error) {
+	q := url.Values{}
+	if filter.Email != "" {
+		q.Set("email", filter.Email)
+	}
+	if page.Limit > 0 {
+		q.Set("limit", strconv.Itoa(page.Limit))
+	}
+	if page.Offset > 0 {
+		q.Set("offset", strconv.Itoa(page.Offset))
+	}
+
+	var users []models.User
+	if err := b.do(ctx, http.MethodGet, "/api/v1/users?"+q.Encode(), nil, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (b *httpBackend) DeleteUser(ctx context.Context, id string) error {
+	return b.do(ctx, http.MethodDelete, "/api/v1/users/"+url.PathEscape(id), nil, nil)
+}
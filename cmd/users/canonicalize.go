@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"users/internal/database"
+)
+
+func newCanonicalizeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "canonicalize-emails",
+		Short: "Store the tenant's Gmail addresses in canonical form",
+		Long:  "Rewrite the Gmail addresses of the tenant's users stored before the canonical_gmail flag was turned on into the form the flag stores them in, so they are found by email again. Users whose canonical address another user already holds are left as they are and listed, to be merged or changed by hand. Users are rewritten in batches, each locking its users briefly, so it can run while the servers do.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := database.New()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			var changed, conflicts int
+			after := ""
+			for {
+				batch, err := db.CanonicalizeEmails(cmd.Context(), after, database.MaxPageLimit)
+				if err != nil {
+					return err
+				}
+				changed += batch.Changed
+				for _, c := range batch.Conflicts {
+					fmt.Fprintf(cmd.OutOrStdout(), "Kept %s for user %s: user %s holds its canonical address\n", c.Email, c.UserID, c.HeldBy)
+				}
+				conflicts += len(batch.Conflicts)
+				if batch.Last == "" {
+					break
+				}
+				after = batch.Last
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Canonicalized %d users, kept %d with conflicts\n", changed, conflicts)
+			return nil
+		},
+	}
+}
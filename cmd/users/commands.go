@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/validator"
+)
+
+func newCreateCmd(open func() (backend, error)) *cobra.Command {
+	var user models.User
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a user",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validator.ValidateUser(&user); err != nil {
+				return err
+			}
+			b, err := open()
+			if err != nil {
+				return err
+			}
+			created, err := b.CreateUser(cmd.Context(), &user)
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd, created)
+		},
+	}
+	cmd.Flags().StringVar(&user.ID, "id", "", "ID to create the user with instead of a generated one")
+	cmd.Flags().StringVar(&user.FirstName, "first-name", "", "first name")
+	cmd.Flags().StringVar(&user.LastName, "last-name", "", "last name")
+	cmd.Flags().StringVar(&user.Username, "username", "", "optional unique username")
+	cmd.Flags().StringVar(&user.Email, "email", "", "email address")
+	cmd.Flags().StringVar(&user.Birthdate, "birthdate", "", "birthdate (YYYY-MM-DD)")
+	cmd.Flags().UintVar(&user.Age, "age", 0, "age, for users without a birthdate")
+	return cmd
+}
+
+func newGetCmd(open func() (backend, error)) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get <id>",
+		Short: "Show a user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := open()
+			if err != nil {
+				return err
+			}
+			user, err := b.GetUser(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd, user)
+		},
+	}
+}
+
+func newListCmd(open func() (backend, error)) *cobra.Command {
+	var filter database.UserFilter
+	var page database.Page
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List users",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := open()
+			if err != nil {
+				return err
+			}
+			users, err := b.ListUsers(cmd.Context(), filter, page)
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd, users)
+		},
+	}
+	cmd.Flags().StringVar(&filter.Email, "email", "", "only list the user with this email")
+	cmd.Flags().IntVar(&page.Limit, "limit", database.DefaultPageLimit, "maximum number of users")
+	cmd.Flags().IntVar(&page.Offset, "offset", 0, "number of users to skip")
+	return cmd
+}
+
+func newDeleteCmd(open func() (backend, error)) *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "delete <id>",
+		Short: "Delete a user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !yes {
+				fmt.Fprintf(cmd.OutOrStdout(), "Delete user %s? [y/N] ", args[0])
+				answer, _ := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+				if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+					return errAborted
+				}
+			}
+			b, err := open()
+			if err != nil {
+				return err
+			}
+			if err := b.DeleteUser(cmd.Context(), args[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Deleted user %s\n", args[0])
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "do not ask for confirmation")
+	return cmd
+}
+
+func newMigrateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply pending database migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := database.New()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if err := db.Migrate(cmd.Context()); err != nil {
+				return err
+			}
+			version, _, err := db.MigrationVersion(cmd.Context())
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Database is at version %d\n", version)
+			return nil
+		},
+	}
+}
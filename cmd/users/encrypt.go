@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"users/internal/database"
+)
+
+func newEncryptCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "encrypt",
+		Short: "Encrypt stored emails with the current PII key",
+		Long:  "Encrypt the emails still stored in plaintext, after PII encryption was turned on, and those encrypted with an older key, after a new one was added. Users are encrypted in batches, each locking its users briefly, so it can run while the servers do. Older keys must stay configured until it is done.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := database.New()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			var total int
+			after := ""
+			for {
+				last, encrypted, err := db.EncryptUserPII(cmd.Context(), after, database.MaxPageLimit)
+				if err != nil {
+					return err
+				}
+				total += encrypted
+				if last == "" {
+					break
+				}
+				after = last
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Encrypted %d users\n", total)
+			return nil
+		},
+	}
+}
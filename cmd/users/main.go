@@ -0,0 +1,69 @@
+// Command users is an operator tool for inspecting and fixing user data
+// without writing SQL. It talks to the database directly by default, or to a
+// running API when --api is given.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"users/internal/tenant"
+)
+
+func main() {
+	if err := newRootCmd().ExecuteContext(context.Background()); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCmd() *cobra.Command {
+	var apiURL, tenantID string
+
+	root := &cobra.Command{
+		Use:          "users",
+		Short:        "Manage users of the users service",
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if !tenant.IsValid(tenantID) {
+				return fmt.Errorf("invalid tenant id %q", tenantID)
+			}
+			cmd.SetContext(tenant.WithTenant(cmd.Context(), tenantID))
+			return nil
+		},
+	}
+	root.PersistentFlags().StringVar(&apiURL, "api", os.Getenv("USERS_API_URL"), "base URL of the users API; talks to the database directly when empty")
+	root.PersistentFlags().StringVar(&tenantID, "tenant", tenant.Default, "tenant to operate on")
+
+	open := func() (backend, error) {
+		if apiURL != "" {
+			return newHTTPBackend(apiURL), nil
+		}
+		return newDBBackend()
+	}
+
+	root.AddCommand(
+		newCreateCmd(open),
+		newGetCmd(open),
+		newListCmd(open),
+		newDeleteCmd(open),
+		newMigrateCmd(),
+		newSeedCmd(),
+		newReindexCmd(),
+		newPartitionCmd(),
+		newEncryptCmd(),
+		newCanonicalizeCmd(),
+	)
+	return root
+}
+
+func printJSON(cmd *cobra.Command, v any) error {
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+var errAborted = fmt.Errorf("aborted")
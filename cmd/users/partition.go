@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"users/internal/database"
+)
+
+func newPartitionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "partition",
+		Short: "Partition the users table by tenant",
+	}
+	cmd.AddCommand(newPartitionCreateCmd(), newPartitionListCmd())
+	return cmd
+}
+
+func newPartitionCreateCmd() *cobra.Command {
+	var count int
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Rebuild the users table as partitions hashed on the tenant",
+		Long:  "Rebuild the users table as partitions hashed on the tenant. The table is copied in one transaction and locked until the copy is done, so run it in a maintenance window or before the table grows large.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !yes {
+				fmt.Fprintf(cmd.OutOrStdout(), "Rebuild the users table as %d partitions? Users cannot be read or written until it is done. [y/N] ", count)
+				answer, _ := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+				if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+					return errAborted
+				}
+			}
+			db, err := database.New()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if err := db.PartitionUsers(cmd.Context(), count); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Partitioned users into %d partitions\n", count)
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&count, "count", 16, "number of partitions")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "do not ask for confirmation")
+	return cmd
+}
+
+func newPartitionListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the partitions of the users table with their estimated size",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := database.New()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			partitions, err := db.UserPartitions(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd, partitions)
+		},
+	}
+}
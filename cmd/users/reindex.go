@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/searchindex"
+)
+
+// reindexMargin moves the search indexer back before the snapshot started,
+// so changes committed by transactions in flight at that time are not
+// missed.
+const reindexMargin = time.Minute
+
+func newReindexCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reindex",
+		Short: "Rebuild the search index from scratch",
+		Long:  "Rebuild the search index from scratch in a new index and swap it in once it holds every user. Searches keep using the old index until then, and changes made meanwhile are applied by the running servers afterwards.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			index := searchindex.FromEnv()
+			if index == nil {
+				return errors.New("SEARCH_INDEX_URL is not set")
+			}
+			db, err := database.New()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			started := time.Now()
+			var count int
+			err = index.Rebuild(cmd.Context(), func(ctx context.Context, fn func([]models.TenantUser) error) error {
+				after := ""
+				for {
+					users, err := db.ScanUsers(ctx, after, database.MaxPageLimit)
+					if err != nil || len(users) == 0 {
+						return err
+					}
+					if err := fn(users); err != nil {
+						return err
+					}
+					count += len(users)
+					after = users[len(users)-1].ID
+				}
+			})
+			if err != nil {
+				return err
+			}
+			if err := db.ResetUserFeed(cmd.Context(), searchindex.Consumer, started.Add(-reindexMargin)); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Indexed %d users\n", count)
+			return nil
+		},
+	}
+}
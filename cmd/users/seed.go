@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"users/internal/database"
+	"users/internal/seed"
+)
+
+func newSeedCmd() *cobra.Command {
+	opts := seed.Options{Count: 100, Seed: 1, Locale: "en"}
+
+	cmd := &cobra.Command{
+		Use:   "seed",
+		Short: "Populate the database with generated users",
+		Long:  "Populate the database with generated users. Runs with the same seed and locale produce the same users and never create duplicates.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := database.New()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			created, err := seed.Run(cmd.Context(), db, opts)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Created %d of %d users\n", created, opts.Count)
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&opts.Count, "count", opts.Count, "number of users to generate")
+	cmd.Flags().Int64Var(&opts.Seed, "seed", opts.Seed, "random seed; the same seed yields the same users")
+	cmd.Flags().StringVar(&opts.Locale, "locale", opts.Locale, "name locale, one of "+strings.Join(seed.Locales(), ", "))
+	return cmd
+}
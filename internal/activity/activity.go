@@ -0,0 +1,92 @@
+// Package activity records when users were last seen without adding a
+// database write to every authenticated request.
+package activity
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"users/internal/models"
+)
+
+// Store is the subset of the database service the tracker needs.
+type Store interface {
+	TouchLastSeen(ctx context.Context, seen []models.Activity) error
+}
+
+type key struct {
+	tenantID string
+	userID   string
+}
+
+// Tracker collects sightings in memory and writes them in batches. Only the
+// latest sighting per user survives until the next flush.
+type Tracker struct {
+	store Store
+
+	mu      sync.Mutex
+	pending map[key]time.Time
+
+	// Interval is how often pending sightings are written.
+	Interval time.Duration
+}
+
+// NewTracker returns a tracker writing to store.
+func NewTracker(store Store) *Tracker {
+	return &Tracker{
+		store:    store,
+		pending:  make(map[key]time.Time),
+		Interval: 30 * time.Second,
+	}
+}
+
+// Seen notes that the user made a request just now. It never blocks on the
+// database.
+func (t *Tracker) Seen(tenantID, userID string) {
+	t.mu.Lock()
+	t.pending[key{tenantID, userID}] = time.Now()
+	t.mu.Unlock()
+}
+
+// Run flushes pending sightings every Interval until ctx is done, then
+// flushes one last time.
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			t.flush(flushCtx)
+			cancel()
+			return
+		case <-ticker.C:
+			t.flush(ctx)
+		}
+	}
+}
+
+// Flush writes pending sightings immediately.
+func (t *Tracker) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = make(map[key]time.Time, len(pending))
+	t.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+	seen := make([]models.Activity, 0, len(pending))
+	for k, at := range pending {
+		seen = append(seen, models.Activity{TenantID: k.tenantID, UserID: k.userID, SeenAt: at})
+	}
+	return t.store.TouchLastSeen(ctx, seen)
+}
+
+func (t *Tracker) flush(ctx context.Context) {
+	if err := t.Flush(ctx); err != nil {
+		log.Printf("Error recording user activity: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+// Package auth carries the identity of whoever is performing a request
+// through contexts, so lower layers can attribute their actions.
+package auth
+
+import "context"
+
+// System is the actor of work not triggered by an authenticated caller.
+const System = "system"
+
+type (
+	actorKey  struct{}
+	scopesKey struct{}
+)
+
+// WithActor returns a copy of ctx attributed to actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor of ctx, or System.
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return System
+}
+
+// WithScopes returns a copy of ctx restricted to scopes.
+func WithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesKey{}, scopes)
+}
+
+// HasScope reports whether ctx may perform actions requiring scope. Contexts
+// without scopes are not restricted by them.
+func HasScope(ctx context.Context, scope string) bool {
+	scopes, ok := ctx.Value(scopesKey{}).([]string)
+	if !ok {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Scoped reports whether ctx carries scopes, i.e. was authenticated by a
+// credential such as an API key that only grants specific permissions.
+func Scoped(ctx context.Context) bool {
+	_, ok := ctx.Value(scopesKey{}).([]string)
+	return ok
+}
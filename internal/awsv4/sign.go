@@ -0,0 +1,88 @@
+// Package awsv4 signs requests to AWS APIs with Signature Version 4, which
+// is all the service needs from an AWS SDK.
+package awsv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Signer holds the credentials and scope requests are signed for.
+type Signer struct {
+	Region          string
+	Service         string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Sign adds the X-Amz-Date and Authorization headers to req. Content-Type,
+// Host, X-Amz-Content-Sha256, X-Amz-Security-Token and X-Amz-Target are
+// signed when present, which keeps the canonical request independent of
+// headers added by the transport. A X-Amz-Content-Sha256 header set by the
+// caller, such as UNSIGNED-PAYLOAD for S3 uploads streamed from a file,
+// takes the place of the hash of payload.
+func (s Signer) Sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := now.UTC().Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	// Canonical headers must be sorted by name.
+	var signed, headers string
+	for _, h := range []struct{ name, value string }{
+		{"content-type", req.Header.Get("Content-Type")},
+		{"host", req.URL.Host},
+		{"x-amz-content-sha256", req.Header.Get("X-Amz-Content-Sha256")},
+		{"x-amz-date", amzDate},
+		{"x-amz-security-token", s.SessionToken},
+		{"x-amz-target", req.Header.Get("X-Amz-Target")},
+	} {
+		if h.value == "" {
+			continue
+		}
+		if signed != "" {
+			signed += ";"
+		}
+		signed += h.name
+		headers += h.name + ":" + h.value + "\n"
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = sha256Hex(payload)
+	}
+	canonical := req.Method + "\n" + path + "\n" + req.URL.RawQuery + "\n" + headers + "\n" + signed + "\n" + payloadHash
+	scope := day + "/" + s.Region + "/" + s.Service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), day)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, s.Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKeyID, scope, signed, signature))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
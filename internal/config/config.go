@@ -0,0 +1,97 @@
+// Package config checks configuration read from the environment up front:
+// a Report collects every missing or invalid value, so a deployment fails
+// at boot with all of its mistakes listed instead of one per restart, or
+// later halfway through a request.
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error lists the problems a Report found.
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Report collects configuration problems. The zero value is ready to use.
+type Report struct {
+	problems []string
+}
+
+// Addf records a problem.
+func (r *Report) Addf(format string, args ...any) {
+	r.problems = append(r.problems, fmt.Sprintf(format, args...))
+}
+
+// Check records err, when not nil, as a problem. It takes the errors of
+// the functions that parse settings themselves, which name the variable.
+func (r *Report) Check(err error) {
+	if err != nil {
+		r.Addf("%v", err)
+	}
+}
+
+// Required records a problem when key is unset, saying why it is needed.
+func (r *Report) Required(key, why string) {
+	if os.Getenv(key) == "" {
+		r.Addf("%s is required %s", key, why)
+	}
+}
+
+// Int records a problem when key is set to anything but an integer of at
+// least min.
+func (r *Report) Int(key string, min int) {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err != nil || n < min {
+			r.Addf("%s must be an integer of at least %d, got %q", key, min, v)
+		}
+	}
+}
+
+// Port records a problem when key is set to anything but a TCP port.
+func (r *Report) Port(key string) {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err != nil || n < 1 || n > 65535 {
+			r.Addf("%s must be a port between 1 and 65535, got %q", key, v)
+		}
+	}
+}
+
+// Duration records a problem when key is set to anything but a positive
+// duration such as 30s or 5m.
+func (r *Report) Duration(key string) {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			r.Addf("%s must be a positive duration such as 30s or 5m, got %q", key, v)
+		}
+	}
+}
+
+// Bool records a problem when key is set to anything but true or false.
+func (r *Report) Bool(key string) {
+	r.OneOf(key, "true", "false")
+}
+
+// OneOf records a problem when key is set to none of values.
+func (r *Report) OneOf(key string, values ...string) {
+	if v := os.Getenv(key); v != "" && !slices.Contains(values, v) {
+		r.Addf("%s must be one of %s, got %q", key, strings.Join(values, ", "), v)
+	}
+}
+
+// Err returns an *Error listing the problems, nil when there are none.
+func (r *Report) Err() error {
+	if len(r.problems) == 0 {
+		return nil
+	}
+	return &Error{Problems: slices.Clone(r.problems)}
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// recordActivity ends the statements recording sightings: each user in
+// seen is added to the users active on the day of the sighting, once
+// however often they are seen. RefreshGrowthStats counts them into
+// user_growth_stats.
+const recordActivity = `
+        INSERT INTO user_daily_activity (tenant_id, day, user_id)
+        SELECT tenant_id, day, id FROM seen
+        ON CONFLICT DO NOTHING
+    `
+
+// RecordLogin stamps the user's last login, which also counts as being seen.
+func (s *service) RecordLogin(ctx context.Context, userID string) error {
+	_, err := s.db.Exec(ctx, `
+        WITH touched AS (
+            UPDATE users SET last_login_at = now(), last_seen_at = now()
+            WHERE id = $1 AND tenant_id = $2
+            RETURNING id, tenant_id, last_login_at, last_seen_at
+        ),
+        directory AS (
+            UPDATE user_directory d SET last_login_at = t.last_login_at, last_seen_at = t.last_seen_at
+            FROM touched t WHERE d.id = t.id
+        ),
+        seen AS (
+            SELECT tenant_id, (last_seen_at AT TIME ZONE 'UTC')::date AS day, id FROM touched
+        )
+        `+recordActivity, userID, tenant.FromContext(ctx))
+	return err
+}
+
+// TouchLastSeen writes a batch of sightings in one statement. A sighting
+// never moves last_seen_at backwards and counts its user as active on its
+// day. Sightings do not change updated_at, so they are copied into the
+// user directory right away rather than through the change feed.
+func (s *service) TouchLastSeen(ctx context.Context, seen []models.Activity) error {
+	tenants := make([]string, len(seen))
+	ids := make([]string, len(seen))
+	times := make([]time.Time, len(seen))
+	for i, a := range seen {
+		tenants[i], ids[i], times[i] = a.TenantID, a.UserID, a.SeenAt
+	}
+
+	_, err := s.db.Exec(ctx, `
+        WITH v AS (
+            SELECT * FROM unnest($1::text[], $2::text[], $3::timestamptz[]) AS v(tenant_id, id, seen_at)
+        ),
+        touched AS (
+            UPDATE users u
+            SET last_seen_at = GREATEST(u.last_seen_at, v.seen_at)
+            FROM v
+            WHERE u.id = v.id AND u.tenant_id = v.tenant_id
+            RETURNING u.id, u.tenant_id, u.last_seen_at
+        ),
+        directory AS (
+            UPDATE user_directory d SET last_seen_at = t.last_seen_at
+            FROM touched t WHERE d.id = t.id
+        ),
+        seen AS (
+            SELECT v.tenant_id, (v.seen_at AT TIME ZONE 'UTC')::date AS day, v.id
+            FROM v JOIN touched t ON t.id = v.id AND t.tenant_id = v.tenant_id
+        )
+        `+recordActivity, tenants, ids, times)
+	return err
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// ErrAlreadyAnonymized is returned when anonymizing a user twice.
+var ErrAlreadyAnonymized = errors.New("user is already anonymized")
+
+// AnonymizeUser irreversibly replaces the user's personal data with
+// placeholders while keeping the row, so references to the ID stay valid.
+// Linked login identities and cached responses that may still contain the
+// old data are purged, consents lose their source IPs and the action is
+// recorded in the audit log, all in one transaction.
+func (s *service) AnonymizeUser(ctx context.Context, id string) (*models.User, error) {
+	tenantID := tenant.FromContext(ctx)
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockUsers(ctx, tx, id); err != nil {
+		return nil, err
+	}
+	var anonymized bool
+	err = tx.QueryRow(ctx, `SELECT anonymized_at IS NOT NULL FROM users WHERE id = $1 AND tenant_id = $2 FOR UPDATE`, id, tenantID).Scan(&anonymized)
+	if err != nil {
+		return nil, err
+	}
+	if anonymized {
+		return nil, ErrAlreadyAnonymized
+	}
+
+	user, err := s.anonymize(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// anonymize scrubs the locked, not yet anonymized user id within tx.
+func (s *service) anonymize(ctx context.Context, tx conn, id string) (*models.User, error) {
+	tenantID := tenant.FromContext(ctx)
+	query := `
+        UPDATE users
+        SET first_name = 'Anonymized',
+            last_name = 'User',
+            username = NULL,
+            locale = NULL,
+            timezone = NULL,
+            email = 'anonymized+' || id || '@invalid',
+            email_ciphertext = NULL,
+            age = 0,
+            birthdate = NULL,
+            metadata = '{}',
+            tags = '{}',
+            password_hash = NULL,
+            pending_email = NULL,
+            pending_email_ciphertext = NULL,
+            email_token_hash = NULL,
+            last_login_at = NULL,
+            last_seen_at = NULL,
+            anonymized_at = now(),
+            version = version + 1,
+            updated_at = now()
+        WHERE id = $1 AND tenant_id = $2
+        RETURNING ` + selectList("", defaultUserFields)
+	user, err := s.scanUser(tx.QueryRow(ctx, query, id, tenantID))
+	if err != nil {
+		return nil, err
+	}
+
+	// Linked accounts would let the person behind them log back in
+	if _, err := tx.Exec(ctx, `DELETE FROM identities WHERE tenant_id = $1 AND user_id = $2`, tenantID, id); err != nil {
+		return nil, err
+	}
+
+	// Consents stay as the record of what was agreed to, without where
+	// from
+	if _, err := tx.Exec(ctx, `UPDATE consents SET source_ip = NULL WHERE tenant_id = $1 AND user_id = $2`, tenantID, id); err != nil {
+		return nil, err
+	}
+
+	// So do the user's own audited changes
+	if _, err := tx.Exec(ctx, `UPDATE audit_log SET ip = NULL WHERE tenant_id = $1 AND actor = 'user:' || $2`, tenantID, id); err != nil {
+		return nil, err
+	}
+
+	// Replayable responses of earlier requests may still carry the old data
+	_, err = tx.Exec(ctx, `DELETE FROM idempotency_keys WHERE starts_with(key, $1 || ':') AND position(convert_to($2, 'UTF8') IN body) > 0`, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := recordAudit(ctx, tx, &models.AuditEntry{Action: models.AuditUserAnonymized, TargetUserID: id}); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
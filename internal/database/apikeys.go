@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+const apiKeyColumns = `id, tenant_id, name, prefix, scopes, created, last_used_at, revoked_at`
+
+func scanAPIKey(row interface{ Scan(...any) error }) (*models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(&key.ID, &key.TenantID, &key.Name, &key.Prefix, &key.Scopes, &key.Created, &key.LastUsedAt, &key.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// CreateAPIKey stores key for the tenant in ctx under the given hash.
+func (s *service) CreateAPIKey(ctx context.Context, key *models.APIKey, hash string) error {
+	key.ID = s.newID()
+	key.TenantID = tenant.FromContext(ctx)
+	query := `
+        INSERT INTO api_keys (id, tenant_id, name, prefix, key_hash, scopes)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING created
+    `
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, query, key.ID, key.TenantID, key.Name, key.Prefix, hash, key.Scopes).Scan(&key.Created); err != nil {
+			return err
+		}
+		return s.enforceQuota(ctx, tx, QuotaAPIKeys)
+	})
+}
+
+// GetAPIKeyByHash returns the active key with the given hash regardless of
+// tenant, since the key itself determines the tenant.
+func (s *service) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`
+	return scanAPIKey(s.db.QueryRow(ctx, query, hash))
+}
+
+func (s *service) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE tenant_id = $1 ORDER BY created`
+	rows, err := s.db.Query(ctx, query, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *service) RevokeAPIKey(ctx context.Context, id string) error {
+	res, err := s.db.Exec(ctx, `UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND tenant_id = $2 AND revoked_at IS NULL`, id, tenant.FromContext(ctx))
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// TouchAPIKey records that a key was used. Writes are limited to one per
+// minute per key.
+func (s *service) TouchAPIKey(ctx context.Context, id string) error {
+	_, err := s.db.Exec(ctx, `
+        UPDATE api_keys SET last_used_at = now()
+        WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')
+    `, id)
+	return err
+}
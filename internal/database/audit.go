@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/auth"
+	"users/internal/models"
+	"users/internal/proxy"
+	"users/internal/tenant"
+)
+
+// recordAudit takes a conn, so audit entries can be written as part of the
+// transaction that performs the audited change.
+func recordAudit(ctx context.Context, db conn, entry *models.AuditEntry) error {
+	entry.TenantID = tenant.FromContext(ctx)
+	if entry.Actor == "" {
+		entry.Actor = auth.ActorFromContext(ctx)
+	}
+	if entry.IP == "" {
+		entry.IP = proxy.ClientIP(ctx)
+	}
+	details, err := json.Marshal(entry.Details)
+	if err != nil {
+		return err
+	}
+	if entry.Details == nil {
+		details = []byte("{}")
+	}
+
+	query := `
+        INSERT INTO audit_log (tenant_id, actor, action, target_user_id, details, ip)
+        VALUES ($1, $2, $3, NULLIF($4, ''), $5, NULLIF($6, ''))
+        RETURNING id, created
+    `
+	return db.QueryRow(ctx, query, entry.TenantID, entry.Actor, entry.Action, entry.TargetUserID, details, entry.IP).Scan(&entry.ID, &entry.Created)
+}
+
+// RecordAudit appends entry to the audit log of the tenant in ctx. The actor
+// defaults to the one carried by ctx.
+func (s *service) RecordAudit(ctx context.Context, entry *models.AuditEntry) error {
+	return recordAudit(ctx, s.db, entry)
+}
+
+// ListAuditEntries returns the audit entries targeting a user, oldest first.
+func (s *service) ListAuditEntries(ctx context.Context, userID string) ([]models.AuditEntry, error) {
+	rows, err := s.db.Query(ctx, listAuditEntriesQuery, tenant.FromContext(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditEntries(rows)
+}
+
+const auditColumns = `id, tenant_id, actor, action, COALESCE(target_user_id, ''), details, COALESCE(ip, ''), created`
+
+const listAuditEntriesQuery = `
+    SELECT ` + auditColumns + `
+    FROM audit_log
+    WHERE tenant_id = $1 AND target_user_id = $2
+    ORDER BY created, id
+`
+
+// AuditFilter selects audit entries. Empty fields match every entry; Since
+// and Until restrict the entries to those created in [Since, Until).
+type AuditFilter struct {
+	Actor        string
+	TargetUserID string
+	// Actions matches entries with any of the actions.
+	Actions []string
+	Since   time.Time
+	Until   time.Time
+}
+
+// where renders the filter as a WHERE clause for the tenant of ctx.
+func (f AuditFilter) where(ctx context.Context) (string, []any) {
+	args := []any{tenant.FromContext(ctx)}
+	conds := []string{"tenant_id = $1"}
+	if f.Actor != "" {
+		args = append(args, f.Actor)
+		conds = append(conds, fmt.Sprintf("actor = $%d", len(args)))
+	}
+	if f.TargetUserID != "" {
+		args = append(args, f.TargetUserID)
+		conds = append(conds, fmt.Sprintf("target_user_id = $%d", len(args)))
+	}
+	if len(f.Actions) > 0 {
+		args = append(args, f.Actions)
+		conds = append(conds, fmt.Sprintf("action = ANY($%d)", len(args)))
+	}
+	if !f.Since.IsZero() {
+		args = append(args, f.Since)
+		conds = append(conds, fmt.Sprintf("created >= $%d", len(args)))
+	}
+	if !f.Until.IsZero() {
+		args = append(args, f.Until)
+		conds = append(conds, fmt.Sprintf("created < $%d", len(args)))
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// QueryAudit returns a page of the tenant's audit entries matching filter,
+// newest first.
+func (s *service) QueryAudit(ctx context.Context, filter AuditFilter, page Page) ([]models.AuditEntry, error) {
+	page = page.Normalize()
+	where, args := filter.where(ctx)
+	args = append(args, page.Limit, page.Offset)
+	query := fmt.Sprintf(`SELECT %s FROM audit_log%s ORDER BY created DESC, id DESC LIMIT $%d OFFSET $%d`,
+		auditColumns, where, len(args)-1, len(args))
+
+	var entries []models.AuditEntry
+	err := s.read(ctx, "QueryAudit", func(db conn) error {
+		rows, err := db.Query(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		entries, err = scanAuditEntries(rows)
+		return err
+	})
+	return entries, err
+}
+
+// CountAudit returns the number of the tenant's audit entries matching
+// filter.
+func (s *service) CountAudit(ctx context.Context, filter AuditFilter) (int64, error) {
+	where, args := filter.where(ctx)
+	var count int64
+	err := s.read(ctx, "CountAudit", func(db conn) error {
+		return db.QueryRow(ctx, `SELECT count(*) FROM audit_log`+where, args...).Scan(&count)
+	})
+	return count, err
+}
+
+// EachAuditEntry calls fn with every audit entry of the tenant matching
+// filter, oldest first, without holding them all in memory. It stops at
+// the first error fn returns. Entries are read in batches, each continuing
+// after the last entry of the one before, so an export does not hold one
+// query open for as long as its client takes to read it.
+func (s *service) EachAuditEntry(ctx context.Context, filter AuditFilter, fn func(models.AuditEntry) error) error {
+	var after *models.AuditEntry
+	for {
+		where, args := filter.where(ctx)
+		if after != nil {
+			args = append(args, after.Created, after.ID)
+			where += fmt.Sprintf(" AND (created, id) > ($%d, $%d)", len(args)-1, len(args))
+		}
+		args = append(args, exportBatchSize)
+		query := fmt.Sprintf(`SELECT %s FROM audit_log%s ORDER BY created, id LIMIT $%d`, auditColumns, where, len(args))
+
+		var batch []models.AuditEntry
+		err := s.retry(ctx, "EachAuditEntry", isTransient, func() error {
+			rows, err := s.db.Query(ctx, query, args...)
+			if err != nil {
+				return err
+			}
+			batch, err = scanAuditEntries(rows)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for _, e := range batch {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if len(batch) < exportBatchSize {
+			return nil
+		}
+		after = &batch[len(batch)-1]
+	}
+}
+
+func scanAuditEntry(rows pgx.Rows) (models.AuditEntry, error) {
+	var e models.AuditEntry
+	var details []byte
+	if err := rows.Scan(&e.ID, &e.TenantID, &e.Actor, &e.Action, &e.TargetUserID, &details, &e.IP, &e.Created); err != nil {
+		return e, err
+	}
+	return e, json.Unmarshal(details, &e.Details)
+}
+
+func scanAuditEntries(rows pgx.Rows) ([]models.AuditEntry, error) {
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
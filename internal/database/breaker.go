@@ -0,0 +1,787 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"users/internal/models"
+)
+
+// ErrUnavailable is returned without touching the database while the
+// circuit breaker is open.
+var ErrUnavailable = errors.New("database unavailable")
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitHalfOpen
+	circuitOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitHalfOpen:
+		return "half-open"
+	case circuitOpen:
+		return "open"
+	}
+	return "closed"
+}
+
+var (
+	circuitStateGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "users_db_circuit_state",
+		Help: "State of the database circuit breaker: 0 closed, 1 half-open, 2 open.",
+	})
+	circuitRejectionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "users_db_circuit_rejections_total",
+		Help: "Database operations rejected by the open circuit breaker.",
+	})
+	circuitTransitionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "users_db_circuit_transitions_total",
+		Help: "Circuit breaker state changes by new state.",
+	}, []string{"state"})
+)
+
+// CircuitBreaker is a Service that stops calling the wrapped one after
+// repeated connection failures. While open every call fails fast with
+// ErrUnavailable; after the cooldown a single call is let through to probe
+// whether the database is back.
+type CircuitBreaker struct {
+	next Service
+
+	// Threshold consecutive connection failures open the circuit.
+	Threshold int
+	// Cooldown is how long the circuit stays open before probing.
+	Cooldown time.Duration
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+var _ Service = (*CircuitBreaker)(nil)
+
+// WithCircuitBreaker wraps next in a circuit breaker configured from
+// DB_BREAKER_THRESHOLD (default 5) and DB_BREAKER_COOLDOWN (default 10s).
+func WithCircuitBreaker(next Service) *CircuitBreaker {
+	b := &CircuitBreaker{next: next, Threshold: 5, Cooldown: 10 * time.Second}
+	if n, err := strconv.Atoi(os.Getenv("DB_BREAKER_THRESHOLD")); err == nil && n > 0 {
+		b.Threshold = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("DB_BREAKER_COOLDOWN")); err == nil && d > 0 {
+		b.Cooldown = d
+	}
+	return b
+}
+
+// Ready reports whether calls would currently reach the database. It is
+// false while the circuit is open and cooling down.
+func (b *CircuitBreaker) Ready() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != circuitOpen || time.Since(b.openedAt) >= b.Cooldown
+}
+
+// RetryAfter returns how long until the open circuit probes again.
+func (b *CircuitBreaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != circuitOpen {
+		return 0
+	}
+	return max(b.Cooldown-time.Since(b.openedAt), 0)
+}
+
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.Cooldown {
+			circuitRejectionsTotal.Inc()
+			return ErrUnavailable
+		}
+		b.setState(circuitHalfOpen)
+		return nil
+	case circuitHalfOpen:
+		// Only the probe may pass until it reports back
+		circuitRejectionsTotal.Inc()
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// record counts the outcome of a call made with ctx. A call that failed
+// because its caller gave up, cancelling ctx or letting its deadline pass,
+// says nothing about the database and counts neither way; a probe ending
+// like that leaves the next call to probe again.
+func (b *CircuitBreaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil && ctx.Err() != nil {
+		if b.state == circuitHalfOpen {
+			b.setState(circuitOpen)
+		}
+		return
+	}
+	if !isConnectionError(err) {
+		b.failures = 0
+		if b.state != circuitClosed {
+			b.setState(circuitClosed)
+		}
+		return
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.Threshold {
+		b.openedAt = time.Now()
+		b.setState(circuitOpen)
+	}
+}
+
+func (b *CircuitBreaker) setState(state circuitState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	circuitStateGauge.Set(float64(state))
+	circuitTransitionsTotal.WithLabelValues(state.String()).Inc()
+}
+
+func (b *CircuitBreaker) do(ctx context.Context, fn func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.record(ctx, err)
+	return err
+}
+
+func call[T any](ctx context.Context, b *CircuitBreaker, fn func() (T, error)) (T, error) {
+	if err := b.allow(); err != nil {
+		var zero T
+		return zero, err
+	}
+	v, err := fn()
+	b.record(ctx, err)
+	return v, err
+}
+
+// isConnectionError reports whether err means the database could not be
+// reached, as opposed to a query that failed on a healthy database.
+func isConnectionError(err error) bool {
+	if err == nil || err == sql.ErrNoRows || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "53300", "57P01", "57P02", "57P03":
+			return true
+		}
+		return len(pgErr.Code) == 5 && pgErr.Code[:2] == "08"
+	}
+	var netErr net.Error
+	var connectErr *pgconn.ConnectError
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) || errors.As(err, &connectErr)
+}
+
+// Health reports the circuit state along with the wrapped service's health.
+// It bypasses the breaker so operators can see the database recover.
+func (b *CircuitBreaker) Health() HealthReport {
+	b.mu.Lock()
+	state := b.state
+	b.mu.Unlock()
+	if state == circuitOpen && !b.Ready() {
+		return HealthReport{Status: "down", Circuit: state.String(), Error: ErrUnavailable.Error()}
+	}
+	report := b.next.Health()
+	report.Circuit = state.String()
+	return report
+}
+
+func (b *CircuitBreaker) Close() error {
+	return b.next.Close()
+}
+
+// ListenUserChanges bypasses the breaker: it runs for the life of the
+// instance and does its own reconnecting.
+func (b *CircuitBreaker) ListenUserChanges(ctx context.Context, fn func(UserChangeNotification)) error {
+	return b.next.ListenUserChanges(ctx, fn)
+}
+
+func (b *CircuitBreaker) MigrationVersion(ctx context.Context) (uint, bool, error) {
+	if err := b.allow(); err != nil {
+		return 0, false, err
+	}
+	version, dirty, err := b.next.MigrationVersion(ctx)
+	b.record(ctx, err)
+	return version, dirty, err
+}
+
+func (b *CircuitBreaker) Migrate(ctx context.Context) error {
+	return b.do(ctx, func() error { return b.next.Migrate(ctx) })
+}
+
+func (b *CircuitBreaker) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	return call(ctx, b, func() (*models.User, error) { return b.next.CreateUser(ctx, user) })
+}
+
+func (b *CircuitBreaker) GetUserByID(ctx context.Context, id string, fields ...string) (*models.User, error) {
+	return call(ctx, b, func() (*models.User, error) { return b.next.GetUserByID(ctx, id, fields...) })
+}
+
+func (b *CircuitBreaker) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return call(ctx, b, func() (*models.User, error) { return b.next.GetUserByEmail(ctx, email) })
+}
+
+func (b *CircuitBreaker) GetUserByUsername(ctx context.Context, name string) (*models.User, error) {
+	return call(ctx, b, func() (*models.User, error) { return b.next.GetUserByUsername(ctx, name) })
+}
+
+func (b *CircuitBreaker) CheckUsernameAvailable(ctx context.Context, name string) (bool, error) {
+	return call(ctx, b, func() (bool, error) { return b.next.CheckUsernameAvailable(ctx, name) })
+}
+
+func (b *CircuitBreaker) UpdateUserByID(ctx context.Context, id string, updates models.UserUpdate) (*models.User, error) {
+	return call(ctx, b, func() (*models.User, error) { return b.next.UpdateUserByID(ctx, id, updates) })
+}
+
+func (b *CircuitBreaker) IssueEmailConfirmation(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	return b.do(ctx, func() error { return b.next.IssueEmailConfirmation(ctx, userID, tokenHash, expiresAt) })
+}
+
+func (b *CircuitBreaker) ConfirmEmailChange(ctx context.Context, tokenHash string) (*models.User, error) {
+	return call(ctx, b, func() (*models.User, error) { return b.next.ConfirmEmailChange(ctx, tokenHash) })
+}
+
+func (b *CircuitBreaker) DeleteUserByID(ctx context.Context, id string) (*models.User, error) {
+	return call(ctx, b, func() (*models.User, error) { return b.next.DeleteUserByID(ctx, id) })
+}
+
+func (b *CircuitBreaker) GetUserByIdentity(ctx context.Context, provider, subject string) (*models.User, error) {
+	return call(ctx, b, func() (*models.User, error) { return b.next.GetUserByIdentity(ctx, provider, subject) })
+}
+
+func (b *CircuitBreaker) LinkIdentity(ctx context.Context, identity *models.Identity) error {
+	return b.do(ctx, func() error { return b.next.LinkIdentity(ctx, identity) })
+}
+
+func (b *CircuitBreaker) UnlinkIdentity(ctx context.Context, userID, provider string) error {
+	return b.do(ctx, func() error { return b.next.UnlinkIdentity(ctx, userID, provider) })
+}
+
+func (b *CircuitBreaker) ListIdentities(ctx context.Context, userID string) ([]models.Identity, error) {
+	return call(ctx, b, func() ([]models.Identity, error) { return b.next.ListIdentities(ctx, userID) })
+}
+
+func (b *CircuitBreaker) GetPasswordHash(ctx context.Context, userID string) (string, error) {
+	return call(ctx, b, func() (string, error) { return b.next.GetPasswordHash(ctx, userID) })
+}
+
+func (b *CircuitBreaker) SetPasswordHash(ctx context.Context, userID, hash string) error {
+	return b.do(ctx, func() error { return b.next.SetPasswordHash(ctx, userID, hash) })
+}
+
+func (b *CircuitBreaker) GetLockedUntil(ctx context.Context, userID string) (*time.Time, error) {
+	return call(ctx, b, func() (*time.Time, error) { return b.next.GetLockedUntil(ctx, userID) })
+}
+
+func (b *CircuitBreaker) RecordFailedLogin(ctx context.Context, userID string, policy LockoutPolicy) (*time.Time, error) {
+	return call(ctx, b, func() (*time.Time, error) { return b.next.RecordFailedLogin(ctx, userID, policy) })
+}
+
+func (b *CircuitBreaker) ResetFailedLogins(ctx context.Context, userID string) error {
+	return b.do(ctx, func() error { return b.next.ResetFailedLogins(ctx, userID) })
+}
+
+func (b *CircuitBreaker) UnlockUser(ctx context.Context, userID string) error {
+	return b.do(ctx, func() error { return b.next.UnlockUser(ctx, userID) })
+}
+
+func (b *CircuitBreaker) SuspendUser(ctx context.Context, id string) (*models.User, error) {
+	return call(ctx, b, func() (*models.User, error) { return b.next.SuspendUser(ctx, id) })
+}
+
+func (b *CircuitBreaker) ActivateUser(ctx context.Context, id string) (*models.User, error) {
+	return call(ctx, b, func() (*models.User, error) { return b.next.ActivateUser(ctx, id) })
+}
+
+func (b *CircuitBreaker) RecordLogin(ctx context.Context, userID string) error {
+	return b.do(ctx, func() error { return b.next.RecordLogin(ctx, userID) })
+}
+
+func (b *CircuitBreaker) TouchLastSeen(ctx context.Context, seen []models.Activity) error {
+	return b.do(ctx, func() error { return b.next.TouchLastSeen(ctx, seen) })
+}
+
+func (b *CircuitBreaker) AnonymizeUser(ctx context.Context, id string) (*models.User, error) {
+	return call(ctx, b, func() (*models.User, error) { return b.next.AnonymizeUser(ctx, id) })
+}
+
+func (b *CircuitBreaker) ExportUserData(ctx context.Context, id string) (*models.UserExport, error) {
+	return call(ctx, b, func() (*models.UserExport, error) { return b.next.ExportUserData(ctx, id) })
+}
+
+func (b *CircuitBreaker) ListUsers(ctx context.Context, filter UserFilter, page Page) ([]models.User, error) {
+	return call(ctx, b, func() ([]models.User, error) { return b.next.ListUsers(ctx, filter, page) })
+}
+
+func (b *CircuitBreaker) GetUsersByIDs(ctx context.Context, ids []string) ([]models.User, error) {
+	return call(ctx, b, func() ([]models.User, error) { return b.next.GetUsersByIDs(ctx, ids) })
+}
+
+func (b *CircuitBreaker) SearchUsers(ctx context.Context, text string, filter UserFilter, page Page) ([]models.User, error) {
+	return call(ctx, b, func() ([]models.User, error) { return b.next.SearchUsers(ctx, text, filter, page) })
+}
+
+func (b *CircuitBreaker) CountUsers(ctx context.Context, filter UserFilter) (int64, error) {
+	return call(ctx, b, func() (int64, error) { return b.next.CountUsers(ctx, filter) })
+}
+
+func (b *CircuitBreaker) UserStats(ctx context.Context, days int) (*models.UserStats, error) {
+	return call(ctx, b, func() (*models.UserStats, error) { return b.next.UserStats(ctx, days) })
+}
+
+func (b *CircuitBreaker) GetIdempotencyRecord(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+	return call(ctx, b, func() (*models.IdempotencyRecord, error) { return b.next.GetIdempotencyRecord(ctx, key) })
+}
+
+func (b *CircuitBreaker) SaveIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	return b.do(ctx, func() error { return b.next.SaveIdempotencyRecord(ctx, record) })
+}
+
+func (b *CircuitBreaker) RecordAudit(ctx context.Context, entry *models.AuditEntry) error {
+	return b.do(ctx, func() error { return b.next.RecordAudit(ctx, entry) })
+}
+
+func (b *CircuitBreaker) ListAuditEntries(ctx context.Context, userID string) ([]models.AuditEntry, error) {
+	return call(ctx, b, func() ([]models.AuditEntry, error) { return b.next.ListAuditEntries(ctx, userID) })
+}
+
+func (b *CircuitBreaker) GetTOTP(ctx context.Context, userID string) (*models.TOTP, error) {
+	return call(ctx, b, func() (*models.TOTP, error) { return b.next.GetTOTP(ctx, userID) })
+}
+
+func (b *CircuitBreaker) EnrollTOTP(ctx context.Context, userID, secret string) error {
+	return b.do(ctx, func() error { return b.next.EnrollTOTP(ctx, userID, secret) })
+}
+
+func (b *CircuitBreaker) EnableTOTP(ctx context.Context, userID string, step int64, recoveryHashes []string) error {
+	return b.do(ctx, func() error { return b.next.EnableTOTP(ctx, userID, step, recoveryHashes) })
+}
+
+func (b *CircuitBreaker) DisableTOTP(ctx context.Context, userID string) error {
+	return b.do(ctx, func() error { return b.next.DisableTOTP(ctx, userID) })
+}
+
+func (b *CircuitBreaker) RegenerateRecoveryCodes(ctx context.Context, userID string, recoveryHashes []string) error {
+	return b.do(ctx, func() error { return b.next.RegenerateRecoveryCodes(ctx, userID, recoveryHashes) })
+}
+
+func (b *CircuitBreaker) RecordTOTPUse(ctx context.Context, userID string, step int64) (bool, error) {
+	return call(ctx, b, func() (bool, error) { return b.next.RecordTOTPUse(ctx, userID, step) })
+}
+
+func (b *CircuitBreaker) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	return call(ctx, b, func() (bool, error) { return b.next.UseRecoveryCode(ctx, userID, codeHash) })
+}
+
+func (b *CircuitBreaker) CreateAPIKey(ctx context.Context, key *models.APIKey, hash string) error {
+	return b.do(ctx, func() error { return b.next.CreateAPIKey(ctx, key, hash) })
+}
+
+func (b *CircuitBreaker) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	return call(ctx, b, func() (*models.APIKey, error) { return b.next.GetAPIKeyByHash(ctx, hash) })
+}
+
+func (b *CircuitBreaker) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	return call(ctx, b, func() ([]models.APIKey, error) { return b.next.ListAPIKeys(ctx) })
+}
+
+func (b *CircuitBreaker) RevokeAPIKey(ctx context.Context, id string) error {
+	return b.do(ctx, func() error { return b.next.RevokeAPIKey(ctx, id) })
+}
+
+func (b *CircuitBreaker) TouchAPIKey(ctx context.Context, id string) error {
+	return b.do(ctx, func() error { return b.next.TouchAPIKey(ctx, id) })
+}
+
+func (b *CircuitBreaker) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	return b.do(ctx, func() error { return b.next.CreateWebhook(ctx, webhook) })
+}
+
+func (b *CircuitBreaker) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	return call(ctx, b, func() (*models.Webhook, error) { return b.next.GetWebhook(ctx, id) })
+}
+
+func (b *CircuitBreaker) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	return call(ctx, b, func() ([]models.Webhook, error) { return b.next.ListWebhooks(ctx) })
+}
+
+func (b *CircuitBreaker) ListWebhooksForEvent(ctx context.Context, eventType string) ([]models.Webhook, error) {
+	return call(ctx, b, func() ([]models.Webhook, error) { return b.next.ListWebhooksForEvent(ctx, eventType) })
+}
+
+func (b *CircuitBreaker) DeleteWebhook(ctx context.Context, id string) error {
+	return b.do(ctx, func() error { return b.next.DeleteWebhook(ctx, id) })
+}
+
+func (b *CircuitBreaker) RecordWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return b.do(ctx, func() error { return b.next.RecordWebhookDelivery(ctx, delivery) })
+}
+
+func (b *CircuitBreaker) ListWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	return call(ctx, b, func() ([]models.WebhookDelivery, error) { return b.next.ListWebhookDeliveries(ctx, webhookID, limit) })
+}
+
+func (b *CircuitBreaker) CreateUsers(ctx context.Context, users []*models.User) error {
+	return b.do(ctx, func() error { return b.next.CreateUsers(ctx, users) })
+}
+
+func (b *CircuitBreaker) UpdateUsers(ctx context.Context, ids []string, updates models.UserUpdate) ([]models.BulkResult, error) {
+	return call(ctx, b, func() ([]models.BulkResult, error) { return b.next.UpdateUsers(ctx, ids, updates) })
+}
+
+func (b *CircuitBreaker) DeleteUsers(ctx context.Context, filter UserFilter, limit int, opts DeleteOptions) (*DeleteResult, error) {
+	return call(ctx, b, func() (*DeleteResult, error) { return b.next.DeleteUsers(ctx, filter, limit, opts) })
+}
+
+func (b *CircuitBreaker) UpsertUserByEmail(ctx context.Context, user *models.User) (bool, error) {
+	return call(ctx, b, func() (bool, error) { return b.next.UpsertUserByEmail(ctx, user) })
+}
+
+func (b *CircuitBreaker) GetUsersChangedSince(ctx context.Context, since time.Time, cursor string, limit int) (*models.ChangeSet, error) {
+	return call(ctx, b, func() (*models.ChangeSet, error) { return b.next.GetUsersChangedSince(ctx, since, cursor, limit) })
+}
+
+func (b *CircuitBreaker) PurgeAnonymizedUsers(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	return call(ctx, b, func() (int64, error) { return b.next.PurgeAnonymizedUsers(ctx, before, limit, dryRun) })
+}
+
+func (b *CircuitBreaker) PurgeExpiredTokens(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	return call(ctx, b, func() (int64, error) { return b.next.PurgeExpiredTokens(ctx, before, limit, dryRun) })
+}
+
+func (b *CircuitBreaker) TrimAuditLog(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	return call(ctx, b, func() (int64, error) { return b.next.TrimAuditLog(ctx, before, limit, dryRun) })
+}
+
+func (b *CircuitBreaker) TrimTombstones(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	return call(ctx, b, func() (int64, error) { return b.next.TrimTombstones(ctx, before, limit, dryRun) })
+}
+
+func (b *CircuitBreaker) EnqueueJob(ctx context.Context, job *models.Job) error {
+	return b.do(ctx, func() error { return b.next.EnqueueJob(ctx, job) })
+}
+
+func (b *CircuitBreaker) ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]models.Job, error) {
+	return call(ctx, b, func() ([]models.Job, error) { return b.next.ClaimJobs(ctx, kinds, limit, lease) })
+}
+
+func (b *CircuitBreaker) CompleteJob(ctx context.Context, id int64) error {
+	return b.do(ctx, func() error { return b.next.CompleteJob(ctx, id) })
+}
+
+func (b *CircuitBreaker) FailJob(ctx context.Context, id int64, message string, retryIn time.Duration) error {
+	return b.do(ctx, func() error { return b.next.FailJob(ctx, id, message, retryIn) })
+}
+
+func (b *CircuitBreaker) ListJobs(ctx context.Context, status models.JobStatus, page Page) ([]models.Job, error) {
+	return call(ctx, b, func() ([]models.Job, error) { return b.next.ListJobs(ctx, status, page) })
+}
+
+func (b *CircuitBreaker) RetryJob(ctx context.Context, id int64) (*models.Job, error) {
+	return call(ctx, b, func() (*models.Job, error) { return b.next.RetryJob(ctx, id) })
+}
+
+func (b *CircuitBreaker) IssuePasswordReset(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	return b.do(ctx, func() error { return b.next.IssuePasswordReset(ctx, userID, tokenHash, expiresAt) })
+}
+
+func (b *CircuitBreaker) ResetPassword(ctx context.Context, tokenHash, hash string) (string, error) {
+	return call(ctx, b, func() (string, error) { return b.next.ResetPassword(ctx, tokenHash, hash) })
+}
+
+func (b *CircuitBreaker) GetNotificationTemplate(ctx context.Context, name string, locales []string) (*models.NotificationTemplate, error) {
+	return call(ctx, b, func() (*models.NotificationTemplate, error) {
+		return b.next.GetNotificationTemplate(ctx, name, locales)
+	})
+}
+
+func (b *CircuitBreaker) ListNotificationTemplates(ctx context.Context) ([]models.NotificationTemplate, error) {
+	return call(ctx, b, func() ([]models.NotificationTemplate, error) { return b.next.ListNotificationTemplates(ctx) })
+}
+
+func (b *CircuitBreaker) PutNotificationTemplate(ctx context.Context, tmpl *models.NotificationTemplate) error {
+	return b.do(ctx, func() error { return b.next.PutNotificationTemplate(ctx, tmpl) })
+}
+
+func (b *CircuitBreaker) DeleteNotificationTemplate(ctx context.Context, name, locale string) error {
+	return b.do(ctx, func() error { return b.next.DeleteNotificationTemplate(ctx, name, locale) })
+}
+
+func (b *CircuitBreaker) ListFeatureFlags(ctx context.Context) ([]models.FeatureFlag, error) {
+	return call(ctx, b, func() ([]models.FeatureFlag, error) { return b.next.ListFeatureFlags(ctx) })
+}
+
+func (b *CircuitBreaker) SetFeatureFlag(ctx context.Context, name string, enabled bool) (*models.FeatureFlag, error) {
+	return call(ctx, b, func() (*models.FeatureFlag, error) { return b.next.SetFeatureFlag(ctx, name, enabled) })
+}
+
+func (b *CircuitBreaker) DeleteFeatureFlag(ctx context.Context, name string) error {
+	return b.do(ctx, func() error { return b.next.DeleteFeatureFlag(ctx, name) })
+}
+
+func (b *CircuitBreaker) GetMetadata(ctx context.Context, userID string) (models.Metadata, error) {
+	return call(ctx, b, func() (models.Metadata, error) { return b.next.GetMetadata(ctx, userID) })
+}
+
+func (b *CircuitBreaker) SetMetadata(ctx context.Context, userID string, md models.Metadata) (models.Metadata, error) {
+	return call(ctx, b, func() (models.Metadata, error) { return b.next.SetMetadata(ctx, userID, md) })
+}
+
+func (b *CircuitBreaker) MergeMetadata(ctx context.Context, userID string, patch models.Metadata) (models.Metadata, error) {
+	return call(ctx, b, func() (models.Metadata, error) { return b.next.MergeMetadata(ctx, userID, patch) })
+}
+
+func (b *CircuitBreaker) AddUserTags(ctx context.Context, id string, tags []string) (*models.User, error) {
+	return call(ctx, b, func() (*models.User, error) { return b.next.AddUserTags(ctx, id, tags) })
+}
+
+func (b *CircuitBreaker) RemoveUserTags(ctx context.Context, id string, tags []string) (*models.User, error) {
+	return call(ctx, b, func() (*models.User, error) { return b.next.RemoveUserTags(ctx, id, tags) })
+}
+
+func (b *CircuitBreaker) CreateGroup(ctx context.Context, group *models.Group) error {
+	return b.do(ctx, func() error { return b.next.CreateGroup(ctx, group) })
+}
+
+func (b *CircuitBreaker) GetGroup(ctx context.Context, id string) (*models.Group, error) {
+	return call(ctx, b, func() (*models.Group, error) { return b.next.GetGroup(ctx, id) })
+}
+
+func (b *CircuitBreaker) ListGroups(ctx context.Context, page Page) ([]models.Group, error) {
+	return call(ctx, b, func() ([]models.Group, error) { return b.next.ListGroups(ctx, page) })
+}
+
+func (b *CircuitBreaker) UpdateGroup(ctx context.Context, id string, updates models.GroupUpdate) (*models.Group, error) {
+	return call(ctx, b, func() (*models.Group, error) { return b.next.UpdateGroup(ctx, id, updates) })
+}
+
+func (b *CircuitBreaker) DeleteGroup(ctx context.Context, id string) error {
+	return b.do(ctx, func() error { return b.next.DeleteGroup(ctx, id) })
+}
+
+func (b *CircuitBreaker) AddUserToGroup(ctx context.Context, groupID, userID string) error {
+	return b.do(ctx, func() error { return b.next.AddUserToGroup(ctx, groupID, userID) })
+}
+
+func (b *CircuitBreaker) RemoveUserFromGroup(ctx context.Context, groupID, userID string) error {
+	return b.do(ctx, func() error { return b.next.RemoveUserFromGroup(ctx, groupID, userID) })
+}
+
+func (b *CircuitBreaker) ListGroupMembers(ctx context.Context, groupID string, page Page) ([]models.User, error) {
+	return call(ctx, b, func() ([]models.User, error) { return b.next.ListGroupMembers(ctx, groupID, page) })
+}
+
+func (b *CircuitBreaker) ListUserGroups(ctx context.Context, userID string) ([]models.Group, error) {
+	return call(ctx, b, func() ([]models.Group, error) { return b.next.ListUserGroups(ctx, userID) })
+}
+
+func (b *CircuitBreaker) GetPreferences(ctx context.Context, userID string) (*models.Preferences, error) {
+	return call(ctx, b, func() (*models.Preferences, error) { return b.next.GetPreferences(ctx, userID) })
+}
+
+func (b *CircuitBreaker) UpdatePreferences(ctx context.Context, userID string, updates models.PreferencesUpdate) (*models.Preferences, error) {
+	return call(ctx, b, func() (*models.Preferences, error) { return b.next.UpdatePreferences(ctx, userID, updates) })
+}
+
+func (b *CircuitBreaker) QueryAudit(ctx context.Context, filter AuditFilter, page Page) ([]models.AuditEntry, error) {
+	return call(ctx, b, func() ([]models.AuditEntry, error) { return b.next.QueryAudit(ctx, filter, page) })
+}
+
+func (b *CircuitBreaker) EachAuditEntry(ctx context.Context, filter AuditFilter, fn func(models.AuditEntry) error) error {
+	return b.do(ctx, func() error { return b.next.EachAuditEntry(ctx, filter, fn) })
+}
+
+func (b *CircuitBreaker) RecordPurgeRun(ctx context.Context, run *models.PurgeRun) error {
+	return b.do(ctx, func() error { return b.next.RecordPurgeRun(ctx, run) })
+}
+
+func (b *CircuitBreaker) ListPurgeRuns(ctx context.Context, job string, page Page) ([]models.PurgeRun, error) {
+	return call(ctx, b, func() ([]models.PurgeRun, error) { return b.next.ListPurgeRuns(ctx, job, page) })
+}
+
+func (b *CircuitBreaker) CountSearchUsers(ctx context.Context, text string, filter UserFilter) (int64, error) {
+	return call(ctx, b, func() (int64, error) { return b.next.CountSearchUsers(ctx, text, filter) })
+}
+
+func (b *CircuitBreaker) CountAudit(ctx context.Context, filter AuditFilter) (int64, error) {
+	return call(ctx, b, func() (int64, error) { return b.next.CountAudit(ctx, filter) })
+}
+
+func (b *CircuitBreaker) CountGroups(ctx context.Context) (int64, error) {
+	return call(ctx, b, func() (int64, error) { return b.next.CountGroups(ctx) })
+}
+
+func (b *CircuitBreaker) CountGroupMembers(ctx context.Context, groupID string) (int64, error) {
+	return call(ctx, b, func() (int64, error) { return b.next.CountGroupMembers(ctx, groupID) })
+}
+
+func (b *CircuitBreaker) FindPotentialDuplicates(ctx context.Context, user *models.User) ([]models.DuplicateCandidate, error) {
+	return call(ctx, b, func() ([]models.DuplicateCandidate, error) { return b.next.FindPotentialDuplicates(ctx, user) })
+}
+
+func (b *CircuitBreaker) MergeUsers(ctx context.Context, primaryID, duplicateID string) (*models.User, error) {
+	return call(ctx, b, func() (*models.User, error) { return b.next.MergeUsers(ctx, primaryID, duplicateID) })
+}
+
+func (b *CircuitBreaker) CountJobs(ctx context.Context, status models.JobStatus) (int64, error) {
+	return call(ctx, b, func() (int64, error) { return b.next.CountJobs(ctx, status) })
+}
+
+func (b *CircuitBreaker) RefreshUserDirectory(ctx context.Context, limit int) (int, error) {
+	return call(ctx, b, func() (int, error) { return b.next.RefreshUserDirectory(ctx, limit) })
+}
+
+func (b *CircuitBreaker) SyncUserFeed(ctx context.Context, consumer string, limit int, apply func(ctx context.Context, batch models.FeedBatch) error) (int, error) {
+	return call(ctx, b, func() (int, error) { return b.next.SyncUserFeed(ctx, consumer, limit, apply) })
+}
+
+func (b *CircuitBreaker) ResetUserFeed(ctx context.Context, consumer string, at time.Time) error {
+	return b.do(ctx, func() error { return b.next.ResetUserFeed(ctx, consumer, at) })
+}
+
+func (b *CircuitBreaker) ScanUsers(ctx context.Context, after string, limit int) ([]models.TenantUser, error) {
+	return call(ctx, b, func() ([]models.TenantUser, error) { return b.next.ScanUsers(ctx, after, limit) })
+}
+
+func (b *CircuitBreaker) PartitionUsers(ctx context.Context, partitions int) error {
+	return b.do(ctx, func() error { return b.next.PartitionUsers(ctx, partitions) })
+}
+
+func (b *CircuitBreaker) UserPartitions(ctx context.Context) ([]models.Partition, error) {
+	return call(ctx, b, func() ([]models.Partition, error) { return b.next.UserPartitions(ctx) })
+}
+
+func (b *CircuitBreaker) MaintainUserPartitions(ctx context.Context) error {
+	return b.do(ctx, func() error { return b.next.MaintainUserPartitions(ctx) })
+}
+
+func (b *CircuitBreaker) EncryptUserPII(ctx context.Context, after string, limit int) (string, int, error) {
+	if err := b.allow(); err != nil {
+		return "", 0, err
+	}
+	last, encrypted, err := b.next.EncryptUserPII(ctx, after, limit)
+	b.record(ctx, err)
+	return last, encrypted, err
+}
+
+func (b *CircuitBreaker) DryRun(ctx context.Context, fn func(ctx context.Context) error) error {
+	return b.do(ctx, func() error { return b.next.DryRun(ctx, fn) })
+}
+
+func (b *CircuitBreaker) ListQuotas(ctx context.Context) ([]models.Quota, error) {
+	return call(ctx, b, func() ([]models.Quota, error) { return b.next.ListQuotas(ctx) })
+}
+
+func (b *CircuitBreaker) SetQuota(ctx context.Context, name string, limit int64) (*models.Quota, error) {
+	return call(ctx, b, func() (*models.Quota, error) { return b.next.SetQuota(ctx, name, limit) })
+}
+
+func (b *CircuitBreaker) DeleteQuota(ctx context.Context, name string) error {
+	return b.do(ctx, func() error { return b.next.DeleteQuota(ctx, name) })
+}
+
+func (b *CircuitBreaker) RecordConsent(ctx context.Context, consent *models.Consent) error {
+	return b.do(ctx, func() error { return b.next.RecordConsent(ctx, consent) })
+}
+
+func (b *CircuitBreaker) GetConsents(ctx context.Context, userID string) ([]models.Consent, error) {
+	return call(ctx, b, func() ([]models.Consent, error) { return b.next.GetConsents(ctx, userID) })
+}
+
+func (b *CircuitBreaker) SnapshotUser(ctx context.Context, id string) (*models.UserSnapshot, error) {
+	return call(ctx, b, func() (*models.UserSnapshot, error) { return b.next.SnapshotUser(ctx, id) })
+}
+
+func (b *CircuitBreaker) RestoreUserSnapshot(ctx context.Context, snapshot *models.UserSnapshot, version int) (*models.User, error) {
+	return call(ctx, b, func() (*models.User, error) { return b.next.RestoreUserSnapshot(ctx, snapshot, version) })
+}
+
+func (b *CircuitBreaker) CreateExportJob(ctx context.Context, job *models.ExportJob) error {
+	return b.do(ctx, func() error { return b.next.CreateExportJob(ctx, job) })
+}
+
+func (b *CircuitBreaker) GetExportJob(ctx context.Context, id int64) (*models.ExportJob, error) {
+	return call(ctx, b, func() (*models.ExportJob, error) { return b.next.GetExportJob(ctx, id) })
+}
+
+func (b *CircuitBreaker) ListExportJobs(ctx context.Context, page Page) ([]models.ExportJob, error) {
+	return call(ctx, b, func() ([]models.ExportJob, error) { return b.next.ListExportJobs(ctx, page) })
+}
+
+func (b *CircuitBreaker) CountExportJobs(ctx context.Context) (int64, error) {
+	return call(ctx, b, func() (int64, error) { return b.next.CountExportJobs(ctx) })
+}
+
+func (b *CircuitBreaker) UpdateExportJob(ctx context.Context, job *models.ExportJob) error {
+	return b.do(ctx, func() error { return b.next.UpdateExportJob(ctx, job) })
+}
+
+func (b *CircuitBreaker) DeleteExportJob(ctx context.Context, id int64) error {
+	return b.do(ctx, func() error { return b.next.DeleteExportJob(ctx, id) })
+}
+
+func (b *CircuitBreaker) EachUser(ctx context.Context, filter UserFilter, fn func(models.User) error) error {
+	return b.do(ctx, func() error { return b.next.EachUser(ctx, filter, fn) })
+}
+
+func (b *CircuitBreaker) RefreshGrowthStats(ctx context.Context) (int64, error) {
+	return call(ctx, b, func() (int64, error) { return b.next.RefreshGrowthStats(ctx) })
+}
+
+func (b *CircuitBreaker) GetGrowthStats(ctx context.Context, from, to time.Time) (*models.GrowthStats, error) {
+	return call(ctx, b, func() (*models.GrowthStats, error) { return b.next.GetGrowthStats(ctx, from, to) })
+}
+
+func (b *CircuitBreaker) PurgeDeadJobs(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	return call(ctx, b, func() (int64, error) { return b.next.PurgeDeadJobs(ctx, before, limit, dryRun) })
+}
+
+func (b *CircuitBreaker) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	return call(ctx, b, func() (*models.IdempotencyRecord, error) { return b.next.ReserveIdempotencyKey(ctx, record) })
+}
+
+func (b *CircuitBreaker) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	return b.do(ctx, func() error { return b.next.ReleaseIdempotencyKey(ctx, key) })
+}
+
+func (b *CircuitBreaker) IssueEmailVerification(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	return b.do(ctx, func() error { return b.next.IssueEmailVerification(ctx, userID, tokenHash, expiresAt) })
+}
+
+func (b *CircuitBreaker) CanonicalizeEmails(ctx context.Context, after string, limit int) (CanonicalEmails, error) {
+	return call(ctx, b, func() (CanonicalEmails, error) { return b.next.CanonicalizeEmails(ctx, after, limit) })
+}
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// CreateUsers inserts users with COPY, which is much faster than individual
+// inserts for large batches such as seeding or imports.
+func (s *service) CreateUsers(ctx context.Context, users []*models.User) error {
+	tenantID := tenant.FromContext(ctx)
+	rows := make([][]any, 0, len(users))
+	for _, user := range users {
+		born, err := storedBirthdate(user, s.now())
+		if err != nil {
+			return err
+		}
+		if user.ID, err = s.newUserID(); err != nil {
+			return err
+		}
+		normalizeUser(ctx, user)
+		email, emailCiphertext, err := sealEmail(s.piiKeys, user.Email)
+		if err != nil {
+			return err
+		}
+		if user.Status == "" {
+			user.Status = newUserStatus(ctx)
+		}
+		rows = append(rows, []any{
+			user.ID, tenantID, user.FirstName, user.LastName, nullIfEmpty(user.Username),
+			email, user.Age, nullIfEmpty(user.PasswordHash), user.Status, nullIfEmpty(user.Locale), born, nullIfEmpty(user.Timezone),
+			emailCiphertext,
+		})
+	}
+
+	columns := []string{"id", "tenant_id", "first_name", "last_name", "username", "email", "age", "password_hash", "status", "locale", "birthdate", "timezone", "email_ciphertext"}
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"users"}, columns, pgx.CopyFromRows(rows)); err != nil {
+			return err
+		}
+		return s.enforceQuota(ctx, tx, QuotaUsers)
+	})
+	if err != nil {
+		for _, user := range users {
+			user.ID = ""
+		}
+		return mapConstraintError(err)
+	}
+	return nil
+}
+
+// ErrBulkUniqueField is returned when a bulk update would give many users
+// the same username or email.
+var ErrBulkUniqueField = errors.New("username and email cannot be set for many users at once")
+
+// UpdateUsers applies updates to all users in ids with a single statement
+// and reports per ID whether it was updated, not found or, being
+// anonymized or merged, not updatable.
+func (s *service) UpdateUsers(ctx context.Context, ids []string, updates models.UserUpdate) ([]models.BulkResult, error) {
+	if updates.Username != nil || updates.Email != nil {
+		return nil, ErrBulkUniqueField
+	}
+	results := make([]models.BulkResult, len(ids))
+	for i, id := range ids {
+		results[i] = models.BulkResult{ID: id, Status: models.BulkNotFound}
+	}
+	if len(ids) == 0 {
+		return results, nil
+	}
+
+	set, params, err := UpdateSet(ctx, s.piiKeys, updates)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`UPDATE users SET %s WHERE id = ANY($%d) AND tenant_id = $%d
+        AND anonymized_at IS NULL AND merged_into IS NULL RETURNING %s`,
+		set, len(params)+1, len(params)+2, selectList("", defaultUserFields))
+	params = append(params, ids, tenant.FromContext(ctx))
+	users, err := s.queryUsers(ctx, s.db, query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := make(map[string]*models.User, len(users))
+	for i := range users {
+		updated[users[i].ID] = &users[i]
+	}
+	var missed []string
+	for i := range results {
+		if user, ok := updated[results[i].ID]; ok {
+			results[i].Status = models.BulkUpdated
+			results[i].User = user
+		} else {
+			missed = append(missed, results[i].ID)
+		}
+	}
+	if len(missed) == 0 {
+		return results, nil
+	}
+
+	// Users that exist but were left alone are anonymized or merged
+	rows, err := s.db.Query(ctx, `SELECT id FROM users WHERE id = ANY($1) AND tenant_id = $2`, missed, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	existing, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if results[i].Status == models.BulkNotFound && slices.Contains(existing, results[i].ID) {
+			results[i].Status = models.BulkNotUpdatable
+		}
+	}
+	return results, nil
+}
+
+// MaxBulkDelete caps the limit of a single DeleteUsers call.
+const MaxBulkDelete = 1000
+
+var (
+	// ErrBulkLimitRequired is returned when DeleteUsers is called without a
+	// positive limit within MaxBulkDelete.
+	ErrBulkLimitRequired = fmt.Errorf("a limit between 1 and %d is required", MaxBulkDelete)
+	// ErrBulkFilterRequired is returned when a bulk delete would match every
+	// user of the tenant.
+	ErrBulkFilterRequired = errors.New("a filter is required to delete users in bulk")
+	// ErrBulkLimitExceeded is returned when more users match than the limit
+	// allows; nothing is deleted then.
+	ErrBulkLimitExceeded = errors.New("more users match than the limit allows")
+)
+
+// DeleteOptions tune DeleteUsers.
+type DeleteOptions struct {
+	// Soft anonymizes the users instead of removing their rows, see
+	// AnonymizeUser. Users that already are anonymized do not match.
+	Soft bool
+}
+
+// DeleteResult reports the outcome of DeleteUsers. Matched is the number of
+// users the filter selects; IDs are the users actually deleted and Users
+// them as they were before a hard or after a soft deletion. DryRun is set
+// by callers that ran DeleteUsers within DryRun.
+type DeleteResult struct {
+	Matched int64         `json:"matched"`
+	IDs     []string      `json:"ids"`
+	DryRun  bool          `json:"dry_run,omitempty"`
+	Users   []models.User `json:"-"`
+}
+
+// DeleteUsers deletes up to limit users matching filter in one
+// transaction. When more users match, nothing is deleted and
+// ErrBulkLimitExceeded is returned along with the count, so callers can
+// narrow the filter or knowingly raise the limit.
+func (s *service) DeleteUsers(ctx context.Context, filter UserFilter, limit int, opts DeleteOptions) (*DeleteResult, error) {
+	if limit <= 0 || limit > MaxBulkDelete {
+		return nil, ErrBulkLimitRequired
+	}
+	if filter.empty() {
+		return nil, ErrBulkFilterRequired
+	}
+	where, args := filter.where(ctx, s.piiKeys, nil)
+	if opts.Soft {
+		where += " AND anonymized_at IS NULL"
+	}
+
+	result := &DeleteResult{}
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		result.IDs, result.Users = []string{}, nil
+		if err := tx.QueryRow(ctx, `SELECT count(*) FROM users`+where, args...).Scan(&result.Matched); err != nil {
+			return err
+		}
+		if result.Matched > int64(limit) {
+			return ErrBulkLimitExceeded
+		}
+
+		rows, err := tx.Query(ctx, `SELECT id FROM users`+where+` ORDER BY id FOR UPDATE`, args...)
+		if err != nil {
+			return err
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return err
+		}
+		if len(ids) > limit {
+			return ErrBulkLimitExceeded
+		}
+
+		result.Users = make([]models.User, 0, len(ids))
+		for _, id := range ids {
+			if opts.Soft {
+				user, err := s.anonymize(ctx, tx, id)
+				if err != nil {
+					return err
+				}
+				result.Users = append(result.Users, *user)
+				continue
+			}
+			query := `DELETE FROM users WHERE id = $1 AND tenant_id = $2 RETURNING ` + selectList("", defaultUserFields)
+			user, err := s.scanUser(tx.QueryRow(ctx, query, id, tenant.FromContext(ctx)))
+			if err != nil {
+				return err
+			}
+			result.Users = append(result.Users, *user)
+			if err := recordAudit(ctx, tx, &models.AuditEntry{Action: models.AuditUserDeleted, TargetUserID: id}); err != nil {
+				return err
+			}
+		}
+		result.IDs = ids
+		return nil
+	})
+	if err != nil {
+		if err == ErrBulkLimitExceeded {
+			return result, err
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// ErrInvalidCursor is returned for change cursors this service did not
+// hand out.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// changeSettleTime keeps the newest changes out of a change set. updated_at
+// is stamped when a transaction writes, not when it commits, so a slow
+// transaction can commit a change older than one already handed out;
+// waiting a little lets those land before the cursor moves past them.
+const changeSettleTime = 5 * time.Second
+
+// settledBefore returns the SQL expression for the time before which
+// every change has committed, given the parameter holding
+// changeSettleTime in seconds. updated_at and deleted_at are the start
+// times of the writing transactions, so no transaction still running can
+// commit a change older than the oldest of them, however long it takes;
+// a transaction left open holds the change sets back until it ends.
+// Transactions of roles the service cannot see in pg_stat_activity are
+// only covered by the settle time, so writers of other roles need the
+// service's role to be a member of pg_read_all_stats.
+func settledBefore(param string) string {
+	return `LEAST(now() - make_interval(secs => ` + param + `), (
+        SELECT min(xact_start) FROM pg_stat_activity
+        WHERE datname = current_database() AND pid <> pg_backend_pid()
+    ))`
+}
+
+// changePosition is where a sync left off: the time of the last change
+// and, to break ties, the user ID.
+type changePosition struct {
+	at time.Time
+	id string
+}
+
+func (p changePosition) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(p.at.UTC().Format(time.RFC3339Nano) + "|" + p.id))
+}
+
+func parseChangeCursor(cursor string) (changePosition, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return changePosition{}, ErrInvalidCursor
+	}
+	at, id, ok := strings.Cut(string(b), "|")
+	if !ok {
+		return changePosition{}, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return changePosition{}, ErrInvalidCursor
+	}
+	return changePosition{at: t, id: id}, nil
+}
+
+// GetUsersChangedSince returns the users created, updated or deleted since
+// since, oldest change first. A non-empty cursor from an earlier change set
+// takes precedence over since. Deletions come from user_tombstones, which a
+// trigger fills whenever a row is removed.
+func (s *service) GetUsersChangedSince(ctx context.Context, since time.Time, cursor string, limit int) (*models.ChangeSet, error) {
+	limit = Page{Limit: limit}.Normalize().Limit
+	pos := changePosition{at: since}
+	if cursor != "" {
+		var err error
+		if pos, err = parseChangeCursor(cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	// Changes are read from the primary: a lagging replica could let the
+	// cursor skip changes it has not replayed yet.
+	tenantID := tenant.FromContext(ctx)
+	set := &models.ChangeSet{Changes: []models.Change{}}
+	err := s.retry(ctx, "GetUsersChangedSince", isTransient, func() error {
+		set.Changes = set.Changes[:0]
+		rows, err := s.db.Query(ctx, `
+            SELECT changed_at, id, deleted FROM (
+                SELECT updated_at AS changed_at, id, false AS deleted FROM users
+                WHERE tenant_id = $1 AND (updated_at, id) > ($2, $3)
+                UNION ALL
+                SELECT deleted_at, user_id, true FROM user_tombstones
+                WHERE tenant_id = $1 AND (deleted_at, user_id) > ($2, $3)
+            ) c
+            WHERE changed_at < `+settledBefore("$4")+`
+            ORDER BY changed_at, id, deleted
+            LIMIT $5
+        `, tenantID, pos.at, pos.id, changeSettleTime.Seconds(), limit+1)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var c models.Change
+			if err := rows.Scan(&c.ChangedAt, &c.ID, &c.Deleted); err != nil {
+				return err
+			}
+			set.Changes = append(set.Changes, c)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if set.HasMore = len(set.Changes) > limit; set.HasMore {
+		set.Changes = set.Changes[:limit]
+	}
+	if n := len(set.Changes); n > 0 {
+		pos = changePosition{at: set.Changes[n-1].ChangedAt, id: set.Changes[n-1].ID}
+	}
+	set.Cursor = pos.String()
+
+	var ids []string
+	for _, c := range set.Changes {
+		if !c.Deleted {
+			ids = append(ids, c.ID)
+		}
+	}
+	users, err := s.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*models.User, len(users))
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+	}
+	// A user deleted since the first query is left out; the sync reaches
+	// its tombstone later on.
+	changes := set.Changes[:0]
+	for _, c := range set.Changes {
+		if !c.Deleted {
+			if c.User = byID[c.ID]; c.User == nil {
+				continue
+			}
+		}
+		changes = append(changes, c)
+	}
+	set.Changes = changes
+	return set, nil
+}
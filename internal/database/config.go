@@ -0,0 +1,75 @@
+package database
+
+import (
+	"os"
+
+	"users/internal/config"
+	"users/internal/pii"
+	"users/internal/secrets"
+)
+
+// CheckConfig records in r every problem with the database settings of
+// the environment, so they can be reported together with those of the
+// rest of the service before anything connects. New runs the same checks.
+func CheckConfig(r *config.Report) {
+	checkConfig(r, options{})
+}
+
+func checkConfig(r *config.Report, o options) {
+	r.Check(checkDriver())
+	if o.dsn == "" && o.pool == nil {
+		checkConnection(r)
+	}
+	_, err := statementTimeout()
+	r.Check(err)
+	_, err = slowQueryThreshold()
+	r.Check(err)
+	_, err = withTimeouts(nil)
+	r.Check(err)
+	_, err = secrets.FromEnv()
+	r.Check(err)
+	_, err = pii.FromEnv()
+	r.Check(err)
+	if o.newID == nil {
+		_, err = idGeneratorFromEnv()
+		r.Check(err)
+	}
+	if o.faults == nil {
+		_, err = FaultsFromEnv()
+		r.Check(err)
+	}
+	r.Int("DB_RETRY_MAX_ATTEMPTS", 1)
+	r.Int("DB_BREAKER_THRESHOLD", 1)
+	for _, key := range []string{
+		"DB_CREDENTIALS_TTL", "DB_RETRY_BASE_DELAY", "DB_RETRY_MAX_DELAY", "DB_BREAKER_COOLDOWN",
+		"DB_POOL_METRICS_INTERVAL", "DB_READ_MODEL_MAX_LAG",
+	} {
+		r.Duration(key)
+	}
+	r.Bool("DB_READ_MODEL")
+	for _, name := range quotaNames() {
+		r.Int(quotas[name].env, 0)
+	}
+}
+
+// checkConnection checks the settings the connection strings of the
+// primary and the replicas are built from.
+func checkConnection(r *config.Report) {
+	if os.Getenv("DATABASE_URL") == "" {
+		const why = "unless DATABASE_URL is set"
+		r.Required("DB_HOST", why)
+		r.Required("DB_PORT", why)
+		r.Required("DB_DATABASE", why)
+		if os.Getenv("DB_CREDENTIALS_PROVIDER") == "" {
+			r.Required("DB_USERNAME", "unless DATABASE_URL or DB_CREDENTIALS_PROVIDER is set")
+		}
+		r.Port("DB_PORT")
+	}
+	r.Int("DB_CONNECT_TIMEOUT", 0)
+	if _, err := baseURL(); err != nil {
+		r.Check(err)
+		return
+	}
+	_, err := replicaDSNs()
+	r.Check(err)
+}
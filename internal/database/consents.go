@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// RecordConsent appends consent to the consents of consent.UserID. It
+// returns sql.ErrNoRows if the tenant has no such user.
+func (s *service) RecordConsent(ctx context.Context, consent *models.Consent) error {
+	query := `
+        INSERT INTO consents (tenant_id, user_id, kind, version, granted, source_ip)
+        SELECT $1, id, $3, $4, $5, NULLIF($6, '') FROM users WHERE id = $2 AND tenant_id = $1
+        RETURNING id, recorded_at
+    `
+	return s.db.QueryRow(ctx, query, tenant.FromContext(ctx), consent.UserID, consent.Kind, consent.Version, consent.Granted, consent.SourceIP).
+		Scan(&consent.ID, &consent.RecordedAt)
+}
+
+// GetConsents returns every consent the user gave or withdrew, in the
+// order they were recorded.
+func (s *service) GetConsents(ctx context.Context, userID string) ([]models.Consent, error) {
+	rows, err := s.db.Query(ctx, listConsentsQuery, tenant.FromContext(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanConsents(rows)
+}
+
+const listConsentsQuery = `
+    SELECT id, user_id, kind, version, granted, COALESCE(source_ip, ''), recorded_at
+    FROM consents
+    WHERE tenant_id = $1 AND user_id = $2
+    ORDER BY recorded_at, id
+`
+
+func scanConsents(rows pgx.Rows) ([]models.Consent, error) {
+	consents, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Consent, error) {
+		var c models.Consent
+		err := row.Scan(&c.ID, &c.UserID, &c.Kind, &c.Version, &c.Granted, &c.SourceIP, &c.RecordedAt)
+		return c, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if consents == nil {
+		consents = []models.Consent{}
+	}
+	return consents, nil
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"users/internal/secrets"
+)
+
+// defaultCredentialsTTL is how long fetched credentials are reused, and at
+// the same time the longest a connection lives, so a rotated password
+// replaces the old one on all connections within that time.
+const defaultCredentialsTTL = 5 * time.Minute
+
+// credentialsFromEnv returns the cached secret store from
+// DB_CREDENTIALS_PROVIDER, nil when credentials come from DB_* or
+// DATABASE_URL. DB_CREDENTIALS_TTL overrides the refresh interval.
+func credentialsFromEnv() (*secrets.Cache, error) {
+	provider, err := secrets.FromEnv()
+	if err != nil || provider == nil {
+		return nil, err
+	}
+	ttl := defaultCredentialsTTL
+	if d, err := time.ParseDuration(os.Getenv("DB_CREDENTIALS_TTL")); err == nil && d > 0 {
+		ttl = d
+	}
+	return &secrets.Cache{Provider: provider, TTL: ttl}, nil
+}
+
+// useCredentials makes every new connection of cfg authenticate with the
+// current credentials of creds.
+func useCredentials(cfg *pgxpool.Config, creds *secrets.Cache) {
+	cfg.BeforeConnect = func(ctx context.Context, cc *pgx.ConnConfig) error {
+		c, err := creds.Credentials(ctx)
+		if err != nil {
+			return err
+		}
+		if c.Username != "" {
+			cc.User = c.Username
+		}
+		cc.Password = c.Password
+		return nil
+	}
+	cfg.MaxConnLifetime = min(cfg.MaxConnLifetime, creds.TTL)
+}
+
+// isAuthError reports whether the server rejected the credentials, which
+// after a rotation means the cached ones are stale.
+func isAuthError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == "28P01" || pgErr.Code == "28000")
+}
+
+// refreshCredentials drops the cached credentials when err says they were
+// rejected and reports whether a retry may now succeed.
+func (s *service) refreshCredentials(err error) bool {
+	if s.credentials == nil || !isAuthError(err) {
+		return false
+	}
+	s.credentials.Invalidate()
+	return true
+}
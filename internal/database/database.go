@@ -3,184 +3,745 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log"
-	"os"
-	"strconv"
+	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/config"
+	"users/internal/flags"
 	"users/internal/models"
+	"users/internal/pii"
+	"users/internal/secrets"
+	"users/internal/tenant"
+	"users/internal/validator"
 
-	"github.com/google/uuid"
-	_ "github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/joho/godotenv/autoload"
 )
 
-// Service represents a service that interacts with a database.
+// Service is everything the database provides. Consumers should depend on
+// the narrower interfaces it is composed of, or declare their own, so they
+// and their fakes only need what they use.
 type Service interface {
-	// Health returns a map of health status information.
-	// The keys and values in the map are service-specific.
-	Health() map[string]string
+	HealthChecker
+	Migrator
+	UserRepository
+	CredentialStore
+	ConsentStore
+	APIKeyStore
+	WebhookStore
+	AuditLog
+	GroupStore
+	IdempotencyStore
+	JobStore
+	ExportJobStore
+	TemplateStore
+	FlagStore
+	QuotaStore
+	Purger
+	ReadModel
+	Partitioner
+	GrowthStatsStore
+	PIIEncrypter
+	EmailCanonicalizer
+	DryRunner
 
-	// Close terminates the database connection.
-	// It returns an error if the connection cannot be closed.
-	Close() error
+	// Close terminates the database connections.
+	io.Closer
+}
 
-	CreateUser(user *models.User) error
-	GetUserByID(id string) (*models.User, error)
-	UpdateUserByID(id string, updates models.UserUpdate) (*models.User, error)
+// HealthChecker reports on the state of the database.
+type HealthChecker interface {
+	// Health reports whether the database is reachable together with its
+	// latency, schema version, pool statistics and replica lag.
+	Health() HealthReport
 }
 
-type service struct {
-	db *sql.DB
+// Migrator manages the schema.
+type Migrator interface {
+	// Migrate applies all pending embedded schema migrations.
+	Migrate(ctx context.Context) error
+	// MigrationVersion returns the applied schema version and dirty flag.
+	MigrationVersion(ctx context.Context) (uint, bool, error)
 }
 
-var (
-	database   = os.Getenv("DB_DATABASE")
-	password   = os.Getenv("DB_PASSWORD")
-	username   = os.Getenv("DB_USERNAME")
-	port       = os.Getenv("DB_PORT")
-	host       = os.Getenv("DB_HOST")
-	dbInstance *service
-)
+// UserRepository stores users. Its operations are scoped to the tenant
+// carried by ctx, see package tenant.
+type UserRepository interface {
+	// CreateUser inserts user with the ID it has, if any, or a generated
+	// one, and returns the user as stored, with its ID and timestamps. A
+	// chosen ID another user of any tenant has fails with ErrUserExists.
+	CreateUser(ctx context.Context, user *models.User) (*models.User, error)
+	// CreateUsers bulk inserts users in a single COPY, setting their IDs.
+	// Either all of them are created or none.
+	CreateUsers(ctx context.Context, users []*models.User) error
+	// UpsertUserByEmail creates the user or updates the one with its email,
+	// reporting whether it was created.
+	UpsertUserByEmail(ctx context.Context, user *models.User) (bool, error)
+	// GetUserByID returns the user with the given ID. When fields are given
+	// only the matching columns are selected and populated.
+	GetUserByID(ctx context.Context, id string, fields ...string) (*models.User, error)
+	// GetUserByEmail looks a user up by email, ignoring case.
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	// GetUserByUsername looks a user up by username, ignoring case.
+	GetUserByUsername(ctx context.Context, name string) (*models.User, error)
+	// CheckUsernameAvailable reports whether no user holds name yet.
+	CheckUsernameAvailable(ctx context.Context, name string) (bool, error)
+	// UpdateUserByID applies updates. A changed email is stored as the
+	// pending email and needs IssueEmailConfirmation and ConfirmEmailChange.
+	UpdateUserByID(ctx context.Context, id string, updates models.UserUpdate) (*models.User, error)
+	// UpdateUsers applies the same update to many users in one statement.
+	// Username and email cannot be bulk updated; the version is ignored.
+	UpdateUsers(ctx context.Context, ids []string, updates models.UserUpdate) ([]models.BulkResult, error)
+	IssueEmailConfirmation(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error
+	// IssueEmailVerification sends a pending user through
+	// ConfirmEmailChange to verify the email they signed up with.
+	IssueEmailVerification(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error
+	// ConfirmEmailChange returns ErrEmailTaken when the address was claimed
+	// by another user since the change was requested.
+	ConfirmEmailChange(ctx context.Context, tokenHash string) (*models.User, error)
+	// DeleteUserByID removes the user and returns it as it was before deletion.
+	DeleteUserByID(ctx context.Context, id string) (*models.User, error)
+	// DeleteUsers deletes or, with opts.Soft, anonymizes the users matching
+	// filter. It refuses to touch more than limit users.
+	DeleteUsers(ctx context.Context, filter UserFilter, limit int, opts DeleteOptions) (*DeleteResult, error)
+	// SuspendUser moves the user to suspended, ActivateUser to active.
+	// Both return ErrInvalidTransition when the current status forbids it.
+	SuspendUser(ctx context.Context, id string) (*models.User, error)
+	ActivateUser(ctx context.Context, id string) (*models.User, error)
+	// RecordLogin stamps the user's last_login_at.
+	RecordLogin(ctx context.Context, userID string) error
+	// TouchLastSeen updates last_seen_at for a batch of users.
+	TouchLastSeen(ctx context.Context, seen []models.Activity) error
+	// AnonymizeUser scrubs the user's personal data but keeps the row.
+	AnonymizeUser(ctx context.Context, id string) (*models.User, error)
+	// MergeUsers folds the duplicate into the primary, keeping the
+	// duplicate as a merged user, and returns the updated primary.
+	MergeUsers(ctx context.Context, primaryID, duplicateID string) (*models.User, error)
+	// ExportUserData returns everything stored about a user as one bundle.
+	ExportUserData(ctx context.Context, id string) (*models.UserExport, error)
+	// SnapshotUser returns the user's profile, metadata and preferences as
+	// they are now. RestoreUserSnapshot puts them back, provided the user
+	// is still at version.
+	SnapshotUser(ctx context.Context, id string) (*models.UserSnapshot, error)
+	RestoreUserSnapshot(ctx context.Context, snapshot *models.UserSnapshot, version int) (*models.User, error)
+	// ListUsers returns a page of users matching filter, oldest first.
+	ListUsers(ctx context.Context, filter UserFilter, page Page) ([]models.User, error)
+	// GetUsersByIDs returns the existing users among ids in one round trip.
+	GetUsersByIDs(ctx context.Context, ids []string) ([]models.User, error)
+	// SearchUsers full-text searches names and email, best matches first.
+	SearchUsers(ctx context.Context, text string, filter UserFilter, page Page) ([]models.User, error)
+	// CountSearchUsers returns the number of users SearchUsers finds.
+	CountSearchUsers(ctx context.Context, text string, filter UserFilter) (int64, error)
+	// FindPotentialDuplicates returns users that may be the same person as
+	// user, by similar name or email, most likely first.
+	FindPotentialDuplicates(ctx context.Context, user *models.User) ([]models.DuplicateCandidate, error)
+	// GetUsersChangedSince returns a page of users created, updated or
+	// deleted since since, resuming at cursor when one is given.
+	GetUsersChangedSince(ctx context.Context, since time.Time, cursor string, limit int) (*models.ChangeSet, error)
+	// ListenUserChanges calls fn for every committed change to a user, from
+	// any instance, until ctx is done.
+	ListenUserChanges(ctx context.Context, fn func(UserChangeNotification)) error
+	// CountUsers returns the number of users matching filter.
+	CountUsers(ctx context.Context, filter UserFilter) (int64, error)
+	// UserStats aggregates signups over the last days days and ages.
+	UserStats(ctx context.Context, days int) (*models.UserStats, error)
+	// AddUserTags and RemoveUserTags change the tags the user carries and
+	// return the updated user.
+	AddUserTags(ctx context.Context, id string, tags []string) (*models.User, error)
+	RemoveUserTags(ctx context.Context, id string, tags []string) (*models.User, error)
+	// GetPreferences returns the user's preferences, the defaults when
+	// they never changed them.
+	GetPreferences(ctx context.Context, userID string) (*models.Preferences, error)
+	// UpdatePreferences changes the preferences set in updates.
+	UpdatePreferences(ctx context.Context, userID string, updates models.PreferencesUpdate) (*models.Preferences, error)
+	// GetMetadata returns the custom attributes attached to the user.
+	GetMetadata(ctx context.Context, userID string) (models.Metadata, error)
+	// SetMetadata replaces the user's metadata.
+	SetMetadata(ctx context.Context, userID string, md models.Metadata) (models.Metadata, error)
+	// MergeMetadata updates the given keys of the user's metadata; nil
+	// values remove keys.
+	MergeMetadata(ctx context.Context, userID string, patch models.Metadata) (models.Metadata, error)
+}
 
-func New() Service {
-	// Reuse Connection
-	if dbInstance != nil {
-		return dbInstance
-	}
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", username, password, host, port, database)
-	db, err := sql.Open("pgx", connStr)
-	if err != nil {
-		log.Fatal(err)
-	}
-	dbInstance = &service{
-		db: db,
-	}
-	return dbInstance
+// CredentialStore holds what users sign in with: passwords, external
+// identities, lockouts and second factors.
+type CredentialStore interface {
+	// GetUserByIdentity returns the user linked to an external account.
+	GetUserByIdentity(ctx context.Context, provider, subject string) (*models.User, error)
+	LinkIdentity(ctx context.Context, identity *models.Identity) error
+	UnlinkIdentity(ctx context.Context, userID, provider string) error
+	ListIdentities(ctx context.Context, userID string) ([]models.Identity, error)
+	// GetPasswordHash returns the user's password hash, empty when the user
+	// has not set a password.
+	GetPasswordHash(ctx context.Context, userID string) (string, error)
+	// SetPasswordHash replaces the user's password hash.
+	SetPasswordHash(ctx context.Context, userID, hash string) error
+	// IssuePasswordReset stores the hash of a password reset token.
+	IssuePasswordReset(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error
+	// ResetPassword sets a new password for the holder of a valid reset
+	// token and returns their ID.
+	ResetPassword(ctx context.Context, tokenHash, hash string) (string, error)
+	// GetLockedUntil returns when the user's lockout ends, nil if unlocked.
+	GetLockedUntil(ctx context.Context, userID string) (*time.Time, error)
+	RecordFailedLogin(ctx context.Context, userID string, policy LockoutPolicy) (*time.Time, error)
+	ResetFailedLogins(ctx context.Context, userID string) error
+	UnlockUser(ctx context.Context, userID string) error
+	GetTOTP(ctx context.Context, userID string) (*models.TOTP, error)
+	// EnrollTOTP stores a pending TOTP secret for the user.
+	EnrollTOTP(ctx context.Context, userID, secret string) error
+	// EnableTOTP activates the pending secret and sets the recovery codes.
+	EnableTOTP(ctx context.Context, userID string, step int64, recoveryHashes []string) error
+	DisableTOTP(ctx context.Context, userID string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID string, recoveryHashes []string) error
+	// RecordTOTPUse rejects replays of an already used code.
+	RecordTOTPUse(ctx context.Context, userID string, step int64) (bool, error)
+	// UseRecoveryCode consumes a recovery code, reporting whether it was valid.
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error)
 }
 
-// Health checks the health of the database connection by pinging the database.
-// It returns a map with keys indicating various health statistics.
-func (s *service) Health() map[string]string {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
+// ConsentStore records the consents users give and withdraw, such as to
+// the terms of service.
+type ConsentStore interface {
+	// RecordConsent appends a consent event; the latest of each kind is the
+	// one in force.
+	RecordConsent(ctx context.Context, consent *models.Consent) error
+	// GetConsents returns the user's consent events in the order they were
+	// recorded.
+	GetConsents(ctx context.Context, userID string) ([]models.Consent, error)
+}
 
-	stats := make(map[string]string)
+// APIKeyStore stores API keys.
+type APIKeyStore interface {
+	// CreateAPIKey stores a new API key; only its hash is persisted.
+	CreateAPIKey(ctx context.Context, key *models.APIKey, hash string) error
+	// GetAPIKeyByHash resolves an active API key from the hash of its secret.
+	GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+	TouchAPIKey(ctx context.Context, id string) error
+}
 
-	// Ping the database
-	err := s.db.PingContext(ctx)
-	if err != nil {
-		stats["status"] = "down"
-		stats["error"] = fmt.Sprintf("db down: %v", err)
-		log.Fatalf(fmt.Sprintf("db down: %v", err)) // Log the error and terminate the program
-		return stats
-	}
+// WebhookStore stores webhooks and their deliveries.
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	GetWebhook(ctx context.Context, id string) (*models.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]models.Webhook, error)
+	// ListWebhooksForEvent returns the active webhooks subscribed to an event type.
+	ListWebhooksForEvent(ctx context.Context, eventType string) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+	RecordWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	ListWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error)
+}
 
-	// Database is up, add more statistics
-	stats["status"] = "up"
-	stats["message"] = "It's healthy"
+// AuditLog records who changed what.
+type AuditLog interface {
+	// RecordAudit appends an entry to the audit log.
+	RecordAudit(ctx context.Context, entry *models.AuditEntry) error
+	// ListAuditEntries returns the audit entries targeting a user.
+	ListAuditEntries(ctx context.Context, userID string) ([]models.AuditEntry, error)
+	// QueryAudit returns a page of the entries matching filter, newest
+	// first.
+	QueryAudit(ctx context.Context, filter AuditFilter, page Page) ([]models.AuditEntry, error)
+	CountAudit(ctx context.Context, filter AuditFilter) (int64, error)
+	// EachAuditEntry calls fn with every entry matching filter, oldest
+	// first, stopping at the first error.
+	EachAuditEntry(ctx context.Context, filter AuditFilter, fn func(models.AuditEntry) error) error
+}
 
-	// Get database stats (like open connections, in use, idle, etc.)
-	dbStats := s.db.Stats()
-	stats["open_connections"] = strconv.Itoa(dbStats.OpenConnections)
-	stats["in_use"] = strconv.Itoa(dbStats.InUse)
-	stats["idle"] = strconv.Itoa(dbStats.Idle)
-	stats["wait_count"] = strconv.FormatInt(dbStats.WaitCount, 10)
-	stats["wait_duration"] = dbStats.WaitDuration.String()
-	stats["max_idle_closed"] = strconv.FormatInt(dbStats.MaxIdleClosed, 10)
-	stats["max_lifetime_closed"] = strconv.FormatInt(dbStats.MaxLifetimeClosed, 10)
+// GroupStore manages groups of users and their members, scoped to the
+// tenant carried by ctx.
+type GroupStore interface {
+	// CreateGroup returns ErrGroupNameTaken when the name is in use.
+	CreateGroup(ctx context.Context, group *models.Group) error
+	GetGroup(ctx context.Context, id string) (*models.Group, error)
+	ListGroups(ctx context.Context, page Page) ([]models.Group, error)
+	CountGroups(ctx context.Context) (int64, error)
+	UpdateGroup(ctx context.Context, id string, updates models.GroupUpdate) (*models.Group, error)
+	// DeleteGroup removes the group and its memberships.
+	DeleteGroup(ctx context.Context, id string) error
+	// AddUserToGroup adds a member; adding one again is a no-op.
+	AddUserToGroup(ctx context.Context, groupID, userID string) error
+	RemoveUserFromGroup(ctx context.Context, groupID, userID string) error
+	// ListGroupMembers returns a page of members in the order they joined.
+	ListGroupMembers(ctx context.Context, groupID string, page Page) ([]models.User, error)
+	CountGroupMembers(ctx context.Context, groupID string) (int64, error)
+	// ListUserGroups returns every group the user is a member of.
+	ListUserGroups(ctx context.Context, userID string) ([]models.Group, error)
+}
 
-	// Evaluate stats to provide a health message
-	if dbStats.OpenConnections > 40 { // Assuming 50 is the max for this example
-		stats["message"] = "The database is experiencing heavy load."
-	}
+// IdempotencyStore keeps the results of requests for replay.
+type IdempotencyStore interface {
+	// GetIdempotencyRecord returns the stored result for an idempotency key.
+	GetIdempotencyRecord(ctx context.Context, key string) (*models.IdempotencyRecord, error)
+	// ReserveIdempotencyKey claims a key for a request about to run,
+	// returning the record holding it instead if there is one.
+	ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+	// SaveIdempotencyRecord stores the result of a request for later replay.
+	SaveIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error
+	// ReleaseIdempotencyKey drops a reservation whose request failed.
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+}
 
-	if dbStats.WaitCount > 1000 {
-		stats["message"] = "The database has a high number of wait events, indicating potential bottlenecks."
-	}
+// JobStore is the background job queue.
+type JobStore interface {
+	// EnqueueJob stores a background job for the tenant of ctx.
+	EnqueueJob(ctx context.Context, job *models.Job) error
+	// ClaimJobs locks due jobs of the given kinds for a worker.
+	ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]models.Job, error)
+	CompleteJob(ctx context.Context, id int64) error
+	// FailJob schedules a retry, or marks the job dead after its last attempt.
+	FailJob(ctx context.Context, id int64, message string, retryIn time.Duration) error
+	// ListJobs returns a page of the jobs of the tenant of ctx.
+	ListJobs(ctx context.Context, status models.JobStatus, page Page) ([]models.Job, error)
+	// CountJobs returns the number of jobs with status, or of all jobs
+	// when it is empty.
+	CountJobs(ctx context.Context, status models.JobStatus) (int64, error)
+	// RetryJob requeues a dead job of the tenant of ctx with a fresh set
+	// of attempts.
+	RetryJob(ctx context.Context, id int64) (*models.Job, error)
+}
+
+// ExportJobStore tracks exports of users running in the background,
+// scoped to the tenant carried by ctx.
+type ExportJobStore interface {
+	// CreateExportJob stores a pending export job and audits it.
+	CreateExportJob(ctx context.Context, job *models.ExportJob) error
+	GetExportJob(ctx context.Context, id int64) (*models.ExportJob, error)
+	// ListExportJobs returns a page of export jobs, newest first.
+	ListExportJobs(ctx context.Context, page Page) ([]models.ExportJob, error)
+	CountExportJobs(ctx context.Context) (int64, error)
+	// UpdateExportJob stores the progress and outcome of a job.
+	UpdateExportJob(ctx context.Context, job *models.ExportJob) error
+	DeleteExportJob(ctx context.Context, id int64) error
+	// EachUser calls fn with every user matching filter, oldest first,
+	// stopping at the first error.
+	EachUser(ctx context.Context, filter UserFilter, fn func(models.User) error) error
+}
+
+// TemplateStore holds tenants' notification templates.
+type TemplateStore interface {
+	// GetNotificationTemplate returns the tenant's template called name for
+	// the first of locales it has one for.
+	GetNotificationTemplate(ctx context.Context, name string, locales []string) (*models.NotificationTemplate, error)
+	ListNotificationTemplates(ctx context.Context) ([]models.NotificationTemplate, error)
+	// PutNotificationTemplate creates or replaces a template.
+	PutNotificationTemplate(ctx context.Context, tmpl *models.NotificationTemplate) error
+	DeleteNotificationTemplate(ctx context.Context, name, locale string) error
+}
+
+// FlagStore holds tenants' feature flag overrides.
+type FlagStore interface {
+	// ListFeatureFlags returns the flag overrides of every tenant.
+	ListFeatureFlags(ctx context.Context) ([]models.FeatureFlag, error)
+	// SetFeatureFlag and DeleteFeatureFlag manage the overrides of the
+	// tenant of ctx.
+	SetFeatureFlag(ctx context.Context, name string, enabled bool) (*models.FeatureFlag, error)
+	DeleteFeatureFlag(ctx context.Context, name string) error
+}
+
+// QuotaStore holds the quotas of tenants: defaults read from the QUOTA_*
+// variables, overridden per tenant. The service enforces them itself,
+// failing changes that exceed one with a *QuotaError.
+type QuotaStore interface {
+	// ListQuotas returns every quota as it applies to the tenant of ctx.
+	ListQuotas(ctx context.Context) ([]models.Quota, error)
+	// SetQuota and DeleteQuota manage the overrides of the tenant of ctx.
+	SetQuota(ctx context.Context, name string, limit int64) (*models.Quota, error)
+	DeleteQuota(ctx context.Context, name string) error
+}
+
+// ReadModel maintains the denormalized tables that serve heavy reads.
+type ReadModel interface {
+	// RefreshUserDirectory applies up to limit pending changes to the user
+	// directory lists and searches read from, returning how many it
+	// applied.
+	RefreshUserDirectory(ctx context.Context, limit int) (int, error)
+	// SyncUserFeed hands the next batch of the change feed to apply on
+	// behalf of consumer, such as a search indexer, and moves consumer past
+	// it once apply succeeds.
+	SyncUserFeed(ctx context.Context, consumer string, limit int, apply func(ctx context.Context, batch models.FeedBatch) error) (int, error)
+	// ResetUserFeed makes consumer see every change since at again.
+	ResetUserFeed(ctx context.Context, consumer string, at time.Time) error
+	// ScanUsers pages through the users of all tenants by ID.
+	ScanUsers(ctx context.Context, after string, limit int) ([]models.TenantUser, error)
+}
+
+// Purger removes data that is no longer needed across all tenants.
+type Purger interface {
+	// PurgeAnonymizedUsers, PurgeExpiredTokens, PurgeDeadJobs,
+	// TrimAuditLog and TrimTombstones remove data that is no longer needed
+	// across all tenants, or only count it with dryRun.
+	PurgeAnonymizedUsers(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error)
+	PurgeExpiredTokens(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error)
+	PurgeDeadJobs(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error)
+	TrimAuditLog(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error)
+	TrimTombstones(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error)
+	// RecordPurgeRun and ListPurgeRuns keep the reports of those runs.
+	RecordPurgeRun(ctx context.Context, run *models.PurgeRun) error
+	ListPurgeRuns(ctx context.Context, job string, page Page) ([]models.PurgeRun, error)
+}
+
+// GrowthStatsStore keeps daily aggregates of the users of every tenant so
+// dashboards need not count them at request time.
+type GrowthStatsStore interface {
+	// RefreshGrowthStats recounts the signups, deletions and active users
+	// of recent days across all tenants, returning how many days it wrote.
+	RefreshGrowthStats(ctx context.Context) (int64, error)
+	// GetGrowthStats returns the daily growth of the tenant of ctx from
+	// the day of from through the day of to (UTC).
+	GetGrowthStats(ctx context.Context, from, to time.Time) (*models.GrowthStats, error)
+}
+
+// DryRunner runs operations without persisting their changes.
+type DryRunner interface {
+	// DryRun runs fn in a transaction rolled back once it returns; the
+	// operations fn runs with its context change nothing.
+	DryRun(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// PIIEncrypter brings the encryption of stored personal data up to date.
+type PIIEncrypter interface {
+	// EncryptUserPII encrypts with the current key the emails of up to
+	// limit users after the ID after that are in plaintext or under an
+	// older key, returning the last ID it looked at, "" once done, and how
+	// many it encrypted. It returns ErrPIIEncryptionDisabled unless
+	// PII_ENCRYPTION_KEYS is set.
+	EncryptUserPII(ctx context.Context, after string, limit int) (string, int, error)
+}
+
+// EmailCanonicalizer brings the Gmail addresses stored before a tenant
+// turned on canonical_gmail into the form the flag stores them in.
+type EmailCanonicalizer interface {
+	CanonicalizeEmails(ctx context.Context, after string, limit int) (CanonicalEmails, error)
+}
+
+// Partitioner turns the users table into one partitioned by tenant and
+// keeps the partitions in shape.
+type Partitioner interface {
+	// PartitionUsers rebuilds the users table as the given number of
+	// partitions hashed on tenant_id, returning ErrAlreadyPartitioned if it
+	// is partitioned already. The table is locked while it is copied.
+	PartitionUsers(ctx context.Context, partitions int) error
+	// UserPartitions lists the partitions, or none while the table is not
+	// partitioned.
+	UserPartitions(ctx context.Context) ([]models.Partition, error)
+	// MaintainUserPartitions refreshes the statistics of the partitioned
+	// table and reports the size of each partition.
+	MaintainUserPartitions(ctx context.Context) error
+}
+
+// ErrVersionConflict is returned when an update expected a version of the
+// user that is no longer current.
+var ErrVersionConflict = errors.New("user version conflict")
+
+type service struct {
+	db *pool
+	// retryPolicy applies to reads and to transactions aborted by
+	// serialization failures.
+	retryPolicy RetryPolicy
+	// replicas take the reads that tolerate replication lag; nil without
+	// configured replicas.
+	replicas *replicaSet
+	// credentials come from a secret store when configured; see
+	// DB_CREDENTIALS_PROVIDER.
+	credentials *secrets.Cache
+	// piiKeys encrypt email addresses when PII_ENCRYPTION_KEYS is set; nil
+	// stores them in plaintext.
+	piiKeys *pii.Keyring
+	// directory decides whether lists read the user_directory read model.
+	directory *directory
+	// stopMetrics ends the export of pool statistics.
+	stopMetrics chan struct{}
+	// closeOnce makes closing the service more than once harmless.
+	closeOnce sync.Once
+
+	logger *log.Logger
+	now    func() time.Time
+	newID  IDGenerator
+	// quotaDefaults are the limits of tenants without an override of
+	// their own.
+	quotaDefaults map[string]int64
+}
+
+// connectTimeout bounds the ping New sends to check the primary is
+// reachable.
+const connectTimeout = 10 * time.Second
 
-	if dbStats.MaxIdleClosed > int64(dbStats.OpenConnections)/2 {
-		stats["message"] = "Many idle connections are being closed, consider revising the connection pool settings."
+// New connects to the database configured in the environment, or through
+// opts. Each call returns a new service with its own pools; callers close
+// it when done. Configuration problems are reported all at once, as a
+// *config.Error, before connecting.
+func New(opts ...Option) (Service, error) {
+	o := newOptions(opts)
+	var report config.Report
+	checkConfig(&report, o)
+	if err := report.Err(); err != nil {
+		return nil, err
+	}
+	timeout, err := statementTimeout()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := credentialsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	piiKeys, err := pii.FromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if o.newID == nil {
+		if o.newID, err = idGeneratorFromEnv(); err != nil {
+			return nil, err
+		}
+	}
+	if o.faults == nil {
+		if o.faults, err = FaultsFromEnv(); err != nil {
+			return nil, err
+		}
+	}
+	if o.faults.Enabled() {
+		o.logger.Printf("Injecting database faults: %+v", *o.faults)
+	}
+	poolOpts := poolOptions{credentials: creds, faults: o.faults}
+	if threshold, err := slowQueryThreshold(); err != nil {
+		return nil, err
+	} else if threshold > 0 {
+		poolOpts.tracer = slowQueryLogger{threshold: threshold}
+	}
+	dsns, err := replicaDSNs()
+	if err != nil {
+		return nil, err
 	}
 
-	if dbStats.MaxLifetimeClosed > int64(dbStats.OpenConnections)/2 {
-		stats["message"] = "Many connections are being closed due to max lifetime, consider increasing max lifetime or revising the connection usage pattern."
+	var db *pool
+	if o.pool != nil {
+		db = &pool{Pool: o.pool, faults: o.faults}
+	} else {
+		connStr := o.dsn
+		if connStr == "" {
+			if connStr, err = primaryDSN(); err != nil {
+				return nil, err
+			}
+		}
+		if db, err = newPool(context.Background(), withStatementTimeout(connStr, timeout), poolOpts); err != nil {
+			return nil, err
+		}
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	if err := db.Ping(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+	s := &service{
+		db:          db,
+		retryPolicy: retryPolicyFromEnv(),
+		credentials: creds,
+		piiKeys:     piiKeys,
+		directory:   directoryFromEnv(),
+		logger:      o.logger,
+		now:         o.now,
+		newID:       o.newID,
 
-	return stats
+		quotaDefaults: quotaDefaultsFromEnv(),
+	}
+	if len(dsns) > 0 {
+		for i := range dsns {
+			dsns[i] = withStatementTimeout(dsns[i], timeout)
+		}
+		if s.replicas, err = newReplicaSet(dsns, poolOpts, o.logger); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	s.stopMetrics = make(chan struct{})
+	go s.exportPoolMetrics(poolMetricsInterval(), s.stopMetrics)
+	timeouts, err := withTimeouts(s)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return instrument(timeouts), nil
 }
 
 // Close closes the database connection.
 // It logs a message indicating the disconnection from the specific database.
 // If the connection is successfully closed, it returns nil.
 // If an error occurs while closing the connection, it returns the error.
+// Closing an already closed service does nothing.
 func (s *service) Close() error {
-	log.Printf("Disconnected from database: %s", database)
-	return s.db.Close()
+	s.closeOnce.Do(func() {
+		s.logger.Printf("Disconnected from database: %s", s.db.Config().ConnConfig.Database)
+		close(s.stopMetrics)
+		s.replicas.close()
+		s.db.Close()
+	})
+	return nil
 }
 
-func (s *service) CreateUser(user *models.User) error {
-	id := uuid.New()
+func (s *service) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	id, chosen := user.ID, user.ID != ""
+	if !chosen {
+		var err error
+		if id, err = s.newUserID(); err != nil {
+			return nil, err
+		}
+	} else if err := validator.ValidateID(id); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidID, err)
+	}
 	query := `
-        INSERT INTO users (id, first_name, last_name, email, age)
-        VALUES ($1, $2, $3, $4, $5)
-    `
-	log.Printf("Executing query: %s with values: %s, %s, %s, %s, %d", query, id, user.FirstName, user.LastName, user.Email, user.Age)
-	_, err := s.db.Exec(query, id, user.FirstName, user.LastName, user.Email, user.Age)
+        INSERT INTO users (id, tenant_id, first_name, last_name, username, email, age, password_hash, status, locale, birthdate, timezone, email_ciphertext)
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, NULLIF($8, ''), $9, NULLIF($10, ''), $11, NULLIF($12, ''), $13)
+        RETURNING ` + selectList("", defaultUserFields)
+	born, err := storedBirthdate(user, s.now())
 	if err != nil {
-		log.Printf("Error executing query: %v", err)
-		return err
+		return nil, err
 	}
-	//user.ID = id.String() // Устанавливаем ID в объекте user
-	return nil
+	normalizeUser(ctx, user)
+	email, emailCiphertext, err := sealEmail(s.piiKeys, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status == "" {
+		user.Status = newUserStatus(ctx)
+	}
+	args := []any{id, tenant.FromContext(ctx), user.FirstName, user.LastName, user.Username, email, user.Age, user.PasswordHash, user.Status, user.Locale, born, user.Timezone, emailCiphertext}
+	var created *models.User
+	err = s.inTx(ctx, func(tx pgx.Tx) error {
+		if chosen {
+			// Generated IDs are unique by construction, chosen ones are
+			// checked against every tenant
+			if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('user-id:' || $1))`, id); err != nil {
+				return err
+			}
+			var taken bool
+			if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, id).Scan(&taken); err != nil {
+				return err
+			}
+			if taken {
+				return ErrUserExists
+			}
+		}
+		var err error
+		if created, err = s.scanUser(tx.QueryRow(ctx, query, args...)); err != nil {
+			return err
+		}
+		return s.enforceQuota(ctx, tx, QuotaUsers)
+	})
+	if err != nil {
+		s.logger.Printf("Error executing query: %v", err)
+		return nil, mapConstraintError(err)
+	}
+	return created, nil
 }
 
-func (s *service) GetUserByID(id string) (*models.User, error) {
+func (s *service) GetUserByID(ctx context.Context, id string, fields ...string) (*models.User, error) {
+	if len(fields) == 0 {
+		fields = defaultUserFields
+	}
+
 	var user models.User
-	query := `SELECT id, first_name, last_name, email, age FROM users WHERE id = $1`
-	err := s.db.QueryRow(query, id).Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Age)
+	columns, dest, err := s.userColumns(&user, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM users WHERE id = $1 AND tenant_id = $2`, selectList("", columns))
+	err = s.read(ctx, "GetUserByID", func(db conn) error {
+		return db.QueryRow(ctx, query, id, tenant.FromContext(ctx)).Scan(dest...)
+	})
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (s *service) UpdateUserByID(id string, updates models.UserUpdate) (*models.User, error) {
-	query := "UPDATE users SET "
-	params := []interface{}{}
-	paramId := 1
+func (s *service) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	query := `SELECT ` + selectList("", defaultUserFields) + ` FROM users WHERE lower(email) = ANY($1) AND tenant_id = $2`
+	var user *models.User
+	err := s.retry(ctx, "GetUserByEmail", isTransient, func() (err error) {
+		user, err = s.scanUser(s.db.QueryRow(ctx, query, emailLookup(s.piiKeys, normalizeEmail(ctx, email)), tenant.FromContext(ctx)))
+		return err
+	})
+	return user, err
+}
+
+func (s *service) GetUserByUsername(ctx context.Context, name string) (*models.User, error) {
+	query := `SELECT ` + selectList("", defaultUserFields) + ` FROM users WHERE lower(username) = lower($1) AND tenant_id = $2`
+	var user *models.User
+	err := s.retry(ctx, "GetUserByUsername", isTransient, func() (err error) {
+		user, err = s.scanUser(s.db.QueryRow(ctx, query, name, tenant.FromContext(ctx)))
+		return err
+	})
+	return user, err
+}
+
+func (s *service) CheckUsernameAvailable(ctx context.Context, name string) (bool, error) {
+	var taken bool
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE lower(username) = lower($1) AND tenant_id = $2)`
+	err := s.retry(ctx, "CheckUsernameAvailable", isTransient, func() error {
+		return s.db.QueryRow(ctx, query, name, tenant.FromContext(ctx)).Scan(&taken)
+	})
+	return !taken, err
+}
 
-	if updates.FirstName != nil {
-		query += fmt.Sprintf("first_name = $%d, ", paramId)
-		params = append(params, *updates.FirstName)
-		paramId++
+func (s *service) UpdateUserByID(ctx context.Context, id string, updates models.UserUpdate) (*models.User, error) {
+	set, params, err := UpdateSet(ctx, s.piiKeys, updates)
+	if err != nil {
+		return nil, err
 	}
-	if updates.LastName != nil {
-		query += fmt.Sprintf("last_name = $%d, ", paramId)
-		params = append(params, *updates.LastName)
-		paramId++
+	query := "UPDATE users SET " + set
+	paramId := len(params) + 1
+	query += fmt.Sprintf(" WHERE id = $%d AND tenant_id = $%d", paramId, paramId+1)
+	params = append(params, id, tenant.FromContext(ctx))
+	paramId += 2
+	if updates.Version != nil {
+		query += fmt.Sprintf(" AND version = $%d", paramId)
+		params = append(params, *updates.Version)
 	}
-	if updates.Age != nil {
-		query += fmt.Sprintf("age = $%d, ", paramId)
-		params = append(params, *updates.Age)
-		paramId++
+	query += " RETURNING " + selectList("", defaultUserFields)
+
+	user, err := s.scanUser(s.db.QueryRow(ctx, query, params...))
+	if err == sql.ErrNoRows && updates.Version != nil {
+		// Tell a stale version apart from a missing user
+		var exists bool
+		err := s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND tenant_id = $2)`, id, tenant.FromContext(ctx)).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, ErrVersionConflict
+		}
 	}
-	if updates.Email != nil {
-		query += fmt.Sprintf("email = $%d, ", paramId)
-		params = append(params, *updates.Email)
-		paramId++
+	if err != nil {
+		return nil, mapConstraintError(err)
 	}
 
-	// Remove the last comma and add the WHERE clause
-	query = query[:len(query)-2] + fmt.Sprintf(" WHERE id = $%d RETURNING id, first_name, last_name, email, age", paramId)
-	params = append(params, id)
+	return user, nil
+}
 
-	var user models.User
-	err := s.db.QueryRow(query, params...).Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Age)
-	if err != nil {
-		return nil, err
-	}
+// normalizeEmail is applied to every email written or looked up so that
+// addresses compare case-insensitively and, for tenants with the
+// canonical_gmail flag, Gmail spellings of one mailbox match.
+func normalizeEmail(ctx context.Context, email string) string {
+	return validator.NormalizeEmail(email, flags.Enabled(ctx, flags.CanonicalGmail))
+}
 
-	return &user, nil
+// normalizeUser brings the names and email of a new user into the form
+// they are stored and compared in.
+func normalizeUser(ctx context.Context, user *models.User) {
+	user.FirstName = validator.NormalizeName(user.FirstName)
+	user.LastName = validator.NormalizeName(user.LastName)
+	user.Email = normalizeEmail(ctx, user.Email)
+}
+
+func (s *service) DeleteUserByID(ctx context.Context, id string) (*models.User, error) {
+	query := `DELETE FROM users WHERE id = $1 AND tenant_id = $2 RETURNING ` + selectList("", defaultUserFields)
+	return s.scanUser(s.db.QueryRow(ctx, query, id, tenant.FromContext(ctx)))
 }
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrReadModelDisabled is returned by RefreshUserDirectory unless
+// DB_READ_MODEL is set.
+var ErrReadModelDisabled = errors.New("the user directory read model is disabled")
+
+// directoryColumns are copied from users into user_directory.
+const directoryColumns = `id, tenant_id, first_name, last_name, username, email, pending_email, locale, timezone,
+    tags, status, age, birthdate, created, updated_at, version, merged_into, anonymized_at,
+    last_login_at, last_seen_at, metadata, search_vector, email_ciphertext, pending_email_ciphertext`
+
+// defaultDirectoryMaxLag is how far the read model may fall behind before
+// queries go back to the users table, unless DB_READ_MODEL_MAX_LAG says
+// otherwise.
+const defaultDirectoryMaxLag = 30 * time.Second
+
+// directory tracks whether the user_directory read model can serve list
+// queries.
+type directory struct {
+	enabled bool
+	maxLag  time.Duration
+	// caughtUp is when the projection last reached the end of the change
+	// feed, in Unix nanoseconds.
+	caughtUp atomic.Int64
+}
+
+// directoryFromEnv reads DB_READ_MODEL and DB_READ_MODEL_MAX_LAG.
+func directoryFromEnv() *directory {
+	d := &directory{enabled: os.Getenv("DB_READ_MODEL") == "true", maxLag: defaultDirectoryMaxLag}
+	if lag, err := time.ParseDuration(os.Getenv("DB_READ_MODEL_MAX_LAG")); err == nil && lag > 0 {
+		d.maxLag = lag
+	}
+	return d
+}
+
+// userSource returns the table list queries read: the read model while it
+// is enabled and fresh, the users table otherwise.
+func (s *service) userSource() string {
+	d := s.directory
+	if d == nil || !d.enabled {
+		return "users"
+	}
+	if time.Since(time.Unix(0, d.caughtUp.Load())) > d.maxLag {
+		return "users"
+	}
+	return "user_directory"
+}
+
+// RefreshUserDirectory applies up to limit changes from the change feed to
+// the user_directory read model and returns how many it applied. When
+// another instance is refreshing, it only takes note of how far that one
+// got.
+func (s *service) RefreshUserDirectory(ctx context.Context, limit int) (int, error) {
+	if s.directory == nil || !s.directory.enabled {
+		return 0, ErrReadModelDisabled
+	}
+	limit = Page{Limit: limit}.Normalize().Limit
+
+	var applied int
+	var caughtUp *time.Time
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		applied = 0
+		locked, err := lockFeed(ctx, tx, feedUserDirectory)
+		if err != nil {
+			return err
+		}
+		if !locked {
+			caughtUp, err = feedCaughtUp(ctx, tx, feedUserDirectory)
+			return err
+		}
+
+		b, err := readFeed(ctx, tx, feedUserDirectory, limit)
+		if err != nil {
+			return err
+		}
+		if len(b.deleted) > 0 {
+			if _, err := tx.Exec(ctx, `DELETE FROM user_directory WHERE id = ANY($1)`, b.deleted); err != nil {
+				return err
+			}
+		}
+		if len(b.changed) > 0 {
+			if _, err := tx.Exec(ctx, upsertDirectoryQuery, b.changed); err != nil {
+				return err
+			}
+		}
+		applied = b.size
+		caughtUp, err = b.advance(ctx, tx, limit)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if caughtUp != nil {
+		s.directory.caughtUp.Store(caughtUp.UnixNano())
+	}
+	return applied, nil
+}
+
+// upsertDirectoryQuery copies the current state of the users with the IDs
+// in $1. Users deleted in the meantime are skipped; their tombstones come
+// later in the feed.
+var upsertDirectoryQuery = func() string {
+	var set []string
+	for _, c := range strings.Split(directoryColumns, ",") {
+		if c = strings.TrimSpace(c); c != "id" {
+			set = append(set, c+" = EXCLUDED."+c)
+		}
+	}
+	return `
+        INSERT INTO user_directory (` + directoryColumns + `)
+        SELECT ` + directoryColumns + ` FROM users WHERE id = ANY($1)
+        ON CONFLICT (id) DO UPDATE SET ` + strings.Join(set, ", ")
+}()
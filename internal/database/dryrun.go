@@ -0,0 +1,32 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type dryRunKey struct{}
+
+// dryRunTx returns the transaction of the dry run ctx belongs to, or nil.
+func dryRunTx(ctx context.Context) pgx.Tx {
+	t, _ := ctx.Value(dryRunKey{}).(pgx.Tx)
+	return t
+}
+
+// DryRun runs fn in a transaction that is rolled back once fn returns, so
+// the operations fn runs with the context it is given validate, check
+// constraints and see their own changes as usual, but persist nothing.
+// Reads go to the primary. Advisory locks the operations take are real
+// and held as usual. DryRun returns fn's error.
+func (s *service) DryRun(ctx context.Context, fn func(ctx context.Context) error) error {
+	if dryRunTx(ctx) != nil {
+		return fn(ctx)
+	}
+	t, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback(context.WithoutCancel(ctx))
+	return fn(context.WithValue(ctx, dryRunKey{}, t))
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// defaultApplicationName identifies the service in pg_stat_activity unless
+// DB_APPLICATION_NAME says otherwise.
+const defaultApplicationName = "users"
+
+// primaryDSN returns the connection string of the primary. DATABASE_URL
+// takes precedence over the separate DB_* variables; either way
+// DB_SSLMODE, DB_SSLROOTCERT, DB_APPLICATION_NAME and DB_CONNECT_TIMEOUT
+// are applied on top.
+func primaryDSN() (string, error) {
+	u, err := baseURL()
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// replicaDSN returns the primary's connection string pointed at another
+// host, for replicas that share its database and credentials.
+func replicaDSN(hostport string) (string, error) {
+	u, err := baseURL()
+	if err != nil {
+		return "", err
+	}
+	if _, _, err := net.SplitHostPort(hostport); err != nil {
+		p := u.Port()
+		if p == "" {
+			p = "5432"
+		}
+		hostport = net.JoinHostPort(hostport, p)
+	}
+	u.Host = hostport
+	return u.String(), nil
+}
+
+func baseURL() (*url.URL, error) {
+	var u *url.URL
+	if raw := os.Getenv("DATABASE_URL"); raw != "" {
+		var err error
+		if u, err = url.Parse(raw); err != nil {
+			return nil, fmt.Errorf("DATABASE_URL: %w", err)
+		}
+		if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+			return nil, fmt.Errorf("DATABASE_URL: unsupported scheme %q", u.Scheme)
+		}
+	} else {
+		u = &url.URL{
+			Scheme: "postgres",
+			User:   url.UserPassword(os.Getenv("DB_USERNAME"), os.Getenv("DB_PASSWORD")),
+			Host:   net.JoinHostPort(os.Getenv("DB_HOST"), os.Getenv("DB_PORT")),
+			Path:   "/" + os.Getenv("DB_DATABASE"),
+		}
+	}
+
+	q := u.Query()
+	setParam(q, "sslmode", os.Getenv("DB_SSLMODE"), "disable")
+	setParam(q, "sslrootcert", os.Getenv("DB_SSLROOTCERT"), "")
+	setParam(q, "application_name", os.Getenv("DB_APPLICATION_NAME"), defaultApplicationName)
+	setParam(q, "connect_timeout", os.Getenv("DB_CONNECT_TIMEOUT"), "")
+	if mode := q.Get("sslmode"); !validSSLMode(mode) {
+		return nil, fmt.Errorf("unsupported sslmode %q", mode)
+	}
+	u.RawQuery = q.Encode()
+	return u, nil
+}
+
+// setParam sets key to value when given. Otherwise fallback fills it in
+// unless the connection string already carries the parameter.
+func setParam(q url.Values, key, value, fallback string) {
+	switch {
+	case value != "":
+		q.Set(key, value)
+	case !q.Has(key) && fallback != "":
+		q.Set(key, fallback)
+	}
+}
+
+func validSSLMode(mode string) bool {
+	switch strings.ToLower(mode) {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		return true
+	}
+	return false
+}
+
+// unsupportedDrivers names the DB_DRIVER values people reach for that this
+// service cannot run on, with the reason.
+var unsupportedDrivers = map[string]string{
+	"sqlite": "the schema relies on PostgreSQL triggers, JSONB, LISTEN/NOTIFY and SKIP LOCKED; use `make docker-run` for a local database",
+	"mysql":  "the schema relies on PostgreSQL triggers, JSONB, LISTEN/NOTIFY and partial unique indexes; run PostgreSQL alongside the MySQL deployment",
+}
+
+// checkDriver validates DB_DRIVER. PostgreSQL is the only backend, so the
+// setting exists to fail loudly instead of connecting somewhere unexpected.
+func checkDriver() error {
+	switch d := strings.ToLower(os.Getenv("DB_DRIVER")); d {
+	case "", "postgres", "postgresql", "pgx":
+		return nil
+	default:
+		if why, ok := unsupportedDrivers[d]; ok {
+			return fmt.Errorf("DB_DRIVER %s is not supported: %s", d, why)
+		}
+		return fmt.Errorf("unknown DB_DRIVER %q", d)
+	}
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"users/internal/models"
+	"users/internal/tenant"
+	"users/internal/validator"
+)
+
+// MaxDuplicateCandidates bounds the users FindPotentialDuplicates returns.
+const MaxDuplicateCandidates = 10
+
+// fullNameExpr is the expression the trigram index on users is built on.
+const fullNameExpr = `lower(first_name || ' ' || last_name)`
+
+// mailboxExpr reduces the email expression %[1]s to the mailbox it
+// delivers to: +tags are dropped everywhere, and dots too for Gmail. It
+// matches what canonical_gmail stores, applied to every tenant.
+const mailboxExpr = `(CASE WHEN split_part(%[1]s, '@', 2) IN ('gmail.com', 'googlemail.com')
+        THEN replace(split_part(split_part(%[1]s, '@', 1), '+', 1), '.', '') || '@gmail.com'
+        ELSE split_part(split_part(%[1]s, '@', 1), '+', 1) || '@' || split_part(%[1]s, '@', 2) END)`
+
+// FindPotentialDuplicates returns the tenant's users, other than user
+// itself, whose full name is similar to user's by trigram similarity
+// (pg_trgm's default threshold of 0.3) or whose email reaches the same
+// mailbox. Email matches come first, then the most similar names. user
+// need not be stored yet.
+func (s *service) FindPotentialDuplicates(ctx context.Context, user *models.User) ([]models.DuplicateCandidate, error) {
+	name := strings.ToLower(validator.NormalizeName(user.FirstName) + " " + validator.NormalizeName(user.LastName))
+	// Encrypted emails only match exactly, through their blind index
+	email := normalizeEmail(ctx, user.Email)
+	if s.piiKeys != nil {
+		email = s.piiKeys.BlindIndex(email)
+	}
+	mailbox, wanted := fmt.Sprintf(mailboxExpr, "lower(email)"), fmt.Sprintf(mailboxExpr, "$4::text")
+	query := fmt.Sprintf(`
+        SELECT %[1]s, similarity(%[2]s, $3) AS score, %[3]s = %[4]s AS same_mailbox, %[2]s %% $3 AS similar_name
+        FROM users
+        WHERE tenant_id = $1 AND id <> $2 AND anonymized_at IS NULL AND status <> 'merged'
+          AND (%[2]s %% $3 OR %[3]s = %[4]s)
+        ORDER BY same_mailbox DESC, score DESC, id
+        LIMIT $5
+    `, selectList("", defaultUserFields), fullNameExpr, mailbox, wanted)
+
+	var candidates []models.DuplicateCandidate
+	err := s.read(ctx, "FindPotentialDuplicates", func(db conn) error {
+		rows, err := db.Query(ctx, query, tenant.FromContext(ctx), user.ID, name, email, MaxDuplicateCandidates)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		candidates = []models.DuplicateCandidate{}
+		for rows.Next() {
+			var c models.DuplicateCandidate
+			var sameMailbox, similarName bool
+			_, dest, err := s.userColumns(&c.User, defaultUserFields)
+			if err != nil {
+				return err
+			}
+			if err := rows.Scan(append(dest, &c.Score, &sameMailbox, &similarName)...); err != nil {
+				return err
+			}
+			if sameMailbox {
+				c.Reasons = append(c.Reasons, models.DuplicateEmail)
+			}
+			if similarName {
+				c.Reasons = append(c.Reasons, models.DuplicateName)
+			}
+			candidates = append(candidates, c)
+		}
+		return rows.Err()
+	})
+	return candidates, err
+}
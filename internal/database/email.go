@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+	"users/internal/validator"
+)
+
+// ErrEmailTaken is returned when confirming an email change to an address
+// another user claimed in the meantime.
+var ErrEmailTaken = errors.New("email address is already in use")
+
+// IssueEmailConfirmation attaches a confirmation token to the user's pending
+// email, replacing any earlier token.
+func (s *service) IssueEmailConfirmation(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	res, err := s.db.Exec(ctx, `
+        UPDATE users SET email_token_hash = $3, email_token_expires_at = $4
+        WHERE id = $1 AND tenant_id = $2 AND pending_email IS NOT NULL
+    `, userID, tenant.FromContext(ctx), tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// IssueEmailVerification attaches a verification token to the current
+// email of a pending user, replacing any earlier token. It returns
+// sql.ErrNoRows for users no longer pending or changing their email, whose
+// confirmation verifies them instead.
+func (s *service) IssueEmailVerification(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	res, err := s.db.Exec(ctx, `
+        UPDATE users SET email_token_hash = $3, email_token_expires_at = $4
+        WHERE id = $1 AND tenant_id = $2 AND status = 'pending' AND pending_email IS NULL
+    `, userID, tenant.FromContext(ctx), tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ConfirmEmailChange swaps in the pending email of the user holding an
+// unexpired token, or only verifies the current one when none is pending.
+// Either proves the user owns their address, so a pending user becomes
+// active. It returns sql.ErrNoRows for unknown or expired tokens.
+func (s *service) ConfirmEmailChange(ctx context.Context, tokenHash string) (*models.User, error) {
+	query := `
+        UPDATE users
+        SET email = COALESCE(pending_email, email),
+            email_ciphertext = CASE WHEN pending_email IS NULL THEN email_ciphertext ELSE pending_email_ciphertext END,
+            status = CASE WHEN status = 'pending' THEN 'active' ELSE status END,
+            pending_email = NULL,
+            pending_email_ciphertext = NULL,
+            email_token_hash = NULL,
+            email_token_expires_at = NULL,
+            version = version + 1,
+            updated_at = now()
+        WHERE email_token_hash = $1 AND tenant_id = $2 AND email_token_expires_at > now()
+        RETURNING ` + selectList("", defaultUserFields)
+	user, err := s.scanUser(s.db.QueryRow(ctx, query, tokenHash, tenant.FromContext(ctx)))
+	if err != nil {
+		return nil, mapConstraintError(err)
+	}
+	return user, nil
+}
+
+// EmailConflict is a user whose canonical Gmail address another user of the
+// tenant already holds.
+type EmailConflict struct {
+	UserID string
+	Email  string
+	// HeldBy is the user holding the canonical address.
+	HeldBy string
+}
+
+// CanonicalEmails is a batch of CanonicalizeEmails.
+type CanonicalEmails struct {
+	// Last is the last ID looked at, "" once done.
+	Last string
+	// Changed counts the users whose address was rewritten.
+	Changed int
+	// Conflicts are the users left as they were.
+	Conflicts []EmailConflict
+}
+
+// CanonicalizeEmails rewrites the Gmail addresses of up to limit users of
+// the tenant of ctx after the ID after into their canonical form, as the
+// canonical_gmail flag stores them. Users whose canonical address is held
+// by another user keep theirs and are reported as conflicts, to be merged
+// or changed by hand.
+func (s *service) CanonicalizeEmails(ctx context.Context, after string, limit int) (CanonicalEmails, error) {
+	limit = Page{Limit: limit}.Normalize().Limit
+	tenantID := tenant.FromContext(ctx)
+
+	type stored struct {
+		id, email string
+	}
+	var batch CanonicalEmails
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		batch = CanonicalEmails{}
+		rows, err := tx.Query(ctx, `
+            SELECT id, COALESCE(email_ciphertext, email)
+            FROM users WHERE tenant_id = $1 AND id > $2 ORDER BY id LIMIT $3
+            FOR UPDATE
+        `, tenantID, after, limit)
+		if err != nil {
+			return err
+		}
+		page, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (stored, error) {
+			var u stored
+			err := row.Scan(&u.id, sealedString{s.piiKeys, &u.email})
+			return u, err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, u := range page {
+			batch.Last = u.id
+			canonical := validator.NormalizeEmail(u.email, true)
+			if canonical == u.email {
+				continue
+			}
+			var holder string
+			err := tx.QueryRow(ctx, `SELECT id FROM users WHERE tenant_id = $1 AND email = ANY($2) AND id <> $3 LIMIT 1`,
+				tenantID, emailLookup(s.piiKeys, canonical), u.id).Scan(&holder)
+			if err == nil {
+				batch.Conflicts = append(batch.Conflicts, EmailConflict{UserID: u.id, Email: u.email, HeldBy: holder})
+				continue
+			}
+			if err != pgx.ErrNoRows {
+				return err
+			}
+			email, ciphertext, err := sealEmail(s.piiKeys, canonical)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, `
+                UPDATE users SET email = $3, email_ciphertext = $4, version = version + 1, updated_at = now()
+                WHERE id = $1 AND tenant_id = $2
+            `, u.id, tenantID, email, ciphertext)
+			if err != nil {
+				return mapConstraintError(err)
+			}
+			batch.Changed++
+		}
+		return nil
+	})
+	if err != nil {
+		return CanonicalEmails{}, err
+	}
+	return batch, nil
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrUsernameTaken is returned when another user of the tenant already
+// holds the username.
+var ErrUsernameTaken = errors.New("username is already taken")
+
+// ErrGroupNameTaken is returned when another group of the tenant already
+// has the name.
+var ErrGroupNameTaken = errors.New("group name is already taken")
+
+// mapConstraintError turns unique violations into the
+// errors callers can act on, leaving every other error untouched.
+func mapConstraintError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return err
+	}
+	// A partitioned users table reports the index of the partition
+	switch partitionIndexSuffix.ReplaceAllString(pgErr.ConstraintName, "") {
+	case "users_tenant_id_email_key", "users_tenant_id_lower_email_key":
+		return ErrEmailTaken
+	case "users_pkey":
+		return ErrUserExists
+	case "users_tenant_id_lower_username_key":
+		return ErrUsernameTaken
+	case "groups_tenant_id_lower_name_key":
+		return ErrGroupNameTaken
+	case "jobs_key_idx":
+		return ErrJobQueued
+	}
+	return err
+}
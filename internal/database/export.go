@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// ExportUserData gathers everything stored about the user into one bundle.
+// The queries are sent as one batch, so the export costs a single round
+// trip and sees a consistent set of rows.
+func (s *service) ExportUserData(ctx context.Context, id string) (*models.UserExport, error) {
+	var user models.User
+	columns, dest, err := s.userColumns(&user, models.UserFields)
+	if err != nil {
+		return nil, err
+	}
+	tenantID := tenant.FromContext(ctx)
+
+	batch := &pgx.Batch{}
+	batch.Queue(fmt.Sprintf(`SELECT %s FROM users WHERE id = $1 AND tenant_id = $2`, selectList("", columns)), id, tenantID)
+	batch.Queue(`SELECT metadata FROM users WHERE id = $1 AND tenant_id = $2`, id, tenantID)
+	batch.Queue(getPreferencesQuery, getPreferencesArgs(ctx, id)...)
+	batch.Queue(listIdentitiesQuery, tenantID, id)
+	batch.Queue(listAuditEntriesQuery, tenantID, id)
+	batch.Queue(listConsentsQuery, tenantID, id)
+
+	results := s.db.SendBatch(ctx, batch)
+	defer results.Close()
+
+	if err := (row{results.QueryRow()}).Scan(dest...); err != nil {
+		return nil, err
+	}
+	var raw []byte
+	if err := (row{results.QueryRow()}).Scan(&raw); err != nil {
+		return nil, err
+	}
+	metadata, err := decodeMetadata(raw)
+	if err != nil {
+		return nil, err
+	}
+	prefs, err := scanPreferences(row{results.QueryRow()})
+	if err != nil {
+		return nil, err
+	}
+	rows, err := results.Query()
+	if err != nil {
+		return nil, err
+	}
+	identities, err := scanIdentities(rows)
+	if err != nil {
+		return nil, err
+	}
+	if rows, err = results.Query(); err != nil {
+		return nil, err
+	}
+	audit, err := scanAuditEntries(rows)
+	if err != nil {
+		return nil, err
+	}
+	if rows, err = results.Query(); err != nil {
+		return nil, err
+	}
+	consents, err := scanConsents(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.UserExport{
+		ExportedAt:   s.now().UTC(),
+		User:         &user,
+		Metadata:     metadata,
+		Preferences:  prefs,
+		Identities:   identities,
+		AuditEntries: audit,
+		Consents:     consents,
+	}, nil
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// exportBatchSize is how many rows EachUser and EachAuditEntry read per
+// query.
+const exportBatchSize = 1000
+
+const exportJobFields = `id, tenant_id, format, filter, status, total, exported, COALESCE(storage_key, ''), size,
+    COALESCE(error, ''), COALESCE(created_by, ''), created, updated_at, completed_at`
+
+func scanExportJob(row interface{ Scan(...any) error }) (*models.ExportJob, error) {
+	var job models.ExportJob
+	var filter []byte
+	err := row.Scan(&job.ID, &job.TenantID, &job.Format, &filter, &job.Status, &job.Total, &job.Exported,
+		&job.StorageKey, &job.Size, &job.Error, &job.CreatedBy, &job.Created, &job.UpdatedAt, &job.CompletedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(filter, &job.Filter); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CreateExportJob stores a pending export job for the tenant of ctx,
+// filling in its ID, and audits it in the same transaction.
+func (s *service) CreateExportJob(ctx context.Context, job *models.ExportJob) error {
+	if job.Filter == nil {
+		job.Filter = map[string]string{}
+	}
+	filter, err := json.Marshal(job.Filter)
+	if err != nil {
+		return err
+	}
+	job.TenantID = tenant.FromContext(ctx)
+	job.Status = models.ExportPending
+
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+            INSERT INTO export_jobs (tenant_id, format, filter, created_by)
+            VALUES ($1, $2, $3, NULLIF($4, ''))
+            RETURNING id, created, updated_at
+        `, job.TenantID, job.Format, filter, job.CreatedBy).Scan(&job.ID, &job.Created, &job.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, &models.AuditEntry{
+			Action:  models.AuditUsersExported,
+			Details: map[string]any{"export_id": job.ID, "format": job.Format, "filter": job.Filter},
+		})
+	})
+}
+
+// GetExportJob returns the tenant's export job with id, or sql.ErrNoRows.
+func (s *service) GetExportJob(ctx context.Context, id int64) (*models.ExportJob, error) {
+	return scanExportJob(row{s.db.QueryRow(ctx, fmt.Sprintf(`
+        SELECT %s FROM export_jobs WHERE id = $1 AND tenant_id = $2
+    `, exportJobFields), id, tenant.FromContext(ctx))})
+}
+
+// ListExportJobs returns a page of the tenant's export jobs, newest first.
+func (s *service) ListExportJobs(ctx context.Context, page Page) ([]models.ExportJob, error) {
+	page = page.Normalize()
+	rows, err := s.db.Query(ctx, fmt.Sprintf(`
+        SELECT %s FROM export_jobs
+        WHERE tenant_id = $1
+        ORDER BY id DESC
+        LIMIT $2 OFFSET $3
+    `, exportJobFields), tenant.FromContext(ctx), page.Limit, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []models.ExportJob{}
+	for rows.Next() {
+		job, err := scanExportJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+func (s *service) CountExportJobs(ctx context.Context) (int64, error) {
+	var n int64
+	err := s.db.QueryRow(ctx, `SELECT count(*) FROM export_jobs WHERE tenant_id = $1`, tenant.FromContext(ctx)).Scan(&n)
+	return n, err
+}
+
+// UpdateExportJob stores the progress and outcome of an export job: its
+// status, counts, file and error. Jobs that are done or failed get their
+// completion time set.
+func (s *service) UpdateExportJob(ctx context.Context, job *models.ExportJob) error {
+	return row{s.db.QueryRow(ctx, `
+        UPDATE export_jobs
+        SET status = $3, total = $4, exported = $5, storage_key = NULLIF($6, ''), size = $7,
+            error = NULLIF($8, ''), updated_at = now(),
+            completed_at = CASE WHEN $3 IN ('done', 'failed') THEN now() END
+        WHERE id = $1 AND tenant_id = $2
+        RETURNING updated_at, completed_at
+    `, job.ID, tenant.FromContext(ctx), job.Status, job.Total, job.Exported, job.StorageKey, job.Size, job.Error,
+	)}.Scan(&job.UpdatedAt, &job.CompletedAt)
+}
+
+// DeleteExportJob removes the tenant's export job with id. It returns
+// sql.ErrNoRows when there is none; deleting its file is up to the caller.
+func (s *service) DeleteExportJob(ctx context.Context, id int64) error {
+	var deleted int64
+	return row{s.db.QueryRow(ctx, `
+        DELETE FROM export_jobs WHERE id = $1 AND tenant_id = $2 RETURNING id
+    `, id, tenant.FromContext(ctx))}.Scan(&deleted)
+}
+
+// EachUser calls fn with every user of the tenant matching filter, oldest
+// first, with all of their fields. Users are read in batches ordered by
+// creation time and ID, each continuing after the last user of the one
+// before, so exports of millions of users neither hold one query open
+// throughout nor slow down as they go. Users created while it runs may or
+// may not be included.
+func (s *service) EachUser(ctx context.Context, filter UserFilter, fn func(models.User) error) error {
+	var user models.User
+	columns, dest, err := s.userColumns(&user, models.UserFields)
+	if err != nil {
+		return err
+	}
+
+	var after *models.User
+	for {
+		where, args := filter.where(ctx, s.piiKeys, nil)
+		if after != nil {
+			args = append(args, after.Created, after.ID)
+			where += fmt.Sprintf(" AND (created, id) > ($%d, $%d)", len(args)-1, len(args))
+		}
+		args = append(args, exportBatchSize)
+		query := fmt.Sprintf(`SELECT %s FROM users%s ORDER BY created, id LIMIT $%d`,
+			selectList("", columns), where, len(args))
+
+		var batch []models.User
+		err := s.retry(ctx, "EachUser", isTransient, func() error {
+			batch = batch[:0]
+			rows, err := s.db.Query(ctx, query, args...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				user = models.User{}
+				if err := rows.Scan(dest...); err != nil {
+					return err
+				}
+				batch = append(batch, user)
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return err
+		}
+		for _, u := range batch {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+		if len(batch) < exportBatchSize {
+			return nil
+		}
+		after = &batch[len(batch)-1]
+	}
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var faultsInjectedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "users_db_faults_injected_total",
+	Help: "Faults injected into database operations by kind.",
+}, []string{"kind"})
+
+// Faults describes the failures injected into database operations, to
+// check in tests and staging that retries, timeouts and the circuit breaker
+// cope with them. The zero value injects nothing.
+type Faults struct {
+	// Latency delays LatencyRate of the calls, a share between 0 and 1.
+	// Delays end early when the context is done, with its error.
+	Latency     time.Duration
+	LatencyRate float64
+	// ConnectionErrorRate of the calls fail as if the connection had
+	// dropped, SerializationRate as if aborted by a serialization failure.
+	ConnectionErrorRate float64
+	SerializationRate   float64
+	// Operations limits the faults to these Service methods, all when empty.
+	Operations []string
+}
+
+// Enabled reports whether f injects anything.
+func (f *Faults) Enabled() bool {
+	return f != nil && (f.Latency > 0 && f.LatencyRate > 0 || f.ConnectionErrorRate > 0 || f.SerializationRate > 0)
+}
+
+// faultVariables configure the faults FaultsFromEnv reads.
+var faultVariables = []string{
+	"DB_FAULT_LATENCY", "DB_FAULT_LATENCY_RATE", "DB_FAULT_CONNECTION_ERROR_RATE",
+	"DB_FAULT_SERIALIZATION_RATE", "DB_FAULT_OPERATIONS",
+}
+
+// FaultsFromEnv reads DB_FAULT_LATENCY, DB_FAULT_LATENCY_RATE,
+// DB_FAULT_CONNECTION_ERROR_RATE, DB_FAULT_SERIALIZATION_RATE and the comma
+// separated DB_FAULT_OPERATIONS. They only take effect with
+// DB_FAULTS_ENABLED=true, which is refused with APP_ENV=production, so a
+// variable left behind from fault testing cannot degrade production; set
+// without it they are an error.
+func FaultsFromEnv() (*Faults, error) {
+	if os.Getenv("DB_FAULTS_ENABLED") != "true" {
+		for _, key := range faultVariables {
+			if os.Getenv(key) != "" {
+				return nil, fmt.Errorf("%s is set but DB_FAULTS_ENABLED is not true", key)
+			}
+		}
+		return &Faults{}, nil
+	}
+	if os.Getenv("APP_ENV") == "production" {
+		return nil, fmt.Errorf("DB_FAULTS_ENABLED cannot be used with APP_ENV=production")
+	}
+	f := &Faults{Operations: splitOperations(os.Getenv("DB_FAULT_OPERATIONS"))}
+	if v := os.Getenv("DB_FAULT_LATENCY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid DB_FAULT_LATENCY %q", v)
+		}
+		f.Latency = d
+		f.LatencyRate = 1
+	}
+	for key, rate := range map[string]*float64{
+		"DB_FAULT_LATENCY_RATE":          &f.LatencyRate,
+		"DB_FAULT_CONNECTION_ERROR_RATE": &f.ConnectionErrorRate,
+		"DB_FAULT_SERIALIZATION_RATE":    &f.SerializationRate,
+	} {
+		v := os.Getenv(key)
+		if v == "" {
+			continue
+		}
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r < 0 || r > 1 {
+			return nil, fmt.Errorf("invalid %s %q: use a share between 0 and 1", key, v)
+		}
+		*rate = r
+	}
+	return f, nil
+}
+
+func splitOperations(list string) []string {
+	var ops []string
+	for _, op := range strings.Split(list, ",") {
+		if op = strings.TrimSpace(op); op != "" {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// inject delays and fails a call of op as f says, returning the error the
+// call fails with.
+func (f *Faults) inject(ctx context.Context, op string) error {
+	if !f.Enabled() || len(f.Operations) > 0 && !slices.Contains(f.Operations, op) {
+		return nil
+	}
+	if f.Latency > 0 && rand.Float64() < f.LatencyRate {
+		faultsInjectedTotal.WithLabelValues("latency").Inc()
+		timer := time.NewTimer(f.Latency)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if rand.Float64() < f.ConnectionErrorRate {
+		faultsInjectedTotal.WithLabelValues("connection").Inc()
+		return &pgconn.PgError{Code: "08006", Message: "injected fault: connection failure"}
+	}
+	if rand.Float64() < f.SerializationRate {
+		faultsInjectedTotal.WithLabelValues("serialization").Inc()
+		return &pgconn.PgError{Code: "40001", Message: "injected fault: could not serialize access"}
+	}
+	return nil
+}
+
+// faultyBatch is the result of a batch failed by an injected fault.
+type faultyBatch struct {
+	err error
+}
+
+func (b faultyBatch) Exec() (pgconn.CommandTag, error) { return pgconn.CommandTag{}, b.err }
+func (b faultyBatch) Query() (pgx.Rows, error)         { return nil, b.err }
+func (b faultyBatch) QueryRow() pgx.Row                { return faultyRow(b) }
+func (b faultyBatch) Close() error                     { return b.err }
+
+// faultyRow is a row failed by an injected fault.
+type faultyRow struct {
+	err error
+}
+
+func (r faultyRow) Scan(dest ...any) error { return r.err }
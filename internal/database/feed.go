@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+)
+
+// Consumers of the change feed, each with its own position in
+// read_model_positions.
+const (
+	feedUserDirectory = "user_directory"
+)
+
+// feedBatch is what a consumer reads from the feed in one go.
+type feedBatch struct {
+	consumer         string
+	pos              changePosition
+	changed, deleted []string
+	size             int
+}
+
+// lockFeed takes the consumer's advisory lock for the rest of tx, so one
+// instance at a time moves it forward. It reports false when another
+// instance holds it.
+func lockFeed(ctx context.Context, tx pgx.Tx, consumer string) (bool, error) {
+	var locked bool
+	err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock(hashtext('feed:' || $1))`, consumer).Scan(&locked)
+	return locked, err
+}
+
+// feedCaughtUp returns when the consumer last reached the end of the feed,
+// or nil if it never did.
+func feedCaughtUp(ctx context.Context, tx pgx.Tx, consumer string) (*time.Time, error) {
+	var at *time.Time
+	err := tx.QueryRow(ctx, `SELECT caught_up_at FROM read_model_positions WHERE name = $1`, consumer).Scan(&at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return at, err
+}
+
+// readFeed returns up to limit changes after the consumer's position
+// across all tenants. Like GetUsersChangedSince it leaves out changes
+// that transactions still running could commit before, so consumers
+// trail the users table by at least changeSettleTime and by the oldest
+// open transaction.
+func readFeed(ctx context.Context, tx pgx.Tx, consumer string, limit int) (*feedBatch, error) {
+	_, err := tx.Exec(ctx, `INSERT INTO read_model_positions (name) VALUES ($1) ON CONFLICT DO NOTHING`, consumer)
+	if err != nil {
+		return nil, err
+	}
+	b := &feedBatch{consumer: consumer}
+	err = tx.QueryRow(ctx, `SELECT changed_at, user_id FROM read_model_positions WHERE name = $1 FOR UPDATE`, consumer).Scan(&b.pos.at, &b.pos.id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+        SELECT changed_at, id, deleted FROM (
+            SELECT updated_at AS changed_at, id, false AS deleted FROM users
+            WHERE (updated_at, id) > ($1, $2)
+            UNION ALL
+            SELECT deleted_at, user_id, true FROM user_tombstones
+            WHERE (deleted_at, user_id) > ($1, $2)
+        ) c
+        WHERE changed_at < `+settledBefore("$3")+`
+        ORDER BY changed_at, id, deleted
+        LIMIT $4
+    `, b.pos.at, b.pos.id, changeSettleTime.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var gone bool
+		if err := rows.Scan(&b.pos.at, &b.pos.id, &gone); err != nil {
+			return nil, err
+		}
+		if gone {
+			b.deleted = append(b.deleted, b.pos.id)
+		} else {
+			b.changed = append(b.changed, b.pos.id)
+		}
+		b.size++
+	}
+	return b, rows.Err()
+}
+
+// advance moves the consumer past the batch. A batch shorter than limit
+// reached the end of the feed, which is recorded as caught up. It returns
+// when the consumer last caught up.
+func (b *feedBatch) advance(ctx context.Context, tx pgx.Tx, limit int) (*time.Time, error) {
+	var caughtUp *time.Time
+	err := tx.QueryRow(ctx, `
+        UPDATE read_model_positions
+        SET changed_at = $2, user_id = $3, caught_up_at = CASE WHEN $4 THEN now() ELSE caught_up_at END
+        WHERE name = $1
+        RETURNING caught_up_at
+    `, b.consumer, b.pos.at, b.pos.id, b.size < limit).Scan(&caughtUp)
+	return caughtUp, err
+}
+
+// SyncUserFeed hands the next batch of up to limit changes to apply and
+// moves consumer past them once apply succeeds. apply runs inside the
+// transaction holding the consumer's position, so a failed batch is handed
+// out again and no two instances apply batches at the same time; while
+// another instance holds the consumer, SyncUserFeed returns 0 without
+// calling apply. Users changed more than once may come again in later
+// batches, so apply must be idempotent.
+func (s *service) SyncUserFeed(ctx context.Context, consumer string, limit int, apply func(ctx context.Context, batch models.FeedBatch) error) (int, error) {
+	limit = Page{Limit: limit}.Normalize().Limit
+	var size int
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		size = 0
+		if locked, err := lockFeed(ctx, tx, consumer); err != nil || !locked {
+			return err
+		}
+		b, err := readFeed(ctx, tx, consumer, limit)
+		if err != nil {
+			return err
+		}
+		batch := models.FeedBatch{Users: []models.TenantUser{}, Deleted: b.deleted}
+		if len(b.changed) > 0 {
+			if batch.Users, err = s.tenantUsers(ctx, tx, `WHERE id = ANY($1)`, b.changed); err != nil {
+				return err
+			}
+		}
+		if b.size > 0 {
+			if err := apply(ctx, batch); err != nil {
+				return err
+			}
+		}
+		size = b.size
+		_, err = b.advance(ctx, tx, limit)
+		return err
+	})
+	return size, err
+}
+
+// ResetUserFeed moves consumer back so that it sees every change since at
+// again, e.g. after its copy was rebuilt from a snapshot taken at that
+// time.
+func (s *service) ResetUserFeed(ctx context.Context, consumer string, at time.Time) error {
+	_, err := s.db.Exec(ctx, `
+        INSERT INTO read_model_positions (name, changed_at) VALUES ($1, $2)
+        ON CONFLICT (name) DO UPDATE SET changed_at = EXCLUDED.changed_at, user_id = '', caught_up_at = NULL
+    `, consumer, at)
+	return err
+}
+
+// ScanUsers returns up to limit users of all tenants ordered by ID,
+// starting after the ID after, for consumers copying every user.
+func (s *service) ScanUsers(ctx context.Context, after string, limit int) ([]models.TenantUser, error) {
+	limit = Page{Limit: limit}.Normalize().Limit
+	var users []models.TenantUser
+	err := s.retry(ctx, "ScanUsers", isTransient, func() (err error) {
+		users, err = s.tenantUsers(ctx, s.db, `WHERE id > $1 ORDER BY id LIMIT $2`, after, limit)
+		return err
+	})
+	return users, err
+}
+
+// tenantUsers selects the users matching the clause along with their
+// tenants.
+func (s *service) tenantUsers(ctx context.Context, db conn, clause string, args ...any) ([]models.TenantUser, error) {
+	rows, err := db.Query(ctx, fmt.Sprintf(`SELECT tenant_id, %s FROM users %s`, selectList("", defaultUserFields), clause), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.TenantUser{}
+	for rows.Next() {
+		var u models.TenantUser
+		_, dest, err := s.userColumns(&u.User, defaultUserFields)
+		if err != nil {
+			return nil, err
+		}
+		if err := rows.Scan(append([]any{&u.TenantID}, dest...)...); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
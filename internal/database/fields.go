@@ -0,0 +1,173 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"users/internal/models"
+)
+
+// defaultUserFields are the fields selected when the caller does not ask for
+// a specific projection.
+var defaultUserFields = []string{"id", "first_name", "last_name", "username", "email", "pending_email", "locale", "timezone", "tags", "status", "age", "birthdate", "created", "updated_at", "version", "merged_into", "anonymized_at", "last_login_at", "last_seen_at"}
+
+// userColumns resolves the requested JSON field names into column names and
+// the matching scan destinations on user.
+func (s *service) userColumns(user *models.User, fields []string) ([]string, []any, error) {
+	columns := make([]string, 0, len(fields))
+	dest := make([]any, 0, len(fields))
+	for _, f := range fields {
+		switch f {
+		case "id":
+			dest = append(dest, &user.ID)
+		case "first_name":
+			dest = append(dest, &user.FirstName)
+		case "last_name":
+			dest = append(dest, &user.LastName)
+		case "username":
+			dest = append(dest, nullString{&user.Username})
+		case "age":
+			dest = append(dest, storedAge{user})
+		case "birthdate":
+			dest = append(dest, birthdate{user})
+		case "email":
+			dest = append(dest, sealedString{s.piiKeys, &user.Email})
+		case "pending_email":
+			dest = append(dest, sealedString{s.piiKeys, &user.PendingEmail})
+		case "locale":
+			dest = append(dest, nullString{&user.Locale})
+		case "timezone":
+			dest = append(dest, nullString{&user.Timezone})
+		case "tags":
+			dest = append(dest, &user.Tags)
+		case "status":
+			dest = append(dest, &user.Status)
+		case "created":
+			dest = append(dest, &user.Created)
+		case "updated_at":
+			dest = append(dest, &user.UpdatedAt)
+		case "version":
+			dest = append(dest, &user.Version)
+		case "merged_into":
+			dest = append(dest, nullString{&user.MergedInto})
+		case "anonymized_at":
+			dest = append(dest, &user.AnonymizedAt)
+		case "last_login_at":
+			dest = append(dest, &user.LastLoginAt)
+		case "last_seen_at":
+			dest = append(dest, &user.LastSeenAt)
+		default:
+			return nil, nil, fmt.Errorf("unknown field %q", f)
+		}
+		columns = append(columns, f)
+	}
+	// Age is computed from the birthdate, so it is selected along with age.
+	if slices.Contains(fields, "age") && !slices.Contains(fields, "birthdate") {
+		columns = append(columns, "birthdate")
+		dest = append(dest, birthdate{user})
+	}
+	return columns, dest, nil
+}
+
+// selectList renders columns for a SELECT or RETURNING clause, qualified
+// with table unless it is empty. Fields that may be stored encrypted are
+// read from their ciphertext column, or the plain one for rows not
+// encrypted yet.
+func selectList(table string, columns []string) string {
+	qualify := func(c string) string {
+		if table == "" {
+			return c
+		}
+		return table + "." + c
+	}
+	list := make([]string, len(columns))
+	for i, c := range columns {
+		if sealed, ok := sealedColumns[c]; ok {
+			list[i] = fmt.Sprintf("COALESCE(%s, %s)", qualify(sealed), qualify(c))
+		} else {
+			list[i] = qualify(c)
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+// scanUser scans a row holding defaultUserFields.
+func (s *service) scanUser(row interface{ Scan(...any) error }) (*models.User, error) {
+	var user models.User
+	_, dest, err := s.userColumns(&user, defaultUserFields)
+	if err != nil {
+		return nil, err
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// nullString scans a nullable text column into a string, mapping NULL to "".
+type nullString struct {
+	s *string
+}
+
+func (n nullString) Scan(src any) error {
+	var ns sql.NullString
+	if err := ns.Scan(src); err != nil {
+		return err
+	}
+	*n.s = ns.String
+	return nil
+}
+
+// storedBirthdate parses user.Birthdate for storage, returning nil when
+// there is none, and sets user.Age from it as of now so the age column stays
+// meaningful.
+func storedBirthdate(user *models.User, now time.Time) (any, error) {
+	if user.Birthdate == "" {
+		return nil, nil
+	}
+	d, err := time.Parse(models.DateLayout, user.Birthdate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid birthdate %q: %w", user.Birthdate, err)
+	}
+	user.Age = models.AgeAt(d, now)
+	return d, nil
+}
+
+// birthdate scans the nullable birthdate column and derives the user's age
+// from it.
+type birthdate struct {
+	user *models.User
+}
+
+func (b birthdate) Scan(src any) error {
+	var d sql.NullTime
+	if err := d.Scan(src); err != nil {
+		return err
+	}
+	if d.Valid {
+		b.user.Birthdate = d.Time.Format(models.DateLayout)
+		b.user.Age = models.AgeAt(d.Time, time.Now())
+	}
+	return nil
+}
+
+// storedAge scans the age column, which only counts for users without a
+// birthdate. Columns scan in order, so it must not overwrite an age that
+// birthdate already computed.
+type storedAge struct {
+	user *models.User
+}
+
+func (a storedAge) Scan(src any) error {
+	var n sql.NullInt64
+	if err := n.Scan(src); err != nil {
+		return err
+	}
+	if a.user.Birthdate == "" {
+		a.user.Age = uint(n.Int64)
+	}
+	return nil
+}
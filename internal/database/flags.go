@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// ListFeatureFlags returns the stored flag overrides of every tenant.
+func (s *service) ListFeatureFlags(ctx context.Context) ([]models.FeatureFlag, error) {
+	rows, err := s.db.Query(ctx, `SELECT tenant_id, name, enabled, updated_at FROM feature_flags ORDER BY tenant_id, name`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.FeatureFlag, error) {
+		var f models.FeatureFlag
+		err := row.Scan(&f.TenantID, &f.Name, &f.Enabled, &f.UpdatedAt)
+		return f, err
+	})
+}
+
+// SetFeatureFlag stores the tenant's override of flag name.
+func (s *service) SetFeatureFlag(ctx context.Context, name string, enabled bool) (*models.FeatureFlag, error) {
+	f := models.FeatureFlag{TenantID: tenant.FromContext(ctx), Name: name, Enabled: enabled}
+	err := s.db.QueryRow(ctx, `
+        INSERT INTO feature_flags (tenant_id, name, enabled)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (tenant_id, name) DO UPDATE
+        SET enabled = EXCLUDED.enabled, updated_at = now()
+        RETURNING updated_at
+    `, f.TenantID, name, enabled).Scan(&f.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// DeleteFeatureFlag removes the tenant's override of flag name. It returns
+// sql.ErrNoRows if there is none.
+func (s *service) DeleteFeatureFlag(ctx context.Context, name string) error {
+	res, err := s.db.Exec(ctx, `DELETE FROM feature_flags WHERE tenant_id = $1 AND name = $2`, tenant.FromContext(ctx), name)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+const groupColumns = `id, name, description, created, updated_at`
+
+func scanGroup(row interface{ Scan(...any) error }) (*models.Group, error) {
+	var group models.Group
+	if err := row.Scan(&group.ID, &group.Name, &group.Description, &group.Created, &group.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func scanGroups(rows pgx.Rows) ([]models.Group, error) {
+	defer rows.Close()
+	groups := []models.Group{}
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *group)
+	}
+	return groups, rows.Err()
+}
+
+// CreateGroup stores group for the tenant of ctx, filling in its ID and
+// timestamps. It returns ErrGroupNameTaken when the tenant already has a
+// group with the name, ignoring case.
+func (s *service) CreateGroup(ctx context.Context, group *models.Group) error {
+	group.ID = s.newID()
+	err := s.db.QueryRow(ctx, `
+        INSERT INTO groups (id, tenant_id, name, description)
+        VALUES ($1, $2, $3, $4)
+        RETURNING created, updated_at
+    `, group.ID, tenant.FromContext(ctx), group.Name, group.Description).Scan(&group.Created, &group.UpdatedAt)
+	if err != nil {
+		group.ID = ""
+		return mapConstraintError(err)
+	}
+	return nil
+}
+
+func (s *service) GetGroup(ctx context.Context, id string) (*models.Group, error) {
+	var group *models.Group
+	err := s.read(ctx, "GetGroup", func(db conn) (err error) {
+		group, err = scanGroup(db.QueryRow(ctx, `SELECT `+groupColumns+` FROM groups WHERE id = $1 AND tenant_id = $2`,
+			id, tenant.FromContext(ctx)))
+		return err
+	})
+	return group, err
+}
+
+// ListGroups returns a page of the tenant's groups ordered by name.
+func (s *service) ListGroups(ctx context.Context, page Page) ([]models.Group, error) {
+	page = page.Normalize()
+	var groups []models.Group
+	err := s.read(ctx, "ListGroups", func(db conn) error {
+		rows, err := db.Query(ctx, `
+            SELECT `+groupColumns+` FROM groups
+            WHERE tenant_id = $1
+            ORDER BY lower(name), id
+            LIMIT $2 OFFSET $3
+        `, tenant.FromContext(ctx), page.Limit, page.Offset)
+		if err != nil {
+			return err
+		}
+		groups, err = scanGroups(rows)
+		return err
+	})
+	return groups, err
+}
+
+// CountGroups returns the number of the tenant's groups.
+func (s *service) CountGroups(ctx context.Context) (int64, error) {
+	var count int64
+	err := s.read(ctx, "CountGroups", func(db conn) error {
+		return db.QueryRow(ctx, `SELECT count(*) FROM groups WHERE tenant_id = $1`, tenant.FromContext(ctx)).Scan(&count)
+	})
+	return count, err
+}
+
+// UpdateGroup applies updates to the group and returns it. An update
+// setting nothing returns ErrNoFieldsToUpdate.
+func (s *service) UpdateGroup(ctx context.Context, id string, updates models.GroupUpdate) (*models.Group, error) {
+	var c setClause
+	if updates.Name != nil {
+		c.add("name = $%d", *updates.Name)
+	}
+	if updates.Description != nil {
+		c.add("description = $%d", *updates.Description)
+	}
+	if len(c.assignments) == 0 {
+		return nil, ErrNoFieldsToUpdate
+	}
+	c.assignments = append(c.assignments, "updated_at = now()")
+	args := append(c.params, id, tenant.FromContext(ctx))
+	query := fmt.Sprintf(`UPDATE groups SET %s WHERE id = $%d AND tenant_id = $%d RETURNING %s`,
+		strings.Join(c.assignments, ", "), len(args)-1, len(args), groupColumns)
+	group, err := scanGroup(s.db.QueryRow(ctx, query, args...))
+	if err != nil {
+		return nil, mapConstraintError(err)
+	}
+	return group, nil
+}
+
+// DeleteGroup removes the group and its memberships.
+func (s *service) DeleteGroup(ctx context.Context, id string) error {
+	res, err := s.db.Exec(ctx, `DELETE FROM groups WHERE id = $1 AND tenant_id = $2`, id, tenant.FromContext(ctx))
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AddUserToGroup makes the user a member of the group. Adding a member
+// again is a no-op. It returns sql.ErrNoRows when the tenant has no such
+// group or user.
+func (s *service) AddUserToGroup(ctx context.Context, groupID, userID string) error {
+	tenantID := tenant.FromContext(ctx)
+	var added bool
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx, `
+            INSERT INTO group_members (group_id, user_id, tenant_id)
+            SELECT g.id, u.id, u.tenant_id FROM groups g, users u
+            WHERE g.id = $1 AND g.tenant_id = $3 AND u.id = $2 AND u.tenant_id = $3
+            ON CONFLICT DO NOTHING
+        `, groupID, userID, tenantID)
+		if added = err == nil && res.RowsAffected() > 0; !added {
+			return err
+		}
+		return s.enforceQuota(ctx, tx, QuotaGroupsPerUser, userID)
+	})
+	if err != nil || added {
+		return err
+	}
+	var member bool
+	err = s.db.QueryRow(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM group_members m JOIN groups g ON g.id = m.group_id
+            WHERE m.group_id = $1 AND m.user_id = $2 AND g.tenant_id = $3
+        )
+    `, groupID, userID, tenantID).Scan(&member)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RemoveUserFromGroup ends the user's membership of the group. It returns
+// sql.ErrNoRows when the user is not a member.
+func (s *service) RemoveUserFromGroup(ctx context.Context, groupID, userID string) error {
+	res, err := s.db.Exec(ctx, `
+        DELETE FROM group_members m USING groups g
+        WHERE g.id = m.group_id AND m.group_id = $1 AND m.user_id = $2 AND g.tenant_id = $3
+    `, groupID, userID, tenant.FromContext(ctx))
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CountGroupMembers returns the number of members of the group. It
+// returns sql.ErrNoRows when the tenant has no such group.
+func (s *service) CountGroupMembers(ctx context.Context, groupID string) (int64, error) {
+	var count int64
+	err := s.read(ctx, "CountGroupMembers", func(db conn) error {
+		// A missing group yields no row rather than a count of 0
+		return db.QueryRow(ctx, `
+            SELECT (SELECT count(*) FROM group_members m JOIN users u ON u.id = m.user_id
+                    WHERE m.group_id = g.id AND u.tenant_id = g.tenant_id)
+            FROM groups g
+            WHERE g.id = $1 AND g.tenant_id = $2
+        `, groupID, tenant.FromContext(ctx)).Scan(&count)
+	})
+	return count, err
+}
+
+// ListGroupMembers returns a page of the group's members in the order they
+// joined. It returns sql.ErrNoRows when the tenant has no such group.
+func (s *service) ListGroupMembers(ctx context.Context, groupID string, page Page) ([]models.User, error) {
+	page = page.Normalize()
+	tenantID := tenant.FromContext(ctx)
+	query := `
+        SELECT ` + selectList("u", defaultUserFields) + `
+        FROM group_members m JOIN users u ON u.id = m.user_id
+        WHERE m.group_id = $1 AND u.tenant_id = $2
+        ORDER BY m.added_at, u.id
+        LIMIT $3 OFFSET $4
+    `
+	var users []models.User
+	err := s.read(ctx, "ListGroupMembers", func(db conn) error {
+		var exists bool
+		err := db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM groups WHERE id = $1 AND tenant_id = $2)`, groupID, tenantID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return sql.ErrNoRows
+		}
+		users, err = s.queryUsers(ctx, db, query, groupID, tenantID, page.Limit, page.Offset)
+		return err
+	})
+	return users, err
+}
+
+// ListUserGroups returns the groups the user is a member of, by name.
+func (s *service) ListUserGroups(ctx context.Context, userID string) ([]models.Group, error) {
+	var groups []models.Group
+	err := s.read(ctx, "ListUserGroups", func(db conn) error {
+		rows, err := db.Query(ctx, `
+            SELECT g.id, g.name, g.description, g.created, g.updated_at
+            FROM group_members m JOIN groups g ON g.id = m.group_id
+            WHERE m.user_id = $1 AND g.tenant_id = $2
+            ORDER BY lower(g.name), g.id
+        `, userID, tenant.FromContext(ctx))
+		if err != nil {
+			return err
+		}
+		groups, err = scanGroups(rows)
+		return err
+	})
+	return groups, err
+}
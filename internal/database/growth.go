@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// RefreshGrowthStats recounts the signups, deletions and active users of
+// every tenant into user_growth_stats, from the day before the last day an
+// earlier refresh counted through today, or over everything the first
+// time; starting a day early picks up what reached the tables after the
+// last refresh of a day. The counts of a day only ever grow: signups are
+// recounted from the users still there, deletions from tombstones still
+// kept and active users from user_daily_activity, which the refresh prunes
+// of the days it will not count again, so a later recount of a day past
+// missing some never replaces a fuller one. It returns how many days of
+// tenants it wrote.
+func (s *service) RefreshGrowthStats(ctx context.Context) (int64, error) {
+	var n int64
+	err := s.retry(ctx, "RefreshGrowthStats", isTransient, func() error {
+		tag, err := s.db.Exec(ctx, `
+            WITH since AS (
+                SELECT COALESCE(max(day) - 1, '-infinity'::date) AS day
+                FROM user_growth_stats
+                WHERE refreshed_at IS NOT NULL
+            ),
+            pruned AS (
+                DELETE FROM user_daily_activity WHERE day < (SELECT day FROM since)
+            ),
+            counts AS (
+                SELECT tenant_id, (created AT TIME ZONE 'UTC')::date AS day, count(*) AS signups, 0 AS deletions, 0 AS active_users
+                FROM users
+                WHERE created >= (SELECT day FROM since)::timestamp AT TIME ZONE 'UTC'
+                GROUP BY 1, 2
+                UNION ALL
+                SELECT tenant_id, (deleted_at AT TIME ZONE 'UTC')::date, 0, count(*), 0
+                FROM user_tombstones
+                WHERE deleted_at >= (SELECT day FROM since)::timestamp AT TIME ZONE 'UTC'
+                GROUP BY 1, 2
+                UNION ALL
+                SELECT tenant_id, day, 0, 0, count(*)
+                FROM user_daily_activity
+                WHERE day >= (SELECT day FROM since)
+                GROUP BY 1, 2
+            )
+            INSERT INTO user_growth_stats AS g (tenant_id, day, signups, deletions, active_users, refreshed_at)
+            SELECT tenant_id, day, sum(signups), sum(deletions), sum(active_users), now()
+            FROM counts
+            GROUP BY tenant_id, day
+            ON CONFLICT (tenant_id, day) DO UPDATE
+            SET signups = GREATEST(g.signups, EXCLUDED.signups),
+                deletions = GREATEST(g.deletions, EXCLUDED.deletions),
+                active_users = GREATEST(g.active_users, EXCLUDED.active_users),
+                refreshed_at = EXCLUDED.refreshed_at
+        `)
+		n = tag.RowsAffected()
+		return err
+	})
+	return n, err
+}
+
+// GetGrowthStats returns the daily growth of the tenant of ctx from the
+// day of from through the day of to (UTC), including days without any.
+func (s *service) GetGrowthStats(ctx context.Context, from, to time.Time) (*models.GrowthStats, error) {
+	from = from.UTC().Truncate(24 * time.Hour)
+	to = to.UTC().Truncate(24 * time.Hour)
+	stats := &models.GrowthStats{From: from, To: to, Days: []models.GrowthDay{}}
+
+	rows, err := s.db.Query(ctx, `
+        SELECT d.day::date, COALESCE(g.signups, 0), COALESCE(g.deletions, 0), COALESCE(g.active_users, 0)
+        FROM generate_series($2::date, $3::date, interval '1 day') AS d(day)
+        LEFT JOIN user_growth_stats g ON g.tenant_id = $1 AND g.day = d.day::date
+        ORDER BY d.day
+    `, tenant.FromContext(ctx), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d models.GrowthDay
+		if err := rows.Scan(&d.Day, &d.Signups, &d.Deletions, &d.ActiveUsers); err != nil {
+			return nil, err
+		}
+		stats.Days = append(stats.Days, d)
+	}
+	return stats, rows.Err()
+}
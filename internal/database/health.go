@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// healthTimeout bounds the whole health check, including replica probes.
+const healthTimeout = time.Second
+
+// HealthReport describes the state of the database as seen by the service.
+type HealthReport struct {
+	// Status is "up" when the primary answers queries and "down" otherwise.
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Circuit is the state of the circuit breaker, when there is one.
+	Circuit string `json:"circuit,omitempty"`
+	// LatencyMS is the round trip time of a SELECT 1 on the primary.
+	LatencyMS float64         `json:"latency_ms"`
+	Schema    *SchemaHealth   `json:"schema,omitempty"`
+	Pool      *PoolHealth     `json:"pool,omitempty"`
+	Replicas  []ReplicaHealth `json:"replicas,omitempty"`
+	// Warnings point out pool statistics that deserve attention.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// SchemaHealth compares the applied schema with the embedded migrations.
+type SchemaHealth struct {
+	Version uint `json:"version"`
+	Latest  uint `json:"latest"`
+	Dirty   bool `json:"dirty"`
+	// Pending is true while migrations newer than Version are embedded.
+	Pending bool `json:"pending"`
+}
+
+// PoolHealth is a snapshot of the primary's connection pool.
+type PoolHealth struct {
+	OpenConnections   int32  `json:"open_connections"`
+	MaxConnections    int32  `json:"max_connections"`
+	InUse             int32  `json:"in_use"`
+	Idle              int32  `json:"idle"`
+	WaitCount         int64  `json:"wait_count"`
+	WaitDuration      string `json:"wait_duration"`
+	MaxIdleClosed     int64  `json:"max_idle_closed"`
+	MaxLifetimeClosed int64  `json:"max_lifetime_closed"`
+}
+
+// ReplicaHealth is the state of one read replica.
+type ReplicaHealth struct {
+	Host    string `json:"host"`
+	Healthy bool   `json:"healthy"`
+	// LagSeconds is how far the replica's replay trails behind the primary,
+	// measured as the age of the last replayed transaction. It also grows
+	// while the primary is idle.
+	LagSeconds float64 `json:"lag_seconds"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Health checks the primary with a timed round trip and reports the schema
+// version, pool statistics and, when configured, replica lag.
+func (s *service) Health() HealthReport {
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+
+	start := time.Now()
+	var one int
+	if err := s.db.QueryRow(ctx, `SELECT 1`).Scan(&one); err != nil {
+		return HealthReport{Status: "down", Error: err.Error()}
+	}
+	report := HealthReport{
+		Status:    "up",
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	if schema, err := s.schemaHealth(ctx); err != nil {
+		report.Warnings = append(report.Warnings, "Schema version unavailable: "+err.Error())
+	} else {
+		report.Schema = schema
+	}
+
+	stat := s.db.Stat()
+	report.Pool = &PoolHealth{
+		OpenConnections:   stat.TotalConns(),
+		MaxConnections:    stat.MaxConns(),
+		InUse:             stat.AcquiredConns(),
+		Idle:              stat.IdleConns(),
+		WaitCount:         stat.EmptyAcquireCount(),
+		WaitDuration:      stat.AcquireDuration().String(),
+		MaxIdleClosed:     stat.MaxIdleDestroyCount(),
+		MaxLifetimeClosed: stat.MaxLifetimeDestroyCount(),
+	}
+	if stat.TotalConns() > stat.MaxConns()*4/5 {
+		report.Warnings = append(report.Warnings, "The database is experiencing heavy load.")
+	}
+	if stat.EmptyAcquireCount() > 1000 {
+		report.Warnings = append(report.Warnings, "The database has a high number of wait events, indicating potential bottlenecks.")
+	}
+	if stat.MaxIdleDestroyCount() > int64(stat.TotalConns())/2 {
+		report.Warnings = append(report.Warnings, "Many idle connections are being closed, consider revising the connection pool settings.")
+	}
+	if stat.MaxLifetimeDestroyCount() > int64(stat.TotalConns())/2 {
+		report.Warnings = append(report.Warnings, "Many connections are being closed due to max lifetime, consider increasing max lifetime or revising the connection usage pattern.")
+	}
+
+	if s.replicas != nil {
+		for _, r := range s.replicas.replicas {
+			report.Replicas = append(report.Replicas, r.health(ctx))
+		}
+	}
+	return report
+}
+
+// schemaHealth reads the applied version without creating the bookkeeping
+// table, which MigrationVersion would do.
+func (s *service) schemaHealth(ctx context.Context) (*SchemaHealth, error) {
+	list, err := embeddedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	health := &SchemaHealth{}
+	if len(list) > 0 {
+		health.Latest = list[len(list)-1].version
+	}
+
+	err = s.db.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&health.Version, &health.Dirty)
+	var pgErr *pgconn.PgError
+	if err != nil && !errors.Is(err, sql.ErrNoRows) && !(errors.As(err, &pgErr) && pgErr.Code == "42P01") {
+		return nil, err
+	}
+	health.Pending = health.Version < health.Latest
+	return health, nil
+}
+
+func (r *replica) health(ctx context.Context) ReplicaHealth {
+	h := ReplicaHealth{Host: redactDSN(r.dsn), Healthy: r.healthy.Load()}
+	if !h.Healthy {
+		return h
+	}
+	err := r.db.QueryRow(ctx, `
+        SELECT COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)::float8
+    `).Scan(&h.LagSeconds)
+	if err != nil {
+		h.Error = err.Error()
+	}
+	return h
+}
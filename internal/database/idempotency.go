@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"users/internal/models"
+)
+
+// GetIdempotencyRecord returns the unexpired record stored for key, or
+// sql.ErrNoRows if there is none.
+func (s *service) GetIdempotencyRecord(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+	var record models.IdempotencyRecord
+	query := `
+        SELECT key, request_hash, status_code, body, created, expires_at
+        FROM idempotency_keys
+        WHERE key = $1 AND expires_at > now()
+    `
+	err := s.db.QueryRow(ctx, query, key).Scan(&record.Key, &record.RequestHash, &record.StatusCode, &record.Body, &record.Created, &record.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ReserveIdempotencyKey claims record.Key for the request of
+// record.RequestHash by storing a pending record, without a response,
+// until record.ExpiresAt. It returns nil once the key is reserved, and
+// otherwise the unexpired record that holds the key, pending or complete,
+// so that concurrent requests with the same key run the handler only once.
+func (s *service) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	// An expired record is gone by the time it is read again, so the loop
+	// ends once the reservation or the lookup finds a live one
+	for {
+		res, err := s.db.Exec(ctx, `
+            INSERT INTO idempotency_keys (key, request_hash, status_code, body, expires_at)
+            VALUES ($1, $2, 0, '', $3)
+            ON CONFLICT (key) DO UPDATE
+            SET request_hash = EXCLUDED.request_hash,
+                status_code = 0,
+                body = '',
+                created = now(),
+                expires_at = EXCLUDED.expires_at
+            WHERE idempotency_keys.expires_at <= now()
+        `, record.Key, record.RequestHash, record.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		if res.RowsAffected() == 1 {
+			return nil, nil
+		}
+		existing, err := s.GetIdempotencyRecord(ctx, record.Key)
+		if err != sql.ErrNoRows {
+			return existing, err
+		}
+	}
+}
+
+// SaveIdempotencyRecord stores the response of the request that reserved
+// record.Key. If the reservation has expired it stores record unless an
+// unexpired record already exists for the same key, in which case the
+// first result wins.
+func (s *service) SaveIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	query := `
+        INSERT INTO idempotency_keys (key, request_hash, status_code, body, expires_at)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (key) DO UPDATE
+        SET request_hash = EXCLUDED.request_hash,
+            status_code = EXCLUDED.status_code,
+            body = EXCLUDED.body,
+            created = now(),
+            expires_at = EXCLUDED.expires_at
+        WHERE idempotency_keys.expires_at <= now()
+           OR (idempotency_keys.status_code = 0 AND idempotency_keys.request_hash = EXCLUDED.request_hash)
+    `
+	_, err := s.db.Exec(ctx, query, record.Key, record.RequestHash, record.StatusCode, record.Body, record.ExpiresAt)
+	return err
+}
+
+// ReleaseIdempotencyKey drops the pending reservation of key, so the
+// request can be retried with it.
+func (s *service) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE key = $1 AND status_code = 0`, key)
+	return err
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// GetUserByIdentity returns the user linked to the provider account.
+func (s *service) GetUserByIdentity(ctx context.Context, provider, subject string) (*models.User, error) {
+	query := `
+        SELECT ` + selectList("u", defaultUserFields) + `
+        FROM identities i
+        JOIN users u ON u.id = i.user_id
+        WHERE i.tenant_id = $1 AND i.provider = $2 AND i.subject = $3
+    `
+	return s.scanUser(s.db.QueryRow(ctx, query, tenant.FromContext(ctx), provider, subject))
+}
+
+// LinkIdentity links a provider account to identity.UserID.
+func (s *service) LinkIdentity(ctx context.Context, identity *models.Identity) error {
+	query := `
+        INSERT INTO identities (tenant_id, user_id, provider, subject, email)
+        SELECT $1, id, $3, $4, NULLIF($5, '') FROM users WHERE id = $2 AND tenant_id = $1
+        RETURNING id, created
+    `
+	return s.db.QueryRow(ctx, query, tenant.FromContext(ctx), identity.UserID, identity.Provider, identity.Subject, identity.Email).Scan(&identity.ID, &identity.Created)
+}
+
+// UnlinkIdentity removes the link between a user and a provider.
+func (s *service) UnlinkIdentity(ctx context.Context, userID, provider string) error {
+	res, err := s.db.Exec(ctx, `DELETE FROM identities WHERE tenant_id = $1 AND user_id = $2 AND provider = $3`, tenant.FromContext(ctx), userID, provider)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListIdentities returns the provider accounts linked to a user.
+func (s *service) ListIdentities(ctx context.Context, userID string) ([]models.Identity, error) {
+	rows, err := s.db.Query(ctx, listIdentitiesQuery, tenant.FromContext(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanIdentities(rows)
+}
+
+const listIdentitiesQuery = `
+    SELECT id, user_id, provider, subject, COALESCE(email, ''), created
+    FROM identities
+    WHERE tenant_id = $1 AND user_id = $2
+    ORDER BY created
+`
+
+func scanIdentities(rows pgx.Rows) ([]models.Identity, error) {
+	defer rows.Close()
+
+	identities := []models.Identity{}
+	for rows.Next() {
+		var i models.Identity
+		if err := rows.Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.Created); err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
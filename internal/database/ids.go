@@ -0,0 +1,106 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"users/internal/validator"
+)
+
+// IDGenerator returns a new user ID. IDs must be unique across tenants,
+// since the change feed and the read model key users by ID alone, and
+// pass validator.ValidateID.
+type IDGenerator func() string
+
+// UUIDv4 generates random UUIDs. Inserting them lands anywhere in the
+// primary key index, which fragments it as the table grows.
+func UUIDv4() string {
+	return uuid.New().String()
+}
+
+// UUIDv7 generates UUIDs starting with the time in milliseconds, so new
+// IDs sort after older ones and inserts append to the index.
+func UUIDv7() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// crockford is the alphabet of ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID generates ULIDs: 26 characters holding the time in milliseconds and
+// 80 random bits, which sort by time like UUIDv7 but are shorter.
+func ULID() string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixMilli())<<16)
+	if _, err := rand.Read(b[6:]); err != nil {
+		panic(err)
+	}
+	// 26 characters of 5 bits each are 130 bits; the first two are zero
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// isULID reports whether s is shaped like a ULID.
+func isULID(s string) bool {
+	if len(s) != 26 {
+		return false
+	}
+	for i := range len(s) {
+		if strings.IndexByte(crockford, s[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// idGenerators are the generators DB_ID_FORMAT selects from.
+var idGenerators = map[string]IDGenerator{
+	"uuidv4": UUIDv4,
+	"uuidv7": UUIDv7,
+	"ulid":   ULID,
+}
+
+// idGeneratorFromEnv returns the generator named by DB_ID_FORMAT, uuidv4
+// unless set.
+func idGeneratorFromEnv() (IDGenerator, error) {
+	format := os.Getenv("DB_ID_FORMAT")
+	if format == "" {
+		return UUIDv4, nil
+	}
+	gen, ok := idGenerators[format]
+	if !ok {
+		return nil, fmt.Errorf("invalid DB_ID_FORMAT %q: use uuidv4, uuidv7 or ulid", format)
+	}
+	return gen, nil
+}
+
+var (
+	// ErrInvalidID is returned when creating a user with an ID, chosen
+	// by the caller or generated, that validator.ValidateID rejects.
+	ErrInvalidID = errors.New("invalid user ID")
+	// ErrUserExists is returned when creating a user with an ID another
+	// user, of any tenant, already has.
+	ErrUserExists = errors.New("a user with this ID already exists")
+)
+
+// newUserID generates an ID for a new user.
+func (s *service) newUserID() (string, error) {
+	id := s.newID()
+	if err := validator.ValidateID(id); err != nil {
+		return "", fmt.Errorf("%w %q from the ID generator: %v", ErrInvalidID, id, err)
+	}
+	return id, nil
+}
@@ -0,0 +1,961 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"users/internal/models"
+)
+
+// defaultSlowQueryThreshold is the query duration above which queries are
+// logged unless DB_SLOW_QUERY_THRESHOLD says otherwise.
+const defaultSlowQueryThreshold = 500 * time.Millisecond
+
+var operationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "users_db_operation_duration_seconds",
+	Help:    "Duration of database service operations, including retries.",
+	Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+}, []string{"operation"})
+
+type operationKey struct{}
+
+// operationFrom returns the Service method ctx was passed to.
+func operationFrom(ctx context.Context) string {
+	op, _ := ctx.Value(operationKey{}).(string)
+	return op
+}
+
+// instrumentedService records how long every operation of the wrapped
+// service takes and names the operation in ctx so slow queries can be
+// traced back to it.
+type instrumentedService struct {
+	next Service
+}
+
+func instrument(next Service) *instrumentedService {
+	return &instrumentedService{next: next}
+}
+
+func (m *instrumentedService) start(ctx context.Context, op string) (context.Context, func()) {
+	start := time.Now()
+	return context.WithValue(ctx, operationKey{}, op), func() {
+		operationDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	}
+}
+
+// slowQueryThreshold reads DB_SLOW_QUERY_THRESHOLD; zero disables logging.
+func slowQueryThreshold() (time.Duration, error) {
+	v := os.Getenv("DB_SLOW_QUERY_THRESHOLD")
+	if v == "" {
+		return defaultSlowQueryThreshold, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid DB_SLOW_QUERY_THRESHOLD %q", v)
+	}
+	return d, nil
+}
+
+// slowQueryLogger is a pgx tracer that logs queries taking longer than
+// threshold. Parameters are sanitized as they may hold personal data.
+type slowQueryLogger struct {
+	threshold time.Duration
+}
+
+type queryStart struct {
+	at   time.Time
+	sql  string
+	args []any
+}
+
+type queryStartKey struct{}
+
+func (l slowQueryLogger) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{at: time.Now(), sql: data.SQL, args: data.Args})
+}
+
+func (l slowQueryLogger) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	q, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	if elapsed := time.Since(q.at); elapsed >= l.threshold {
+		slog.Warn("Slow query",
+			"operation", operationFrom(ctx),
+			"duration", elapsed,
+			"sql", strings.Join(strings.Fields(q.sql), " "),
+			"args", sanitizeArgs(q.args),
+			"error", data.Err)
+	}
+}
+
+// sanitizeArgs renders query parameters for logs. Numbers, booleans, times
+// and IDs are kept; other strings and binary values only show their size.
+func sanitizeArgs(args []any) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case nil:
+			out[i] = "NULL"
+		case bool, int, int32, int64, uint, uint32, uint64, float64, time.Time, time.Duration:
+			out[i] = fmt.Sprint(v)
+		case *uint:
+			if v == nil {
+				out[i] = "NULL"
+			} else {
+				out[i] = fmt.Sprint(*v)
+			}
+		case string:
+			if _, err := uuid.Parse(v); err == nil || isULID(v) {
+				out[i] = v
+			} else {
+				out[i] = fmt.Sprintf("<string len=%d>", len(v))
+			}
+		case []string:
+			out[i] = fmt.Sprintf("<%d strings>", len(v))
+		case []byte:
+			out[i] = fmt.Sprintf("<%d bytes>", len(v))
+		default:
+			out[i] = fmt.Sprintf("<%T>", v)
+		}
+	}
+	return out
+}
+
+func (m *instrumentedService) Health() HealthReport {
+	return m.next.Health()
+}
+
+func (m *instrumentedService) Close() error {
+	return m.next.Close()
+}
+
+// ListenUserChanges is not timed; it runs until ctx is done.
+func (m *instrumentedService) ListenUserChanges(ctx context.Context, fn func(UserChangeNotification)) error {
+	return m.next.ListenUserChanges(ctx, fn)
+}
+
+func (m *instrumentedService) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	ctx, done := m.start(ctx, "CreateUser")
+	defer done()
+	return m.next.CreateUser(ctx, user)
+}
+
+func (m *instrumentedService) Migrate(ctx context.Context) error {
+	ctx, done := m.start(ctx, "Migrate")
+	defer done()
+	return m.next.Migrate(ctx)
+}
+
+func (m *instrumentedService) MigrationVersion(ctx context.Context) (uint, bool, error) {
+	ctx, done := m.start(ctx, "MigrationVersion")
+	defer done()
+	return m.next.MigrationVersion(ctx)
+}
+
+func (m *instrumentedService) CreateUsers(ctx context.Context, users []*models.User) error {
+	ctx, done := m.start(ctx, "CreateUsers")
+	defer done()
+	return m.next.CreateUsers(ctx, users)
+}
+
+func (m *instrumentedService) GetUserByID(ctx context.Context, id string, fields ...string) (*models.User, error) {
+	ctx, done := m.start(ctx, "GetUserByID")
+	defer done()
+	return m.next.GetUserByID(ctx, id, fields...)
+}
+
+func (m *instrumentedService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, done := m.start(ctx, "GetUserByEmail")
+	defer done()
+	return m.next.GetUserByEmail(ctx, email)
+}
+
+func (m *instrumentedService) GetUserByUsername(ctx context.Context, name string) (*models.User, error) {
+	ctx, done := m.start(ctx, "GetUserByUsername")
+	defer done()
+	return m.next.GetUserByUsername(ctx, name)
+}
+
+func (m *instrumentedService) CheckUsernameAvailable(ctx context.Context, name string) (bool, error) {
+	ctx, done := m.start(ctx, "CheckUsernameAvailable")
+	defer done()
+	return m.next.CheckUsernameAvailable(ctx, name)
+}
+
+func (m *instrumentedService) UpdateUserByID(ctx context.Context, id string, updates models.UserUpdate) (*models.User, error) {
+	ctx, done := m.start(ctx, "UpdateUserByID")
+	defer done()
+	return m.next.UpdateUserByID(ctx, id, updates)
+}
+
+func (m *instrumentedService) IssueEmailConfirmation(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	ctx, done := m.start(ctx, "IssueEmailConfirmation")
+	defer done()
+	return m.next.IssueEmailConfirmation(ctx, userID, tokenHash, expiresAt)
+}
+
+func (m *instrumentedService) ConfirmEmailChange(ctx context.Context, tokenHash string) (*models.User, error) {
+	ctx, done := m.start(ctx, "ConfirmEmailChange")
+	defer done()
+	return m.next.ConfirmEmailChange(ctx, tokenHash)
+}
+
+func (m *instrumentedService) DeleteUserByID(ctx context.Context, id string) (*models.User, error) {
+	ctx, done := m.start(ctx, "DeleteUserByID")
+	defer done()
+	return m.next.DeleteUserByID(ctx, id)
+}
+
+func (m *instrumentedService) GetUserByIdentity(ctx context.Context, provider, subject string) (*models.User, error) {
+	ctx, done := m.start(ctx, "GetUserByIdentity")
+	defer done()
+	return m.next.GetUserByIdentity(ctx, provider, subject)
+}
+
+func (m *instrumentedService) LinkIdentity(ctx context.Context, identity *models.Identity) error {
+	ctx, done := m.start(ctx, "LinkIdentity")
+	defer done()
+	return m.next.LinkIdentity(ctx, identity)
+}
+
+func (m *instrumentedService) UnlinkIdentity(ctx context.Context, userID, provider string) error {
+	ctx, done := m.start(ctx, "UnlinkIdentity")
+	defer done()
+	return m.next.UnlinkIdentity(ctx, userID, provider)
+}
+
+func (m *instrumentedService) ListIdentities(ctx context.Context, userID string) ([]models.Identity, error) {
+	ctx, done := m.start(ctx, "ListIdentities")
+	defer done()
+	return m.next.ListIdentities(ctx, userID)
+}
+
+func (m *instrumentedService) GetPasswordHash(ctx context.Context, userID string) (string, error) {
+	ctx, done := m.start(ctx, "GetPasswordHash")
+	defer done()
+	return m.next.GetPasswordHash(ctx, userID)
+}
+
+func (m *instrumentedService) SetPasswordHash(ctx context.Context, userID, hash string) error {
+	ctx, done := m.start(ctx, "SetPasswordHash")
+	defer done()
+	return m.next.SetPasswordHash(ctx, userID, hash)
+}
+
+func (m *instrumentedService) GetLockedUntil(ctx context.Context, userID string) (*time.Time, error) {
+	ctx, done := m.start(ctx, "GetLockedUntil")
+	defer done()
+	return m.next.GetLockedUntil(ctx, userID)
+}
+
+func (m *instrumentedService) RecordFailedLogin(ctx context.Context, userID string, policy LockoutPolicy) (*time.Time, error) {
+	ctx, done := m.start(ctx, "RecordFailedLogin")
+	defer done()
+	return m.next.RecordFailedLogin(ctx, userID, policy)
+}
+
+func (m *instrumentedService) ResetFailedLogins(ctx context.Context, userID string) error {
+	ctx, done := m.start(ctx, "ResetFailedLogins")
+	defer done()
+	return m.next.ResetFailedLogins(ctx, userID)
+}
+
+func (m *instrumentedService) UnlockUser(ctx context.Context, userID string) error {
+	ctx, done := m.start(ctx, "UnlockUser")
+	defer done()
+	return m.next.UnlockUser(ctx, userID)
+}
+
+func (m *instrumentedService) SuspendUser(ctx context.Context, id string) (*models.User, error) {
+	ctx, done := m.start(ctx, "SuspendUser")
+	defer done()
+	return m.next.SuspendUser(ctx, id)
+}
+
+func (m *instrumentedService) ActivateUser(ctx context.Context, id string) (*models.User, error) {
+	ctx, done := m.start(ctx, "ActivateUser")
+	defer done()
+	return m.next.ActivateUser(ctx, id)
+}
+
+func (m *instrumentedService) RecordLogin(ctx context.Context, userID string) error {
+	ctx, done := m.start(ctx, "RecordLogin")
+	defer done()
+	return m.next.RecordLogin(ctx, userID)
+}
+
+func (m *instrumentedService) TouchLastSeen(ctx context.Context, seen []models.Activity) error {
+	ctx, done := m.start(ctx, "TouchLastSeen")
+	defer done()
+	return m.next.TouchLastSeen(ctx, seen)
+}
+
+func (m *instrumentedService) AnonymizeUser(ctx context.Context, id string) (*models.User, error) {
+	ctx, done := m.start(ctx, "AnonymizeUser")
+	defer done()
+	return m.next.AnonymizeUser(ctx, id)
+}
+
+func (m *instrumentedService) ExportUserData(ctx context.Context, id string) (*models.UserExport, error) {
+	ctx, done := m.start(ctx, "ExportUserData")
+	defer done()
+	return m.next.ExportUserData(ctx, id)
+}
+
+func (m *instrumentedService) ListUsers(ctx context.Context, filter UserFilter, page Page) ([]models.User, error) {
+	ctx, done := m.start(ctx, "ListUsers")
+	defer done()
+	return m.next.ListUsers(ctx, filter, page)
+}
+
+func (m *instrumentedService) GetUsersByIDs(ctx context.Context, ids []string) ([]models.User, error) {
+	ctx, done := m.start(ctx, "GetUsersByIDs")
+	defer done()
+	return m.next.GetUsersByIDs(ctx, ids)
+}
+
+func (m *instrumentedService) SearchUsers(ctx context.Context, text string, filter UserFilter, page Page) ([]models.User, error) {
+	ctx, done := m.start(ctx, "SearchUsers")
+	defer done()
+	return m.next.SearchUsers(ctx, text, filter, page)
+}
+
+func (m *instrumentedService) CountUsers(ctx context.Context, filter UserFilter) (int64, error) {
+	ctx, done := m.start(ctx, "CountUsers")
+	defer done()
+	return m.next.CountUsers(ctx, filter)
+}
+
+func (m *instrumentedService) UserStats(ctx context.Context, days int) (*models.UserStats, error) {
+	ctx, done := m.start(ctx, "UserStats")
+	defer done()
+	return m.next.UserStats(ctx, days)
+}
+
+func (m *instrumentedService) GetIdempotencyRecord(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+	ctx, done := m.start(ctx, "GetIdempotencyRecord")
+	defer done()
+	return m.next.GetIdempotencyRecord(ctx, key)
+}
+
+func (m *instrumentedService) SaveIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	ctx, done := m.start(ctx, "SaveIdempotencyRecord")
+	defer done()
+	return m.next.SaveIdempotencyRecord(ctx, record)
+}
+
+func (m *instrumentedService) RecordAudit(ctx context.Context, entry *models.AuditEntry) error {
+	ctx, done := m.start(ctx, "RecordAudit")
+	defer done()
+	return m.next.RecordAudit(ctx, entry)
+}
+
+func (m *instrumentedService) ListAuditEntries(ctx context.Context, userID string) ([]models.AuditEntry, error) {
+	ctx, done := m.start(ctx, "ListAuditEntries")
+	defer done()
+	return m.next.ListAuditEntries(ctx, userID)
+}
+
+func (m *instrumentedService) GetTOTP(ctx context.Context, userID string) (*models.TOTP, error) {
+	ctx, done := m.start(ctx, "GetTOTP")
+	defer done()
+	return m.next.GetTOTP(ctx, userID)
+}
+
+func (m *instrumentedService) EnrollTOTP(ctx context.Context, userID, secret string) error {
+	ctx, done := m.start(ctx, "EnrollTOTP")
+	defer done()
+	return m.next.EnrollTOTP(ctx, userID, secret)
+}
+
+func (m *instrumentedService) EnableTOTP(ctx context.Context, userID string, step int64, recoveryHashes []string) error {
+	ctx, done := m.start(ctx, "EnableTOTP")
+	defer done()
+	return m.next.EnableTOTP(ctx, userID, step, recoveryHashes)
+}
+
+func (m *instrumentedService) DisableTOTP(ctx context.Context, userID string) error {
+	ctx, done := m.start(ctx, "DisableTOTP")
+	defer done()
+	return m.next.DisableTOTP(ctx, userID)
+}
+
+func (m *instrumentedService) RegenerateRecoveryCodes(ctx context.Context, userID string, recoveryHashes []string) error {
+	ctx, done := m.start(ctx, "RegenerateRecoveryCodes")
+	defer done()
+	return m.next.RegenerateRecoveryCodes(ctx, userID, recoveryHashes)
+}
+
+func (m *instrumentedService) RecordTOTPUse(ctx context.Context, userID string, step int64) (bool, error) {
+	ctx, done := m.start(ctx, "RecordTOTPUse")
+	defer done()
+	return m.next.RecordTOTPUse(ctx, userID, step)
+}
+
+func (m *instrumentedService) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	ctx, done := m.start(ctx, "UseRecoveryCode")
+	defer done()
+	return m.next.UseRecoveryCode(ctx, userID, codeHash)
+}
+
+func (m *instrumentedService) CreateAPIKey(ctx context.Context, key *models.APIKey, hash string) error {
+	ctx, done := m.start(ctx, "CreateAPIKey")
+	defer done()
+	return m.next.CreateAPIKey(ctx, key, hash)
+}
+
+func (m *instrumentedService) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	ctx, done := m.start(ctx, "GetAPIKeyByHash")
+	defer done()
+	return m.next.GetAPIKeyByHash(ctx, hash)
+}
+
+func (m *instrumentedService) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	ctx, done := m.start(ctx, "ListAPIKeys")
+	defer done()
+	return m.next.ListAPIKeys(ctx)
+}
+
+func (m *instrumentedService) RevokeAPIKey(ctx context.Context, id string) error {
+	ctx, done := m.start(ctx, "RevokeAPIKey")
+	defer done()
+	return m.next.RevokeAPIKey(ctx, id)
+}
+
+func (m *instrumentedService) TouchAPIKey(ctx context.Context, id string) error {
+	ctx, done := m.start(ctx, "TouchAPIKey")
+	defer done()
+	return m.next.TouchAPIKey(ctx, id)
+}
+
+func (m *instrumentedService) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	ctx, done := m.start(ctx, "CreateWebhook")
+	defer done()
+	return m.next.CreateWebhook(ctx, webhook)
+}
+
+func (m *instrumentedService) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	ctx, done := m.start(ctx, "GetWebhook")
+	defer done()
+	return m.next.GetWebhook(ctx, id)
+}
+
+func (m *instrumentedService) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	ctx, done := m.start(ctx, "ListWebhooks")
+	defer done()
+	return m.next.ListWebhooks(ctx)
+}
+
+func (m *instrumentedService) ListWebhooksForEvent(ctx context.Context, eventType string) ([]models.Webhook, error) {
+	ctx, done := m.start(ctx, "ListWebhooksForEvent")
+	defer done()
+	return m.next.ListWebhooksForEvent(ctx, eventType)
+}
+
+func (m *instrumentedService) DeleteWebhook(ctx context.Context, id string) error {
+	ctx, done := m.start(ctx, "DeleteWebhook")
+	defer done()
+	return m.next.DeleteWebhook(ctx, id)
+}
+
+func (m *instrumentedService) RecordWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	ctx, done := m.start(ctx, "RecordWebhookDelivery")
+	defer done()
+	return m.next.RecordWebhookDelivery(ctx, delivery)
+}
+
+func (m *instrumentedService) ListWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	ctx, done := m.start(ctx, "ListWebhookDeliveries")
+	defer done()
+	return m.next.ListWebhookDeliveries(ctx, webhookID, limit)
+}
+
+func (m *instrumentedService) UpdateUsers(ctx context.Context, ids []string, updates models.UserUpdate) ([]models.BulkResult, error) {
+	ctx, done := m.start(ctx, "UpdateUsers")
+	defer done()
+	return m.next.UpdateUsers(ctx, ids, updates)
+}
+
+func (m *instrumentedService) DeleteUsers(ctx context.Context, filter UserFilter, limit int, opts DeleteOptions) (*DeleteResult, error) {
+	ctx, done := m.start(ctx, "DeleteUsers")
+	defer done()
+	return m.next.DeleteUsers(ctx, filter, limit, opts)
+}
+
+func (m *instrumentedService) UpsertUserByEmail(ctx context.Context, user *models.User) (bool, error) {
+	ctx, done := m.start(ctx, "UpsertUserByEmail")
+	defer done()
+	return m.next.UpsertUserByEmail(ctx, user)
+}
+
+func (m *instrumentedService) GetUsersChangedSince(ctx context.Context, since time.Time, cursor string, limit int) (*models.ChangeSet, error) {
+	ctx, done := m.start(ctx, "GetUsersChangedSince")
+	defer done()
+	return m.next.GetUsersChangedSince(ctx, since, cursor, limit)
+}
+
+func (m *instrumentedService) PurgeAnonymizedUsers(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	ctx, done := m.start(ctx, "PurgeAnonymizedUsers")
+	defer done()
+	return m.next.PurgeAnonymizedUsers(ctx, before, limit, dryRun)
+}
+
+func (m *instrumentedService) PurgeExpiredTokens(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	ctx, done := m.start(ctx, "PurgeExpiredTokens")
+	defer done()
+	return m.next.PurgeExpiredTokens(ctx, before, limit, dryRun)
+}
+
+func (m *instrumentedService) TrimAuditLog(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	ctx, done := m.start(ctx, "TrimAuditLog")
+	defer done()
+	return m.next.TrimAuditLog(ctx, before, limit, dryRun)
+}
+
+func (m *instrumentedService) TrimTombstones(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	ctx, done := m.start(ctx, "TrimTombstones")
+	defer done()
+	return m.next.TrimTombstones(ctx, before, limit, dryRun)
+}
+
+func (m *instrumentedService) EnqueueJob(ctx context.Context, job *models.Job) error {
+	ctx, done := m.start(ctx, "EnqueueJob")
+	defer done()
+	return m.next.EnqueueJob(ctx, job)
+}
+
+func (m *instrumentedService) ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]models.Job, error) {
+	ctx, done := m.start(ctx, "ClaimJobs")
+	defer done()
+	return m.next.ClaimJobs(ctx, kinds, limit, lease)
+}
+
+func (m *instrumentedService) CompleteJob(ctx context.Context, id int64) error {
+	ctx, done := m.start(ctx, "CompleteJob")
+	defer done()
+	return m.next.CompleteJob(ctx, id)
+}
+
+func (m *instrumentedService) FailJob(ctx context.Context, id int64, message string, retryIn time.Duration) error {
+	ctx, done := m.start(ctx, "FailJob")
+	defer done()
+	return m.next.FailJob(ctx, id, message, retryIn)
+}
+
+func (m *instrumentedService) ListJobs(ctx context.Context, status models.JobStatus, page Page) ([]models.Job, error) {
+	ctx, done := m.start(ctx, "ListJobs")
+	defer done()
+	return m.next.ListJobs(ctx, status, page)
+}
+
+func (m *instrumentedService) RetryJob(ctx context.Context, id int64) (*models.Job, error) {
+	ctx, done := m.start(ctx, "RetryJob")
+	defer done()
+	return m.next.RetryJob(ctx, id)
+}
+
+func (m *instrumentedService) IssuePasswordReset(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	ctx, done := m.start(ctx, "IssuePasswordReset")
+	defer done()
+	return m.next.IssuePasswordReset(ctx, userID, tokenHash, expiresAt)
+}
+
+func (m *instrumentedService) ResetPassword(ctx context.Context, tokenHash, hash string) (string, error) {
+	ctx, done := m.start(ctx, "ResetPassword")
+	defer done()
+	return m.next.ResetPassword(ctx, tokenHash, hash)
+}
+
+func (m *instrumentedService) GetNotificationTemplate(ctx context.Context, name string, locales []string) (*models.NotificationTemplate, error) {
+	ctx, done := m.start(ctx, "GetNotificationTemplate")
+	defer done()
+	return m.next.GetNotificationTemplate(ctx, name, locales)
+}
+
+func (m *instrumentedService) ListNotificationTemplates(ctx context.Context) ([]models.NotificationTemplate, error) {
+	ctx, done := m.start(ctx, "ListNotificationTemplates")
+	defer done()
+	return m.next.ListNotificationTemplates(ctx)
+}
+
+func (m *instrumentedService) PutNotificationTemplate(ctx context.Context, tmpl *models.NotificationTemplate) error {
+	ctx, done := m.start(ctx, "PutNotificationTemplate")
+	defer done()
+	return m.next.PutNotificationTemplate(ctx, tmpl)
+}
+
+func (m *instrumentedService) DeleteNotificationTemplate(ctx context.Context, name, locale string) error {
+	ctx, done := m.start(ctx, "DeleteNotificationTemplate")
+	defer done()
+	return m.next.DeleteNotificationTemplate(ctx, name, locale)
+}
+
+func (m *instrumentedService) ListFeatureFlags(ctx context.Context) ([]models.FeatureFlag, error) {
+	ctx, done := m.start(ctx, "ListFeatureFlags")
+	defer done()
+	return m.next.ListFeatureFlags(ctx)
+}
+
+func (m *instrumentedService) SetFeatureFlag(ctx context.Context, name string, enabled bool) (*models.FeatureFlag, error) {
+	ctx, done := m.start(ctx, "SetFeatureFlag")
+	defer done()
+	return m.next.SetFeatureFlag(ctx, name, enabled)
+}
+
+func (m *instrumentedService) DeleteFeatureFlag(ctx context.Context, name string) error {
+	ctx, done := m.start(ctx, "DeleteFeatureFlag")
+	defer done()
+	return m.next.DeleteFeatureFlag(ctx, name)
+}
+
+func (m *instrumentedService) GetMetadata(ctx context.Context, userID string) (models.Metadata, error) {
+	ctx, done := m.start(ctx, "GetMetadata")
+	defer done()
+	return m.next.GetMetadata(ctx, userID)
+}
+
+func (m *instrumentedService) SetMetadata(ctx context.Context, userID string, md models.Metadata) (models.Metadata, error) {
+	ctx, done := m.start(ctx, "SetMetadata")
+	defer done()
+	return m.next.SetMetadata(ctx, userID, md)
+}
+
+func (m *instrumentedService) MergeMetadata(ctx context.Context, userID string, patch models.Metadata) (models.Metadata, error) {
+	ctx, done := m.start(ctx, "MergeMetadata")
+	defer done()
+	return m.next.MergeMetadata(ctx, userID, patch)
+}
+
+func (m *instrumentedService) AddUserTags(ctx context.Context, id string, tags []string) (*models.User, error) {
+	ctx, done := m.start(ctx, "AddUserTags")
+	defer done()
+	return m.next.AddUserTags(ctx, id, tags)
+}
+
+func (m *instrumentedService) RemoveUserTags(ctx context.Context, id string, tags []string) (*models.User, error) {
+	ctx, done := m.start(ctx, "RemoveUserTags")
+	defer done()
+	return m.next.RemoveUserTags(ctx, id, tags)
+}
+
+func (m *instrumentedService) CreateGroup(ctx context.Context, group *models.Group) error {
+	ctx, done := m.start(ctx, "CreateGroup")
+	defer done()
+	return m.next.CreateGroup(ctx, group)
+}
+
+func (m *instrumentedService) GetGroup(ctx context.Context, id string) (*models.Group, error) {
+	ctx, done := m.start(ctx, "GetGroup")
+	defer done()
+	return m.next.GetGroup(ctx, id)
+}
+
+func (m *instrumentedService) ListGroups(ctx context.Context, page Page) ([]models.Group, error) {
+	ctx, done := m.start(ctx, "ListGroups")
+	defer done()
+	return m.next.ListGroups(ctx, page)
+}
+
+func (m *instrumentedService) UpdateGroup(ctx context.Context, id string, updates models.GroupUpdate) (*models.Group, error) {
+	ctx, done := m.start(ctx, "UpdateGroup")
+	defer done()
+	return m.next.UpdateGroup(ctx, id, updates)
+}
+
+func (m *instrumentedService) DeleteGroup(ctx context.Context, id string) error {
+	ctx, done := m.start(ctx, "DeleteGroup")
+	defer done()
+	return m.next.DeleteGroup(ctx, id)
+}
+
+func (m *instrumentedService) AddUserToGroup(ctx context.Context, groupID, userID string) error {
+	ctx, done := m.start(ctx, "AddUserToGroup")
+	defer done()
+	return m.next.AddUserToGroup(ctx, groupID, userID)
+}
+
+func (m *instrumentedService) RemoveUserFromGroup(ctx context.Context, groupID, userID string) error {
+	ctx, done := m.start(ctx, "RemoveUserFromGroup")
+	defer done()
+	return m.next.RemoveUserFromGroup(ctx, groupID, userID)
+}
+
+func (m *instrumentedService) ListGroupMembers(ctx context.Context, groupID string, page Page) ([]models.User, error) {
+	ctx, done := m.start(ctx, "ListGroupMembers")
+	defer done()
+	return m.next.ListGroupMembers(ctx, groupID, page)
+}
+
+func (m *instrumentedService) ListUserGroups(ctx context.Context, userID string) ([]models.Group, error) {
+	ctx, done := m.start(ctx, "ListUserGroups")
+	defer done()
+	return m.next.ListUserGroups(ctx, userID)
+}
+
+func (m *instrumentedService) GetPreferences(ctx context.Context, userID string) (*models.Preferences, error) {
+	ctx, done := m.start(ctx, "GetPreferences")
+	defer done()
+	return m.next.GetPreferences(ctx, userID)
+}
+
+func (m *instrumentedService) UpdatePreferences(ctx context.Context, userID string, updates models.PreferencesUpdate) (*models.Preferences, error) {
+	ctx, done := m.start(ctx, "UpdatePreferences")
+	defer done()
+	return m.next.UpdatePreferences(ctx, userID, updates)
+}
+
+func (m *instrumentedService) QueryAudit(ctx context.Context, filter AuditFilter, page Page) ([]models.AuditEntry, error) {
+	ctx, done := m.start(ctx, "QueryAudit")
+	defer done()
+	return m.next.QueryAudit(ctx, filter, page)
+}
+
+func (m *instrumentedService) EachAuditEntry(ctx context.Context, filter AuditFilter, fn func(models.AuditEntry) error) error {
+	ctx, done := m.start(ctx, "EachAuditEntry")
+	defer done()
+	return m.next.EachAuditEntry(ctx, filter, fn)
+}
+
+func (m *instrumentedService) RecordPurgeRun(ctx context.Context, run *models.PurgeRun) error {
+	ctx, done := m.start(ctx, "RecordPurgeRun")
+	defer done()
+	return m.next.RecordPurgeRun(ctx, run)
+}
+
+func (m *instrumentedService) ListPurgeRuns(ctx context.Context, job string, page Page) ([]models.PurgeRun, error) {
+	ctx, done := m.start(ctx, "ListPurgeRuns")
+	defer done()
+	return m.next.ListPurgeRuns(ctx, job, page)
+}
+
+func (m *instrumentedService) CountSearchUsers(ctx context.Context, text string, filter UserFilter) (int64, error) {
+	ctx, done := m.start(ctx, "CountSearchUsers")
+	defer done()
+	return m.next.CountSearchUsers(ctx, text, filter)
+}
+
+func (m *instrumentedService) CountAudit(ctx context.Context, filter AuditFilter) (int64, error) {
+	ctx, done := m.start(ctx, "CountAudit")
+	defer done()
+	return m.next.CountAudit(ctx, filter)
+}
+
+func (m *instrumentedService) CountGroups(ctx context.Context) (int64, error) {
+	ctx, done := m.start(ctx, "CountGroups")
+	defer done()
+	return m.next.CountGroups(ctx)
+}
+
+func (m *instrumentedService) CountGroupMembers(ctx context.Context, groupID string) (int64, error) {
+	ctx, done := m.start(ctx, "CountGroupMembers")
+	defer done()
+	return m.next.CountGroupMembers(ctx, groupID)
+}
+
+func (m *instrumentedService) FindPotentialDuplicates(ctx context.Context, user *models.User) ([]models.DuplicateCandidate, error) {
+	ctx, done := m.start(ctx, "FindPotentialDuplicates")
+	defer done()
+	return m.next.FindPotentialDuplicates(ctx, user)
+}
+
+func (m *instrumentedService) MergeUsers(ctx context.Context, primaryID, duplicateID string) (*models.User, error) {
+	ctx, done := m.start(ctx, "MergeUsers")
+	defer done()
+	return m.next.MergeUsers(ctx, primaryID, duplicateID)
+}
+
+func (m *instrumentedService) CountJobs(ctx context.Context, status models.JobStatus) (int64, error) {
+	ctx, done := m.start(ctx, "CountJobs")
+	defer done()
+	return m.next.CountJobs(ctx, status)
+}
+
+func (m *instrumentedService) RefreshUserDirectory(ctx context.Context, limit int) (int, error) {
+	ctx, done := m.start(ctx, "RefreshUserDirectory")
+	defer done()
+	return m.next.RefreshUserDirectory(ctx, limit)
+}
+
+func (m *instrumentedService) SyncUserFeed(ctx context.Context, consumer string, limit int, apply func(ctx context.Context, batch models.FeedBatch) error) (int, error) {
+	ctx, done := m.start(ctx, "SyncUserFeed")
+	defer done()
+	return m.next.SyncUserFeed(ctx, consumer, limit, apply)
+}
+
+func (m *instrumentedService) ResetUserFeed(ctx context.Context, consumer string, at time.Time) error {
+	ctx, done := m.start(ctx, "ResetUserFeed")
+	defer done()
+	return m.next.ResetUserFeed(ctx, consumer, at)
+}
+
+func (m *instrumentedService) ScanUsers(ctx context.Context, after string, limit int) ([]models.TenantUser, error) {
+	ctx, done := m.start(ctx, "ScanUsers")
+	defer done()
+	return m.next.ScanUsers(ctx, after, limit)
+}
+
+func (m *instrumentedService) PartitionUsers(ctx context.Context, partitions int) error {
+	ctx, done := m.start(ctx, "PartitionUsers")
+	defer done()
+	return m.next.PartitionUsers(ctx, partitions)
+}
+
+func (m *instrumentedService) UserPartitions(ctx context.Context) ([]models.Partition, error) {
+	ctx, done := m.start(ctx, "UserPartitions")
+	defer done()
+	return m.next.UserPartitions(ctx)
+}
+
+func (m *instrumentedService) MaintainUserPartitions(ctx context.Context) error {
+	ctx, done := m.start(ctx, "MaintainUserPartitions")
+	defer done()
+	return m.next.MaintainUserPartitions(ctx)
+}
+
+func (m *instrumentedService) EncryptUserPII(ctx context.Context, after string, limit int) (string, int, error) {
+	ctx, done := m.start(ctx, "EncryptUserPII")
+	defer done()
+	return m.next.EncryptUserPII(ctx, after, limit)
+}
+
+func (m *instrumentedService) DryRun(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, done := m.start(ctx, "DryRun")
+	defer done()
+	return m.next.DryRun(ctx, fn)
+}
+
+func (m *instrumentedService) ListQuotas(ctx context.Context) ([]models.Quota, error) {
+	ctx, done := m.start(ctx, "ListQuotas")
+	defer done()
+	return m.next.ListQuotas(ctx)
+}
+
+func (m *instrumentedService) SetQuota(ctx context.Context, name string, limit int64) (*models.Quota, error) {
+	ctx, done := m.start(ctx, "SetQuota")
+	defer done()
+	return m.next.SetQuota(ctx, name, limit)
+}
+
+func (m *instrumentedService) DeleteQuota(ctx context.Context, name string) error {
+	ctx, done := m.start(ctx, "DeleteQuota")
+	defer done()
+	return m.next.DeleteQuota(ctx, name)
+}
+
+func (m *instrumentedService) RecordConsent(ctx context.Context, consent *models.Consent) error {
+	ctx, done := m.start(ctx, "RecordConsent")
+	defer done()
+	return m.next.RecordConsent(ctx, consent)
+}
+
+func (m *instrumentedService) GetConsents(ctx context.Context, userID string) ([]models.Consent, error) {
+	ctx, done := m.start(ctx, "GetConsents")
+	defer done()
+	return m.next.GetConsents(ctx, userID)
+}
+
+func (m *instrumentedService) SnapshotUser(ctx context.Context, id string) (*models.UserSnapshot, error) {
+	ctx, done := m.start(ctx, "SnapshotUser")
+	defer done()
+	return m.next.SnapshotUser(ctx, id)
+}
+
+func (m *instrumentedService) RestoreUserSnapshot(ctx context.Context, snapshot *models.UserSnapshot, version int) (*models.User, error) {
+	ctx, done := m.start(ctx, "RestoreUserSnapshot")
+	defer done()
+	return m.next.RestoreUserSnapshot(ctx, snapshot, version)
+}
+
+func (m *instrumentedService) CreateExportJob(ctx context.Context, job *models.ExportJob) error {
+	ctx, done := m.start(ctx, "CreateExportJob")
+	defer done()
+	return m.next.CreateExportJob(ctx, job)
+}
+
+func (m *instrumentedService) GetExportJob(ctx context.Context, id int64) (*models.ExportJob, error) {
+	ctx, done := m.start(ctx, "GetExportJob")
+	defer done()
+	return m.next.GetExportJob(ctx, id)
+}
+
+func (m *instrumentedService) ListExportJobs(ctx context.Context, page Page) ([]models.ExportJob, error) {
+	ctx, done := m.start(ctx, "ListExportJobs")
+	defer done()
+	return m.next.ListExportJobs(ctx, page)
+}
+
+func (m *instrumentedService) CountExportJobs(ctx context.Context) (int64, error) {
+	ctx, done := m.start(ctx, "CountExportJobs")
+	defer done()
+	return m.next.CountExportJobs(ctx)
+}
+
+func (m *instrumentedService) UpdateExportJob(ctx context.Context, job *models.ExportJob) error {
+	ctx, done := m.start(ctx, "UpdateExportJob")
+	defer done()
+	return m.next.UpdateExportJob(ctx, job)
+}
+
+func (m *instrumentedService) DeleteExportJob(ctx context.Context, id int64) error {
+	ctx, done := m.start(ctx, "DeleteExportJob")
+	defer done()
+	return m.next.DeleteExportJob(ctx, id)
+}
+
+func (m *instrumentedService) EachUser(ctx context.Context, filter UserFilter, fn func(models.User) error) error {
+	ctx, done := m.start(ctx, "EachUser")
+	defer done()
+	return m.next.EachUser(ctx, filter, fn)
+}
+
+func (m *instrumentedService) RefreshGrowthStats(ctx context.Context) (int64, error) {
+	ctx, done := m.start(ctx, "RefreshGrowthStats")
+	defer done()
+	return m.next.RefreshGrowthStats(ctx)
+}
+
+func (m *instrumentedService) GetGrowthStats(ctx context.Context, from, to time.Time) (*models.GrowthStats, error) {
+	ctx, done := m.start(ctx, "GetGrowthStats")
+	defer done()
+	return m.next.GetGrowthStats(ctx, from, to)
+}
+
+func (m *instrumentedService) PurgeDeadJobs(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	ctx, done := m.start(ctx, "PurgeDeadJobs")
+	defer done()
+	return m.next.PurgeDeadJobs(ctx, before, limit, dryRun)
+}
+
+func (m *instrumentedService) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	ctx, done := m.start(ctx, "ReserveIdempotencyKey")
+	defer done()
+	return m.next.ReserveIdempotencyKey(ctx, record)
+}
+
+func (m *instrumentedService) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	ctx, done := m.start(ctx, "ReleaseIdempotencyKey")
+	defer done()
+	return m.next.ReleaseIdempotencyKey(ctx, key)
+}
+
+func (m *instrumentedService) IssueEmailVerification(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	ctx, done := m.start(ctx, "IssueEmailVerification")
+	defer done()
+	return m.next.IssueEmailVerification(ctx, userID, tokenHash, expiresAt)
+}
+
+func (m *instrumentedService) CanonicalizeEmails(ctx context.Context, after string, limit int) (CanonicalEmails, error) {
+	ctx, done := m.start(ctx, "CanonicalizeEmails")
+	defer done()
+	return m.next.CanonicalizeEmails(ctx, after, limit)
+}
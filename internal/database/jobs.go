@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// DefaultJobAttempts is how often a job runs before it is marked dead.
+const DefaultJobAttempts = 5
+
+// ErrJobQueued is returned when a dead job is retried while another job
+// with the same key is already waiting.
+var ErrJobQueued = errors.New("a job with the same key is already queued")
+
+const jobFields = `id, kind, tenant_id, COALESCE(key, ''), payload, status, attempts, max_attempts, run_at, COALESCE(last_error, ''), created, updated_at`
+
+func scanJob(row interface{ Scan(...any) error }) (*models.Job, error) {
+	var job models.Job
+	err := row.Scan(&job.ID, &job.Kind, &job.TenantID, &job.Key, &job.Payload, &job.Status,
+		&job.Attempts, &job.MaxAttempts, &job.RunAt, &job.LastError, &job.Created, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func scanJobs(rows pgx.Rows) ([]models.Job, error) {
+	defer rows.Close()
+	jobs := []models.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// EnqueueJob stores job for the tenant of ctx, filling in its ID. A job
+// whose key is already pending or running is dropped silently and keeps a
+// zero ID.
+func (s *service) EnqueueJob(ctx context.Context, job *models.Job) error {
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = DefaultJobAttempts
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = s.now()
+	}
+	if len(job.Payload) == 0 {
+		job.Payload = []byte("{}")
+	}
+	job.TenantID = tenant.FromContext(ctx)
+	job.Status = models.JobPending
+
+	err := s.db.QueryRow(ctx, `
+        INSERT INTO jobs (kind, tenant_id, key, payload, max_attempts, run_at)
+        VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6)
+        ON CONFLICT (key) WHERE key IS NOT NULL AND status <> 'dead' DO NOTHING
+        RETURNING id, created, updated_at
+    `, job.Kind, job.TenantID, job.Key, job.Payload, job.MaxAttempts, job.RunAt).Scan(&job.ID, &job.Created, &job.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+// ClaimJobs locks up to limit due jobs of the given kinds for lease. Jobs
+// whose lease ran out, because their worker died, are claimed again; those
+// already out of attempts are marked dead instead.
+func (s *service) ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]models.Job, error) {
+	var jobs []models.Job
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+            UPDATE jobs
+            SET status = 'dead', locked_until = NULL, last_error = 'worker lease expired', updated_at = now()
+            WHERE status = 'running' AND locked_until < now() AND attempts >= max_attempts
+        `)
+		if err != nil {
+			return err
+		}
+		rows, err := tx.Query(ctx, fmt.Sprintf(`
+            UPDATE jobs
+            SET status = 'running', attempts = attempts + 1,
+                locked_until = now() + make_interval(secs => $3), updated_at = now()
+            WHERE id IN (
+                SELECT id FROM jobs
+                WHERE kind = ANY($1)
+                  AND ((status = 'pending' AND run_at <= now()) OR (status = 'running' AND locked_until < now()))
+                ORDER BY run_at, id
+                LIMIT $2
+                FOR UPDATE SKIP LOCKED
+            )
+            RETURNING %s
+        `, jobFields), kinds, limit, lease.Seconds())
+		if err != nil {
+			return err
+		}
+		jobs, err = scanJobs(rows)
+		return err
+	})
+	return jobs, err
+}
+
+// CompleteJob removes a finished job.
+func (s *service) CompleteJob(ctx context.Context, id int64) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM jobs WHERE id = $1`, id)
+	return err
+}
+
+// FailJob records a failed attempt and schedules the next one after
+// retryIn, or marks the job dead when it has no attempts left.
+func (s *service) FailJob(ctx context.Context, id int64, message string, retryIn time.Duration) error {
+	_, err := s.db.Exec(ctx, `
+        UPDATE jobs
+        SET status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+            run_at = now() + make_interval(secs => $3),
+            locked_until = NULL,
+            last_error = $2,
+            updated_at = now()
+        WHERE id = $1
+    `, id, message, retryIn.Seconds())
+	return err
+}
+
+// ListJobs returns a page of the jobs of the tenant of ctx, oldest first.
+// An empty status lists every job.
+func (s *service) ListJobs(ctx context.Context, status models.JobStatus, page Page) ([]models.Job, error) {
+	page = page.Normalize()
+	rows, err := s.db.Query(ctx, fmt.Sprintf(`
+        SELECT %s FROM jobs
+        WHERE tenant_id = $1 AND ($2 = '' OR status = $2)
+        ORDER BY id
+        LIMIT $3 OFFSET $4
+    `, jobFields), tenant.FromContext(ctx), status, page.Limit, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+// CountJobs returns the number of jobs with status across all tenants, as
+// the health check watches the queue as a whole. An empty status counts
+// every job.
+func (s *service) CountJobs(ctx context.Context, status models.JobStatus) (int64, error) {
+	var n int64
+	err := s.db.QueryRow(ctx, `SELECT count(*) FROM jobs WHERE $1 = '' OR status = $1`, status).Scan(&n)
+	return n, err
+}
+
+// RetryJob gives a dead job of the tenant of ctx a fresh set of attempts,
+// starting now. It returns sql.ErrNoRows when the tenant has no dead job
+// with that ID.
+func (s *service) RetryJob(ctx context.Context, id int64) (*models.Job, error) {
+	job, err := scanJob(s.db.QueryRow(ctx, fmt.Sprintf(`
+        UPDATE jobs
+        SET status = 'pending', attempts = 0, run_at = now(), updated_at = now()
+        WHERE id = $1 AND tenant_id = $2 AND status = 'dead'
+        RETURNING %s
+    `, jobFields), id, tenant.FromContext(ctx)))
+	if err != nil {
+		return nil, mapConstraintError(err)
+	}
+	return job, nil
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"users/internal/models"
+	"users/internal/pii"
+	"users/internal/tenant"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+// UserFilter narrows down the users returned by list queries. Zero values
+// are ignored; the tenant always comes from the context.
+type UserFilter struct {
+	Email    string
+	Username string
+	Status   models.UserStatus
+	// InactiveSince keeps users not seen since this time. Users never seen
+	// count from their creation.
+	InactiveSince time.Time
+	// CreatedAfter and CreatedBefore bound the creation time, the former
+	// inclusively, so consecutive windows never overlap.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// TagsAny keeps users carrying at least one of the tags, TagsAll those
+	// carrying every one of them.
+	TagsAny []string
+	TagsAll []string
+	// Metadata keeps users whose metadata holds every key with a value
+	// whose text equals the given one, so "true" matches a boolean and
+	// "42" a number.
+	Metadata map[string]string
+}
+
+// Page selects a window of an ordered result set.
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// Normalize applies the default and maximum limit, as every list does.
+func (p Page) Normalize() Page {
+	if p.Limit <= 0 {
+		p.Limit = DefaultPageLimit
+	}
+	if p.Limit > MaxPageLimit {
+		p.Limit = MaxPageLimit
+	}
+	if p.Offset < 0 {
+		p.Offset = 0
+	}
+	return p
+}
+
+// empty reports whether the filter keeps every user of the tenant.
+func (f UserFilter) empty() bool {
+	return f.Email == "" && f.Username == "" && f.Status == "" && f.InactiveSince.IsZero() &&
+		f.CreatedAfter.IsZero() && f.CreatedBefore.IsZero() && len(f.TagsAny) == 0 && len(f.TagsAll) == 0 &&
+		len(f.Metadata) == 0
+}
+
+// where renders the filter as a WHERE clause, appending its parameters to args.
+// An email also matches its blind index under keys.
+func (f UserFilter) where(ctx context.Context, keys *pii.Keyring, args []any) (string, []any) {
+	args = append(args, tenant.FromContext(ctx))
+	conds := []string{fmt.Sprintf("tenant_id = $%d", len(args))}
+	if f.Email != "" {
+		args = append(args, emailLookup(keys, normalizeEmail(ctx, f.Email)))
+		conds = append(conds, fmt.Sprintf("lower(email) = ANY($%d)", len(args)))
+	}
+	if f.Username != "" {
+		args = append(args, f.Username)
+		conds = append(conds, fmt.Sprintf("lower(username) = lower($%d)", len(args)))
+	}
+	if f.Status != "" {
+		args = append(args, f.Status)
+		conds = append(conds, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if !f.InactiveSince.IsZero() {
+		args = append(args, f.InactiveSince)
+		conds = append(conds, fmt.Sprintf("COALESCE(last_seen_at, created) < $%d", len(args)))
+	}
+	if !f.CreatedAfter.IsZero() {
+		args = append(args, f.CreatedAfter)
+		conds = append(conds, fmt.Sprintf("created >= $%d", len(args)))
+	}
+	if !f.CreatedBefore.IsZero() {
+		args = append(args, f.CreatedBefore)
+		conds = append(conds, fmt.Sprintf("created < $%d", len(args)))
+	}
+	if len(f.TagsAny) > 0 {
+		args = append(args, normalizeTags(f.TagsAny))
+		conds = append(conds, fmt.Sprintf("tags && $%d", len(args)))
+	}
+	if len(f.TagsAll) > 0 {
+		args = append(args, normalizeTags(f.TagsAll))
+		conds = append(conds, fmt.Sprintf("tags @> $%d", len(args)))
+	}
+	for _, key := range sortedKeys(f.Metadata) {
+		args = append(args, key, f.Metadata[key])
+		conds = append(conds, fmt.Sprintf("metadata ->> $%d = $%d", len(args)-1, len(args)))
+	}
+
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+func (s *service) ListUsers(ctx context.Context, filter UserFilter, page Page) ([]models.User, error) {
+	page = page.Normalize()
+
+	where, args := filter.where(ctx, s.piiKeys, nil)
+	args = append(args, page.Limit, page.Offset)
+	query := fmt.Sprintf(`SELECT %s FROM %s%s ORDER BY created, id LIMIT $%d OFFSET $%d`,
+		selectList("", defaultUserFields), s.userSource(), where, len(args)-1, len(args))
+
+	var users []models.User
+	err := s.read(ctx, "ListUsers", func(db conn) (err error) {
+		users, err = s.queryUsers(ctx, db, query, args...)
+		return err
+	})
+	return users, err
+}
+
+// queryUsers runs a query selecting defaultUserFields and scans every row.
+func (s *service) queryUsers(ctx context.Context, db conn, query string, args ...any) ([]models.User, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := s.scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+// GetUsersByIDs returns the users with the given IDs in a single query. IDs
+// that do not exist are skipped, so the result may be shorter than ids.
+func (s *service) GetUsersByIDs(ctx context.Context, ids []string) ([]models.User, error) {
+	if len(ids) == 0 {
+		return []models.User{}, nil
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM users WHERE id = ANY($1) AND tenant_id = $2`, selectList("", defaultUserFields))
+	var users []models.User
+	err := s.retry(ctx, "GetUsersByIDs", isTransient, func() (err error) {
+		users, err = s.queryUsers(ctx, s.db, query, ids, tenant.FromContext(ctx))
+		return err
+	})
+	return users, err
+}
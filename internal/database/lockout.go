@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// LockoutPolicy decides when repeated failed logins lock an account.
+type LockoutPolicy struct {
+	// MaxFailures failed logins within Window lock the account for Duration.
+	MaxFailures int
+	Window      time.Duration
+	Duration    time.Duration
+}
+
+// GetLockedUntil returns when the user's lockout ends, or nil when the
+// account is not locked.
+func (s *service) GetLockedUntil(ctx context.Context, userID string) (*time.Time, error) {
+	var until *time.Time
+	query := `SELECT CASE WHEN locked_until > now() THEN locked_until END FROM users WHERE id = $1 AND tenant_id = $2`
+	if err := s.db.QueryRow(ctx, query, userID, tenant.FromContext(ctx)).Scan(&until); err != nil {
+		return nil, err
+	}
+	return until, nil
+}
+
+// RecordFailedLogin counts a failed login and locks the account once the
+// policy's threshold is reached within its window. It returns when the
+// lockout ends if this failure locked the account.
+func (s *service) RecordFailedLogin(ctx context.Context, userID string, policy LockoutPolicy) (*time.Time, error) {
+	var until *time.Time
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		// Every expression sees the row as it was before the update
+		err := tx.QueryRow(ctx, `
+            WITH attempt AS (
+                SELECT id,
+                       CASE WHEN first_failed_login_at IS NULL OR first_failed_login_at < now() - make_interval(secs => $3)
+                            THEN 1 ELSE failed_logins + 1 END AS failures
+                FROM users WHERE id = $1 AND tenant_id = $2
+                FOR UPDATE
+            )
+            UPDATE users u
+            SET failed_logins = CASE WHEN a.failures >= $4 THEN 0 ELSE a.failures END,
+                first_failed_login_at = CASE WHEN a.failures = 1 THEN now() ELSE u.first_failed_login_at END,
+                locked_until = CASE WHEN a.failures >= $4 THEN now() + make_interval(secs => $5) ELSE u.locked_until END
+            FROM attempt a
+            WHERE u.id = a.id
+            RETURNING CASE WHEN a.failures >= $4 THEN u.locked_until END
+        `, userID, tenant.FromContext(ctx), policy.Window.Seconds(), policy.MaxFailures, policy.Duration.Seconds()).Scan(&until)
+		if err != nil || until == nil {
+			return err
+		}
+		return recordAudit(ctx, tx, &models.AuditEntry{
+			Action:       models.AuditUserLocked,
+			TargetUserID: userID,
+			Details:      map[string]any{"locked_until": until},
+		})
+	})
+	return until, err
+}
+
+// ResetFailedLogins forgets the failed logins of a user after a successful
+// login.
+func (s *service) ResetFailedLogins(ctx context.Context, userID string) error {
+	_, err := s.db.Exec(ctx, `
+        UPDATE users SET failed_logins = 0, first_failed_login_at = NULL
+        WHERE id = $1 AND tenant_id = $2 AND failed_logins > 0
+    `, userID, tenant.FromContext(ctx))
+	return err
+}
+
+// UnlockUser lifts a lockout before its cooldown ends.
+func (s *service) UnlockUser(ctx context.Context, userID string) error {
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx, `
+            UPDATE users SET failed_logins = 0, first_failed_login_at = NULL, locked_until = NULL
+            WHERE id = $1 AND tenant_id = $2
+        `, userID, tenant.FromContext(ctx))
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return sql.ErrNoRows
+		}
+		return recordAudit(ctx, tx, &models.AuditEntry{Action: models.AuditUserUnlocked, TargetUserID: userID})
+	})
+}
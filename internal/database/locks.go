@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/tenant"
+)
+
+// userLockSpace is the first key of the two key advisory locks taken on
+// users, keeping them apart from the single key locks of migrations and
+// feed consumers. The second key is a hash of the tenant and user ID.
+const userLockSpace = 0x75736572 // "user"
+
+// userLockKey names the lock of the user id of the tenant of ctx.
+func userLockKey(ctx context.Context, id string) string {
+	return tenant.FromContext(ctx) + "/" + id
+}
+
+// lockUsers takes the advisory locks of the users ids for the rest of tx,
+// in a fixed order so operations locking the same users cannot deadlock.
+// The locks serialize operations on a user across instances without
+// locking rows or tables.
+func lockUsers(ctx context.Context, tx pgx.Tx, ids ...string) error {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = userLockKey(ctx, id)
+	}
+	slices.Sort(keys)
+	for _, key := range slices.Compact(keys) {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2))`, userLockSpace, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+	"users/internal/validator"
+)
+
+var (
+	// ErrMergeSelf is returned when a user is merged into itself.
+	ErrMergeSelf = errors.New("a user cannot be merged into itself")
+	// ErrNotMergeable is returned when either user is anonymized or
+	// already merged.
+	ErrNotMergeable = errors.New("anonymized or merged users cannot be merged")
+)
+
+type mergeSide struct {
+	email      string
+	status     models.UserStatus
+	anonymized bool
+	tags       []string
+	metadata   models.Metadata
+}
+
+// MergeUsers folds the duplicate into the primary user in one transaction.
+// The primary takes over the duplicate's group memberships, linked
+// identities for providers it has not linked itself, preferences if it has
+// none, tags, audit history and consents, of which the latest of either
+// user is in force. Metadata is combined with the primary's keys winning.
+// The duplicate is kept as a merged user pointing at the primary, with its
+// email freed and its credentials removed. It returns the updated primary.
+func (s *service) MergeUsers(ctx context.Context, primaryID, duplicateID string) (*models.User, error) {
+	if primaryID == duplicateID {
+		return nil, ErrMergeSelf
+	}
+	tenantID := tenant.FromContext(ctx)
+
+	var primary *models.User
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		if err := lockUsers(ctx, tx, primaryID, duplicateID); err != nil {
+			return err
+		}
+		// Lock in a fixed order so two opposite merges cannot deadlock
+		rows, err := tx.Query(ctx, `
+            SELECT id, COALESCE(email_ciphertext, email), status, anonymized_at IS NOT NULL, tags, metadata
+            FROM users WHERE id = ANY($1) AND tenant_id = $2
+            ORDER BY id FOR UPDATE
+        `, []string{primaryID, duplicateID}, tenantID)
+		if err != nil {
+			return err
+		}
+		sides := map[string]*mergeSide{}
+		for rows.Next() {
+			var id string
+			var raw []byte
+			side := &mergeSide{}
+			if err := rows.Scan(&id, sealedString{s.piiKeys, &side.email}, &side.status, &side.anonymized, &side.tags, &raw); err != nil {
+				rows.Close()
+				return err
+			}
+			if side.metadata, err = decodeMetadata(raw); err != nil {
+				rows.Close()
+				return err
+			}
+			sides[id] = side
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		p, d := sides[primaryID], sides[duplicateID]
+		if p == nil || d == nil {
+			return sql.ErrNoRows
+		}
+		if p.anonymized || d.anonymized || p.status == models.StatusMerged || d.status == models.StatusMerged {
+			return ErrNotMergeable
+		}
+
+		tags := normalizeTags(append(p.tags, d.tags...))
+		if len(tags) > MaxUserTags {
+			return ErrTooManyTags
+		}
+		metadata := d.metadata
+		for key, value := range p.metadata {
+			metadata[key] = value
+		}
+		if err := validator.ValidateMetadata(metadata); err != nil {
+			return err
+		}
+		doc, err := json.Marshal(metadata)
+		if err != nil {
+			return err
+		}
+
+		for _, stmt := range []string{
+			`INSERT INTO group_members (group_id, user_id, tenant_id, added_at)
+             SELECT group_id, $1, $3, added_at FROM group_members WHERE user_id = $2
+             ON CONFLICT DO NOTHING`,
+			`DELETE FROM group_members WHERE user_id = $2`,
+			`UPDATE identities SET user_id = $1
+             WHERE user_id = $2 AND tenant_id = $3
+               AND provider NOT IN (SELECT provider FROM identities WHERE user_id = $1)`,
+			// A second account of a provider the primary already linked
+			// would log in as nobody
+			`DELETE FROM identities WHERE user_id = $2 AND tenant_id = $3`,
+			`INSERT INTO user_preferences (user_id, tenant_id, email_notifications, security_alerts, newsletter, theme, updated_at)
+             SELECT $1, $3, email_notifications, security_alerts, newsletter, theme, updated_at
+             FROM user_preferences WHERE user_id = $2
+             ON CONFLICT DO NOTHING`,
+			`DELETE FROM user_preferences WHERE user_id = $2`,
+			`DELETE FROM totp_recovery_codes WHERE user_id = $2`,
+			`DELETE FROM user_totp WHERE user_id = $2`,
+			`UPDATE audit_log SET target_user_id = $1 WHERE target_user_id = $2 AND tenant_id = $3`,
+			`UPDATE consents SET user_id = $1 WHERE user_id = $2 AND tenant_id = $3`,
+		} {
+			if _, err := tx.Exec(ctx, stmt, primaryID, duplicateID, tenantID); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(ctx, `
+            UPDATE users
+            SET status = 'merged',
+                merged_into = $3,
+                email = 'merged+' || id || '@invalid',
+                email_ciphertext = NULL,
+                username = NULL,
+                pending_email = NULL,
+                pending_email_ciphertext = NULL,
+                email_token_hash = NULL,
+                email_token_expires_at = NULL,
+                reset_token_hash = NULL,
+                reset_token_expires_at = NULL,
+                password_hash = NULL,
+                metadata = '{}',
+                tags = '{}',
+                version = version + 1,
+                updated_at = now()
+            WHERE id = $1 AND tenant_id = $2
+        `, duplicateID, tenantID, primaryID)
+		if err != nil {
+			return err
+		}
+		primary, err = s.scanUser(tx.QueryRow(ctx, `
+            UPDATE users SET tags = $3, metadata = $4, version = version + 1, updated_at = now()
+            WHERE id = $1 AND tenant_id = $2
+            RETURNING `+selectList("", defaultUserFields),
+			primaryID, tenantID, tags, doc))
+		if err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, tx, &models.AuditEntry{
+			Action:       models.AuditUserMerged,
+			TargetUserID: primaryID,
+			Details:      map[string]any{"duplicate_id": duplicateID, "duplicate_email": d.email},
+		})
+	})
+	if err != nil {
+		return nil, mapConstraintError(err)
+	}
+	return primary, nil
+}
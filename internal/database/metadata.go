@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+	"users/internal/validator"
+)
+
+// GetMetadata returns the user's metadata, empty when none is set.
+func (s *service) GetMetadata(ctx context.Context, userID string) (models.Metadata, error) {
+	var raw []byte
+	err := s.read(ctx, "GetMetadata", func(db conn) error {
+		return db.QueryRow(ctx, `SELECT metadata FROM users WHERE id = $1 AND tenant_id = $2`,
+			userID, tenant.FromContext(ctx)).Scan(&raw)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return decodeMetadata(raw)
+}
+
+// SetMetadata replaces the user's metadata with md.
+func (s *service) SetMetadata(ctx context.Context, userID string, md models.Metadata) (models.Metadata, error) {
+	if md == nil {
+		md = models.Metadata{}
+	}
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		return s.writeMetadata(ctx, tx, userID, md, sortedKeys(md))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// MergeMetadata sets the keys of patch on the user's metadata, removing
+// those whose value is nil, and returns the result. The merged metadata
+// must stay within the limits of validator.ValidateMetadata.
+func (s *service) MergeMetadata(ctx context.Context, userID string, patch models.Metadata) (models.Metadata, error) {
+	var merged models.Metadata
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		var raw []byte
+		err := tx.QueryRow(ctx, `SELECT metadata FROM users WHERE id = $1 AND tenant_id = $2 FOR UPDATE`,
+			userID, tenant.FromContext(ctx)).Scan(&raw)
+		if err != nil {
+			return err
+		}
+		if merged, err = decodeMetadata(raw); err != nil {
+			return err
+		}
+		for key, value := range patch {
+			if value == nil {
+				delete(merged, key)
+			} else {
+				merged[key] = value
+			}
+		}
+		if err := validator.ValidateMetadata(merged); err != nil {
+			return err
+		}
+		return s.writeMetadata(ctx, tx, userID, merged, sortedKeys(patch))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// writeMetadata stores md and audits the change of keys. Like any other
+// change of the user it moves the version and updated_at, so caches and
+// the change feeds see it.
+func (s *service) writeMetadata(ctx context.Context, tx pgx.Tx, userID string, md models.Metadata, keys []string) error {
+	doc, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(ctx, `
+        UPDATE users SET metadata = $3, version = version + 1, updated_at = now()
+        WHERE id = $1 AND tenant_id = $2
+    `, userID, tenant.FromContext(ctx), doc)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+	return recordAudit(ctx, tx, &models.AuditEntry{
+		Action:       models.AuditMetadataChanged,
+		TargetUserID: userID,
+		Details:      map[string]any{"keys": keys},
+	})
+}
+
+func decodeMetadata(raw []byte) (models.Metadata, error) {
+	md := models.Metadata{}
+	if len(raw) == 0 {
+		return md, nil
+	}
+	if err := json.Unmarshal(raw, &md); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// sortedKeys returns the keys of m in order, so queries and audit details
+// do not depend on map iteration.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"users/migrations"
+)
+
+// The bookkeeping table matches the one used by golang-migrate, so the
+// Makefile targets and the embedded runner can be used interchangeably.
+const schemaMigrationsTable = `
+    CREATE TABLE IF NOT EXISTS schema_migrations (
+        version BIGINT NOT NULL PRIMARY KEY,
+        dirty BOOLEAN NOT NULL
+    )
+`
+
+type migration struct {
+	version uint
+	name    string
+}
+
+// embeddedMigrations returns the embedded up migrations ordered by version.
+func embeddedMigrations() ([]migration, error) {
+	names, err := fs.Glob(migrations.FS, "*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var list []migration
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration name %s", name)
+		}
+		list = append(list, migration{version: uint(version), name: name})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].version < list[j].version })
+	return list, nil
+}
+
+// MigrationVersion returns the currently applied schema version and whether
+// the last migration failed half way.
+func (s *service) MigrationVersion(ctx context.Context) (uint, bool, error) {
+	if _, err := s.db.Exec(ctx, schemaMigrationsTable); err != nil {
+		return 0, false, err
+	}
+
+	var version uint
+	var dirty bool
+	err := s.db.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// migrationLock is the advisory lock key Migrate holds, so instances that
+// migrate on boot at the same time apply each migration once.
+const migrationLock = 0x7573657273 // "users"
+
+// Migrate applies every embedded migration newer than the current version,
+// each in its own transaction.
+func (s *service) Migrate(ctx context.Context) error {
+	lock, err := s.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	if _, err := lock.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLock); err != nil {
+		return err
+	}
+	defer lock.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationLock)
+
+	current, dirty, err := s.MigrationVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("database is dirty at version %d, fix it manually", current)
+	}
+
+	list, err := embeddedMigrations()
+	if err != nil {
+		return err
+	}
+	for _, m := range list {
+		if m.version <= current {
+			continue
+		}
+		if err := s.applyMigration(ctx, m); err != nil {
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+		s.logger.Printf("Applied migration %s", m.name)
+	}
+	return nil
+}
+
+func (s *service) applyMigration(ctx context.Context, m migration) error {
+	body, err := fs.ReadFile(migrations.FS, m.name)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Schema changes may legitimately run longer than DB_STATEMENT_TIMEOUT
+	if _, err := tx.Exec(ctx, `SET LOCAL statement_timeout = 0`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, string(body)); err != nil {
+		// Migrations that refuse to run say what to do about it
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Hint != "" {
+			return fmt.Errorf("%w: %s", err, pgErr.Hint)
+		}
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, m.version); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
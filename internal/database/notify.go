@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// UsersChangedChannel is the channel a trigger notifies on for every
+// created, updated or deleted user.
+const UsersChangedChannel = "users_changed"
+
+// listenRetryDelay is the pause before a lost listener connection is
+// reestablished.
+const listenRetryDelay = time.Second
+
+// UserChangeNotification is the payload sent on UsersChangedChannel.
+type UserChangeNotification struct {
+	TenantID string `json:"tenant_id"`
+	UserID   string `json:"id"`
+	// Op is the statement that changed the user: INSERT, UPDATE or DELETE.
+	Op string `json:"op"`
+}
+
+// ListenUserChanges calls fn for every change committed by any instance
+// until ctx is done. It holds a dedicated connection to the primary and
+// reconnects when it is lost; notifications sent in between are missed, so
+// callers should then treat everything they cached as stale. fn runs on the
+// listener's goroutine and should return quickly.
+func (s *service) ListenUserChanges(ctx context.Context, fn func(UserChangeNotification)) error {
+	for {
+		err := s.listenOnce(ctx, fn)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.logger.Printf("Listening for user changes failed, reconnecting: %v", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+func (s *service) listenOnce(ctx context.Context, fn func(UserChangeNotification)) error {
+	c, err := s.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// A connection that has run LISTEN must not go back to the pool.
+	conn := c.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+UsersChangedChannel); err != nil {
+		return err
+	}
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var change UserChangeNotification
+		if err := json.Unmarshal([]byte(n.Payload), &change); err != nil {
+			s.logger.Printf("Ignoring malformed %s notification %q: %v", UsersChangedChannel, n.Payload, err)
+			continue
+		}
+		fn(change)
+	}
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Option configures the service built by New. Without options everything
+// is read from the environment.
+type Option func(*options)
+
+type options struct {
+	dsn    string
+	pool   *pgxpool.Pool
+	logger *log.Logger
+	now    func() time.Time
+	newID  IDGenerator
+	faults *Faults
+}
+
+// WithDSN connects to dsn instead of the primary configured through
+// DATABASE_URL or the DB_* variables. DB_STATEMENT_TIMEOUT still applies.
+func WithDSN(dsn string) Option {
+	return func(o *options) { o.dsn = dsn }
+}
+
+// WithPool makes the service use p, as configured by the caller, for the
+// primary. The service takes ownership and closes p on Close.
+func WithPool(p *pgxpool.Pool) Option {
+	return func(o *options) { o.pool = p }
+}
+
+// WithLogger sends the service's log output to l instead of the standard
+// logger.
+func WithLogger(l *log.Logger) Option {
+	return func(o *options) { o.logger = l }
+}
+
+// WithClock makes the service read the current time from now, for the
+// timestamps it sets itself rather than leaving to the database.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) { o.now = now }
+}
+
+// WithIDGenerator makes the service assign IDs from newID instead of the
+// generator DB_ID_FORMAT selects.
+func WithIDGenerator(newID IDGenerator) Option {
+	return func(o *options) { o.newID = newID }
+}
+
+// WithFaultInjection makes every query and transaction of the service
+// subject to faults, instead of those configured with the DB_FAULT_*
+// variables. The faults hit beneath the retries, so they exercise the
+// retries, timeouts and circuit breaker like real failures would.
+func WithFaultInjection(faults *Faults) Option {
+	return func(o *options) { o.faults = faults }
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		logger: log.Default(),
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,258 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"users/internal/models"
+)
+
+// maxUserPartitions bounds PartitionUsers. Every partition adds planning
+// work to the queries that span tenants.
+const maxUserPartitions = 256
+
+// ErrAlreadyPartitioned is returned by PartitionUsers when the users table
+// is partitioned already.
+var ErrAlreadyPartitioned = errors.New("the users table is already partitioned")
+
+// partitionIndexSuffix is what the indexes of a partition add to the name
+// of the index of the users table they belong to, so constraint violations
+// raised by a partition map to the same errors.
+var partitionIndexSuffix = regexp.MustCompile(`_p\d+$`)
+
+// partitionSkew is how many times the average a partition may hold before
+// maintenance warns that a few tenants dominate it.
+const partitionSkew = 2
+
+var (
+	partitionRows = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "users_db_partition_rows",
+		Help: "Estimated rows in each partition of the users table as of the last maintenance run.",
+	}, []string{"partition"})
+	partitionBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "users_db_partition_bytes",
+		Help: "Size of each partition of the users table, indexes included, as of the last maintenance run.",
+	}, []string{"partition"})
+)
+
+// usersIndex is an index of the users table, backing a constraint when
+// constraint is set.
+type usersIndex struct {
+	name       string
+	unique     bool
+	using      string
+	constraint string
+}
+
+// usersReference is a foreign key of or referencing the users table.
+type usersReference struct {
+	table, name, definition string
+}
+
+// PartitionUsers rebuilds the users table as partitions hashed on
+// tenant_id, so queries scoped to a tenant only touch its partition. The
+// indexes, constraints, triggers and foreign keys of the table are carried
+// over; every partition gets the indexes with its number appended. The
+// table stays locked while it is copied.
+func (s *service) PartitionUsers(ctx context.Context, partitions int) error {
+	if partitions < 2 || partitions > maxUserPartitions {
+		return fmt.Errorf("partitions must be between 2 and %d", maxUserPartitions)
+	}
+	width := len(strconv.Itoa(partitions - 1))
+	names := make([]string, partitions)
+	for i := range names {
+		names[i] = fmt.Sprintf("users_p%0*d", width, i)
+	}
+
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		for _, stmt := range []string{
+			`SET LOCAL statement_timeout = 0`,
+			`LOCK TABLE users IN ACCESS EXCLUSIVE MODE`,
+		} {
+			if _, err := tx.Exec(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		var partitioned bool
+		err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = 'users'::regclass)`).Scan(&partitioned)
+		if err != nil {
+			return err
+		}
+		if partitioned {
+			return ErrAlreadyPartitioned
+		}
+
+		indexes, err := collect(ctx, tx, `
+            SELECT ic.relname, i.indisunique, substring(pg_get_indexdef(i.indexrelid) FROM ' USING .*$'),
+                   COALESCE(pg_get_constraintdef(c.oid), '')
+            FROM pg_index i
+            JOIN pg_class ic ON ic.oid = i.indexrelid
+            LEFT JOIN pg_constraint c ON c.conindid = i.indexrelid AND c.conrelid = i.indrelid
+            WHERE i.indrelid = 'users'::regclass
+        `, func(row pgx.CollectableRow) (usersIndex, error) {
+			var ix usersIndex
+			err := row.Scan(&ix.name, &ix.unique, &ix.using, &ix.constraint)
+			return ix, err
+		})
+		if err != nil {
+			return err
+		}
+		references, err := collect(ctx, tx, `
+            SELECT conrelid::regclass::text, conname, pg_get_constraintdef(oid)
+            FROM pg_constraint
+            WHERE contype = 'f' AND (confrelid = 'users'::regclass OR conrelid = 'users'::regclass)
+        `, func(row pgx.CollectableRow) (usersReference, error) {
+			var ref usersReference
+			err := row.Scan(&ref.table, &ref.name, &ref.definition)
+			return ref, err
+		})
+		if err != nil {
+			return err
+		}
+		triggers, err := collect(ctx, tx, `
+            SELECT pg_get_triggerdef(oid) FROM pg_trigger WHERE tgrelid = 'users'::regclass AND NOT tgisinternal
+        `, pgx.RowTo[string])
+		if err != nil {
+			return err
+		}
+		// Generated columns are computed again as rows are copied
+		var columns string
+		err = tx.QueryRow(ctx, `
+            SELECT string_agg(quote_ident(attname), ', ' ORDER BY attnum) FROM pg_attribute
+            WHERE attrelid = 'users'::regclass AND attnum > 0 AND NOT attisdropped AND attgenerated = ''
+        `).Scan(&columns)
+		if err != nil {
+			return err
+		}
+
+		stmts := []string{`
+            CREATE TABLE users_partitioned (LIKE users INCLUDING DEFAULTS INCLUDING CONSTRAINTS
+                INCLUDING GENERATED INCLUDING STORAGE INCLUDING COMMENTS)
+            PARTITION BY HASH (tenant_id)`,
+		}
+		for i, name := range names {
+			stmts = append(stmts, fmt.Sprintf(`CREATE TABLE %s PARTITION OF users_partitioned FOR VALUES WITH (MODULUS %d, REMAINDER %d)`,
+				name, partitions, i))
+		}
+		stmts = append(stmts, `INSERT INTO users_partitioned (`+columns+`) SELECT `+columns+` FROM users`)
+		for _, ref := range references {
+			stmts = append(stmts, fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT %s`, ref.table, pgx.Identifier{ref.name}.Sanitize()))
+		}
+		stmts = append(stmts, `DROP TABLE users`, `ALTER TABLE users_partitioned RENAME TO users`)
+
+		// Indexes are first built on every partition under a name of their
+		// own, which the index of the partitioned table then adopts. A
+		// unique index that does not include tenant_id cannot be created.
+		for _, ix := range indexes {
+			for _, part := range names {
+				name := pgx.Identifier{ix.name + part[len("users"):]}.Sanitize()
+				stmts = append(stmts, indexStatement(ix, name, part))
+			}
+			stmts = append(stmts, indexStatement(ix, pgx.Identifier{ix.name}.Sanitize(), "users"))
+		}
+		stmts = append(stmts, triggers...)
+		for _, ref := range references {
+			stmts = append(stmts, fmt.Sprintf(`ALTER TABLE %s ADD CONSTRAINT %s %s`, ref.table, pgx.Identifier{ref.name}.Sanitize(), ref.definition))
+		}
+		stmts = append(stmts, `ANALYZE users`)
+
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("%w: %s", err, stmt)
+			}
+		}
+		return nil
+	})
+}
+
+// indexStatement creates ix on table under name.
+func indexStatement(ix usersIndex, name, table string) string {
+	if ix.constraint != "" {
+		return fmt.Sprintf(`ALTER TABLE %s ADD CONSTRAINT %s %s`, table, name, ix.constraint)
+	}
+	unique := ""
+	if ix.unique {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf(`CREATE %sINDEX %s ON %s%s`, unique, name, table, ix.using)
+}
+
+// collect scans every row of a query.
+func collect[T any](ctx context.Context, tx pgx.Tx, query string, scan pgx.RowToFunc[T]) ([]T, error) {
+	rows, err := tx.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scan)
+}
+
+// UserPartitions lists the partitions of the users table with their
+// estimated rows and size, or none while the table is not partitioned.
+func (s *service) UserPartitions(ctx context.Context) ([]models.Partition, error) {
+	rows, err := s.db.Query(ctx, `
+        SELECT c.relname, GREATEST(c.reltuples, 0)::bigint, pg_total_relation_size(c.oid)
+        FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+        WHERE i.inhparent = 'users'::regclass
+        ORDER BY c.relname
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	partitions := []models.Partition{}
+	for rows.Next() {
+		var p models.Partition
+		if err := rows.Scan(&p.Name, &p.Rows, &p.Bytes); err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, p)
+	}
+	return partitions, rows.Err()
+}
+
+// MaintainUserPartitions analyzes the partitioned users table, which
+// autovacuum only does for the partitions, exports the size of every
+// partition and warns about partitions far larger than the others. It does
+// nothing while the table is not partitioned.
+func (s *service) MaintainUserPartitions(ctx context.Context) error {
+	partitions, err := s.UserPartitions(ctx)
+	if err != nil || len(partitions) == 0 {
+		return err
+	}
+	// Without statistics of its own, the planner misjudges every query on
+	// the partitioned table that is not pruned to a single partition
+	err = s.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SET LOCAL statement_timeout = 0`); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `ANALYZE users`)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if partitions, err = s.UserPartitions(ctx); err != nil {
+		return err
+	}
+
+	var total int64
+	for _, p := range partitions {
+		total += p.Rows
+		partitionRows.WithLabelValues(p.Name).Set(float64(p.Rows))
+		partitionBytes.WithLabelValues(p.Name).Set(float64(p.Bytes))
+	}
+	average := total / int64(len(partitions))
+	for _, p := range partitions {
+		if average > 0 && p.Rows > partitionSkew*average {
+			s.logger.Printf("Partition %s holds %d users, more than %d times the average of %d", p.Name, p.Rows, partitionSkew, average)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// GetPasswordHash returns the stored hash, or an empty string for users that
+// only sign in through a provider.
+func (s *service) GetPasswordHash(ctx context.Context, userID string) (string, error) {
+	var hash sql.NullString
+	query := `SELECT password_hash FROM users WHERE id = $1 AND tenant_id = $2`
+	if err := s.db.QueryRow(ctx, query, userID, tenant.FromContext(ctx)).Scan(&hash); err != nil {
+		return "", err
+	}
+	return hash.String, nil
+}
+
+// SetPasswordHash stores a new password hash and records the change.
+func (s *service) SetPasswordHash(ctx context.Context, userID, hash string) error {
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx, `
+            UPDATE users SET password_hash = $3, reset_token_hash = NULL, reset_token_expires_at = NULL
+            WHERE id = $1 AND tenant_id = $2
+        `, userID, tenant.FromContext(ctx), hash)
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return sql.ErrNoRows
+		}
+		return recordAudit(ctx, tx, &models.AuditEntry{Action: models.AuditPasswordChanged, TargetUserID: userID})
+	})
+}
+
+// IssuePasswordReset attaches a reset token to the user, replacing any
+// earlier one.
+func (s *service) IssuePasswordReset(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	res, err := s.db.Exec(ctx, `
+        UPDATE users SET reset_token_hash = $3, reset_token_expires_at = $4
+        WHERE id = $1 AND tenant_id = $2
+    `, userID, tenant.FromContext(ctx), tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ResetPassword stores a new password hash for the user holding an
+// unexpired reset token, consumes the token and lifts any lockout. It
+// returns the user's ID, or sql.ErrNoRows for unknown or expired tokens.
+func (s *service) ResetPassword(ctx context.Context, tokenHash, hash string) (string, error) {
+	var userID string
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+            UPDATE users
+            SET password_hash = $3,
+                reset_token_hash = NULL,
+                reset_token_expires_at = NULL,
+                failed_logins = 0,
+                first_failed_login_at = NULL,
+                locked_until = NULL
+            WHERE reset_token_hash = $1 AND tenant_id = $2 AND reset_token_expires_at > now()
+            RETURNING id
+        `, tokenHash, tenant.FromContext(ctx), hash).Scan(&userID)
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, &models.AuditEntry{Action: models.AuditPasswordReset, TargetUserID: userID})
+	})
+	return userID, err
+}
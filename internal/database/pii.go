@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/pii"
+)
+
+// sealedColumns map the fields that are stored encrypted while a service
+// has PII keys to the columns holding their ciphertext. The fields' own columns
+// then hold blind indexes, so uniqueness and lookups by equality keep
+// working on them.
+var sealedColumns = map[string]string{
+	"email":         "email_ciphertext",
+	"pending_email": "pending_email_ciphertext",
+}
+
+// sealEmail returns what is stored of a normalized email: its blind index
+// and ciphertext under keys, the address itself and no ciphertext with
+// nil keys.
+func sealEmail(keys *pii.Keyring, email string) (string, *string, error) {
+	if keys == nil || email == "" {
+		return email, nil, nil
+	}
+	ciphertext, err := keys.Encrypt(email)
+	if err != nil {
+		return "", nil, err
+	}
+	return keys.BlindIndex(email), &ciphertext, nil
+}
+
+// emailLookup returns the stored values a normalized email matches: the
+// address itself, which rows not encrypted yet hold, and its blind index
+// under keys.
+func emailLookup(keys *pii.Keyring, email string) []string {
+	if keys == nil {
+		return []string{email}
+	}
+	return []string{email, keys.BlindIndex(email)}
+}
+
+// errNoPIIKeys is returned when reading an encrypted value without
+// PII_ENCRYPTION_KEYS.
+var errNoPIIKeys = errors.New("email is stored encrypted but PII_ENCRYPTION_KEYS is not set")
+
+// sealedString scans a nullable column that may hold a value encrypted by
+// sealEmail, decrypting it with keys, and maps NULL to "".
+type sealedString struct {
+	keys *pii.Keyring
+	s    *string
+}
+
+func (v sealedString) Scan(src any) error {
+	var ns sql.NullString
+	if err := ns.Scan(src); err != nil {
+		return err
+	}
+	if !pii.Encrypted(ns.String) {
+		*v.s = ns.String
+		return nil
+	}
+	if v.keys == nil {
+		return errNoPIIKeys
+	}
+	plaintext, err := v.keys.Decrypt(ns.String)
+	if err != nil {
+		return err
+	}
+	*v.s = plaintext
+	return nil
+}
+
+// ErrPIIEncryptionDisabled is returned by EncryptUserPII unless
+// PII_ENCRYPTION_KEYS is set.
+var ErrPIIEncryptionDisabled = errors.New("PII encryption is disabled")
+
+// EncryptUserPII encrypts the emails of up to limit users of all tenants
+// with IDs after after, in ID order, that are stored in plaintext or
+// encrypted with a key other than the current one. It returns the last ID
+// it looked at, "" once there are none left, and how many users it
+// encrypted. Neither the version nor updated_at of the users change.
+func (s *service) EncryptUserPII(ctx context.Context, after string, limit int) (string, int, error) {
+	if s.piiKeys == nil {
+		return "", 0, ErrPIIEncryptionDisabled
+	}
+	limit = Page{Limit: limit}.Normalize().Limit
+
+	type stored struct {
+		id, tenantID                         string
+		email, emailCiphertext               string
+		pendingEmail, pendingEmailCiphertext string
+	}
+	var last string
+	var encrypted int
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		last, encrypted = "", 0
+		rows, err := tx.Query(ctx, `
+            SELECT id, tenant_id, COALESCE(email_ciphertext, email), COALESCE(email_ciphertext, ''),
+                   COALESCE(pending_email_ciphertext, pending_email), COALESCE(pending_email_ciphertext, '')
+            FROM users WHERE id > $1 ORDER BY id LIMIT $2
+            FOR UPDATE
+        `, after, limit)
+		if err != nil {
+			return err
+		}
+		page, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (stored, error) {
+			var u stored
+			err := row.Scan(&u.id, &u.tenantID, sealedString{s.piiKeys, &u.email}, &u.emailCiphertext,
+				sealedString{s.piiKeys, &u.pendingEmail}, &u.pendingEmailCiphertext)
+			return u, err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, u := range page {
+			last = u.id
+			if s.piiKeys.Current(u.emailCiphertext) &&
+				(u.pendingEmail == "" || s.piiKeys.Current(u.pendingEmailCiphertext)) {
+				continue
+			}
+			email, emailCiphertext, err := sealEmail(s.piiKeys, u.email)
+			if err != nil {
+				return err
+			}
+			pendingEmail, pendingEmailCiphertext, err := sealEmail(s.piiKeys, u.pendingEmail)
+			if err != nil {
+				return err
+			}
+			for _, table := range []string{"users", "user_directory"} {
+				_, err := tx.Exec(ctx, `
+                    UPDATE `+table+`
+                    SET email = $3, email_ciphertext = $4, pending_email = NULLIF($5, ''), pending_email_ciphertext = $6
+                    WHERE id = $1 AND tenant_id = $2
+                `, u.id, u.tenantID, email, emailCiphertext, pendingEmail, pendingEmailCiphertext)
+				if err != nil {
+					return mapConstraintError(err)
+				}
+			}
+			encrypted++
+		}
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return last, encrypted, nil
+}
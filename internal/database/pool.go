@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"users/internal/secrets"
+)
+
+// conn is the query API shared by the pool and transactions.
+type conn interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// pool is a pgx connection pool whose rows report a missing result as
+// sql.ErrNoRows, which is what the Service interface promises its callers.
+type pool struct {
+	*pgxpool.Pool
+	// faults are injected into every query and transaction, see Faults.
+	faults *Faults
+}
+
+// poolOptions are applied to the primary and replica pools alike.
+type poolOptions struct {
+	// credentials replace those in the connection string when set.
+	credentials *secrets.Cache
+	tracer      pgx.QueryTracer
+	faults      *Faults
+}
+
+func newPool(ctx context.Context, dsn string, opts poolOptions) (*pool, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if opts.credentials != nil {
+		useCredentials(cfg, opts.credentials)
+	}
+	cfg.ConnConfig.Tracer = opts.tracer
+	p, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &pool{Pool: p, faults: opts.faults}, nil
+}
+
+// Exec and the other query methods of the pool run on the transaction of
+// the dry run ctx belongs to, if any, see DryRun; transactions begun within
+// one are savepoints of it.
+func (p *pool) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if err := p.faults.inject(ctx, operationFrom(ctx)); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	if t := dryRunTx(ctx); t != nil {
+		return t.Exec(ctx, sql, args...)
+	}
+	return p.Pool.Exec(ctx, sql, args...)
+}
+
+func (p *pool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if err := p.faults.inject(ctx, operationFrom(ctx)); err != nil {
+		return nil, err
+	}
+	if t := dryRunTx(ctx); t != nil {
+		return t.Query(ctx, sql, args...)
+	}
+	return p.Pool.Query(ctx, sql, args...)
+}
+
+func (p *pool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if err := p.faults.inject(ctx, operationFrom(ctx)); err != nil {
+		return faultyRow{err}
+	}
+	if t := dryRunTx(ctx); t != nil {
+		return row{t.QueryRow(ctx, sql, args...)}
+	}
+	return row{p.Pool.QueryRow(ctx, sql, args...)}
+}
+
+func (p *pool) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	if err := p.faults.inject(ctx, operationFrom(ctx)); err != nil {
+		return faultyBatch{err}
+	}
+	if t := dryRunTx(ctx); t != nil {
+		return t.SendBatch(ctx, b)
+	}
+	return p.Pool.SendBatch(ctx, b)
+}
+
+func (p *pool) CopyFrom(ctx context.Context, table pgx.Identifier, columns []string, rows pgx.CopyFromSource) (int64, error) {
+	if err := p.faults.inject(ctx, operationFrom(ctx)); err != nil {
+		return 0, err
+	}
+	if t := dryRunTx(ctx); t != nil {
+		return t.CopyFrom(ctx, table, columns, rows)
+	}
+	return p.Pool.CopyFrom(ctx, table, columns, rows)
+}
+
+func (p *pool) Begin(ctx context.Context) (pgx.Tx, error) {
+	if err := p.faults.inject(ctx, operationFrom(ctx)); err != nil {
+		return nil, err
+	}
+	begin := p.Pool.Begin
+	if t := dryRunTx(ctx); t != nil {
+		begin = t.Begin
+	}
+	t, err := begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tx{t}, nil
+}
+
+// BeginTx is Begin with opts. Within a dry run it starts a savepoint of
+// the dry run's transaction instead, whose options then apply.
+func (p *pool) BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	if err := p.faults.inject(ctx, operationFrom(ctx)); err != nil {
+		return nil, err
+	}
+	begin := func(ctx context.Context) (pgx.Tx, error) { return p.Pool.BeginTx(ctx, opts) }
+	if t := dryRunTx(ctx); t != nil {
+		begin = t.Begin
+	}
+	t, err := begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tx{t}, nil
+}
+
+type tx struct {
+	pgx.Tx
+}
+
+func (t tx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return row{t.Tx.QueryRow(ctx, sql, args...)}
+}
+
+type row struct {
+	pgx.Row
+}
+
+func (r row) Scan(dest ...any) error {
+	err := r.Row.Scan(dest...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return sql.ErrNoRows
+	}
+	return err
+}
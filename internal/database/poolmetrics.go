@@ -0,0 +1,107 @@
+package database
+
+import (
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// defaultPoolMetricsInterval is how often pool statistics are exported
+// unless DB_POOL_METRICS_INTERVAL says otherwise.
+const defaultPoolMetricsInterval = 10 * time.Second
+
+var (
+	poolConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "users_db_pool_connections",
+		Help: "Connections of each database pool by state: acquired, idle or constructing.",
+	}, []string{"pool", "state"})
+	poolMaxConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "users_db_pool_max_connections",
+		Help: "Maximum size of each database pool.",
+	}, []string{"pool"})
+	poolAcquires = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "users_db_pool_acquires_total",
+		Help: "Connections acquired from each database pool.",
+	}, []string{"pool"})
+	poolEmptyAcquires = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "users_db_pool_empty_acquires_total",
+		Help: "Acquires that had to wait because the pool had no idle connection.",
+	}, []string{"pool"})
+	poolCanceledAcquires = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "users_db_pool_canceled_acquires_total",
+		Help: "Acquires given up because their context ended first.",
+	}, []string{"pool"})
+	poolAcquireSeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "users_db_pool_acquire_duration_seconds_total",
+		Help: "Time spent acquiring connections from each database pool.",
+	}, []string{"pool"})
+	poolClosedConnections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "users_db_pool_closed_connections_total",
+		Help: "Connections closed by each database pool, by reason: max_idle or max_lifetime.",
+	}, []string{"pool", "reason"})
+)
+
+// poolMetricsInterval reads DB_POOL_METRICS_INTERVAL.
+func poolMetricsInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("DB_POOL_METRICS_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+	return defaultPoolMetricsInterval
+}
+
+// poolExporter copies the statistics of one pool into the metrics. pgx
+// keeps cumulative counts, so the counters are advanced by what changed
+// since the previous export.
+type poolExporter struct {
+	name string
+	pool *pool
+
+	acquires, emptyAcquires, canceledAcquires int64
+	acquireDuration                           time.Duration
+	idleClosed, lifetimeClosed                int64
+}
+
+func (e *poolExporter) export() {
+	stat := e.pool.Stat()
+	poolConnections.WithLabelValues(e.name, "acquired").Set(float64(stat.AcquiredConns()))
+	poolConnections.WithLabelValues(e.name, "idle").Set(float64(stat.IdleConns()))
+	poolConnections.WithLabelValues(e.name, "constructing").Set(float64(stat.ConstructingConns()))
+	poolMaxConnections.WithLabelValues(e.name).Set(float64(stat.MaxConns()))
+
+	poolAcquires.WithLabelValues(e.name).Add(float64(stat.AcquireCount() - e.acquires))
+	poolEmptyAcquires.WithLabelValues(e.name).Add(float64(stat.EmptyAcquireCount() - e.emptyAcquires))
+	poolCanceledAcquires.WithLabelValues(e.name).Add(float64(stat.CanceledAcquireCount() - e.canceledAcquires))
+	poolAcquireSeconds.WithLabelValues(e.name).Add((stat.AcquireDuration() - e.acquireDuration).Seconds())
+	poolClosedConnections.WithLabelValues(e.name, "max_idle").Add(float64(stat.MaxIdleDestroyCount() - e.idleClosed))
+	poolClosedConnections.WithLabelValues(e.name, "max_lifetime").Add(float64(stat.MaxLifetimeDestroyCount() - e.lifetimeClosed))
+
+	e.acquires, e.emptyAcquires, e.canceledAcquires = stat.AcquireCount(), stat.EmptyAcquireCount(), stat.CanceledAcquireCount()
+	e.acquireDuration = stat.AcquireDuration()
+	e.idleClosed, e.lifetimeClosed = stat.MaxIdleDestroyCount(), stat.MaxLifetimeDestroyCount()
+}
+
+// exportPoolMetrics exports the statistics of the primary and replica
+// pools every interval until stop is closed.
+func (s *service) exportPoolMetrics(interval time.Duration, stop <-chan struct{}) {
+	exporters := []*poolExporter{{name: "primary", pool: s.db}}
+	if s.replicas != nil {
+		for _, r := range s.replicas.replicas {
+			exporters = append(exporters, &poolExporter{name: redactDSN(r.dsn), pool: r.db})
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, e := range exporters {
+			e.export()
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// getPreferencesQuery selects the preferences of user $1 of tenant $2,
+// falling back to the defaults in $3 to $6.
+const getPreferencesQuery = `
+    SELECT COALESCE(p.email_notifications, $3), COALESCE(p.security_alerts, $4),
+           COALESCE(p.newsletter, $5), COALESCE(p.theme, $6), p.updated_at
+    FROM users u LEFT JOIN user_preferences p ON p.user_id = u.id
+    WHERE u.id = $1 AND u.tenant_id = $2
+`
+
+func getPreferencesArgs(ctx context.Context, userID string) []any {
+	def := models.DefaultPreferences()
+	return []any{userID, tenant.FromContext(ctx), def.EmailNotifications, def.SecurityAlerts, def.Newsletter, def.Theme}
+}
+
+func scanPreferences(row interface{ Scan(...any) error }) (*models.Preferences, error) {
+	var prefs models.Preferences
+	if err := row.Scan(&prefs.EmailNotifications, &prefs.SecurityAlerts, &prefs.Newsletter, &prefs.Theme, &prefs.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+// GetPreferences returns the user's preferences, the defaults for those who
+// never changed them. It returns sql.ErrNoRows when there is no such user.
+func (s *service) GetPreferences(ctx context.Context, userID string) (*models.Preferences, error) {
+	var prefs *models.Preferences
+	err := s.read(ctx, "GetPreferences", func(db conn) (err error) {
+		prefs, err = scanPreferences(db.QueryRow(ctx, getPreferencesQuery, getPreferencesArgs(ctx, userID)...))
+		return err
+	})
+	return prefs, err
+}
+
+// UpdatePreferences applies updates on top of the user's current
+// preferences, or the defaults, and returns the result. It returns
+// sql.ErrNoRows when there is no such user.
+func (s *service) UpdatePreferences(ctx context.Context, userID string, updates models.PreferencesUpdate) (*models.Preferences, error) {
+	def := models.DefaultPreferences()
+	return scanPreferences(s.db.QueryRow(ctx, `
+        INSERT INTO user_preferences (user_id, tenant_id, email_notifications, security_alerts, newsletter, theme)
+        SELECT id, tenant_id, COALESCE($3::boolean, $7), COALESCE($4::boolean, $8), COALESCE($5::boolean, $9), COALESCE($6::text, $10)
+        FROM users WHERE id = $1 AND tenant_id = $2
+        ON CONFLICT (user_id) DO UPDATE
+        SET email_notifications = COALESCE($3::boolean, user_preferences.email_notifications),
+            security_alerts = COALESCE($4::boolean, user_preferences.security_alerts),
+            newsletter = COALESCE($5::boolean, user_preferences.newsletter),
+            theme = COALESCE($6::text, user_preferences.theme),
+            updated_at = now()
+        RETURNING email_notifications, security_alerts, newsletter, theme, updated_at
+    `, userID, tenant.FromContext(ctx), updates.EmailNotifications, updates.SecurityAlerts, updates.Newsletter, updates.Theme,
+		def.EmailNotifications, def.SecurityAlerts, def.Newsletter, def.Theme))
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+)
+
+// The purge methods work across all tenants. They remove at most limit
+// rows when limit is positive, so a large backlog goes in several short
+// batches. With dryRun they count every row that would be removed instead
+// of removing any.
+
+// PurgeAnonymizedUsers deletes users anonymized before before.
+func (s *service) PurgeAnonymizedUsers(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	return s.purge(ctx, dryRun, limit, "users", "tenant_id, id", `anonymized_at < $1`, before)
+}
+
+// PurgeExpiredTokens drops pending email changes whose confirmation token
+// expired before before and such password reset tokens, together with
+// idempotency records expired by then. before is never later than now, so
+// tokens still valid are kept.
+func (s *service) PurgeExpiredTokens(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	if now := s.now(); before.After(now) {
+		before = now
+	}
+	if dryRun {
+		var n int64
+		err := s.db.QueryRow(ctx, `
+            SELECT (SELECT count(*) FROM users WHERE email_token_expires_at < $1)
+                 + (SELECT count(*) FROM users WHERE reset_token_expires_at < $1)
+                 + (SELECT count(*) FROM idempotency_keys WHERE expires_at < $1)
+        `, before).Scan(&n)
+		return n, err
+	}
+
+	var n int64
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx, `
+            UPDATE users
+            SET pending_email = NULL,
+                pending_email_ciphertext = NULL,
+                email_token_hash = NULL,
+                email_token_expires_at = NULL,
+                version = version + 1,
+                updated_at = now()
+            WHERE (tenant_id, id) IN (
+                SELECT tenant_id, id FROM users WHERE email_token_expires_at < $1 LIMIT $2
+            )
+        `, before, limitArg(limit))
+		if err != nil {
+			return err
+		}
+		n = res.RowsAffected()
+		res, err = tx.Exec(ctx, `
+            UPDATE users SET reset_token_hash = NULL, reset_token_expires_at = NULL
+            WHERE (tenant_id, id) IN (
+                SELECT tenant_id, id FROM users WHERE reset_token_expires_at < $1 LIMIT $2
+            )
+        `, before, limitArg(limit))
+		if err != nil {
+			return err
+		}
+		n += res.RowsAffected()
+		res, err = tx.Exec(ctx, `
+            DELETE FROM idempotency_keys
+            WHERE key IN (SELECT key FROM idempotency_keys WHERE expires_at < $1 LIMIT $2)
+        `, before, limitArg(limit))
+		if err != nil {
+			return err
+		}
+		n += res.RowsAffected()
+		return nil
+	})
+	return n, err
+}
+
+// TrimAuditLog deletes audit entries recorded before before.
+func (s *service) TrimAuditLog(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	return s.purge(ctx, dryRun, limit, "audit_log", "id", `created < $1`, before)
+}
+
+// TrimTombstones deletes the deletion records kept for delta syncs from
+// before before. Clients syncing less often than that miss deletions.
+func (s *service) TrimTombstones(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	return s.purge(ctx, dryRun, limit, "user_tombstones", "tenant_id, user_id, deleted_at", `deleted_at < $1`, before)
+}
+
+// PurgeDeadJobs deletes the jobs that ran out of attempts before before,
+// going by their last attempt. Until then they can be retried.
+func (s *service) PurgeDeadJobs(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	return s.purge(ctx, dryRun, limit, "jobs", "id", `status = 'dead' AND updated_at < $1`, before)
+}
+
+// RecordPurgeRun stores the report of a purge job run, filling in its ID.
+func (s *service) RecordPurgeRun(ctx context.Context, run *models.PurgeRun) error {
+	return s.db.QueryRow(ctx, `
+        INSERT INTO purge_runs (job, dry_run, rows, error, started_at, finished_at)
+        VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)
+        RETURNING id
+    `, run.Job, run.DryRun, run.Rows, run.Error, run.StartedAt, run.FinishedAt).Scan(&run.ID)
+}
+
+// ListPurgeRuns returns a page of purge job runs, newest first. An empty
+// job lists the runs of every job.
+func (s *service) ListPurgeRuns(ctx context.Context, job string, page Page) ([]models.PurgeRun, error) {
+	page = page.Normalize()
+	rows, err := s.db.Query(ctx, `
+        SELECT id, job, dry_run, rows, COALESCE(error, ''), started_at, finished_at
+        FROM purge_runs
+        WHERE $1 = '' OR job = $1
+        ORDER BY started_at DESC, id DESC
+        LIMIT $2 OFFSET $3
+    `, job, page.Limit, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.PurgeRun{}
+	for rows.Next() {
+		var run models.PurgeRun
+		if err := rows.Scan(&run.ID, &run.Job, &run.DryRun, &run.Rows, &run.Error, &run.StartedAt, &run.FinishedAt); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// purge deletes, or counts, the rows of table matching where, at most
+// limit of them when limit is positive. key lists the columns identifying
+// a row of table.
+func (s *service) purge(ctx context.Context, dryRun bool, limit int64, table, key, where string, args ...any) (int64, error) {
+	if dryRun {
+		var n int64
+		err := s.db.QueryRow(ctx, `SELECT count(*) FROM `+table+` WHERE `+where, args...).Scan(&n)
+		return n, err
+	}
+	query := fmt.Sprintf(`DELETE FROM %[1]s WHERE (%[2]s) IN (SELECT %[2]s FROM %[1]s WHERE %[3]s LIMIT $%[4]d)`,
+		table, key, where, len(args)+1)
+	res, err := s.db.Exec(ctx, query, append(args, limitArg(limit))...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// limitArg is the LIMIT parameter for limit: none, as NULL, unless it is
+// positive.
+func limitArg(limit int64) any {
+	if limit <= 0 {
+		return nil
+	}
+	return limit
+}
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// The quotas tenants are held to.
+const (
+	// QuotaUsers limits the users of a tenant, anonymized and merged ones
+	// included until they are purged.
+	QuotaUsers = "users"
+	// QuotaAPIKeys limits the API keys of a tenant that are not revoked.
+	QuotaAPIKeys = "api_keys"
+	// QuotaGroupsPerUser limits the groups each user is a member of.
+	QuotaGroupsPerUser = "groups_per_user"
+)
+
+// quota describes how a quota is configured and counted.
+type quota struct {
+	// env holds the default limit of every tenant, unlimited unless set.
+	env string
+	// usage counts what the quota limits for tenant $1 and, for quotas of
+	// each user, user $2.
+	usage   string
+	perUser bool
+}
+
+var quotas = map[string]quota{
+	QuotaUsers: {
+		env:   "QUOTA_USERS",
+		usage: `SELECT count(*) FROM users WHERE tenant_id = $1`,
+	},
+	QuotaAPIKeys: {
+		env:   "QUOTA_API_KEYS",
+		usage: `SELECT count(*) FROM api_keys WHERE tenant_id = $1 AND revoked_at IS NULL`,
+	},
+	QuotaGroupsPerUser: {
+		env:     "QUOTA_GROUPS_PER_USER",
+		usage:   `SELECT count(*) FROM group_members WHERE tenant_id = $1 AND user_id = $2`,
+		perUser: true,
+	},
+}
+
+// quotaLockSpace is the first key of the advisory locks serializing the
+// changes counted against a quota. The second key is a hash of the tenant,
+// quota and, for quotas of each user, user.
+const quotaLockSpace = 0x71756f74 // "quot"
+
+var (
+	// ErrQuotaExceeded is matched by the *QuotaError returned when a
+	// change would take a tenant or user over a quota.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrUnknownQuota is returned when overriding a quota that does not
+	// exist.
+	ErrUnknownQuota = errors.New("unknown quota")
+)
+
+// QuotaError reports the quota a change would exceed.
+type QuotaError struct {
+	Quota string
+	Limit int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota %s of %d exceeded", e.Quota, e.Limit)
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// quotaDefaultsFromEnv reads the default limit of every quota. Invalid
+// values, which CheckConfig reports, leave the quota unlimited.
+func quotaDefaultsFromEnv() map[string]int64 {
+	defaults := make(map[string]int64, len(quotas))
+	for name, q := range quotas {
+		if n, err := strconv.ParseInt(os.Getenv(q.env), 10, 64); err == nil && n > 0 {
+			defaults[name] = n
+		}
+	}
+	return defaults
+}
+
+// enforceQuota fails tx with a *QuotaError if the tenant of ctx, or the
+// user given for quotas of each user, uses more of quota name than its
+// limit. Callers make their change in tx first so that it is counted; the
+// quota's lock, held for the rest of tx, makes concurrent changes count
+// each other.
+func (s *service) enforceQuota(ctx context.Context, tx pgx.Tx, name string, userID ...string) error {
+	tenantID := tenant.FromContext(ctx)
+	limit, _, err := s.quotaLimit(ctx, tx, tenantID, name)
+	if err != nil || limit == 0 {
+		return err
+	}
+	args := []any{tenantID}
+	key := tenantID + "/" + name
+	if quotas[name].perUser {
+		args = append(args, userID[0])
+		key += "/" + userID[0]
+	}
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2))`, quotaLockSpace, key); err != nil {
+		return err
+	}
+	var used int64
+	if err := tx.QueryRow(ctx, quotas[name].usage, args...).Scan(&used); err != nil {
+		return err
+	}
+	if used > limit {
+		return &QuotaError{Quota: name, Limit: limit}
+	}
+	return nil
+}
+
+// quotaLimit returns the limit of quota name for tenantID, the tenant's
+// override or the default, and when the override was set.
+func (s *service) quotaLimit(ctx context.Context, db conn, tenantID, name string) (int64, *time.Time, error) {
+	var limit int64
+	var updated time.Time
+	err := db.QueryRow(ctx, `SELECT quota, updated_at FROM tenant_quotas WHERE tenant_id = $1 AND name = $2`, tenantID, name).Scan(&limit, &updated)
+	if err == sql.ErrNoRows {
+		return s.quotaDefaults[name], nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return limit, &updated, nil
+}
+
+// ListQuotas returns every quota as it applies to the tenant of ctx, with
+// what the tenant uses of those that are not per user.
+func (s *service) ListQuotas(ctx context.Context) ([]models.Quota, error) {
+	tenantID := tenant.FromContext(ctx)
+	list := make([]models.Quota, 0, len(quotas))
+	for _, name := range quotaNames() {
+		q := models.Quota{TenantID: tenantID, Name: name}
+		var err error
+		if q.Limit, q.UpdatedAt, err = s.quotaLimit(ctx, s.db, tenantID, name); err != nil {
+			return nil, err
+		}
+		q.Overridden = q.UpdatedAt != nil
+		if !quotas[name].perUser {
+			var used int64
+			if err := s.db.QueryRow(ctx, quotas[name].usage, tenantID).Scan(&used); err != nil {
+				return nil, err
+			}
+			q.Used = &used
+		}
+		list = append(list, q)
+	}
+	return list, nil
+}
+
+// SetQuota overrides the limit of quota name for the tenant of ctx; 0 lifts
+// the quota. Lowering a limit below the current usage removes nothing but
+// fails further changes until usage is back under it.
+func (s *service) SetQuota(ctx context.Context, name string, limit int64) (*models.Quota, error) {
+	if _, ok := quotas[name]; !ok {
+		return nil, fmt.Errorf("%w %q, want %s", ErrUnknownQuota, name, strings.Join(quotaNames(), ", "))
+	}
+	if limit < 0 {
+		return nil, fmt.Errorf("quota %s must not be negative", name)
+	}
+	q := models.Quota{TenantID: tenant.FromContext(ctx), Name: name, Limit: limit, Overridden: true}
+	var updated time.Time
+	err := s.db.QueryRow(ctx, `
+        INSERT INTO tenant_quotas (tenant_id, name, quota)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (tenant_id, name) DO UPDATE
+        SET quota = EXCLUDED.quota, updated_at = now()
+        RETURNING updated_at
+    `, q.TenantID, name, limit).Scan(&updated)
+	if err != nil {
+		return nil, err
+	}
+	q.UpdatedAt = &updated
+	return &q, nil
+}
+
+// DeleteQuota removes the tenant's override of quota name, so the default
+// applies again. It returns sql.ErrNoRows if there is none.
+func (s *service) DeleteQuota(ctx context.Context, name string) error {
+	res, err := s.db.Exec(ctx, `DELETE FROM tenant_quotas WHERE tenant_id = $1 AND name = $2`, tenant.FromContext(ctx), name)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func quotaNames() []string {
+	names := make([]string, 0, len(quotas))
+	for name := range quotas {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
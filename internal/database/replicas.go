@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// replicaCheckInterval is how often replicas are pinged to find out whether
+// they can take reads.
+const replicaCheckInterval = 5 * time.Second
+
+type replica struct {
+	db      *pool
+	dsn     string
+	healthy atomic.Bool
+}
+
+// replicaSet spreads reads over healthy replicas round robin.
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+	stop     chan struct{}
+	logger   *log.Logger
+}
+
+// replicaDSNs reads DB_REPLICA_DSNS, a comma separated list of connection
+// strings. DB_REPLICA_HOSTS is a shorthand for replicas that share the
+// primary's database, credentials and connection parameters.
+func replicaDSNs() ([]string, error) {
+	var dsns []string
+	for _, dsn := range strings.Split(os.Getenv("DB_REPLICA_DSNS"), ",") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			dsns = append(dsns, dsn)
+		}
+	}
+	for _, h := range strings.Split(os.Getenv("DB_REPLICA_HOSTS"), ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			dsn, err := replicaDSN(h)
+			if err != nil {
+				return nil, err
+			}
+			dsns = append(dsns, dsn)
+		}
+	}
+	return dsns, nil
+}
+
+func newReplicaSet(dsns []string, opts poolOptions, logger *log.Logger) (*replicaSet, error) {
+	set := &replicaSet{stop: make(chan struct{}), logger: logger}
+	for _, dsn := range dsns {
+		db, err := newPool(context.Background(), dsn, opts)
+		if err != nil {
+			set.close()
+			return nil, err
+		}
+		r := &replica{db: db, dsn: dsn}
+		r.healthy.Store(true)
+		set.replicas = append(set.replicas, r)
+	}
+	go set.monitor()
+	return set, nil
+}
+
+// pick returns the next healthy replica, or nil when none is.
+func (rs *replicaSet) pick() *replica {
+	if rs == nil {
+		return nil
+	}
+	n := len(rs.replicas)
+	start := rs.next.Add(1)
+	for i := 0; i < n; i++ {
+		r := rs.replicas[(int(start)+i)%n]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+func (rs *replicaSet) healthyCount() int {
+	n := 0
+	for _, r := range rs.replicas {
+		if r.healthy.Load() {
+			n++
+		}
+	}
+	return n
+}
+
+func (rs *replicaSet) monitor() {
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rs.stop:
+			return
+		case <-ticker.C:
+			for _, r := range rs.replicas {
+				rs.check(r)
+			}
+		}
+	}
+}
+
+func (rs *replicaSet) check(r *replica) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := r.db.Ping(ctx)
+	if healthy := err == nil; r.healthy.Swap(healthy) != healthy {
+		if healthy {
+			rs.logger.Printf("Database replica %s is back", redactDSN(r.dsn))
+		} else {
+			rs.logger.Printf("Database replica %s is down: %v", redactDSN(r.dsn), err)
+		}
+	}
+}
+
+func (rs *replicaSet) close() {
+	if rs == nil {
+		return
+	}
+	close(rs.stop)
+	for _, r := range rs.replicas {
+		r.db.Close()
+	}
+}
+
+// read runs fn on a healthy replica. It falls back to the primary when no
+// replica is healthy or the replica could not be reached, taking that
+// replica out of rotation until the next successful health check.
+// Transient failures are retried according to the retry policy.
+func (s *service) read(ctx context.Context, op string, fn func(db conn) error) error {
+	return s.retry(ctx, op, isTransient, func() error {
+		return s.readOnce(ctx, fn)
+	})
+}
+
+func (s *service) readOnce(ctx context.Context, fn func(db conn) error) error {
+	// A dry run reads its own changes
+	r := s.replicas.pick()
+	if r == nil || dryRunTx(ctx) != nil {
+		return fn(s.db)
+	}
+	err := fn(r.db)
+	if err == nil || err == sql.ErrNoRows || ctx.Err() != nil {
+		return err
+	}
+	// Errors reported by the server itself are the query's fault
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return err
+	}
+	if r.healthy.Swap(false) {
+		s.logger.Printf("Database replica %s failed, reading from primary: %v", redactDSN(r.dsn), err)
+	}
+	return fn(s.db)
+}
+
+// redactDSN hides the password of a connection string for logging.
+func redactDSN(dsn string) string {
+	cfg, err := pgconn.ParseConfig(dsn)
+	if err != nil {
+		return "replica"
+	}
+	return cfg.Host
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	retriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "users_db_retries_total",
+		Help: "Database operations retried after a transient error.",
+	}, []string{"operation"})
+	retriesExhaustedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "users_db_retries_exhausted_total",
+		Help: "Database operations that still failed with a transient error after the last attempt.",
+	}, []string{"operation"})
+)
+
+// RetryPolicy decides how often and how patiently operations that hit a
+// transient error are retried.
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt; 1 disables retries.
+	MaxAttempts int
+	// BaseDelay is the backoff cap of the first retry. It doubles on every
+	// attempt up to MaxDelay and the actual delay is drawn uniformly below
+	// the cap.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// retryPolicyFromEnv reads DB_RETRY_MAX_ATTEMPTS, DB_RETRY_BASE_DELAY and
+// DB_RETRY_MAX_DELAY on top of the defaults.
+func retryPolicyFromEnv() RetryPolicy {
+	p := RetryPolicy{MaxAttempts: 3, BaseDelay: 50 * time.Millisecond, MaxDelay: time.Second}
+	if n, err := strconv.Atoi(os.Getenv("DB_RETRY_MAX_ATTEMPTS")); err == nil && n > 0 {
+		p.MaxAttempts = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("DB_RETRY_BASE_DELAY")); err == nil && d > 0 {
+		p.BaseDelay = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("DB_RETRY_MAX_DELAY")); err == nil && d > 0 {
+		p.MaxDelay = d
+	}
+	return p
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.BaseDelay << (attempt - 1)
+	if ceiling > p.MaxDelay || ceiling <= 0 {
+		ceiling = p.MaxDelay
+	}
+	return rand.N(ceiling) + 1
+}
+
+// isTransient reports whether err is likely to go away on its own, such as
+// a serialization failure or a connection dropped during a failover.
+func isTransient(err error) bool {
+	return isRollbackRetryable(err) || isConnectionError(err) || pgconn.SafeToRetry(err)
+}
+
+// isRollbackRetryable reports whether err aborted a transaction in a way
+// that guarantees nothing was committed.
+func isRollbackRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == "40001" || pgErr.Code == "40P01")
+}
+
+// retry runs fn until it succeeds, fails with an error retryable reports
+// false for, the policy runs out of attempts or ctx is done. Rejected
+// credentials from a secret store are refetched and retried as well. fn must be safe
+// to run more than once.
+func (s *service) retry(ctx context.Context, op string, retryable func(error) bool, fn func() error) error {
+	attempts := max(s.retryPolicy.MaxAttempts, 1)
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || ctx.Err() != nil {
+			return err
+		}
+		if !retryable(err) && !s.refreshCredentials(err) {
+			return err
+		}
+		if attempt == attempts {
+			retriesExhaustedTotal.WithLabelValues(op).Inc()
+			return err
+		}
+		retriesTotal.WithLabelValues(op).Inc()
+
+		timer := time.NewTimer(s.retryPolicy.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"users/internal/models"
+)
+
+// prefixQuery turns free text into a tsquery where every word is matched as
+// a prefix, so "jo smi" matches "John Smith". It returns "" when the input
+// holds no searchable characters.
+func prefixQuery(text string) string {
+	var terms []string
+	for _, word := range strings.Fields(text) {
+		// Drop everything tsquery would interpret as an operator
+		word = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '@' || r == '.' || r == '_' || r == '-' {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, word)
+		word = strings.Trim(word, ".-")
+		if word != "" {
+			terms = append(terms, word+":*")
+		}
+	}
+	return strings.Join(terms, " & ")
+}
+
+// SearchUsers returns users matching filter whose names or email match
+// every word of text as a prefix, best matches first.
+func (s *service) SearchUsers(ctx context.Context, text string, filter UserFilter, page Page) ([]models.User, error) {
+	tsquery := prefixQuery(text)
+	if tsquery == "" {
+		return []models.User{}, nil
+	}
+	page = page.Normalize()
+
+	args := []any{tsquery}
+	where, args := filter.where(ctx, s.piiKeys, args)
+	args = append(args, page.Limit, page.Offset)
+	query := fmt.Sprintf(`
+        SELECT %s FROM %s%s AND search_vector @@ to_tsquery('simple', $1)
+        ORDER BY ts_rank(search_vector, to_tsquery('simple', $1)) DESC, id
+        LIMIT $%d OFFSET $%d
+    `, selectList("", defaultUserFields), s.userSource(), where, len(args)-1, len(args))
+	var users []models.User
+	err := s.read(ctx, "SearchUsers", func(db conn) (err error) {
+		users, err = s.queryUsers(ctx, db, query, args...)
+		return err
+	})
+	return users, err
+}
+
+// CountSearchUsers returns the number of users SearchUsers finds for text
+// and filter across all pages.
+func (s *service) CountSearchUsers(ctx context.Context, text string, filter UserFilter) (int64, error) {
+	tsquery := prefixQuery(text)
+	if tsquery == "" {
+		return 0, nil
+	}
+	where, args := filter.where(ctx, s.piiKeys, []any{tsquery})
+	var count int64
+	err := s.read(ctx, "CountSearchUsers", func(db conn) error {
+		return db.QueryRow(ctx, `SELECT count(*) FROM `+s.userSource()+where+` AND search_vector @@ to_tsquery('simple', $1)`, args...).Scan(&count)
+	})
+	return count, err
+}
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+	"users/internal/validator"
+)
+
+// ErrNotRestorable is returned when restoring a snapshot of a user that
+// was anonymized or merged since, which must not be undone.
+var ErrNotRestorable = errors.New("anonymized or merged users cannot be restored")
+
+// SnapshotUser reads the user with its metadata and the preferences in a
+// read-only repeatable read transaction, so the snapshot sees the rows as
+// they were at one moment even while the user is being changed.
+func (s *service) SnapshotUser(ctx context.Context, id string) (*models.UserSnapshot, error) {
+	var user models.User
+	columns, dest, err := s.userColumns(&user, models.UserFields)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var raw []byte
+	err = tx.QueryRow(ctx, fmt.Sprintf(`SELECT %s, metadata FROM users WHERE id = $1 AND tenant_id = $2`, selectList("", columns)),
+		id, tenant.FromContext(ctx)).Scan(append(dest, &raw)...)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := decodeMetadata(raw)
+	if err != nil {
+		return nil, err
+	}
+	prefs, err := scanPreferences(tx.QueryRow(ctx, getPreferencesQuery, getPreferencesArgs(ctx, id)...))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &models.UserSnapshot{
+		TakenAt:     s.now().UTC(),
+		User:        &user,
+		Metadata:    metadata,
+		Preferences: prefs,
+	}, nil
+}
+
+// RestoreUserSnapshot overwrites the profile, metadata and preferences of
+// the snapshot's user with those of the snapshot and returns the restored
+// user. It returns ErrVersionConflict unless the user is at version, the
+// one the caller reviewed before deciding to overwrite it. Status,
+// credentials and group memberships are not part of snapshots and stay as
+// they are; a pending email change is cancelled. The restore is audited in
+// the same transaction.
+func (s *service) RestoreUserSnapshot(ctx context.Context, snapshot *models.UserSnapshot, version int) (*models.User, error) {
+	snap := snapshot.User
+	tenantID := tenant.FromContext(ctx)
+	tags := normalizeTags(snap.Tags)
+	if len(tags) > MaxUserTags {
+		return nil, ErrTooManyTags
+	}
+	doc, err := json.Marshal(snapshot.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	email, ciphertext, err := sealEmail(s.piiKeys, normalizeEmail(ctx, snap.Email))
+	if err != nil {
+		return nil, err
+	}
+
+	var user *models.User
+	err = s.inTx(ctx, func(tx pgx.Tx) error {
+		if err := lockUsers(ctx, tx, snap.ID); err != nil {
+			return err
+		}
+		var current int
+		var restorable bool
+		err := tx.QueryRow(ctx, `
+            SELECT version, anonymized_at IS NULL AND merged_into IS NULL
+            FROM users WHERE id = $1 AND tenant_id = $2 FOR UPDATE
+        `, snap.ID, tenantID).Scan(&current, &restorable)
+		if err != nil {
+			return err
+		}
+		if !restorable {
+			return ErrNotRestorable
+		}
+		if current != version {
+			return ErrVersionConflict
+		}
+
+		query := `
+            UPDATE users
+            SET first_name = $3,
+                last_name = $4,
+                username = NULLIF($5, ''),
+                email = $6,
+                email_ciphertext = $7,
+                pending_email = NULL,
+                pending_email_ciphertext = NULL,
+                email_token_hash = NULL,
+                email_token_expires_at = NULL,
+                birthdate = $8::date,
+                age = COALESCE(date_part('year', age($8::date)), $9),
+                locale = NULLIF($10, ''),
+                timezone = NULLIF($11, ''),
+                tags = $12,
+                metadata = $13,
+                version = version + 1,
+                updated_at = now()
+            WHERE id = $1 AND tenant_id = $2
+            RETURNING ` + selectList("", defaultUserFields)
+		user, err = s.scanUser(tx.QueryRow(ctx, query, snap.ID, tenantID,
+			validator.NormalizeName(snap.FirstName), validator.NormalizeName(snap.LastName), snap.Username,
+			email, ciphertext, nullIfEmpty(snap.Birthdate), int64(snap.Age), snap.Locale, snap.Timezone,
+			tags, doc))
+		if err != nil {
+			return mapConstraintError(err)
+		}
+
+		if err := restorePreferences(ctx, tx, snap.ID, snapshot.Preferences); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, &models.AuditEntry{
+			Action:       models.AuditUserRestored,
+			TargetUserID: snap.ID,
+			Details:      map[string]any{"taken_at": snapshot.TakenAt, "snapshot_version": snap.Version, "version": version},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// restorePreferences stores prefs as the user's preferences. Users whose
+// snapshot still had the defaults go back to having none stored.
+func restorePreferences(ctx context.Context, tx pgx.Tx, userID string, prefs *models.Preferences) error {
+	if prefs == nil || prefs.UpdatedAt == nil {
+		_, err := tx.Exec(ctx, `DELETE FROM user_preferences WHERE user_id = $1`, userID)
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+        INSERT INTO user_preferences (user_id, tenant_id, email_notifications, security_alerts, newsletter, theme)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (user_id) DO UPDATE
+        SET email_notifications = EXCLUDED.email_notifications,
+            security_alerts = EXCLUDED.security_alerts,
+            newsletter = EXCLUDED.newsletter,
+            theme = EXCLUDED.theme,
+            updated_at = now()
+    `, userID, tenant.FromContext(ctx), prefs.EmailNotifications, prefs.SecurityAlerts, prefs.Newsletter, prefs.Theme)
+	return err
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// CountUsers returns the number of users matching filter.
+func (s *service) CountUsers(ctx context.Context, filter UserFilter) (int64, error) {
+	where, args := filter.where(ctx, s.piiKeys, nil)
+
+	var count int64
+	err := s.retry(ctx, "CountUsers", isTransient, func() error {
+		return s.db.QueryRow(ctx, `SELECT count(*) FROM `+s.userSource()+where, args...).Scan(&count)
+	})
+	return count, err
+}
+
+// UserStats returns the total user count, signups per day over the last
+// days days (including days without signups) and the age distribution.
+func (s *service) UserStats(ctx context.Context, days int) (*models.UserStats, error) {
+	tenantID := tenant.FromContext(ctx)
+	stats := &models.UserStats{
+		SignupsPerDay:   []models.DailyCount{},
+		AgeDistribution: []models.AgeBucket{},
+	}
+
+	var err error
+	if stats.Total, err = s.CountUsers(ctx, UserFilter{}); err != nil {
+		return nil, err
+	}
+
+	query := `
+        SELECT d.day, count(u.id)
+        FROM generate_series(current_date - ($2::int - 1), current_date, interval '1 day') AS d(day)
+        LEFT JOIN users u ON u.tenant_id = $1 AND u.created >= d.day AND u.created < d.day + interval '1 day'
+        GROUP BY d.day
+        ORDER BY d.day
+    `
+	rows, err := s.db.Query(ctx, query, tenantID, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c models.DailyCount
+		if err := rows.Scan(&c.Day, &c.Count); err != nil {
+			return nil, err
+		}
+		stats.SignupsPerDay = append(stats.SignupsPerDay, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+        SELECT CASE
+                   WHEN age < 18 THEN '0-17'
+                   WHEN age < 25 THEN '18-24'
+                   WHEN age < 35 THEN '25-34'
+                   WHEN age < 45 THEN '35-44'
+                   WHEN age < 55 THEN '45-54'
+                   WHEN age < 65 THEN '55-64'
+                   ELSE '65+'
+               END AS bucket,
+               count(*)
+        FROM (
+            SELECT COALESCE(date_part('year', age(birthdate))::int, age) AS age
+            FROM users
+            WHERE tenant_id = $1
+        ) u
+        GROUP BY bucket
+        ORDER BY min(age)
+    `
+	rows, err = s.db.Query(ctx, query, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("age distribution: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var b models.AgeBucket
+		if err := rows.Scan(&b.Range, &b.Count); err != nil {
+			return nil, err
+		}
+		stats.AgeDistribution = append(stats.AgeDistribution, b)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/flags"
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// ErrInvalidTransition is returned when a user's status cannot move to the
+// requested one, e.g. activating an already active user.
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// SuspendUser blocks the user until they are activated again.
+func (s *service) SuspendUser(ctx context.Context, id string) (*models.User, error) {
+	return s.transitionUser(ctx, id, models.StatusSuspended, models.AuditUserSuspended)
+}
+
+// ActivateUser activates a pending user or lifts a suspension.
+func (s *service) ActivateUser(ctx context.Context, id string) (*models.User, error) {
+	return s.transitionUser(ctx, id, models.StatusActive, models.AuditUserActivated)
+}
+
+// newUserStatus is the status of users created without one: pending while
+// the tenant requires email verification, active otherwise.
+func newUserStatus(ctx context.Context) models.UserStatus {
+	if flags.Enabled(ctx, flags.EmailVerificationRequired) {
+		return models.StatusPending
+	}
+	return models.StatusActive
+}
+
+func (s *service) transitionUser(ctx context.Context, id string, next models.UserStatus, action string) (*models.User, error) {
+	var user *models.User
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		tenantID := tenant.FromContext(ctx)
+
+		var current models.UserStatus
+		err := tx.QueryRow(ctx, `SELECT status FROM users WHERE id = $1 AND tenant_id = $2 FOR UPDATE`, id, tenantID).Scan(&current)
+		if err != nil {
+			return err
+		}
+		if !current.CanTransitionTo(next) {
+			return ErrInvalidTransition
+		}
+
+		query := `
+            UPDATE users SET status = $3, version = version + 1, updated_at = now()
+            WHERE id = $1 AND tenant_id = $2
+            RETURNING ` + selectList("", defaultUserFields)
+		if user, err = s.scanUser(tx.QueryRow(ctx, query, id, tenantID, next)); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, &models.AuditEntry{
+			Action:       action,
+			TargetUserID: id,
+			Details:      map[string]any{"from": current, "to": next},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
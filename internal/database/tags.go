@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// MaxUserTags is the number of tags a user can carry.
+const MaxUserTags = 50
+
+// ErrTooManyTags is returned when tagging would give a user more than
+// MaxUserTags tags.
+var ErrTooManyTags = errors.New("user has too many tags")
+
+// AddUserTags adds tags to the user, ignoring those already set, and
+// returns the updated user.
+func (s *service) AddUserTags(ctx context.Context, id string, tags []string) (*models.User, error) {
+	return s.retag(ctx, id, func(current []string) []string {
+		return append(current, tags...)
+	})
+}
+
+// RemoveUserTags removes tags from the user and returns the updated user.
+// Tags the user does not carry are ignored.
+func (s *service) RemoveUserTags(ctx context.Context, id string, tags []string) (*models.User, error) {
+	return s.retag(ctx, id, func(current []string) []string {
+		return slices.DeleteFunc(current, func(t string) bool {
+			return slices.Contains(tags, t)
+		})
+	})
+}
+
+// retag replaces the user's tags with the normalized result of change.
+func (s *service) retag(ctx context.Context, id string, change func(current []string) []string) (*models.User, error) {
+	var user *models.User
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		tenantID := tenant.FromContext(ctx)
+
+		var current []string
+		err := tx.QueryRow(ctx, `SELECT tags FROM users WHERE id = $1 AND tenant_id = $2 FOR UPDATE`, id, tenantID).Scan(&current)
+		if err != nil {
+			return err
+		}
+		tags := normalizeTags(change(current))
+		if len(tags) > MaxUserTags && len(tags) > len(current) {
+			return ErrTooManyTags
+		}
+		query := `
+            UPDATE users SET tags = $3, version = version + 1, updated_at = now()
+            WHERE id = $1 AND tenant_id = $2
+            RETURNING ` + selectList("", defaultUserFields)
+		user, err = s.scanUser(tx.QueryRow(ctx, query, id, tenantID, tags))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// normalizeTags lower-cases, sorts and deduplicates tags.
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, t := range tags {
+		normalized = append(normalized, strings.ToLower(t))
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+const templateFields = `name, locale, subject, text_body, html_body, updated_at`
+
+func scanTemplate(row interface{ Scan(...any) error }) (*models.NotificationTemplate, error) {
+	var t models.NotificationTemplate
+	if err := row.Scan(&t.Name, &t.Locale, &t.Subject, &t.Text, &t.HTML, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetNotificationTemplate returns the tenant's template called name for
+// the earliest of locales it has stored, or sql.ErrNoRows if it has none
+// of them.
+func (s *service) GetNotificationTemplate(ctx context.Context, name string, locales []string) (*models.NotificationTemplate, error) {
+	query := `SELECT ` + templateFields + ` FROM notification_templates
+        WHERE tenant_id = $1 AND name = $2 AND locale = ANY($3)
+        ORDER BY array_position($3, locale)
+        LIMIT 1`
+	var t *models.NotificationTemplate
+	err := s.read(ctx, "GetNotificationTemplate", func(db conn) (err error) {
+		t, err = scanTemplate(db.QueryRow(ctx, query, tenant.FromContext(ctx), name, locales))
+		return err
+	})
+	return t, err
+}
+
+// ListNotificationTemplates returns every template the tenant has stored.
+func (s *service) ListNotificationTemplates(ctx context.Context) ([]models.NotificationTemplate, error) {
+	var templates []models.NotificationTemplate
+	err := s.read(ctx, "ListNotificationTemplates", func(db conn) error {
+		rows, err := db.Query(ctx, `SELECT `+templateFields+` FROM notification_templates
+            WHERE tenant_id = $1 ORDER BY name, locale`, tenant.FromContext(ctx))
+		if err != nil {
+			return err
+		}
+		templates, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.NotificationTemplate, error) {
+			t, err := scanTemplate(row)
+			if err != nil {
+				return models.NotificationTemplate{}, err
+			}
+			return *t, nil
+		})
+		return err
+	})
+	if templates == nil {
+		templates = []models.NotificationTemplate{}
+	}
+	return templates, err
+}
+
+// PutNotificationTemplate stores tmpl for the tenant of ctx, replacing any
+// template with the same name and locale, and fills in UpdatedAt.
+func (s *service) PutNotificationTemplate(ctx context.Context, tmpl *models.NotificationTemplate) error {
+	return s.db.QueryRow(ctx, `
+        INSERT INTO notification_templates (tenant_id, name, locale, subject, text_body, html_body)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (tenant_id, name, locale) DO UPDATE
+        SET subject = EXCLUDED.subject,
+            text_body = EXCLUDED.text_body,
+            html_body = EXCLUDED.html_body,
+            updated_at = now()
+        RETURNING updated_at
+    `, tenant.FromContext(ctx), tmpl.Name, tmpl.Locale, tmpl.Subject, tmpl.Text, tmpl.HTML).Scan(&tmpl.UpdatedAt)
+}
+
+// DeleteNotificationTemplate removes a stored template, so the built-in
+// one applies again. It returns sql.ErrNoRows if there is none.
+func (s *service) DeleteNotificationTemplate(ctx context.Context, name, locale string) error {
+	res, err := s.db.Exec(ctx, `DELETE FROM notification_templates WHERE tenant_id = $1 AND name = $2 AND locale = $3`,
+		tenant.FromContext(ctx), name, locale)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,944 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"users/internal/models"
+)
+
+// defaultQueryTimeout bounds every operation that has no timeout of its own.
+const defaultQueryTimeout = 5 * time.Second
+
+// timeoutService gives every operation of the wrapped service a deadline so
+// a slow query cannot hold a pool connection indefinitely.
+type timeoutService struct {
+	next Service
+
+	defaultTimeout time.Duration
+	timeouts       map[string]time.Duration
+}
+
+// withTimeouts wraps next with deadlines read from DB_QUERY_TIMEOUT and
+// DB_OPERATION_TIMEOUTS, a comma separated list of Operation=duration pairs
+// such as "ExportUserData=30s,Migrate=0". A zero duration disables the
+// deadline for that operation.
+func withTimeouts(next Service) (*timeoutService, error) {
+	t := &timeoutService{
+		next:           next,
+		defaultTimeout: defaultQueryTimeout,
+		// Migrations and partitioning may rewrite large tables, purges and
+		// encryption batches touch many rows; feed consumers call out to
+		// other systems within the operation
+		timeouts: map[string]time.Duration{
+			"Migrate":                0,
+			"PartitionUsers":         0,
+			"MaintainUserPartitions": 10 * time.Minute,
+			"RefreshGrowthStats":     10 * time.Minute,
+			"EncryptUserPII":         time.Minute,
+			"CanonicalizeEmails":     time.Minute,
+			"SyncUserFeed":           time.Minute,
+			"PurgeAnonymizedUsers":   time.Minute,
+			"PurgeExpiredTokens":     time.Minute,
+			"PurgeDeadJobs":          time.Minute,
+			"TrimAuditLog":           time.Minute,
+			"TrimTombstones":         time.Minute,
+			// The operations of a dry run have deadlines of their own,
+			// export jobs that of their lease; audit exports stream for
+			// as long as their client reads
+			"EachUser":       0,
+			"EachAuditEntry": 0,
+			"DryRun":         0,
+		},
+	}
+	if v := os.Getenv("DB_QUERY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid DB_QUERY_TIMEOUT %q", v)
+		}
+		t.defaultTimeout = d
+	}
+	for _, pair := range strings.Split(os.Getenv("DB_OPERATION_TIMEOUTS"), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		op, v, ok := strings.Cut(pair, "=")
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if !ok || err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid DB_OPERATION_TIMEOUTS entry %q", pair)
+		}
+		t.timeouts[strings.TrimSpace(op)] = d
+	}
+	return t, nil
+}
+
+// statementTimeout returns the server side statement_timeout in
+// milliseconds from DB_STATEMENT_TIMEOUT, defaulting to 30s. It backs up
+// the context deadlines for queries whose client went away.
+func statementTimeout() (int64, error) {
+	v := os.Getenv("DB_STATEMENT_TIMEOUT")
+	if v == "" {
+		return (30 * time.Second).Milliseconds(), nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid DB_STATEMENT_TIMEOUT %q", v)
+	}
+	return d.Milliseconds(), nil
+}
+
+// withStatementTimeout adds the statement_timeout runtime parameter to a
+// connection string unless it already sets one.
+func withStatementTimeout(dsn string, ms int64) string {
+	if ms == 0 || strings.Contains(dsn, "statement_timeout=") {
+		return dsn
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%sstatement_timeout=%d", dsn, sep, ms)
+}
+
+func (t *timeoutService) context(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	d, ok := t.timeouts[op]
+	if !ok {
+		d = t.defaultTimeout
+	}
+	if d == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+func (t *timeoutService) Health() HealthReport {
+	return t.next.Health()
+}
+
+func (t *timeoutService) Close() error {
+	return t.next.Close()
+}
+
+// ListenUserChanges runs until ctx is done, so it gets no timeout.
+func (t *timeoutService) ListenUserChanges(ctx context.Context, fn func(UserChangeNotification)) error {
+	return t.next.ListenUserChanges(ctx, fn)
+}
+
+func (t *timeoutService) Migrate(ctx context.Context) error {
+	ctx, cancel := t.context(ctx, "Migrate")
+	defer cancel()
+	return t.next.Migrate(ctx)
+}
+
+func (t *timeoutService) MigrationVersion(ctx context.Context) (uint, bool, error) {
+	ctx, cancel := t.context(ctx, "MigrationVersion")
+	defer cancel()
+	return t.next.MigrationVersion(ctx)
+}
+
+func (t *timeoutService) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	ctx, cancel := t.context(ctx, "CreateUser")
+	defer cancel()
+	return t.next.CreateUser(ctx, user)
+}
+
+func (t *timeoutService) GetUserByID(ctx context.Context, id string, fields ...string) (*models.User, error) {
+	ctx, cancel := t.context(ctx, "GetUserByID")
+	defer cancel()
+	return t.next.GetUserByID(ctx, id, fields...)
+}
+
+func (t *timeoutService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, cancel := t.context(ctx, "GetUserByEmail")
+	defer cancel()
+	return t.next.GetUserByEmail(ctx, email)
+}
+
+func (t *timeoutService) GetUserByUsername(ctx context.Context, name string) (*models.User, error) {
+	ctx, cancel := t.context(ctx, "GetUserByUsername")
+	defer cancel()
+	return t.next.GetUserByUsername(ctx, name)
+}
+
+func (t *timeoutService) CheckUsernameAvailable(ctx context.Context, name string) (bool, error) {
+	ctx, cancel := t.context(ctx, "CheckUsernameAvailable")
+	defer cancel()
+	return t.next.CheckUsernameAvailable(ctx, name)
+}
+
+func (t *timeoutService) UpdateUserByID(ctx context.Context, id string, updates models.UserUpdate) (*models.User, error) {
+	ctx, cancel := t.context(ctx, "UpdateUserByID")
+	defer cancel()
+	return t.next.UpdateUserByID(ctx, id, updates)
+}
+
+func (t *timeoutService) IssueEmailConfirmation(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	ctx, cancel := t.context(ctx, "IssueEmailConfirmation")
+	defer cancel()
+	return t.next.IssueEmailConfirmation(ctx, userID, tokenHash, expiresAt)
+}
+
+func (t *timeoutService) ConfirmEmailChange(ctx context.Context, tokenHash string) (*models.User, error) {
+	ctx, cancel := t.context(ctx, "ConfirmEmailChange")
+	defer cancel()
+	return t.next.ConfirmEmailChange(ctx, tokenHash)
+}
+
+func (t *timeoutService) DeleteUserByID(ctx context.Context, id string) (*models.User, error) {
+	ctx, cancel := t.context(ctx, "DeleteUserByID")
+	defer cancel()
+	return t.next.DeleteUserByID(ctx, id)
+}
+
+func (t *timeoutService) GetUserByIdentity(ctx context.Context, provider, subject string) (*models.User, error) {
+	ctx, cancel := t.context(ctx, "GetUserByIdentity")
+	defer cancel()
+	return t.next.GetUserByIdentity(ctx, provider, subject)
+}
+
+func (t *timeoutService) LinkIdentity(ctx context.Context, identity *models.Identity) error {
+	ctx, cancel := t.context(ctx, "LinkIdentity")
+	defer cancel()
+	return t.next.LinkIdentity(ctx, identity)
+}
+
+func (t *timeoutService) UnlinkIdentity(ctx context.Context, userID, provider string) error {
+	ctx, cancel := t.context(ctx, "UnlinkIdentity")
+	defer cancel()
+	return t.next.UnlinkIdentity(ctx, userID, provider)
+}
+
+func (t *timeoutService) ListIdentities(ctx context.Context, userID string) ([]models.Identity, error) {
+	ctx, cancel := t.context(ctx, "ListIdentities")
+	defer cancel()
+	return t.next.ListIdentities(ctx, userID)
+}
+
+func (t *timeoutService) GetPasswordHash(ctx context.Context, userID string) (string, error) {
+	ctx, cancel := t.context(ctx, "GetPasswordHash")
+	defer cancel()
+	return t.next.GetPasswordHash(ctx, userID)
+}
+
+func (t *timeoutService) SetPasswordHash(ctx context.Context, userID, hash string) error {
+	ctx, cancel := t.context(ctx, "SetPasswordHash")
+	defer cancel()
+	return t.next.SetPasswordHash(ctx, userID, hash)
+}
+
+func (t *timeoutService) GetLockedUntil(ctx context.Context, userID string) (*time.Time, error) {
+	ctx, cancel := t.context(ctx, "GetLockedUntil")
+	defer cancel()
+	return t.next.GetLockedUntil(ctx, userID)
+}
+
+func (t *timeoutService) RecordFailedLogin(ctx context.Context, userID string, policy LockoutPolicy) (*time.Time, error) {
+	ctx, cancel := t.context(ctx, "RecordFailedLogin")
+	defer cancel()
+	return t.next.RecordFailedLogin(ctx, userID, policy)
+}
+
+func (t *timeoutService) ResetFailedLogins(ctx context.Context, userID string) error {
+	ctx, cancel := t.context(ctx, "ResetFailedLogins")
+	defer cancel()
+	return t.next.ResetFailedLogins(ctx, userID)
+}
+
+func (t *timeoutService) UnlockUser(ctx context.Context, userID string) error {
+	ctx, cancel := t.context(ctx, "UnlockUser")
+	defer cancel()
+	return t.next.UnlockUser(ctx, userID)
+}
+
+func (t *timeoutService) SuspendUser(ctx context.Context, id string) (*models.User, error) {
+	ctx, cancel := t.context(ctx, "SuspendUser")
+	defer cancel()
+	return t.next.SuspendUser(ctx, id)
+}
+
+func (t *timeoutService) ActivateUser(ctx context.Context, id string) (*models.User, error) {
+	ctx, cancel := t.context(ctx, "ActivateUser")
+	defer cancel()
+	return t.next.ActivateUser(ctx, id)
+}
+
+func (t *timeoutService) RecordLogin(ctx context.Context, userID string) error {
+	ctx, cancel := t.context(ctx, "RecordLogin")
+	defer cancel()
+	return t.next.RecordLogin(ctx, userID)
+}
+
+func (t *timeoutService) TouchLastSeen(ctx context.Context, seen []models.Activity) error {
+	ctx, cancel := t.context(ctx, "TouchLastSeen")
+	defer cancel()
+	return t.next.TouchLastSeen(ctx, seen)
+}
+
+func (t *timeoutService) AnonymizeUser(ctx context.Context, id string) (*models.User, error) {
+	ctx, cancel := t.context(ctx, "AnonymizeUser")
+	defer cancel()
+	return t.next.AnonymizeUser(ctx, id)
+}
+
+func (t *timeoutService) ExportUserData(ctx context.Context, id string) (*models.UserExport, error) {
+	ctx, cancel := t.context(ctx, "ExportUserData")
+	defer cancel()
+	return t.next.ExportUserData(ctx, id)
+}
+
+func (t *timeoutService) ListUsers(ctx context.Context, filter UserFilter, page Page) ([]models.User, error) {
+	ctx, cancel := t.context(ctx, "ListUsers")
+	defer cancel()
+	return t.next.ListUsers(ctx, filter, page)
+}
+
+func (t *timeoutService) GetUsersByIDs(ctx context.Context, ids []string) ([]models.User, error) {
+	ctx, cancel := t.context(ctx, "GetUsersByIDs")
+	defer cancel()
+	return t.next.GetUsersByIDs(ctx, ids)
+}
+
+func (t *timeoutService) SearchUsers(ctx context.Context, text string, filter UserFilter, page Page) ([]models.User, error) {
+	ctx, cancel := t.context(ctx, "SearchUsers")
+	defer cancel()
+	return t.next.SearchUsers(ctx, text, filter, page)
+}
+
+func (t *timeoutService) CountUsers(ctx context.Context, filter UserFilter) (int64, error) {
+	ctx, cancel := t.context(ctx, "CountUsers")
+	defer cancel()
+	return t.next.CountUsers(ctx, filter)
+}
+
+func (t *timeoutService) UserStats(ctx context.Context, days int) (*models.UserStats, error) {
+	ctx, cancel := t.context(ctx, "UserStats")
+	defer cancel()
+	return t.next.UserStats(ctx, days)
+}
+
+func (t *timeoutService) GetIdempotencyRecord(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+	ctx, cancel := t.context(ctx, "GetIdempotencyRecord")
+	defer cancel()
+	return t.next.GetIdempotencyRecord(ctx, key)
+}
+
+func (t *timeoutService) SaveIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	ctx, cancel := t.context(ctx, "SaveIdempotencyRecord")
+	defer cancel()
+	return t.next.SaveIdempotencyRecord(ctx, record)
+}
+
+func (t *timeoutService) RecordAudit(ctx context.Context, entry *models.AuditEntry) error {
+	ctx, cancel := t.context(ctx, "RecordAudit")
+	defer cancel()
+	return t.next.RecordAudit(ctx, entry)
+}
+
+func (t *timeoutService) ListAuditEntries(ctx context.Context, userID string) ([]models.AuditEntry, error) {
+	ctx, cancel := t.context(ctx, "ListAuditEntries")
+	defer cancel()
+	return t.next.ListAuditEntries(ctx, userID)
+}
+
+func (t *timeoutService) GetTOTP(ctx context.Context, userID string) (*models.TOTP, error) {
+	ctx, cancel := t.context(ctx, "GetTOTP")
+	defer cancel()
+	return t.next.GetTOTP(ctx, userID)
+}
+
+func (t *timeoutService) EnrollTOTP(ctx context.Context, userID, secret string) error {
+	ctx, cancel := t.context(ctx, "EnrollTOTP")
+	defer cancel()
+	return t.next.EnrollTOTP(ctx, userID, secret)
+}
+
+func (t *timeoutService) EnableTOTP(ctx context.Context, userID string, step int64, recoveryHashes []string) error {
+	ctx, cancel := t.context(ctx, "EnableTOTP")
+	defer cancel()
+	return t.next.EnableTOTP(ctx, userID, step, recoveryHashes)
+}
+
+func (t *timeoutService) DisableTOTP(ctx context.Context, userID string) error {
+	ctx, cancel := t.context(ctx, "DisableTOTP")
+	defer cancel()
+	return t.next.DisableTOTP(ctx, userID)
+}
+
+func (t *timeoutService) RegenerateRecoveryCodes(ctx context.Context, userID string, recoveryHashes []string) error {
+	ctx, cancel := t.context(ctx, "RegenerateRecoveryCodes")
+	defer cancel()
+	return t.next.RegenerateRecoveryCodes(ctx, userID, recoveryHashes)
+}
+
+func (t *timeoutService) RecordTOTPUse(ctx context.Context, userID string, step int64) (bool, error) {
+	ctx, cancel := t.context(ctx, "RecordTOTPUse")
+	defer cancel()
+	return t.next.RecordTOTPUse(ctx, userID, step)
+}
+
+func (t *timeoutService) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	ctx, cancel := t.context(ctx, "UseRecoveryCode")
+	defer cancel()
+	return t.next.UseRecoveryCode(ctx, userID, codeHash)
+}
+
+func (t *timeoutService) CreateAPIKey(ctx context.Context, key *models.APIKey, hash string) error {
+	ctx, cancel := t.context(ctx, "CreateAPIKey")
+	defer cancel()
+	return t.next.CreateAPIKey(ctx, key, hash)
+}
+
+func (t *timeoutService) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	ctx, cancel := t.context(ctx, "GetAPIKeyByHash")
+	defer cancel()
+	return t.next.GetAPIKeyByHash(ctx, hash)
+}
+
+func (t *timeoutService) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	ctx, cancel := t.context(ctx, "ListAPIKeys")
+	defer cancel()
+	return t.next.ListAPIKeys(ctx)
+}
+
+func (t *timeoutService) RevokeAPIKey(ctx context.Context, id string) error {
+	ctx, cancel := t.context(ctx, "RevokeAPIKey")
+	defer cancel()
+	return t.next.RevokeAPIKey(ctx, id)
+}
+
+func (t *timeoutService) TouchAPIKey(ctx context.Context, id string) error {
+	ctx, cancel := t.context(ctx, "TouchAPIKey")
+	defer cancel()
+	return t.next.TouchAPIKey(ctx, id)
+}
+
+func (t *timeoutService) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	ctx, cancel := t.context(ctx, "CreateWebhook")
+	defer cancel()
+	return t.next.CreateWebhook(ctx, webhook)
+}
+
+func (t *timeoutService) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	ctx, cancel := t.context(ctx, "GetWebhook")
+	defer cancel()
+	return t.next.GetWebhook(ctx, id)
+}
+
+func (t *timeoutService) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	ctx, cancel := t.context(ctx, "ListWebhooks")
+	defer cancel()
+	return t.next.ListWebhooks(ctx)
+}
+
+func (t *timeoutService) ListWebhooksForEvent(ctx context.Context, eventType string) ([]models.Webhook, error) {
+	ctx, cancel := t.context(ctx, "ListWebhooksForEvent")
+	defer cancel()
+	return t.next.ListWebhooksForEvent(ctx, eventType)
+}
+
+func (t *timeoutService) DeleteWebhook(ctx context.Context, id string) error {
+	ctx, cancel := t.context(ctx, "DeleteWebhook")
+	defer cancel()
+	return t.next.DeleteWebhook(ctx, id)
+}
+
+func (t *timeoutService) RecordWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	ctx, cancel := t.context(ctx, "RecordWebhookDelivery")
+	defer cancel()
+	return t.next.RecordWebhookDelivery(ctx, delivery)
+}
+
+func (t *timeoutService) ListWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := t.context(ctx, "ListWebhookDeliveries")
+	defer cancel()
+	return t.next.ListWebhookDeliveries(ctx, webhookID, limit)
+}
+
+func (t *timeoutService) CreateUsers(ctx context.Context, users []*models.User) error {
+	ctx, cancel := t.context(ctx, "CreateUsers")
+	defer cancel()
+	return t.next.CreateUsers(ctx, users)
+}
+
+func (t *timeoutService) UpdateUsers(ctx context.Context, ids []string, updates models.UserUpdate) ([]models.BulkResult, error) {
+	ctx, cancel := t.context(ctx, "UpdateUsers")
+	defer cancel()
+	return t.next.UpdateUsers(ctx, ids, updates)
+}
+
+func (t *timeoutService) DeleteUsers(ctx context.Context, filter UserFilter, limit int, opts DeleteOptions) (*DeleteResult, error) {
+	ctx, cancel := t.context(ctx, "DeleteUsers")
+	defer cancel()
+	return t.next.DeleteUsers(ctx, filter, limit, opts)
+}
+
+func (t *timeoutService) UpsertUserByEmail(ctx context.Context, user *models.User) (bool, error) {
+	ctx, cancel := t.context(ctx, "UpsertUserByEmail")
+	defer cancel()
+	return t.next.UpsertUserByEmail(ctx, user)
+}
+
+func (t *timeoutService) GetUsersChangedSince(ctx context.Context, since time.Time, cursor string, limit int) (*models.ChangeSet, error) {
+	ctx, cancel := t.context(ctx, "GetUsersChangedSince")
+	defer cancel()
+	return t.next.GetUsersChangedSince(ctx, since, cursor, limit)
+}
+
+func (t *timeoutService) PurgeAnonymizedUsers(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	ctx, cancel := t.context(ctx, "PurgeAnonymizedUsers")
+	defer cancel()
+	return t.next.PurgeAnonymizedUsers(ctx, before, limit, dryRun)
+}
+
+func (t *timeoutService) PurgeExpiredTokens(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	ctx, cancel := t.context(ctx, "PurgeExpiredTokens")
+	defer cancel()
+	return t.next.PurgeExpiredTokens(ctx, before, limit, dryRun)
+}
+
+func (t *timeoutService) TrimAuditLog(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	ctx, cancel := t.context(ctx, "TrimAuditLog")
+	defer cancel()
+	return t.next.TrimAuditLog(ctx, before, limit, dryRun)
+}
+
+func (t *timeoutService) TrimTombstones(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	ctx, cancel := t.context(ctx, "TrimTombstones")
+	defer cancel()
+	return t.next.TrimTombstones(ctx, before, limit, dryRun)
+}
+
+func (t *timeoutService) EnqueueJob(ctx context.Context, job *models.Job) error {
+	ctx, cancel := t.context(ctx, "EnqueueJob")
+	defer cancel()
+	return t.next.EnqueueJob(ctx, job)
+}
+
+func (t *timeoutService) ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]models.Job, error) {
+	ctx, cancel := t.context(ctx, "ClaimJobs")
+	defer cancel()
+	return t.next.ClaimJobs(ctx, kinds, limit, lease)
+}
+
+func (t *timeoutService) CompleteJob(ctx context.Context, id int64) error {
+	ctx, cancel := t.context(ctx, "CompleteJob")
+	defer cancel()
+	return t.next.CompleteJob(ctx, id)
+}
+
+func (t *timeoutService) FailJob(ctx context.Context, id int64, message string, retryIn time.Duration) error {
+	ctx, cancel := t.context(ctx, "FailJob")
+	defer cancel()
+	return t.next.FailJob(ctx, id, message, retryIn)
+}
+
+func (t *timeoutService) ListJobs(ctx context.Context, status models.JobStatus, page Page) ([]models.Job, error) {
+	ctx, cancel := t.context(ctx, "ListJobs")
+	defer cancel()
+	return t.next.ListJobs(ctx, status, page)
+}
+
+func (t *timeoutService) RetryJob(ctx context.Context, id int64) (*models.Job, error) {
+	ctx, cancel := t.context(ctx, "RetryJob")
+	defer cancel()
+	return t.next.RetryJob(ctx, id)
+}
+
+func (t *timeoutService) IssuePasswordReset(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	ctx, cancel := t.context(ctx, "IssuePasswordReset")
+	defer cancel()
+	return t.next.IssuePasswordReset(ctx, userID, tokenHash, expiresAt)
+}
+
+func (t *timeoutService) ResetPassword(ctx context.Context, tokenHash, hash string) (string, error) {
+	ctx, cancel := t.context(ctx, "ResetPassword")
+	defer cancel()
+	return t.next.ResetPassword(ctx, tokenHash, hash)
+}
+
+func (t *timeoutService) GetNotificationTemplate(ctx context.Context, name string, locales []string) (*models.NotificationTemplate, error) {
+	ctx, cancel := t.context(ctx, "GetNotificationTemplate")
+	defer cancel()
+	return t.next.GetNotificationTemplate(ctx, name, locales)
+}
+
+func (t *timeoutService) ListNotificationTemplates(ctx context.Context) ([]models.NotificationTemplate, error) {
+	ctx, cancel := t.context(ctx, "ListNotificationTemplates")
+	defer cancel()
+	return t.next.ListNotificationTemplates(ctx)
+}
+
+func (t *timeoutService) PutNotificationTemplate(ctx context.Context, tmpl *models.NotificationTemplate) error {
+	ctx, cancel := t.context(ctx, "PutNotificationTemplate")
+	defer cancel()
+	return t.next.PutNotificationTemplate(ctx, tmpl)
+}
+
+func (t *timeoutService) DeleteNotificationTemplate(ctx context.Context, name, locale string) error {
+	ctx, cancel := t.context(ctx, "DeleteNotificationTemplate")
+	defer cancel()
+	return t.next.DeleteNotificationTemplate(ctx, name, locale)
+}
+
+func (t *timeoutService) ListFeatureFlags(ctx context.Context) ([]models.FeatureFlag, error) {
+	ctx, cancel := t.context(ctx, "ListFeatureFlags")
+	defer cancel()
+	return t.next.ListFeatureFlags(ctx)
+}
+
+func (t *timeoutService) SetFeatureFlag(ctx context.Context, name string, enabled bool) (*models.FeatureFlag, error) {
+	ctx, cancel := t.context(ctx, "SetFeatureFlag")
+	defer cancel()
+	return t.next.SetFeatureFlag(ctx, name, enabled)
+}
+
+func (t *timeoutService) DeleteFeatureFlag(ctx context.Context, name string) error {
+	ctx, cancel := t.context(ctx, "DeleteFeatureFlag")
+	defer cancel()
+	return t.next.DeleteFeatureFlag(ctx, name)
+}
+
+func (t *timeoutService) GetMetadata(ctx context.Context, userID string) (models.Metadata, error) {
+	ctx, cancel := t.context(ctx, "GetMetadata")
+	defer cancel()
+	return t.next.GetMetadata(ctx, userID)
+}
+
+func (t *timeoutService) SetMetadata(ctx context.Context, userID string, md models.Metadata) (models.Metadata, error) {
+	ctx, cancel := t.context(ctx, "SetMetadata")
+	defer cancel()
+	return t.next.SetMetadata(ctx, userID, md)
+}
+
+func (t *timeoutService) MergeMetadata(ctx context.Context, userID string, patch models.Metadata) (models.Metadata, error) {
+	ctx, cancel := t.context(ctx, "MergeMetadata")
+	defer cancel()
+	return t.next.MergeMetadata(ctx, userID, patch)
+}
+
+func (t *timeoutService) AddUserTags(ctx context.Context, id string, tags []string) (*models.User, error) {
+	ctx, cancel := t.context(ctx, "AddUserTags")
+	defer cancel()
+	return t.next.AddUserTags(ctx, id, tags)
+}
+
+func (t *timeoutService) RemoveUserTags(ctx context.Context, id string, tags []string) (*models.User, error) {
+	ctx, cancel := t.context(ctx, "RemoveUserTags")
+	defer cancel()
+	return t.next.RemoveUserTags(ctx, id, tags)
+}
+
+func (t *timeoutService) CreateGroup(ctx context.Context, group *models.Group) error {
+	ctx, cancel := t.context(ctx, "CreateGroup")
+	defer cancel()
+	return t.next.CreateGroup(ctx, group)
+}
+
+func (t *timeoutService) GetGroup(ctx context.Context, id string) (*models.Group, error) {
+	ctx, cancel := t.context(ctx, "GetGroup")
+	defer cancel()
+	return t.next.GetGroup(ctx, id)
+}
+
+func (t *timeoutService) ListGroups(ctx context.Context, page Page) ([]models.Group, error) {
+	ctx, cancel := t.context(ctx, "ListGroups")
+	defer cancel()
+	return t.next.ListGroups(ctx, page)
+}
+
+func (t *timeoutService) UpdateGroup(ctx context.Context, id string, updates models.GroupUpdate) (*models.Group, error) {
+	ctx, cancel := t.context(ctx, "UpdateGroup")
+	defer cancel()
+	return t.next.UpdateGroup(ctx, id, updates)
+}
+
+func (t *timeoutService) DeleteGroup(ctx context.Context, id string) error {
+	ctx, cancel := t.context(ctx, "DeleteGroup")
+	defer cancel()
+	return t.next.DeleteGroup(ctx, id)
+}
+
+func (t *timeoutService) AddUserToGroup(ctx context.Context, groupID, userID string) error {
+	ctx, cancel := t.context(ctx, "AddUserToGroup")
+	defer cancel()
+	return t.next.AddUserToGroup(ctx, groupID, userID)
+}
+
+func (t *timeoutService) RemoveUserFromGroup(ctx context.Context, groupID, userID string) error {
+	ctx, cancel := t.context(ctx, "RemoveUserFromGroup")
+	defer cancel()
+	return t.next.RemoveUserFromGroup(ctx, groupID, userID)
+}
+
+func (t *timeoutService) ListGroupMembers(ctx context.Context, groupID string, page Page) ([]models.User, error) {
+	ctx, cancel := t.context(ctx, "ListGroupMembers")
+	defer cancel()
+	return t.next.ListGroupMembers(ctx, groupID, page)
+}
+
+func (t *timeoutService) ListUserGroups(ctx context.Context, userID string) ([]models.Group, error) {
+	ctx, cancel := t.context(ctx, "ListUserGroups")
+	defer cancel()
+	return t.next.ListUserGroups(ctx, userID)
+}
+
+func (t *timeoutService) GetPreferences(ctx context.Context, userID string) (*models.Preferences, error) {
+	ctx, cancel := t.context(ctx, "GetPreferences")
+	defer cancel()
+	return t.next.GetPreferences(ctx, userID)
+}
+
+func (t *timeoutService) UpdatePreferences(ctx context.Context, userID string, updates models.PreferencesUpdate) (*models.Preferences, error) {
+	ctx, cancel := t.context(ctx, "UpdatePreferences")
+	defer cancel()
+	return t.next.UpdatePreferences(ctx, userID, updates)
+}
+
+func (t *timeoutService) QueryAudit(ctx context.Context, filter AuditFilter, page Page) ([]models.AuditEntry, error) {
+	ctx, cancel := t.context(ctx, "QueryAudit")
+	defer cancel()
+	return t.next.QueryAudit(ctx, filter, page)
+}
+
+func (t *timeoutService) EachAuditEntry(ctx context.Context, filter AuditFilter, fn func(models.AuditEntry) error) error {
+	ctx, cancel := t.context(ctx, "EachAuditEntry")
+	defer cancel()
+	return t.next.EachAuditEntry(ctx, filter, fn)
+}
+
+func (t *timeoutService) RecordPurgeRun(ctx context.Context, run *models.PurgeRun) error {
+	ctx, cancel := t.context(ctx, "RecordPurgeRun")
+	defer cancel()
+	return t.next.RecordPurgeRun(ctx, run)
+}
+
+func (t *timeoutService) ListPurgeRuns(ctx context.Context, job string, page Page) ([]models.PurgeRun, error) {
+	ctx, cancel := t.context(ctx, "ListPurgeRuns")
+	defer cancel()
+	return t.next.ListPurgeRuns(ctx, job, page)
+}
+
+func (t *timeoutService) CountSearchUsers(ctx context.Context, text string, filter UserFilter) (int64, error) {
+	ctx, cancel := t.context(ctx, "CountSearchUsers")
+	defer cancel()
+	return t.next.CountSearchUsers(ctx, text, filter)
+}
+
+func (t *timeoutService) CountAudit(ctx context.Context, filter AuditFilter) (int64, error) {
+	ctx, cancel := t.context(ctx, "CountAudit")
+	defer cancel()
+	return t.next.CountAudit(ctx, filter)
+}
+
+func (t *timeoutService) CountGroups(ctx context.Context) (int64, error) {
+	ctx, cancel := t.context(ctx, "CountGroups")
+	defer cancel()
+	return t.next.CountGroups(ctx)
+}
+
+func (t *timeoutService) CountGroupMembers(ctx context.Context, groupID string) (int64, error) {
+	ctx, cancel := t.context(ctx, "CountGroupMembers")
+	defer cancel()
+	return t.next.CountGroupMembers(ctx, groupID)
+}
+
+func (t *timeoutService) FindPotentialDuplicates(ctx context.Context, user *models.User) ([]models.DuplicateCandidate, error) {
+	ctx, cancel := t.context(ctx, "FindPotentialDuplicates")
+	defer cancel()
+	return t.next.FindPotentialDuplicates(ctx, user)
+}
+
+func (t *timeoutService) MergeUsers(ctx context.Context, primaryID, duplicateID string) (*models.User, error) {
+	ctx, cancel := t.context(ctx, "MergeUsers")
+	defer cancel()
+	return t.next.MergeUsers(ctx, primaryID, duplicateID)
+}
+
+func (t *timeoutService) CountJobs(ctx context.Context, status models.JobStatus) (int64, error) {
+	ctx, cancel := t.context(ctx, "CountJobs")
+	defer cancel()
+	return t.next.CountJobs(ctx, status)
+}
+
+func (t *timeoutService) RefreshUserDirectory(ctx context.Context, limit int) (int, error) {
+	ctx, cancel := t.context(ctx, "RefreshUserDirectory")
+	defer cancel()
+	return t.next.RefreshUserDirectory(ctx, limit)
+}
+
+func (t *timeoutService) SyncUserFeed(ctx context.Context, consumer string, limit int, apply func(ctx context.Context, batch models.FeedBatch) error) (int, error) {
+	ctx, cancel := t.context(ctx, "SyncUserFeed")
+	defer cancel()
+	return t.next.SyncUserFeed(ctx, consumer, limit, apply)
+}
+
+func (t *timeoutService) ResetUserFeed(ctx context.Context, consumer string, at time.Time) error {
+	ctx, cancel := t.context(ctx, "ResetUserFeed")
+	defer cancel()
+	return t.next.ResetUserFeed(ctx, consumer, at)
+}
+
+func (t *timeoutService) ScanUsers(ctx context.Context, after string, limit int) ([]models.TenantUser, error) {
+	ctx, cancel := t.context(ctx, "ScanUsers")
+	defer cancel()
+	return t.next.ScanUsers(ctx, after, limit)
+}
+
+func (t *timeoutService) PartitionUsers(ctx context.Context, partitions int) error {
+	ctx, cancel := t.context(ctx, "PartitionUsers")
+	defer cancel()
+	return t.next.PartitionUsers(ctx, partitions)
+}
+
+func (t *timeoutService) UserPartitions(ctx context.Context) ([]models.Partition, error) {
+	ctx, cancel := t.context(ctx, "UserPartitions")
+	defer cancel()
+	return t.next.UserPartitions(ctx)
+}
+
+func (t *timeoutService) MaintainUserPartitions(ctx context.Context) error {
+	ctx, cancel := t.context(ctx, "MaintainUserPartitions")
+	defer cancel()
+	return t.next.MaintainUserPartitions(ctx)
+}
+
+func (t *timeoutService) EncryptUserPII(ctx context.Context, after string, limit int) (string, int, error) {
+	ctx, cancel := t.context(ctx, "EncryptUserPII")
+	defer cancel()
+	return t.next.EncryptUserPII(ctx, after, limit)
+}
+
+func (t *timeoutService) DryRun(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, cancel := t.context(ctx, "DryRun")
+	defer cancel()
+	return t.next.DryRun(ctx, fn)
+}
+
+func (t *timeoutService) ListQuotas(ctx context.Context) ([]models.Quota, error) {
+	ctx, cancel := t.context(ctx, "ListQuotas")
+	defer cancel()
+	return t.next.ListQuotas(ctx)
+}
+
+func (t *timeoutService) SetQuota(ctx context.Context, name string, limit int64) (*models.Quota, error) {
+	ctx, cancel := t.context(ctx, "SetQuota")
+	defer cancel()
+	return t.next.SetQuota(ctx, name, limit)
+}
+
+func (t *timeoutService) DeleteQuota(ctx context.Context, name string) error {
+	ctx, cancel := t.context(ctx, "DeleteQuota")
+	defer cancel()
+	return t.next.DeleteQuota(ctx, name)
+}
+
+func (t *timeoutService) RecordConsent(ctx context.Context, consent *models.Consent) error {
+	ctx, cancel := t.context(ctx, "RecordConsent")
+	defer cancel()
+	return t.next.RecordConsent(ctx, consent)
+}
+
+func (t *timeoutService) GetConsents(ctx context.Context, userID string) ([]models.Consent, error) {
+	ctx, cancel := t.context(ctx, "GetConsents")
+	defer cancel()
+	return t.next.GetConsents(ctx, userID)
+}
+
+func (t *timeoutService) SnapshotUser(ctx context.Context, id string) (*models.UserSnapshot, error) {
+	ctx, cancel := t.context(ctx, "SnapshotUser")
+	defer cancel()
+	return t.next.SnapshotUser(ctx, id)
+}
+
+func (t *timeoutService) RestoreUserSnapshot(ctx context.Context, snapshot *models.UserSnapshot, version int) (*models.User, error) {
+	ctx, cancel := t.context(ctx, "RestoreUserSnapshot")
+	defer cancel()
+	return t.next.RestoreUserSnapshot(ctx, snapshot, version)
+}
+
+func (t *timeoutService) CreateExportJob(ctx context.Context, job *models.ExportJob) error {
+	ctx, cancel := t.context(ctx, "CreateExportJob")
+	defer cancel()
+	return t.next.CreateExportJob(ctx, job)
+}
+
+func (t *timeoutService) GetExportJob(ctx context.Context, id int64) (*models.ExportJob, error) {
+	ctx, cancel := t.context(ctx, "GetExportJob")
+	defer cancel()
+	return t.next.GetExportJob(ctx, id)
+}
+
+func (t *timeoutService) ListExportJobs(ctx context.Context, page Page) ([]models.ExportJob, error) {
+	ctx, cancel := t.context(ctx, "ListExportJobs")
+	defer cancel()
+	return t.next.ListExportJobs(ctx, page)
+}
+
+func (t *timeoutService) CountExportJobs(ctx context.Context) (int64, error) {
+	ctx, cancel := t.context(ctx, "CountExportJobs")
+	defer cancel()
+	return t.next.CountExportJobs(ctx)
+}
+
+func (t *timeoutService) UpdateExportJob(ctx context.Context, job *models.ExportJob) error {
+	ctx, cancel := t.context(ctx, "UpdateExportJob")
+	defer cancel()
+	return t.next.UpdateExportJob(ctx, job)
+}
+
+func (t *timeoutService) DeleteExportJob(ctx context.Context, id int64) error {
+	ctx, cancel := t.context(ctx, "DeleteExportJob")
+	defer cancel()
+	return t.next.DeleteExportJob(ctx, id)
+}
+
+func (t *timeoutService) EachUser(ctx context.Context, filter UserFilter, fn func(models.User) error) error {
+	ctx, cancel := t.context(ctx, "EachUser")
+	defer cancel()
+	return t.next.EachUser(ctx, filter, fn)
+}
+
+func (t *timeoutService) RefreshGrowthStats(ctx context.Context) (int64, error) {
+	ctx, cancel := t.context(ctx, "RefreshGrowthStats")
+	defer cancel()
+	return t.next.RefreshGrowthStats(ctx)
+}
+
+func (t *timeoutService) GetGrowthStats(ctx context.Context, from, to time.Time) (*models.GrowthStats, error) {
+	ctx, cancel := t.context(ctx, "GetGrowthStats")
+	defer cancel()
+	return t.next.GetGrowthStats(ctx, from, to)
+}
+
+func (t *timeoutService) PurgeDeadJobs(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+	ctx, cancel := t.context(ctx, "PurgeDeadJobs")
+	defer cancel()
+	return t.next.PurgeDeadJobs(ctx, before, limit, dryRun)
+}
+
+func (t *timeoutService) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	ctx, cancel := t.context(ctx, "ReserveIdempotencyKey")
+	defer cancel()
+	return t.next.ReserveIdempotencyKey(ctx, record)
+}
+
+func (t *timeoutService) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	ctx, cancel := t.context(ctx, "ReleaseIdempotencyKey")
+	defer cancel()
+	return t.next.ReleaseIdempotencyKey(ctx, key)
+}
+
+func (t *timeoutService) IssueEmailVerification(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	ctx, cancel := t.context(ctx, "IssueEmailVerification")
+	defer cancel()
+	return t.next.IssueEmailVerification(ctx, userID, tokenHash, expiresAt)
+}
+
+func (t *timeoutService) CanonicalizeEmails(ctx context.Context, after string, limit int) (CanonicalEmails, error) {
+	ctx, cancel := t.context(ctx, "CanonicalizeEmails")
+	defer cancel()
+	return t.next.CanonicalizeEmails(ctx, after, limit)
+}
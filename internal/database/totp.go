@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// ErrTOTPAlreadyEnabled is returned when enrolling a user whose two-factor
+// authentication is already on.
+var ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+// GetTOTP returns the user's TOTP enrollment, enabled or not.
+func (s *service) GetTOTP(ctx context.Context, userID string) (*models.TOTP, error) {
+	var t models.TOTP
+	query := `SELECT user_id, secret, enabled_at, last_used_step, created FROM user_totp WHERE user_id = $1 AND tenant_id = $2`
+	err := s.db.QueryRow(ctx, query, userID, tenant.FromContext(ctx)).Scan(&t.UserID, &t.Secret, &t.EnabledAt, &t.LastUsedStep, &t.Created)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// EnrollTOTP stores a new, not yet enabled secret for the user. Enrolling
+// again replaces a pending secret but never an enabled one.
+func (s *service) EnrollTOTP(ctx context.Context, userID, secret string) error {
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx, `
+            INSERT INTO user_totp (user_id, tenant_id, secret)
+            SELECT id, tenant_id, $3 FROM users WHERE id = $1 AND tenant_id = $2
+            ON CONFLICT (user_id) DO UPDATE
+            SET secret = EXCLUDED.secret, created = now(), last_used_step = 0
+            WHERE user_totp.enabled_at IS NULL
+        `, userID, tenant.FromContext(ctx), secret)
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return ErrTOTPAlreadyEnabled
+		}
+		return recordAudit(ctx, tx, &models.AuditEntry{Action: models.AuditTOTPEnrolled, TargetUserID: userID})
+	})
+}
+
+// EnableTOTP turns on the pending enrollment and stores the hashes of a
+// fresh set of recovery codes.
+func (s *service) EnableTOTP(ctx context.Context, userID string, step int64, recoveryHashes []string) error {
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx, `
+            UPDATE user_totp SET enabled_at = now(), last_used_step = $3
+            WHERE user_id = $1 AND tenant_id = $2 AND enabled_at IS NULL
+        `, userID, tenant.FromContext(ctx), step)
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return sql.ErrNoRows
+		}
+		if err := replaceRecoveryCodes(ctx, tx, userID, recoveryHashes); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, &models.AuditEntry{Action: models.AuditTOTPEnabled, TargetUserID: userID})
+	})
+}
+
+// DisableTOTP removes the enrollment and all recovery codes.
+func (s *service) DisableTOTP(ctx context.Context, userID string) error {
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1 AND tenant_id = $2`, userID, tenant.FromContext(ctx))
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return sql.ErrNoRows
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, &models.AuditEntry{Action: models.AuditTOTPDisabled, TargetUserID: userID})
+	})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the user.
+func (s *service) RegenerateRecoveryCodes(ctx context.Context, userID string, recoveryHashes []string) error {
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		if err := replaceRecoveryCodes(ctx, tx, userID, recoveryHashes); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, &models.AuditEntry{Action: models.AuditTOTPRecoveryRegenerated, TargetUserID: userID})
+	})
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID string, hashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+        INSERT INTO totp_recovery_codes (user_id, tenant_id, code_hash) SELECT $1, $3, unnest($2::text[])
+    `, userID, hashes, tenant.FromContext(ctx))
+	return err
+}
+
+// RecordTOTPUse marks the time step of an accepted code as used. It returns
+// false if that step, or a later one, was already used, so each code can
+// only be used once.
+func (s *service) RecordTOTPUse(ctx context.Context, userID string, step int64) (bool, error) {
+	res, err := s.db.Exec(ctx, `
+        UPDATE user_totp SET last_used_step = $3
+        WHERE user_id = $1 AND tenant_id = $2 AND last_used_step < $3
+    `, userID, tenant.FromContext(ctx), step)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode consumes the unused recovery code with the given hash. It
+// returns false if there is no such code.
+func (s *service) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	used := false
+	err := s.inTx(ctx, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx, `
+            UPDATE totp_recovery_codes SET used_at = now()
+            WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+        `, userID, codeHash)
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return nil
+		}
+		used = true
+		return recordAudit(ctx, tx, &models.AuditEntry{Action: models.AuditTOTPRecoveryCodeConsumed, TargetUserID: userID})
+	})
+	return used, err
+}
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// inTx runs fn in a transaction that is committed if fn returns nil and
+// rolled back otherwise. Transactions aborted by a serialization failure or
+// deadlock are run again, so fn must not have side effects outside tx.
+func (s *service) inTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	return s.retry(ctx, "transaction", isRollbackRetryable, func() error {
+		return s.inTxOnce(ctx, fn)
+	})
+}
+
+func (s *service) inTxOnce(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
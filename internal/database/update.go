@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"users/internal/models"
+	"users/internal/pii"
+	"users/internal/validator"
+)
+
+// ErrNoFieldsToUpdate is returned for an update that sets no field.
+var ErrNoFieldsToUpdate = errors.New("no fields to update")
+
+// setClause collects the assignments of an UPDATE together with their
+// parameters, numbered in the order they are added.
+type setClause struct {
+	assignments []string
+	params      []any
+}
+
+// add appends an assignment; format holds one %d for the number of the
+// parameter taking value.
+func (c *setClause) add(format string, value any) {
+	c.params = append(c.params, value)
+	c.assignments = append(c.assignments, fmt.Sprintf(format, len(c.params)))
+}
+
+// UpdateSet builds the SET clause applying updates, numbering its
+// parameters from $1, for UpdateUserByID and UpdateUsers. Every update
+// bumps the version used for optimistic locking and updated_at. A new email
+// is normalized for the tenant of ctx and sealed with keys, which may be
+// nil to store it in plaintext. It returns
+// ErrNoFieldsToUpdate when updates sets no field; Version alone is a
+// condition, not a field.
+func UpdateSet(ctx context.Context, keys *pii.Keyring, updates models.UserUpdate) (string, []any, error) {
+	var c setClause
+	if updates.FirstName != nil {
+		c.add("first_name = $%d", validator.NormalizeName(*updates.FirstName))
+	}
+	if updates.LastName != nil {
+		c.add("last_name = $%d", validator.NormalizeName(*updates.LastName))
+	}
+	if updates.Username != nil {
+		c.add("username = NULLIF($%d, '')", *updates.Username)
+	}
+	if updates.Locale != nil {
+		c.add("locale = NULLIF($%d, '')", *updates.Locale)
+	}
+	if updates.Timezone != nil {
+		c.add("timezone = NULLIF($%d, '')", *updates.Timezone)
+	}
+	switch {
+	// The age column keeps the age as of the last birthdate change, for
+	// users whose birthdate is cleared.
+	case updates.Birthdate != nil && *updates.Birthdate == "":
+		c.assignments = append(c.assignments, "birthdate = NULL, age = COALESCE(date_part('year', age(birthdate)), age)")
+	case updates.Birthdate != nil:
+		c.add("birthdate = $%[1]d::date, age = date_part('year', age($%[1]d::date))", *updates.Birthdate)
+	case updates.Age != nil:
+		c.add("age = $%d, birthdate = NULL", *updates.Age)
+	}
+	if updates.Email != nil {
+		// A new email only takes effect once confirmed, see
+		// ConfirmEmailChange. Asking for the current one cancels the change.
+		email, ciphertext, err := sealEmail(keys, normalizeEmail(ctx, *updates.Email))
+		if err != nil {
+			return "", nil, err
+		}
+		c.add("pending_email = NULLIF($%d, email), email_token_hash = NULL, email_token_expires_at = NULL", email)
+		if ciphertext != nil {
+			c.add(fmt.Sprintf("pending_email_ciphertext = CASE WHEN $%d = email THEN NULL ELSE $%%d END", len(c.params)), *ciphertext)
+		}
+	}
+	if len(c.assignments) == 0 {
+		return "", nil, ErrNoFieldsToUpdate
+	}
+
+	c.assignments = append(c.assignments, "version = version + 1", "updated_at = now()")
+	return strings.Join(c.assignments, ", "), c.params, nil
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// UpsertUserByEmail creates the user or, when the tenant already has a
+// user with the same email, overwrites its names, age, birthdate and, if given,
+// username, locale and timezone. Passwords and status are only set on creation. user is filled
+// with the stored row; created reports which of the two happened.
+func (s *service) UpsertUserByEmail(ctx context.Context, user *models.User) (created bool, err error) {
+	born, err := storedBirthdate(user, s.now())
+	if err != nil {
+		return false, err
+	}
+	normalizeUser(ctx, user)
+	email, emailCiphertext, err := sealEmail(s.piiKeys, user.Email)
+	if err != nil {
+		return false, err
+	}
+	if user.Status == "" {
+		user.Status = newUserStatus(ctx)
+	}
+	query := `
+        INSERT INTO users (id, tenant_id, first_name, last_name, username, email, age, password_hash, status, locale, birthdate, timezone, email_ciphertext)
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, NULLIF($8, ''), $9, NULLIF($10, ''), $11, NULLIF($12, ''), $13)
+        ON CONFLICT (tenant_id, lower(email)) DO UPDATE
+        SET first_name = EXCLUDED.first_name,
+            last_name = EXCLUDED.last_name,
+            age = EXCLUDED.age,
+            birthdate = EXCLUDED.birthdate,
+            username = COALESCE(EXCLUDED.username, users.username),
+            locale = COALESCE(EXCLUDED.locale, users.locale),
+            timezone = COALESCE(EXCLUDED.timezone, users.timezone),
+            version = users.version + 1,
+            updated_at = now()
+        RETURNING xmax = 0, ` + selectList("", defaultUserFields)
+
+	var stored models.User
+	_, dest, err := s.userColumns(&stored, defaultUserFields)
+	if err != nil {
+		return false, err
+	}
+	id, err := s.newUserID()
+	if err != nil {
+		return false, err
+	}
+	err = s.inTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, query, id, tenant.FromContext(ctx), user.FirstName, user.LastName,
+			user.Username, email, user.Age, user.PasswordHash, user.Status, user.Locale, born, user.Timezone, emailCiphertext).Scan(append([]any{&created}, dest...)...)
+		if err != nil || !created {
+			return err
+		}
+		return s.enforceQuota(ctx, tx, QuotaUsers)
+	})
+	if err != nil {
+		return false, mapConstraintError(err)
+	}
+	*user = stored
+	return created, nil
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"users/internal/models"
+)
+
+const webhookColumns = `id, url, secret, events, active, created`
+
+func scanWebhook(row interface{ Scan(...any) error }) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := row.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, &webhook.Events, &webhook.Active, &webhook.Created)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (s *service) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	webhook.ID = s.newID()
+	query := `
+        INSERT INTO webhooks (id, url, secret, events, active)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING created
+    `
+	return s.db.QueryRow(ctx, query, webhook.ID, webhook.URL, webhook.Secret, webhook.Events, webhook.Active).Scan(&webhook.Created)
+}
+
+func (s *service) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1`
+	return scanWebhook(s.db.QueryRow(ctx, query, id))
+}
+
+func (s *service) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks ORDER BY created`
+	return s.queryWebhooks(ctx, query)
+}
+
+// ListWebhooksForEvent returns the active webhooks subscribed to eventType.
+func (s *service) ListWebhooksForEvent(ctx context.Context, eventType string) ([]models.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE active AND $1 = ANY(events) ORDER BY created`
+	return s.queryWebhooks(ctx, query, eventType)
+}
+
+func (s *service) queryWebhooks(ctx context.Context, query string, args ...any) ([]models.Webhook, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (s *service) DeleteWebhook(ctx context.Context, id string) error {
+	res, err := s.db.Exec(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *service) RecordWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	query := `
+        INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, attempt, status_code, error)
+        VALUES ($1, $2, $3, $4, NULLIF($5, 0), NULLIF($6, ''))
+        RETURNING id, created
+    `
+	return s.db.QueryRow(ctx, query, delivery.WebhookID, delivery.EventID, delivery.EventType, delivery.Attempt, delivery.StatusCode, delivery.Error).Scan(&delivery.ID, &delivery.Created)
+}
+
+// ListWebhookDeliveries returns the most recent delivery attempts for a webhook.
+func (s *service) ListWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	query := `
+        SELECT id, webhook_id, event_id, event_type, attempt, COALESCE(status_code, 0), COALESCE(error, ''), created
+        FROM webhook_deliveries
+        WHERE webhook_id = $1
+        ORDER BY created DESC
+        LIMIT $2
+    `
+	rows, err := s.db.Query(ctx, query, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Attempt, &d.StatusCode, &d.Error, &d.Created); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
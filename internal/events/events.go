@@ -0,0 +1,95 @@
+// Package events provides the in-process bus used to announce changes to
+// users to interested subscribers such as webhook delivery.
+package events
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+const (
+	UserCreated    = "user.created"
+	UserUpdated    = "user.updated"
+	UserDeleted    = "user.deleted"
+	UserAnonymized = "user.anonymized"
+	// UserMerged carries the duplicate, whose merged_into names the user
+	// it was merged into.
+	UserMerged = "user.merged"
+)
+
+// Types lists every event type published on the bus.
+var Types = []string{UserCreated, UserUpdated, UserDeleted, UserAnonymized, UserMerged}
+
+// Event describes a single change to a user.
+type Event struct {
+	ID         string       `json:"id"`
+	Type       string       `json:"type"`
+	TenantID   string       `json:"tenant_id"`
+	UserID     string       `json:"user_id"`
+	User       *models.User `json:"data,omitempty"`
+	OccurredAt time.Time    `json:"occurred_at"`
+}
+
+// New returns an event of the given type for user in the tenant of ctx.
+func New(ctx context.Context, eventType string, user *models.User) Event {
+	return Event{
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		TenantID:   tenant.FromContext(ctx),
+		UserID:     user.ID,
+		User:       user,
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+// Handler receives published events. Handlers are called synchronously and
+// must not block.
+type Handler func(Event)
+
+// Bus fans published events out to every subscribed handler.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []subscription
+	nextID   int
+}
+
+type subscription struct {
+	id int
+	h  Handler
+}
+
+// NewBus returns an empty bus.
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers h to receive every subsequently published event.
+// Calling the returned function removes it again.
+func (b *Bus) Subscribe(h Handler) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	id := b.nextID
+	b.handlers = append(b.handlers, subscription{id: id, h: h})
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.handlers = slices.DeleteFunc(b.handlers, func(s subscription) bool { return s.id == id })
+	}
+}
+
+// Publish delivers e to all subscribers.
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, s := range b.handlers {
+		s.h(e)
+	}
+}
@@ -0,0 +1,216 @@
+// Package flags decides which optional features are enabled for a tenant,
+// so they can be rolled out one tenant at a time. A flag is resolved from,
+// in order of precedence, the tenant's override stored in the database,
+// the tenant's entry in the configuration, the configured default and
+// finally the flag's built-in default.
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// The known flags.
+const (
+	// WelcomeEmail sends new users a welcome mail.
+	WelcomeEmail = "welcome_email"
+	// EmailVerificationRequired creates users as pending instead of
+	// active and mails them a code, so they cannot log in until they
+	// confirm their email or an operator activates them.
+	EmailVerificationRequired = "email_verification_required"
+	// CanonicalGmail stores and looks up Gmail addresses without dots and
+	// +tags, so one mailbox cannot sign up twice.
+	CanonicalGmail = "canonical_gmail"
+	// DuplicateWarnings looks for potential duplicates of every new user
+	// and names them in the X-Potential-Duplicates header of the response.
+	DuplicateWarnings = "duplicate_warnings"
+)
+
+// Known lists every flag with its built-in default.
+var Known = map[string]bool{
+	WelcomeEmail:              false,
+	EmailVerificationRequired: false,
+	CanonicalGmail:            false,
+	DuplicateWarnings:         false,
+}
+
+// Config holds the flags set through configuration.
+type Config struct {
+	Defaults map[string]bool            `json:"defaults"`
+	Tenants  map[string]map[string]bool `json:"tenants"`
+}
+
+// Validate reports flags in c that do not exist.
+func (c Config) Validate() error {
+	check := func(flags map[string]bool) error {
+		for name := range flags {
+			if _, ok := Known[name]; !ok {
+				return fmt.Errorf("unknown feature flag %q", name)
+			}
+		}
+		return nil
+	}
+	if err := check(c.Defaults); err != nil {
+		return err
+	}
+	for _, flags := range c.Tenants {
+		if err := check(flags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseList parses a comma separated list of flags to enable, such as
+// "welcome_email,-email_verification_required", where a leading "-"
+// disables the flag.
+func ParseList(list string) (map[string]bool, error) {
+	flags := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		enabled := !strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		if _, ok := Known[name]; !ok {
+			return nil, fmt.Errorf("unknown feature flag %q", name)
+		}
+		flags[name] = enabled
+	}
+	return flags, nil
+}
+
+// LoadFile reads a Config from a JSON file.
+func LoadFile(path string) (Config, error) {
+	var c Config
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := c.Validate(); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Store loads the overrides kept in the database.
+type Store interface {
+	ListFeatureFlags(ctx context.Context) ([]models.FeatureFlag, error)
+}
+
+// Flags resolves flags from the configuration and a cached copy of the
+// stored overrides.
+type Flags struct {
+	store     Store
+	config    atomic.Pointer[Config]
+	overrides atomic.Pointer[map[string]map[string]bool]
+}
+
+// New returns flags resolved from cfg and the overrides in store. The
+// overrides are only read by Refresh and Run.
+func New(store Store, cfg Config) *Flags {
+	f := &Flags{store: store}
+	f.SetConfig(cfg)
+	f.overrides.Store(&map[string]map[string]bool{})
+	return f
+}
+
+// SetConfig replaces the configuration, such as after a reload.
+func (f *Flags) SetConfig(cfg Config) {
+	f.config.Store(&cfg)
+}
+
+// Refresh rereads the stored overrides.
+func (f *Flags) Refresh(ctx context.Context) error {
+	stored, err := f.store.ListFeatureFlags(ctx)
+	if err != nil {
+		return err
+	}
+	overrides := map[string]map[string]bool{}
+	for _, flag := range stored {
+		if overrides[flag.TenantID] == nil {
+			overrides[flag.TenantID] = map[string]bool{}
+		}
+		overrides[flag.TenantID][flag.Name] = flag.Enabled
+	}
+	f.overrides.Store(&overrides)
+	return nil
+}
+
+// Run refreshes the overrides every interval until ctx is done, so
+// changes made on other instances take effect here too.
+func (f *Flags) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := f.Refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error refreshing feature flags: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Source tells where the value of a flag came from.
+type Source string
+
+const (
+	SourceBuiltin  Source = "builtin"
+	SourceConfig   Source = "config"
+	SourceOverride Source = "override"
+)
+
+// Resolve returns whether flag name is enabled for tenantID and where
+// that was decided.
+func (f *Flags) Resolve(tenantID, name string) (bool, Source) {
+	if enabled, ok := (*f.overrides.Load())[tenantID][name]; ok {
+		return enabled, SourceOverride
+	}
+	cfg := f.config.Load()
+	if enabled, ok := cfg.Tenants[tenantID][name]; ok {
+		return enabled, SourceConfig
+	}
+	if enabled, ok := cfg.Defaults[name]; ok {
+		return enabled, SourceConfig
+	}
+	return Known[name], SourceBuiltin
+}
+
+// Enabled reports whether flag name is enabled for tenantID.
+func (f *Flags) Enabled(tenantID, name string) bool {
+	enabled, _ := f.Resolve(tenantID, name)
+	return enabled
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying f, which Enabled consults.
+func NewContext(ctx context.Context, f *Flags) context.Context {
+	return context.WithValue(ctx, contextKey{}, f)
+}
+
+// Enabled reports whether flag name is enabled for the tenant of ctx. A
+// context without flags gets the built-in defaults.
+func Enabled(ctx context.Context, name string) bool {
+	f, ok := ctx.Value(contextKey{}).(*Flags)
+	if !ok {
+		return Known[name]
+	}
+	return f.Enabled(tenant.FromContext(ctx), name)
+}
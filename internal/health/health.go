@@ -0,0 +1,164 @@
+// Package health aggregates the checks of the components the service
+// depends on into one report.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Statuses of a check and of the whole report.
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+	// StatusDegraded is reported when only optional checks fail.
+	StatusDegraded = "degraded"
+)
+
+// DefaultTimeout bounds checks registered without a timeout.
+const DefaultTimeout = time.Second
+
+// CheckFunc probes one component. The details it returns, if any, are
+// included in the report whether or not the check fails.
+type CheckFunc func(ctx context.Context) (details any, err error)
+
+// Check is a named probe with its own timeout.
+type Check struct {
+	Name    string
+	Timeout time.Duration
+	// Optional checks degrade the report instead of taking it down, for
+	// components the service keeps working without.
+	Optional bool
+	Run      CheckFunc
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Status     string  `json:"status"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+	Optional   bool    `json:"optional,omitempty"`
+	Details    any     `json:"details,omitempty"`
+}
+
+// Report is the outcome of every registered check, keyed by name.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Registry holds the checks of the service. It is safe for concurrent use.
+type Registry struct {
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{checks: make(map[string]Check)}
+}
+
+// Register adds check, replacing any check of the same name.
+func (r *Registry) Register(check Check) {
+	if check.Timeout <= 0 {
+		check.Timeout = DefaultTimeout
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[check.Name] = check
+}
+
+// Names returns the names of the registered checks, sorted.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.checks))
+	for name := range r.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run runs every check concurrently, each within its timeout, and
+// aggregates the results. The report is down when a required check fails
+// and degraded when only optional ones do.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := make([]Check, 0, len(r.checks))
+	for _, check := range r.checks {
+		checks = append(checks, check)
+	}
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]Result, len(checks))}
+	for i, check := range checks {
+		result := results[i]
+		report.Checks[check.Name] = result
+		if result.Status == StatusUp {
+			continue
+		}
+		if !check.Optional {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+type outcome struct {
+	details any
+	err     error
+}
+
+// run calls check, giving up when its timeout passes even if the check
+// ignores its context.
+func run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- outcome{err: fmt.Errorf("panic: %v", p)}
+			}
+		}()
+		details, err := check.Run(ctx)
+		done <- outcome{details, err}
+	}()
+
+	var o outcome
+	select {
+	case o = <-done:
+	case <-ctx.Done():
+		o.err = fmt.Errorf("timed out after %s", check.Timeout)
+	}
+	result := Result{
+		Status:     StatusUp,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		Optional:   check.Optional,
+		Details:    o.details,
+	}
+	if o.err != nil {
+		result.Status = StatusDown
+		result.Error = o.err.Error()
+	}
+	return result
+}
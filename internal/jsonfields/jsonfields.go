@@ -0,0 +1,140 @@
+// Package jsonfields finds the fields of a JSON document that the Go value
+// it is decoded into has no place for, which encoding/json silently drops.
+package jsonfields
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	unmarshalerType     = reflect.TypeFor[json.Unmarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// Unknown returns the paths of the object fields in data that decoding it
+// into a value of v's type would ignore, sorted, such as
+// "frist_name", "updates.frist_name" or "users[2].frist_name". Field names
+// match as encoding/json matches them, ignoring case. Values decoding
+// themselves, maps and interfaces accept any field. Unknown returns nil
+// for data that is not valid JSON; decoding reports that.
+func Unknown(data []byte, v any) []string {
+	var doc any
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+		return nil
+	}
+	var unknown []string
+	walk(doc, reflect.TypeOf(v), "", &unknown)
+	slices.Sort(unknown)
+	return unknown
+}
+
+func walk(doc any, t reflect.Type, path string, unknown *[]string) {
+	for t != nil && t.Kind() == reflect.Pointer {
+		if decodesItself(t) {
+			return
+		}
+		t = t.Elem()
+	}
+	if t == nil || decodesItself(t) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return
+		}
+		fields := structFields(t)
+		for name, value := range obj {
+			field, ok := lookup(fields, name)
+			if !ok {
+				*unknown = append(*unknown, join(path, name))
+				continue
+			}
+			walk(value, field, join(path, name), unknown)
+		}
+	case reflect.Map:
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return
+		}
+		for name, value := range obj {
+			walk(value, t.Elem(), join(path, name), unknown)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := doc.([]any)
+		if !ok {
+			return
+		}
+		for i, elem := range arr {
+			walk(elem, t.Elem(), path+"["+strconv.Itoa(i)+"]", unknown)
+		}
+	}
+}
+
+func decodesItself(t reflect.Type) bool {
+	return t.Implements(unmarshalerType) || t.Implements(textUnmarshalerType) ||
+		reflect.PointerTo(t).Implements(unmarshalerType) || reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// structFields maps the JSON names of the fields of t, those of embedded
+// structs included, to their types.
+func structFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for n, typ := range structFields(ft) {
+					if _, ok := fields[n]; !ok {
+						fields[n] = typ
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func lookup(fields map[string]reflect.Type, name string) (reflect.Type, bool) {
+	if t, ok := fields[name]; ok {
+		return t, true
+	}
+	for n, t := range fields {
+		if strings.EqualFold(n, name) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
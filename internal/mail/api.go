@@ -0,0 +1,112 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"users/internal/awsv4"
+)
+
+// SendGridSender sends messages through the SendGrid v3 mail API.
+type SendGridSender struct {
+	APIKey string
+	From   string
+	// Endpoint overrides the API URL, for tests.
+	Endpoint string
+	Client   *http.Client
+}
+
+func (s *SendGridSender) Send(ctx context.Context, msg Message) error {
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	contents := []content{{"text/plain", msg.Body}}
+	if msg.HTML != "" {
+		contents = append(contents, content{"text/html", msg.HTML})
+	}
+	payload, err := json.Marshal(map[string]any{
+		"personalizations": []any{map[string]any{"to": []any{map[string]string{"email": msg.To}}}},
+		"from":             map[string]string{"email": s.From},
+		"subject":          msg.Subject,
+		"content":          contents,
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = "https://api.sendgrid.com/v3/mail/send"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	return do(s.Client, req, "sendgrid")
+}
+
+// SESSender sends messages through the Amazon SES v2 API.
+type SESSender struct {
+	Signer awsv4.Signer
+	From   string
+	// Endpoint overrides the regional endpoint, for VPC endpoints and tests.
+	Endpoint string
+	Client   *http.Client
+}
+
+func (s *SESSender) Send(ctx context.Context, msg Message) error {
+	type text struct {
+		Data    string `json:"Data"`
+		Charset string `json:"Charset"`
+	}
+	body := map[string]text{"Text": {msg.Body, "UTF-8"}}
+	if msg.HTML != "" {
+		body["Html"] = text{msg.HTML, "UTF-8"}
+	}
+	payload, err := json.Marshal(map[string]any{
+		"FromEmailAddress": s.From,
+		"Destination":      map[string][]string{"ToAddresses": {msg.To}},
+		"Content": map[string]any{"Simple": map[string]any{
+			"Subject": text{msg.Subject, "UTF-8"},
+			"Body":    body,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = "https://email." + s.Signer.Region + ".amazonaws.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/v2/email/outbound-emails", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	s.Signer.Sign(req, payload, time.Now())
+	return do(s.Client, req, "ses")
+}
+
+// do sends req and turns unsuccessful responses into errors quoting the
+// start of the provider's explanation.
+func do(client *http.Client, req *http.Request, provider string) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", provider, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s: %s", provider, resp.Status, bytes.TrimSpace(detail))
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Package mail sends transactional email to users.
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"users/internal/awsv4"
+)
+
+// Message is an email to a single recipient. HTML is optional; the plain
+// text Body is always sent.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	HTML    string `json:",omitempty"`
+}
+
+// Sender delivers messages.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewFromEnv returns the sender selected by MAIL_PROVIDER: smtp, sendgrid,
+// ses or log. Without MAIL_PROVIDER it uses SMTP when SMTP_ADDR is set and
+// otherwise only logs messages, which is enough for local development.
+// MAIL_FROM, or SMTP_FROM for SMTP, is the sender address.
+func NewFromEnv() (Sender, error) {
+	provider := os.Getenv("MAIL_PROVIDER")
+	if provider == "" && os.Getenv("SMTP_ADDR") != "" {
+		provider = "smtp"
+	}
+	from := os.Getenv("MAIL_FROM")
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	switch provider {
+	case "", "log":
+		return LogSender{}, nil
+	case "smtp":
+		if from == "" {
+			from = os.Getenv("SMTP_FROM")
+		}
+		return &SMTPSender{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			From:     from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}, nil
+	case "sendgrid":
+		s := &SendGridSender{APIKey: os.Getenv("SENDGRID_API_KEY"), From: from, Client: client}
+		if s.APIKey == "" || s.From == "" {
+			return nil, fmt.Errorf("sendgrid mail needs SENDGRID_API_KEY and MAIL_FROM")
+		}
+		return s, nil
+	case "ses":
+		region := os.Getenv("AWS_REGION")
+		if region == "" {
+			region = os.Getenv("AWS_DEFAULT_REGION")
+		}
+		s := &SESSender{
+			Signer: awsv4.Signer{
+				Region:          region,
+				Service:         "ses",
+				AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+				SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+				SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			},
+			From:   from,
+			Client: client,
+		}
+		if region == "" || s.Signer.AccessKeyID == "" || s.Signer.SecretAccessKey == "" || s.From == "" {
+			return nil, fmt.Errorf("ses mail needs AWS_REGION, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and MAIL_FROM")
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown MAIL_PROVIDER %q", provider)
+}
+
+// LogSender writes messages to the log instead of sending them.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// SMTPSender sends messages through an SMTP relay, authenticating with
+// PLAIN auth when a username is set.
+type SMTPSender struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	// Header injection through user controlled addresses
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("invalid message header")
+	}
+	header := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\n", s.From, msg.To, msg.Subject)
+	if msg.HTML == "" {
+		body := header + "Content-Type: text/plain; charset=utf-8\r\n\r\n" + msg.Body
+		return smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, []byte(body))
+	}
+
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	boundary := hex.EncodeToString(b)
+	body := header + "Content-Type: multipart/alternative; boundary=" + boundary + "\r\n\r\n" +
+		"--" + boundary + "\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n" + msg.Body + "\r\n" +
+		"--" + boundary + "\r\nContent-Type: text/html; charset=utf-8\r\n\r\n" + msg.HTML + "\r\n" +
+		"--" + boundary + "--\r\n"
+	return smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, []byte(body))
+}
@@ -0,0 +1,157 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"users/internal/models"
+)
+
+// Templates every message is rendered from. Each has built-in sources in
+// templates/{name}.subject.txt, {name}.txt and {name}.html, which tenants
+// may override per locale.
+const (
+	TemplateWelcome           = "welcome"
+	TemplateEmailChange       = "email_change"
+	TemplateEmailVerification = "email_verification"
+	TemplatePasswordReset     = "password_reset"
+)
+
+// TemplateNames lists every template.
+var TemplateNames = []string{TemplateWelcome, TemplateEmailChange, TemplateEmailVerification, TemplatePasswordReset}
+
+//go:embed templates
+var templateFS embed.FS
+
+var defaultTemplates = map[string]Template{}
+
+func init() {
+	read := func(path string) string {
+		b, err := templateFS.ReadFile(path)
+		if err != nil {
+			panic(err)
+		}
+		return string(b)
+	}
+	for _, name := range TemplateNames {
+		t := Template{
+			Subject: read("templates/" + name + ".subject.txt"),
+			Text:    read("templates/" + name + ".txt"),
+			HTML:    read("templates/" + name + ".html"),
+		}
+		if err := t.Validate(name); err != nil {
+			panic(err)
+		}
+		defaultTemplates[name] = t
+	}
+}
+
+// Template holds the sources of one message. Subject and Text are
+// text/template sources, HTML is an html/template source and may be empty
+// for text-only mail.
+type Template struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// DefaultTemplate returns the built-in template called name.
+func DefaultTemplate(name string) (Template, bool) {
+	t, ok := defaultTemplates[name]
+	return t, ok
+}
+
+// Render builds the message to to from the built-in template name.
+func Render(name, to string, data any) (Message, error) {
+	t, ok := defaultTemplates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown mail template %q", name)
+	}
+	return t.Render(to, data)
+}
+
+// Render builds the message to to. data is available to the templates as
+// dot; values in the HTML part are escaped.
+func (t Template) Render(to string, data any) (Message, error) {
+	subject, err := executeText("subject", t.Subject, data)
+	if err != nil {
+		return Message{}, err
+	}
+	body, err := executeText("text", t.Text, data)
+	if err != nil {
+		return Message{}, err
+	}
+	msg := Message{To: to, Subject: strings.TrimSpace(subject), Body: strings.TrimSpace(body)}
+
+	if strings.TrimSpace(t.HTML) != "" {
+		html, err := htmltemplate.New("html").Option("missingkey=error").Parse(t.HTML)
+		if err != nil {
+			return Message{}, err
+		}
+		var b bytes.Buffer
+		if err := html.Execute(&b, data); err != nil {
+			return Message{}, err
+		}
+		msg.HTML = b.String()
+	}
+	return msg, nil
+}
+
+// Validate reports whether t parses and renders with the kind of data the
+// template called name is given, so mistakes such as unknown fields are
+// caught before any mail is sent.
+func (t Template) Validate(name string) error {
+	data, ok := sampleData[name]
+	if !ok {
+		return fmt.Errorf("unknown mail template %q", name)
+	}
+	if strings.TrimSpace(t.Subject) == "" {
+		return fmt.Errorf("subject is required")
+	}
+	if strings.TrimSpace(t.Text) == "" {
+		return fmt.Errorf("text is required")
+	}
+	_, err := t.Render("user@example.com", data)
+	return err
+}
+
+func executeText(name, src string, data any) (string, error) {
+	tmpl, err := texttemplate.New(name).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// TokenData is the data of the email_change, email_verification and
+// password_reset templates.
+// Link is empty when there is no frontend to link to. ExpiresAt is in the
+// user's time zone.
+type TokenData struct {
+	Token     string
+	Link      string
+	ExpiresAt time.Time
+}
+
+// sampleData is the data each template is test-rendered with.
+var sampleData = map[string]any{
+	TemplateWelcome: &models.User{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com"},
+	TemplateEmailChange: TokenData{
+		Token: "token", Link: "https://example.com/confirm?token=token", ExpiresAt: time.Now(),
+	},
+	TemplateEmailVerification: TokenData{
+		Token: "token", Link: "https://example.com/confirm?token=token", ExpiresAt: time.Now(),
+	},
+	TemplatePasswordReset: TokenData{
+		Token: "token", Link: "https://example.com/reset?token=token", ExpiresAt: time.Now(),
+	},
+}
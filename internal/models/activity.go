@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Activity is a sighting of a user, written in batches by the activity
+// tracker.
+type Activity struct {
+	TenantID string
+	UserID   string
+	SeenAt   time.Time
+}
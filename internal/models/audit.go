@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Audited actions.
+const (
+	AuditUserAnonymized   = "user.anonymized"
+	AuditUserDeleted      = "user.deleted"
+	AuditIdentityLinked   = "identity.linked"
+	AuditIdentityUnlinked = "identity.unlinked"
+	AuditPasswordChanged  = "password.changed"
+	AuditPasswordReset    = "password.reset"
+	AuditUserLocked       = "user.locked"
+	AuditUserUnlocked     = "user.unlocked"
+	AuditUserSuspended    = "user.suspended"
+	AuditUserActivated    = "user.activated"
+	AuditMetadataChanged  = "user.metadata_changed"
+	AuditUserMerged       = "user.merged"
+	AuditUserRestored     = "user.restored"
+	AuditUsersExported    = "users.exported"
+
+	AuditImpersonationStarted = "impersonation.started"
+	AuditImpersonationEnded   = "impersonation.ended"
+
+	AuditTOTPEnrolled             = "totp.enrolled"
+	AuditTOTPEnabled              = "totp.enabled"
+	AuditTOTPDisabled             = "totp.disabled"
+	AuditTOTPRecoveryRegenerated  = "totp.recovery_codes_regenerated"
+	AuditTOTPRecoveryCodeConsumed = "totp.recovery_code_used"
+)
+
+// AuditEntry records a sensitive action and who performed it.
+type AuditEntry struct {
+	ID           int64          `json:"id"`
+	TenantID     string         `json:"tenant_id"`
+	Actor        string         `json:"actor"`
+	Action       string         `json:"action"`
+	TargetUserID string         `json:"target_user_id,omitempty"`
+	Details      map[string]any `json:"details,omitempty"`
+	// IP is the client address the change was requested from.
+	IP      string    `json:"ip,omitempty"`
+	Created time.Time `json:"created"`
+}
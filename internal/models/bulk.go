@@ -0,0 +1,21 @@
+package models
+
+// BulkStatus is the outcome of a bulk operation for one user.
+type BulkStatus string
+
+const (
+	BulkUpdated  BulkStatus = "updated"
+	BulkNotFound BulkStatus = "not_found"
+	// BulkNotUpdatable is a user the operation does not apply to, such as
+	// an anonymized or merged user, or one already in the requested
+	// status.
+	BulkNotUpdatable BulkStatus = "not_updatable"
+)
+
+// BulkResult reports what a bulk operation did to one of the requested
+// users. User is the user after the change.
+type BulkResult struct {
+	ID     string     `json:"id"`
+	Status BulkStatus `json:"status"`
+	User   *User      `json:"user,omitempty"`
+}
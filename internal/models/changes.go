@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Change is a user created, updated or deleted after a sync point. Deleted
+// changes carry no user.
+type Change struct {
+	ID        string    `json:"id"`
+	ChangedAt time.Time `json:"changed_at"`
+	Deleted   bool      `json:"deleted,omitempty"`
+	User      *User     `json:"user,omitempty"`
+}
+
+// ChangeSet is a page of changes in the order they happened. Cursor resumes
+// after the last change and is returned even when the page is empty, so a
+// client can always store it for the next sync.
+type ChangeSet struct {
+	Changes []Change `json:"changes"`
+	Cursor  string   `json:"cursor"`
+	HasMore bool     `json:"has_more"`
+}
+
+// TenantUser is a user together with its tenant, for consumers working
+// across tenants.
+type TenantUser struct {
+	TenantID string `json:"tenant_id"`
+	User
+}
+
+// FeedBatch is a batch of the change feed handed to a consumer that keeps
+// a copy of the users elsewhere, such as a search index.
+type FeedBatch struct {
+	// Users are the current state of the users created or updated.
+	Users []TenantUser
+	// Deleted are the IDs of the users deleted.
+	Deleted []string
+}
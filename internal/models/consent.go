@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// The kinds of consent users give.
+const (
+	// ConsentTerms accepts a version of the terms of service.
+	ConsentTerms = "terms"
+	// ConsentMarketing agrees to marketing messages.
+	ConsentMarketing = "marketing"
+)
+
+// ConsentKinds are the kinds of consent that can be recorded.
+var ConsentKinds = []string{ConsentTerms, ConsentMarketing}
+
+// Consent is a user giving or withdrawing consent. Consents are only ever
+// appended; the latest of a kind is the one in force.
+type Consent struct {
+	ID     int64  `json:"id"`
+	UserID string `json:"user_id"`
+	Kind   string `json:"kind"`
+	// Version is the version of the document consented to, such as the
+	// terms of service, if any.
+	Version string `json:"version,omitempty"`
+	Granted bool   `json:"granted"`
+	// SourceIP is the address the consent was given from.
+	SourceIP   string    `json:"source_ip,omitempty"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// LatestConsent returns the latest consent of kind in consents, which are
+// in the order they were recorded, or nil if there is none.
+func LatestConsent(consents []Consent, kind string) *Consent {
+	for i := len(consents) - 1; i >= 0; i-- {
+		if consents[i].Kind == kind {
+			return &consents[i]
+		}
+	}
+	return nil
+}
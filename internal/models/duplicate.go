@@ -0,0 +1,18 @@
+package models
+
+// Reasons a user is reported as a potential duplicate.
+const (
+	// DuplicateName means the full names are similar.
+	DuplicateName = "name"
+	// DuplicateEmail means the emails lead to the same mailbox once dots
+	// and +tags are ignored the way Gmail does.
+	DuplicateEmail = "email"
+)
+
+// DuplicateCandidate is a user that may be the same person as another.
+type DuplicateCandidate struct {
+	User User `json:"user"`
+	// Score is the trigram similarity of the full names, from 0 to 1.
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// UserExport bundles everything stored about a user for subject access
+// requests.
+type UserExport struct {
+	ExportedAt time.Time `json:"exported_at"`
+	User       *User     `json:"user"`
+
+	Metadata     Metadata     `json:"metadata"`
+	Preferences  *Preferences `json:"preferences"`
+	Identities   []Identity   `json:"identities"`
+	AuditEntries []AuditEntry `json:"audit_entries"`
+	Consents     []Consent    `json:"consents"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// ExportStatus is where an export job is in its life cycle.
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "pending"
+	ExportRunning ExportStatus = "running"
+	ExportDone    ExportStatus = "done"
+	ExportFailed  ExportStatus = "failed"
+)
+
+func (s ExportStatus) IsValid() bool {
+	switch s {
+	case ExportPending, ExportRunning, ExportDone, ExportFailed:
+		return true
+	}
+	return false
+}
+
+// The formats users can be exported in.
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+)
+
+// ExportJob is an export of the users of a tenant too large for one
+// request, written to a file in the background.
+type ExportJob struct {
+	ID       int64  `json:"id"`
+	TenantID string `json:"tenant_id"`
+	Format   string `json:"format"`
+	// Filter holds the list filters the export was started with, as the
+	// query parameters of GET /users take them.
+	Filter map[string]string `json:"filter"`
+	Status ExportStatus      `json:"status"`
+	// Total is the number of users the export expects to write, counted
+	// when it starts; Exported how many it has written so far.
+	Total    int64 `json:"total"`
+	Exported int64 `json:"exported"`
+	// StorageKey locates the finished file; Size is its length in bytes.
+	StorageKey  string     `json:"-"`
+	Size        int64      `json:"size,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	Created     time.Time  `json:"created"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// DownloadURL is set on finished exports in API responses.
+	DownloadURL string `json:"download_url,omitempty"`
+}
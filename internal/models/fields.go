@@ -0,0 +1,15 @@
+package models
+
+// UserFields lists the JSON field names of User that clients may request
+// through sparse fieldsets.
+var UserFields = []string{"id", "first_name", "last_name", "username", "age", "birthdate", "email", "pending_email", "locale", "timezone", "tags", "status", "created", "updated_at", "version", "merged_into", "anonymized_at", "last_login_at", "last_seen_at"}
+
+// IsUserField reports whether name is a selectable User field.
+func IsUserField(name string) bool {
+	for _, f := range UserFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
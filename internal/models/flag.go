@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// FeatureFlag is a tenant's stored override of a feature flag.
+type FeatureFlag struct {
+	TenantID  string    `json:"tenant_id"`
+	Name      string    `json:"name"`
+	Enabled   bool      `json:"enabled"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Group is a named set of users of a tenant, such as a team or a
+// department.
+type Group struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Created     time.Time `json:"created"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// GroupUpdate changes the fields of a group that are set.
+type GroupUpdate struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
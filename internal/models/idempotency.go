@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// IdempotencyRecord is the stored outcome of a request made with an
+// Idempotency-Key header.
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+	// StatusCode is 0 while the first request with the key is still
+	// running; Body is empty until then.
+	StatusCode int
+	Body       []byte
+	Created    time.Time
+	ExpiresAt  time.Time
+}
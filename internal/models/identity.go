@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Identity links a user to an account at an external login provider.
+type Identity struct {
+	ID       int64     `json:"id"`
+	UserID   string    `json:"user_id"`
+	Provider string    `json:"provider"`
+	Subject  string    `json:"subject"`
+	Email    string    `json:"email,omitempty"`
+	Created  time.Time `json:"created"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// JobStatus is where a background job is in its life cycle. Finished jobs
+// are deleted, so there is no done status.
+type JobStatus string
+
+const (
+	JobPending JobStatus = "pending"
+	JobRunning JobStatus = "running"
+	// JobDead jobs failed on every attempt and wait for an operator.
+	JobDead JobStatus = "dead"
+)
+
+func (s JobStatus) IsValid() bool {
+	switch s {
+	case JobPending, JobRunning, JobDead:
+		return true
+	}
+	return false
+}
+
+// Job is a unit of background work stored in the jobs table.
+type Job struct {
+	ID       int64  `json:"id"`
+	Kind     string `json:"kind"`
+	TenantID string `json:"tenant_id"`
+	// Key, when set, deduplicates jobs: only one pending or running job
+	// may hold it.
+	Key string `json:"key,omitempty"`
+	// Payload is what the job's handler needs. It is never part of API
+	// responses.
+	Payload     json.RawMessage `json:"-"`
+	Status      JobStatus       `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	Created     time.Time       `json:"created"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
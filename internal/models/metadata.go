@@ -0,0 +1,5 @@
+package models
+
+// Metadata holds custom attributes integrators attach to a user, such as a
+// CRM id or marketing opt-ins. Values are arbitrary JSON.
+type Metadata map[string]any
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Theme is the look of a user's UI.
+type Theme string
+
+const (
+	ThemeSystem Theme = "system"
+	ThemeLight  Theme = "light"
+	ThemeDark   Theme = "dark"
+)
+
+// IsValid reports whether t is a known theme.
+func (t Theme) IsValid() bool {
+	return t == ThemeSystem || t == ThemeLight || t == ThemeDark
+}
+
+// Preferences are the settings a user chooses for themselves.
+type Preferences struct {
+	// EmailNotifications opts in to mail about activity on the account.
+	EmailNotifications bool `json:"email_notifications"`
+	// SecurityAlerts opts in to mail about new sign-ins and credential
+	// changes.
+	SecurityAlerts bool  `json:"security_alerts"`
+	Newsletter     bool  `json:"newsletter"`
+	Theme          Theme `json:"theme"`
+	// UpdatedAt is nil while the user still has the defaults.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// DefaultPreferences are the preferences of users who never changed them.
+func DefaultPreferences() Preferences {
+	return Preferences{EmailNotifications: true, SecurityAlerts: true, Theme: ThemeSystem}
+}
+
+// PreferencesUpdate changes the preferences that are set.
+type PreferencesUpdate struct {
+	EmailNotifications *bool  `json:"email_notifications,omitempty"`
+	SecurityAlerts     *bool  `json:"security_alerts,omitempty"`
+	Newsletter         *bool  `json:"newsletter,omitempty"`
+	Theme              *Theme `json:"theme,omitempty"`
+}
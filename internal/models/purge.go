@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// PurgeRun reports one run of a retention job. Rows counts what was
+// removed, or what would have been in a dry run.
+type PurgeRun struct {
+	ID         int64     `json:"id"`
+	Job        string    `json:"job"`
+	DryRun     bool      `json:"dry_run"`
+	Rows       int64     `json:"rows"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Partition is a partition of the users table. Rows is the planner's
+// estimate as of the last analyze.
+type Partition struct {
+	Name  string `json:"name"`
+	Rows  int64  `json:"rows"`
+	Bytes int64  `json:"bytes"`
+}
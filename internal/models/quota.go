@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Quota is a limit on what a tenant, or each of its users, may store. A
+// limit of 0 means unlimited.
+type Quota struct {
+	TenantID string `json:"tenant_id"`
+	Name     string `json:"name"`
+	Limit    int64  `json:"limit"`
+	// Overridden reports whether the limit is the tenant's own rather than
+	// the configured default.
+	Overridden bool `json:"overridden"`
+	// Used is what the tenant uses of the quota, unset for quotas that
+	// apply to each user.
+	Used      *int64     `json:"used,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// UserSnapshot is the state of a user at one point in time: the profile,
+// metadata and preferences that edits change. Restoring it undoes the
+// edits made since it was taken.
+type UserSnapshot struct {
+	TakenAt     time.Time    `json:"taken_at"`
+	User        *User        `json:"user"`
+	Metadata    Metadata     `json:"metadata"`
+	Preferences *Preferences `json:"preferences"`
+}
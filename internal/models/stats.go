@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// DailyCount is the number of users created on one day.
+type DailyCount struct {
+	Day   time.Time `json:"day"`
+	Count int64     `json:"count"`
+}
+
+// AgeBucket is the number of users whose age falls into a range.
+type AgeBucket struct {
+	Range string `json:"range"`
+	Count int64  `json:"count"`
+}
+
+// UserStats summarizes the users of a tenant for dashboards.
+type UserStats struct {
+	Total           int64        `json:"total"`
+	SignupsPerDay   []DailyCount `json:"signups_per_day"`
+	AgeDistribution []AgeBucket  `json:"age_distribution"`
+}
+
+// GrowthDay is the number of signups, deletions and active users of a
+// tenant on one day (UTC).
+type GrowthDay struct {
+	Day         time.Time `json:"day"`
+	Signups     int64     `json:"signups"`
+	Deletions   int64     `json:"deletions"`
+	ActiveUsers int64     `json:"active_users"`
+}
+
+// GrowthStats is the daily growth of a tenant from From to To, both
+// included, with every day in between.
+type GrowthStats struct {
+	From time.Time   `json:"from"`
+	To   time.Time   `json:"to"`
+	Days []GrowthDay `json:"days"`
+}
@@ -0,0 +1,37 @@
+package models
+
+// UserStatus is where a user is in the account lifecycle.
+type UserStatus string
+
+const (
+	// StatusPending users were created but not yet activated.
+	StatusPending UserStatus = "pending"
+	// StatusActive users can sign in and use the service.
+	StatusActive UserStatus = "active"
+	// StatusSuspended users are blocked until an operator activates them.
+	StatusSuspended UserStatus = "suspended"
+	// StatusMerged users were merged into another user, named by their
+	// MergedInto, and are kept only so references to them stay valid.
+	StatusMerged UserStatus = "merged"
+)
+
+// IsValid reports whether s is a known status.
+func (s UserStatus) IsValid() bool {
+	switch s {
+	case StatusPending, StatusActive, StatusSuspended, StatusMerged:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether a user may move from s to next. Merging
+// is not a transition; merged users stay merged.
+func (s UserStatus) CanTransitionTo(next UserStatus) bool {
+	switch next {
+	case StatusActive:
+		return s == StatusPending || s == StatusSuspended
+	case StatusSuspended:
+		return s == StatusPending || s == StatusActive
+	}
+	return false
+}
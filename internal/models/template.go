@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// NotificationTemplate is a tenant's version of a mail template for one
+// locale. Locale "default" applies to users whose locale has no template
+// of its own.
+type NotificationTemplate struct {
+	Name      string    `json:"name"`
+	Locale    string    `json:"locale"`
+	Subject   string    `json:"subject"`
+	Text      string    `json:"text"`
+	HTML      string    `json:"html,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+	// Builtin marks the template shipped with the service, returned when
+	// the tenant has not stored one.
+	Builtin bool `json:"builtin,omitempty"`
+}
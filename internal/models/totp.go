@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// TOTP is a user's authenticator app enrollment. It only protects logins
+// once EnabledAt is set, i.e. after the user proved the app works.
+type TOTP struct {
+	UserID       string     `json:"user_id"`
+	Secret       string     `json:"-"`
+	EnabledAt    *time.Time `json:"enabled_at,omitempty"`
+	LastUsedStep int64      `json:"-"`
+	Created      time.Time  `json:"created"`
+}
@@ -3,17 +3,83 @@ package models
 import "time"
 
 type User struct {
-	ID        string    `json:"id"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Age       uint      `json:"age"`
-	Email     string    `json:"email"`
-	Created   time.Time `json:"created"`
+	ID        string `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username,omitempty"`
+	// Age is computed from Birthdate on read. Users stored without a
+	// birthdate keep the age they were last given.
+	Age uint `json:"age"`
+	// Birthdate is a date such as "1990-04-01".
+	Birthdate string `json:"birthdate,omitempty"`
+	Email     string `json:"email"`
+	// PendingEmail is the address the user asked to change to. It replaces
+	// Email once confirmed.
+	PendingEmail string `json:"pending_email,omitempty"`
+	// Locale is a language tag such as "de" or "pt-BR" choosing the
+	// language of the mail sent to the user.
+	Locale string `json:"locale,omitempty"`
+	// Timezone is an IANA time zone such as "Europe/Berlin" used to show
+	// times to the user.
+	Timezone string `json:"timezone,omitempty"`
+	// Tags segment users, e.g. "beta" or "vip". They are lower case and
+	// sorted.
+	Tags []string `json:"tags,omitempty"`
+	// Status defaults to active when a user is created without one.
+	Status    UserStatus `json:"status"`
+	Created   time.Time  `json:"created"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Version   int        `json:"version"`
+
+	// MergedInto is the user a merged user was merged into.
+	MergedInto string `json:"merged_into,omitempty"`
+
+	AnonymizedAt *time.Time `json:"anonymized_at,omitempty"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+	LastSeenAt   *time.Time `json:"last_seen_at,omitempty"`
+
+	// PasswordHash is the bcrypt hash stored by CreateUser. It is never
+	// selected or serialized.
+	PasswordHash string `json:"-"`
 }
 
 type UserUpdate struct {
 	FirstName *string `json:"first_name,omitempty"`
 	LastName  *string `json:"last_name,omitempty"`
-	Age       *uint   `json:"age,omitempty"`
+	Username  *string `json:"username,omitempty"`
+	// Age is accepted for older clients and clears the birthdate, since
+	// it no longer matches. It is ignored when Birthdate is also set.
+	Age *uint `json:"age,omitempty"`
+	// Birthdate set to "" clears it.
+	Birthdate *string `json:"birthdate,omitempty"`
 	Email     *string `json:"email,omitempty"`
+	// Locale and Timezone set to "" clear them.
+	Locale   *string `json:"locale,omitempty"`
+	Timezone *string `json:"timezone,omitempty"`
+
+	// Version, when set, makes the update succeed only if the stored user
+	// still has this version.
+	Version *int `json:"version,omitempty"`
+}
+
+// DateLayout is the layout of Birthdate.
+const DateLayout = "2006-01-02"
+
+// AgeAt returns the age in whole years at t of someone born on birthdate.
+func AgeAt(birthdate, t time.Time) uint {
+	years := t.Year() - birthdate.Year()
+	if t.Month() < birthdate.Month() || (t.Month() == birthdate.Month() && t.Day() < birthdate.Day()) {
+		years--
+	}
+	return uint(max(years, 0))
+}
+
+// Location returns the user's time zone, UTC when they have none.
+func (u *User) Location() *time.Location {
+	if u.Timezone != "" {
+		if loc, err := time.LoadLocation(u.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
 }
@@ -0,0 +1,148 @@
+// Package oauth implements "Sign in with ..." for external OAuth2/OIDC
+// providers.
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+// ErrEmailUnverified is returned when the provider cannot vouch for the
+// account's email address.
+var ErrEmailUnverified = errors.New("provider account has no verified email")
+
+// Profile is what a provider tells us about the signed in account.
+type Profile struct {
+	Subject   string
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+// Provider is a configured external login provider.
+type Provider struct {
+	Name   string
+	Config *oauth2.Config
+
+	profile func(ctx context.Context, client *http.Client) (*Profile, error)
+}
+
+// Profile exchanges code for a token and fetches the account profile.
+func (p *Provider) Profile(ctx context.Context, code, verifier string) (*Profile, error) {
+	token, err := p.Config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %w", err)
+	}
+	return p.profile(ctx, p.Config.Client(ctx, token))
+}
+
+// Google returns the "Sign in with Google" provider.
+func Google(clientID, clientSecret, redirectURL string) *Provider {
+	return &Provider{
+		Name: "google",
+		Config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     endpoints.Google,
+			Scopes:       []string{"openid", "email", "profile"},
+		},
+		profile: googleProfile,
+	}
+}
+
+// GitHub returns the "Sign in with GitHub" provider.
+func GitHub(clientID, clientSecret, redirectURL string) *Provider {
+	return &Provider{
+		Name: "github",
+		Config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     endpoints.GitHub,
+			Scopes:       []string{"read:user", "user:email"},
+		},
+		profile: githubProfile,
+	}
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func googleProfile(ctx context.Context, client *http.Client) (*Profile, error) {
+	var info struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		GivenName     string `json:"given_name"`
+		FamilyName    string `json:"family_name"`
+	}
+	if err := getJSON(ctx, client, "https://openidconnect.googleapis.com/v1/userinfo", &info); err != nil {
+		return nil, err
+	}
+	if !info.EmailVerified {
+		return nil, ErrEmailUnverified
+	}
+	return &Profile{Subject: info.Sub, Email: info.Email, FirstName: info.GivenName, LastName: info.FamilyName}, nil
+}
+
+func githubProfile(ctx context.Context, client *http.Client) (*Profile, error) {
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user", &user); err != nil {
+		return nil, err
+	}
+
+	// The public profile email is optional, so ask for the primary one
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	profile := &Profile{Subject: strconv.FormatInt(user.ID, 10)}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			profile.Email = e.Email
+		}
+	}
+	if profile.Email == "" {
+		return nil, ErrEmailUnverified
+	}
+
+	name := strings.TrimSpace(user.Name)
+	if name == "" {
+		name = user.Login
+	}
+	profile.FirstName, profile.LastName, _ = strings.Cut(name, " ")
+	return profile, nil
+}
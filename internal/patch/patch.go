@@ -0,0 +1,172 @@
+// Package patch translates RFC 6902 JSON Patch and RFC 7386 JSON Merge Patch
+// documents into the partial updates understood by the database layer.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"users/internal/models"
+)
+
+const (
+	// JSONPatchContentType is the media type of RFC 6902 documents.
+	JSONPatchContentType = "application/json-patch+json"
+	// MergePatchContentType is the media type of RFC 7386 documents.
+	MergePatchContentType = "application/merge-patch+json"
+)
+
+// patchable lists the user fields a patch document may change.
+var patchable = map[string]bool{
+	"first_name": true,
+	"last_name":  true,
+	"username":   true,
+	"age":        true,
+	"birthdate":  true,
+	"email":      true,
+	"locale":     true,
+	"timezone":   true,
+}
+
+// Operation is a single RFC 6902 operation.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// MergePatch converts an RFC 7386 merge patch document into a UserUpdate.
+func MergePatch(doc []byte) (models.UserUpdate, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return models.UserUpdate{}, fmt.Errorf("merge patch must be a JSON object: %w", err)
+	}
+
+	for name, value := range fields {
+		if !patchable[name] {
+			return models.UserUpdate{}, fmt.Errorf("field %s cannot be patched", name)
+		}
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			return models.UserUpdate{}, fmt.Errorf("field %s cannot be removed", name)
+		}
+	}
+	return toUpdate(fields)
+}
+
+// JSONPatch applies the RFC 6902 operations in doc to current and converts
+// the resulting changes into a UserUpdate.
+func JSONPatch(doc []byte, current *models.User) (models.UserUpdate, error) {
+	var ops []Operation
+	if err := json.Unmarshal(doc, &ops); err != nil {
+		return models.UserUpdate{}, fmt.Errorf("json patch must be an array of operations: %w", err)
+	}
+
+	data, err := json.Marshal(current)
+	if err != nil {
+		return models.UserUpdate{}, err
+	}
+	var original map[string]json.RawMessage
+	if err := json.Unmarshal(data, &original); err != nil {
+		return models.UserUpdate{}, err
+	}
+	patched := make(map[string]json.RawMessage, len(original))
+	for k, v := range original {
+		patched[k] = v
+	}
+
+	for i, op := range ops {
+		if err := apply(patched, op); err != nil {
+			return models.UserUpdate{}, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	changed := make(map[string]json.RawMessage)
+	for name, value := range patched {
+		if !bytes.Equal(original[name], value) {
+			changed[name] = value
+		}
+	}
+	return toUpdate(changed)
+}
+
+func apply(doc map[string]json.RawMessage, op Operation) error {
+	name, err := field(op.Path)
+	if err != nil {
+		return err
+	}
+
+	switch op.Op {
+	case "add", "replace":
+		if !patchable[name] {
+			return fmt.Errorf("field %s cannot be patched", name)
+		}
+		if op.Value == nil {
+			return fmt.Errorf("%s requires a value", op.Op)
+		}
+		doc[name] = op.Value
+	case "remove":
+		return fmt.Errorf("field %s cannot be removed", name)
+	case "move":
+		return fmt.Errorf("field %s cannot be removed", op.From)
+	case "copy":
+		from, err := field(op.From)
+		if err != nil {
+			return err
+		}
+		if !patchable[name] {
+			return fmt.Errorf("field %s cannot be patched", name)
+		}
+		value, ok := doc[from]
+		if !ok {
+			return fmt.Errorf("field %s does not exist", from)
+		}
+		doc[name] = value
+	case "test":
+		value, ok := doc[name]
+		if !ok || !equalJSON(value, op.Value) {
+			return fmt.Errorf("test failed for %s", op.Path)
+		}
+	default:
+		return fmt.Errorf("unsupported operation %q", op.Op)
+	}
+	return nil
+}
+
+// field resolves a JSON pointer to a top level user field.
+func field(pointer string) (string, error) {
+	if !strings.HasPrefix(pointer, "/") || strings.Count(pointer, "/") != 1 {
+		return "", fmt.Errorf("invalid path %q", pointer)
+	}
+	name := strings.NewReplacer("~1", "/", "~0", "~").Replace(pointer[1:])
+	if !models.IsUserField(name) {
+		return "", fmt.Errorf("unknown field %q", name)
+	}
+	return name, nil
+}
+
+func equalJSON(a, b json.RawMessage) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	ea, _ := json.Marshal(va)
+	eb, _ := json.Marshal(vb)
+	return bytes.Equal(ea, eb)
+}
+
+func toUpdate(fields map[string]json.RawMessage) (models.UserUpdate, error) {
+	var updates models.UserUpdate
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return updates, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&updates); err != nil {
+		return updates, err
+	}
+	return updates, nil
+}
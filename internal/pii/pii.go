@@ -0,0 +1,173 @@
+// Package pii encrypts personal data before it is stored, with AES-256-GCM
+// under versioned keys so keys can be rotated, and derives blind indexes:
+// keyed hashes that let encrypted values be looked up by equality without
+// decrypting them.
+package pii
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// prefix starts every encrypted value, followed by the key version and a
+// colon: "enc:v2:...". Values without it are stored in plaintext.
+const prefix = "enc:v"
+
+// ErrUnknownKey is returned when decrypting a value sealed with a key
+// version the keyring does not hold.
+var ErrUnknownKey = errors.New("pii: value is encrypted with an unknown key version")
+
+// Keyring holds the encryption keys by version, the version new values are
+// encrypted with, and the blind index key.
+type Keyring struct {
+	keys     map[int]cipher.AEAD
+	current  int
+	indexKey []byte
+}
+
+// New returns a keyring encrypting with the key of version current. Keys
+// must be 32 bytes; the blind index key at least 32 bytes.
+func New(keys map[int][]byte, current int, indexKey []byte) (*Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("pii: no key of version %d", current)
+	}
+	if len(indexKey) < 32 {
+		return nil, errors.New("pii: the blind index key must be at least 32 bytes")
+	}
+	k := &Keyring{keys: make(map[int]cipher.AEAD, len(keys)), current: current, indexKey: indexKey}
+	for version, key := range keys {
+		if version < 1 {
+			return nil, fmt.Errorf("pii: key version %d must be positive", version)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("pii: key of version %d must be 32 bytes", version)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if k.keys[version], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// FromEnv returns the keyring configured by PII_ENCRYPTION_KEYS, a comma
+// separated list of version:key pairs with base64 keys, encrypting with
+// PII_ENCRYPTION_KEY_VERSION (default the highest version) and indexing
+// with the base64 PII_BLIND_INDEX_KEY. It returns nil when no keys are set.
+func FromEnv() (*Keyring, error) {
+	raw := os.Getenv("PII_ENCRYPTION_KEYS")
+	if raw == "" {
+		return nil, nil
+	}
+	keys := make(map[int][]byte)
+	current := 0
+	for _, pair := range strings.Split(raw, ",") {
+		v, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		version, err := strconv.Atoi(v)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("PII_ENCRYPTION_KEYS: %q is not version:key", pair)
+		}
+		if keys[version], err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return nil, fmt.Errorf("PII_ENCRYPTION_KEYS: key of version %d: %w", version, err)
+		}
+		current = max(current, version)
+	}
+	if v := os.Getenv("PII_ENCRYPTION_KEY_VERSION"); v != "" {
+		var err error
+		if current, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("PII_ENCRYPTION_KEY_VERSION: %w", err)
+		}
+	}
+	indexKey, err := base64.StdEncoding.DecodeString(os.Getenv("PII_BLIND_INDEX_KEY"))
+	if err != nil {
+		return nil, fmt.Errorf("PII_BLIND_INDEX_KEY: %w", err)
+	}
+	return New(keys, current, indexKey)
+}
+
+// Encrypt seals plaintext with the current key.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	aead := k.keys[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + strconv.Itoa(k.current) + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value Encrypt sealed with any key of the keyring. Values
+// that are not encrypted are returned as they are.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	version, sealed, ok := split(value)
+	if !ok {
+		return value, nil
+	}
+	aead, ok := k.keys[version]
+	if !ok {
+		return "", fmt.Errorf("%w %d", ErrUnknownKey, version)
+	}
+	data, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", errors.New("pii: malformed encrypted value")
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("pii: encrypted value does not authenticate")
+	}
+	return string(plaintext), nil
+}
+
+// Current reports whether value is encrypted with the current key, so
+// that it need not be encrypted again after a rotation.
+func (k *Keyring) Current(value string) bool {
+	version, _, ok := split(value)
+	return ok && version == k.current
+}
+
+// Version is the key version new values are encrypted with.
+func (k *Keyring) Version() int {
+	return k.current
+}
+
+// BlindIndex returns the keyed hash of value as hex. Equal values have
+// equal indexes, so callers normalize values before indexing them.
+func (k *Keyring) BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Encrypted reports whether value was sealed by Encrypt.
+func Encrypted(value string) bool {
+	_, _, ok := split(value)
+	return ok
+}
+
+// split takes apart an encrypted value into its key version and sealed
+// data.
+func split(value string) (int, string, bool) {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return 0, "", false
+	}
+	v, sealed, ok := strings.Cut(rest, ":")
+	version, err := strconv.Atoi(v)
+	if !ok || err != nil {
+		return 0, "", false
+	}
+	return version, sealed, true
+}
@@ -0,0 +1,132 @@
+// Package proxy works out the address of the client behind the reverse
+// proxies and load balancers a deployment trusts, and carries it in request
+// contexts. Forwarding headers are only believed when the peer that sent
+// them is trusted, so clients cannot pick their own address.
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// Trusted holds the networks of trusted proxies. The zero value, like a nil
+// *Trusted, trusts none, so the peer address is always the client's.
+type Trusted struct {
+	prefixes []netip.Prefix
+}
+
+// Parse reads a comma separated list of trusted proxies, as addresses or
+// CIDR prefixes such as 10.0.0.0/8.
+func Parse(list string) (*Trusted, error) {
+	t := &Trusted{}
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(v)
+			if aerr != nil {
+				return nil, fmt.Errorf("%q is neither an IP address nor a CIDR prefix", v)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		t.prefixes = append(t.prefixes, prefix.Masked())
+	}
+	return t, nil
+}
+
+// FromEnv returns the proxies listed in TRUSTED_PROXIES, none unless set.
+func FromEnv() (*Trusted, error) {
+	t, err := Parse(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	return t, nil
+}
+
+func (t *Trusted) trusts(addr netip.Addr) bool {
+	if t == nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range t.prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the address of the client of r. Unless the peer is a
+// trusted proxy that is the peer itself. Otherwise X-Forwarded-For is read
+// from the right, the end the proxies appended to, and the first address
+// not belonging to a trusted proxy is the client; everything left of it was
+// sent by the client and cannot be believed. A malformed entry ends the
+// walk at the last address that parsed. X-Real-IP is used when a trusted
+// peer sends no X-Forwarded-For.
+func (t *Trusted) Resolve(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !t.trusts(peer) {
+		return host
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	if len(hops) == 0 {
+		if real, ok := parseHop(r.Header.Get("X-Real-IP")); ok {
+			return real.String()
+		}
+		return peer.Unmap().String()
+	}
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseHop(hops[i])
+		if !ok {
+			break
+		}
+		client = addr
+		if !t.trusts(addr) {
+			break
+		}
+	}
+	return client.Unmap().String()
+}
+
+// parseHop parses an entry of a forwarding header, which some proxies send
+// with a port.
+func parseHop(v string) (netip.Addr, bool) {
+	v = strings.TrimSpace(v)
+	if addr, err := netip.ParseAddr(v); err == nil {
+		return addr.Unmap(), true
+	}
+	if addrPort, err := netip.ParseAddrPort(v); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+type clientIPKey struct{}
+
+// WithClientIP returns a copy of ctx carrying the client address ip.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP returns the client address carried by ctx, "" outside of a
+// request.
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
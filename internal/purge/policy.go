@@ -0,0 +1,66 @@
+package purge
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Policy is the retention of one class of data, such as audit entries or
+// anonymized users.
+type Policy struct {
+	// Class names the data and the job purging it.
+	Class string
+	// Retention is how long the data is kept. Zero keeps it forever unless
+	// MinRetention is zero too, in which case it is purged as soon as it
+	// is due.
+	Retention time.Duration
+	// MinRetention is the shortest retention accepted, so a mistyped
+	// setting cannot wipe data that is still in use.
+	MinRetention time.Duration
+	// Purge removes, or only counts with dryRun, the data of the class
+	// older than before, removing at most limit rows when limit is
+	// positive.
+	Purge func(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error)
+}
+
+// Validate reports whether the retention is allowed.
+func (p Policy) Validate() error {
+	if p.Retention < 0 {
+		return fmt.Errorf("%s retention must not be negative", p.Class)
+	}
+	if p.Retention > 0 && p.Retention < p.MinRetention {
+		return fmt.Errorf("%s retention %s is shorter than the minimum of %s", p.Class, p.Retention, p.MinRetention)
+	}
+	return nil
+}
+
+// keepsForever reports whether the policy never purges anything.
+func (p Policy) keepsForever() bool {
+	return p.Retention == 0 && p.MinRetention > 0
+}
+
+// Job returns the job enforcing the policy.
+func (p Policy) Job() Job {
+	return Job{
+		Name: p.Class,
+		Run: func(ctx context.Context, limit int64, dryRun bool) (int64, error) {
+			return p.Purge(ctx, time.Now().Add(-p.Retention), limit, dryRun)
+		},
+	}
+}
+
+// NewScheduler validates policies and returns a scheduler with a job for
+// each of them that purges anything.
+func NewScheduler(schedule Schedule, policies []Policy) (*Scheduler, error) {
+	s := &Scheduler{Schedule: schedule}
+	for _, p := range policies {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		if !p.keepsForever() {
+			s.Jobs = append(s.Jobs, p.Job())
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,174 @@
+// Package purge periodically removes data the service no longer needs to
+// keep: anonymized users, expired tokens and old audit entries.
+package purge
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"users/internal/models"
+)
+
+var (
+	runsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "users_purge_runs_total",
+		Help: "Purge job runs by job and result.",
+	}, []string{"job", "result"})
+	rowsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "users_purge_rows_total",
+		Help: "Rows removed by purge jobs, or that would have been in dry-run mode.",
+	}, []string{"job", "dry_run"})
+	durationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "users_purge_duration_seconds",
+		Help: "Duration of purge job runs.",
+	}, []string{"job"})
+	lastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "users_purge_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful run of each purge job.",
+	}, []string{"job"})
+)
+
+// jobTimeout bounds a single job run.
+const jobTimeout = 10 * time.Minute
+
+// Job is one kind of cleanup. Run removes what is due, at most limit rows
+// when limit is positive, or only counts it when dryRun is set, and
+// returns the number of rows affected. Jobs that do not remove rows may
+// ignore limit.
+type Job struct {
+	Name string
+	Run  func(ctx context.Context, limit int64, dryRun bool) (int64, error)
+}
+
+// Scheduler runs its jobs one after another whenever Schedule fires, in
+// UTC.
+type Scheduler struct {
+	Schedule Schedule
+	Jobs     []Job
+	// DryRun makes every job only report what it would remove.
+	DryRun bool
+	// Enqueue, when set, hands the due jobs to the background workers,
+	// which call RunJob, instead of running them inline. scheduled is the
+	// time the schedule fired, which tells runs on different instances
+	// apart.
+	Enqueue func(ctx context.Context, job string, scheduled time.Time) error
+	// MaxRows, when positive, makes a job remove what is due in batches of
+	// at most that many rows, so no single statement holds locks on a
+	// large backlog for long.
+	MaxRows int64
+	// Report, when set, is given the outcome of every job run.
+	Report func(ctx context.Context, run models.PurgeRun) error
+}
+
+// Run waits for the schedule and runs the jobs until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		next := s.Schedule.Next(time.Now().UTC())
+		if next.IsZero() {
+			log.Printf("Purge schedule never fires, purging is disabled")
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			if s.Enqueue == nil {
+				s.RunOnce(ctx)
+				continue
+			}
+			for _, job := range s.Jobs {
+				if err := s.Enqueue(ctx, job.Name, next); err != nil {
+					log.Printf("Error queueing purge job %s: %v", job.Name, err)
+				}
+			}
+		}
+	}
+}
+
+// RunOnce runs every job immediately. A failing job does not keep the
+// others from running.
+func (s *Scheduler) RunOnce(ctx context.Context) {
+	for _, job := range s.Jobs {
+		s.run(ctx, job)
+	}
+}
+
+// RunJob runs the job called name immediately.
+func (s *Scheduler) RunJob(ctx context.Context, name string) error {
+	for _, job := range s.Jobs {
+		if job.Name == name {
+			return s.run(ctx, job)
+		}
+	}
+	return fmt.Errorf("unknown purge job %q", name)
+}
+
+func (s *Scheduler) run(ctx context.Context, job Job) error {
+	ctx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+
+	start := time.Now()
+	n, err := s.execute(ctx, job)
+	durationSeconds.WithLabelValues(job.Name).Observe(time.Since(start).Seconds())
+	s.report(ctx, job, start, n, err)
+	if err != nil {
+		runsTotal.WithLabelValues(job.Name, "error").Inc()
+		log.Printf("Purge job %s failed: %v", job.Name, err)
+		return err
+	}
+	runsTotal.WithLabelValues(job.Name, "success").Inc()
+	lastSuccess.WithLabelValues(job.Name).SetToCurrentTime()
+
+	if s.DryRun {
+		rowsTotal.WithLabelValues(job.Name, "true").Add(float64(n))
+		log.Printf("Purge job %s would remove %d rows (dry run)", job.Name, n)
+		return nil
+	}
+	rowsTotal.WithLabelValues(job.Name, "false").Add(float64(n))
+	log.Printf("Purge job %s removed %d rows", job.Name, n)
+	return nil
+}
+
+// execute runs job, batch after batch of MaxRows rows until a batch comes
+// up short when MaxRows is set, and returns the rows affected by all of
+// them. A run stopped by its timeout keeps what its batches removed; the
+// next run carries on.
+func (s *Scheduler) execute(ctx context.Context, job Job) (int64, error) {
+	if s.MaxRows <= 0 || s.DryRun {
+		return job.Run(ctx, 0, s.DryRun)
+	}
+	var total int64
+	for {
+		n, err := job.Run(ctx, s.MaxRows, false)
+		total += n
+		if err != nil || n < s.MaxRows {
+			return total, err
+		}
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+	}
+}
+
+func (s *Scheduler) report(ctx context.Context, job Job, start time.Time, n int64, err error) {
+	if s.Report == nil {
+		return
+	}
+	run := models.PurgeRun{Job: job.Name, DryRun: s.DryRun, Rows: n, StartedAt: start, FinishedAt: time.Now()}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	// A run that hit its timeout is still reported.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := s.Report(ctx, run); err != nil {
+		log.Printf("Error reporting purge job %s: %v", job.Name, err)
+	}
+}
@@ -0,0 +1,125 @@
+// Package redact removes personal data and secrets from what the service
+// logs: query parameters, JSON fields and email addresses.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Placeholder replaces what is redacted.
+const Placeholder = "[REDACTED]"
+
+// DefaultRules name the fields and parameters holding personal data or
+// secrets. URIs, such as the otpauth:// URI of a TOTP enrollment, carry
+// both in their labels and queries. Emails are redacted wherever they
+// appear, whatever the name.
+var DefaultRules = []string{
+	"*email*", "*name*", "*password*", "*token*", "*secret*", "*key*", "*uri*", "*url*",
+	"authorization", "birthdate", "metadata", "code", "state", "q",
+}
+
+var (
+	// emailPattern matches addresses whether or not their @ is escaped.
+	emailPattern = regexp.MustCompile(`[^\s@"/?&=,;:<>()\[\]]+(?:@|%40)[^\s@"/?&=,;:<>()\[\]]+\.[a-zA-Z]{2,}`)
+	// paramPattern finds the parameters of queries within text, such as
+	// the secret of "otpauth://totp/users?secret=...&issuer=users".
+	paramPattern = regexp.MustCompile(`([?&])([^=&#\s"?]+)=([^&#\s"]*)`)
+)
+
+// Rules decide what is redacted. A rule is a case insensitive glob such as
+// "*token*" matched against the names of fields and parameters.
+type Rules struct {
+	patterns []string
+}
+
+// New returns rules matching any of patterns.
+func New(patterns ...string) Rules {
+	r := Rules{}
+	for _, p := range patterns {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			r.patterns = append(r.patterns, p)
+		}
+	}
+	return r
+}
+
+// Matches reports whether values called name are redacted.
+func (r Rules) Matches(name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range r.patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// String redacts the email addresses in s and the values of matching
+// parameters of the URLs in it.
+func (r Rules) String(s string) string {
+	s = paramPattern.ReplaceAllStringFunc(s, func(param string) string {
+		m := paramPattern.FindStringSubmatch(param)
+		if name, err := url.QueryUnescape(m[2]); err == nil && r.Matches(name) {
+			return m[1] + m[2] + "=" + Placeholder
+		}
+		return param
+	})
+	return emailPattern.ReplaceAllString(s, Placeholder)
+}
+
+// Query returns the encoded query q with the values of matching
+// parameters redacted.
+func (r Rules) Query(q url.Values) string {
+	redacted := url.Values{}
+	for name, values := range q {
+		for _, v := range values {
+			if r.Matches(name) {
+				v = Placeholder
+			}
+			redacted.Add(name, r.String(v))
+		}
+	}
+	// Placeholders read better unescaped
+	return strings.ReplaceAll(redacted.Encode(), url.QueryEscape(Placeholder), Placeholder)
+}
+
+// JSON returns the JSON document body with the values of matching fields,
+// at any depth, redacted. A body that is not JSON is redacted whole.
+func (r Rules) JSON(body []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return []byte(Placeholder)
+	}
+	out, err := json.Marshal(r.value(doc))
+	if err != nil {
+		return []byte(Placeholder)
+	}
+	return out
+}
+
+func (r Rules) value(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for name, field := range v {
+			if r.Matches(name) {
+				v[name] = Placeholder
+			} else {
+				v[name] = r.value(field)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = r.value(item)
+		}
+	case string:
+		return r.String(v)
+	}
+	return v
+}
@@ -0,0 +1,329 @@
+// Package searchindex mirrors users into Elasticsearch or OpenSearch for
+// fuzzy, typo tolerant search. The index is a copy: Postgres stays the
+// source of truth and search results are loaded from it by ID.
+package searchindex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"users/internal/models"
+)
+
+// Consumer is the change feed consumer keeping the index up to date.
+const Consumer = "search_index"
+
+// Index is a search index reached through an alias, so it can be rebuilt
+// in a new concrete index and swapped in at once.
+type Index struct {
+	url    string
+	alias  string
+	client *http.Client
+
+	apiKey             string
+	username, password string
+
+	// ensured is set once the alias is known to exist.
+	ensured atomic.Bool
+}
+
+// FromEnv returns the index configured by SEARCH_INDEX_URL and
+// SEARCH_INDEX_NAME (default "users"), authenticated with
+// SEARCH_INDEX_API_KEY or SEARCH_INDEX_USERNAME and SEARCH_INDEX_PASSWORD.
+// It returns nil when no URL is set.
+func FromEnv() *Index {
+	url := os.Getenv("SEARCH_INDEX_URL")
+	if url == "" {
+		return nil
+	}
+	alias := os.Getenv("SEARCH_INDEX_NAME")
+	if alias == "" {
+		alias = "users"
+	}
+	return &Index{
+		url:      strings.TrimRight(url, "/"),
+		alias:    alias,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		apiKey:   os.Getenv("SEARCH_INDEX_API_KEY"),
+		username: os.Getenv("SEARCH_INDEX_USERNAME"),
+		password: os.Getenv("SEARCH_INDEX_PASSWORD"),
+	}
+}
+
+// document is what is indexed of a user.
+type document struct {
+	TenantID  string   `json:"tenant_id"`
+	FirstName string   `json:"first_name"`
+	LastName  string   `json:"last_name"`
+	Username  string   `json:"username,omitempty"`
+	Email     string   `json:"email"`
+	Status    string   `json:"status"`
+	Tags      []string `json:"tags"`
+}
+
+// properties are the fields of the index. Names and emails are matched as
+// words, emails and usernames also whole.
+var properties = map[string]any{
+	"tenant_id":  map[string]string{"type": "keyword"},
+	"first_name": map[string]string{"type": "text"},
+	"last_name":  map[string]string{"type": "text"},
+	"username":   map[string]any{"type": "text", "fields": map[string]any{"raw": map[string]string{"type": "keyword"}}},
+	"email":      map[string]any{"type": "text", "fields": map[string]any{"raw": map[string]string{"type": "keyword"}}},
+	"status":     map[string]string{"type": "keyword"},
+	"tags":       map[string]string{"type": "keyword"},
+}
+
+// create creates a concrete index, behind the alias when withAlias is set.
+func (ix *Index) create(ctx context.Context, withAlias bool) (string, error) {
+	index := fmt.Sprintf("%s-%d", ix.alias, time.Now().UnixNano())
+	definition := map[string]any{
+		"mappings": map[string]any{"dynamic": "strict", "properties": properties},
+	}
+	if withAlias {
+		definition["aliases"] = map[string]any{ix.alias: map[string]any{}}
+	}
+	body, err := json.Marshal(definition)
+	if err != nil {
+		return "", err
+	}
+	return index, ix.do(ctx, http.MethodPut, "/"+index, "application/json", bytes.NewReader(body), nil)
+}
+
+// Apply writes a batch of the change feed to the index. It may be applied
+// more than once: documents are replaced whole and deleting a missing one
+// is not an error.
+func (ix *Index) Apply(ctx context.Context, batch models.FeedBatch) error {
+	if err := ix.ensure(ctx); err != nil {
+		return err
+	}
+	return ix.bulk(ctx, ix.alias, batch.Users, batch.Deleted)
+}
+
+// bulk indexes users and deletes the documents of deleted in one request.
+func (ix *Index) bulk(ctx context.Context, index string, users []models.TenantUser, deleted []string) error {
+	if len(users) == 0 && len(deleted) == 0 {
+		return nil
+	}
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, u := range users {
+		enc.Encode(map[string]any{"index": map[string]string{"_index": index, "_id": u.ID}})
+		enc.Encode(document{
+			TenantID: u.TenantID, FirstName: u.FirstName, LastName: u.LastName, Username: u.Username,
+			Email: u.Email, Status: string(u.Status), Tags: u.Tags,
+		})
+	}
+	for _, id := range deleted {
+		enc.Encode(map[string]any{"delete": map[string]string{"_index": index, "_id": id}})
+	}
+
+	var resp struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID     string          `json:"_id"`
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := ix.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", &body, &resp); err != nil {
+		return err
+	}
+	if !resp.Errors {
+		return nil
+	}
+	for _, item := range resp.Items {
+		for action, result := range item {
+			if result.Status < 300 || (action == "delete" && result.Status == http.StatusNotFound) {
+				continue
+			}
+			return fmt.Errorf("search index: %s %s: %d %s", action, result.ID, result.Status, result.Error)
+		}
+	}
+	return nil
+}
+
+// Filter narrows down a search. Zero values are ignored.
+type Filter struct {
+	Status  models.UserStatus
+	TagsAny []string
+	TagsAll []string
+}
+
+// Search returns the IDs of the tenant's users best matching text, allowing
+// for typos, and how many match in total.
+func (ix *Index) Search(ctx context.Context, tenantID, text string, filter Filter, limit, offset int) ([]string, int64, error) {
+	filters := []any{map[string]any{"term": map[string]string{"tenant_id": tenantID}}}
+	if filter.Status != "" {
+		filters = append(filters, map[string]any{"term": map[string]string{"status": string(filter.Status)}})
+	}
+	if len(filter.TagsAny) > 0 {
+		filters = append(filters, map[string]any{"terms": map[string][]string{"tags": filter.TagsAny}})
+	}
+	for _, tag := range filter.TagsAll {
+		filters = append(filters, map[string]any{"term": map[string]string{"tags": tag}})
+	}
+	query := map[string]any{
+		"from":             offset,
+		"size":             limit,
+		"_source":          false,
+		"track_total_hits": true,
+		"query": map[string]any{
+			"bool": map[string]any{
+				"filter": filters,
+				"must": map[string]any{
+					"multi_match": map[string]any{
+						"query":     text,
+						"fields":    []string{"first_name^2", "last_name^2", "username", "email", "username.raw^3", "email.raw^3"},
+						"fuzziness": "AUTO",
+						"operator":  "and",
+					},
+				},
+			},
+		},
+	}
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var resp struct {
+		Hits struct {
+			Total struct {
+				Value int64 `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := ix.do(ctx, http.MethodPost, "/"+ix.alias+"/_search", "application/json", bytes.NewReader(body), &resp); err != nil {
+		return nil, 0, err
+	}
+	ids := make([]string, len(resp.Hits.Hits))
+	for i, hit := range resp.Hits.Hits {
+		ids[i] = hit.ID
+	}
+	return ids, resp.Hits.Total.Value, nil
+}
+
+// Rebuild fills a new concrete index with the users load yields, points
+// the alias at it and drops the indices it pointed at before. Searches
+// keep using the old index until the swap.
+func (ix *Index) Rebuild(ctx context.Context, load func(ctx context.Context, fn func([]models.TenantUser) error) error) error {
+	index, err := ix.create(ctx, false)
+	if err != nil {
+		return err
+	}
+	err = load(ctx, func(users []models.TenantUser) error {
+		return ix.bulk(ctx, index, users, nil)
+	})
+	if err != nil {
+		ix.do(ctx, http.MethodDelete, "/"+index, "", nil, nil)
+		return err
+	}
+
+	old, err := ix.aliasedIndices(ctx)
+	if err != nil {
+		return err
+	}
+	actions := []any{map[string]any{"add": map[string]string{"index": index, "alias": ix.alias}}}
+	for _, name := range old {
+		actions = append(actions, map[string]any{"remove_index": map[string]string{"index": name}})
+	}
+	body, err := json.Marshal(map[string]any{"actions": actions})
+	if err != nil {
+		return err
+	}
+	return ix.do(ctx, http.MethodPost, "/_aliases", "application/json", bytes.NewReader(body), nil)
+}
+
+// ensure creates a first concrete index behind the alias unless the alias
+// exists.
+func (ix *Index) ensure(ctx context.Context) error {
+	if ix.ensured.Load() {
+		return nil
+	}
+	old, err := ix.aliasedIndices(ctx)
+	if err != nil {
+		return err
+	}
+	if len(old) == 0 {
+		if _, err := ix.create(ctx, true); err != nil {
+			return err
+		}
+	}
+	ix.ensured.Store(true)
+	return nil
+}
+
+// aliasedIndices returns the concrete indices behind the alias.
+func (ix *Index) aliasedIndices(ctx context.Context) ([]string, error) {
+	var resp map[string]json.RawMessage
+	err := ix.do(ctx, http.MethodGet, "/_alias/"+ix.alias, "", nil, &resp)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	names := make([]string, 0, len(resp))
+	for name := range resp {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Ping checks that the cluster answers.
+func (ix *Index) Ping(ctx context.Context) error {
+	return ix.do(ctx, http.MethodGet, "/", "", nil, nil)
+}
+
+// statusError is a response with an error status.
+type statusError struct {
+	status int
+	body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("search index: %d %s", e.status, e.body)
+}
+
+func isNotFound(err error) bool {
+	se, ok := err.(*statusError)
+	return ok && se.status == http.StatusNotFound
+}
+
+func (ix *Index) do(ctx context.Context, method, path, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, ix.url+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	switch {
+	case ix.apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+ix.apiKey)
+	case ix.username != "":
+		req.SetBasicAuth(ix.username, ix.password)
+	}
+
+	resp, err := ix.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return &statusError{status: resp.StatusCode, body: strings.TrimSpace(string(msg))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
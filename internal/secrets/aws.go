@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"users/internal/awsv4"
+)
+
+// AWSSecretsManager reads credentials from an AWS Secrets Manager secret
+// holding a JSON object with username and password keys, the format RDS
+// uses for managed and rotated database secrets.
+type AWSSecretsManager struct {
+	Region          string
+	SecretID        string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Endpoint overrides the regional endpoint, for VPC endpoints and tests.
+	Endpoint string
+	Client   *http.Client
+}
+
+func (a *AWSSecretsManager) Credentials(ctx context.Context) (Credentials, error) {
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + a.Region + ".amazonaws.com/"
+	}
+	payload, err := json.Marshal(map[string]string{"SecretId": a.SecretID})
+	if err != nil {
+		return Credentials{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return Credentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	a.sign(req, payload, time.Now().UTC())
+
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Credentials{}, fmt.Errorf("secrets manager: reading %s: %s", a.SecretID, resp.Status)
+	}
+
+	var body struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Credentials{}, fmt.Errorf("secrets manager: %w", err)
+	}
+	var data secretData
+	if err := json.Unmarshal([]byte(body.SecretString), &data); err != nil {
+		return Credentials{}, fmt.Errorf("secrets manager: %s is not a JSON object: %w", a.SecretID, err)
+	}
+	if data.Password == "" {
+		return Credentials{}, fmt.Errorf("secrets manager: %s has no password", a.SecretID)
+	}
+	return Credentials{Username: data.Username, Password: data.Password}, nil
+}
+
+func (a *AWSSecretsManager) sign(req *http.Request, payload []byte, now time.Time) {
+	awsv4.Signer{
+		Region:          a.Region,
+		Service:         "secretsmanager",
+		AccessKeyID:     a.AccessKeyID,
+		SecretAccessKey: a.SecretAccessKey,
+		SessionToken:    a.SessionToken,
+	}.Sign(req, payload, now)
+}
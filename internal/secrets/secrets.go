@@ -0,0 +1,104 @@
+// Package secrets fetches database credentials from a secret store so they
+// do not have to live in plain environment variables.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Credentials are a database username and password. Expires is set for
+// leased credentials, such as those issued by Vault's database engine.
+type Credentials struct {
+	Username string
+	Password string
+	Expires  time.Time
+}
+
+// Provider fetches the current credentials.
+type Provider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// FromEnv returns the provider selected by DB_CREDENTIALS_PROVIDER, "vault"
+// or "aws", and nil when it is unset so the DB_* variables are used as is.
+func FromEnv() (Provider, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	switch kind := os.Getenv("DB_CREDENTIALS_PROVIDER"); kind {
+	case "":
+		return nil, nil
+	case "vault":
+		v := &Vault{
+			Addr:   os.Getenv("VAULT_ADDR"),
+			Token:  os.Getenv("VAULT_TOKEN"),
+			Path:   os.Getenv("DB_VAULT_PATH"),
+			Client: client,
+		}
+		if v.Addr == "" || v.Token == "" || v.Path == "" {
+			return nil, fmt.Errorf("vault credentials need VAULT_ADDR, VAULT_TOKEN and DB_VAULT_PATH")
+		}
+		return v, nil
+	case "aws":
+		region := os.Getenv("AWS_REGION")
+		if region == "" {
+			region = os.Getenv("AWS_DEFAULT_REGION")
+		}
+		a := &AWSSecretsManager{
+			Region:          region,
+			SecretID:        os.Getenv("DB_AWS_SECRET_ID"),
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			Client:          client,
+		}
+		if a.Region == "" || a.SecretID == "" || a.AccessKeyID == "" || a.SecretAccessKey == "" {
+			return nil, fmt.Errorf("aws credentials need AWS_REGION, DB_AWS_SECRET_ID, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		}
+		return a, nil
+	default:
+		return nil, fmt.Errorf("unknown DB_CREDENTIALS_PROVIDER %q", kind)
+	}
+}
+
+// Cache keeps the credentials of a provider for TTL, or until they expire
+// when that comes first, so new connections do not each hit the store.
+// Invalidate forces the next call to fetch again, which is how a rotated
+// password is picked up after authentication starts failing.
+type Cache struct {
+	Provider Provider
+	TTL      time.Duration
+
+	mu      sync.Mutex
+	current Credentials
+	fetched time.Time
+}
+
+// expiryMargin renews leased credentials before they run out.
+const expiryMargin = 30 * time.Second
+
+func (c *Cache) Credentials(ctx context.Context) (Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if !c.fetched.IsZero() && now.Sub(c.fetched) < c.TTL &&
+		(c.current.Expires.IsZero() || now.Before(c.current.Expires.Add(-expiryMargin))) {
+		return c.current, nil
+	}
+	creds, err := c.Provider.Credentials(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+	c.current, c.fetched = creds, now
+	return creds, nil
+}
+
+func (c *Cache) Invalidate() {
+	c.mu.Lock()
+	c.fetched = time.Time{}
+	c.mu.Unlock()
+}
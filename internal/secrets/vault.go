@@ -0,0 +1,71 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Vault reads credentials from a Vault secret. Path is relative to /v1/,
+// e.g. "secret/data/users-db" for a KV version 2 secret or
+// "database/creds/users" for dynamic credentials from the database engine.
+// The secret must hold username and password keys.
+type Vault struct {
+	Addr   string
+	Token  string
+	Path   string
+	Client *http.Client
+}
+
+func (v *Vault) Credentials(ctx context.Context) (Credentials, error) {
+	url := strings.TrimRight(v.Addr, "/") + "/v1/" + strings.TrimLeft(v.Path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Credentials{}, fmt.Errorf("vault: reading %s: %s", v.Path, resp.Status)
+	}
+
+	var body struct {
+		LeaseDuration int             `json:"lease_duration"`
+		Data          json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Credentials{}, fmt.Errorf("vault: %w", err)
+	}
+	// KV version 2 nests the secret one level deeper.
+	var kv2 struct {
+		Data *secretData `json:"data"`
+	}
+	var data secretData
+	if err := json.Unmarshal(body.Data, &kv2); err == nil && kv2.Data != nil {
+		data = *kv2.Data
+	} else if err := json.Unmarshal(body.Data, &data); err != nil {
+		return Credentials{}, fmt.Errorf("vault: %w", err)
+	}
+	if data.Password == "" {
+		return Credentials{}, fmt.Errorf("vault: %s has no password", v.Path)
+	}
+
+	creds := Credentials{Username: data.Username, Password: data.Password}
+	if body.LeaseDuration > 0 {
+		creds.Expires = time.Now().Add(time.Duration(body.LeaseDuration) * time.Second)
+	}
+	return creds, nil
+}
+
+type secretData struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
@@ -0,0 +1,139 @@
+// Package seed populates the database with generated users for development
+// and load testing.
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"users/internal/models"
+)
+
+// Store is the subset of the database service the seeder needs.
+type Store interface {
+	CreateUsers(ctx context.Context, users []*models.User) error
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+}
+
+type names struct {
+	first []string
+	last  []string
+}
+
+var locales = map[string]names{
+	"en": {
+		first: []string{"James", "Mary", "John", "Patricia", "Robert", "Jennifer", "Michael", "Linda", "William", "Elizabeth", "David", "Susan"},
+		last:  []string{"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Wilson", "Anderson", "Taylor", "Thomas"},
+	},
+	"de": {
+		first: []string{"Lukas", "Anna", "Leon", "Lena", "Finn", "Mia", "Jonas", "Emma", "Paul", "Hannah", "Felix", "Lea"},
+		last:  []string{"Müller", "Schmidt", "Schneider", "Fischer", "Weber", "Meyer", "Wagner", "Becker", "Schulz", "Hoffmann", "Koch", "Richter"},
+	},
+	"ru": {
+		first: []string{"Александр", "Анна", "Дмитрий", "Мария", "Максим", "Елена", "Иван", "Ольга", "Сергей", "Татьяна", "Андрей", "Наталья"},
+		last:  []string{"Иванов", "Смирнов", "Кузнецов", "Попов", "Васильев", "Петров", "Соколов", "Михайлов", "Новиков", "Фёдоров", "Морозов", "Волков"},
+	},
+}
+
+// Locales returns the supported locale codes.
+func Locales() []string {
+	codes := make([]string, 0, len(locales))
+	for code := range locales {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Options configure a seeding run.
+type Options struct {
+	Count  int
+	Seed   int64
+	Locale string
+}
+
+// Users generates opts.Count users. The same options always produce the same
+// users, including their email addresses.
+func Users(opts Options) ([]models.User, error) {
+	gen, err := NewGenerator(opts.Seed, opts.Locale)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]models.User, 0, opts.Count)
+	for i := 0; i < opts.Count; i++ {
+		users = append(users, gen.Next())
+	}
+	return users, nil
+}
+
+// Generator produces a deterministic sequence of users: generators with the
+// same seed and locale produce the same users in the same order.
+type Generator struct {
+	rnd    *rand.Rand
+	names  names
+	seed   int64
+	locale string
+	n      int
+}
+
+// NewGenerator returns a generator of users with names of locale.
+func NewGenerator(seed int64, locale string) (*Generator, error) {
+	n, ok := locales[locale]
+	if !ok {
+		return nil, fmt.Errorf("unsupported locale %q", locale)
+	}
+	return &Generator{rnd: rand.New(rand.NewSource(seed)), names: n, seed: seed, locale: locale}, nil
+}
+
+// Next returns the next user, with names, a birthdate and an email address
+// unique to the generator's seed and locale.
+func (g *Generator) Next() models.User {
+	user := models.User{
+		FirstName: g.names.first[g.rnd.Intn(len(g.names.first))],
+		LastName:  g.names.last[g.rnd.Intn(len(g.names.last))],
+		Birthdate: time.Date(1945+g.rnd.Intn(62), 1, 1+g.rnd.Intn(365), 0, 0, 0, 0, time.UTC).Format(models.DateLayout),
+		Email:     fmt.Sprintf("seed.%s.%d.%d@example.com", strings.ToLower(g.locale), g.seed, g.n),
+	}
+	g.n++
+	return user
+}
+
+// Rand returns the source of the generator's randomness, for callers
+// deriving more values from the same seed.
+func (g *Generator) Rand() *rand.Rand {
+	return g.rnd
+}
+
+// Run inserts the generated users in one bulk copy, skipping those whose
+// email already exists so repeated runs are idempotent. It returns the
+// number created.
+func Run(ctx context.Context, store Store, opts Options) (int, error) {
+	users, err := Users(opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var missing []*models.User
+	for i := range users {
+		_, err := store.GetUserByEmail(ctx, users[i].Email)
+		if err == nil {
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return 0, err
+		}
+		missing = append(missing, &users[i])
+	}
+	if len(missing) == 0 {
+		return 0, nil
+	}
+	if err := store.CreateUsers(ctx, missing); err != nil {
+		return 0, err
+	}
+	return len(missing), nil
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"users/internal/proxy"
+	"users/internal/redact"
+)
+
+// defaultAccessLogBodyBytes is how much of each body is logged with
+// ACCESS_LOG_BODIES unless ACCESS_LOG_MAX_BODY_BYTES says otherwise.
+const defaultAccessLogBodyBytes = 2048
+
+// accessLogPolicy decides what is logged of every request.
+type accessLogPolicy struct {
+	enabled bool
+	// bodies logs JSON request and response bodies up to maxBodyBytes.
+	bodies       bool
+	maxBodyBytes int
+	rules        redact.Rules
+}
+
+// accessLogPolicyFromEnv reads ACCESS_LOG ("false" turns logging off),
+// ACCESS_LOG_BODIES, ACCESS_LOG_MAX_BODY_BYTES and ACCESS_LOG_REDACT, a
+// comma separated list of field and parameter names to redact on top of
+// redact.DefaultRules.
+func accessLogPolicyFromEnv() accessLogPolicy {
+	return accessLogPolicy{
+		enabled:      os.Getenv("ACCESS_LOG") != "false",
+		bodies:       os.Getenv("ACCESS_LOG_BODIES") == "true",
+		maxBodyBytes: envInt("ACCESS_LOG_MAX_BODY_BYTES", defaultAccessLogBodyBytes),
+		rules:        redact.New(append(redact.DefaultRules, splitList(os.Getenv("ACCESS_LOG_REDACT"))...)...),
+	}
+}
+
+// logAccess logs the method, path, status, duration and sizes of every
+// request. Query parameters, path parameters and bodies go through the
+// redaction rules first, and emails are redacted wherever they appear.
+func (s *Server) logAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := s.config().accessLog
+		if !p.enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		urlPath, query := r.URL.Path, r.URL.Query()
+
+		in := &countingBody{ReadCloser: r.Body}
+		if r.Body != nil && r.Body != http.NoBody {
+			if p.bodies && isJSON(r.Header.Get("Content-Type")) {
+				in.capture = &limitedBuffer{max: p.maxBodyBytes}
+			}
+			r.Body = in
+		}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		var out *limitedBuffer
+		if p.bodies {
+			out = &limitedBuffer{max: p.maxBodyBytes}
+			ww.Tee(out)
+		}
+
+		next.ServeHTTP(ww, r)
+
+		var line strings.Builder
+		line.WriteString(r.Method + " " + p.redactPath(r, urlPath))
+		if len(query) > 0 {
+			line.WriteString("?" + p.rules.Query(query))
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		line.WriteString(" ip=" + proxy.ClientIP(r.Context()))
+		line.WriteString(" status=" + strconv.Itoa(status))
+		line.WriteString(" duration=" + time.Since(start).Round(time.Microsecond).String())
+		line.WriteString(" bytes_in=" + strconv.FormatInt(in.n, 10))
+		line.WriteString(" bytes_out=" + strconv.Itoa(ww.BytesWritten()))
+		if in.capture != nil && in.capture.Len() > 0 {
+			line.WriteString(" request_body=" + p.redactBody(in.capture))
+		}
+		if out != nil && out.Len() > 0 && isJSON(ww.Header().Get("Content-Type")) {
+			line.WriteString(" response_body=" + p.redactBody(out))
+		}
+		log.Print(line.String())
+	})
+}
+
+// redactPath redacts the path parameters matching the rules, such as a
+// username, and any email the path holds.
+func (p accessLogPolicy) redactPath(r *http.Request, urlPath string) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		segments := strings.Split(urlPath, "/")
+		for i, key := range rctx.URLParams.Keys {
+			if !p.rules.Matches(key) || i >= len(rctx.URLParams.Values) {
+				continue
+			}
+			for j, segment := range segments {
+				if segment == rctx.URLParams.Values[i] {
+					segments[j] = redact.Placeholder
+				}
+			}
+		}
+		urlPath = strings.Join(segments, "/")
+	}
+	return p.rules.String(urlPath)
+}
+
+// redactBody returns the redacted JSON of a captured body. A body cut off
+// at the limit cannot be parsed and is redacted whole.
+func (p accessLogPolicy) redactBody(b *limitedBuffer) string {
+	if b.truncated {
+		return redact.Placeholder
+	}
+	return string(p.rules.JSON(b.Bytes()))
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// countingBody counts the bytes of the request body the handler reads and
+// captures them when capture is set.
+type countingBody struct {
+	io.ReadCloser
+	n       int64
+	capture *limitedBuffer
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if b.capture != nil {
+		b.capture.Write(p[:n])
+	}
+	return n, err
+}
+
+// limitedBuffer keeps up to max bytes and notes whether more were written.
+type limitedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.max - b.Len(); n > room {
+		b.truncated = true
+		p = p[:max(room, 0)]
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+
+	"users/internal/auth"
+	"users/internal/models"
+)
+
+// requireAdmin only lets through requests bearing the ADMIN_TOKEN or an API
+// key with the admin scope. Without a token only API keys are accepted.
+// Keys act within their own tenant, so the routes behind it must only touch
+// the tenant of the request.
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.Scoped(r.Context()) {
+			if !auth.HasScope(r.Context(), models.ScopeAdmin) {
+				writeProblem(w, r, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.requireOperator(next).ServeHTTP(w, r)
+	})
+}
+
+// requireOperator only lets through requests bearing the ADMIN_TOKEN. It
+// guards what is shared by all tenants, such as webhooks, jobs, quotas and
+// the debug endpoints, which no tenant's API key may reach.
+func (s *Server) requireOperator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.Scoped(r.Context()) {
+			writeProblem(w, r, "Only the operator may use this endpoint", http.StatusForbidden)
+			return
+		}
+		if s.adminToken == "" {
+			writeProblem(w, r, "Admin API is disabled", http.StatusForbidden)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			writeProblem(w, r, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithActor(r.Context(), "admin")))
+	})
+}
+
+// audit records an action after it succeeded. Failures are logged rather
+// than reported since the action itself already took effect.
+func (s *Server) audit(r *http.Request, action, userID string, details map[string]any) {
+	entry := &models.AuditEntry{Action: action, TargetUserID: userID, Details: details}
+	if err := s.db.RecordAudit(r.Context(), entry); err != nil {
+		log.Printf("Error recording audit entry %s for user %s: %v", action, userID, err)
+	}
+}
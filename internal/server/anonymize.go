@@ -0,0 +1,33 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/database"
+	"users/internal/events"
+)
+
+func (s *Server) anonymizeUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := s.db.AnonymizeUser(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeProblem(w, r, "User not found", http.StatusNotFound)
+			return
+		}
+		if err == database.ErrAlreadyAnonymized {
+			writeError(w, r, err)
+			return
+		}
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.revokeSessions(r, user.ID)
+	s.events.Publish(events.New(r.Context(), events.UserAnonymized, user))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/auth"
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/tenant"
+	"users/internal/validator"
+)
+
+// apiKeyPrefix marks API keys so they can be told apart from other bearer
+// tokens and recognized by secret scanners.
+const apiKeyPrefix = "uk_"
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerAPIKey returns the API key presented by the request, if any.
+func bearerAPIKey(r *http.Request) (string, bool) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key, true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok && strings.HasPrefix(token, apiKeyPrefix) {
+		return token, true
+	}
+	return "", false
+}
+
+// withAPIKey authenticates requests presenting an API key. The request is
+// scoped to the key's tenant and limited to its scopes; invalid keys are
+// rejected rather than treated as anonymous.
+func (s *Server) withAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, ok := bearerAPIKey(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := s.db.GetAPIKeyByHash(r.Context(), hashAPIKey(raw))
+		if err != nil {
+			if err != sql.ErrNoRows {
+				log.Printf("Error loading API key: %v", err)
+				writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			writeProblem(w, r, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		if err := s.db.TouchAPIKey(r.Context(), key.ID); err != nil {
+			log.Printf("Error recording use of API key %s: %v", key.ID, err)
+		}
+
+		ctx := tenant.WithTenant(r.Context(), key.TenantID)
+		ctx = auth.WithActor(ctx, "apikey:"+key.ID)
+		ctx = auth.WithScopes(ctx, key.Scopes)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireScope rejects API key requests whose key lacks scope. Requests not
+// authenticated by a key are left to the other checks.
+func (s *Server) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !auth.HasScope(r.Context(), scope) {
+				writeProblem(w, r, "API key lacks scope "+scope, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (s *Server) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var key models.APIKey
+	if err := json.NewDecoder(r.Body).Decode(&key); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if err := validator.ValidateAPIKey(&key); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	key.Key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	key.Prefix = key.Key[:len(apiKeyPrefix)+8]
+
+	if err := s.db.CreateAPIKey(r.Context(), &key, hashAPIKey(key.Key)); err != nil {
+		if errors.Is(err, database.ErrQuotaExceeded) {
+			writeError(w, r, err)
+			return
+		}
+		writeProblem(w, r, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	// The key is only ever returned on creation
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+func (s *Server) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.db.ListAPIKeys(r.Context())
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+func (s *Server) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.RevokeAPIKey(r.Context(), chi.URLParam(r, "id")); err != nil {
+		if err == sql.ErrNoRows {
+			writeProblem(w, r, "API key not found", http.StatusNotFound)
+			return
+		}
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
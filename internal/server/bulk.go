@@ -0,0 +1,236 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"users/internal/database"
+	"users/internal/events"
+	"users/internal/models"
+	"users/internal/validator"
+)
+
+func (s *Server) bulkUpdateUsersHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		IDs     []string          `json:"ids"`
+		Updates models.UserUpdate `json:"updates"`
+	}
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	if len(req.IDs) == 0 {
+		writeProblem(w, r, "ids are required", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > database.MaxPageLimit {
+		writeProblem(w, r, "too many ids", http.StatusBadRequest)
+		return
+	}
+	if err := validator.ValidateUserUpdate(&req.Updates); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if dryRun {
+		result, err := s.dryRun(r.Context(), req.IDs, false, func(ctx context.Context) ([]models.User, error) {
+			results, err := s.db.UpdateUsers(ctx, req.IDs, req.Updates)
+			if err != nil {
+				return nil, err
+			}
+			var updated []models.User
+			for _, result := range results {
+				if result.User != nil {
+					updated = append(updated, *result.User)
+				}
+			}
+			return updated, nil
+		})
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeDryRun(w, result)
+		return
+	}
+	results, err := s.db.UpdateUsers(r.Context(), req.IDs, req.Updates)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	for _, result := range results {
+		if result.User != nil {
+			s.events.Publish(events.New(r.Context(), events.UserUpdated, result.User))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"results": results})
+}
+
+func (s *Server) bulkSuspendUsersHandler(w http.ResponseWriter, r *http.Request) {
+	s.bulkTransitionUsers(w, r, s.db.SuspendUser, true)
+}
+
+func (s *Server) bulkActivateUsersHandler(w http.ResponseWriter, r *http.Request) {
+	s.bulkTransitionUsers(w, r, s.db.ActivateUser, false)
+}
+
+// bulkTransitionUsers applies a status change to every user in the ids of
+// the body, one at a time, revoking the sessions of the changed users when
+// revoke is set. It reports per ID whether the user was updated, not found
+// or not updatable, being in a status the change does not apply to.
+func (s *Server) bulkTransitionUsers(w http.ResponseWriter, r *http.Request, transition func(ctx context.Context, id string) (*models.User, error), revoke bool) {
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	if len(req.IDs) == 0 {
+		writeProblem(w, r, "ids are required", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > database.MaxPageLimit {
+		writeProblem(w, r, "too many ids", http.StatusBadRequest)
+		return
+	}
+
+	results := make([]models.BulkResult, len(req.IDs))
+	for i, id := range req.IDs {
+		results[i].ID = id
+		user, err := transition(r.Context(), id)
+		switch {
+		case err == sql.ErrNoRows:
+			results[i].Status = models.BulkNotFound
+		case err == database.ErrInvalidTransition:
+			results[i].Status = models.BulkNotUpdatable
+		case err != nil:
+			writeError(w, r, err)
+			return
+		default:
+			results[i].Status, results[i].User = models.BulkUpdated, user
+			if revoke {
+				s.revokeSessions(r, id)
+			}
+			s.events.Publish(events.New(r.Context(), events.UserUpdated, user))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"results": results})
+}
+
+// bulkDeleteUsersHandler deletes the users matching the list filters in
+// the query. limit is mandatory, mode=soft anonymizes instead of deleting
+// and dry_run=true reports what would be deleted without deleting it.
+func (s *Server) bulkDeleteUsersHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseUserFilter(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil {
+		writeProblem(w, r, database.ErrBulkLimitRequired.Error(), http.StatusBadRequest)
+		return
+	}
+	var opts database.DeleteOptions
+	switch q.Get("mode") {
+	case "", "hard":
+	case "soft":
+		opts.Soft = true
+	default:
+		writeProblem(w, r, errInvalidParam("mode").Error(), http.StatusBadRequest)
+		return
+	}
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var result *database.DeleteResult
+	if dryRun {
+		err = s.db.DryRun(r.Context(), func(ctx context.Context) (err error) {
+			result, err = s.db.DeleteUsers(ctx, filter, limit, opts)
+			return err
+		})
+		if result != nil {
+			result.DryRun = true
+			result.Users = nil
+		}
+	} else {
+		result, err = s.db.DeleteUsers(r.Context(), filter, limit, opts)
+	}
+	if err == database.ErrBulkLimitExceeded {
+		writeProblem(w, r, fmt.Sprintf("%d users match, more than the limit of %d", result.Matched, limit), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	event := events.UserDeleted
+	if opts.Soft {
+		event = events.UserAnonymized
+	}
+	for i := range result.Users {
+		s.revokeSessions(r, result.Users[i].ID)
+		s.events.Publish(events.New(r.Context(), event, &result.Users[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// upsertUserHandler creates the user in the body or updates the existing
+// one with the same email, for syncing users from external systems.
+func (s *Server) upsertUserHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		models.User
+		Password string `json:"password"`
+	}
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	user := req.User
+
+	if err := validator.ValidateUser(&user); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if req.Password != "" {
+		var ok bool
+		if user.PasswordHash, ok = s.hashPassword(w, r, "password", req.Password); !ok {
+			return
+		}
+	}
+
+	created, err := s.db.UpsertUserByEmail(r.Context(), &user)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(&user))
+	if created {
+		s.events.Publish(events.New(r.Context(), events.UserCreated, &user))
+		s.sendWelcome(r, &user)
+		s.requestEmailVerification(r, &user)
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		s.events.Publish(events.New(r.Context(), events.UserUpdated, &user))
+	}
+	json.NewEncoder(w).Encode(user)
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"users/internal/config"
+	"users/internal/database"
+	"users/internal/mail"
+	"users/internal/proxy"
+	"users/internal/purge"
+	"users/internal/storage"
+	"users/internal/validator"
+)
+
+// settings are the tunables that can change while the server runs. They
+// are read as one snapshot per use and replaced as a whole on reload, so a
+// request never sees half of an old and half of a new configuration.
+type settings struct {
+	passwordPolicy validator.PasswordPolicy
+	lockout        database.LockoutPolicy
+	idempotencyTTL time.Duration
+	emailChangeTTL time.Duration
+	// passwordResetTTL is how long a password reset token stays valid.
+	passwordResetTTL time.Duration
+	totpIssuer       string
+	// impersonationTTL is how long an admin may act as a user.
+	impersonationTTL time.Duration
+	// termsVersion is the version of the terms of service users must have
+	// accepted; none when empty.
+	termsVersion string
+	// rejectUnknownFields makes user endpoints fail bodies with fields
+	// they do not know, unless a request prefers lenient handling.
+	rejectUnknownFields bool
+	// accessLog decides what is logged of each request.
+	accessLog accessLogPolicy
+}
+
+// loadSettings reads the tunables from the environment. Invalid values
+// are reported rather than replaced by defaults, which fails the server at
+// boot and keeps the running configuration on a bad reload.
+func loadSettings() (*settings, error) {
+	passwordPolicy, err := validator.PasswordPolicyFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("invalid password policy: %w", err)
+	}
+	cfg := &settings{
+		passwordPolicy: passwordPolicy,
+		lockout: database.LockoutPolicy{
+			MaxFailures: envInt("LOGIN_MAX_FAILURES", 5),
+			Window:      envDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+			Duration:    envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		},
+		idempotencyTTL:   envDuration("IDEMPOTENCY_TTL", defaultIdempotencyTTL),
+		emailChangeTTL:   envDuration("EMAIL_CHANGE_TTL", 24*time.Hour),
+		passwordResetTTL: envDuration("PASSWORD_RESET_TTL", time.Hour),
+		totpIssuer:       envOr("TOTP_ISSUER", "users"),
+		impersonationTTL: envDuration("IMPERSONATION_TTL", 15*time.Minute),
+		termsVersion:     os.Getenv("TERMS_VERSION"),
+		accessLog:        accessLogPolicyFromEnv(),
+	}
+	switch v := envOr("JSON_UNKNOWN_FIELDS", unknownFieldsIgnore); v {
+	case unknownFieldsIgnore:
+	case unknownFieldsReject:
+		cfg.rejectUnknownFields = true
+	default:
+		return nil, fmt.Errorf("invalid JSON_UNKNOWN_FIELDS %q, want %s or %s", v, unknownFieldsIgnore, unknownFieldsReject)
+	}
+	for _, key := range []string{"LOGIN_MAX_FAILURES", "ACCESS_LOG_MAX_BODY_BYTES"} {
+		if v := os.Getenv(key); v != "" {
+			if n, err := strconv.Atoi(v); err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid %s %q", key, v)
+			}
+		}
+	}
+	for _, key := range []string{"LOGIN_FAILURE_WINDOW", "LOGIN_LOCKOUT_DURATION", "IDEMPOTENCY_TTL", "EMAIL_CHANGE_TTL", "PASSWORD_RESET_TTL", "IMPERSONATION_TTL"} {
+		if v := os.Getenv(key); v != "" {
+			if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid %s %q", key, v)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// checkConfig reports every missing or invalid setting of the environment
+// at once, those of the database included, so the server fails at boot
+// with one actionable list instead of the first mistake, or a broken
+// connection string that only fails later.
+func checkConfig() error {
+	var r config.Report
+	database.CheckConfig(&r)
+
+	r.Required("PORT", "to listen on")
+	r.Port("PORT")
+	r.Port("DEBUG_PORT")
+	_, err := loadSettings()
+	r.Check(err)
+	_, err = loadFlagConfig()
+	r.Check(err)
+	_, err = mail.NewFromEnv()
+	r.Check(err)
+	_, err = proxy.FromEnv()
+	r.Check(err)
+	_, err = storage.FromEnv()
+	r.Check(err)
+	if len(os.Getenv("TERMS_VERSION")) > validator.MaxConsentVersionLength {
+		r.Addf("TERMS_VERSION must be at most %d characters", validator.MaxConsentVersionLength)
+	}
+	r.OneOf("MIGRATION_MODE", migrateCheck, migrateAuto, migrateWait)
+	for _, key := range []string{"PURGE_SCHEDULE", "GROWTH_STATS_SCHEDULE"} {
+		if spec := os.Getenv(key); spec != "" && spec != "off" {
+			if _, err := purge.ParseSchedule(spec); err != nil {
+				r.Addf("%s: %v", key, err)
+			}
+		}
+	}
+
+	r.OneOf("SESSION_STORE", "memory", "redis")
+	if os.Getenv("SESSION_STORE") == "redis" {
+		r.Required("REDIS_URL", "with SESSION_STORE=redis")
+	}
+	for _, provider := range []string{"GOOGLE", "GITHUB"} {
+		if os.Getenv("OAUTH_"+provider+"_CLIENT_ID") != "" {
+			why := "with OAUTH_" + provider + "_CLIENT_ID"
+			r.Required("OAUTH_"+provider+"_CLIENT_SECRET", why)
+			r.Required("OAUTH_REDIRECT_BASE_URL", why)
+		}
+	}
+
+	for _, key := range []string{
+		"MAX_REQUEST_BODY_BYTES", "ACCESS_LOG_MAX_BODY_BYTES", "WORKER_CONCURRENCY", "HEALTH_MAX_PENDING_JOBS",
+		"PURGE_MAX_ROWS", "TOKEN_RETENTION_HOURS", "PURGE_ANONYMIZED_AFTER_DAYS", "AUDIT_RETENTION_DAYS",
+		"TOMBSTONE_RETENTION_DAYS", "DEAD_JOB_RETENTION_DAYS", "EXPORT_CONCURRENCY",
+	} {
+		r.Int(key, 0)
+	}
+	for _, key := range []string{
+		"MIGRATION_WAIT_INTERVAL", "SESSION_TTL", "FEATURE_FLAGS_REFRESH", "ACTIVITY_FLUSH_INTERVAL",
+		"SEARCH_INDEX_SYNC_INTERVAL", "READ_MODEL_REFRESH_INTERVAL", "WORKER_POLL_INTERVAL", "CORS_MAX_AGE",
+		"HEALTH_DATABASE_TIMEOUT", "HEALTH_SESSIONS_TIMEOUT", "HEALTH_SEARCH_INDEX_TIMEOUT", "HEALTH_JOBS_TIMEOUT",
+		"EXPORT_JOB_TIMEOUT",
+	} {
+		r.Duration(key)
+	}
+	for _, key := range []string{"ACCESS_LOG", "ACCESS_LOG_BODIES", "CORS_ALLOW_CREDENTIALS", "SESSION_COOKIE_SECURE", "PURGE_DRY_RUN"} {
+		r.Bool(key)
+	}
+	_, err = corsPolicyFromEnv()
+	r.Check(err)
+	if v := os.Getenv("API_LEGACY_SUNSET"); v != "" {
+		if _, err := time.Parse(time.DateOnly, v); err != nil {
+			r.Addf("API_LEGACY_SUNSET must be a date such as 2027-04-30, got %q", v)
+		}
+	}
+	return r.Err()
+}
+
+// config returns the current settings.
+func (s *Server) config() *settings {
+	return s.settings.Load()
+}
+
+// Reload rereads .env, when there is one, and the environment and swaps in
+// the settings and the feature flag configuration if they are all valid,
+// as SIGHUP does. Everything else keeps the value it started with.
+func (s *Server) Reload() error {
+	if err := godotenv.Overload(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	cfg, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	flagConfig, err := loadFlagConfig()
+	if err != nil {
+		return err
+	}
+	s.settings.Store(cfg)
+	s.flags.SetConfig(flagConfig)
+	return nil
+}
+
+// reloadOnSignal reloads the settings on every SIGHUP until ctx is done.
+func (s *Server) reloadOnSignal(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := s.Reload(); err != nil {
+				log.Printf("Configuration reload failed, keeping the current settings: %v", err)
+				continue
+			}
+			log.Printf("Configuration reloaded")
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/models"
+	"users/internal/proxy"
+	"users/internal/session"
+	"users/internal/validator"
+)
+
+// errConsentRequired is returned for operations that need a consent the
+// user has not given, or has withdrawn.
+var errConsentRequired = errors.New("consent required")
+
+type consentRequest struct {
+	Kind    string `json:"kind"`
+	Version string `json:"version"`
+	Granted *bool  `json:"granted"`
+	// SourceIP is where a consent collected elsewhere was given; consents
+	// users record themselves are attributed to their request.
+	SourceIP string `json:"source_ip"`
+}
+
+func (s *Server) listConsentsHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeConsents(w, r, chi.URLParam(r, "id"))
+}
+
+// recordConsentHandler records a consent on behalf of a user, such as one
+// given in another application.
+func (s *Server) recordConsentHandler(w http.ResponseWriter, r *http.Request) {
+	s.recordConsent(w, r, chi.URLParam(r, "id"), false)
+}
+
+func (s *Server) listMyConsentsHandler(w http.ResponseWriter, r *http.Request) {
+	sess, _ := session.FromContext(r.Context())
+	s.writeConsents(w, r, sess.UserID)
+}
+
+func (s *Server) recordMyConsentHandler(w http.ResponseWriter, r *http.Request) {
+	sess, _ := session.FromContext(r.Context())
+	s.recordConsent(w, r, sess.UserID, true)
+}
+
+func (s *Server) writeConsents(w http.ResponseWriter, r *http.Request, userID string) {
+	consents, err := s.db.GetConsents(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(consents)
+}
+
+// recordConsent records the consent in the body for userID, from the
+// request's address when self is set. Withdrawing marketing consent also
+// unsubscribes the user from the newsletter.
+func (s *Server) recordConsent(w http.ResponseWriter, r *http.Request, userID string, self bool) {
+	var req consentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if req.Granted == nil {
+		writeProblem(w, r, "granted is required", http.StatusBadRequest)
+		return
+	}
+	consent := models.Consent{UserID: userID, Kind: req.Kind, Version: req.Version, Granted: *req.Granted, SourceIP: req.SourceIP}
+	if self || consent.SourceIP == "" {
+		consent.SourceIP = proxy.ClientIP(r.Context())
+	}
+	if err := validator.ValidateConsent(&consent); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if net.ParseIP(consent.SourceIP) == nil {
+		writeProblem(w, r, "source_ip must be an IP address", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.db.RecordConsent(r.Context(), &consent); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if consent.Kind == models.ConsentMarketing && !consent.Granted {
+		off := false
+		if _, err := s.db.UpdatePreferences(r.Context(), userID, models.PreferencesUpdate{Newsletter: &off}); err != nil {
+			log.Printf("Error unsubscribing user %s from the newsletter: %v", userID, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(consent)
+}
+
+// hasConsent reports whether the consent of kind in force for the user is
+// granted and, unless version is empty, for version.
+func (s *Server) hasConsent(ctx context.Context, userID, kind, version string) (bool, error) {
+	consents, err := s.db.GetConsents(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	latest := models.LatestConsent(consents, kind)
+	return latest != nil && latest.Granted && (version == "" || latest.Version == version), nil
+}
+
+// requireConsent turns away the requests of users who have not accepted
+// TERMS_VERSION of the terms of service, when it is set, until they do.
+func (s *Server) requireConsent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version := s.config().termsVersion
+		if version == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sess, _ := session.FromContext(r.Context())
+		ok, err := s.hasConsent(r.Context(), sess.UserID, models.ConsentTerms, version)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if !ok {
+			writeError(w, r, fmt.Errorf("%w: accept version %s of the terms of service first", errConsentRequired, version))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
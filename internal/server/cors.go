@@ -0,0 +1,93 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsPolicy decides which browser origins may call the API.
+type corsPolicy struct {
+	origins     []string
+	methods     string
+	headers     string
+	expose      string
+	credentials bool
+	maxAge      time.Duration
+}
+
+// corsPolicyFromEnv reads CORS_ALLOWED_ORIGINS, a comma separated list of
+// origins or "*", and the optional CORS_ALLOWED_METHODS,
+// CORS_ALLOWED_HEADERS, CORS_ALLOW_CREDENTIALS and CORS_MAX_AGE. Without
+// origins CORS stays disabled. Credentials cannot be allowed for any
+// origin: echoing every origin with them would let every site act with the
+// session of whoever visits it.
+func corsPolicyFromEnv() (corsPolicy, error) {
+	p := corsPolicy{
+		origins:     splitList(os.Getenv("CORS_ALLOWED_ORIGINS")),
+		methods:     envOr("CORS_ALLOWED_METHODS", "GET, POST, PATCH, DELETE"),
+		headers:     envOr("CORS_ALLOWED_HEADERS", "Authorization, Content-Type, If-Match, If-None-Match, If-Modified-Since, Prefer, "+idempotencyKeyHeader+", "+tenantHeader+", X-API-Key"),
+		expose:      "ETag, Last-Modified, Retry-After, Idempotent-Replayed, Link, X-Total-Count, " + duplicatesHeader,
+		credentials: os.Getenv("CORS_ALLOW_CREDENTIALS") == "true",
+		maxAge:      envDuration("CORS_MAX_AGE", 10*time.Minute),
+	}
+	if p.credentials && slices.Contains(p.origins, "*") {
+		return corsPolicy{}, errors.New("CORS_ALLOW_CREDENTIALS=true cannot be combined with CORS_ALLOWED_ORIGINS=*; list the allowed origins")
+	}
+	return p, nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func (p corsPolicy) allows(origin string) bool {
+	return slices.Contains(p.origins, "*") || slices.Contains(p.origins, origin)
+}
+
+// withCORS adds the CORS headers for allowed origins and answers preflight
+// requests itself, before they reach authentication.
+func (s *Server) withCORS(next http.Handler) http.Handler {
+	p := s.cors
+	if len(p.origins) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !p.allows(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The request's origin is echoed rather than "*", which browsers
+		// refuse along with credentials; corsPolicyFromEnv keeps a
+		// wildcard from being combined with them.
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if p.credentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", p.methods)
+			w.Header().Set("Access-Control-Allow-Headers", p.headers)
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Access-Control-Expose-Headers", p.expose)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"users/internal/database"
+)
+
+// startTime is reported by /debug/stats as the process uptime.
+var startTime = time.Now()
+
+// debugRoutes serves the profiling and diagnostics endpoints. They are
+// only mounted on DEBUG_PORT, which should not be exposed publicly, and
+// require the ADMIN_TOKEN; API keys are refused. /metrics is served there
+// too, to scrapers without credentials unless METRICS_TOKEN is set.
+func (s *Server) debugRoutes() http.Handler {
+	r := chi.NewRouter()
+	r.Handle("/metrics", s.metricsHandler())
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.withTenant)
+		r.Use(s.withAPIKey)
+		r.Use(s.requireOperator)
+
+		r.Get("/debug/stats", s.debugStatsHandler)
+		r.Handle("/debug/vars", expvar.Handler())
+		r.HandleFunc("/debug/pprof/", pprof.Index)
+		r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		r.Handle("/debug/pprof/{profile}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pprof.Handler(chi.URLParam(r, "profile")).ServeHTTP(w, r)
+		}))
+	})
+	return r
+}
+
+// metricsHandler serves the Prometheus metrics to requests that send
+// METRICS_TOKEN as a bearer token, or to any request when it is not set.
+// The public listener only serves them with a token; without one they are
+// left to the debug listener.
+func (s *Server) metricsHandler() http.Handler {
+	metrics := promhttp.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.metricsToken != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.metricsToken)) != 1 {
+				writeProblem(w, r, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		metrics.ServeHTTP(w, r)
+	})
+}
+
+// serveDebug listens on port for the debug routes. CPU profiles and traces
+// run for as long as asked, so there is no write timeout.
+func (s *Server) serveDebug(port int) {
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           s.debugRoutes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("Serving debug endpoints on %s", srv.Addr)
+	if err := srv.ListenAndServe(); err != nil {
+		log.Printf("Debug server stopped: %v", err)
+	}
+}
+
+type debugStats struct {
+	UptimeSeconds float64                  `json:"uptime_seconds"`
+	GoVersion     string                   `json:"go_version"`
+	Goroutines    int                      `json:"goroutines"`
+	CPUs          int                      `json:"cpus"`
+	Heap          heapStats                `json:"heap"`
+	GC            gcStats                  `json:"gc"`
+	Pool          *database.PoolHealth     `json:"pool,omitempty"`
+	Replicas      []database.ReplicaHealth `json:"replicas,omitempty"`
+}
+
+type heapStats struct {
+	AllocBytes    uint64 `json:"alloc_bytes"`
+	SysBytes      uint64 `json:"sys_bytes"`
+	IdleBytes     uint64 `json:"idle_bytes"`
+	ReleasedBytes uint64 `json:"released_bytes"`
+	Objects       uint64 `json:"objects"`
+}
+
+type gcStats struct {
+	Runs          uint32  `json:"runs"`
+	PauseTotalMS  float64 `json:"pause_total_ms"`
+	LastPauseMS   float64 `json:"last_pause_ms"`
+	NextTargetMiB float64 `json:"next_target_mib"`
+}
+
+// debugStatsHandler returns a snapshot of the runtime and the database
+// pools.
+func (s *Server) debugStatsHandler(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	health := s.db.Health()
+
+	stats := debugStats{
+		UptimeSeconds: time.Since(startTime).Seconds(),
+		GoVersion:     runtime.Version(),
+		Goroutines:    runtime.NumGoroutine(),
+		CPUs:          runtime.NumCPU(),
+		Heap: heapStats{
+			AllocBytes:    mem.HeapAlloc,
+			SysBytes:      mem.HeapSys,
+			IdleBytes:     mem.HeapIdle,
+			ReleasedBytes: mem.HeapReleased,
+			Objects:       mem.HeapObjects,
+		},
+		GC: gcStats{
+			Runs:          mem.NumGC,
+			PauseTotalMS:  float64(mem.PauseTotalNs) / 1e6,
+			LastPauseMS:   float64(mem.PauseNs[(mem.NumGC+255)%256]) / 1e6,
+			NextTargetMiB: float64(mem.NextGC) / (1 << 20),
+		},
+		Pool:     health.Pool,
+		Replicas: health.Replicas,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
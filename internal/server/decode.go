@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"users/internal/jsonfields"
+	"users/internal/validator"
+)
+
+const (
+	unknownFieldsIgnore = "ignore"
+	unknownFieldsReject = "reject"
+)
+
+// strictDecoding reports whether the body of r may only hold fields the
+// endpoint knows. A Prefer header asking for handling=strict or
+// handling=lenient (RFC 7240) decides for its request; otherwise
+// JSON_UNKNOWN_FIELDS does. applied is the preference honored, if any.
+func (s *Server) strictDecoding(r *http.Request) (strict bool, applied string) {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			pref, _, _ = strings.Cut(pref, ";")
+			name, value, _ := strings.Cut(strings.TrimSpace(pref), "=")
+			if !strings.EqualFold(strings.TrimSpace(name), "handling") {
+				continue
+			}
+			switch value = strings.Trim(strings.TrimSpace(value), `"`); strings.ToLower(value) {
+			case "strict":
+				return true, "handling=strict"
+			case "lenient":
+				return false, "handling=lenient"
+			}
+		}
+	}
+	return s.config().rejectUnknownFields, ""
+}
+
+// decodeJSON decodes the JSON body of a user endpoint into v. Under strict
+// decoding, fields v has no place for fail the request with a validation
+// error naming every one of them, so typos such as "frist_name" do not go
+// unnoticed; otherwise they are ignored. It writes the error response
+// itself and reports whether decoding succeeded.
+func (s *Server) decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	strict, applied := s.strictDecoding(r)
+	if applied != "" {
+		w.Header().Set("Preference-Applied", applied)
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return false
+	}
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(v); err != nil {
+		writeBodyError(w, r, err)
+		return false
+	}
+	if !strict {
+		return true
+	}
+	if unknown := jsonfields.Unknown(body, v); len(unknown) > 0 {
+		errs := make(validator.Errors, len(unknown))
+		for i, field := range unknown {
+			errs[i] = validator.ValidationError{
+				Field:   field,
+				Code:    validator.CodeFieldUnknown,
+				Message: fmt.Sprintf("unknown field %s", field),
+			}
+		}
+		writeError(w, r, errs)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"users/internal/models"
+)
+
+// dryRunResult reports what a request sent with dry_run=true would have
+// done. None of it was persisted.
+type dryRunResult struct {
+	DryRun   bool         `json:"dry_run"`
+	Affected int          `json:"affected"`
+	Changes  []userChange `json:"changes"`
+}
+
+// userChange is what a request would change of a user: the fields that
+// would differ, or that the user would be deleted.
+type userChange struct {
+	ID      string                 `json:"id"`
+	Deleted bool                   `json:"deleted,omitempty"`
+	Fields  map[string]fieldChange `json:"fields,omitempty"`
+}
+
+// fieldChange holds a field's value before and after, null when unset.
+type fieldChange struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+// bookkeepingFields change with every write and are left out of diffs.
+var bookkeepingFields = []string{"version", "updated_at"}
+
+// parseDryRun reads the dry_run query parameter.
+func parseDryRun(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("dry_run")
+	if v == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errInvalidParam("dry_run")
+	}
+	return dryRun, nil
+}
+
+// dryRun runs op within a dry run and reports what it changes of the users
+// with ids. op returns the users it changed as they are afterwards, or
+// the users it deleted when deletes is set. op's errors are returned as
+// they are.
+func (s *Server) dryRun(ctx context.Context, ids []string, deletes bool, op func(ctx context.Context) ([]models.User, error)) (*dryRunResult, error) {
+	result := &dryRunResult{DryRun: true, Changes: []userChange{}}
+	err := s.db.DryRun(ctx, func(ctx context.Context) error {
+		var before []models.User
+		if !deletes {
+			var err error
+			if before, err = s.db.GetUsersByIDs(ctx, ids); err != nil {
+				return err
+			}
+		}
+		after, err := op(ctx)
+		if err != nil {
+			return err
+		}
+		for i := range after {
+			change := userChange{ID: after[i].ID, Deleted: deletes}
+			if !deletes {
+				j := slices.IndexFunc(before, func(u models.User) bool { return u.ID == after[i].ID })
+				if j < 0 {
+					continue
+				}
+				change.Fields = diffUser(&before[j], &after[i])
+			}
+			result.Changes = append(result.Changes, change)
+		}
+		result.Affected = len(result.Changes)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// diffUser returns the fields whose values differ between before and
+// after, bookkeeping aside.
+func diffUser(before, after *models.User) map[string]fieldChange {
+	from, to := jsonFields(before), jsonFields(after)
+	changes := map[string]fieldChange{}
+	for name := range to {
+		if _, ok := from[name]; !ok {
+			from[name] = nil
+		}
+	}
+	for name, value := range from {
+		if !bytes.Equal(value, to[name]) && !slices.Contains(bookkeepingFields, name) {
+			changes[name] = fieldChange{From: value, To: to[name]}
+		}
+	}
+	return changes
+}
+
+// jsonFields returns the fields of v as the API renders them.
+func jsonFields(v any) map[string]json.RawMessage {
+	fields := map[string]json.RawMessage{}
+	data, err := json.Marshal(v)
+	if err == nil {
+		_ = json.Unmarshal(data, &fields)
+	}
+	return fields
+}
+
+func writeDryRun(w http.ResponseWriter, result *dryRunResult) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/events"
+	"users/internal/flags"
+	"users/internal/models"
+)
+
+// duplicatesHeader names the potential duplicates of a user just created
+// when the duplicate_warnings flag is on.
+const duplicatesHeader = "X-Potential-Duplicates"
+
+// userDuplicatesHandler lists users that may be the same person, for
+// support to merge.
+func (s *Server) userDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := s.db.GetUserByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	candidates, err := s.db.FindPotentialDuplicates(r.Context(), user)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(candidates)
+}
+
+// warnDuplicates sets the duplicates header for a new user. The user is
+// created either way, so a failed lookup is only logged.
+func (s *Server) warnDuplicates(w http.ResponseWriter, r *http.Request, user *models.User) {
+	if !flags.Enabled(r.Context(), flags.DuplicateWarnings) {
+		return
+	}
+	candidates, err := s.db.FindPotentialDuplicates(r.Context(), user)
+	if err != nil {
+		log.Printf("Error looking for duplicates of user %s: %v", user.ID, err)
+		return
+	}
+	if len(candidates) == 0 {
+		return
+	}
+	ids := make([]string, len(candidates))
+	for i, c := range candidates {
+		ids[i] = c.User.ID
+	}
+	w.Header().Set(duplicatesHeader, strings.Join(ids, ", "))
+}
+
+type mergeRequest struct {
+	DuplicateID string `json:"duplicate_id"`
+}
+
+// mergeUsersHandler merges the duplicate named in the body into the user
+// in the URL and returns the updated user.
+func (s *Server) mergeUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var req mergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if req.DuplicateID == "" {
+		writeProblem(w, r, "duplicate_id is required", http.StatusBadRequest)
+		return
+	}
+
+	primary, err := s.db.MergeUsers(r.Context(), chi.URLParam(r, "id"), req.DuplicateID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.revokeSessions(r, req.DuplicateID)
+	s.events.Publish(events.New(r.Context(), events.UserUpdated, primary))
+	if duplicate, err := s.db.GetUserByID(r.Context(), req.DuplicateID); err == nil {
+		s.events.Publish(events.New(r.Context(), events.UserMerged, duplicate))
+	} else {
+		log.Printf("Error loading merged user %s: %v", req.DuplicateID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(primary))
+	json.NewEncoder(w).Encode(primary)
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"users/internal/database"
+	"users/internal/events"
+	"users/internal/flags"
+	"users/internal/mail"
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// newToken returns a random token for links sent by mail. Only its hash
+// is stored.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// requestEmailConfirmation queues a mail with a confirmation token for the
+// user's pending email. Failures are logged; the user can ask for a new
+// token by submitting the email again.
+func (s *Server) requestEmailConfirmation(r *http.Request, user *models.User) {
+	if err := s.queueMail(r, mail.TemplateEmailChange, user.ID); err != nil {
+		log.Printf("Error queueing email confirmation for user %s: %v", user.ID, err)
+	}
+}
+
+// requestEmailVerification queues a mail with a verification token for a
+// user created pending while the tenant requires email verification.
+// Failures are logged; the user can ask for another token at /email/verify.
+func (s *Server) requestEmailVerification(r *http.Request, user *models.User) {
+	if user.Status != models.StatusPending || !flags.Enabled(r.Context(), flags.EmailVerificationRequired) {
+		return
+	}
+	if err := s.queueMail(r, mail.TemplateEmailVerification, user.ID); err != nil {
+		log.Printf("Error queueing email verification for user %s: %v", user.ID, err)
+	}
+}
+
+// requestEmailVerificationHandler mails a new verification token to the
+// pending user with the given email. It always answers 202 so the response
+// does not reveal whether an account exists.
+func (s *Server) requestEmailVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if req.Email == "" {
+		writeProblem(w, r, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.GetUserByEmail(r.Context(), req.Email)
+	if err != nil && err != sql.ErrNoRows {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		s.requestEmailVerification(r, user)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// mailJob is the payload of a mail job. It only names the template and
+// the user: the worker issues any token and renders the mail when it
+// runs, so neither tokens nor addresses are stored in the queue.
+type mailJob struct {
+	Template string `json:"template"`
+	UserID   string `json:"user_id"`
+}
+
+// queueMail leaves sending template to the user to the background
+// workers, so a slow mail provider never holds up a request.
+func (s *Server) queueMail(r *http.Request, template, userID string) error {
+	return s.jobs.Enqueue(r.Context(), jobSendUserMail, mailJob{Template: template, UserID: userID})
+}
+
+// sendUserMail runs a mail job. Nothing is sent to a user deleted since,
+// nor for an email change confirmed or cancelled since, nor to verify a
+// user no longer pending. A token is issued
+// on every attempt, so only the one sent last can be used.
+func (s *Server) sendUserMail(ctx context.Context, job models.Job) error {
+	var payload mailJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+	user, err := s.db.GetUserByID(ctx, payload.UserID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	to, data := user.Email, any(user)
+	switch payload.Template {
+	case mail.TemplateEmailChange:
+		if user.PendingEmail == "" {
+			return nil
+		}
+		to = user.PendingEmail
+		data, err = s.issueToken(ctx, user, s.config().emailChangeTTL, s.emailConfirmURL, s.db.IssueEmailConfirmation)
+	case mail.TemplateEmailVerification:
+		data, err = s.issueToken(ctx, user, s.config().emailChangeTTL, s.emailConfirmURL, s.db.IssueEmailVerification)
+	case mail.TemplatePasswordReset:
+		data, err = s.issueToken(ctx, user, s.config().passwordResetTTL, s.passwordResetURL, s.db.IssuePasswordReset)
+	}
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	t, err := s.notificationTemplate(ctx, payload.Template, user.Locale)
+	if err != nil {
+		return err
+	}
+	msg, err := t.Render(to, data)
+	if err != nil {
+		return err
+	}
+	return s.mail.Send(ctx, msg)
+}
+
+// issueToken stores the hash of a new token for user with issue, valid
+// for ttl, and returns the data of the mail carrying it, linked from link
+// when that is set.
+func (s *Server) issueToken(ctx context.Context, user *models.User, ttl time.Duration, link string,
+	issue func(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error) (mail.TokenData, error) {
+	token, err := newToken()
+	if err != nil {
+		return mail.TokenData{}, err
+	}
+	expiresAt := time.Now().Add(ttl)
+	if err := issue(ctx, user.ID, hashToken(token), expiresAt); err != nil {
+		return mail.TokenData{}, err
+	}
+
+	data := mail.TokenData{Token: token, ExpiresAt: expiresAt.In(user.Location())}
+	if link != "" {
+		data.Link = link + "?" + url.Values{"token": {token}, "tenant": {tenant.FromContext(ctx)}}.Encode()
+	}
+	return data, nil
+}
+
+// sendWelcome queues the welcome mail for a new user when the tenant has
+// the welcome_email flag enabled.
+func (s *Server) sendWelcome(r *http.Request, user *models.User) {
+	if !flags.Enabled(r.Context(), flags.WelcomeEmail) {
+		return
+	}
+	if err := s.queueMail(r, mail.TemplateWelcome, user.ID); err != nil {
+		log.Printf("Error queueing welcome email for user %s: %v", user.ID, err)
+	}
+}
+
+// emailInUse reports whether another user than userID holds email.
+func (s *Server) emailInUse(r *http.Request, userID, email string) (bool, error) {
+	other, err := s.db.GetUserByEmail(r.Context(), email)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return other.ID != userID, nil
+}
+
+func (s *Server) confirmEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if req.Token == "" {
+		writeProblem(w, r, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.ConfirmEmailChange(r.Context(), hashToken(req.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeProblem(w, r, "Invalid or expired token", http.StatusNotFound)
+			return
+		}
+		if err == database.ErrEmailTaken {
+			writeError(w, r, err)
+			return
+		}
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.events.Publish(events.New(r.Context(), events.UserUpdated, user))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(user))
+	json.NewEncoder(w).Encode(user)
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"users/internal/models"
+)
+
+var errInvalidIfMatch = errors.New("invalid If-Match header")
+
+// etag returns the weak entity tag of the user's current version. A user
+// rendered with only some fields is a representation of its own, so the
+// tag of each set of fields also names the set.
+func etag(user *models.User, fields ...string) string {
+	if len(fields) == 0 {
+		return fmt.Sprintf(`W/"%d"`, user.Version)
+	}
+	set := slices.Clone(fields)
+	slices.Sort(set)
+	set = slices.Compact(set)
+	h := fnv.New32a()
+	h.Write([]byte(strings.Join(set, ",")))
+	return fmt.Sprintf(`W/"%d-%08x"`, user.Version, h.Sum32())
+}
+
+// parseIfMatch returns the version named by an If-Match header, which may
+// be the tag of a set of fields too. A nil version means the header was
+// "*" and any version matches.
+func parseIfMatch(header string) (*int, error) {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return nil, nil
+	}
+
+	// Only a single tag is meaningful since a user has exactly one version
+	tag := strings.TrimPrefix(header, "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return nil, errInvalidIfMatch
+	}
+	number, _, _ := strings.Cut(tag[1:len(tag)-1], "-")
+	version, err := strconv.Atoi(number)
+	if err != nil {
+		return nil, errInvalidIfMatch
+	}
+	return &version, nil
+}
+
+// notModified sets the caching headers of a read of user, rendered with
+// fields or in full without any, and reports whether the copy the client
+// already holds, named by If-None-Match or, without it, If-Modified-Since,
+// is still current. In that case it has answered 304 Not Modified and the
+// caller writes nothing more.
+func notModified(w http.ResponseWriter, r *http.Request, user *models.User, fields ...string) bool {
+	tag := etag(user, fields...)
+	// Clients may keep the user but must check back before using it
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", tag)
+	if !user.UpdatedAt.IsZero() {
+		w.Header().Set("Last-Modified", user.UpdatedAt.UTC().Format(http.TimeFormat))
+	}
+
+	fresh := false
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		fresh = etagListMatches(header, tag)
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !user.UpdatedAt.IsZero() {
+		// Last-Modified has whole seconds only
+		fresh = !user.UpdatedAt.Truncate(time.Second).After(since)
+	}
+	if fresh {
+		w.WriteHeader(http.StatusNotModified)
+	}
+	return fresh
+}
+
+// etagListMatches reports whether an If-None-Match header names tag,
+// comparing weakly as RFC 9110 requires for that header.
+func etagListMatches(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(tag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,403 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/auth"
+	"users/internal/database"
+	"users/internal/flags"
+	"users/internal/models"
+	"users/internal/storage"
+	"users/internal/tenant"
+	"users/internal/worker"
+)
+
+const jobExportUsers = "users.export"
+
+// exportProgressEvery is how many users an export writes between progress
+// updates.
+const exportProgressEvery = 1000
+
+// errExportNotReady is returned when downloading an export that has not
+// finished.
+var errExportNotReady = errors.New("export has not finished")
+
+// exportFilterParams are the query parameters of GET /users an export
+// filter may hold, besides metadata.<key>.
+var exportFilterParams = []string{"email", "username", "status", "inactive_days", "created_after", "created_before", "tags_any", "tags_all"}
+
+// newExportPool returns the workers running exports. They are kept apart
+// from the other background jobs, whose short lease an export of millions
+// of users would outlive: EXPORT_JOB_TIMEOUT (default 1h) bounds one
+// export and EXPORT_CONCURRENCY (default 1) how many run at once.
+func (s *Server) newExportPool() *worker.Pool {
+	pool := worker.NewPool(s.db)
+	pool.Concurrency = max(envInt("EXPORT_CONCURRENCY", 1), 1)
+	pool.PollInterval = envDuration("WORKER_POLL_INTERVAL", pool.PollInterval)
+	pool.Lease = envDuration("EXPORT_JOB_TIMEOUT", time.Hour)
+	pool.Register(jobExportUsers, s.runExport)
+	return pool
+}
+
+// RunExports runs export jobs until ctx is done. NewServer runs it with
+// the rest of the background work; callers of New run it themselves.
+func (s *Server) RunExports(ctx context.Context) {
+	s.exports.Run(flags.NewContext(ctx, s.flags))
+}
+
+// runExport writes the users of an export job to a temporary file, then
+// stores it. Progress is recorded as it goes. Failures are retried; the
+// export is marked failed once the job runs out of attempts. An export
+// deleted while it runs stops at its next progress update.
+func (s *Server) runExport(ctx context.Context, job models.Job) error {
+	var payload struct {
+		ExportID int64 `json:"export_id"`
+	}
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+	export, err := s.db.GetExportJob(ctx, payload.ExportID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if export.Status == models.ExportDone || export.Status == models.ExportFailed {
+		return nil
+	}
+
+	err = s.writeExport(ctx, export)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil && job.Attempts >= job.MaxAttempts {
+		export.Status = models.ExportFailed
+		export.Error = err.Error()
+		if uerr := s.db.UpdateExportJob(context.WithoutCancel(ctx), export); uerr != nil {
+			log.Printf("Error marking export %d failed: %v", export.ID, uerr)
+		}
+	}
+	return err
+}
+
+func (s *Server) writeExport(ctx context.Context, export *models.ExportJob) error {
+	filter, err := exportFilter(export.Filter)
+	if err != nil {
+		return err
+	}
+	total, err := s.db.CountUsers(ctx, filter)
+	if err != nil {
+		return err
+	}
+	export.Status = models.ExportRunning
+	export.Total, export.Exported, export.Error = total, 0, ""
+	if err := s.db.UpdateExportJob(ctx, export); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp("", "users-export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	buf := bufio.NewWriter(f)
+	write, flush := exportWriter(buf, export.Format)
+	err = s.db.EachUser(ctx, filter, func(u models.User) error {
+		if err := write(u); err != nil {
+			return err
+		}
+		export.Exported++
+		if export.Exported%exportProgressEvery == 0 {
+			return s.db.UpdateExportJob(ctx, export)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("exports/%s/%d.%s", tenant.FromContext(ctx), export.ID, export.Format)
+	if err := s.exportStore.Put(ctx, key, f, size); err != nil {
+		return err
+	}
+	export.Status = models.ExportDone
+	export.StorageKey, export.Size = key, size
+	err = s.db.UpdateExportJob(ctx, export)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Deleted while uploading
+		s.exportStore.Delete(ctx, key)
+	}
+	return err
+}
+
+// exportFilter turns the filter an export was started with into the list
+// filter it stands for, rejecting parameters GET /users does not know, so a
+// typo does not export every user.
+func exportFilter(params map[string]string) (database.UserFilter, error) {
+	q := url.Values{}
+	for name, v := range params {
+		if !strings.HasPrefix(name, "metadata.") && !slices.Contains(exportFilterParams, name) {
+			return database.UserFilter{}, errInvalidParam(name)
+		}
+		q.Set(name, v)
+	}
+	return userFilterFromQuery(q)
+}
+
+// exportWriter returns functions writing users in format to w and
+// finishing the file.
+func exportWriter(w io.Writer, format string) (write func(models.User) error, flush func() error) {
+	if format == models.ExportNDJSON {
+		enc := json.NewEncoder(w)
+		return func(u models.User) error { return enc.Encode(u) }, func() error { return nil }
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(userCSVHeader)
+	write = func(u models.User) error { return cw.Write(userCSVRecord(u)) }
+	flush = func() error {
+		cw.Flush()
+		return cw.Error()
+	}
+	return write, flush
+}
+
+var userCSVHeader = []string{
+	"id", "first_name", "last_name", "username", "email", "pending_email", "age", "birthdate", "locale", "timezone",
+	"tags", "status", "created", "updated_at", "version", "merged_into", "anonymized_at", "last_login_at", "last_seen_at",
+}
+
+// userCSVRecord renders u as a CSV row. Tags are joined by commas, times
+// written as RFC 3339.
+func userCSVRecord(u models.User) []string {
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		u.ID,
+		csvSafe(u.FirstName),
+		csvSafe(u.LastName),
+		csvSafe(u.Username),
+		csvSafe(u.Email),
+		csvSafe(u.PendingEmail),
+		strconv.FormatUint(uint64(u.Age), 10),
+		u.Birthdate,
+		u.Locale,
+		u.Timezone,
+		csvSafe(strings.Join(u.Tags, ",")),
+		string(u.Status),
+		formatTime(&u.Created),
+		formatTime(&u.UpdatedAt),
+		strconv.Itoa(u.Version),
+		u.MergedInto,
+		formatTime(u.AnonymizedAt),
+		formatTime(u.LastLoginAt),
+		formatTime(u.LastSeenAt),
+	}
+}
+
+// exportsPath is where exports are served. Links point to v1 whatever
+// path the request came through, so clients move off the legacy paths.
+const exportsPath = "/api/v1/admin/exports"
+
+// withDownloadURL sets the download URL of finished exports.
+func withDownloadURL(export *models.ExportJob) *models.ExportJob {
+	if export.Status == models.ExportDone {
+		export.DownloadURL = fmt.Sprintf("%s/%d/download", exportsPath, export.ID)
+	}
+	return export
+}
+
+func parseExportID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeProblem(w, r, "invalid export id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// createExportHandler starts exporting the users matching a filter and
+// answers 202 with the job to poll.
+func (s *Server) createExportHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Format string            `json:"format"`
+		Filter map[string]string `json:"filter"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if req.Format == "" {
+		req.Format = models.ExportCSV
+	}
+	if req.Format != models.ExportCSV && req.Format != models.ExportNDJSON {
+		writeProblem(w, r, "format must be csv or ndjson", http.StatusBadRequest)
+		return
+	}
+	if _, err := exportFilter(req.Filter); err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	export := &models.ExportJob{Format: req.Format, Filter: req.Filter, CreatedBy: auth.ActorFromContext(r.Context())}
+	if err := s.db.CreateExportJob(r.Context(), export); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	err := s.exports.EnqueueJob(r.Context(), &models.Job{
+		Kind: jobExportUsers,
+		Key:  fmt.Sprintf("export:%d", export.ID),
+	}, map[string]int64{"export_id": export.ID})
+	if err != nil {
+		export.Status, export.Error = models.ExportFailed, "could not be queued"
+		s.db.UpdateExportJob(r.Context(), export)
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("%s/%d", exportsPath, export.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(export)
+}
+
+func (s *Server) listExportsHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	exports, err := s.db.ListExportJobs(r.Context(), page)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	total, err := s.db.CountExportJobs(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	for i := range exports {
+		withDownloadURL(&exports[i])
+	}
+	writePage(w, r, exports, total, page.Normalize())
+}
+
+// getExportHandler reports the status and progress of an export, with the
+// URL to download it from once it is done.
+func (s *Server) getExportHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseExportID(w, r)
+	if !ok {
+		return
+	}
+	export, err := s.db.GetExportJob(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(withDownloadURL(export))
+}
+
+// downloadExportHandler streams the file of a finished export from
+// storage.
+func (s *Server) downloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseExportID(w, r)
+	if !ok {
+		return
+	}
+	export, err := s.db.GetExportJob(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if export.Status != models.ExportDone {
+		writeError(w, r, errExportNotReady)
+		return
+	}
+	file, err := s.exportStore.Open(r.Context(), export.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		writeError(w, r, sql.ErrNoRows)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	contentType := "text/csv; charset=utf-8"
+	if export.Format == models.ExportNDJSON {
+		contentType = "application/x-ndjson"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(export.Size, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="users-%s-%d.%s"`, export.TenantID, export.ID, export.Format))
+	// Large exports take longer than the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if _, err := io.Copy(w, file); err != nil {
+		log.Printf("Error downloading export %d: %v", export.ID, err)
+	}
+}
+
+// deleteExportHandler removes an export and its file. A running export is
+// stopped.
+func (s *Server) deleteExportHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseExportID(w, r)
+	if !ok {
+		return
+	}
+	export, err := s.db.GetExportJob(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if export.StorageKey != "" {
+		if err := s.exportStore.Delete(r.Context(), export.StorageKey); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	if err := s.db.DeleteExportJob(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// parseFields reads the comma separated "fields" query parameter.
+func parseFields(r *http.Request) []string {
+	raw := r.URL.Query().Get("fields")
+	if raw == "" {
+		return nil
+	}
+
+	var fields []string
+	for _, f := range strings.Split(raw, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// projectFields returns only the requested fields of v as a JSON object.
+func projectFields(v any, fields []string) map[string]json.RawMessage {
+	all := jsonFields(v)
+	projected := make(map[string]json.RawMessage, len(fields))
+	for _, f := range fields {
+		if value, ok := all[f]; ok {
+			projected[f] = value
+		}
+	}
+	return projected
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/flags"
+	"users/internal/tenant"
+)
+
+// loadFlagConfig reads the feature flag configuration: FEATURE_FLAGS_FILE
+// names a JSON file with defaults and per-tenant flags, and FEATURE_FLAGS
+// lists defaults that take precedence over the file's.
+func loadFlagConfig() (flags.Config, error) {
+	var cfg flags.Config
+	if path := os.Getenv("FEATURE_FLAGS_FILE"); path != "" {
+		var err error
+		if cfg, err = flags.LoadFile(path); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.Defaults == nil {
+		cfg.Defaults = map[string]bool{}
+	}
+	// WELCOME_EMAIL predates the flags and still enables them for everyone
+	if os.Getenv("WELCOME_EMAIL") == "true" {
+		cfg.Defaults[flags.WelcomeEmail] = true
+	}
+	list, err := flags.ParseList(os.Getenv("FEATURE_FLAGS"))
+	if err != nil {
+		return cfg, err
+	}
+	for name, enabled := range list {
+		cfg.Defaults[name] = enabled
+	}
+	return cfg, nil
+}
+
+// withFlags makes the feature flags available to handlers and the database
+// through the request context.
+func (s *Server) withFlags(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(flags.NewContext(r.Context(), s.flags)))
+	})
+}
+
+type flagState struct {
+	Name    string       `json:"name"`
+	Enabled bool         `json:"enabled"`
+	Source  flags.Source `json:"source"`
+}
+
+// listFlagsHandler returns every flag as resolved for the tenant of the
+// request.
+func (s *Server) listFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	tenantID := tenant.FromContext(r.Context())
+	states := make([]flagState, 0, len(flags.Known))
+	for name := range flags.Known {
+		enabled, source := s.flags.Resolve(tenantID, name)
+		states = append(states, flagState{Name: name, Enabled: enabled, Source: source})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(states)
+}
+
+// setFlagHandler overrides a flag for the tenant of the request. Other
+// instances pick the change up on their next refresh.
+func (s *Server) setFlagHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if _, ok := flags.Known[name]; !ok {
+		writeProblem(w, r, "unknown feature flag", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if req.Enabled == nil {
+		writeProblem(w, r, "enabled is required", http.StatusBadRequest)
+		return
+	}
+
+	flag, err := s.db.SetFeatureFlag(r.Context(), name, *req.Enabled)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.refreshFlags(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flag)
+}
+
+// deleteFlagHandler removes the tenant's override, so the configured value
+// applies again.
+func (s *Server) deleteFlagHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.DeleteFeatureFlag(r.Context(), chi.URLParam(r, "name")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.refreshFlags(r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) refreshFlags(r *http.Request) {
+	if err := s.flags.Refresh(r.Context()); err != nil {
+		log.Printf("Error refreshing feature flags: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/models"
+	"users/internal/validator"
+)
+
+func (s *Server) createGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var group models.Group
+	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if err := validator.ValidateGroup(&group); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := s.db.CreateGroup(r.Context(), &group); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(group)
+}
+
+func (s *Server) listGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := parseListPage(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	groups, err := s.db.ListGroups(r.Context(), page)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	total, err := s.db.CountGroups(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writePage(w, r, groups, total, page)
+}
+
+func (s *Server) getGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, err := s.db.GetGroup(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
+
+func (s *Server) updateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var updates models.GroupUpdate
+	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if err := validator.ValidateGroupUpdate(&updates); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	group, err := s.db.UpdateGroup(r.Context(), chi.URLParam(r, "id"), updates)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
+
+func (s *Server) deleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.DeleteGroup(r.Context(), chi.URLParam(r, "id")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := parseListPage(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	users, err := s.db.ListGroupMembers(r.Context(), chi.URLParam(r, "id"), page)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	total, err := s.db.CountGroupMembers(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writePage(w, r, users, total, page)
+}
+
+func (s *Server) addGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.AddUserToGroup(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "userID")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) removeGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.RemoveUserFromGroup(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "userID")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listUserGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	groups, err := s.db.ListUserGroups(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(groups)
+}
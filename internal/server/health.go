@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"users/internal/health"
+	"users/internal/models"
+	"users/internal/webhooks"
+)
+
+// newHealthRegistry registers the checks of the components the server
+// depends on. Only the database is required; the others degrade the report.
+func (s *Server) newHealthRegistry(dispatcher *webhooks.Dispatcher) *health.Registry {
+	registry := health.NewRegistry()
+	registry.Register(health.Check{
+		Name:    "database",
+		Timeout: envDuration("HEALTH_DATABASE_TIMEOUT", 2*time.Second),
+		Run: func(ctx context.Context) (any, error) {
+			report := s.db.Health()
+			if report.Status != health.StatusUp {
+				return report, errors.New(report.Error)
+			}
+			return report, nil
+		},
+	})
+
+	if pinger, ok := s.sessions.Store.(interface{ Ping(context.Context) error }); ok {
+		registry.Register(health.Check{
+			Name:     "sessions",
+			Timeout:  envDuration("HEALTH_SESSIONS_TIMEOUT", 500*time.Millisecond),
+			Optional: true,
+			Run: func(ctx context.Context) (any, error) {
+				return nil, pinger.Ping(ctx)
+			},
+		})
+	}
+
+	if s.searchIndex != nil {
+		registry.Register(health.Check{
+			Name:     "search_index",
+			Timeout:  envDuration("HEALTH_SEARCH_INDEX_TIMEOUT", time.Second),
+			Optional: true,
+			Run: func(ctx context.Context) (any, error) {
+				return nil, s.searchIndex.Ping(ctx)
+			},
+		})
+	}
+
+	maxPending := int64(envInt("HEALTH_MAX_PENDING_JOBS", 10000))
+	registry.Register(health.Check{
+		Name:     "jobs",
+		Timeout:  envDuration("HEALTH_JOBS_TIMEOUT", time.Second),
+		Optional: true,
+		Run: func(ctx context.Context) (any, error) {
+			pending, err := s.db.CountJobs(ctx, models.JobPending)
+			if err != nil {
+				return nil, err
+			}
+			details := map[string]int64{"pending": pending}
+			if maxPending > 0 && pending > maxPending {
+				return details, fmt.Errorf("%d jobs are pending, more than %d", pending, maxPending)
+			}
+			return details, nil
+		},
+	})
+
+	registry.Register(health.Check{
+		Name:     "webhooks",
+		Optional: true,
+		Run: func(ctx context.Context) (any, error) {
+			queued, capacity := dispatcher.Backlog()
+			details := map[string]int{"queued": queued, "capacity": capacity}
+			if queued >= capacity*3/4 {
+				return details, fmt.Errorf("the delivery queue is %d%% full", queued*100/capacity)
+			}
+			return details, nil
+		},
+	})
+	return registry
+}
+
+// healthHandler runs the registered checks. It answers 503 while a required
+// check fails.
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	report := s.health.Run(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status == health.StatusDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
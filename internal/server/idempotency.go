@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+const (
+	idempotencyKeyHeader  = "Idempotency-Key"
+	defaultIdempotencyTTL = 24 * time.Hour
+	// idempotencyLease is how long a key stays reserved for a request
+	// that neither finishes nor fails, longer than any request may take.
+	idempotencyLease = time.Minute
+)
+
+// recorder captures the status and body written by a handler while passing
+// them through to the client.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotent replays the stored response for requests carrying a known
+// Idempotency-Key header and stores the response of new ones. The key is
+// reserved before the handler runs, so a request arriving while another
+// with the same key is still running is answered 409 instead of running
+// the handler twice.
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > 128 {
+			writeProblem(w, r, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+
+		// Keys are chosen by clients, so keep tenants from colliding
+		key = tenant.FromContext(r.Context()) + ":" + key
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeBodyError(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		hash := hex.EncodeToString(sum[:])
+
+		record, err := s.db.ReserveIdempotencyKey(r.Context(), &models.IdempotencyRecord{
+			Key:         key,
+			RequestHash: hash,
+			ExpiresAt:   time.Now().Add(idempotencyLease),
+		})
+		if err != nil {
+			writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if record != nil {
+			switch {
+			case record.RequestHash != hash:
+				writeProblem(w, r, "Idempotency-Key was already used with a different request", http.StatusUnprocessableEntity)
+			case record.StatusCode == 0:
+				w.Header().Set("Retry-After", "1")
+				writeProblem(w, r, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+			default:
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(record.StatusCode)
+				_, _ = w.Write(record.Body)
+			}
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		// Server errors are worth retrying, so only remember definitive
+		// outcomes. Saving or releasing must happen even when the client
+		// went away.
+		ctx := context.WithoutCancel(r.Context())
+		if rec.status >= http.StatusInternalServerError {
+			if err := s.db.ReleaseIdempotencyKey(ctx, key); err != nil {
+				log.Printf("Error releasing idempotency key %s: %v", key, err)
+			}
+			return
+		}
+		err = s.db.SaveIdempotencyRecord(ctx, &models.IdempotencyRecord{
+			Key:         key,
+			RequestHash: hash,
+			StatusCode:  rec.status,
+			Body:        rec.body.Bytes(),
+			ExpiresAt:   time.Now().Add(s.config().idempotencyTTL),
+		})
+		if err != nil {
+			log.Printf("Error saving idempotency key %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/auth"
+	"users/internal/models"
+	"users/internal/session"
+	"users/internal/tenant"
+)
+
+// impersonationHeader marks every response to a request made by an admin
+// impersonating a user.
+const impersonationHeader = "X-Impersonated-By"
+
+type impersonateRequest struct {
+	Reason string `json:"reason"`
+}
+
+type impersonateResponse struct {
+	// Token is sent as the value of the Cookie named Cookie.
+	Token   string           `json:"token"`
+	Cookie  string           `json:"cookie"`
+	Session *session.Session `json:"session"`
+}
+
+// impersonateUserHandler lets an admin act as a user, e.g. to reproduce
+// what a user reports, through a short-lived session of that user. The
+// session cannot change the user's credentials and both its start and its
+// revocation are audited; everything done with it is attributed to the
+// admin.
+func (s *Server) impersonateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var req impersonateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		writeProblem(w, r, "reason is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.GetUserByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	actor := auth.ActorFromContext(r.Context())
+	token, sess, err := s.sessions.Impersonate(r.Context(), r, tenant.FromContext(r.Context()), user.ID, actor, req.Reason, s.config().impersonationTTL)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, models.AuditImpersonationStarted, user.ID, map[string]any{
+		"session_id": sess.ID,
+		"reason":     req.Reason,
+		"expires_at": sess.ExpiresAt.Format(time.RFC3339),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(impersonateResponse{Token: token, Cookie: s.sessions.CookieName, Session: sess})
+}
+
+// endImpersonationHandler revokes an impersonation session before it
+// expires.
+func (s *Server) endImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	sess, err := s.sessions.Store.Get(r.Context(), chi.URLParam(r, "id"))
+	if err == session.ErrNotFound || (err == nil && (sess.ImpersonatedBy == "" || sess.TenantID != tenant.FromContext(r.Context()))) {
+		writeProblem(w, r, "Impersonation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.sessions.Store.Delete(r.Context(), sess.ID); err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, models.AuditImpersonationEnded, sess.UserID, map[string]any{"session_id": sess.ID})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// forbidImpersonation keeps impersonation sessions away from the user's
+// credentials and sessions, which only the user may change.
+func (s *Server) forbidImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sess, ok := session.FromContext(r.Context()); ok && sess.ImpersonatedBy != "" {
+			writeProblem(w, r, "Not allowed while impersonating", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/mail"
+	"users/internal/models"
+	"users/internal/purge"
+	"users/internal/worker"
+)
+
+// Kinds of background jobs.
+const (
+	jobSendUserMail = "mail.user"
+	jobPurge        = "purge"
+	jobGrowthStats  = "growth_stats"
+
+	// jobSendMail jobs carry a rendered mail. They are no longer queued
+	// but those already waiting are still sent.
+	jobSendMail = "mail.send"
+)
+
+// newWorkerPool returns the background workers, sized by
+// WORKER_CONCURRENCY and WORKER_POLL_INTERVAL, with the server's job kinds
+// registered. purger and growth may be nil when their schedule is off.
+func (s *Server) newWorkerPool(purger, growth *purge.Scheduler) *worker.Pool {
+	pool := worker.NewPool(s.db)
+	pool.Concurrency = max(envInt("WORKER_CONCURRENCY", pool.Concurrency), 1)
+	pool.PollInterval = envDuration("WORKER_POLL_INTERVAL", pool.PollInterval)
+
+	pool.Register(jobSendUserMail, s.sendUserMail)
+	pool.Register(jobSendMail, func(ctx context.Context, job models.Job) error {
+		var msg mail.Message
+		if err := json.Unmarshal(job.Payload, &msg); err != nil {
+			return err
+		}
+		return s.mail.Send(ctx, msg)
+	})
+	registerScheduler(pool, jobPurge, purger)
+	registerScheduler(pool, jobGrowthStats, growth)
+	return pool
+}
+
+// registerScheduler makes the runs of scheduler background jobs of kind.
+func registerScheduler(pool *worker.Pool, kind string, scheduler *purge.Scheduler) {
+	if scheduler == nil {
+		return
+	}
+	pool.Register(kind, func(ctx context.Context, job models.Job) error {
+		var payload struct {
+			Job string `json:"job"`
+		}
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return err
+		}
+		return scheduler.RunJob(ctx, payload.Job)
+	})
+	// One job per scheduled run, however many instances queue it
+	scheduler.Enqueue = func(ctx context.Context, name string, scheduled time.Time) error {
+		return pool.EnqueueJob(ctx, &models.Job{
+			Kind: kind,
+			Key:  fmt.Sprintf("%s:%s:%s", kind, name, scheduled.UTC().Format(time.RFC3339)),
+		}, map[string]string{"job": name})
+	}
+}
+
+func (s *Server) listJobsHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	status := models.JobStatus(r.URL.Query().Get("status"))
+	if status != "" && !status.IsValid() {
+		writeProblem(w, r, errInvalidParam("status").Error(), http.StatusBadRequest)
+		return
+	}
+
+	jobs, err := s.db.ListJobs(r.Context(), status, page)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// retryJobHandler puts a dead job back in the queue.
+func (s *Server) retryJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeProblem(w, r, "invalid job id", http.StatusBadRequest)
+		return
+	}
+
+	job, err := s.db.RetryJob(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
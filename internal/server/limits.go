@@ -0,0 +1,41 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// defaultMaxBodyBytes caps request bodies unless MAX_REQUEST_BODY_BYTES
+// says otherwise. Users and patches are a few hundred bytes.
+const defaultMaxBodyBytes = 1 << 20
+
+// limitBody rejects request bodies larger than s.maxBodyBytes. Declared
+// lengths are refused up front; for the rest reading stops at the limit and
+// writeBodyError turns that into a 413.
+func (s *Server) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.maxBodyBytes > 0 && r.Body != nil {
+			if r.ContentLength > s.maxBodyBytes {
+				tooLarge(w, r, s.maxBodyBytes)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeBodyError answers a failure to read or decode the request body.
+func writeBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		tooLarge(w, r, maxErr.Limit)
+		return
+	}
+	writeProblem(w, r, err.Error(), http.StatusBadRequest)
+}
+
+func tooLarge(w http.ResponseWriter, r *http.Request, limit int64) {
+	writeProblem(w, r, "Request body must not exceed "+strconv.FormatInt(limit, 10)+" bytes", http.StatusRequestEntityTooLarge)
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/validator"
+)
+
+// parsePage reads the limit and offset query parameters.
+func parsePage(r *http.Request) (database.Page, error) {
+	var page database.Page
+	q := r.URL.Query()
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return page, errInvalidParam("limit")
+		}
+		page.Limit = limit
+	}
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return page, errInvalidParam("offset")
+		}
+		page.Offset = offset
+	}
+	return page, nil
+}
+
+// parseUserFilter reads the list filters from the query string.
+func parseUserFilter(r *http.Request) (database.UserFilter, error) {
+	return userFilterFromQuery(r.URL.Query())
+}
+
+// userFilterFromQuery reads the list filters from query parameters.
+func userFilterFromQuery(q url.Values) (database.UserFilter, error) {
+	filter := database.UserFilter{
+		Email:    q.Get("email"),
+		Username: q.Get("username"),
+		Status:   models.UserStatus(q.Get("status")),
+	}
+	if filter.Status != "" && !filter.Status.IsValid() {
+		return filter, errInvalidParam("status")
+	}
+	if v := q.Get("inactive_days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days <= 0 {
+			return filter, errInvalidParam("inactive_days")
+		}
+		filter.InactiveSince = time.Now().AddDate(0, 0, -days)
+	}
+	for _, param := range []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"created_after", &filter.CreatedAfter},
+		{"created_before", &filter.CreatedBefore},
+	} {
+		if v := q.Get(param.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, errInvalidParam(param.name)
+			}
+			*param.dst = t
+		}
+	}
+	if !filter.CreatedAfter.IsZero() && !filter.CreatedBefore.IsZero() && !filter.CreatedAfter.Before(filter.CreatedBefore) {
+		return filter, errInvalidParam("created_before")
+	}
+	for _, param := range []struct {
+		name string
+		dst  *[]string
+	}{
+		{"tags_any", &filter.TagsAny},
+		{"tags_all", &filter.TagsAll},
+	} {
+		for _, tag := range splitList(q.Get(param.name)) {
+			if validator.ValidateTag(tag) != nil {
+				return filter, errInvalidParam(param.name)
+			}
+			*param.dst = append(*param.dst, tag)
+		}
+	}
+	// metadata.crm_id=42 keeps users whose metadata has crm_id 42
+	for name := range q {
+		key, ok := strings.CutPrefix(name, "metadata.")
+		if !ok {
+			continue
+		}
+		if validator.ValidateMetadataKey(key) != nil {
+			return filter, errInvalidParam(name)
+		}
+		if filter.Metadata == nil {
+			filter.Metadata = make(map[string]string)
+		}
+		filter.Metadata[key] = q.Get(name)
+	}
+	return filter, nil
+}
+
+type errInvalidParam string
+
+func (e errInvalidParam) Error() string {
+	return "invalid query parameter: " + string(e)
+}
+
+func (s *Server) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if ids := r.URL.Query().Get("ids"); ids != "" {
+		s.getUsersByIDsHandler(w, r, strings.Split(ids, ","))
+		return
+	}
+
+	page, err := parseListPage(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseUserFilter(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	users, err := s.db.ListUsers(r.Context(), filter, page)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	total, err := s.db.CountUsers(r.Context(), filter)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, users, total, page)
+}
+
+func (s *Server) getUsersByIDsHandler(w http.ResponseWriter, r *http.Request, ids []string) {
+	if len(ids) > database.MaxPageLimit {
+		writeProblem(w, r, "too many ids", http.StatusBadRequest)
+		return
+	}
+
+	users, err := s.db.GetUsersByIDs(r.Context(), ids)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+func (s *Server) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		writeProblem(w, r, "query parameter q is required", http.StatusBadRequest)
+		return
+	}
+	page, err := parseListPage(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Get("fuzzy") == "true" {
+		s.fuzzySearchHandler(w, r, q, page)
+		return
+	}
+	filter, err := parseUserFilter(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	users, err := s.db.SearchUsers(r.Context(), q, filter, page)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	total, err := s.db.CountSearchUsers(r.Context(), q, filter)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, users, total, page)
+}
+
+// userChangesHandler serves delta syncs: the users changed since the
+// RFC 3339 time since, or since the position of an earlier cursor.
+func (s *Server) userChangesHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	cursor := q.Get("cursor")
+	var since time.Time
+	if v := q.Get("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			writeProblem(w, r, errInvalidParam("since").Error(), http.StatusBadRequest)
+			return
+		}
+	} else if cursor == "" {
+		writeProblem(w, r, "query parameter since or cursor is required", http.StatusBadRequest)
+		return
+	}
+	page, err := parsePage(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	set, err := s.db.GetUsersChangedSince(r.Context(), since, cursor, page.Limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(set)
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/models"
+	"users/internal/validator"
+)
+
+func (s *Server) getMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	md, err := s.db.GetMetadata(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(md)
+}
+
+// putMetadataHandler replaces the user's metadata with the JSON object in
+// the body.
+func (s *Server) putMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	var md models.Metadata
+	if err := json.NewDecoder(r.Body).Decode(&md); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if err := validator.ValidateMetadata(md); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	md, err := s.db.SetMetadata(r.Context(), chi.URLParam(r, "id"), md)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(md)
+}
+
+// patchMetadataHandler merges the JSON object in the body into the user's
+// metadata; keys set to null are removed.
+func (s *Server) patchMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	var patch models.Metadata
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if err := validator.ValidateMetadata(patch); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	md, err := s.db.MergeMetadata(r.Context(), chi.URLParam(r, "id"), patch)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(md)
+}
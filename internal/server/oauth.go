@@ -0,0 +1,348 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/oauth2"
+
+	"users/internal/events"
+	"users/internal/flags"
+	"users/internal/models"
+	"users/internal/oauth"
+	"users/internal/session"
+	"users/internal/tenant"
+	"users/internal/validator"
+)
+
+const oauthStateCookie = "oauth_state"
+
+// oauthState survives the round trip through the provider in a short lived
+// cookie.
+type oauthState struct {
+	State    string `json:"state"`
+	Verifier string `json:"verifier"`
+	Tenant   string `json:"tenant"`
+	// LinkUserID is set when an authenticated user links another account.
+	LinkUserID string `json:"link_user_id,omitempty"`
+}
+
+// newOAuthProviders configures the providers whose credentials are set.
+func newOAuthProviders() map[string]*oauth.Provider {
+	base := strings.TrimRight(os.Getenv("OAUTH_REDIRECT_BASE_URL"), "/")
+	providers := make(map[string]*oauth.Provider)
+
+	if id := os.Getenv("OAUTH_GOOGLE_CLIENT_ID"); id != "" {
+		providers["google"] = oauth.Google(id, os.Getenv("OAUTH_GOOGLE_CLIENT_SECRET"), base+"/auth/google/callback")
+	}
+	if id := os.Getenv("OAUTH_GITHUB_CLIENT_ID"); id != "" {
+		providers["github"] = oauth.GitHub(id, os.Getenv("OAUTH_GITHUB_CLIENT_SECRET"), base+"/auth/github/callback")
+	}
+	return providers
+}
+
+func (s *Server) oauthProvider(w http.ResponseWriter, r *http.Request) (*oauth.Provider, bool) {
+	provider, ok := s.oauth[chi.URLParam(r, "provider")]
+	if !ok {
+		writeProblem(w, r, "Unknown login provider", http.StatusNotFound)
+	}
+	return provider, ok
+}
+
+func (s *Server) oauthLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := s.oauthProvider(w, r)
+	if !ok {
+		return
+	}
+
+	// Browsers cannot send the tenant header through a redirect
+	tenantID := r.URL.Query().Get("tenant")
+	if tenantID == "" {
+		tenantID = tenant.FromContext(r.Context())
+	}
+	if !tenant.IsValid(tenantID) {
+		writeProblem(w, r, "invalid tenant id", http.StatusBadRequest)
+		return
+	}
+	s.redirectToProvider(w, r, provider, oauthState{Tenant: tenantID})
+}
+
+func (s *Server) linkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := s.oauthProvider(w, r)
+	if !ok {
+		return
+	}
+	sess, _ := session.FromContext(r.Context())
+	s.redirectToProvider(w, r, provider, oauthState{Tenant: sess.TenantID, LinkUserID: sess.UserID})
+}
+
+func (s *Server) redirectToProvider(w http.ResponseWriter, r *http.Request, provider *oauth.Provider, state oauthState) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	state.State = base64.RawURLEncoding.EncodeToString(b)
+	state.Verifier = oauth2.GenerateVerifier()
+
+	data, _ := json.Marshal(state)
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(data),
+		Path:     "/auth/",
+		MaxAge:   int((10 * time.Minute) / time.Second),
+		HttpOnly: true,
+		Secure:   s.sessions.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	url := provider.Config.AuthCodeURL(state.State, oauth2.S256ChallengeOption(state.Verifier))
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+func readOAuthState(r *http.Request) (*oauthState, error) {
+	c, err := r.Cookie(oauthStateCookie)
+	if err != nil {
+		return nil, errors.New("missing login state")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err != nil {
+		return nil, errors.New("invalid login state")
+	}
+	var state oauthState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errors.New("invalid login state")
+	}
+	if state.State == "" || r.URL.Query().Get("state") != state.State {
+		return nil, errors.New("login state mismatch")
+	}
+	return &state, nil
+}
+
+func (s *Server) oauthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := s.oauthProvider(w, r)
+	if !ok {
+		return
+	}
+	state, err := readOAuthState(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Path: "/auth/", MaxAge: -1})
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		writeProblem(w, r, "Login was not completed: "+e, http.StatusUnauthorized)
+		return
+	}
+
+	profile, err := provider.Profile(r.Context(), r.URL.Query().Get("code"), state.Verifier)
+	if err != nil {
+		if err == oauth.ErrEmailUnverified {
+			writeError(w, r, err)
+			return
+		}
+		log.Printf("OAuth login with %s failed: %v", provider.Name, err)
+		writeProblem(w, r, "Login failed", http.StatusBadGateway)
+		return
+	}
+
+	ctx := tenant.WithTenant(r.Context(), state.Tenant)
+	r = r.WithContext(ctx)
+
+	if state.LinkUserID != "" {
+		s.completeLink(w, r, provider.Name, profile, state.LinkUserID)
+		return
+	}
+
+	user, err := s.db.GetUserByIdentity(ctx, provider.Name, profile.Subject)
+	if err == sql.ErrNoRows {
+		user, err = s.provisionUser(w, r, provider.Name, profile)
+		if user == nil && err == nil {
+			return
+		}
+	}
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	s.startLogin(w, r, user)
+}
+
+// provisionUser creates a user for a first login. It writes the response
+// itself and returns a nil user when the login cannot proceed.
+func (s *Server) provisionUser(w http.ResponseWriter, r *http.Request, provider string, profile *oauth.Profile) (*models.User, error) {
+	// Never attach a provider account to an existing user implicitly, since
+	// that would hand the account to whoever controls the provider side
+	_, err := s.db.GetUserByEmail(r.Context(), profile.Email)
+	if err == nil {
+		writeProblem(w, r, "An account with this email already exists; sign in and link the provider instead", http.StatusConflict)
+		return nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	// Provider names are free text, so keep only what a name may contain.
+	// Providers only hand out verified emails, so the user starts active
+	// even where the tenant requires email verification
+	user := &models.User{
+		FirstName: validator.SanitizeName(profile.FirstName),
+		LastName:  validator.SanitizeName(profile.LastName),
+		Email:     profile.Email,
+		Status:    models.StatusActive,
+	}
+	if user.FirstName == "" {
+		local, _, _ := strings.Cut(profile.Email, "@")
+		user.FirstName = validator.SanitizeName(local)
+	}
+	if user.FirstName == "" {
+		user.FirstName = validator.NoName
+	}
+	if user.LastName == "" {
+		user.LastName = validator.NoName
+	}
+	if err := validator.ValidateUser(user); err != nil {
+		writeProblem(w, r, err.Error(), http.StatusUnprocessableEntity)
+		return nil, nil
+	}
+
+	user, err = s.db.CreateUser(r.Context(), user)
+	if err != nil {
+		return nil, err
+	}
+	identity := &models.Identity{UserID: user.ID, Provider: provider, Subject: profile.Subject, Email: profile.Email}
+	if err := s.db.LinkIdentity(r.Context(), identity); err != nil {
+		// Do not leave a user behind that nobody can log in as
+		if _, derr := s.db.DeleteUserByID(r.Context(), user.ID); derr != nil {
+			log.Printf("Error removing half provisioned user %s: %v", user.ID, derr)
+		}
+		return nil, err
+	}
+
+	s.events.Publish(events.New(r.Context(), events.UserCreated, user))
+	s.sendWelcome(r, user)
+	return user, nil
+}
+
+func (s *Server) completeLink(w http.ResponseWriter, r *http.Request, provider string, profile *oauth.Profile, userID string) {
+	identity := &models.Identity{UserID: userID, Provider: provider, Subject: profile.Subject, Email: profile.Email}
+	if err := s.db.LinkIdentity(r.Context(), identity); err != nil {
+		if err == sql.ErrNoRows {
+			writeProblem(w, r, "User not found", http.StatusNotFound)
+			return
+		}
+		writeProblem(w, r, "Account is already linked", http.StatusConflict)
+		return
+	}
+	s.audit(r, models.AuditIdentityLinked, userID, map[string]any{"provider": provider})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(identity)
+}
+
+// startLogin starts a session for a user who proved their first factor. If
+// the user has two-factor authentication enabled the session stays pending
+// until a code is posted to /auth/2fa.
+func (s *Server) startLogin(w http.ResponseWriter, r *http.Request, user *models.User) {
+	if user.Status == models.StatusSuspended {
+		writeProblem(w, r, "Account is suspended", http.StatusForbidden)
+		return
+	}
+	if user.Status == models.StatusMerged {
+		writeProblem(w, r, "Account was merged into another", http.StatusForbidden)
+		return
+	}
+	if user.Status == models.StatusPending && flags.Enabled(r.Context(), flags.EmailVerificationRequired) {
+		writeProblem(w, r, "Account is not activated yet", http.StatusForbidden)
+		return
+	}
+	enrollment, err := s.db.GetTOTP(r.Context(), user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err == nil && enrollment.EnabledAt != nil {
+		if _, err := s.sessions.StartPending(r.Context(), w, r, tenant.FromContext(r.Context()), user.ID); err != nil {
+			writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]bool{"mfa_required": true})
+		return
+	}
+	s.completeLogin(w, r, user)
+}
+
+// completeLogin starts a session for user and responds with the user.
+func (s *Server) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User) {
+	if _, err := s.sessions.Start(r.Context(), w, r, tenant.FromContext(r.Context()), user.ID); err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.db.RecordLogin(r.Context(), user.ID); err != nil {
+		log.Printf("Error recording login of user %s: %v", user.ID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func (s *Server) meHandler(w http.ResponseWriter, r *http.Request) {
+	sess, _ := session.FromContext(r.Context())
+	user, err := s.db.GetUserByID(r.Context(), sess.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeProblem(w, r, "User not found", http.StatusNotFound)
+			return
+		}
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if notModified(w, r, user) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func (s *Server) listIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	sess, _ := session.FromContext(r.Context())
+	identities, err := s.db.ListIdentities(r.Context(), sess.UserID)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identities)
+}
+
+func (s *Server) unlinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	sess, _ := session.FromContext(r.Context())
+	provider := chi.URLParam(r, "provider")
+	if err := s.db.UnlinkIdentity(r.Context(), sess.UserID, provider); err != nil {
+		if err == sql.ErrNoRows {
+			writeProblem(w, r, "Identity not found", http.StatusNotFound)
+			return
+		}
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, models.AuditIdentityUnlinked, sess.UserID, map[string]any{"provider": provider})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"users/internal/database"
+)
+
+// pageEnvelope is the body of a list for clients passing envelope=true,
+// instead of the bare array.
+type pageEnvelope[T any] struct {
+	Items []T   `json:"items"`
+	Total int64 `json:"total"`
+	// NextCursor, passed as cursor, fetches the next page. It is empty on
+	// the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// parseListPage reads limit and offset like parsePage, or the position of
+// a cursor from an earlier page instead of offset.
+func parseListPage(r *http.Request) (database.Page, error) {
+	page, err := parsePage(r)
+	if err != nil {
+		return page, err
+	}
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		b, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			return page, errInvalidParam("cursor")
+		}
+		offset, err := strconv.Atoi(string(b))
+		if err != nil || offset < 0 {
+			return page, errInvalidParam("cursor")
+		}
+		page.Offset = offset
+	}
+	return page.Normalize(), nil
+}
+
+func pageCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// writePage writes one page of a list of total items. Link (RFC 8288)
+// headers point at the first, previous, next and last page, and
+// X-Total-Count carries total.
+func writePage[T any](w http.ResponseWriter, r *http.Request, items []T, total int64, page database.Page) {
+	next := page.Offset + len(items)
+	hasNext := int64(next) < total && len(items) > 0
+
+	link := func(rel string, offset int) {
+		u := *r.URL
+		q := u.Query()
+		q.Del("cursor")
+		q.Set("offset", strconv.Itoa(offset))
+		q.Set("limit", strconv.Itoa(page.Limit))
+		u.RawQuery = q.Encode()
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel))
+	}
+	link("first", 0)
+	if page.Offset > 0 {
+		link("prev", max(page.Offset-page.Limit, 0))
+	}
+	if hasNext {
+		link("next", next)
+	}
+	link("last", int(max(total-1, 0)/int64(page.Limit))*page.Limit)
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.URL.Query().Get("envelope") != "true" {
+		json.NewEncoder(w).Encode(items)
+		return
+	}
+	body := pageEnvelope[T]{Items: items, Total: total}
+	if hasNext {
+		body.NextCursor = pageCursor(next)
+	}
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"users/internal/mail"
+	"users/internal/models"
+	"users/internal/session"
+	"users/internal/tenant"
+	"users/internal/validator"
+)
+
+// dummyHash is compared against when the account does not exist so that
+// unknown emails take as long to reject as wrong passwords.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// hashPassword checks password, sent as field of the request, against the
+// policy and returns its hash. It writes the response itself when the
+// password is rejected.
+func (s *Server) hashPassword(w http.ResponseWriter, r *http.Request, field, password string) (string, bool) {
+	if err := s.config().passwordPolicy.Validate(r.Context(), password); err != nil {
+		writeError(w, r, validator.Field(field, err))
+		return "", false
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return "", false
+	}
+	return string(hash), true
+}
+
+func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	// Unknown, locked and password-less accounts are all compared against
+	// dummyHash and answered like a wrong password, so neither the
+	// response nor its timing tells which emails are registered
+	hash, known, locked := dummyHash, false, false
+	user, err := s.db.GetUserByEmail(r.Context(), req.Email)
+	if err != nil && err != sql.ErrNoRows {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		lockedUntil, err := s.db.GetLockedUntil(r.Context(), user.ID)
+		if err != nil {
+			writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		locked = lockedUntil != nil
+	}
+	if user != nil && !locked {
+		stored, err := s.db.GetPasswordHash(r.Context(), user.ID)
+		if err != nil {
+			writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if stored != "" {
+			hash, known = []byte(stored), true
+		}
+	}
+
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(req.Password)); err != nil || !known {
+		if lockout := s.config().lockout; user != nil && !locked && lockout.MaxFailures > 0 {
+			if _, err := s.db.RecordFailedLogin(r.Context(), user.ID, lockout); err != nil {
+				log.Printf("Error recording failed login of user %s: %v", user.ID, err)
+			}
+		}
+		writeProblem(w, r, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+	if err := s.db.ResetFailedLogins(r.Context(), user.ID); err != nil {
+		log.Printf("Error resetting failed logins of user %s: %v", user.ID, err)
+	}
+	s.startLogin(w, r, user)
+}
+
+// writeLocked rejects the second factor of a login to an account locked
+// meanwhile, telling the client when to retry. Only the holder of the
+// password gets that far; password logins to locked accounts answer like
+// wrong passwords.
+func writeLocked(w http.ResponseWriter, r *http.Request, until time.Time) {
+	retry := int(math.Ceil(time.Until(until).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(retry, 1)))
+	writeProblem(w, r, "Account is locked after too many failed logins", http.StatusLocked)
+}
+
+func (s *Server) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.UnlockUser(r.Context(), chi.URLParam(r, "id")); err != nil {
+		if err == sql.ErrNoRows {
+			writeProblem(w, r, "User not found", http.StatusNotFound)
+			return
+		}
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// changePasswordHandler sets a new password for the signed in user. Users
+// who already have a password must confirm it, and every other session of
+// the user is ended afterwards.
+func (s *Server) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	sess, _ := session.FromContext(r.Context())
+	var req changePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	current, err := s.db.GetPasswordHash(r.Context(), sess.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeProblem(w, r, "User not found", http.StatusNotFound)
+			return
+		}
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if current != "" && bcrypt.CompareHashAndPassword([]byte(current), []byte(req.CurrentPassword)) != nil {
+		writeProblem(w, r, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	hash, ok := s.hashPassword(w, r, "new_password", req.NewPassword)
+	if !ok {
+		return
+	}
+	if err := s.db.SetPasswordHash(r.Context(), sess.UserID, hash); err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	s.revokeOtherSessions(r, sess)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeOtherSessions ends every session of the user except current.
+func (s *Server) revokeOtherSessions(r *http.Request, current *session.Session) {
+	sessions, err := s.sessions.Store.ListByUser(r.Context(), tenant.FromContext(r.Context()), current.UserID)
+	if err != nil {
+		log.Printf("Error listing sessions of user %s: %v", current.UserID, err)
+		return
+	}
+	for _, other := range sessions {
+		if other.ID == current.ID {
+			continue
+		}
+		if err := s.sessions.Store.Delete(r.Context(), other.ID); err != nil {
+			log.Printf("Error revoking session of user %s: %v", current.UserID, err)
+		}
+	}
+}
+
+// requestPasswordResetHandler mails a reset token to the user with the
+// given email. It always answers 202 so the response does not reveal
+// whether an account exists.
+func (s *Server) requestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if req.Email == "" {
+		writeProblem(w, r, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.GetUserByEmail(r.Context(), req.Email)
+	if err != nil && err != sql.ErrNoRows {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		s.issuePasswordReset(r, user)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// issuePasswordReset queues a mail with a reset token for user. Failures
+// are logged; the user can ask for another reset.
+func (s *Server) issuePasswordReset(r *http.Request, user *models.User) {
+	if err := s.queueMail(r, mail.TemplatePasswordReset, user.ID); err != nil {
+		log.Printf("Error queueing password reset for user %s: %v", user.ID, err)
+	}
+}
+
+// confirmPasswordResetHandler sets the new password of the holder of a
+// reset token and ends all of their sessions.
+func (s *Server) confirmPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if req.Token == "" {
+		writeProblem(w, r, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	hash, ok := s.hashPassword(w, r, "new_password", req.NewPassword)
+	if !ok {
+		return
+	}
+	userID, err := s.db.ResetPassword(r.Context(), hashToken(req.Token), hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeProblem(w, r, "Invalid or expired token", http.StatusNotFound)
+			return
+		}
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	s.revokeSessions(r, userID)
+	w.WriteHeader(http.StatusNoContent)
+}
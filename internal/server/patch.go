@@ -0,0 +1,53 @@
+package server
+
+import (
+	"database/sql"
+	"io"
+	"mime"
+	"net/http"
+
+	"users/internal/models"
+	"users/internal/patch"
+)
+
+// mediaType returns the request's Content-Type without parameters.
+func mediaType(r *http.Request) string {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mt
+}
+
+// decodePatch translates a JSON Patch or Merge Patch body into a UserUpdate.
+// It writes the error response itself and reports whether decoding succeeded.
+func (s *Server) decodePatch(w http.ResponseWriter, r *http.Request, id string) (models.UserUpdate, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return models.UserUpdate{}, false
+	}
+
+	if mediaType(r) == patch.MergePatchContentType {
+		updates, err := patch.MergePatch(body)
+		if err != nil {
+			writeProblem(w, r, err.Error(), http.StatusBadRequest)
+			return updates, false
+		}
+		return updates, true
+	}
+
+	current, err := s.db.GetUserByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeProblem(w, r, "User not found", http.StatusNotFound)
+			return models.UserUpdate{}, false
+		}
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return models.UserUpdate{}, false
+	}
+
+	updates, err := patch.JSONPatch(body, current)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusUnprocessableEntity)
+		return updates, false
+	}
+	return updates, true
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/models"
+	"users/internal/session"
+	"users/internal/validator"
+)
+
+func (s *Server) getPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	s.writePreferences(w, r, chi.URLParam(r, "id"))
+}
+
+func (s *Server) updatePreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	s.updatePreferences(w, r, chi.URLParam(r, "id"))
+}
+
+func (s *Server) getMyPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	sess, _ := session.FromContext(r.Context())
+	s.writePreferences(w, r, sess.UserID)
+}
+
+func (s *Server) updateMyPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	sess, _ := session.FromContext(r.Context())
+	s.updatePreferences(w, r, sess.UserID)
+}
+
+func (s *Server) writePreferences(w http.ResponseWriter, r *http.Request, userID string) {
+	prefs, err := s.db.GetPreferences(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// updatePreferences applies the preferences set in the body and answers
+// with all of the user's preferences. Subscribing to the newsletter takes
+// the user's marketing consent.
+func (s *Server) updatePreferences(w http.ResponseWriter, r *http.Request, userID string) {
+	var updates models.PreferencesUpdate
+	if !s.decodeJSON(w, r, &updates) {
+		return
+	}
+	if err := validator.ValidatePreferencesUpdate(&updates); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if updates.Newsletter != nil && *updates.Newsletter {
+		ok, err := s.hasConsent(r.Context(), userID, models.ConsentMarketing, "")
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if !ok {
+			writeError(w, r, fmt.Errorf("%w: the newsletter needs marketing consent", errConsentRequired))
+			return
+		}
+	}
+	prefs, err := s.db.UpdatePreferences(r.Context(), userID, updates)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
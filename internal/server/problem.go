@@ -0,0 +1,118 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"users/internal/database"
+	"users/internal/oauth"
+	"users/internal/validator"
+)
+
+const problemContentType = "application/problem+json"
+
+// problem is an RFC 7807 problem details response.
+type problem struct {
+	// Type identifies the kind of problem; "about:blank" when the status
+	// code says it all.
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Errors lists the invalid fields of a rejected request, each with a
+	// stable code clients can act on.
+	Errors []validator.ValidationError `json:"errors,omitempty"`
+}
+
+// problemTypeBase prefixes the type of domain problems, which are
+// documented in the README.
+const problemTypeBase = "/problems/"
+
+// domainProblems maps the errors the service layers return to a problem
+// type and status. They are matched with errors.Is in order.
+var domainProblems = []struct {
+	err    error
+	status int
+	kind   string
+	title  string
+}{
+	{sql.ErrNoRows, http.StatusNotFound, "not-found", "Resource not found"},
+	{database.ErrEmailTaken, http.StatusConflict, "email-taken", "Email address already in use"},
+	{database.ErrUsernameTaken, http.StatusConflict, "username-taken", "Username already taken"},
+	{database.ErrUserExists, http.StatusConflict, "user-exists", "User ID already in use"},
+	{database.ErrInvalidID, http.StatusBadRequest, "invalid-id", "Invalid user ID"},
+	{database.ErrVersionConflict, http.StatusPreconditionFailed, "version-conflict", "User was modified by another request"},
+	{database.ErrNoFieldsToUpdate, http.StatusBadRequest, "no-fields-to-update", "No fields to update"},
+	{database.ErrBulkUniqueField, http.StatusBadRequest, "bulk-unique-field", "Field cannot be bulk updated"},
+	{database.ErrBulkLimitRequired, http.StatusBadRequest, "bulk-limit-required", "Limit required"},
+	{database.ErrBulkFilterRequired, http.StatusBadRequest, "bulk-filter-required", "Filter required"},
+	{database.ErrInvalidCursor, http.StatusBadRequest, "invalid-cursor", "Invalid cursor"},
+	{database.ErrGroupNameTaken, http.StatusConflict, "group-name-taken", "Group name already taken"},
+	{database.ErrTooManyTags, http.StatusConflict, "too-many-tags", "User has too many tags"},
+	{database.ErrQuotaExceeded, http.StatusConflict, "quota-exceeded", "Quota exceeded"},
+	{database.ErrUnknownQuota, http.StatusNotFound, "unknown-quota", "Unknown quota"},
+	{database.ErrJobQueued, http.StatusConflict, "job-queued", "Job already queued"},
+	{database.ErrInvalidTransition, http.StatusConflict, "invalid-status-transition", "Status change not allowed"},
+	{database.ErrAlreadyAnonymized, http.StatusConflict, "already-anonymized", "User is already anonymized"},
+	{database.ErrMergeSelf, http.StatusBadRequest, "merge-self", "User cannot be merged into itself"},
+	{database.ErrNotMergeable, http.StatusConflict, "not-mergeable", "User cannot be merged"},
+	{database.ErrNotRestorable, http.StatusConflict, "not-restorable", "User cannot be restored"},
+	{database.ErrTOTPAlreadyEnabled, http.StatusConflict, "totp-already-enabled", "Two-factor authentication is already enabled"},
+	{database.ErrUnavailable, http.StatusServiceUnavailable, "database-unavailable", "Database unavailable"},
+	{errConsentRequired, http.StatusForbidden, "consent-required", "Consent required"},
+	{errExportNotReady, http.StatusConflict, "export-not-ready", "Export not finished"},
+	{oauth.ErrEmailUnverified, http.StatusForbidden, "email-unverified", "Email address not verified"},
+}
+
+// writeProblem answers with a problem of the generic type for status. It
+// takes the place of http.Error, with detail as the human readable
+// explanation.
+func writeProblem(w http.ResponseWriter, r *http.Request, detail string, status int) {
+	writeProblemDetails(w, problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	})
+}
+
+// writeError answers with the problem matching err: the field errors of a
+// failed validation, a known domain error, or an opaque internal error.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var fields validator.Errors
+	if errors.As(err, &fields) {
+		writeProblemDetails(w, problem{
+			Type:     problemTypeBase + "validation-error",
+			Title:    "Invalid request",
+			Status:   http.StatusBadRequest,
+			Detail:   err.Error(),
+			Instance: r.URL.Path,
+			Errors:   fields,
+		})
+		return
+	}
+	for _, p := range domainProblems {
+		if errors.Is(err, p.err) {
+			writeProblemDetails(w, problem{
+				Type:     problemTypeBase + p.kind,
+				Title:    p.title,
+				Status:   p.status,
+				Detail:   err.Error(),
+				Instance: r.URL.Path,
+			})
+			return
+		}
+	}
+	writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+}
+
+func writeProblemDetails(w http.ResponseWriter, p problem) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,17 @@
+package server
+
+import (
+	"net/http"
+
+	"users/internal/proxy"
+)
+
+// withClientIP resolves the client address of the request, looking through
+// the trusted proxies, and stores it in the context for the access log,
+// sessions, consents and the audit log.
+func (s *Server) withClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := proxy.WithClientIP(r.Context(), s.proxies.Resolve(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/purge"
+)
+
+const day = 24 * time.Hour
+
+// newPurgeScheduler builds the retention policies from PURGE_SCHEDULE, a
+// cron expression evaluated in UTC or "off", PURGE_DRY_RUN, PURGE_MAX_ROWS
+// and the retention period of each kind of data. A retention of 0 keeps
+// the data forever, except for expired tokens which are then dropped as
+// soon as they expire. The same schedule maintains the partitions of a
+// partitioned users table. It returns nil when purging is off.
+func newPurgeScheduler(db database.Purger, partitions database.Partitioner) (*purge.Scheduler, error) {
+	spec := envOr("PURGE_SCHEDULE", "0 3 * * *")
+	if spec == "off" {
+		return nil, nil
+	}
+	schedule, err := purge.ParseSchedule(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PURGE_SCHEDULE: %w", err)
+	}
+
+	policies := []purge.Policy{
+		{
+			Class:     "expired_tokens",
+			Retention: time.Duration(envInt("TOKEN_RETENTION_HOURS", 0)) * time.Hour,
+			Purge:     db.PurgeExpiredTokens,
+		},
+		{
+			Class:        "anonymized_users",
+			Retention:    time.Duration(envInt("PURGE_ANONYMIZED_AFTER_DAYS", 30)) * day,
+			MinRetention: day,
+			Purge:        db.PurgeAnonymizedUsers,
+		},
+		{
+			Class:        "audit_log",
+			Retention:    time.Duration(envInt("AUDIT_RETENTION_DAYS", 365)) * day,
+			MinRetention: 30 * day,
+			Purge:        db.TrimAuditLog,
+		},
+		{
+			Class:        "tombstones",
+			Retention:    time.Duration(envInt("TOMBSTONE_RETENTION_DAYS", 30)) * day,
+			MinRetention: day,
+			Purge:        db.TrimTombstones,
+		},
+		{
+			Class:        "dead_jobs",
+			Retention:    time.Duration(envInt("DEAD_JOB_RETENTION_DAYS", 30)) * day,
+			MinRetention: day,
+			Purge:        db.PurgeDeadJobs,
+		},
+	}
+	s, err := purge.NewScheduler(schedule, policies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retention policy: %w", err)
+	}
+	// Maintenance removes nothing and is skipped in dry runs
+	s.Jobs = append(s.Jobs, purge.Job{
+		Name: "user_partitions",
+		Run: func(ctx context.Context, limit int64, dryRun bool) (int64, error) {
+			if dryRun {
+				return 0, nil
+			}
+			return 0, partitions.MaintainUserPartitions(ctx)
+		},
+	})
+	s.DryRun = os.Getenv("PURGE_DRY_RUN") == "true"
+	s.MaxRows = int64(envInt("PURGE_MAX_ROWS", 100000))
+	s.Report = func(ctx context.Context, run models.PurgeRun) error {
+		return db.RecordPurgeRun(ctx, &run)
+	}
+	return s, nil
+}
+
+// newGrowthScheduler refreshes the growth statistics on
+// GROWTH_STATS_SCHEDULE, a cron expression evaluated in UTC or "off",
+// every hour by default. It is independent of purging, so turning purges
+// off does not leave the statistics behind. Its runs are reported like
+// purge runs. It returns nil when the schedule is off.
+func newGrowthScheduler(stats database.GrowthStatsStore, runs database.Purger) (*purge.Scheduler, error) {
+	spec := envOr("GROWTH_STATS_SCHEDULE", "0 * * * *")
+	if spec == "off" {
+		return nil, nil
+	}
+	schedule, err := purge.ParseSchedule(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GROWTH_STATS_SCHEDULE: %w", err)
+	}
+	return &purge.Scheduler{
+		Schedule: schedule,
+		Jobs: []purge.Job{{
+			Name: "user_growth_stats",
+			Run: func(ctx context.Context, limit int64, dryRun bool) (int64, error) {
+				return stats.RefreshGrowthStats(ctx)
+			},
+		}},
+		Report: func(ctx context.Context, run models.PurgeRun) error {
+			return runs.RecordPurgeRun(ctx, &run)
+		},
+	}, nil
+}
+
+// listPurgeRunsHandler reports what the retention jobs removed, newest
+// run first, optionally for one job.
+func (s *Server) listPurgeRunsHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	runs, err := s.db.ListPurgeRuns(r.Context(), r.URL.Query().Get("job"), page)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
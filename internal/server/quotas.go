@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// listQuotasHandler returns every quota as it applies to the tenant of the
+// request, with what the tenant uses of it.
+func (s *Server) listQuotasHandler(w http.ResponseWriter, r *http.Request) {
+	quotas, err := s.db.ListQuotas(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quotas)
+}
+
+// setQuotaHandler overrides a quota for the tenant of the request. Only the
+// operator may, so tenants cannot raise their own limits.
+func (s *Server) setQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Limit *int64 `json:"limit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if req.Limit == nil || *req.Limit < 0 {
+		writeProblem(w, r, "limit is required and must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	quota, err := s.db.SetQuota(r.Context(), chi.URLParam(r, "name"), *req.Limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quota)
+}
+
+// deleteQuotaHandler removes the tenant's override, so the configured
+// default applies again.
+func (s *Server) deleteQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.DeleteQuota(r.Context(), chi.URLParam(r, "name")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"users/internal/database"
+)
+
+// readModelBatch is how many changes one refresh applies.
+const readModelBatch = 500
+
+// refreshReadModel keeps the user directory read model up to date until ctx
+// is done, every interval or right away while changes are backed up. It
+// returns at once unless DB_READ_MODEL enables the read model.
+func (s *Server) refreshReadModel(ctx context.Context, interval time.Duration) {
+	for {
+		n, err := s.db.RefreshUserDirectory(ctx, readModelBatch)
+		if errors.Is(err, database.ErrReadModelDisabled) {
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error refreshing the user directory: %v", err)
+		}
+		if err == nil && n == readModelBatch {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -1,14 +1,20 @@
 package server
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"slices"
 
 	"github.com/go-chi/chi/v5"
 
+	"users/internal/database"
+	"users/internal/events"
 	"users/internal/models"
+	"users/internal/patch"
 	"users/internal/validator"
 
 	"github.com/go-chi/chi/v5/middleware"
@@ -16,19 +22,210 @@ import (
 
 func (s *Server) RegisterRoutes() http.Handler {
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, r, "No such endpoint", http.StatusNotFound)
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, r, "Method not allowed for this endpoint", http.StatusMethodNotAllowed)
+	})
+	r.Use(s.withClientIP)
+	r.Use(s.logAccess)
+	r.Use(s.withCORS)
+	r.Use(s.failFast)
+	r.Use(s.limitBody)
+	r.Use(s.withTenant)
+	r.Use(s.withFlags)
+	r.Use(s.withSession)
+	r.Use(s.withAPIKey)
+	r.Use(s.rejectSuspended)
 
 	r.Get("/", s.HelloWorldHandler)
 
 	r.Get("/health", s.healthHandler)
+	r.Get("/ready", s.readyHandler)
+	if s.metricsToken != "" {
+		r.Handle("/metrics", s.metricsHandler())
+	}
 
-	r.Post("/users", s.createUserHandler)
+	// OAuth redirect URIs are registered with the providers, so the
+	// browser flow stays outside of the versioned API.
+	r.Get("/auth/{provider}/login", s.oauthLoginHandler)
+	r.Get("/auth/{provider}/callback", s.oauthCallbackHandler)
 
-	r.Get("/user/{id}", s.getUserByID)
-	r.Patch("/user/{id}", s.updateUserHandler)
+	r.Route("/api/v1", s.v1Routes)
+	r.Group(func(r chi.Router) {
+		r.Use(deprecated("/api/v1"))
+		s.legacyRoutes(r)
+	})
 	return r
 }
 
+// v1Routes registers version 1 of the API, mounted under /api/v1. A later
+// version gets its own function and mount point next to it.
+func (s *Server) v1Routes(r chi.Router) {
+	s.apiRoutes(r, "/users/{id}")
+}
+
+// legacyRoutes registers the unversioned paths that predate /api/v1. They
+// behave like v1, except that single users live under /user/{id}.
+func (s *Server) legacyRoutes(r chi.Router) {
+	s.apiRoutes(r, "/user/{id}")
+}
+
+// apiRoutes registers the endpoints shared by v1 and the legacy paths,
+// with user as the path of a single user.
+func (s *Server) apiRoutes(r chi.Router, user string) {
+	// Lists and exports can be large, everything else is small enough
+	// that compressing it costs more than it saves.
+	compress := middleware.Compress(5, "application/json")
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.requireScope(models.ScopeUsersRead))
+
+		r.With(compress).Get("/users", s.listUsersHandler)
+		r.Get("/users/count", s.countUsersHandler)
+		r.With(compress).Get("/users/search", s.searchUsersHandler)
+		r.With(compress).Get("/users/changes", s.userChangesHandler)
+		r.Get("/users/stream", s.streamUsersHandler)
+		r.Get("/usernames/{username}", s.usernameAvailabilityHandler)
+		r.Get(user, s.getUserByID)
+		r.Get(user+"/metadata", s.getMetadataHandler)
+		r.Get(user+"/groups", s.listUserGroupsHandler)
+		r.Get(user+"/duplicates", s.userDuplicatesHandler)
+		r.Get(user+"/preferences", s.getPreferencesHandler)
+		r.Get(user+"/consents", s.listConsentsHandler)
+		r.Get("/groups", s.listGroupsHandler)
+		r.Get("/groups/{id}", s.getGroupHandler)
+		r.Get("/groups/{id}/members", s.listGroupMembersHandler)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(s.requireScope(models.ScopeUsersWrite))
+
+		r.Post("/users", s.idempotent(s.createUserHandler))
+		r.Patch("/users", s.bulkUpdateUsersHandler)
+		r.Put("/users/by-email", s.upsertUserHandler)
+		r.Patch(user, s.updateUserHandler)
+		r.Delete(user, s.deleteUserHandler)
+		r.Put(user+"/tags/{tag}", s.addTagHandler)
+		r.Delete(user+"/tags/{tag}", s.removeTagHandler)
+		r.Patch(user+"/preferences", s.updatePreferencesHandler)
+		r.Post(user+"/consents", s.recordConsentHandler)
+		r.Put(user+"/metadata", s.putMetadataHandler)
+		r.Patch(user+"/metadata", s.patchMetadataHandler)
+		r.Post("/groups", s.createGroupHandler)
+		r.Patch("/groups/{id}", s.updateGroupHandler)
+		r.Delete("/groups/{id}", s.deleteGroupHandler)
+		r.Put("/groups/{id}/members/{userID}", s.addGroupMemberHandler)
+		r.Delete("/groups/{id}/members/{userID}", s.removeGroupMemberHandler)
+	})
+
+	r.Post("/login", s.loginHandler)
+	r.Post("/email/confirm", s.confirmEmailHandler)
+	r.Post("/email/verify", s.requestEmailVerificationHandler)
+	r.Post("/password/reset", s.requestPasswordResetHandler)
+	r.Post("/password/reset/confirm", s.confirmPasswordResetHandler)
+	r.Post("/auth/2fa", s.verifyLoginTOTPHandler)
+	r.Post("/logout", s.logoutHandler)
+	r.Route("/me", func(r chi.Router) {
+		r.Use(s.requireSession)
+
+		r.Get("/", s.meHandler)
+		r.Get("/consents", s.listMyConsentsHandler)
+		r.With(s.forbidImpersonation).Post("/consents", s.recordMyConsentHandler)
+
+		// Everything else waits for the current terms of service to be
+		// accepted
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireConsent)
+
+			r.Get("/preferences", s.getMyPreferencesHandler)
+			r.Patch("/preferences", s.updateMyPreferencesHandler)
+			r.Get("/sessions", s.listMySessionsHandler)
+			r.Get("/identities", s.listIdentitiesHandler)
+
+			r.Group(func(r chi.Router) {
+				r.Use(s.forbidImpersonation)
+
+				r.Post("/password", s.changePasswordHandler)
+				r.Delete("/sessions/{id}", s.revokeMySessionHandler)
+				r.Get("/identities/{provider}/link", s.linkIdentityHandler)
+				r.Delete("/identities/{provider}", s.unlinkIdentityHandler)
+				r.Post("/2fa/enroll", s.enrollTOTPHandler)
+				r.Post("/2fa/enable", s.enableTOTPHandler)
+				r.Post("/2fa/disable", s.disableTOTPHandler)
+				r.Post("/2fa/recovery-codes", s.regenerateRecoveryCodesHandler)
+			})
+		})
+	})
+
+	r.Route("/admin", func(r chi.Router) {
+		// Routes shared by all tenants are the operator's alone
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireOperator)
+
+			r.Get("/webhooks", s.listWebhooksHandler)
+			r.Post("/webhooks", s.createWebhookHandler)
+			r.Get("/webhooks/{id}", s.getWebhookHandler)
+			r.Delete("/webhooks/{id}", s.deleteWebhookHandler)
+			r.Get("/webhooks/{id}/deliveries", s.listWebhookDeliveriesHandler)
+
+			r.Get("/jobs", s.listJobsHandler)
+			r.Post("/jobs/{id}/retry", s.retryJobHandler)
+			r.Get("/purge/runs", s.listPurgeRunsHandler)
+
+			r.Get("/flags", s.listFlagsHandler)
+			r.Put("/flags/{name}", s.setFlagHandler)
+			r.Delete("/flags/{name}", s.deleteFlagHandler)
+
+			r.Put("/quotas/{name}", s.setQuotaHandler)
+			r.Delete("/quotas/{name}", s.deleteQuotaHandler)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireAdmin)
+
+			r.Get("/api-keys", s.listAPIKeysHandler)
+			r.Post("/api-keys", s.createAPIKeyHandler)
+			r.Delete("/api-keys/{id}", s.revokeAPIKeyHandler)
+
+			r.Get("/stats/users", s.userStatsHandler)
+			r.Get("/stats/growth", s.growthStatsHandler)
+
+			r.Get("/audit", s.listAuditHandler)
+			r.With(compress).Get("/audit/export", s.exportAuditHandler)
+
+			r.Get("/templates", s.listTemplatesHandler)
+			r.Get("/templates/{name}/{locale}", s.getTemplateHandler)
+			r.Put("/templates/{name}/{locale}", s.putTemplateHandler)
+			r.Delete("/templates/{name}/{locale}", s.deleteTemplateHandler)
+
+			r.Get("/quotas", s.listQuotasHandler)
+
+			r.Get("/exports", s.listExportsHandler)
+			r.Post("/exports", s.createExportHandler)
+			r.Get("/exports/{id}", s.getExportHandler)
+			r.Get("/exports/{id}/download", s.downloadExportHandler)
+			r.Delete("/exports/{id}", s.deleteExportHandler)
+
+			r.Delete("/users", s.bulkDeleteUsersHandler)
+			r.Post("/users/suspend", s.bulkSuspendUsersHandler)
+			r.Post("/users/activate", s.bulkActivateUsersHandler)
+			r.With(compress).Get("/users/{id}/export", s.exportUserHandler)
+			r.Post("/users/{id}/anonymize", s.anonymizeUserHandler)
+			r.Post("/users/{id}/merge", s.mergeUsersHandler)
+			r.Get("/users/{id}/snapshot", s.snapshotUserHandler)
+			r.Post("/users/{id}/restore", s.restoreUserHandler)
+			r.Post("/users/{id}/unlock", s.unlockUserHandler)
+			r.Post("/users/{id}/suspend", s.suspendUserHandler)
+			r.Post("/users/{id}/activate", s.activateUserHandler)
+			r.Post("/users/{id}/impersonate", s.impersonateUserHandler)
+			r.Delete("/impersonations/{id}", s.endImpersonationHandler)
+			r.Get("/users/{id}/sessions", s.listUserSessionsHandler)
+			r.Delete("/users/{id}/sessions", s.revokeUserSessionsHandler)
+		})
+	})
+}
+
 func (s *Server) HelloWorldHandler(w http.ResponseWriter, r *http.Request) {
 	resp := make(map[string]string)
 	resp["message"] = "Hello World"
@@ -41,72 +238,231 @@ func (s *Server) HelloWorldHandler(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(jsonResp)
 }
 
-func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
-	jsonResp, _ := json.Marshal(s.db.Health())
-	_, _ = w.Write(jsonResp)
-}
-
 func (s *Server) createUserHandler(w http.ResponseWriter, r *http.Request) {
-	var user models.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var req struct {
+		models.User
+		Password string `json:"password"`
+	}
+	if !s.decodeJSON(w, r, &req) {
 		return
 	}
+	user := req.User
 
 	if err := validator.ValidateUser(&user); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
+	if req.Password != "" {
+		var ok bool
+		if user.PasswordHash, ok = s.hashPassword(w, r, "password", req.Password); !ok {
+			return
+		}
+	}
 
-	if err := s.db.CreateUser(&user); err != nil {
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+	created, err := s.db.CreateUser(r.Context(), &user)
+	if err != nil {
+		if err == database.ErrUserExists {
+			// Creating a user again under the ID the client chose for it
+			// returns it, so clients can retry without an idempotency key
+			existing, gerr := s.db.GetUserByID(r.Context(), user.ID)
+			if gerr == nil && existing.Email == user.Email {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(existing)
+				return
+			}
+		}
+		if err == database.ErrEmailTaken || err == database.ErrUsernameTaken || err == database.ErrUserExists || errors.Is(err, database.ErrInvalidID) || errors.Is(err, database.ErrQuotaExceeded) {
+			writeError(w, r, err)
+			return
+		}
+		writeProblem(w, r, "Failed to create user", http.StatusInternalServerError)
 		return
 	}
+	s.events.Publish(events.New(r.Context(), events.UserCreated, created))
+	s.sendWelcome(r, created)
+	s.requestEmailVerification(r, created)
+	s.warnDuplicates(w, r, created)
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(created)
 }
 
 func (s *Server) getUserByID(w http.ResponseWriter, r *http.Request) {
-	user, err := s.db.GetUserByID(chi.URLParam(r, "id"))
+	fields := parseFields(r)
+	if err := validator.ValidateFields(fields); err != nil {
+		writeError(w, r, validator.Field("fields", err))
+		return
+	}
+
+	// The caching headers need the version and modification time
+	selected := fields
+	if len(fields) > 0 {
+		selected = slices.Clone(fields)
+		for _, f := range []string{"version", "updated_at"} {
+			if !slices.Contains(selected, f) {
+				selected = append(selected, f)
+			}
+		}
+	}
+
+	user, err := s.db.GetUserByID(r.Context(), chi.URLParam(r, "id"), selected...)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			http.Error(w, "User not found", http.StatusNotFound)
+			writeProblem(w, r, "User not found", http.StatusNotFound)
 			return
 		}
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if notModified(w, r, user, fields...) {
 		return
 	}
 
 	// Respond with the user's details
 	w.Header().Set("Content-Type", "application/json")
+	if len(fields) > 0 {
+		json.NewEncoder(w).Encode(projectFields(user, fields))
+		return
+	}
 	json.NewEncoder(w).Encode(user)
 }
 
 func (s *Server) updateUserHandler(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	var updates models.UserUpdate
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		writeProblem(w, r, "If-Match header is required", http.StatusPreconditionRequired)
+		return
+	}
+	version, err := parseIfMatch(ifMatch)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	switch mediaType(r) {
+	case patch.JSONPatchContentType, patch.MergePatchContentType:
+		var ok bool
+		if updates, ok = s.decodePatch(w, r, id); !ok {
+			return
+		}
+		if updates == (models.UserUpdate{}) {
+			s.getUserByID(w, r)
+			return
+		}
+	default:
+		if !s.decodeJSON(w, r, &updates) {
+			return
+		}
+	}
+
 	if err := validator.ValidateUserUpdate(&updates); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	updatedUser, err := s.db.UpdateUserByID(id, updates)
+	if version != nil {
+		updates.Version = version
+	}
+	if updates.Email != nil {
+		inUse, err := s.emailInUse(r, id, *updates.Email)
+		if err != nil {
+			writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if inUse {
+			writeError(w, r, database.ErrEmailTaken)
+			return
+		}
+	}
+
+	var updatedUser *models.User
+	var result *dryRunResult
+	if dryRun {
+		result, err = s.dryRun(r.Context(), []string{id}, false, func(ctx context.Context) ([]models.User, error) {
+			user, err := s.db.UpdateUserByID(ctx, id, updates)
+			if err != nil {
+				return nil, err
+			}
+			return []models.User{*user}, nil
+		})
+	} else {
+		updatedUser, err = s.db.UpdateUserByID(r.Context(), id, updates)
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
-			http.Error(w, "User not found", http.StatusNotFound)
+			writeProblem(w, r, "User not found", http.StatusNotFound)
 			return
 		}
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		if err == database.ErrVersionConflict || err == database.ErrNoFieldsToUpdate {
+			writeError(w, r, err)
+			return
+		}
+		if err == database.ErrEmailTaken || err == database.ErrUsernameTaken {
+			writeError(w, r, err)
+			return
+		}
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if dryRun {
+		writeDryRun(w, result)
 		return
 	}
 
+	if updates.Email != nil && updatedUser.PendingEmail != "" {
+		s.requestEmailConfirmation(r, updatedUser)
+	}
+	s.events.Publish(events.New(r.Context(), events.UserUpdated, updatedUser))
+
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(updatedUser))
 	json.NewEncoder(w).Encode(updatedUser)
 }
+
+func (s *Server) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var user *models.User
+	var result *dryRunResult
+	if dryRun {
+		result, err = s.dryRun(r.Context(), []string{id}, true, func(ctx context.Context) ([]models.User, error) {
+			user, err := s.db.DeleteUserByID(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			return []models.User{*user}, nil
+		})
+	} else {
+		user, err = s.db.DeleteUserByID(r.Context(), id)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeProblem(w, r, "User not found", http.StatusNotFound)
+			return
+		}
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if dryRun {
+		writeDryRun(w, result)
+		return
+	}
+	s.revokeSessions(r, user.ID)
+	s.events.Publish(events.New(r.Context(), events.UserDeleted, user))
+
+	w.WriteHeader(http.StatusNoContent)
+}
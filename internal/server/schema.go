@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"users/internal/database"
+	"users/internal/health"
+)
+
+// Ways of handling a schema that is behind the embedded migrations at
+// startup, chosen with MIGRATION_MODE.
+const (
+	// migrateCheck serves requests but reports not ready until an
+	// operator migrates.
+	migrateCheck = "check"
+	// migrateAuto applies pending migrations before serving.
+	migrateAuto = "auto"
+	// migrateWait blocks startup until an operator migrates.
+	migrateWait = "wait"
+)
+
+// prepareSchema brings up the schema as mode says. It returns once the
+// server may start, which in wait mode is when the schema is current.
+func prepareSchema(ctx context.Context, db database.Service, mode string, interval time.Duration) error {
+	switch mode {
+	case migrateCheck:
+		if err := schemaCurrent(db.Health()); err != nil {
+			log.Printf("Not ready: %v", err)
+		}
+		return nil
+	case migrateAuto:
+		if err := db.Migrate(ctx); err != nil {
+			return fmt.Errorf("migrating on boot: %w", err)
+		}
+		return schemaCurrent(db.Health())
+	case migrateWait:
+		for {
+			err := schemaCurrent(db.Health())
+			if err == nil {
+				return nil
+			}
+			log.Printf("Waiting for migrations: %v", err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+	default:
+		return fmt.Errorf("invalid MIGRATION_MODE %q, want %s, %s or %s", mode, migrateCheck, migrateAuto, migrateWait)
+	}
+}
+
+// schemaCurrent reports why the schema in report does not match the
+// embedded migrations, if it does not.
+func schemaCurrent(report database.HealthReport) error {
+	switch schema := report.Schema; {
+	case report.Status != "up":
+		return fmt.Errorf("database is down: %s", report.Error)
+	case schema == nil:
+		return errors.New("schema version unavailable")
+	case schema.Dirty:
+		return fmt.Errorf("schema is dirty at version %d", schema.Version)
+	case schema.Pending:
+		return fmt.Errorf("schema is at version %d, migrations up to %d are pending", schema.Version, schema.Latest)
+	}
+	return nil
+}
+
+// newReadinessRegistry holds the checks /ready answers with: the database
+// must be up and its schema current.
+func (s *Server) newReadinessRegistry() *health.Registry {
+	registry := health.NewRegistry()
+	registry.Register(health.Check{
+		Name:    "schema",
+		Timeout: envDuration("HEALTH_DATABASE_TIMEOUT", 2*time.Second),
+		Run: func(ctx context.Context) (any, error) {
+			report := s.db.Health()
+			return report.Schema, schemaCurrent(report)
+		},
+	})
+	return registry
+}
+
+// readyHandler answers 503 until the server can take traffic. Unlike
+// /health, which is about restarting a broken instance, it fails while
+// waiting for an operator to migrate.
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	report := s.readiness.Run(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status == health.StatusDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/searchindex"
+	"users/internal/tenant"
+)
+
+// searchIndexBatch is how many changes one sync writes to the index.
+const searchIndexBatch = 500
+
+// syncSearchIndex mirrors the change feed into the search index until ctx
+// is done, every interval or right away while changes are backed up.
+func (s *Server) syncSearchIndex(ctx context.Context, interval time.Duration) {
+	for {
+		n, err := s.db.SyncUserFeed(ctx, searchindex.Consumer, searchIndexBatch, s.searchIndex.Apply)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error syncing the search index: %v", err)
+		}
+		if err == nil && n == searchIndexBatch {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// fuzzyUnsupported reports whether name is a list filter the search index
+// cannot apply; it supports status, tags_any and tags_all.
+func fuzzyUnsupported(name string) bool {
+	switch name {
+	case "email", "username", "inactive_days", "created_after", "created_before":
+		return true
+	}
+	return strings.HasPrefix(name, "metadata.")
+}
+
+// fuzzySearchHandler serves GET /users/search?fuzzy=true from the search
+// index, tolerating typos. Matches are loaded from the database, so users
+// deleted since they were indexed are left out.
+func (s *Server) fuzzySearchHandler(w http.ResponseWriter, r *http.Request, q string, page database.Page) {
+	if s.searchIndex == nil {
+		writeProblem(w, r, "Fuzzy search is not configured", http.StatusBadRequest)
+		return
+	}
+	for name := range r.URL.Query() {
+		if fuzzyUnsupported(name) {
+			writeProblem(w, r, "query parameter "+name+" is not supported with fuzzy=true", http.StatusBadRequest)
+			return
+		}
+	}
+	filter, err := parseUserFilter(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page = page.Normalize()
+	ids, total, err := s.searchIndex.Search(r.Context(), tenant.FromContext(r.Context()), q,
+		searchindex.Filter{Status: filter.Status, TagsAny: filter.TagsAny, TagsAll: filter.TagsAll},
+		page.Limit, page.Offset)
+	if err != nil {
+		log.Printf("Error searching the search index: %v", err)
+		writeProblem(w, r, "Search is temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	found, err := s.db.GetUsersByIDs(r.Context(), ids)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	byID := make(map[string]models.User, len(found))
+	for _, u := range found {
+		byID[u.ID] = u
+	}
+	users := make([]models.User, 0, len(ids))
+	for _, id := range ids {
+		if u, ok := byID[id]; ok {
+			users = append(users, u)
+		}
+	}
+	writePage(w, r, users, total, page)
+}
@@ -1,30 +1,105 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 
+	"users/internal/activity"
 	"users/internal/database"
+	"users/internal/events"
+	"users/internal/flags"
+	"users/internal/health"
+	"users/internal/mail"
+	"users/internal/oauth"
+	"users/internal/proxy"
+	"users/internal/purge"
+	"users/internal/searchindex"
+	"users/internal/session"
+	"users/internal/storage"
+	"users/internal/webhooks"
+	"users/internal/worker"
 )
 
 type Server struct {
 	port int
 
 	db database.Service
+	// breaker wraps db; requests are turned away while it is open.
+	breaker *database.CircuitBreaker
+
+	// settings holds the tunables that are reloaded on SIGHUP.
+	settings atomic.Pointer[settings]
+
+	events     *events.Bus
+	adminToken string
+	// metricsToken lets scrapers read /metrics; see metricsHandler.
+	metricsToken string
+
+	sessions *session.Manager
+	oauth    map[string]*oauth.Provider
+
+	activity *activity.Tracker
+	// jobs runs background work such as sending mail.
+	jobs *worker.Pool
+	// purger queues the purge jobs on their schedule; nil when off.
+	purger *purge.Scheduler
+	// growth queues the growth statistics refresh; nil when off.
+	growth *purge.Scheduler
+	// dispatcher delivers events to webhooks.
+	dispatcher *webhooks.Dispatcher
+	// exports runs export jobs, which write their files to exportStore.
+	exports     *worker.Pool
+	exportStore storage.Store
+
+	cors corsPolicy
+	// maxBodyBytes caps request bodies; 0 disables the limit.
+	maxBodyBytes int64
+	// proxies are the proxies whose forwarding headers name the client.
+	proxies *proxy.Trusted
+
+	mail            mail.Sender
+	emailConfirmURL string
+	// passwordResetURL is the frontend page reset tokens are linked to.
+	passwordResetURL string
+
+	flags *flags.Flags
+
+	// health holds the checks reported by /health.
+	health *health.Registry
+	// readiness holds the checks reported by /ready.
+	readiness *health.Registry
+
+	// searchIndex serves fuzzy searches; nil unless SEARCH_INDEX_URL is set.
+	searchIndex *searchindex.Index
 }
 
 func NewServer() *http.Server {
+	if err := checkConfig(); err != nil {
+		log.Fatal(err)
+	}
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
-	NewServer := &Server{
-		port: port,
-
-		db: database.New(),
+	db, err := database.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	migrationMode := envOr("MIGRATION_MODE", migrateCheck)
+	if err := prepareSchema(context.Background(), db, migrationMode, envDuration("MIGRATION_WAIT_INTERVAL", 5*time.Second)); err != nil {
+		log.Fatal(err)
 	}
+	NewServer, err := New(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	NewServer.port = port
+	NewServer.start(context.Background())
 
 	// Declare Server config
 	server := &http.Server{
@@ -37,3 +112,205 @@ func NewServer() *http.Server {
 
 	return server
 }
+
+// Option changes how New builds a server.
+type Option func(*Server)
+
+// WithAdminToken replaces the ADMIN_TOKEN of the environment.
+func WithAdminToken(token string) Option {
+	return func(s *Server) { s.adminToken = token }
+}
+
+// WithMailer sends mail through sender instead of the MAIL_* settings.
+func WithMailer(sender mail.Sender) Option {
+	return func(s *Server) { s.mail = sender }
+}
+
+// WithSessionStore keeps sessions in store instead of SESSION_STORE.
+func WithSessionStore(store session.Store) Option {
+	return func(s *Server) { s.sessions.Store = store }
+}
+
+// WithExportStore keeps export files in store instead of EXPORT_STORAGE.
+func WithExportStore(store storage.Store) Option {
+	return func(s *Server) { s.exportStore = store }
+}
+
+// WithEvents publishes the server's events on bus, so callers can
+// subscribe to them.
+func WithEvents(bus *events.Bus) Option {
+	return func(s *Server) { s.events = bus }
+}
+
+// New returns a server answering from db, configured by the environment
+// and opts, without starting its background work or listening anywhere,
+// so its handlers can be driven directly as by tests. NewServer builds on
+// it.
+func New(db database.Service, opts ...Option) (*Server, error) {
+	cfg, err := loadSettings()
+	if err != nil {
+		return nil, err
+	}
+	mailer, err := mail.NewFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	flagConfig, err := loadFlagConfig()
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := proxy.FromEnv()
+	if err != nil {
+		return nil, err
+	}
+	exportStore, err := storage.FromEnv()
+	if err != nil {
+		return nil, err
+	}
+	cors, err := corsPolicyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	breaker := database.WithCircuitBreaker(db)
+	s := &Server{
+		db:      breaker,
+		breaker: breaker,
+
+		events:       events.NewBus(),
+		adminToken:   os.Getenv("ADMIN_TOKEN"),
+		metricsToken: os.Getenv("METRICS_TOKEN"),
+
+		sessions: newSessionManager(),
+		oauth:    newOAuthProviders(),
+
+		cors:         cors,
+		maxBodyBytes: int64(envInt("MAX_REQUEST_BODY_BYTES", defaultMaxBodyBytes)),
+		proxies:      proxies,
+		exportStore:  exportStore,
+
+		mail:             mailer,
+		emailConfirmURL:  os.Getenv("EMAIL_CONFIRM_URL"),
+		passwordResetURL: os.Getenv("PASSWORD_RESET_URL"),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.settings.Store(cfg)
+	s.flags = flags.New(s.db, flagConfig)
+
+	s.activity = activity.NewTracker(s.db)
+	s.activity.Interval = envDuration("ACTIVITY_FLUSH_INTERVAL", s.activity.Interval)
+	s.searchIndex = searchindex.FromEnv()
+
+	s.dispatcher = webhooks.NewDispatcher(s.db)
+	s.events.Subscribe(s.dispatcher.Handle)
+
+	if s.purger, err = newPurgeScheduler(s.db, s.db); err != nil {
+		return nil, err
+	}
+	if s.growth, err = newGrowthScheduler(s.db, s.db); err != nil {
+		return nil, err
+	}
+	s.jobs = s.newWorkerPool(s.purger, s.growth)
+	s.exports = s.newExportPool()
+
+	s.health = s.newHealthRegistry(s.dispatcher)
+	s.readiness = s.newReadinessRegistry()
+	return s, nil
+}
+
+// start runs the background work of the server until ctx is done: config
+// reloads, flag refreshes, activity flushes, the read model, webhook
+// deliveries, workers, the purge and growth statistics schedules and the
+// debug listener.
+func (s *Server) start(ctx context.Context) {
+	go s.reloadOnSignal(ctx)
+	go s.flags.Run(ctx, envDuration("FEATURE_FLAGS_REFRESH", 30*time.Second))
+	// Background work sees the same flags as requests
+	background := flags.NewContext(ctx, s.flags)
+
+	go s.activity.Run(ctx)
+	if s.searchIndex != nil {
+		go s.syncSearchIndex(ctx, envDuration("SEARCH_INDEX_SYNC_INTERVAL", 2*time.Second))
+	}
+	go s.refreshReadModel(ctx, envDuration("READ_MODEL_REFRESH_INTERVAL", 2*time.Second))
+	go s.dispatcher.Run(ctx)
+
+	go s.jobs.Run(background)
+	go s.RunExports(ctx)
+	if s.purger != nil {
+		go s.purger.Run(background)
+	}
+	if s.growth != nil {
+		go s.growth.Run(background)
+	}
+
+	if port := envInt("DEBUG_PORT", 0); port > 0 {
+		go s.serveDebug(port)
+	}
+}
+
+func newSessionManager() *session.Manager {
+	ttl, err := time.ParseDuration(os.Getenv("SESSION_TTL"))
+	if err != nil || ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+
+	var store session.Store = session.NewMemoryStore()
+	if os.Getenv("SESSION_STORE") == "redis" {
+		store, err = session.NewRedisStore(os.Getenv("REDIS_URL"))
+		if err != nil {
+			log.Fatalf("invalid REDIS_URL: %v", err)
+		}
+	}
+
+	return &session.Manager{
+		Store:      store,
+		TTL:        ttl,
+		CookieName: "session",
+		Secure:     os.Getenv("SESSION_COOKIE_SECURE") != "false",
+	}
+}
+
+// envOr returns the environment variable key, or fallback when it is empty.
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// envInt returns the environment variable key as an integer, or fallback
+// when it is unset or invalid.
+func envInt(key string, fallback int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || v < 0 {
+		return fallback
+	}
+	return v
+}
+
+// envDuration returns the environment variable key as a duration, or
+// fallback when it is unset or not positive.
+func envDuration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+// failFast turns requests away while the database circuit breaker is open
+// instead of letting each of them fail on its own. Health, readiness and
+// metrics stay reachable so operators can watch the database recover.
+func (s *Server) failFast(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" && r.URL.Path != "/ready" && r.URL.Path != "/metrics" && !s.breaker.Ready() {
+			seconds := int(s.breaker.RetryAfter().Seconds()) + 1
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeProblem(w, r, "Service temporarily unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
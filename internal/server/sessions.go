@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/auth"
+	"users/internal/session"
+	"users/internal/tenant"
+)
+
+// withSession resolves the session cookie and, for authenticated requests,
+// attributes the request to the session's user and tenant. Requests of an
+// impersonation session are attributed to the admin acting as the user.
+func (s *Server) withSession(next http.Handler) http.Handler {
+	return s.sessions.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := session.FromContext(r.Context())
+		if ok && !sess.MFAPending {
+			ctx := tenant.WithTenant(r.Context(), sess.TenantID)
+			if sess.ImpersonatedBy != "" {
+				ctx = auth.WithActor(ctx, sess.ImpersonatedBy+" as user:"+sess.UserID)
+				w.Header().Set(impersonationHeader, sess.ImpersonatedBy)
+			} else {
+				ctx = auth.WithActor(ctx, "user:"+sess.UserID)
+				s.activity.Seen(sess.TenantID, sess.UserID)
+			}
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// requireSession rejects requests without a valid session.
+func (s *Server) requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sess, ok := session.FromContext(r.Context()); !ok || sess.MFAPending {
+			writeProblem(w, r, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.sessions.End(r.Context(), w, r); err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listMySessionsHandler(w http.ResponseWriter, r *http.Request) {
+	sess, _ := session.FromContext(r.Context())
+	s.writeSessions(w, r, sess.UserID)
+}
+
+func (s *Server) revokeMySessionHandler(w http.ResponseWriter, r *http.Request) {
+	sess, _ := session.FromContext(r.Context())
+
+	target, err := s.sessions.Store.Get(r.Context(), chi.URLParam(r, "id"))
+	if err == session.ErrNotFound || (err == nil && (target.UserID != sess.UserID || target.TenantID != sess.TenantID)) {
+		writeProblem(w, r, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.sessions.Store.Delete(r.Context(), target.ID); err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeSessions(w, r, chi.URLParam(r, "id"))
+}
+
+func (s *Server) revokeUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.sessions.Store.DeleteByUser(r.Context(), tenant.FromContext(r.Context()), chi.URLParam(r, "id")); err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) writeSessions(w http.ResponseWriter, r *http.Request, userID string) {
+	sessions, err := s.sessions.Store.ListByUser(r.Context(), tenant.FromContext(r.Context()), userID)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// revokeSessions ends every session of a user, logging failures since the
+// caller has already committed the change that requires it.
+func (s *Server) revokeSessions(r *http.Request, userID string) {
+	if err := s.sessions.Store.DeleteByUser(r.Context(), tenant.FromContext(r.Context()), userID); err != nil {
+		log.Printf("Error revoking sessions of user %s: %v", userID, err)
+	}
+}
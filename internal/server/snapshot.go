@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/events"
+	"users/internal/models"
+	"users/internal/validator"
+)
+
+func (s *Server) snapshotUserHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	snapshot, err := s.db.SnapshotUser(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%s-v%d.json"`, id, snapshot.User.Version))
+	w.Header().Set("ETag", etag(snapshot.User))
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// restoreUserHandler puts back a snapshot taken with snapshotUserHandler.
+// If-Match names the current version of the user, so edits made after the
+// operator looked at the user are not overwritten unseen.
+func (s *Server) restoreUserHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		writeProblem(w, r, "If-Match header is required", http.StatusPreconditionRequired)
+		return
+	}
+	version, err := parseIfMatch(ifMatch)
+	if err != nil || version == nil {
+		writeProblem(w, r, "If-Match must name the version of the user to overwrite", http.StatusBadRequest)
+		return
+	}
+
+	var snapshot models.UserSnapshot
+	if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if err := validator.ValidateUserSnapshot(&snapshot); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if snapshot.User.ID != id {
+		writeProblem(w, r, "Snapshot is of another user", http.StatusBadRequest)
+		return
+	}
+	// The newsletter stays off for users who withdrew marketing consent
+	// after the snapshot was taken
+	if prefs := snapshot.Preferences; prefs != nil && prefs.Newsletter {
+		ok, err := s.hasConsent(r.Context(), id, models.ConsentMarketing, "")
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		prefs.Newsletter = ok
+	}
+
+	user, err := s.db.RestoreUserSnapshot(r.Context(), &snapshot, *version)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.events.Publish(events.New(r.Context(), events.UserUpdated, user))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(user))
+	json.NewEncoder(w).Encode(user)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 366
+)
+
+func (s *Server) countUsersHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseUserFilter(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	count, err := s.db.CountUsers(r.Context(), filter)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"count": count})
+}
+
+func (s *Server) userStatsHandler(w http.ResponseWriter, r *http.Request) {
+	days := defaultStatsDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxStatsDays {
+			writeProblem(w, r, errInvalidParam("days").Error(), http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	stats, err := s.db.UserStats(r.Context(), days)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// growthStatsHandler returns the materialized daily growth between the
+// from and to dates, both included, by default the last defaultStatsDays
+// days.
+func (s *Server) growthStatsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if v := query.Get("to"); v != "" {
+		t, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			writeProblem(w, r, errInvalidParam("to").Error(), http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, 1-defaultStatsDays)
+	if v := query.Get("from"); v != "" {
+		t, err := time.Parse(time.DateOnly, v)
+		if err != nil || t.After(to) || to.Sub(t) >= maxStatsDays*24*time.Hour {
+			writeProblem(w, r, errInvalidParam("from").Error(), http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+
+	stats, err := s.db.GetGrowthStats(r.Context(), from, to)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
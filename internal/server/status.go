@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/database"
+	"users/internal/events"
+	"users/internal/models"
+	"users/internal/session"
+)
+
+// rejectSuspended refuses requests made with the session of a suspended
+// or merged user. Suspending a user also ends their sessions, so this only catches
+// sessions started concurrently or on a lagging session store.
+func (s *Server) rejectSuspended(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := session.FromContext(r.Context())
+		if !ok || sess.MFAPending {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, err := s.db.GetUserByID(r.Context(), sess.UserID, "status")
+		if err != nil && err != sql.ErrNoRows {
+			writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err == nil && user.Status == models.StatusSuspended {
+			writeProblem(w, r, "Account is suspended", http.StatusForbidden)
+			return
+		}
+		if err == nil && user.Status == models.StatusMerged {
+			writeProblem(w, r, "Account was merged into another", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) suspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.transitionUser(w, r, s.db.SuspendUser)
+	if !ok {
+		return
+	}
+	s.revokeSessions(r, user.ID)
+	s.writeTransitionedUser(w, r, user)
+}
+
+func (s *Server) activateUserHandler(w http.ResponseWriter, r *http.Request) {
+	if user, ok := s.transitionUser(w, r, s.db.ActivateUser); ok {
+		s.writeTransitionedUser(w, r, user)
+	}
+}
+
+// transitionUser applies a status change to the user in the URL. It writes
+// the response itself when the change fails.
+func (s *Server) transitionUser(w http.ResponseWriter, r *http.Request, transition func(ctx context.Context, id string) (*models.User, error)) (*models.User, bool) {
+	user, err := transition(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeProblem(w, r, "User not found", http.StatusNotFound)
+			return nil, false
+		}
+		if err == database.ErrInvalidTransition {
+			writeError(w, r, err)
+			return nil, false
+		}
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
+
+func (s *Server) writeTransitionedUser(w http.ResponseWriter, r *http.Request, user *models.User) {
+	s.events.Publish(events.New(r.Context(), events.UserUpdated, user))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(user))
+	json.NewEncoder(w).Encode(user)
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"users/internal/events"
+	"users/internal/tenant"
+)
+
+const (
+	// streamBuffer is how many events a stream client may fall behind
+	// before it is disconnected.
+	streamBuffer = 64
+	// streamHeartbeat keeps idle streams from being closed by proxies.
+	streamHeartbeat = 15 * time.Second
+)
+
+// streamFilter selects the events sent to one stream client. Empty fields
+// match everything.
+type streamFilter struct {
+	types   []string
+	userIDs []string
+}
+
+func parseStreamFilter(r *http.Request) (streamFilter, error) {
+	q := r.URL.Query()
+	f := streamFilter{
+		types:   splitList(q.Get("types")),
+		userIDs: splitList(q.Get("user_id")),
+	}
+	for _, t := range f.types {
+		if !slices.Contains(events.Types, t) {
+			return f, errInvalidParam("types")
+		}
+	}
+	return f, nil
+}
+
+func (f streamFilter) matches(e events.Event) bool {
+	return (len(f.types) == 0 || slices.Contains(f.types, e.Type)) &&
+		(len(f.userIDs) == 0 || slices.Contains(f.userIDs, e.UserID))
+}
+
+// streamUsersHandler pushes the tenant's user events to the client as
+// Server-Sent Events until it disconnects. Events missed while
+// disconnected can be caught up on with /users/changes.
+func (s *Server) streamUsersHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseStreamFilter(r)
+	if err != nil {
+		writeProblem(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tenantID := tenant.FromContext(r.Context())
+	ch := make(chan events.Event, streamBuffer)
+	overflow := make(chan struct{})
+	var once sync.Once
+	// Bus handlers must not block, so a client that cannot keep up is
+	// dropped instead of stalling every publisher.
+	unsubscribe := s.events.Subscribe(func(e events.Event) {
+		if e.TenantID != tenantID || !filter.matches(e) {
+			return
+		}
+		select {
+		case ch <- e:
+		default:
+			once.Do(func() { close(overflow) })
+		}
+	})
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout.
+	rc.SetWriteDeadline(time.Time{})
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-overflow:
+			fmt.Fprint(w, "event: overflow\ndata: {}\n\n")
+			rc.Flush()
+			return
+		case e := <-ch:
+			data, err := json.Marshal(e)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
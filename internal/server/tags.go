@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/events"
+	"users/internal/models"
+	"users/internal/validator"
+)
+
+func (s *Server) addTagHandler(w http.ResponseWriter, r *http.Request) {
+	s.retag(w, r, s.db.AddUserTags)
+}
+
+func (s *Server) removeTagHandler(w http.ResponseWriter, r *http.Request) {
+	s.retag(w, r, s.db.RemoveUserTags)
+}
+
+// retag applies change to the user and tag in the path and answers with
+// the updated user.
+func (s *Server) retag(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, id string, tags []string) (*models.User, error)) {
+	tag := chi.URLParam(r, "tag")
+	if err := validator.ValidateTag(tag); err != nil {
+		writeError(w, r, validator.Field("tag", err))
+		return
+	}
+	user, err := change(r.Context(), chi.URLParam(r, "id"), []string{tag})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.events.Publish(events.New(r.Context(), events.UserUpdated, user))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(user))
+	json.NewEncoder(w).Encode(user)
+}
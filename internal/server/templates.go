@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/mail"
+	"users/internal/models"
+	"users/internal/validator"
+)
+
+// defaultLocale keys the template a tenant uses for users whose locale
+// has none of its own.
+const defaultLocale = "default"
+
+// localeChain lists the template locales tried for a user's locale, most
+// specific first: "pt-BR" tries "pt-br", "pt" and then "default".
+func localeChain(locale string) []string {
+	var chain []string
+	for tag := strings.ToLower(locale); tag != ""; {
+		chain = append(chain, tag)
+		i := strings.LastIndexByte(tag, '-')
+		if i < 0 {
+			break
+		}
+		tag = tag[:i]
+	}
+	return append(chain, defaultLocale)
+}
+
+// notificationTemplate returns the template name for a user with locale:
+// the tenant's closest stored version, or the built-in one.
+func (s *Server) notificationTemplate(ctx context.Context, name, locale string) (mail.Template, error) {
+	stored, err := s.db.GetNotificationTemplate(ctx, name, localeChain(locale))
+	if err == nil {
+		return mail.Template{Subject: stored.Subject, Text: stored.Text, HTML: stored.HTML}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return mail.Template{}, err
+	}
+	t, ok := mail.DefaultTemplate(name)
+	if !ok {
+		return mail.Template{}, fmt.Errorf("unknown mail template %q", name)
+	}
+	return t, nil
+}
+
+// templateParams reads and validates the name and locale of a template
+// route, lower-casing the locale.
+func templateParams(r *http.Request) (name, locale string, err error) {
+	name = chi.URLParam(r, "name")
+	if !slices.Contains(mail.TemplateNames, name) {
+		return "", "", sql.ErrNoRows
+	}
+	locale = strings.ToLower(chi.URLParam(r, "locale"))
+	if locale != defaultLocale {
+		if err := validator.ValidateLocale(locale); err != nil {
+			return "", "", validator.Field("locale", err)
+		}
+	}
+	return name, locale, nil
+}
+
+func (s *Server) listTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	templates, err := s.db.ListNotificationTemplates(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(templates)
+}
+
+// getTemplateHandler returns the template a user with the locale would
+// get, which is the built-in one when the tenant has none stored.
+func (s *Server) getTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	name, locale, err := templateParams(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	resp, err := s.db.GetNotificationTemplate(r.Context(), name, localeChain(locale))
+	if errors.Is(err, sql.ErrNoRows) {
+		t, _ := mail.DefaultTemplate(name)
+		resp, err = &models.NotificationTemplate{
+			Name: name, Locale: defaultLocale, Subject: t.Subject, Text: t.Text, HTML: t.HTML, Builtin: true,
+		}, nil
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// putTemplateHandler stores the tenant's template for a locale. It is
+// test-rendered first, so a broken template is rejected instead of
+// failing every mail sent with it.
+func (s *Server) putTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	name, locale, err := templateParams(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var t models.NotificationTemplate
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	t.Name, t.Locale, t.Builtin = name, locale, false
+
+	if err := (mail.Template{Subject: t.Subject, Text: t.Text, HTML: t.HTML}).Validate(name); err != nil {
+		writeProblem(w, r, "invalid template: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.db.PutNotificationTemplate(r.Context(), &t); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+func (s *Server) deleteTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	name, locale, err := templateParams(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := s.db.DeleteNotificationTemplate(r.Context(), name, locale); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
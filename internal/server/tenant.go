@@ -0,0 +1,26 @@
+package server
+
+import (
+	"net/http"
+
+	"users/internal/tenant"
+)
+
+const tenantHeader = "X-Tenant-ID"
+
+// withTenant scopes the request context to the tenant named by the
+// X-Tenant-ID header, falling back to the default tenant.
+func (s *Server) withTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(tenantHeader)
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !tenant.IsValid(id) {
+			writeProblem(w, r, "invalid tenant id", http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(tenant.WithTenant(r.Context(), id)))
+	})
+}
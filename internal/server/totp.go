@@ -0,0 +1,320 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/session"
+	"users/internal/tenant"
+	"users/internal/totp"
+)
+
+const recoveryCodeCount = 10
+
+type totpRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// newRecoveryCodes returns fresh recovery codes and their hashes.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hashRecoveryCode(raw))
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifySecondFactor checks a TOTP or recovery code of an enabled
+// enrollment, consuming it so it cannot be used again.
+func (s *Server) verifySecondFactor(r *http.Request, enrollment *models.TOTP, req totpRequest) (bool, error) {
+	if req.RecoveryCode != "" {
+		return s.db.UseRecoveryCode(r.Context(), enrollment.UserID, hashRecoveryCode(req.RecoveryCode))
+	}
+	step, ok := totp.Validate(enrollment.Secret, req.Code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return s.db.RecordTOTPUse(r.Context(), enrollment.UserID, step)
+}
+
+func decodeTOTPRequest(w http.ResponseWriter, r *http.Request) (totpRequest, bool) {
+	var req totpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, r, err)
+		return req, false
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		writeProblem(w, r, "code or recovery_code is required", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// enabledTOTP loads the caller's enabled enrollment, writing an error
+// response when there is none.
+func (s *Server) enabledTOTP(w http.ResponseWriter, r *http.Request, userID string) (*models.TOTP, bool) {
+	enrollment, err := s.db.GetTOTP(r.Context(), userID)
+	if err == sql.ErrNoRows || (err == nil && enrollment.EnabledAt == nil) {
+		writeProblem(w, r, "Two-factor authentication is not enabled", http.StatusConflict)
+		return nil, false
+	}
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return enrollment, true
+}
+
+func (s *Server) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	sess, _ := session.FromContext(r.Context())
+	user, err := s.db.GetUserByID(r.Context(), sess.UserID)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.db.EnrollTOTP(r.Context(), user.ID, secret); err != nil {
+		if err == database.ErrTOTPAlreadyEnabled {
+			writeError(w, r, err)
+			return
+		}
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(s.config().totpIssuer, user.Email, secret),
+	})
+}
+
+func (s *Server) enableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	sess, _ := session.FromContext(r.Context())
+	req, ok := decodeTOTPRequest(w, r)
+	if !ok {
+		return
+	}
+
+	enrollment, err := s.db.GetTOTP(r.Context(), sess.UserID)
+	if err == sql.ErrNoRows {
+		writeProblem(w, r, "Enroll before enabling two-factor authentication", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if enrollment.EnabledAt != nil {
+		writeError(w, r, database.ErrTOTPAlreadyEnabled)
+		return
+	}
+
+	step, valid := totp.Validate(enrollment.Secret, req.Code, time.Now())
+	if !valid {
+		writeProblem(w, r, "Invalid code", http.StatusUnprocessableEntity)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.db.EnableTOTP(r.Context(), sess.UserID, step, hashes); err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+func (s *Server) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	sess, _ := session.FromContext(r.Context())
+	req, ok := decodeTOTPRequest(w, r)
+	if !ok {
+		return
+	}
+	enrollment, ok := s.enabledTOTP(w, r, sess.UserID)
+	if !ok {
+		return
+	}
+
+	valid, err := s.verifySecondFactor(r, enrollment, req)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		writeProblem(w, r, "Invalid code", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := s.db.DisableTOTP(r.Context(), sess.UserID); err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	sess, _ := session.FromContext(r.Context())
+	req, ok := decodeTOTPRequest(w, r)
+	if !ok {
+		return
+	}
+	enrollment, ok := s.enabledTOTP(w, r, sess.UserID)
+	if !ok {
+		return
+	}
+
+	valid, err := s.verifySecondFactor(r, enrollment, req)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		writeProblem(w, r, "Invalid code", http.StatusUnprocessableEntity)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.db.RegenerateRecoveryCodes(r.Context(), sess.UserID, hashes); err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// maxMFAFailures is how many wrong codes end a login waiting for its
+// second factor, so each login allows only a few guesses.
+const maxMFAFailures = 5
+
+// verifyLoginTOTPHandler completes a login that is waiting for its second
+// factor by replacing the pending session with a full one. Wrong codes
+// count towards the user's lockout like wrong passwords, and after
+// maxMFAFailures of them the pending session ends and the user has to log
+// in again.
+func (s *Server) verifyLoginTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	pending, ok := session.FromContext(r.Context())
+	if !ok || !pending.MFAPending {
+		writeProblem(w, r, "No login is waiting for a second factor", http.StatusUnauthorized)
+		return
+	}
+	req, ok := decodeTOTPRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// Pending sessions are not attributed to their tenant by withSession
+	ctx := tenant.WithTenant(r.Context(), pending.TenantID)
+	r = r.WithContext(ctx)
+	lockedUntil, err := s.db.GetLockedUntil(ctx, pending.UserID)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if lockedUntil != nil {
+		s.endPendingLogin(r, pending)
+		writeLocked(w, r, *lockedUntil)
+		return
+	}
+	enrollment, ok := s.enabledTOTP(w, r, pending.UserID)
+	if !ok {
+		return
+	}
+
+	valid, err := s.verifySecondFactor(r, enrollment, req)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		s.rejectSecondFactor(w, r, pending)
+		return
+	}
+
+	if err := s.sessions.Store.Delete(ctx, pending.ID); err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.db.ResetFailedLogins(ctx, pending.UserID); err != nil {
+		log.Printf("Error resetting failed logins of user %s: %v", pending.UserID, err)
+	}
+	user, err := s.db.GetUserByID(ctx, pending.UserID)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.completeLogin(w, r, user)
+}
+
+// rejectSecondFactor answers a wrong code posted for the pending login,
+// counting it for the user's lockout and for the pending session.
+func (s *Server) rejectSecondFactor(w http.ResponseWriter, r *http.Request, pending *session.Session) {
+	if lockout := s.config().lockout; lockout.MaxFailures > 0 {
+		lockedUntil, err := s.db.RecordFailedLogin(r.Context(), pending.UserID, lockout)
+		if err != nil {
+			log.Printf("Error recording failed login of user %s: %v", pending.UserID, err)
+		}
+		if lockedUntil != nil {
+			s.endPendingLogin(r, pending)
+			writeLocked(w, r, *lockedUntil)
+			return
+		}
+	}
+	failures, err := s.sessions.Store.RecordMFAFailure(r.Context(), pending.ID)
+	if err != nil && err != session.ErrNotFound {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err == session.ErrNotFound || failures >= maxMFAFailures {
+		s.endPendingLogin(r, pending)
+		writeProblem(w, r, "Too many invalid codes; log in again", http.StatusUnauthorized)
+		return
+	}
+	writeProblem(w, r, "Invalid code", http.StatusUnauthorized)
+}
+
+// endPendingLogin drops a login waiting for its second factor.
+func (s *Server) endPendingLogin(r *http.Request, pending *session.Session) {
+	if err := s.sessions.Store.Delete(r.Context(), pending.ID); err != nil {
+		log.Printf("Error ending pending login of user %s: %v", pending.UserID, err)
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/validator"
+)
+
+func (s *Server) usernameAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "username")
+	resp := map[string]any{"username": name}
+
+	if err := validator.ValidateUsername(name); err != nil {
+		resp["available"] = false
+		resp["reason"] = err.Error()
+	} else {
+		available, err := s.db.CheckUsernameAvailable(r.Context(), name)
+		if err != nil {
+			writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		resp["available"] = available
+		if !available {
+			resp["reason"] = "username is taken"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
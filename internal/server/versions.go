@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// legacyDeprecatedAt is when the unversioned paths were superseded by
+// /api/v1.
+var legacyDeprecatedAt = time.Date(2026, time.October, 14, 0, 0, 0, 0, time.UTC)
+
+// legacySunset returns when the unversioned paths go away, from
+// API_LEGACY_SUNSET (a date such as 2027-04-30), six months after their
+// deprecation by default.
+func legacySunset() time.Time {
+	if t, err := time.Parse(time.DateOnly, os.Getenv("API_LEGACY_SUNSET")); err == nil {
+		return t
+	}
+	return legacyDeprecatedAt.AddDate(0, 6, 0)
+}
+
+// deprecated marks the responses of retired endpoints with the Deprecation
+// (RFC 9745) and Sunset (RFC 8594) headers and links the same path under
+// successor.
+func deprecated(successor string) func(http.Handler) http.Handler {
+	deprecation := "@" + strconv.FormatInt(legacyDeprecatedAt.Unix(), 10)
+	sunset := legacySunset().Format(http.TimeFormat)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := r.URL.Path
+			// Single users moved from /user/{id} to /users/{id}
+			if rest, ok := strings.CutPrefix(path, "/user/"); ok {
+				path = "/users/" + rest
+			}
+			w.Header().Set("Deprecation", deprecation)
+			w.Header().Set("Sunset", sunset)
+			w.Header().Add("Link", "<"+successor+path+`>; rel="successor-version"`)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"users/internal/events"
+	"users/internal/models"
+	"users/internal/validator"
+)
+
+const webhookDeliveriesLimit = 100
+
+func (s *Server) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var webhook models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	if err := validator.ValidateWebhook(&webhook, events.Types); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if webhook.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+	webhook.Active = true
+
+	if err := s.db.CreateWebhook(r.Context(), &webhook); err != nil {
+		writeProblem(w, r, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	// The secret is only ever returned on creation
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (s *Server) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := s.db.ListWebhooks(r.Context())
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+func (s *Server) getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, err := s.db.GetWebhook(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeProblem(w, r, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	webhook.Secret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (s *Server) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.DeleteWebhook(r.Context(), chi.URLParam(r, "id")); err != nil {
+		if err == sql.ErrNoRows {
+			writeProblem(w, r, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := s.db.ListWebhookDeliveries(r.Context(), chi.URLParam(r, "id"), webhookDeliveriesLimit)
+	if err != nil {
+		writeProblem(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
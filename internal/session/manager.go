@@ -0,0 +1,166 @@
+package session
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"users/internal/proxy"
+)
+
+const (
+	// touchInterval limits how often sliding expiration writes to the store.
+	touchInterval = time.Minute
+	// pendingTTL bounds how long a second factor may take.
+	pendingTTL = 5 * time.Minute
+)
+
+// Manager issues session cookies and resolves them on incoming requests.
+type Manager struct {
+	Store Store
+	// TTL is how long a session stays valid without activity.
+	TTL time.Duration
+	// CookieName is the name of the session cookie.
+	CookieName string
+	// Secure marks the cookie as HTTPS only.
+	Secure bool
+}
+
+// Start creates a session for the user and sets its cookie on w.
+func (m *Manager) Start(ctx context.Context, w http.ResponseWriter, r *http.Request, tenantID, userID string) (*Session, error) {
+	return m.start(ctx, w, r, tenantID, userID, false)
+}
+
+// StartPending creates a session that only allows completing a second
+// factor, after which it has to be replaced through Start.
+func (m *Manager) StartPending(ctx context.Context, w http.ResponseWriter, r *http.Request, tenantID, userID string) (*Session, error) {
+	return m.start(ctx, w, r, tenantID, userID, true)
+}
+
+func (m *Manager) start(ctx context.Context, w http.ResponseWriter, r *http.Request, tenantID, userID string, pending bool) (*Session, error) {
+	ttl := m.TTL
+	if pending {
+		ttl = pendingTTL
+	}
+
+	token, id, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	s := &Session{
+		ID:        id,
+		UserID:    userID,
+		TenantID:  tenantID,
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+		Created:   now,
+		LastSeen:  now,
+		ExpiresAt: now.Add(ttl),
+
+		MFAPending: pending,
+	}
+	if err := m.Store.Create(ctx, s); err != nil {
+		return nil, err
+	}
+
+	http.SetCookie(w, m.cookie(token, ttl))
+	return s, nil
+}
+
+// Impersonate creates a session in which actor acts as the user for ttl. No
+// cookie is set: the returned token is handed to the admin, who sends it as
+// the session cookie.
+func (m *Manager) Impersonate(ctx context.Context, r *http.Request, tenantID, userID, actor, reason string, ttl time.Duration) (string, *Session, error) {
+	token, id, err := newToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now().UTC()
+	s := &Session{
+		ID:        id,
+		UserID:    userID,
+		TenantID:  tenantID,
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+		Created:   now,
+		LastSeen:  now,
+		ExpiresAt: now.Add(ttl),
+
+		ImpersonatedBy: actor,
+		Reason:         reason,
+	}
+	if err := m.Store.Create(ctx, s); err != nil {
+		return "", nil, err
+	}
+	return token, s, nil
+}
+
+// End revokes the session of the request, if any, and clears its cookie.
+func (m *Manager) End(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, m.cookie("", -1))
+	c, err := r.Cookie(m.CookieName)
+	if err != nil {
+		return nil
+	}
+	return m.Store.Delete(ctx, idFromToken(c.Value))
+}
+
+func (m *Manager) cookie(token string, ttl time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     m.CookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(ttl / time.Second),
+		HttpOnly: true,
+		Secure:   m.Secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// Middleware attaches the session named by the request cookie to the
+// context and extends its expiry. Requests without a valid session pass
+// through unauthenticated.
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie(m.CookieName)
+		if err != nil || c.Value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		s, err := m.Store.Get(r.Context(), idFromToken(c.Value))
+		if err != nil {
+			if err != ErrNotFound {
+				log.Printf("Error loading session: %v", err)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Slide the expiry, but not on every single request
+		now := time.Now().UTC()
+		if !s.MFAPending && s.ImpersonatedBy == "" && now.Sub(s.LastSeen) >= touchInterval {
+			s.LastSeen = now
+			s.ExpiresAt = now.Add(m.TTL)
+			if err := m.Store.Touch(r.Context(), s.ID, s.LastSeen, s.ExpiresAt); err != nil {
+				log.Printf("Error extending session: %v", err)
+			}
+			http.SetCookie(w, m.cookie(c.Value, m.TTL))
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithSession(r.Context(), s)))
+	})
+}
+
+// clientIP returns the client address resolved by the server's proxy
+// handling, or the peer address of requests that did not go through it.
+func clientIP(r *http.Request) string {
+	if ip := proxy.ClientIP(r.Context()); ip != "" {
+		return ip
+	}
+	return r.RemoteAddr
+}
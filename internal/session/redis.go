@@ -0,0 +1,171 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps sessions in Redis so they are shared between instances.
+// Each session is a JSON value expiring with the session, and a set per user
+// indexes the session IDs for listing and bulk revocation.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore returns a store backed by the Redis server at url, e.g.
+// "redis://localhost:6379/0".
+func NewRedisStore(url string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStore{client: redis.NewClient(opts)}, nil
+}
+
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+func userKey(tenantID, userID string) string {
+	return "user_sessions:" + tenantID + ":" + userID
+}
+
+func (r *RedisStore) save(ctx context.Context, s *Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, sessionKey(s.ID), data, time.Until(s.ExpiresAt))
+	pipe.SAdd(ctx, userKey(s.TenantID, s.UserID), s.ID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisStore) Create(ctx context.Context, s *Session) error {
+	return r.save(ctx, s)
+}
+
+func (r *RedisStore) Get(ctx context.Context, id string) (*Session, error) {
+	data, err := r.client.Get(ctx, sessionKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *RedisStore) Touch(ctx context.Context, id string, lastSeen, expiresAt time.Time) error {
+	s, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	s.LastSeen = lastSeen
+	s.ExpiresAt = expiresAt
+	return r.save(ctx, s)
+}
+
+// RecordMFAFailure rewrites the session under WATCH, so concurrent wrong
+// codes are all counted.
+func (r *RedisStore) RecordMFAFailure(ctx context.Context, id string) (int, error) {
+	var failures int
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, sessionKey(id)).Bytes()
+		if err == redis.Nil {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var s Session
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		s.MFAFailures++
+		failures = s.MFAFailures
+		if data, err = json.Marshal(&s); err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, sessionKey(id), data, time.Until(s.ExpiresAt))
+			return nil
+		})
+		return err
+	}, sessionKey(id))
+	return failures, err
+}
+
+func (r *RedisStore) Delete(ctx context.Context, id string) error {
+	s, err := r.Get(ctx, id)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, sessionKey(id))
+	pipe.SRem(ctx, userKey(s.TenantID, s.UserID), id)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisStore) ListByUser(ctx context.Context, tenantID, userID string) ([]Session, error) {
+	ids, err := r.client.SMembers(ctx, userKey(tenantID, userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	list := []Session{}
+	var stale []any
+	for _, id := range ids {
+		s, err := r.Get(ctx, id)
+		if err == ErrNotFound {
+			stale = append(stale, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *s)
+	}
+	// Expired sessions vanish on their own; drop them from the index too
+	if len(stale) > 0 {
+		r.client.SRem(ctx, userKey(tenantID, userID), stale...)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list, nil
+}
+
+func (r *RedisStore) DeleteByUser(ctx context.Context, tenantID, userID string) error {
+	key := userKey(tenantID, userID)
+	ids, err := r.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{key}
+	for _, id := range ids {
+		keys = append(keys, sessionKey(id))
+	}
+	return r.client.Del(ctx, keys...).Err()
+}
+
+// Ping checks that the Redis server answers.
+func (r *RedisStore) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
@@ -0,0 +1,85 @@
+// Package session implements server-side sessions referenced by an opaque
+// cookie, with pluggable storage.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned for unknown, expired or revoked sessions.
+var ErrNotFound = errors.New("session not found")
+
+// Session is an authenticated login of a user. The ID is derived from the
+// secret token held in the cookie, so IDs can be listed without exposing
+// anything that grants access.
+type Session struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	TenantID  string    `json:"tenant_id"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"last_seen"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// MFAPending marks a login that still has to pass a second factor. Such
+	// sessions do not authenticate anything else.
+	MFAPending bool `json:"mfa_pending,omitempty"`
+	// MFAFailures counts the wrong codes posted for a pending login.
+	MFAFailures int `json:"mfa_failures,omitempty"`
+	// ImpersonatedBy is the actor of an admin acting as the user, empty for
+	// the user's own logins. Such sessions never have their expiry
+	// extended.
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
+	// Reason is why the admin impersonates the user.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Store persists sessions. Implementations must not return expired sessions.
+type Store interface {
+	Create(ctx context.Context, s *Session) error
+	Get(ctx context.Context, id string) (*Session, error)
+	// Touch records activity and moves the expiry of the session.
+	Touch(ctx context.Context, id string, lastSeen, expiresAt time.Time) error
+	// RecordMFAFailure counts a wrong second factor code posted for the
+	// session and returns how many there were.
+	RecordMFAFailure(ctx context.Context, id string) (int, error)
+	Delete(ctx context.Context, id string) error
+	// ListByUser returns the active sessions of a user.
+	ListByUser(ctx context.Context, tenantID, userID string) ([]Session, error)
+	// DeleteByUser revokes every session of a user.
+	DeleteByUser(ctx context.Context, tenantID, userID string) error
+}
+
+// newToken returns a random cookie token and the session ID derived from it.
+func newToken() (token, id string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, idFromToken(token), nil
+}
+
+func idFromToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type contextKey struct{}
+
+// WithSession returns a copy of ctx carrying s.
+func WithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the session of ctx, if any.
+func FromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(contextKey{}).(*Session)
+	return s, ok
+}
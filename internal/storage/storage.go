@@ -0,0 +1,206 @@
+// Package storage keeps the files the service produces, such as user
+// exports, on a local disk or in an S3 bucket.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"users/internal/awsv4"
+)
+
+// ErrNotFound is returned when opening a file that does not exist.
+var ErrNotFound = errors.New("file not found")
+
+// Store keeps files by key. Keys are slash separated paths such as
+// "exports/default/42.csv".
+type Store interface {
+	// Put stores the size bytes of body under key, replacing any file
+	// already there.
+	Put(ctx context.Context, key string, body io.ReadSeeker, size int64) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the file under key. Deleting a missing file is not an
+	// error.
+	Delete(ctx context.Context, key string) error
+}
+
+// FromEnv returns the store EXPORT_STORAGE selects: local (the default),
+// keeping files under EXPORT_DIR, or s3, keeping them in EXPORT_S3_BUCKET.
+func FromEnv() (Store, error) {
+	switch kind := os.Getenv("EXPORT_STORAGE"); kind {
+	case "", "local":
+		dir := os.Getenv("EXPORT_DIR")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "users-exports")
+		}
+		return &Local{Dir: dir}, nil
+	case "s3":
+		region := os.Getenv("AWS_REGION")
+		if region == "" {
+			region = os.Getenv("AWS_DEFAULT_REGION")
+		}
+		s := &S3{
+			Bucket:   os.Getenv("EXPORT_S3_BUCKET"),
+			Endpoint: os.Getenv("EXPORT_S3_ENDPOINT"),
+			Signer: awsv4.Signer{
+				Region:          region,
+				Service:         "s3",
+				AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+				SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+				SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			},
+			Client: http.DefaultClient,
+		}
+		if s.Bucket == "" || region == "" || s.Signer.AccessKeyID == "" || s.Signer.SecretAccessKey == "" {
+			return nil, fmt.Errorf("s3 export storage needs EXPORT_S3_BUCKET, AWS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown EXPORT_STORAGE %q", kind)
+	}
+}
+
+// Local keeps files under Dir. Instances serving the same exports must
+// share it, e.g. as a network volume.
+type Local struct {
+	Dir string
+}
+
+func (l *Local) path(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(l.Dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes body next to its destination and renames it into place, so
+// readers never see half a file.
+func (l *Local) Put(ctx context.Context, key string, body io.ReadSeeker, size int64) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// S3 keeps files in an S3 bucket.
+type S3 struct {
+	Bucket string
+	// Endpoint overrides the regional endpoint, for S3 compatible stores
+	// such as MinIO and tests. Buckets are then addressed by path.
+	Endpoint string
+	Signer   awsv4.Signer
+	Client   *http.Client
+}
+
+func (s *S3) url(key string) string {
+	escaped := (&url.URL{Path: key}).EscapedPath()
+	if s.Endpoint != "" {
+		return strings.TrimSuffix(s.Endpoint, "/") + "/" + s.Bucket + "/" + escaped
+	}
+	return "https://" + s.Bucket + ".s3." + s.Signer.Region + ".amazonaws.com/" + escaped
+}
+
+func (s *S3) do(ctx context.Context, method, key string, body io.ReadSeeker, size int64) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = body
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.url(key), reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	// Uploads are streamed from disk rather than hashed up front
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	s.Signer.Sign(req, nil, time.Now().UTC())
+	return s.Client.Do(req)
+}
+
+func (s *S3) Put(ctx context.Context, key string, body io.ReadSeeker, size int64) error {
+	resp, err := s.do(ctx, http.MethodPut, key, body, size)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("s3: storing %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("s3: reading %s: %s", key, resp.Status)
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("s3: deleting %s: %s", key, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+// Package tenant carries the tenant a request operates on through contexts so
+// every query can be scoped to it.
+package tenant
+
+import (
+	"context"
+	"regexp"
+)
+
+// Default is the tenant used when a request does not name one.
+const Default = "default"
+
+type contextKey struct{}
+
+var validID = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// IsValid reports whether id is an acceptable tenant identifier.
+func IsValid(id string) bool {
+	return validID.MatchString(id)
+}
+
+// WithTenant returns a copy of ctx scoped to the tenant id.
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant ctx is scoped to, or Default.
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(contextKey{}).(string); ok && id != "" {
+		return id
+	}
+	return Default
+}
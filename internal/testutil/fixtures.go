@@ -0,0 +1,172 @@
+// Package testutil helps tests build deterministic data and compare
+// responses against golden files.
+package testutil
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"users/internal/models"
+	"users/internal/seed"
+)
+
+// Seed is the seed fixtures are generated from unless a test picks another.
+const Seed = 1
+
+// Epoch is the creation time of the first fixture; later ones are created
+// a minute apart, so fixtures sort in the order they were built.
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Fixtures builds users with names, birthdates and emails from package
+// seed. Builders with the same seed build the same users in the same
+// order, IDs and timestamps included.
+type Fixtures struct {
+	gen *seed.Generator
+	n   int
+}
+
+// New returns a builder of fixtures from seed, with English names.
+func New(seed int64) *Fixtures {
+	return NewWithLocale(seed, "en")
+}
+
+// NewWithLocale returns a builder of fixtures from seed with names of
+// locale, one of seed.Locales. It panics on an unknown locale.
+func NewWithLocale(s int64, locale string) *Fixtures {
+	gen, err := seed.NewGenerator(s, locale)
+	if err != nil {
+		panic(err)
+	}
+	return &Fixtures{gen: gen}
+}
+
+// UserOption changes a user built by User.
+type UserOption func(*models.User)
+
+// User returns the next user, active at version 1, with opts applied.
+func (f *Fixtures) User(opts ...UserOption) *models.User {
+	user := f.gen.Next()
+	id, err := uuid.NewRandomFromReader(f.gen.Rand())
+	if err != nil {
+		panic(err)
+	}
+	created := Epoch.Add(time.Duration(f.n) * time.Minute)
+	f.n++
+
+	user.ID = id.String()
+	user.Status = models.StatusActive
+	user.Created = created
+	user.UpdatedAt = created
+	user.Version = 1
+	if birthdate, err := time.Parse(models.DateLayout, user.Birthdate); err == nil {
+		user.Age = models.AgeAt(birthdate, created)
+	}
+	for _, opt := range opts {
+		opt(&user)
+	}
+	return &user
+}
+
+// Users returns the next n users, each with opts applied.
+func (f *Fixtures) Users(n int, opts ...UserOption) []*models.User {
+	users := make([]*models.User, n)
+	for i := range users {
+		users[i] = f.User(opts...)
+	}
+	return users
+}
+
+func WithID(id string) UserOption {
+	return func(u *models.User) { u.ID = id }
+}
+
+func WithName(first, last string) UserOption {
+	return func(u *models.User) { u.FirstName, u.LastName = first, last }
+}
+
+func WithEmail(email string) UserOption {
+	return func(u *models.User) { u.Email = email }
+}
+
+func WithUsername(username string) UserOption {
+	return func(u *models.User) { u.Username = username }
+}
+
+// WithBirthdate sets the birthdate and the age at the user's creation; ""
+// leaves the user without either.
+func WithBirthdate(birthdate string) UserOption {
+	return func(u *models.User) {
+		u.Birthdate, u.Age = birthdate, 0
+		if t, err := time.Parse(models.DateLayout, birthdate); err == nil {
+			u.Age = models.AgeAt(t, u.Created)
+		}
+	}
+}
+
+func WithLocale(locale, timezone string) UserOption {
+	return func(u *models.User) { u.Locale, u.Timezone = locale, timezone }
+}
+
+func WithTags(tags ...string) UserOption {
+	return func(u *models.User) { u.Tags = tags }
+}
+
+func WithStatus(status models.UserStatus) UserOption {
+	return func(u *models.User) { u.Status = status }
+}
+
+func WithVersion(version int) UserOption {
+	return func(u *models.User) { u.Version = version }
+}
+
+// WithCreated sets both the creation and the update time.
+func WithCreated(t time.Time) UserOption {
+	return func(u *models.User) { u.Created, u.UpdatedAt = t, t }
+}
+
+// UpdateOption sets a field of an update built by Update.
+type UpdateOption func(*models.UserUpdate)
+
+// Update returns a partial update changing the fields opts set.
+func Update(opts ...UpdateOption) *models.UserUpdate {
+	var update models.UserUpdate
+	for _, opt := range opts {
+		opt(&update)
+	}
+	return &update
+}
+
+func SetFirstName(name string) UpdateOption {
+	return func(u *models.UserUpdate) { u.FirstName = &name }
+}
+
+func SetLastName(name string) UpdateOption {
+	return func(u *models.UserUpdate) { u.LastName = &name }
+}
+
+func SetUsername(username string) UpdateOption {
+	return func(u *models.UserUpdate) { u.Username = &username }
+}
+
+func SetEmail(email string) UpdateOption {
+	return func(u *models.UserUpdate) { u.Email = &email }
+}
+
+// SetBirthdate sets the birthdate; "" clears it.
+func SetBirthdate(birthdate string) UpdateOption {
+	return func(u *models.UserUpdate) { u.Birthdate = &birthdate }
+}
+
+func SetLocale(locale string) UpdateOption {
+	return func(u *models.UserUpdate) { u.Locale = &locale }
+}
+
+func SetTimezone(timezone string) UpdateOption {
+	return func(u *models.UserUpdate) { u.Timezone = &timezone }
+}
+
+// IfVersion makes the update apply only to the user at version.
+func IfVersion(version int) UpdateOption {
+	return func(u *models.UserUpdate) { u.Version = &version }
+}
@@ -0,0 +1,56 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// update rewrites golden files with the output of the tests instead of
+// comparing against them: go test ./tests -run WireFormat -update
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// AssertGolden compares body, a JSON response body, with the golden file
+// testdata/<name>.golden of the test's package. Both are indented the same
+// way first, so the files stay readable and diffs show the fields that
+// changed. With -update the file is written instead.
+func AssertGolden(t testing.TB, name string, body []byte) {
+	t.Helper()
+	var got bytes.Buffer
+	if err := json.Indent(&got, bytes.TrimSpace(body), "", "  "); err != nil {
+		t.Fatalf("%s: response is not JSON: %v\n%s", name, err, body)
+	}
+	got.WriteByte('\n')
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s: %v (run with -update to create it)", name, err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("%s: response differs from %s (run with -update if the change is intended)\ngot:\n%s\nwant:\n%s", name, path, got.Bytes(), want)
+	}
+}
+
+// AssertGoldenJSON encodes v as a handler would and compares it with the
+// golden file name.
+func AssertGoldenJSON(t testing.TB, name string, v any) {
+	t.Helper()
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(v); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	AssertGolden(t, name, body.Bytes())
+}
@@ -0,0 +1,134 @@
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Code names why a value is invalid. Codes are part of the API: clients
+// map them to their own messages, so they never change once released,
+// unlike the English messages next to them.
+type Code string
+
+const (
+	// CodeInvalid is the code of errors without a more specific one.
+	CodeInvalid  Code = "INVALID"
+	CodeRequired Code = "REQUIRED"
+
+	CodeIDInvalid Code = "ID_INVALID"
+
+	CodeNameRequired Code = "NAME_REQUIRED"
+	CodeNameTooLong  Code = "NAME_TOO_LONG"
+	// CodeNameInvalidCharacters covers digits, symbols, misplaced marks
+	// and punctuation in names.
+	CodeNameInvalidCharacters Code = "NAME_INVALID_CHARACTERS"
+
+	CodeEmailInvalid Code = "EMAIL_INVALID"
+
+	CodeUsernameLength   Code = "USERNAME_LENGTH"
+	CodeUsernameInvalid  Code = "USERNAME_INVALID"
+	CodeUsernameReserved Code = "USERNAME_RESERVED"
+
+	CodeBirthdateInvalid  Code = "BIRTHDATE_INVALID"
+	CodeBirthdateTooEarly Code = "BIRTHDATE_TOO_EARLY"
+	CodeBirthdateInFuture Code = "BIRTHDATE_IN_FUTURE"
+	CodeAgeMismatch       Code = "AGE_MISMATCH"
+	CodeAgeOutOfRange     Code = "AGE_OUT_OF_RANGE"
+
+	CodeLocaleInvalid   Code = "LOCALE_INVALID"
+	CodeTimezoneInvalid Code = "TIMEZONE_INVALID"
+	CodeStatusInvalid   Code = "STATUS_INVALID"
+	CodeThemeInvalid    Code = "THEME_INVALID"
+	CodeTagInvalid      Code = "TAG_INVALID"
+
+	CodeMetadataKeyInvalid  Code = "METADATA_KEY_INVALID"
+	CodeMetadataTooManyKeys Code = "METADATA_TOO_MANY_KEYS"
+	CodeMetadataTooLarge    Code = "METADATA_TOO_LARGE"
+
+	CodeConsentKindInvalid     Code = "CONSENT_KIND_INVALID"
+	CodeConsentVersionRequired Code = "CONSENT_VERSION_REQUIRED"
+	CodeConsentVersionTooLong  Code = "CONSENT_VERSION_TOO_LONG"
+
+	CodeGroupNameInvalid        Code = "GROUP_NAME_INVALID"
+	CodeGroupDescriptionTooLong Code = "GROUP_DESCRIPTION_TOO_LONG"
+
+	CodeWebhookURLInvalid     Code = "WEBHOOK_URL_INVALID"
+	CodeWebhookEventsRequired Code = "WEBHOOK_EVENTS_REQUIRED"
+	CodeWebhookEventUnknown   Code = "WEBHOOK_EVENT_UNKNOWN"
+
+	CodeAPIKeyNameRequired   Code = "API_KEY_NAME_REQUIRED"
+	CodeAPIKeyScopesRequired Code = "API_KEY_SCOPES_REQUIRED"
+	CodeAPIKeyScopeUnknown   Code = "API_KEY_SCOPE_UNKNOWN"
+
+	CodeFieldUnknown Code = "FIELD_UNKNOWN"
+
+	CodePasswordTooShort      Code = "PASSWORD_TOO_SHORT"
+	CodePasswordTooLong       Code = "PASSWORD_TOO_LONG"
+	CodePasswordMissingUpper  Code = "PASSWORD_MISSING_UPPERCASE"
+	CodePasswordMissingLower  Code = "PASSWORD_MISSING_LOWERCASE"
+	CodePasswordMissingDigit  Code = "PASSWORD_MISSING_DIGIT"
+	CodePasswordMissingSymbol Code = "PASSWORD_MISSING_SYMBOL"
+	CodePasswordTooCommon     Code = "PASSWORD_TOO_COMMON"
+	CodePasswordBreached      Code = "PASSWORD_BREACHED"
+)
+
+// ValidationError is why one value of a request is invalid. Field is the
+// path of the value in the request, such as "email", "user.tags" or
+// "metadata.crm_id"; the validators of single values leave it empty for
+// their callers to fill in.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// invalid returns a ValidationError with code and the formatted message.
+func invalid(code Code, format string, args ...any) *ValidationError {
+	return &ValidationError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// CodeOf returns the code of err, CodeInvalid when it carries none.
+func CodeOf(err error) Code {
+	var ve *ValidationError
+	if errors.As(err, &ve) && ve.Code != "" {
+		return ve.Code
+	}
+	return CodeInvalid
+}
+
+// Errors lists every invalid field of a request, so clients can fix them
+// all at once.
+type Errors []ValidationError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *Errors) add(field string, err error) {
+	*e = append(*e, ValidationError{Field: field, Code: CodeOf(err), Message: err.Error()})
+}
+
+// err returns e as an error, nil when no field is invalid.
+func (e Errors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Field returns err, as returned by the validator of a single value, as
+// the Errors of a request whose field is invalid.
+func Field(field string, err error) error {
+	var errs Errors
+	errs.add(field, err)
+	return errs
+}
@@ -0,0 +1,193 @@
+package validator
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// commonPasswords are rejected regardless of configuration.
+var commonPasswords = []string{
+	"123456", "12345678", "123456789", "1234567890", "password", "password1",
+	"qwerty", "qwerty123", "qwertyuiop", "111111", "abc123", "iloveyou",
+	"admin", "welcome", "letmein", "monkey", "dragon", "football",
+	"baseball", "sunshine", "princess", "passw0rd", "trustno1", "superman",
+}
+
+// PasswordPolicy describes the passwords users may choose.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// Banned holds additional lowercase passwords that are rejected.
+	Banned map[string]bool
+	// CheckPwned rejects passwords found in the Have I Been Pwned corpus.
+	// Only the first five characters of the password's SHA-1 leave the
+	// process (k-anonymity).
+	CheckPwned bool
+	// PwnedURL is the range API endpoint, overridable for tests.
+	PwnedURL string
+	Client   *http.Client
+}
+
+// DefaultPasswordPolicy requires 12 characters and rejects common passwords.
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength: 12,
+		MaxLength: 72,
+		Banned:    map[string]bool{},
+		PwnedURL:  "https://api.pwnedpasswords.com/range/",
+		Client:    &http.Client{Timeout: 3 * time.Second},
+	}
+}
+
+// PasswordPolicyFromEnv reads the policy from PASSWORD_* environment
+// variables on top of the defaults:
+//
+//	PASSWORD_MIN_LENGTH      minimum number of characters
+//	PASSWORD_REQUIRE         comma separated classes: upper, lower, digit, symbol
+//	PASSWORD_BANNED_FILE     file with one banned password per line
+//	PASSWORD_CHECK_PWNED     "true" to consult Have I Been Pwned
+func PasswordPolicyFromEnv() (PasswordPolicy, error) {
+	p := DefaultPasswordPolicy()
+
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		if _, err := fmt.Sscan(v, &p.MinLength); err != nil || p.MinLength < 1 || p.MinLength > p.MaxLength {
+			return p, fmt.Errorf("invalid PASSWORD_MIN_LENGTH %q", v)
+		}
+	}
+	for _, class := range strings.Split(os.Getenv("PASSWORD_REQUIRE"), ",") {
+		switch strings.TrimSpace(class) {
+		case "":
+		case "upper":
+			p.RequireUpper = true
+		case "lower":
+			p.RequireLower = true
+		case "digit":
+			p.RequireDigit = true
+		case "symbol":
+			p.RequireSymbol = true
+		default:
+			return p, fmt.Errorf("invalid PASSWORD_REQUIRE class %q", class)
+		}
+	}
+	if path := os.Getenv("PASSWORD_BANNED_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return p, err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				p.Banned[strings.ToLower(line)] = true
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return p, err
+		}
+	}
+	p.CheckPwned = os.Getenv("PASSWORD_CHECK_PWNED") == "true"
+	return p, nil
+}
+
+// Validate returns a *ValidationError describing the first rule password
+// breaks.
+func (p PasswordPolicy) Validate(ctx context.Context, password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return invalid(CodePasswordTooShort, "password must be at least %d characters", p.MinLength)
+	}
+	// bcrypt ignores everything after 72 bytes
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return invalid(CodePasswordTooLong, "password must be at most %d bytes", p.MaxLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		return invalid(CodePasswordMissingUpper, "password must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		return invalid(CodePasswordMissingLower, "password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		return invalid(CodePasswordMissingDigit, "password must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		return invalid(CodePasswordMissingSymbol, "password must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	if p.Banned[lowered] {
+		return invalid(CodePasswordTooCommon, "password is too common")
+	}
+	for _, common := range commonPasswords {
+		if lowered == common {
+			return invalid(CodePasswordTooCommon, "password is too common")
+		}
+	}
+
+	if p.CheckPwned {
+		pwned, err := p.pwned(ctx, password)
+		if err != nil {
+			// An unreachable breach corpus must not block sign ups
+			return nil
+		}
+		if pwned {
+			return invalid(CodePasswordBreached, "password appeared in a data breach")
+		}
+	}
+	return nil
+}
+
+func (p PasswordPolicy) pwned(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.PwnedURL+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Add-Padding", "true")
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("pwned passwords: %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		candidate, count, _ := strings.Cut(scanner.Text(), ":")
+		if candidate == suffix && strings.TrimSpace(count) != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
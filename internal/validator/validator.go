@@ -1,40 +1,510 @@
 package validator
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	_ "time/tzdata" // timezones are validated even without a system tz database
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
 
 	"users/internal/models"
 )
 
 func ValidateUser(user *models.User) error {
-	if user.FirstName == "" {
-		return fmt.Errorf("first name is required")
+	var errs Errors
+	if user.ID != "" {
+		if err := ValidateID(user.ID); err != nil {
+			errs.add("id", err)
+		}
+	}
+	if err := ValidateName(user.FirstName); err != nil {
+		errs.add("first_name", fmt.Errorf("first name %w", err))
+	}
+	if err := ValidateName(user.LastName); err != nil {
+		errs.add("last_name", fmt.Errorf("last name %w", err))
+	}
+	if !isValidEmail(NormalizeEmail(user.Email, false)) {
+		errs.add("email", invalid(CodeEmailInvalid, "invalid email address"))
+	}
+	if user.Username != "" {
+		if err := ValidateUsername(user.Username); err != nil {
+			errs.add("username", err)
+		}
 	}
-	if user.LastName == "" {
-		return fmt.Errorf("last name is required")
+	if user.Locale != "" {
+		if err := ValidateLocale(user.Locale); err != nil {
+			errs.add("locale", err)
+		}
 	}
-	if !isValidEmail(user.Email) {
-		return fmt.Errorf("invalid email address")
+	if user.Timezone != "" {
+		if err := ValidateTimezone(user.Timezone); err != nil {
+			errs.add("timezone", err)
+		}
 	}
+	if user.Age > MaxAge {
+		errs.add("age", invalid(CodeAgeOutOfRange, "age must be at most %d", MaxAge))
+	}
+	if user.Birthdate != "" {
+		if err := ValidateBirthdate(user.Birthdate); err != nil {
+			errs.add("birthdate", err)
+		} else if user.Age != 0 && !ageMatches(user.Birthdate, user.Age) {
+			errs.add("age", invalid(CodeAgeMismatch, "age does not match birthdate"))
+		}
+	}
+	// New users cannot start out suspended
+	if user.Status != "" && user.Status != models.StatusActive && user.Status != models.StatusPending {
+		errs.add("status", invalid(CodeStatusInvalid, "status must be active or pending"))
+	}
+	return errs.err()
+}
 
+func ValidateUserUpdate(updates *models.UserUpdate) error {
+	var errs Errors
+	if updates.FirstName != nil {
+		if err := ValidateName(*updates.FirstName); err != nil {
+			errs.add("first_name", fmt.Errorf("first name %w", err))
+		}
+	}
+	if updates.LastName != nil {
+		if err := ValidateName(*updates.LastName); err != nil {
+			errs.add("last_name", fmt.Errorf("last name %w", err))
+		}
+	}
+	if updates.Email != nil && !isValidEmail(NormalizeEmail(*updates.Email, false)) {
+		errs.add("email", invalid(CodeEmailInvalid, "invalid email address"))
+	}
+	// An empty username clears it
+	if updates.Username != nil && *updates.Username != "" {
+		if err := ValidateUsername(*updates.Username); err != nil {
+			errs.add("username", err)
+		}
+	}
+	// An empty locale clears it
+	if updates.Locale != nil && *updates.Locale != "" {
+		if err := ValidateLocale(*updates.Locale); err != nil {
+			errs.add("locale", err)
+		}
+	}
+	// An empty timezone clears it
+	if updates.Timezone != nil && *updates.Timezone != "" {
+		if err := ValidateTimezone(*updates.Timezone); err != nil {
+			errs.add("timezone", err)
+		}
+	}
+	if updates.Age != nil && *updates.Age > MaxAge {
+		errs.add("age", invalid(CodeAgeOutOfRange, "age must be at most %d", MaxAge))
+	}
+	// An empty birthdate clears it
+	if updates.Birthdate != nil && *updates.Birthdate != "" {
+		if err := ValidateBirthdate(*updates.Birthdate); err != nil {
+			errs.add("birthdate", err)
+		} else if updates.Age != nil && !ageMatches(*updates.Birthdate, *updates.Age) {
+			errs.add("age", invalid(CodeAgeMismatch, "age does not match birthdate"))
+		}
+	}
+	return errs.err()
+}
+
+// MaxAge is the highest age accepted for users stored without a
+// birthdate.
+const MaxAge = 150
+
+const (
+	// MaxNameLength is the longest first or last name accepted, in
+	// characters after normalization.
+	MaxNameLength = 100
+	// maxNameMarks is how many combining marks may follow one letter. Real
+	// scripts need a few; more are only used to garble text.
+	maxNameMarks = 4
+)
+
+// nameSeparators may appear in names between the letters, as in
+// "María-José O'Connor" or "St. John".
+const nameSeparators = " -'.’"
+
+// NoName is accepted in place of a name, for people with a single name.
+const NoName = "-"
+
+// NormalizeName trims name, collapses runs of white space into a single
+// space and converts it to Unicode normalization form C, so a name typed
+// with combining accents is stored like its precomposed spelling.
+func NormalizeName(name string) string {
+	return norm.NFC.String(strings.Join(strings.Fields(name), " "))
+}
+
+// ValidateName checks a first or last name as it will be stored, that is
+// after NormalizeName. Letters of any script are accepted, each followed
+// by a few combining marks, with nameSeparators between them. Digits,
+// symbols such as emoji, control characters and invisible formatting
+// characters such as zero-width joiners or direction overrides are not.
+// Errors read as the end of a sentence starting with the field name.
+func ValidateName(name string) error {
+	name = NormalizeName(name)
+	if name == "" {
+		return invalid(CodeNameRequired, "is required")
+	}
+	if name == NoName {
+		return nil
+	}
+	if utf8.RuneCountInString(name) > MaxNameLength {
+		return invalid(CodeNameTooLong, "must be at most %d characters", MaxNameLength)
+	}
+	if !utf8.ValidString(name) {
+		return invalid(CodeNameInvalidCharacters, "must be valid UTF-8")
+	}
+	marks := 0
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r):
+			marks = 0
+		case unicode.Is(unicode.M, r):
+			marks++
+			if i == 0 || marks > maxNameMarks {
+				return invalid(CodeNameInvalidCharacters, "has misplaced combining marks")
+			}
+		case strings.ContainsRune(nameSeparators, r):
+			if i == 0 {
+				return invalid(CodeNameInvalidCharacters, "must start with a letter")
+			}
+			marks = maxNameMarks + 1 // no marks on punctuation
+		default:
+			return invalid(CodeNameInvalidCharacters, "must not contain %U", r)
+		}
+	}
 	return nil
 }
 
-func ValidateUserUpdate(updates *models.UserUpdate) error {
-	if updates.FirstName != nil && *updates.FirstName == "" {
-		return fmt.Errorf("first name is required")
+// SanitizeName drops what ValidateName rejects from a name taken from
+// elsewhere, such as an identity provider. It returns "" when nothing
+// usable is left.
+func SanitizeName(name string) string {
+	var b strings.Builder
+	marks := 0
+	for _, r := range NormalizeName(name) {
+		switch {
+		case unicode.IsLetter(r):
+			marks = 0
+		case unicode.Is(unicode.M, r) && b.Len() > 0 && marks < maxNameMarks:
+			marks++
+		case strings.ContainsRune(nameSeparators, r) && b.Len() > 0:
+			marks = maxNameMarks
+		default:
+			continue
+		}
+		b.WriteRune(r)
+	}
+	name = NormalizeName(b.String())
+	if utf8.RuneCountInString(name) > MaxNameLength {
+		name = NormalizeName(string([]rune(name)[:MaxNameLength]))
+	}
+	if ValidateName(name) != nil {
+		return ""
+	}
+	return name
+}
+
+// minBirthYear is the earliest year accepted as a birthdate.
+const minBirthYear = 1900
+
+// ValidateBirthdate checks that birthdate is a date such as "1990-04-01",
+// no earlier than 1900 and not in the future.
+func ValidateBirthdate(birthdate string) error {
+	d, err := time.Parse(models.DateLayout, birthdate)
+	if err != nil {
+		return invalid(CodeBirthdateInvalid, "birthdate must be a date such as \"1990-04-01\"")
+	}
+	if d.Year() < minBirthYear {
+		return invalid(CodeBirthdateTooEarly, "birthdate must not be before %d", minBirthYear)
+	}
+	if d.After(time.Now()) {
+		return invalid(CodeBirthdateInFuture, "birthdate must not be in the future")
+	}
+	return nil
+}
+
+// ageMatches reports whether age is the current age of someone born on
+// the valid birthdate.
+func ageMatches(birthdate string, age uint) bool {
+	d, _ := time.Parse(models.DateLayout, birthdate)
+	return models.AgeAt(d, time.Now()) == age
+}
+
+// maxLocaleLength is the size of the locale column.
+const maxLocaleLength = 35
+
+// ValidateLocale checks that locale is a well-formed BCP 47 language tag
+// such as "en", "pt-BR" or "zh-Hant-TW". The parser also takes "_" as a
+// separator, which BCP 47 does not.
+func ValidateLocale(locale string) error {
+	if _, err := language.Parse(locale); err != nil || len(locale) > maxLocaleLength || strings.Contains(locale, "_") {
+		return invalid(CodeLocaleInvalid, "locale must be a BCP 47 language tag such as \"en\" or \"pt-BR\"")
+	}
+	return nil
+}
+
+// ValidateTimezone checks that timezone names a zone of the IANA time zone
+// database, such as "Europe/Berlin" or "UTC".
+func ValidateTimezone(timezone string) error {
+	if timezone == "Local" {
+		return invalid(CodeTimezoneInvalid, "timezone must be an IANA time zone such as \"Europe/Berlin\"")
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return invalid(CodeTimezoneInvalid, "timezone must be an IANA time zone such as \"Europe/Berlin\"")
+	}
+	return nil
+}
+
+// idRe matches the IDs users may be created with: UUIDs, ULIDs and other
+// keys that are safe in URLs.
+var idRe = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// ValidateID checks an ID chosen for a new user.
+func ValidateID(id string) error {
+	if !idRe.MatchString(id) {
+		return invalid(CodeIDInvalid, "id must be 1 to 64 letters, digits, '_' or '-'")
+	}
+	return nil
+}
+
+var (
+	usernameRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.-]*$`)
+
+	// reservedUsernames could be mistaken for the service or its staff.
+	reservedUsernames = []string{
+		"admin", "administrator", "api", "help", "me", "moderator", "null",
+		"root", "security", "support", "system", "user", "users",
+	}
+)
+
+func ValidateUsername(name string) error {
+	if len(name) < 3 || len(name) > 30 {
+		return invalid(CodeUsernameLength, "username must be between 3 and 30 characters")
 	}
-	if updates.LastName != nil && *updates.LastName == "" {
-		return fmt.Errorf("last name is required")
+	if !usernameRe.MatchString(name) {
+		return invalid(CodeUsernameInvalid, "username must start with a letter and contain only letters, digits, '_', '.' and '-'")
 	}
-	if updates.Email != nil && !isValidEmail(*updates.Email) {
-		return fmt.Errorf("invalid email address")
+	if slices.Contains(reservedUsernames, strings.ToLower(name)) {
+		return invalid(CodeUsernameReserved, "username is reserved")
 	}
 	return nil
 }
 
+// gmailDomains are the domains of Gmail mailboxes, which ignore dots and
+// anything after a '+' in the local part.
+var gmailDomains = []string{"gmail.com", "googlemail.com"}
+
+// NormalizeEmail trims and lower-cases email. With canonicalGmail, Gmail
+// addresses also drop the dots and +tag of their local part and use the
+// gmail.com domain, so every spelling of one mailbox compares equal.
+func NormalizeEmail(email string, canonicalGmail bool) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !canonicalGmail {
+		return email
+	}
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || !slices.Contains(gmailDomains, domain) {
+		return email
+	}
+	local, _, _ = strings.Cut(local, "+")
+	local = strings.ReplaceAll(local, ".", "")
+	if local == "" {
+		return email
+	}
+	return local + "@gmail.com"
+}
+
 func isValidEmail(email string) bool {
 	re := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 	return re.MatchString(email)
 }
+
+func ValidateFields(fields []string) error {
+	for _, f := range fields {
+		if !models.IsUserField(f) {
+			return invalid(CodeFieldUnknown, "unknown field: %s", f)
+		}
+	}
+	return nil
+}
+
+func ValidateWebhook(webhook *models.Webhook, eventTypes []string) error {
+	var errs Errors
+	u, err := url.Parse(webhook.URL)
+	if err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.add("url", invalid(CodeWebhookURLInvalid, "invalid webhook url"))
+	}
+	if len(webhook.Events) == 0 {
+		errs.add("events", invalid(CodeWebhookEventsRequired, "at least one event type is required"))
+	}
+	for _, e := range webhook.Events {
+		if !slices.Contains(eventTypes, e) {
+			errs.add("events", invalid(CodeWebhookEventUnknown, "unknown event type: %s", e))
+		}
+	}
+	return errs.err()
+}
+
+func ValidateAPIKey(key *models.APIKey) error {
+	var errs Errors
+	if strings.TrimSpace(key.Name) == "" {
+		errs.add("name", invalid(CodeAPIKeyNameRequired, "name is required"))
+	}
+	if len(key.Scopes) == 0 {
+		errs.add("scopes", invalid(CodeAPIKeyScopesRequired, "at least one scope is required"))
+	}
+	for _, scope := range key.Scopes {
+		if !slices.Contains(models.Scopes, scope) {
+			errs.add("scopes", invalid(CodeAPIKeyScopeUnknown, "unknown scope: %s", scope))
+		}
+	}
+	return errs.err()
+}
+
+// ValidatePreferencesUpdate checks the preferences an update sets.
+func ValidatePreferencesUpdate(updates *models.PreferencesUpdate) error {
+	var errs Errors
+	if updates.Theme != nil && !updates.Theme.IsValid() {
+		errs.add("theme", invalid(CodeThemeInvalid, "theme must be system, light or dark"))
+	}
+	return errs.err()
+}
+
+// ValidateUserSnapshot checks a snapshot about to be restored like a new
+// user, except for the status, which restoring leaves alone.
+func ValidateUserSnapshot(snapshot *models.UserSnapshot) error {
+	if snapshot.User == nil {
+		return Field("user", invalid(CodeRequired, "user is required"))
+	}
+	profile := *snapshot.User
+	profile.Status = ""
+	var errs Errors
+	if err := ValidateUser(&profile); err != nil {
+		for _, fe := range err.(Errors) {
+			fe.Field = "user." + fe.Field
+			errs = append(errs, fe)
+		}
+	}
+	for _, tag := range profile.Tags {
+		if err := ValidateTag(tag); err != nil {
+			errs.add("user.tags", err)
+			break
+		}
+	}
+	if err := ValidateMetadata(snapshot.Metadata); err != nil {
+		errs = append(errs, err.(Errors)...)
+	}
+	if p := snapshot.Preferences; p != nil && !p.Theme.IsValid() {
+		errs.add("preferences.theme", invalid(CodeThemeInvalid, "theme must be system, light or dark"))
+	}
+	return errs.err()
+}
+
+// MaxConsentVersionLength bounds the version of a consented document.
+const MaxConsentVersionLength = 64
+
+// ValidateConsent checks a consent about to be recorded. Consents to the
+// terms of service name the version accepted.
+func ValidateConsent(consent *models.Consent) error {
+	var errs Errors
+	if !slices.Contains(models.ConsentKinds, consent.Kind) {
+		errs.add("kind", invalid(CodeConsentKindInvalid, "kind must be one of %s", strings.Join(models.ConsentKinds, ", ")))
+	}
+	if consent.Kind == models.ConsentTerms && consent.Version == "" {
+		errs.add("version", invalid(CodeConsentVersionRequired, "version is required for terms consents"))
+	}
+	if len(consent.Version) > MaxConsentVersionLength {
+		errs.add("version", invalid(CodeConsentVersionTooLong, "version must be at most %d characters", MaxConsentVersionLength))
+	}
+	return errs.err()
+}
+
+// Limits on groups.
+const (
+	MaxGroupNameLength        = 100
+	MaxGroupDescriptionLength = 1000
+)
+
+// ValidateGroup checks a group about to be created.
+func ValidateGroup(group *models.Group) error {
+	return validateGroupFields(&group.Name, &group.Description)
+}
+
+// ValidateGroupUpdate checks the fields an update sets.
+func ValidateGroupUpdate(updates *models.GroupUpdate) error {
+	return validateGroupFields(updates.Name, updates.Description)
+}
+
+func validateGroupFields(name, description *string) error {
+	var errs Errors
+	if name != nil {
+		if strings.TrimSpace(*name) == "" || utf8.RuneCountInString(*name) > MaxGroupNameLength {
+			errs.add("name", invalid(CodeGroupNameInvalid, "name must be 1 to %d characters", MaxGroupNameLength))
+		}
+	}
+	if description != nil && utf8.RuneCountInString(*description) > MaxGroupDescriptionLength {
+		errs.add("description", invalid(CodeGroupDescriptionTooLong, "description must not exceed %d characters", MaxGroupDescriptionLength))
+	}
+	return errs.err()
+}
+
+// tagRe matches a tag such as "beta", "vip" or "churn-risk".
+var tagRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_:-]{0,31}$`)
+
+// ValidateTag checks a user tag. Tags are compared lower case.
+func ValidateTag(tag string) error {
+	if !tagRe.MatchString(strings.ToLower(tag)) {
+		return invalid(CodeTagInvalid, "tags must be 1 to 32 letters, digits, '_', ':' or '-', starting with a letter or digit")
+	}
+	return nil
+}
+
+// Limits on user metadata.
+const (
+	MaxMetadataKeys      = 50
+	MaxMetadataKeyLength = 64
+	MaxMetadataBytes     = 16 << 10
+)
+
+// metadataKeyRe matches the keys metadata may use, which can also be
+// filtered on in query strings.
+var metadataKeyRe = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// ValidateMetadataKey checks a single metadata key.
+func ValidateMetadataKey(key string) error {
+	if len(key) > MaxMetadataKeyLength || !metadataKeyRe.MatchString(key) {
+		return invalid(CodeMetadataKeyInvalid, "keys must be 1 to %d letters, digits, '_', '.' or '-'", MaxMetadataKeyLength)
+	}
+	return nil
+}
+
+// ValidateMetadata checks the keys of md and that it holds at most
+// MaxMetadataKeys keys and MaxMetadataBytes of JSON.
+func ValidateMetadata(md models.Metadata) error {
+	var errs Errors
+	keys := make([]string, 0, len(md))
+	for key := range md {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := ValidateMetadataKey(key); err != nil {
+			errs.add("metadata."+key, err)
+		}
+	}
+	if len(md) > MaxMetadataKeys {
+		errs.add("metadata", invalid(CodeMetadataTooManyKeys, "metadata must not have more than %d keys", MaxMetadataKeys))
+	}
+	if b, err := json.Marshal(md); err != nil || len(b) > MaxMetadataBytes {
+		errs.add("metadata", invalid(CodeMetadataTooLarge, "metadata must not exceed %d bytes", MaxMetadataBytes))
+	}
+	return errs.err()
+}
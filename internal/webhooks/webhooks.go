@@ -0,0 +1,166 @@
+// Package webhooks delivers user events to operator registered endpoints as
+// signed HTTP callbacks.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"users/internal/events"
+	"users/internal/models"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+)
+
+// Store is the subset of the database service the dispatcher needs.
+type Store interface {
+	ListWebhooksForEvent(ctx context.Context, eventType string) ([]models.Webhook, error)
+	RecordWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+}
+
+// Dispatcher queues published events and delivers them to every subscribed
+// webhook, retrying failed deliveries with exponential backoff.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	queue  chan events.Event
+
+	// MaxAttempts is the number of delivery attempts per webhook and event.
+	MaxAttempts int
+	// Backoff is the delay before the first retry; it doubles on each attempt.
+	Backoff time.Duration
+}
+
+// NewDispatcher returns a dispatcher reading subscriptions from store.
+func NewDispatcher(store Store) *Dispatcher {
+	return &Dispatcher{
+		store:       store,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan events.Event, 1024),
+		MaxAttempts: 5,
+		Backoff:     time.Second,
+	}
+}
+
+// Handle enqueues e for delivery. It never blocks; events are dropped and
+// logged when the queue is full.
+func (d *Dispatcher) Handle(e events.Event) {
+	select {
+	case d.queue <- e:
+	default:
+		log.Printf("Webhook queue full, dropping event %s (%s)", e.ID, e.Type)
+	}
+}
+
+// Backlog returns the number of events waiting for delivery and how many
+// the queue holds before events are dropped.
+func (d *Dispatcher) Backlog() (queued, capacity int) {
+	return len(d.queue), cap(d.queue)
+}
+
+// Run delivers queued events until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-d.queue:
+			webhooks, err := d.store.ListWebhooksForEvent(ctx, e.Type)
+			if err != nil {
+				log.Printf("Error loading webhooks for %s: %v", e.Type, err)
+				continue
+			}
+			for _, webhook := range webhooks {
+				go d.deliver(ctx, webhook, e)
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, webhook models.Webhook, e events.Event) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Error encoding event %s: %v", e.ID, err)
+		return
+	}
+
+	backoff := d.Backoff
+	for attempt := 1; attempt <= d.MaxAttempts; attempt++ {
+		status, err := d.send(ctx, webhook, e, payload)
+
+		delivery := &models.WebhookDelivery{
+			WebhookID:  webhook.ID,
+			EventID:    e.ID,
+			EventType:  e.Type,
+			Attempt:    attempt,
+			StatusCode: status,
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		if err := d.store.RecordWebhookDelivery(ctx, delivery); err != nil {
+			log.Printf("Error recording webhook delivery: %v", err)
+		}
+		if err == nil {
+			return
+		}
+		if attempt == d.MaxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+	log.Printf("Giving up delivering event %s to webhook %s after %d attempts", e.ID, webhook.ID, d.MaxAttempts)
+}
+
+func (d *Dispatcher) send(ctx context.Context, webhook models.Webhook, e events.Event, payload []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, e.Type)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(webhook.Secret, timestamp, payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of "timestamp.payload" keyed by
+// secret. Receivers recompute it to verify a callback.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,176 @@
+// Package worker runs background jobs stored in the database. Jobs are
+// executed at least once: a worker that dies mid-job loses its lease and
+// the job runs again, so handlers must be safe to repeat.
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+var jobsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "users_jobs_total",
+	Help: "Background job attempts by kind and result.",
+}, []string{"kind", "result"})
+
+// Store is the subset of the database service the workers need.
+type Store interface {
+	EnqueueJob(ctx context.Context, job *models.Job) error
+	ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]models.Job, error)
+	CompleteJob(ctx context.Context, id int64) error
+	FailJob(ctx context.Context, id int64, message string, retryIn time.Duration) error
+}
+
+// Handler executes one job. The context carries the job's tenant.
+type Handler func(ctx context.Context, job models.Job) error
+
+// Pool claims jobs of the registered kinds and runs them on a fixed number
+// of goroutines.
+type Pool struct {
+	store    Store
+	handlers map[string]Handler
+
+	// Concurrency is the number of jobs run at the same time.
+	Concurrency int
+	// PollInterval is how long an idle pool waits before looking for jobs.
+	PollInterval time.Duration
+	// Lease is how long a claimed job stays locked to this pool. A job
+	// still running when it expires may be picked up elsewhere.
+	Lease time.Duration
+	// Backoff is the delay before the first retry; it doubles on each
+	// attempt.
+	Backoff time.Duration
+}
+
+// NewPool returns a pool working off store.
+func NewPool(store Store) *Pool {
+	return &Pool{
+		store:        store,
+		handlers:     make(map[string]Handler),
+		Concurrency:  4,
+		PollInterval: time.Second,
+		Lease:        5 * time.Minute,
+		Backoff:      10 * time.Second,
+	}
+}
+
+// Register makes the pool run jobs of kind with h. It must be called
+// before Run.
+func (p *Pool) Register(kind string, h Handler) {
+	p.handlers[kind] = h
+}
+
+// Enqueue queues a job of kind for the tenant of ctx with payload encoded
+// as JSON.
+func (p *Pool) Enqueue(ctx context.Context, kind string, payload any) error {
+	return p.EnqueueJob(ctx, &models.Job{Kind: kind}, payload)
+}
+
+// EnqueueJob queues job, for callers that set a key, a start time or a
+// number of attempts.
+func (p *Pool) EnqueueJob(ctx context.Context, job *models.Job, payload any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	job.Payload = b
+	return p.store.EnqueueJob(ctx, job)
+}
+
+// Run claims and executes jobs until ctx is done, then waits for the jobs
+// in flight.
+func (p *Pool) Run(ctx context.Context) {
+	kinds := make([]string, 0, len(p.handlers))
+	for kind := range p.handlers {
+		kinds = append(kinds, kind)
+	}
+	if len(kinds) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	slots := make(chan struct{}, p.Concurrency)
+	for {
+		var jobs []models.Job
+		if free := p.Concurrency - len(slots); free > 0 {
+			var err error
+			jobs, err = p.store.ClaimJobs(ctx, kinds, free, p.Lease)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Error claiming jobs: %v", err)
+			}
+		}
+		for _, job := range jobs {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(job models.Job) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				p.run(ctx, job)
+			}(job)
+		}
+		// A full page means more work is probably waiting.
+		if len(jobs) > 0 && len(slots) < p.Concurrency {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.PollInterval):
+		}
+	}
+}
+
+func (p *Pool) run(ctx context.Context, job models.Job) {
+	ctx, cancel := context.WithTimeout(tenant.WithTenant(ctx, job.TenantID), p.Lease)
+	defer cancel()
+
+	err := p.call(ctx, job)
+	// The outcome is recorded even when shutdown cancelled ctx.
+	recordCtx, cancelRecord := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancelRecord()
+	if err == nil {
+		jobsTotal.WithLabelValues(job.Kind, "success").Inc()
+		if err := p.store.CompleteJob(recordCtx, job.ID); err != nil {
+			log.Printf("Error completing job %d: %v", job.ID, err)
+		}
+		return
+	}
+
+	jobsTotal.WithLabelValues(job.Kind, "error").Inc()
+	if job.Attempts >= job.MaxAttempts {
+		log.Printf("Job %d (%s) failed for the last time: %v", job.ID, job.Kind, err)
+	}
+	if err := p.store.FailJob(recordCtx, job.ID, err.Error(), p.backoff(job.Attempts)); err != nil {
+		log.Printf("Error recording failure of job %d: %v", job.ID, err)
+	}
+}
+
+// call runs the handler, turning a panic into an error so one bad job
+// cannot take the pool down.
+func (p *Pool) call(ctx context.Context, job models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return p.handlers[job.Kind](ctx, job)
+}
+
+func (p *Pool) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < time.Hour; i++ {
+		d *= 2
+	}
+	return min(d, time.Hour)
+}
@@ -0,0 +1,10 @@
+CREATE TABLE idempotency_keys (
+                       key VARCHAR(255) PRIMARY KEY,
+                       request_hash VARCHAR(64) NOT NULL,
+                       status_code INTEGER NOT NULL,
+                       body BYTEA NOT NULL,
+                       created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                       expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
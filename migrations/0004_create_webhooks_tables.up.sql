@@ -0,0 +1,21 @@
+CREATE TABLE webhooks (
+                       id VARCHAR(255) PRIMARY KEY,
+                       url TEXT NOT NULL,
+                       secret VARCHAR(255) NOT NULL,
+                       events TEXT[] NOT NULL,
+                       active BOOLEAN NOT NULL DEFAULT TRUE,
+                       created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE webhook_deliveries (
+                       id BIGSERIAL PRIMARY KEY,
+                       webhook_id VARCHAR(255) NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+                       event_id VARCHAR(255) NOT NULL,
+                       event_type VARCHAR(64) NOT NULL,
+                       attempt INTEGER NOT NULL,
+                       status_code INTEGER,
+                       error TEXT,
+                       created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, created DESC);
@@ -0,0 +1,6 @@
+ALTER TABLE users
+    ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+        to_tsvector('simple', first_name || ' ' || last_name || ' ' || email)
+    ) STORED;
+
+CREATE INDEX users_search_vector_idx ON users USING GIN (search_vector);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_tenant_id_lower_email_key;
+ALTER TABLE users ADD CONSTRAINT users_tenant_id_email_key UNIQUE (tenant_id, email);
@@ -0,0 +1,29 @@
+-- Emails differing only in case or surrounding spaces collide once they
+-- are normalized. Which account to keep is for an operator to decide, so
+-- refuse to migrate with a list of them rather than fail on the index.
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(format('%s in tenant %s (%s users)', email, tenant_id, n), '; ')
+    INTO duplicates
+    FROM (
+        SELECT tenant_id, lower(trim(email)) AS email, count(*) AS n
+        FROM users
+        GROUP BY 1, 2
+        HAVING count(*) > 1
+        ORDER BY 1, 2
+        LIMIT 20
+    ) d;
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'users share an email apart from case or spaces: %', duplicates
+            USING HINT = 'Delete or change the email of all but one user of each, then migrate again. '
+                || 'SELECT tenant_id, lower(trim(email)), array_agg(id) FROM users GROUP BY 1, 2 HAVING count(*) > 1 lists them all.';
+    END IF;
+END
+$$;
+
+UPDATE users SET email = lower(trim(email)) WHERE email <> lower(trim(email));
+
+ALTER TABLE users DROP CONSTRAINT users_tenant_id_email_key;
+CREATE UNIQUE INDEX users_tenant_id_lower_email_key ON users (tenant_id, lower(email));
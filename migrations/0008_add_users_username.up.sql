@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN username VARCHAR(30);
+
+CREATE UNIQUE INDEX users_tenant_id_lower_username_key ON users (tenant_id, lower(username));
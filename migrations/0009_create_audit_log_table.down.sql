@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS anonymized_at;
+DROP TABLE IF EXISTS audit_log;
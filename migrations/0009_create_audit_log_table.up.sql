@@ -0,0 +1,13 @@
+CREATE TABLE audit_log (
+                       id BIGSERIAL PRIMARY KEY,
+                       tenant_id VARCHAR(64) NOT NULL,
+                       actor VARCHAR(255) NOT NULL,
+                       action VARCHAR(64) NOT NULL,
+                       target_user_id VARCHAR(255),
+                       details JSONB NOT NULL DEFAULT '{}',
+                       created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX audit_log_target_user_id_idx ON audit_log (tenant_id, target_user_id, created);
+
+ALTER TABLE users ADD COLUMN anonymized_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS identities;
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE identities (
+                       id BIGSERIAL PRIMARY KEY,
+                       tenant_id VARCHAR(64) NOT NULL,
+                       user_id VARCHAR(255) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       provider VARCHAR(32) NOT NULL,
+                       subject VARCHAR(255) NOT NULL,
+                       email VARCHAR(255),
+                       created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                       UNIQUE (tenant_id, provider, subject),
+                       UNIQUE (user_id, provider)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE api_keys (
+                       id VARCHAR(255) PRIMARY KEY,
+                       tenant_id VARCHAR(64) NOT NULL,
+                       name VARCHAR(255) NOT NULL,
+                       prefix VARCHAR(16) NOT NULL,
+                       key_hash VARCHAR(64) UNIQUE NOT NULL,
+                       scopes TEXT[] NOT NULL,
+                       created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                       last_used_at TIMESTAMP WITH TIME ZONE,
+                       revoked_at TIMESTAMP WITH TIME ZONE
+);
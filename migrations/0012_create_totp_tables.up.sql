@@ -0,0 +1,15 @@
+CREATE TABLE user_totp (
+                       user_id VARCHAR(255) PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+                       tenant_id VARCHAR(64) NOT NULL,
+                       secret VARCHAR(64) NOT NULL,
+                       enabled_at TIMESTAMP WITH TIME ZONE,
+                       last_used_step BIGINT NOT NULL DEFAULT 0,
+                       created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE totp_recovery_codes (
+                       user_id VARCHAR(255) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       code_hash VARCHAR(64) NOT NULL,
+                       used_at TIMESTAMP WITH TIME ZONE,
+                       PRIMARY KEY (user_id, code_hash)
+);
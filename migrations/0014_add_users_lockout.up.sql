@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN first_failed_login_at TIMESTAMPTZ,
+    ADD COLUMN locked_until TIMESTAMPTZ;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_users_tenant_last_seen;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS last_seen_at,
+    DROP COLUMN IF EXISTS last_login_at;
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN last_login_at TIMESTAMPTZ,
+    ADD COLUMN last_seen_at TIMESTAMPTZ;
+
+CREATE INDEX idx_users_tenant_last_seen ON users (tenant_id, last_seen_at);
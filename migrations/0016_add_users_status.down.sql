@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_tenant_status;
+
+ALTER TABLE users DROP COLUMN IF EXISTS status;
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'active'
+        CHECK (status IN ('pending', 'active', 'suspended'));
+
+CREATE INDEX idx_users_tenant_status ON users (tenant_id, status);
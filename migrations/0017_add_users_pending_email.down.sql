@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_users_email_token_hash;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS email_token_expires_at,
+    DROP COLUMN IF EXISTS email_token_hash,
+    DROP COLUMN IF EXISTS pending_email;
@@ -0,0 +1,6 @@
+ALTER TABLE users
+    ADD COLUMN pending_email VARCHAR(255),
+    ADD COLUMN email_token_hash VARCHAR(64),
+    ADD COLUMN email_token_expires_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX idx_users_email_token_hash ON users (email_token_hash);
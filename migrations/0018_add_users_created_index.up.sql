@@ -0,0 +1 @@
+CREATE INDEX idx_users_tenant_created ON users (tenant_id, created);
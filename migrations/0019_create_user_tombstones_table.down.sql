@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS users_tombstone ON users;
+DROP FUNCTION IF EXISTS record_user_tombstone();
+DROP INDEX IF EXISTS idx_users_tenant_updated;
+DROP TABLE IF EXISTS user_tombstones;
@@ -0,0 +1,20 @@
+CREATE TABLE user_tombstones (
+                       tenant_id VARCHAR(64) NOT NULL,
+                       user_id VARCHAR(255) NOT NULL,
+                       deleted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_user_tombstones_tenant_deleted ON user_tombstones (tenant_id, deleted_at, user_id);
+CREATE INDEX idx_users_tenant_updated ON users (tenant_id, updated_at, id);
+
+-- Every way a row can disappear leaves a tombstone behind for delta syncs.
+CREATE FUNCTION record_user_tombstone() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO user_tombstones (tenant_id, user_id) VALUES (OLD.tenant_id, OLD.id);
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_tombstone
+    AFTER DELETE ON users
+    FOR EACH ROW EXECUTE FUNCTION record_user_tombstone();
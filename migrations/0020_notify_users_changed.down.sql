@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS users_changed_update ON users;
+DROP TRIGGER IF EXISTS users_changed_insert_delete ON users;
+DROP FUNCTION IF EXISTS notify_users_changed();
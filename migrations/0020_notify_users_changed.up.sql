@@ -0,0 +1,25 @@
+-- Other instances LISTEN on users_changed to drop cached users as soon as a
+-- change commits. Activity tracking only moves last_seen_at, so updates
+-- notify only when updated_at moves.
+CREATE FUNCTION notify_users_changed() RETURNS trigger AS $$
+DECLARE
+    u users%ROWTYPE;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        u := OLD;
+    ELSE
+        u := NEW;
+    END IF;
+    PERFORM pg_notify('users_changed', json_build_object('tenant_id', u.tenant_id, 'id', u.id, 'op', TG_OP)::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_changed_insert_delete
+    AFTER INSERT OR DELETE ON users
+    FOR EACH ROW EXECUTE FUNCTION notify_users_changed();
+
+CREATE TRIGGER users_changed_update
+    AFTER UPDATE ON users
+    FOR EACH ROW WHEN (OLD.updated_at IS DISTINCT FROM NEW.updated_at)
+    EXECUTE FUNCTION notify_users_changed();
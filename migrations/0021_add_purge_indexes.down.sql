@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_user_tombstones_deleted_at;
+DROP INDEX IF EXISTS audit_log_created_idx;
+DROP INDEX IF EXISTS idx_users_email_token_expires_at;
+DROP INDEX IF EXISTS idx_users_anonymized_at;
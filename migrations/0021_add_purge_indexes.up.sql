@@ -0,0 +1,4 @@
+CREATE INDEX idx_users_anonymized_at ON users (anonymized_at) WHERE anonymized_at IS NOT NULL;
+CREATE INDEX idx_users_email_token_expires_at ON users (email_token_expires_at) WHERE email_token_expires_at IS NOT NULL;
+CREATE INDEX audit_log_created_idx ON audit_log (created);
+CREATE INDEX idx_user_tombstones_deleted_at ON user_tombstones (deleted_at);
@@ -0,0 +1,20 @@
+CREATE TABLE jobs (
+                       id BIGSERIAL PRIMARY KEY,
+                       kind VARCHAR(64) NOT NULL,
+                       tenant_id VARCHAR(64) NOT NULL,
+                       key VARCHAR(255),
+                       payload JSONB NOT NULL DEFAULT '{}',
+                       status VARCHAR(16) NOT NULL DEFAULT 'pending',
+                       attempts INTEGER NOT NULL DEFAULT 0,
+                       max_attempts INTEGER NOT NULL DEFAULT 5,
+                       run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       locked_until TIMESTAMP WITH TIME ZONE,
+                       last_error TEXT,
+                       created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX jobs_ready_idx ON jobs (run_at) WHERE status = 'pending';
+CREATE INDEX jobs_locked_until_idx ON jobs (locked_until) WHERE status = 'running';
+CREATE INDEX jobs_status_idx ON jobs (status, id);
+CREATE UNIQUE INDEX jobs_key_idx ON jobs (key) WHERE key IS NOT NULL AND status <> 'dead';
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_users_reset_token_expires_at;
+DROP INDEX IF EXISTS idx_users_reset_token_hash;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS reset_token_expires_at,
+    DROP COLUMN IF EXISTS reset_token_hash;
@@ -0,0 +1,6 @@
+ALTER TABLE users
+    ADD COLUMN reset_token_hash VARCHAR(64),
+    ADD COLUMN reset_token_expires_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX idx_users_reset_token_hash ON users (reset_token_hash);
+CREATE INDEX idx_users_reset_token_expires_at ON users (reset_token_expires_at) WHERE reset_token_expires_at IS NOT NULL;
@@ -0,0 +1,12 @@
+ALTER TABLE users ADD COLUMN locale VARCHAR(35);
+
+CREATE TABLE notification_templates (
+                       tenant_id VARCHAR(64) NOT NULL,
+                       name VARCHAR(64) NOT NULL,
+                       locale VARCHAR(35) NOT NULL,
+                       subject TEXT NOT NULL,
+                       text_body TEXT NOT NULL,
+                       html_body TEXT NOT NULL DEFAULT '',
+                       updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       PRIMARY KEY (tenant_id, name, locale)
+);
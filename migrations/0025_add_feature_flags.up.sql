@@ -0,0 +1,7 @@
+CREATE TABLE feature_flags (
+                       tenant_id VARCHAR(64) NOT NULL,
+                       name VARCHAR(64) NOT NULL,
+                       enabled BOOLEAN NOT NULL,
+                       updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       PRIMARY KEY (tenant_id, name)
+);
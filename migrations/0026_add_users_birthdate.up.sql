@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN birthdate DATE CHECK (birthdate >= DATE '1900-01-01');
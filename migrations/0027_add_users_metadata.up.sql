@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN metadata JSONB NOT NULL DEFAULT '{}';
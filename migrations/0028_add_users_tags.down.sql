@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_tags_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX users_tags_idx ON users USING GIN (tags);
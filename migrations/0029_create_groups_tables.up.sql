@@ -0,0 +1,19 @@
+CREATE TABLE groups (
+                       id VARCHAR(255) PRIMARY KEY,
+                       tenant_id VARCHAR(64) NOT NULL,
+                       name VARCHAR(100) NOT NULL,
+                       description TEXT NOT NULL DEFAULT '',
+                       created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX groups_tenant_id_lower_name_key ON groups (tenant_id, lower(name));
+
+CREATE TABLE group_members (
+                       group_id VARCHAR(255) NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+                       user_id VARCHAR(255) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                       added_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX group_members_user_id_idx ON group_members (user_id);
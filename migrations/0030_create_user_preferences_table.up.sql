@@ -0,0 +1,8 @@
+CREATE TABLE user_preferences (
+                       user_id VARCHAR(255) PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+                       email_notifications BOOLEAN NOT NULL,
+                       security_alerts BOOLEAN NOT NULL,
+                       newsletter BOOLEAN NOT NULL,
+                       theme VARCHAR(16) NOT NULL,
+                       updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
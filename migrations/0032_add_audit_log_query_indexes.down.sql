@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS audit_log_tenant_id_actor_idx;
+DROP INDEX IF EXISTS audit_log_tenant_id_created_idx;
@@ -0,0 +1,2 @@
+CREATE INDEX audit_log_tenant_id_created_idx ON audit_log (tenant_id, created);
+CREATE INDEX audit_log_tenant_id_actor_idx ON audit_log (tenant_id, actor, created);
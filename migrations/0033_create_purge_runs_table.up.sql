@@ -0,0 +1,11 @@
+CREATE TABLE purge_runs (
+                       id BIGSERIAL PRIMARY KEY,
+                       job VARCHAR(64) NOT NULL,
+                       dry_run BOOLEAN NOT NULL,
+                       rows BIGINT NOT NULL,
+                       error TEXT,
+                       started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                       finished_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX purge_runs_started_at_idx ON purge_runs (started_at);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS users_full_name_trgm_idx;
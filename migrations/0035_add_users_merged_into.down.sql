@@ -0,0 +1,4 @@
+UPDATE users SET status = 'suspended' WHERE status = 'merged';
+ALTER TABLE users DROP COLUMN IF EXISTS merged_into;
+ALTER TABLE users DROP CONSTRAINT users_status_check;
+ALTER TABLE users ADD CONSTRAINT users_status_check CHECK (status IN ('pending', 'active', 'suspended'));
@@ -0,0 +1,4 @@
+ALTER TABLE users DROP CONSTRAINT users_status_check;
+ALTER TABLE users
+    ADD CONSTRAINT users_status_check CHECK (status IN ('pending', 'active', 'suspended', 'merged')),
+    ADD COLUMN merged_into VARCHAR(255) REFERENCES users (id) ON DELETE SET NULL;
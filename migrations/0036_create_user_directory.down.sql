@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_user_tombstones_deleted;
+DROP INDEX IF EXISTS idx_users_updated;
+DROP TABLE IF EXISTS read_model_positions;
+DROP TABLE IF EXISTS user_directory;
@@ -0,0 +1,30 @@
+-- Read model of the users table serving lists and searches, kept up to
+-- date from the change feed by RefreshUserDirectory. It holds no
+-- credentials. Columns added to users that lists return or filter on must
+-- be added here and to directoryColumns too.
+CREATE TABLE user_directory AS
+    SELECT id, tenant_id, first_name, last_name, username, email, pending_email, locale, timezone,
+           tags, status, age, birthdate, created, updated_at, version, merged_into, anonymized_at,
+           last_login_at, last_seen_at, metadata, search_vector
+    FROM users
+    WITH NO DATA;
+
+ALTER TABLE user_directory ADD PRIMARY KEY (id);
+CREATE INDEX user_directory_tenant_created_idx ON user_directory (tenant_id, created, id);
+CREATE INDEX user_directory_tenant_email_idx ON user_directory (tenant_id, lower(email));
+CREATE INDEX user_directory_tenant_status_idx ON user_directory (tenant_id, status, created);
+CREATE INDEX user_directory_tenant_seen_idx ON user_directory (tenant_id, (COALESCE(last_seen_at, created)));
+CREATE INDEX user_directory_tags_idx ON user_directory USING GIN (tags);
+CREATE INDEX user_directory_search_idx ON user_directory USING GIN (search_vector);
+
+-- Read models remember how far into the change feed they are.
+CREATE TABLE read_model_positions (
+                       name VARCHAR(64) PRIMARY KEY,
+                       changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT '1970-01-01 00:00:00+00',
+                       user_id VARCHAR(255) NOT NULL DEFAULT '',
+                       caught_up_at TIMESTAMP WITH TIME ZONE
+);
+
+-- The projection reads the feed across tenants.
+CREATE INDEX idx_users_updated ON users (updated_at, id);
+CREATE INDEX idx_user_tombstones_deleted ON user_tombstones (deleted_at, user_id);
@@ -0,0 +1,35 @@
+DROP TRIGGER IF EXISTS users_clear_merged_into ON users;
+DROP FUNCTION IF EXISTS clear_merged_into();
+DROP INDEX IF EXISTS idx_users_tenant_merged_into;
+
+ALTER TABLE identities DROP CONSTRAINT IF EXISTS identities_user_id_fkey;
+ALTER TABLE user_totp DROP CONSTRAINT IF EXISTS user_totp_user_id_fkey;
+ALTER TABLE totp_recovery_codes DROP CONSTRAINT IF EXISTS totp_recovery_codes_user_id_fkey;
+ALTER TABLE group_members DROP CONSTRAINT IF EXISTS group_members_user_id_fkey;
+ALTER TABLE user_preferences DROP CONSTRAINT IF EXISTS user_preferences_user_id_fkey;
+
+DROP INDEX IF EXISTS idx_users_reset_token_hash;
+CREATE UNIQUE INDEX idx_users_reset_token_hash ON users (reset_token_hash);
+DROP INDEX IF EXISTS idx_users_email_token_hash;
+CREATE UNIQUE INDEX idx_users_email_token_hash ON users (email_token_hash);
+
+DROP INDEX IF EXISTS idx_users_id;
+ALTER TABLE users DROP CONSTRAINT users_pkey;
+ALTER TABLE users ADD CONSTRAINT users_pkey PRIMARY KEY (id);
+
+ALTER TABLE identities ADD CONSTRAINT identities_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE user_totp ADD CONSTRAINT user_totp_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE totp_recovery_codes ADD CONSTRAINT totp_recovery_codes_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE group_members ADD CONSTRAINT group_members_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE user_preferences ADD CONSTRAINT user_preferences_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE users ADD CONSTRAINT users_merged_into_fkey
+    FOREIGN KEY (merged_into) REFERENCES users (id) ON DELETE SET NULL;
+
+ALTER TABLE user_preferences DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE group_members DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE totp_recovery_codes DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,57 @@
+-- Every key of users and of the tables referencing it includes tenant_id,
+-- the column the users table can be partitioned by (./users partition).
+-- A partitioned table only enforces keys that include its partition key.
+ALTER TABLE totp_recovery_codes ADD COLUMN tenant_id VARCHAR(64);
+ALTER TABLE group_members ADD COLUMN tenant_id VARCHAR(64);
+ALTER TABLE user_preferences ADD COLUMN tenant_id VARCHAR(64);
+
+UPDATE totp_recovery_codes c SET tenant_id = u.tenant_id FROM users u WHERE u.id = c.user_id;
+UPDATE group_members m SET tenant_id = u.tenant_id FROM users u WHERE u.id = m.user_id;
+UPDATE user_preferences p SET tenant_id = u.tenant_id FROM users u WHERE u.id = p.user_id;
+
+ALTER TABLE totp_recovery_codes ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE group_members ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE user_preferences ALTER COLUMN tenant_id SET NOT NULL;
+
+ALTER TABLE identities DROP CONSTRAINT identities_user_id_fkey;
+ALTER TABLE user_totp DROP CONSTRAINT user_totp_user_id_fkey;
+ALTER TABLE totp_recovery_codes DROP CONSTRAINT totp_recovery_codes_user_id_fkey;
+ALTER TABLE group_members DROP CONSTRAINT group_members_user_id_fkey;
+ALTER TABLE user_preferences DROP CONSTRAINT user_preferences_user_id_fkey;
+ALTER TABLE users DROP CONSTRAINT users_merged_into_fkey;
+
+ALTER TABLE users DROP CONSTRAINT users_pkey;
+ALTER TABLE users ADD CONSTRAINT users_pkey PRIMARY KEY (tenant_id, id);
+-- The change feed projections and full scans look users up by ID alone.
+CREATE INDEX idx_users_id ON users (id);
+
+DROP INDEX idx_users_email_token_hash;
+CREATE UNIQUE INDEX idx_users_email_token_hash ON users (tenant_id, email_token_hash);
+DROP INDEX idx_users_reset_token_hash;
+CREATE UNIQUE INDEX idx_users_reset_token_hash ON users (tenant_id, reset_token_hash);
+
+ALTER TABLE identities ADD CONSTRAINT identities_user_id_fkey
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users (tenant_id, id) ON DELETE CASCADE;
+ALTER TABLE user_totp ADD CONSTRAINT user_totp_user_id_fkey
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users (tenant_id, id) ON DELETE CASCADE;
+ALTER TABLE totp_recovery_codes ADD CONSTRAINT totp_recovery_codes_user_id_fkey
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users (tenant_id, id) ON DELETE CASCADE;
+ALTER TABLE group_members ADD CONSTRAINT group_members_user_id_fkey
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users (tenant_id, id) ON DELETE CASCADE;
+ALTER TABLE user_preferences ADD CONSTRAINT user_preferences_user_id_fkey
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users (tenant_id, id) ON DELETE CASCADE;
+
+-- A composite key cannot set only merged_into to NULL before PostgreSQL 15,
+-- so a trigger takes over from the foreign key.
+CREATE INDEX idx_users_tenant_merged_into ON users (tenant_id, merged_into) WHERE merged_into IS NOT NULL;
+
+CREATE FUNCTION clear_merged_into() RETURNS trigger AS $$
+BEGIN
+    UPDATE users SET merged_into = NULL WHERE tenant_id = OLD.tenant_id AND merged_into = OLD.id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_clear_merged_into
+    AFTER DELETE ON users
+    FOR EACH ROW EXECUTE FUNCTION clear_merged_into();
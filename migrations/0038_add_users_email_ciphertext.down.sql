@@ -0,0 +1,9 @@
+-- Rows with encrypted emails hold only the blind indexes of their
+-- addresses once the ciphertext is dropped.
+ALTER TABLE user_directory
+    DROP COLUMN email_ciphertext,
+    DROP COLUMN pending_email_ciphertext;
+
+ALTER TABLE users
+    DROP COLUMN email_ciphertext,
+    DROP COLUMN pending_email_ciphertext;
@@ -0,0 +1,10 @@
+-- Encrypted email addresses, see internal/pii. Rows that have them hold
+-- the blind indexes of the addresses in email and pending_email instead of
+-- the addresses themselves.
+ALTER TABLE users
+    ADD COLUMN email_ciphertext TEXT,
+    ADD COLUMN pending_email_ciphertext TEXT;
+
+ALTER TABLE user_directory
+    ADD COLUMN email_ciphertext TEXT,
+    ADD COLUMN pending_email_ciphertext TEXT;
@@ -0,0 +1,7 @@
+CREATE TABLE tenant_quotas (
+                       tenant_id VARCHAR(64) NOT NULL,
+                       name VARCHAR(64) NOT NULL,
+                       quota BIGINT NOT NULL CHECK (quota >= 0),
+                       updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       PRIMARY KEY (tenant_id, name)
+);
@@ -0,0 +1,13 @@
+CREATE TABLE consents (
+                       id BIGSERIAL PRIMARY KEY,
+                       tenant_id VARCHAR(64) NOT NULL,
+                       user_id VARCHAR(255) NOT NULL,
+                       kind VARCHAR(32) NOT NULL,
+                       version VARCHAR(64) NOT NULL DEFAULT '',
+                       granted BOOLEAN NOT NULL,
+                       source_ip VARCHAR(45),
+                       recorded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       FOREIGN KEY (tenant_id, user_id) REFERENCES users (tenant_id, id) ON DELETE CASCADE
+);
+
+CREATE INDEX consents_user_idx ON consents (tenant_id, user_id, kind, recorded_at);
@@ -0,0 +1,3 @@
+-- The client address audited changes were requested from, see
+-- internal/proxy. Entries recorded outside of a request have none.
+ALTER TABLE audit_log ADD COLUMN ip VARCHAR(45);
@@ -0,0 +1,18 @@
+CREATE TABLE export_jobs (
+                       id BIGSERIAL PRIMARY KEY,
+                       tenant_id VARCHAR(64) NOT NULL,
+                       format VARCHAR(16) NOT NULL,
+                       filter JSONB NOT NULL DEFAULT '{}',
+                       status VARCHAR(16) NOT NULL DEFAULT 'pending',
+                       total BIGINT NOT NULL DEFAULT 0,
+                       exported BIGINT NOT NULL DEFAULT 0,
+                       storage_key VARCHAR(255),
+                       size BIGINT NOT NULL DEFAULT 0,
+                       error TEXT,
+                       created_by VARCHAR(255),
+                       created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                       completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX export_jobs_tenant_idx ON export_jobs (tenant_id, id);
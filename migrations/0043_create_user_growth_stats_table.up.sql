@@ -0,0 +1,11 @@
+CREATE TABLE user_growth_stats (
+                       tenant_id VARCHAR(64) NOT NULL,
+                       day DATE NOT NULL,
+                       signups BIGINT NOT NULL DEFAULT 0,
+                       deletions BIGINT NOT NULL DEFAULT 0,
+                       active_users BIGINT NOT NULL DEFAULT 0,
+                       refreshed_at TIMESTAMP WITH TIME ZONE,
+                       PRIMARY KEY (tenant_id, day)
+);
+
+CREATE INDEX user_growth_stats_refreshed_idx ON user_growth_stats (day) WHERE refreshed_at IS NOT NULL;
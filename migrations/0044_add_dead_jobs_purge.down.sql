@@ -0,0 +1 @@
+DROP INDEX IF EXISTS jobs_dead_updated_at_idx;
@@ -0,0 +1,5 @@
+-- Mail jobs used to carry the rendered mail, tokens included, which dead
+-- jobs kept forever
+DELETE FROM jobs WHERE kind = 'mail.send' AND status = 'dead';
+
+CREATE INDEX jobs_dead_updated_at_idx ON jobs (updated_at) WHERE status = 'dead';
@@ -0,0 +1,18 @@
+-- The users seen on each day (UTC), which the growth statistics refresh
+-- counts into user_growth_stats.active_users. Each sighting only inserts
+-- its own row, so busy tenants do not contend for one counter. Days the
+-- refresh has counted are pruned.
+CREATE TABLE user_daily_activity (
+                       tenant_id VARCHAR(64) NOT NULL,
+                       day DATE NOT NULL,
+                       user_id VARCHAR(255) NOT NULL,
+                       PRIMARY KEY (tenant_id, day, user_id)
+);
+
+CREATE INDEX user_daily_activity_day_idx ON user_daily_activity (day);
+
+-- The day each user was last seen is all that is known of the past
+INSERT INTO user_daily_activity (tenant_id, day, user_id)
+SELECT tenant_id, (last_seen_at AT TIME ZONE 'UTC')::date, id
+FROM users
+WHERE last_seen_at IS NOT NULL;
@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"users/internal/activity"
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// activityStore records the batches a tracker writes.
+type activityStore struct {
+	batches [][]models.Activity
+}
+
+func (s *activityStore) TouchLastSeen(ctx context.Context, seen []models.Activity) error {
+	s.batches = append(s.batches, seen)
+	return nil
+}
+
+func TestTrackerWritesLatestSightingPerUser(t *testing.T) {
+	store := &activityStore{}
+	tracker := activity.NewTracker(store)
+	if err := tracker.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.batches) != 0 {
+		t.Fatalf("flushing no sightings wrote %d batches", len(store.batches))
+	}
+
+	tracker.Seen("tenant-a", "user-1")
+	first := time.Now()
+	tracker.Seen("tenant-a", "user-1")
+	tracker.Seen("tenant-b", "user-1")
+	if err := tracker.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.batches) != 1 || len(store.batches[0]) != 2 {
+		t.Fatalf("batches = %v; want one of two sightings", store.batches)
+	}
+	for _, a := range store.batches[0] {
+		if a.TenantID == "tenant-a" && a.SeenAt.Before(first) {
+			t.Errorf("tenant-a sighting at %v; want the latest", a.SeenAt)
+		}
+	}
+
+	if err := tracker.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.batches) != 1 {
+		t.Errorf("a second flush wrote sightings again")
+	}
+}
+
+func TestRecordLoginAndLastSeen(t *testing.T) {
+	db, ctx := testDB(t)
+	user, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RecordLogin(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.LastLoginAt == nil || got.LastSeenAt == nil {
+		t.Fatalf("after a login last_login_at = %v, last_seen_at = %v; want both set", got.LastLoginAt, got.LastSeenAt)
+	}
+	seenAt := *got.LastSeenAt
+
+	// An older sighting arriving late does not move last_seen_at back
+	old := []models.Activity{{TenantID: tenant.FromContext(ctx), UserID: user.ID, SeenAt: seenAt.Add(-time.Hour)}}
+	if err := db.TouchLastSeen(ctx, old); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = db.GetUserByID(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !got.LastSeenAt.Equal(seenAt) {
+		t.Errorf("last_seen_at = %v after an older sighting; want %v", got.LastSeenAt, seenAt)
+	}
+
+	later := seenAt.Add(time.Minute)
+	if err := db.TouchLastSeen(ctx, []models.Activity{{TenantID: tenant.FromContext(ctx), UserID: user.ID, SeenAt: later}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = db.GetUserByID(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !got.LastSeenAt.Equal(later) {
+		t.Errorf("last_seen_at = %v; want %v", got.LastSeenAt, later)
+	}
+	if got.Version != user.Version {
+		t.Errorf("sightings changed version %d to %d", user.Version, got.Version)
+	}
+}
+
+func TestListInactiveUsers(t *testing.T) {
+	db, ctx := testDB(t)
+	active, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle, err := db.CreateUser(ctx, testUser("Grace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	seen := []models.Activity{{TenantID: tenant.FromContext(ctx), UserID: active.ID, SeenAt: now.Add(time.Hour)}}
+	if err := db.TouchLastSeen(ctx, seen); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := db.ListUsers(ctx, database.UserFilter{InactiveSince: now.Add(time.Minute)}, database.Page{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != idle.ID {
+		t.Errorf("inactive users = %v; want only %s, who was never seen", users, idle.ID)
+	}
+}
+
+func TestInactiveDaysMustBePositive(t *testing.T) {
+	h := testServer(t, &dryRunService{})
+	for _, v := range []string{"0", "-3", "soon"} {
+		rec := request(h, http.MethodGet, "/api/v1/users?inactive_days="+v, "", asAdmin...)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("inactive_days=%s: status = %d; want 400", v, rec.Code)
+		}
+	}
+}
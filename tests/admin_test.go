@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+const testAPIKey = "uk_test-key"
+
+// apiKeyService knows one API key with scopes, issued for tenant acme.
+type apiKeyService struct {
+	database.Service
+	scopes []string
+	// tenants records the tenant each quota listing was made for.
+	tenants []string
+}
+
+func (s *apiKeyService) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	if hash != hashKey(testAPIKey) {
+		return nil, sql.ErrNoRows
+	}
+	return &models.APIKey{ID: "key-1", TenantID: "acme", Scopes: s.scopes}, nil
+}
+
+func (s *apiKeyService) TouchAPIKey(ctx context.Context, id string) error { return nil }
+
+func (s *apiKeyService) ListQuotas(ctx context.Context) ([]models.Quota, error) {
+	s.tenants = append(s.tenants, tenant.FromContext(ctx))
+	return []models.Quota{}, nil
+}
+
+func (s *apiKeyService) ListJobs(ctx context.Context, status models.JobStatus, page database.Page) ([]models.Job, error) {
+	return []models.Job{}, nil
+}
+
+func (s *apiKeyService) CountJobs(ctx context.Context, status models.JobStatus) (int64, error) {
+	return 0, nil
+}
+
+func TestTenantAdminKeysStayOutOfGlobalRoutes(t *testing.T) {
+	db := &apiKeyService{scopes: []string{models.ScopeAdmin}}
+	h := testServer(t, db)
+	asKey := []string{"Authorization", "Bearer " + testAPIKey}
+
+	for _, route := range []struct{ method, path, body string }{
+		{http.MethodGet, "/api/v1/admin/webhooks", ""},
+		{http.MethodGet, "/api/v1/admin/jobs", ""},
+		{http.MethodGet, "/api/v1/admin/purge/runs", ""},
+		{http.MethodGet, "/api/v1/admin/flags", ""},
+		{http.MethodPut, "/api/v1/admin/quotas/users", `{"limit": 0}`},
+		{http.MethodDelete, "/api/v1/admin/quotas/users", ""},
+	} {
+		if rec := request(h, route.method, route.path, route.body, asKey...); rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s with a tenant admin key: %d; want 403", route.method, route.path, rec.Code)
+		}
+	}
+
+	// Tenant routes admit the key, within its own tenant
+	rec := request(h, http.MethodGet, "/api/v1/admin/quotas", "", append(asKey, "X-Tenant-ID", "other")...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /admin/quotas with a tenant admin key: %d %s", rec.Code, rec.Body)
+	}
+	if len(db.tenants) != 1 || db.tenants[0] != "acme" {
+		t.Errorf("quotas listed for tenants %v; want [acme]", db.tenants)
+	}
+
+	// The operator reaches both
+	if rec := request(h, http.MethodGet, "/api/v1/admin/jobs", "", asAdmin...); rec.Code != http.StatusOK {
+		t.Errorf("GET /admin/jobs as the operator: %d %s", rec.Code, rec.Body)
+	}
+	if rec := request(h, http.MethodGet, "/api/v1/admin/jobs", "", "Authorization", "Bearer wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /admin/jobs with a wrong token: %d; want 401", rec.Code)
+	}
+}
+
+// hashKey hashes an API key as the server looks it up.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestMetricsNeedTheirToken(t *testing.T) {
+	if rec := request(testServer(t, &apiKeyService{}), http.MethodGet, "/metrics", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("public /metrics without METRICS_TOKEN = %d; want 404", rec.Code)
+	}
+
+	t.Setenv("METRICS_TOKEN", "scrape-token")
+	h := testServer(t, &apiKeyService{})
+	for _, headers := range [][]string{nil, asAdmin} {
+		if rec := request(h, http.MethodGet, "/metrics", "", headers...); rec.Code != http.StatusUnauthorized {
+			t.Errorf("/metrics with %v = %d; want 401", headers, rec.Code)
+		}
+	}
+	if rec := request(h, http.MethodGet, "/metrics", "", "Authorization", "Bearer scrape-token"); rec.Code != http.StatusOK {
+		t.Errorf("/metrics with METRICS_TOKEN = %d; want 200", rec.Code)
+	}
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// The benchmarks run against the database in BENCH_DATABASE_URL, which
+// they migrate and fill with users. Point it at a throwaway database.
+
+// benchSeq keeps emails unique across the repeated runs of a benchmark.
+var benchSeq atomic.Int64
+
+func benchDB(b *testing.B) (database.Service, context.Context) {
+	b.Helper()
+	dsn := os.Getenv("BENCH_DATABASE_URL")
+	if dsn == "" {
+		b.Skip("BENCH_DATABASE_URL is not set")
+	}
+	db, err := database.New(database.WithDSN(dsn), database.WithLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+	if err := db.Migrate(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+	// Every run gets its own tenant so earlier rows do not skew lookups
+	ctx := tenant.WithTenant(context.Background(), fmt.Sprintf("bench-%d", time.Now().UnixNano()))
+	return db, ctx
+}
+
+func benchUser(first string) *models.User {
+	n := benchSeq.Add(1)
+	return &models.User{FirstName: first, LastName: "Bench", Age: 30, Email: fmt.Sprintf("bench.%d@example.com", n)}
+}
+
+func BenchmarkCreateUser(b *testing.B) {
+	db, ctx := benchDB(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.CreateUser(ctx, benchUser("Ada")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetUserByID(b *testing.B) {
+	db, ctx := benchDB(b)
+	user, err := db.CreateUser(ctx, benchUser("Ada"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.GetUserByID(ctx, user.ID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCreateUsers(b *testing.B) {
+	for _, size := range []int{100, 1000} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			db, ctx := benchDB(b)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				users := make([]*models.User, size)
+				for j := range users {
+					users[j] = benchUser("Ada")
+				}
+				b.StartTimer()
+				if err := db.CreateUsers(ctx, users); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*size), "ns/user")
+		})
+	}
+}
+
+func BenchmarkSearchUsers(b *testing.B) {
+	db, ctx := benchDB(b)
+	names := []string{"Ada", "Grace", "Alan", "Edsger", "Barbara"}
+	users := make([]*models.User, 5000)
+	for i := range users {
+		users[i] = benchUser(names[i%len(names)])
+	}
+	if err := db.CreateUsers(ctx, users); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.SearchUsers(ctx, "grace", database.UserFilter{}, database.Page{Limit: 20}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
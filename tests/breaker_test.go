@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+	"users/internal/database"
+	"users/internal/models"
+)
+
+// flakyService fails GetUserByID with a connection error while down.
+type flakyService struct {
+	database.Service
+	down  bool
+	calls int
+}
+
+func (f *flakyService) GetUserByID(ctx context.Context, id string, fields ...string) (*models.User, error) {
+	f.calls++
+	if f.down {
+		return nil, driver.ErrBadConn
+	}
+	return &models.User{ID: id}, nil
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	flaky := &flakyService{down: true}
+	breaker := database.WithCircuitBreaker(flaky)
+	breaker.Threshold = 2
+	breaker.Cooldown = 20 * time.Millisecond
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := breaker.GetUserByID(ctx, "1"); err != driver.ErrBadConn {
+			t.Fatalf("expected connection error; got %v", err)
+		}
+	}
+	if _, err := breaker.GetUserByID(ctx, "1"); err != database.ErrUnavailable {
+		t.Fatalf("expected open circuit to fail fast; got %v", err)
+	}
+	if flaky.calls != 2 || breaker.Ready() {
+		t.Fatalf("expected open circuit not to reach the database; got %d calls", flaky.calls)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	flaky.down = false
+	if _, err := breaker.GetUserByID(ctx, "1"); err != nil {
+		t.Fatalf("expected probe to succeed; got %v", err)
+	}
+	if _, err := breaker.GetUserByID(ctx, "1"); err != nil {
+		t.Fatalf("expected closed circuit after successful probe; got %v", err)
+	}
+}
+
+// waitingService answers GetUserByID only once ctx ends, with its error.
+type waitingService struct {
+	database.Service
+	calls int
+}
+
+func (w *waitingService) GetUserByID(ctx context.Context, id string, fields ...string) (*models.User, error) {
+	w.calls++
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCircuitBreakerIgnoresCallersGivingUp(t *testing.T) {
+	waiting := &waitingService{}
+	breaker := database.WithCircuitBreaker(waiting)
+	breaker.Threshold = 1
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := breaker.GetUserByID(ctx, "1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the caller's deadline; got %v", err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := breaker.GetUserByID(ctx, "1"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the caller's cancellation; got %v", err)
+	}
+	if !breaker.Ready() || waiting.calls != 2 {
+		t.Fatalf("callers giving up opened the circuit after %d calls", waiting.calls)
+	}
+}
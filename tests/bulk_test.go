@@ -0,0 +1,322 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/server"
+	"users/internal/session"
+)
+
+// bulkService updates the users it knows and reports the others missing,
+// as UpdateUsers does.
+type bulkService struct {
+	database.Service
+	known map[string]bool
+}
+
+func (s *bulkService) UpdateUsers(ctx context.Context, ids []string, updates models.UserUpdate) ([]models.BulkResult, error) {
+	if updates.Username != nil || updates.Email != nil {
+		return nil, database.ErrBulkUniqueField
+	}
+	results := make([]models.BulkResult, len(ids))
+	for i, id := range ids {
+		results[i] = models.BulkResult{ID: id, Status: models.BulkNotFound}
+		if s.known[id] {
+			results[i] = models.BulkResult{ID: id, Status: models.BulkUpdated, User: &models.User{ID: id}}
+		}
+	}
+	return results, nil
+}
+
+func TestBulkUpdateRequests(t *testing.T) {
+	tooMany := make([]string, database.MaxPageLimit+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("user-%d", i)
+	}
+	ids, err := json.Marshal(tooMany)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"no ids", `{"updates":{"last_name":"Lamarr"}}`, http.StatusBadRequest},
+		{"too many ids", `{"ids":` + string(ids) + `,"updates":{"last_name":"Lamarr"}}`, http.StatusBadRequest},
+		{"invalid update", `{"ids":["user-1"],"updates":{"age":-1}}`, http.StatusBadRequest},
+		{"unique field", `{"ids":["user-1"],"updates":{"email":"ada@example.com"}}`, http.StatusBadRequest},
+		{"valid", `{"ids":["user-1"],"updates":{"last_name":"Lamarr"}}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		h := testServer(t, &bulkService{known: map[string]bool{"user-1": true}})
+		if rec := request(h, http.MethodPatch, "/api/v1/users", tt.body, asAdmin...); rec.Code != tt.want {
+			t.Errorf("%s: status = %d %s; want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+	}
+}
+
+func TestBulkUpdatePublishesUpdatedUsers(t *testing.T) {
+	bus, published := countEvents()
+	h := testServer(t, &bulkService{known: map[string]bool{"user-1": true, "user-2": true}}, server.WithEvents(bus))
+	rec := request(h, http.MethodPatch, "/api/v1/users", `{"ids":["user-1","user-2","user-3"],"updates":{"last_name":"Lamarr"}}`, asAdmin...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d %s; want 200", rec.Code, rec.Body)
+	}
+	var got struct {
+		Results []models.BulkResult `json:"results"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	var statuses []string
+	for _, r := range got.Results {
+		statuses = append(statuses, r.ID+"="+string(r.Status))
+	}
+	if want := "user-1=updated user-2=updated user-3=not_found"; strings.Join(statuses, " ") != want {
+		t.Errorf("results = %v; want %s", statuses, want)
+	}
+	if *published != 2 {
+		t.Errorf("%d events published; want one per updated user", *published)
+	}
+}
+
+func TestUpdateUsers(t *testing.T) {
+	db, ctx := testDB(t)
+	var users []*models.User
+	for _, name := range []string{"Ada", "Grace"} {
+		user, err := db.CreateUser(ctx, testUser(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user)
+	}
+	lastName := "Lamarr"
+	results, err := db.UpdateUsers(ctx, []string{users[0].ID, "no-such-user", users[1].ID}, models.UserUpdate{LastName: &lastName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[1].Status != models.BulkNotFound {
+		t.Fatalf("results = %+v; want the unknown ID not found", results)
+	}
+	for i, r := range []models.BulkResult{results[0], results[2]} {
+		if r.Status != models.BulkUpdated || r.User == nil || r.User.LastName != lastName || r.User.Version != users[i].Version+1 {
+			t.Errorf("result for %s = %+v; want updated to %s at version %d", users[i].ID, r, lastName, users[i].Version+1)
+		}
+	}
+
+	email := "shared@example.com"
+	if _, err := db.UpdateUsers(ctx, []string{users[0].ID}, models.UserUpdate{Email: &email}); err != database.ErrBulkUniqueField {
+		t.Errorf("bulk updating the email: %v; want ErrBulkUniqueField", err)
+	}
+
+	// Anonymized and merged users are left alone
+	if _, err := db.AnonymizeUser(ctx, users[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	dup, err := db.CreateUser(ctx, testUser("Grace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.MergeUsers(ctx, users[1].ID, dup.ID); err != nil {
+		t.Fatal(err)
+	}
+	other := "Hopper"
+	results, err = db.UpdateUsers(ctx, []string{users[0].ID, dup.ID, users[1].ID}, models.UserUpdate{LastName: &other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.BulkStatus{models.BulkNotUpdatable, models.BulkNotUpdatable, models.BulkUpdated}
+	for i, r := range results {
+		if r.Status != want[i] {
+			t.Errorf("result for %s = %s; want %s", r.ID, r.Status, want[i])
+		}
+	}
+	if got, err := db.GetUserByID(ctx, dup.ID); err != nil || got.LastName == other {
+		t.Errorf("merged user after the update = %+v, %v; want it unchanged", got, err)
+	}
+}
+
+// suspendService suspends user-1, finds user-2 suspended already and
+// knows no one else.
+type suspendService struct {
+	database.Service
+}
+
+func (s *suspendService) SuspendUser(ctx context.Context, id string) (*models.User, error) {
+	switch id {
+	case "user-1":
+		return &models.User{ID: id, Status: models.StatusSuspended}, nil
+	case "user-2":
+		return nil, database.ErrInvalidTransition
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *suspendService) GetUserByID(ctx context.Context, id string, fields ...string) (*models.User, error) {
+	return &models.User{ID: id, Status: models.StatusActive}, nil
+}
+
+func TestBulkSuspendUsers(t *testing.T) {
+	store := session.NewMemoryStore()
+	bus, published := countEvents()
+	h := testServer(t, &suspendService{}, server.WithSessionStore(store), server.WithEvents(bus))
+	startSession(t, store, "default", "user-1")
+	startSession(t, store, "default", "user-2")
+
+	if rec := request(h, http.MethodPost, "/api/v1/admin/users/suspend", `{"ids":[]}`, asAdmin...); rec.Code != http.StatusBadRequest {
+		t.Errorf("no ids: %d; want 400", rec.Code)
+	}
+	rec := request(h, http.MethodPost, "/api/v1/admin/users/suspend", `{"ids":["user-1","user-2","user-3"]}`, asAdmin...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d %s; want 200", rec.Code, rec.Body)
+	}
+	var got struct {
+		Results []models.BulkResult `json:"results"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	var statuses []string
+	for _, r := range got.Results {
+		statuses = append(statuses, r.ID+"="+string(r.Status))
+	}
+	if want := "user-1=updated user-2=not_updatable user-3=not_found"; strings.Join(statuses, " ") != want {
+		t.Errorf("results = %v; want %s", statuses, want)
+	}
+	if *published != 1 {
+		t.Errorf("%d events published; want one for the suspended user", *published)
+	}
+	for id, want := range map[string]int{"user-1": 0, "user-2": 1} {
+		if sessions, err := store.ListByUser(context.Background(), "default", id); err != nil || len(sessions) != want {
+			t.Errorf("sessions of %s = %v, %v; want %d", id, sessions, err, want)
+		}
+	}
+}
+
+// deleteService matches matched users to every bulk delete and deletes
+// them unless there are more than the limit.
+type deleteService struct {
+	database.Service
+	matched int
+}
+
+func (s *deleteService) DeleteUsers(ctx context.Context, filter database.UserFilter, limit int, opts database.DeleteOptions) (*database.DeleteResult, error) {
+	result := &database.DeleteResult{Matched: int64(s.matched), IDs: []string{}}
+	if s.matched > limit {
+		return result, database.ErrBulkLimitExceeded
+	}
+	for i := 0; i < s.matched; i++ {
+		id := fmt.Sprintf("user-%d", i)
+		result.IDs = append(result.IDs, id)
+		result.Users = append(result.Users, models.User{ID: id})
+	}
+	return result, nil
+}
+
+func TestBulkDeleteRequests(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"no limit", "status=active", http.StatusBadRequest},
+		{"unknown mode", "status=active&limit=5&mode=shred", http.StatusBadRequest},
+		{"more than the limit", "status=active&limit=2", http.StatusConflict},
+		{"within the limit", "status=active&limit=3", http.StatusOK},
+		{"soft", "status=active&limit=3&mode=soft", http.StatusOK},
+	}
+	for _, tt := range tests {
+		bus, published := countEvents()
+		h := testServer(t, &deleteService{matched: 3}, server.WithEvents(bus))
+		rec := request(h, http.MethodDelete, "/api/v1/admin/users?"+tt.query, "", asAdmin...)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d %s; want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+		want := 0
+		if rec.Code == http.StatusOK {
+			want = 3
+		}
+		if *published != want {
+			t.Errorf("%s: %d events published; want %d", tt.name, *published, want)
+		}
+	}
+}
+
+func TestDeleteUsers(t *testing.T) {
+	db, ctx := testDB(t)
+	active := database.UserFilter{Status: models.StatusActive}
+	if _, err := db.DeleteUsers(ctx, active, 0, database.DeleteOptions{}); err != database.ErrBulkLimitRequired {
+		t.Errorf("no limit: %v; want ErrBulkLimitRequired", err)
+	}
+	if _, err := db.DeleteUsers(ctx, active, database.MaxBulkDelete+1, database.DeleteOptions{}); err != database.ErrBulkLimitRequired {
+		t.Errorf("limit above the maximum: %v; want ErrBulkLimitRequired", err)
+	}
+	if _, err := db.DeleteUsers(ctx, database.UserFilter{}, 10, database.DeleteOptions{}); err != database.ErrBulkFilterRequired {
+		t.Errorf("no filter: %v; want ErrBulkFilterRequired", err)
+	}
+
+	var ids []string
+	for _, name := range []string{"Ada", "Grace", "Linus"} {
+		user, err := db.CreateUser(ctx, testUser(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.ID)
+	}
+	remaining := func() int {
+		n := 0
+		for _, id := range ids {
+			if _, err := db.GetUserByID(ctx, id); err == nil {
+				n++
+			}
+		}
+		return n
+	}
+
+	result, err := db.DeleteUsers(ctx, active, 2, database.DeleteOptions{})
+	if err != database.ErrBulkLimitExceeded || result == nil || result.Matched != 3 {
+		t.Fatalf("3 matches for a limit of 2: %+v, %v; want ErrBulkLimitExceeded counting 3", result, err)
+	}
+	if n := remaining(); n != 3 {
+		t.Errorf("%d users left after exceeding the limit; want 3", n)
+	}
+
+	err = db.DryRun(ctx, func(ctx context.Context) (err error) {
+		result, err = db.DeleteUsers(ctx, active, 3, database.DeleteOptions{})
+		return err
+	})
+	if err != nil || len(result.IDs) != 3 {
+		t.Fatalf("dry run: %+v, %v; want 3 deleted", result, err)
+	}
+	if n := remaining(); n != 3 {
+		t.Errorf("%d users left after a dry run; want 3", n)
+	}
+
+	if result, err = db.DeleteUsers(ctx, active, 3, database.DeleteOptions{Soft: true}); err != nil || len(result.Users) != 3 {
+		t.Fatalf("soft delete: %+v, %v; want 3 anonymized", result, err)
+	}
+	for _, u := range result.Users {
+		if u.AnonymizedAt == nil {
+			t.Errorf("soft deleted user %s is not anonymized", u.ID)
+		}
+	}
+	if result, err = db.DeleteUsers(ctx, active, 3, database.DeleteOptions{Soft: true}); err != nil || result.Matched != 0 {
+		t.Errorf("soft deleting again: %+v, %v; want no matches", result, err)
+	}
+
+	if result, err = db.DeleteUsers(ctx, active, 3, database.DeleteOptions{}); err != nil || len(result.IDs) != 3 {
+		t.Fatalf("hard delete: %+v, %v; want 3 deleted", result, err)
+	}
+	if n := remaining(); n != 0 {
+		t.Errorf("%d users left after deleting them; want none", n)
+	}
+}
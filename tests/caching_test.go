@@ -0,0 +1,33 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"users/internal/models"
+	"users/internal/testutil"
+)
+
+func TestProjectionsHaveTheirOwnETags(t *testing.T) {
+	user := testutil.New(testutil.Seed).User(testutil.WithVersion(7))
+	h := testServer(t, &goldenService{users: map[string]*models.User{user.ID: user}})
+	get := func(query string, headers ...string) (int, string) {
+		rec := request(h, http.MethodGet, "/api/v1/users/"+user.ID+query, "", append(asAdmin, headers...)...)
+		return rec.Code, rec.Header().Get("ETag")
+	}
+
+	_, full := get("")
+	_, projected := get("?fields=id,email")
+	if full != `W/"7"` || projected == full {
+		t.Fatalf("ETags full %s, projected %s; want W/\"7\" and another", full, projected)
+	}
+	if _, reordered := get("?fields=email,id"); reordered != projected {
+		t.Errorf("reordered fields got ETag %s; want %s", reordered, projected)
+	}
+	if code, _ := get("?fields=id,email", "If-None-Match", full); code != http.StatusOK {
+		t.Errorf("projection with the full ETag = %d; want 200", code)
+	}
+	if code, _ := get("?fields=id,email", "If-None-Match", projected); code != http.StatusNotModified {
+		t.Errorf("projection with its ETag = %d; want 304", code)
+	}
+}
@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"users/client"
+)
+
+func TestClientRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("expected API key to be sent; got %q", r.Header.Get("Authorization"))
+		}
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"id":"1","first_name":"Ada","version":2}`))
+	}))
+	defer srv.Close()
+
+	users := client.New(srv.URL, client.WithAPIKey("key"), client.WithRetries(3, time.Millisecond, time.Millisecond))
+	user, err := users.GetUser(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("expected GET to succeed after retries; got %v", err)
+	}
+	if user.FirstName != "Ada" || calls.Load() != 3 {
+		t.Fatalf("unexpected user %+v after %d calls", user, calls.Load())
+	}
+
+	calls.Store(0)
+	_, err = users.UpdateUser(context.Background(), "1", 2, client.UserUpdate{FirstName: client.String("Grace")})
+	if !errors.Is(err, client.ErrUnavailable) || calls.Load() != 1 {
+		t.Fatalf("expected PATCH not to be retried; got %v after %d calls", err, calls.Load())
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"type":"/problems/email-taken","title":"Email address already in use","status":409}`))
+	}))
+	defer srv.Close()
+
+	users := client.New(srv.URL)
+	_, err := users.CreateUser(context.Background(), client.NewUser{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com"})
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || !errors.Is(err, client.ErrConflict) || apiErr.Code() != client.CodeEmailTaken {
+		t.Fatalf("expected email-taken conflict; got %v", err)
+	}
+	if errors.Is(err, client.ErrNotFound) {
+		t.Fatal("expected conflict not to match ErrNotFound")
+	}
+}
@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"users/internal/config"
+	"users/internal/database"
+)
+
+func TestCheckConfigReportsEveryProblem(t *testing.T) {
+	t.Setenv("DATABASE_URL", "")
+	t.Setenv("DB_HOST", "")
+	t.Setenv("DB_PORT", "54x2")
+	t.Setenv("DB_DATABASE", "users")
+	t.Setenv("DB_USERNAME", "users")
+	t.Setenv("DB_SSLMODE", "sometimes")
+	t.Setenv("DB_RETRY_BASE_DELAY", "100")
+
+	var r config.Report
+	database.CheckConfig(&r)
+	var cfgErr *config.Error
+	if !errors.As(r.Err(), &cfgErr) {
+		t.Fatalf("expected a *config.Error; got %v", r.Err())
+	}
+	for _, want := range []string{"DB_HOST", "DB_PORT", "sslmode", "DB_RETRY_BASE_DELAY"} {
+		if !strings.Contains(cfgErr.Error(), want) {
+			t.Errorf("expected a problem with %s; got %v", want, cfgErr)
+		}
+	}
+	if len(cfgErr.Problems) != 4 {
+		t.Errorf("expected 4 problems; got %q", cfgErr.Problems)
+	}
+
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_SSLMODE", "")
+	t.Setenv("DB_RETRY_BASE_DELAY", "")
+	r = config.Report{}
+	database.CheckConfig(&r)
+	if err := r.Err(); err != nil {
+		t.Errorf("expected a valid configuration; got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/server"
+	"users/internal/session"
+)
+
+// consentService keeps the consents and preferences of user-1.
+type consentService struct {
+	database.Service
+	consents []models.Consent
+	prefs    models.Preferences
+}
+
+func (s *consentService) GetUserByID(ctx context.Context, id string, fields ...string) (*models.User, error) {
+	if id != "user-1" {
+		return nil, sql.ErrNoRows
+	}
+	return &models.User{ID: id, Status: models.StatusActive}, nil
+}
+
+func (s *consentService) RecordConsent(ctx context.Context, consent *models.Consent) error {
+	if consent.UserID != "user-1" {
+		return sql.ErrNoRows
+	}
+	s.consents = append(s.consents, *consent)
+	return nil
+}
+
+func (s *consentService) GetConsents(ctx context.Context, userID string) ([]models.Consent, error) {
+	return s.consents, nil
+}
+
+func (s *consentService) GetPreferences(ctx context.Context, userID string) (*models.Preferences, error) {
+	prefs := s.prefs
+	return &prefs, nil
+}
+
+func (s *consentService) UpdatePreferences(ctx context.Context, userID string, updates models.PreferencesUpdate) (*models.Preferences, error) {
+	if updates.Newsletter != nil {
+		s.prefs.Newsletter = *updates.Newsletter
+	}
+	return s.GetPreferences(ctx, userID)
+}
+
+func TestRequireConsent(t *testing.T) {
+	t.Setenv("TERMS_VERSION", "2024-06")
+	store := session.NewMemoryStore()
+	db := &consentService{prefs: models.DefaultPreferences()}
+	h := testServer(t, db, server.WithSessionStore(store))
+	cookie := startSession(t, store, "default", "user-1")
+
+	rec := request(h, http.MethodGet, "/api/v1/me/preferences", "", cookie...)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("before accepting the terms: %d %s; want 403", rec.Code, rec.Body)
+	}
+	// Consents can be seen and given while the rest is off limits
+	if rec := request(h, http.MethodGet, "/api/v1/me/consents", "", cookie...); rec.Code != http.StatusOK {
+		t.Errorf("listing consents before accepting the terms: %d; want 200", rec.Code)
+	}
+	for _, step := range []struct {
+		version string
+		want    int
+	}{
+		{"2023-01", http.StatusForbidden},
+		{"2024-06", http.StatusOK},
+	} {
+		body := `{"kind":"terms","version":"` + step.version + `","granted":true}`
+		if rec := request(h, http.MethodPost, "/api/v1/me/consents", body, cookie...); rec.Code != http.StatusCreated {
+			t.Fatalf("accepting version %s: %d %s; want 201", step.version, rec.Code, rec.Body)
+		}
+		if rec := request(h, http.MethodGet, "/api/v1/me/preferences", "", cookie...); rec.Code != step.want {
+			t.Errorf("after accepting version %s: %d; want %d", step.version, rec.Code, step.want)
+		}
+	}
+
+	if rec := request(h, http.MethodPost, "/api/v1/me/consents", `{"kind":"terms","version":"2024-06","granted":false}`, cookie...); rec.Code != http.StatusCreated {
+		t.Fatalf("withdrawing: %d %s; want 201", rec.Code, rec.Body)
+	}
+	if rec := request(h, http.MethodGet, "/api/v1/me/preferences", "", cookie...); rec.Code != http.StatusForbidden {
+		t.Errorf("after withdrawing the terms: %d; want 403", rec.Code)
+	}
+}
+
+func TestNewsletterNeedsMarketingConsent(t *testing.T) {
+	db := &consentService{prefs: models.DefaultPreferences()}
+	h := testServer(t, db)
+	subscribe := func() int {
+		return request(h, http.MethodPatch, "/api/v1/users/user-1/preferences", `{"newsletter":true}`, asAdmin...).Code
+	}
+
+	if code := subscribe(); code != http.StatusForbidden {
+		t.Errorf("subscribing without consent: %d; want 403", code)
+	}
+	if rec := request(h, http.MethodPost, "/api/v1/users/user-1/consents", `{"kind":"marketing","granted":true}`, asAdmin...); rec.Code != http.StatusCreated {
+		t.Fatalf("granting: %d %s; want 201", rec.Code, rec.Body)
+	}
+	if code := subscribe(); code != http.StatusOK || !db.prefs.Newsletter {
+		t.Fatalf("subscribing with consent: %d, subscribed %v; want 200 and subscribed", code, db.prefs.Newsletter)
+	}
+
+	rec := request(h, http.MethodPost, "/api/v1/users/user-1/consents", `{"kind":"marketing","granted":false}`, asAdmin...)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("withdrawing: %d %s; want 201", rec.Code, rec.Body)
+	}
+	var consent models.Consent
+	if err := json.NewDecoder(rec.Body).Decode(&consent); err != nil {
+		t.Fatal(err)
+	}
+	if consent.Granted || consent.SourceIP == "" {
+		t.Errorf("withdrawal = %+v; want not granted, from the request's address", consent)
+	}
+	if db.prefs.Newsletter {
+		t.Error("still subscribed to the newsletter after withdrawing marketing consent")
+	}
+	if code := subscribe(); code != http.StatusForbidden {
+		t.Errorf("subscribing after withdrawing: %d; want 403", code)
+	}
+}
+
+func TestConsentRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"unknown kind", "/api/v1/users/user-1/consents", `{"kind":"cookies","granted":true}`, http.StatusBadRequest},
+		{"terms without version", "/api/v1/users/user-1/consents", `{"kind":"terms","granted":true}`, http.StatusBadRequest},
+		{"granted missing", "/api/v1/users/user-1/consents", `{"kind":"marketing"}`, http.StatusBadRequest},
+		{"bad source", "/api/v1/users/user-1/consents", `{"kind":"marketing","granted":true,"source_ip":"nowhere"}`, http.StatusBadRequest},
+		{"unknown user", "/api/v1/users/user-2/consents", `{"kind":"marketing","granted":true}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		h := testServer(t, &consentService{})
+		if rec := request(h, http.MethodPost, tt.path, tt.body, asAdmin...); rec.Code != tt.want {
+			t.Errorf("%s: status = %d %s; want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+	}
+}
+
+func TestConsents(t *testing.T) {
+	db, ctx := testDB(t)
+	user, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consents, err := db.GetConsents(ctx, user.ID); err != nil || consents == nil || len(consents) != 0 {
+		t.Errorf("consents of a new user = %v, %v; want an empty list", consents, err)
+	}
+	for _, c := range []models.Consent{
+		{Kind: models.ConsentTerms, Version: "2024-06", Granted: true, SourceIP: "203.0.113.7"},
+		{Kind: models.ConsentMarketing, Granted: true},
+		{Kind: models.ConsentMarketing, Granted: false},
+	} {
+		c.UserID = user.ID
+		if err := db.RecordConsent(ctx, &c); err != nil {
+			t.Fatal(err)
+		}
+		if c.ID == 0 || c.RecordedAt.IsZero() {
+			t.Errorf("recorded consent %+v; want its ID and time", c)
+		}
+	}
+
+	consents, err := db.GetConsents(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(consents) != 3 {
+		t.Fatalf("consents = %v; want all 3", consents)
+	}
+	if terms := models.LatestConsent(consents, models.ConsentTerms); terms == nil || terms.Version != "2024-06" || terms.SourceIP != "203.0.113.7" {
+		t.Errorf("terms consent = %+v; want version 2024-06 from 203.0.113.7", terms)
+	}
+	if marketing := models.LatestConsent(consents, models.ConsentMarketing); marketing == nil || marketing.Granted {
+		t.Errorf("marketing consent in force = %+v; want the withdrawal", marketing)
+	}
+
+	if err := db.RecordConsent(ctx, &models.Consent{UserID: "no-such-user", Kind: models.ConsentMarketing}); err != sql.ErrNoRows {
+		t.Errorf("recording the consent of an unknown user: %v; want sql.ErrNoRows", err)
+	}
+}
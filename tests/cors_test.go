@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"users/internal/database"
+	"users/internal/server"
+)
+
+// corsService answers nothing; preflight requests never reach it.
+type corsService struct {
+	database.Service
+}
+
+func TestCORSRefusesCredentialsForAnyOrigin(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	if _, err := server.New(&corsService{}); err == nil {
+		t.Error("New accepted credentials for every origin")
+	}
+}
+
+func TestCORSEchoesAllowedOrigins(t *testing.T) {
+	tests := []struct {
+		name, origins, credentials string
+		origin                     string
+		allowed                    bool
+	}{
+		{"any origin", "*", "", "https://app.example.com", true},
+		{"listed origin with credentials", "https://app.example.com", "true", "https://app.example.com", true},
+		{"unlisted origin", "https://app.example.com", "true", "https://evil.example.com", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("CORS_ALLOWED_ORIGINS", tt.origins)
+		t.Setenv("CORS_ALLOW_CREDENTIALS", tt.credentials)
+		h := testServer(t, &corsService{})
+		rec := request(h, http.MethodOptions, "/api/v1/users", "", "Origin", tt.origin, "Access-Control-Request-Method", http.MethodGet)
+		want, wantCredentials := "", ""
+		if tt.allowed {
+			want, wantCredentials = tt.origin, tt.credentials
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != want {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q; want %q", tt.name, got, want)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != wantCredentials {
+			t.Errorf("%s: Access-Control-Allow-Credentials = %q; want %q", tt.name, got, wantCredentials)
+		}
+	}
+}
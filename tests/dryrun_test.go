@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"users/internal/database"
+	"users/internal/events"
+	"users/internal/models"
+	"users/internal/server"
+	"users/internal/tenant"
+)
+
+// dryRunService knows one user, before, and answers an update of it with
+// after. It runs dry runs without a transaction.
+type dryRunService struct {
+	database.Service
+	before, after models.User
+}
+
+func (s *dryRunService) DryRun(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (s *dryRunService) GetUsersByIDs(ctx context.Context, ids []string) ([]models.User, error) {
+	return []models.User{s.before}, nil
+}
+
+func (s *dryRunService) UpdateUserByID(ctx context.Context, id string, updates models.UserUpdate) (*models.User, error) {
+	after := s.after
+	return &after, nil
+}
+
+// dryRunChanges is the body of a dry run response.
+type dryRunChanges struct {
+	DryRun   bool `json:"dry_run"`
+	Affected int  `json:"affected"`
+	Changes  []struct {
+		ID      string `json:"id"`
+		Deleted bool   `json:"deleted"`
+		Fields  map[string]struct {
+			From json.RawMessage `json:"from"`
+			To   json.RawMessage `json:"to"`
+		} `json:"fields"`
+	} `json:"changes"`
+}
+
+// countEvents returns a bus and the number of events published on it.
+func countEvents() (*events.Bus, *int) {
+	bus := events.NewBus()
+	n := new(int)
+	bus.Subscribe(func(events.Event) { *n++ })
+	return bus, n
+}
+
+func TestDryRunDiff(t *testing.T) {
+	before := models.User{ID: "user-1", FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Locale: "de", Status: models.StatusActive, Version: 3}
+	tests := []struct {
+		name   string
+		change func(u *models.User)
+		want   map[string][2]string
+	}{
+		{"changed field", func(u *models.User) { u.FirstName = "Grace" }, map[string][2]string{"first_name": {`"Ada"`, `"Grace"`}}},
+		{"set field", func(u *models.User) { u.Timezone = "Europe/Berlin" }, map[string][2]string{"timezone": {`null`, `"Europe/Berlin"`}}},
+		{"cleared field", func(u *models.User) { u.Locale = "" }, map[string][2]string{"locale": {`"de"`, `null`}}},
+		{"bookkeeping only", func(u *models.User) { u.Version++; u.UpdatedAt = time.Now() }, map[string][2]string{}},
+		{"tags", func(u *models.User) { u.Tags = []string{"beta"} }, map[string][2]string{"tags": {`null`, `["beta"]`}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := before
+			tt.change(&after)
+			bus, published := countEvents()
+			h := testServer(t, &dryRunService{before: before, after: after}, server.WithEvents(bus))
+
+			rec := request(h, http.MethodPatch, "/api/v1/users/user-1?dry_run=true", `{"first_name":"Grace"}`, append(asAdmin, "If-Match", "*")...)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d; want 200: %s", rec.Code, rec.Body)
+			}
+			var got dryRunChanges
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !got.DryRun || got.Affected != 1 || len(got.Changes) != 1 || got.Changes[0].ID != "user-1" {
+				t.Fatalf("dry run = %+v; want one change of user-1", got)
+			}
+			fields := map[string][2]string{}
+			for name, f := range got.Changes[0].Fields {
+				fields[name] = [2]string{string(f.From), string(f.To)}
+			}
+			if fmt.Sprint(fields) != fmt.Sprint(tt.want) {
+				t.Errorf("fields = %v; want %v", fields, tt.want)
+			}
+			if *published != 0 {
+				t.Errorf("dry run published %d events", *published)
+			}
+		})
+	}
+}
+
+func TestDryRunLeavesUsersUnchanged(t *testing.T) {
+	db, ctx := testDB(t)
+	var users []*models.User
+	for _, name := range []string{"Ada", "Grace"} {
+		user, err := db.CreateUser(ctx, testUser(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user)
+	}
+	bus, published := countEvents()
+	h := testServer(t, db, server.WithEvents(bus))
+	headers := append(asAdmin, "X-Tenant-ID", tenant.FromContext(ctx))
+
+	requests := []struct{ method, path, body string }{
+		{http.MethodPatch, "/api/v1/users/" + users[0].ID + "?dry_run=true", `{"first_name":"Hedy"}`},
+		{http.MethodDelete, "/api/v1/users/" + users[0].ID + "?dry_run=true", ""},
+		{http.MethodPatch, "/api/v1/users?dry_run=true", fmt.Sprintf(`{"ids":[%q,%q],"updates":{"last_name":"Lamarr"}}`, users[0].ID, users[1].ID)},
+	}
+	for _, req := range requests {
+		rec := request(h, req.method, req.path, req.body, append(headers, "If-Match", "*")...)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s = %d; want 200: %s", req.method, req.path, rec.Code, rec.Body)
+		}
+		var got dryRunChanges
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if !got.DryRun || got.Affected == 0 {
+			t.Errorf("%s %s reported %+v; want changes", req.method, req.path, got)
+		}
+	}
+
+	for _, want := range users {
+		got, err := db.GetUserByID(ctx, want.ID)
+		if err != nil {
+			t.Fatalf("user %s after the dry runs: %v", want.ID, err)
+		}
+		if got.FirstName != want.FirstName || got.LastName != want.LastName || got.Version != want.Version {
+			t.Errorf("user %s changed to %s %s version %d", want.ID, got.FirstName, got.LastName, got.Version)
+		}
+	}
+	if *published != 0 {
+		t.Errorf("dry runs published %d events", *published)
+	}
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"users/internal/database"
+	"users/internal/models"
+)
+
+// duplicatesService creates users and finds user-2 and user-3 to be
+// possible duplicates of anyone.
+type duplicatesService struct {
+	database.Service
+}
+
+func (s *duplicatesService) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	created := *user
+	created.ID = "user-1"
+	return &created, nil
+}
+
+func (s *duplicatesService) GetUserByID(ctx context.Context, id string, fields ...string) (*models.User, error) {
+	return &models.User{ID: id, FirstName: "Ada", LastName: "Lovelace"}, nil
+}
+
+func (s *duplicatesService) FindPotentialDuplicates(ctx context.Context, user *models.User) ([]models.DuplicateCandidate, error) {
+	return []models.DuplicateCandidate{
+		{User: models.User{ID: "user-2"}, Score: 1, Reasons: []string{models.DuplicateEmail}},
+		{User: models.User{ID: "user-3"}, Score: 0.5, Reasons: []string{models.DuplicateName}},
+	}, nil
+}
+
+func TestDuplicateWarnings(t *testing.T) {
+	const body = `{"first_name":"Ada","last_name":"Lovelace","email":"ada@example.com","age":36}`
+	for _, enabled := range []bool{false, true} {
+		if enabled {
+			t.Setenv("FEATURE_FLAGS", "duplicate_warnings")
+		}
+		h := testServer(t, &duplicatesService{})
+		rec := request(h, http.MethodPost, "/api/v1/users", body, asAdmin...)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create: %d %s; want 201", rec.Code, rec.Body)
+		}
+		want := ""
+		if enabled {
+			want = "user-2, user-3"
+		}
+		if got := rec.Header().Get("X-Potential-Duplicates"); got != want {
+			t.Errorf("with duplicate_warnings %v: X-Potential-Duplicates = %q; want %q", enabled, got, want)
+		}
+	}
+}
+
+func TestListUserDuplicates(t *testing.T) {
+	h := testServer(t, &duplicatesService{})
+	rec := request(h, http.MethodGet, "/api/v1/users/user-1/duplicates", "", asAdmin...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d %s; want 200", rec.Code, rec.Body)
+	}
+	var candidates []models.DuplicateCandidate
+	if err := json.NewDecoder(rec.Body).Decode(&candidates); err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 2 || candidates[0].User.ID != "user-2" || candidates[0].Reasons[0] != models.DuplicateEmail {
+		t.Errorf("candidates = %+v; want user-2 by email first", candidates)
+	}
+}
+
+func TestFindPotentialDuplicates(t *testing.T) {
+	db, ctx := testDB(t)
+	create := func(first, last, email string) *models.User {
+		u := testUser(first)
+		u.LastName = last
+		if email != "" {
+			u.Email = email
+		}
+		created, err := db.CreateUser(ctx, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return created
+	}
+	n := testSeq.Add(1)
+	ada := create("Ada", "Lovelace", fmt.Sprintf("ada.lovelace%d@gmail.com", n))
+	sameMailbox := create("Charles", "Babbage", fmt.Sprintf("A.da.love.lace%d+work@googlemail.com", n))
+	similarName := create("Ada", "Lovelacy", "")
+	anonymized := create("Ada", "Lovelace", "")
+	if _, err := db.AnonymizeUser(ctx, anonymized.ID); err != nil {
+		t.Fatal(err)
+	}
+	create("Grace", "Hopper", "")
+
+	candidates, err := db.FindPotentialDuplicates(ctx, ada)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range candidates {
+		got = append(got, c.User.ID)
+	}
+	if want := []string{sameMailbox.ID, similarName.ID}; !slices.Equal(got, want) {
+		t.Fatalf("candidates = %v; want %v, the same mailbox first", got, want)
+	}
+	if !slices.Equal(candidates[0].Reasons, []string{models.DuplicateEmail}) || !slices.Equal(candidates[1].Reasons, []string{models.DuplicateName}) {
+		t.Errorf("reasons = %v and %v; want email, then name", candidates[0].Reasons, candidates[1].Reasons)
+	}
+
+	// A user not stored yet is compared with everyone
+	unsaved := &models.User{FirstName: "Grace", LastName: "Hopper", Email: "someone@example.com"}
+	if candidates, err = db.FindPotentialDuplicates(ctx, unsaved); err != nil || len(candidates) != 1 {
+		t.Errorf("duplicates of a new Grace Hopper: %v, %v; want one", candidates, err)
+	}
+}
@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"users/internal/database"
+	"users/internal/models"
+)
+
+// confirmService answers every email confirmation with err.
+type confirmService struct {
+	database.Service
+	err error
+}
+
+func (s *confirmService) ConfirmEmailChange(ctx context.Context, tokenHash string) (*models.User, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &models.User{ID: "user-1", Email: "new@example.com", Version: 2}, nil
+}
+
+func TestEmailChangeWaitsForConfirmation(t *testing.T) {
+	db, ctx := testDB(t)
+	user, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := fmt.Sprintf("new.%d@example.com", testSeq.Add(1))
+	updated, err := db.UpdateUserByID(ctx, user.ID, models.UserUpdate{Email: &email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Email != user.Email || updated.PendingEmail != email {
+		t.Fatalf("after the change email = %s, pending = %s; want %s pending %s", updated.Email, updated.PendingEmail, user.Email, email)
+	}
+	if _, err := db.GetUserByEmail(ctx, email); err != sql.ErrNoRows {
+		t.Errorf("looking up the unconfirmed address: %v; want sql.ErrNoRows", err)
+	}
+
+	if err := db.IssueEmailConfirmation(ctx, user.ID, "expired-hash", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ConfirmEmailChange(ctx, "expired-hash"); err != sql.ErrNoRows {
+		t.Errorf("confirming with an expired token: %v; want sql.ErrNoRows", err)
+	}
+	if err := db.IssueEmailConfirmation(ctx, user.ID, "confirm-hash", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.ConfirmEmailChange(ctx, "confirm-hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != email || got.PendingEmail != "" || got.Version != updated.Version+1 {
+		t.Errorf("confirmed user has %s, pending %q, version %d; want %s, none, %d", got.Email, got.PendingEmail, got.Version, email, updated.Version+1)
+	}
+	if err := db.IssueEmailConfirmation(ctx, user.ID, "again-hash", time.Now().Add(time.Hour)); err != sql.ErrNoRows {
+		t.Errorf("confirming without a pending email: %v; want sql.ErrNoRows", err)
+	}
+}
+
+func TestEmailChangeToAnAddressTakenMeanwhile(t *testing.T) {
+	db, ctx := testDB(t)
+	user, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := fmt.Sprintf("taken.%d@example.com", testSeq.Add(1))
+	if _, err := db.UpdateUserByID(ctx, user.ID, models.UserUpdate{Email: &email}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.IssueEmailConfirmation(ctx, user.ID, "taken-hash", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	other := testUser("Grace")
+	other.Email = email
+	if _, err := db.CreateUser(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ConfirmEmailChange(ctx, "taken-hash"); err != database.ErrEmailTaken {
+		t.Errorf("confirming an address taken since: %v; want ErrEmailTaken", err)
+	}
+}
+
+func TestConfirmEmailResponses(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  error
+		want int
+	}{
+		{"confirmed", `{"token":"t"}`, nil, http.StatusOK},
+		{"no token", `{}`, nil, http.StatusBadRequest},
+		{"unknown token", `{"token":"t"}`, sql.ErrNoRows, http.StatusNotFound},
+		{"address taken", `{"token":"t"}`, database.ErrEmailTaken, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		h := testServer(t, &confirmService{err: tt.err})
+		if rec := request(h, http.MethodPost, "/api/v1/email/confirm", tt.body); rec.Code != tt.want {
+			t.Errorf("%s: status = %d %s; want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+	}
+}
+
+func TestEmailVerificationActivatesPendingUsers(t *testing.T) {
+	db, ctx := testDB(t)
+	pending := testUser("Ada")
+	pending.Status = models.StatusPending
+	user, err := db.CreateUser(ctx, pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.IssueEmailVerification(ctx, user.ID, "verify-hash", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.ConfirmEmailChange(ctx, "verify-hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.StatusActive || got.Email != user.Email {
+		t.Errorf("confirmed user is %s with %s; want active with %s", got.Status, got.Email, user.Email)
+	}
+
+	if err := db.IssueEmailVerification(ctx, user.ID, "again-hash", time.Now().Add(time.Hour)); err != sql.ErrNoRows {
+		t.Errorf("verifying an active user: %v; want sql.ErrNoRows", err)
+	}
+	if _, err := db.ConfirmEmailChange(ctx, "verify-hash"); err != sql.ErrNoRows {
+		t.Errorf("reusing the token: %v; want sql.ErrNoRows", err)
+	}
+}
+
+func TestCanonicalizeEmailsKeepsConflicts(t *testing.T) {
+	db, ctx := testDB(t)
+	n := testSeq.Add(1)
+	create := func(email string) *models.User {
+		u := testUser("Ada")
+		u.Email = email
+		created, err := db.CreateUser(ctx, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return created
+	}
+	holder := create(fmt.Sprintf("ada%d@gmail.com", n))
+	dotted := create(fmt.Sprintf("a.da%d@gmail.com", n))
+	tagged := create(fmt.Sprintf("bob%d+news@googlemail.com", n))
+
+	var batch database.CanonicalEmails
+	var err error
+	var conflicts int
+	for after := ""; ; after = batch.Last {
+		if batch, err = db.CanonicalizeEmails(ctx, after, 1); err != nil {
+			t.Fatal(err)
+		}
+		if batch.Last == "" {
+			break
+		}
+		for _, c := range batch.Conflicts {
+			if c.UserID != dotted.ID || c.HeldBy != holder.ID {
+				t.Errorf("unexpected conflict %+v", c)
+			}
+			conflicts++
+		}
+	}
+	if conflicts != 1 {
+		t.Errorf("%d conflicts reported; want 1", conflicts)
+	}
+
+	got, err := db.GetUserByID(ctx, tagged.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("bob%d@gmail.com", n); got.Email != want || got.Version != tagged.Version+1 {
+		t.Errorf("canonicalized to %s at version %d; want %s at %d", got.Email, got.Version, want, tagged.Version+1)
+	}
+	if got, err := db.GetUserByID(ctx, dotted.ID); err != nil || got.Email != dotted.Email {
+		t.Errorf("conflicting user now has %v, %v; want %s kept", got, err, dotted.Email)
+	}
+}
@@ -0,0 +1,25 @@
+package tests
+
+import (
+	"testing"
+
+	"users/internal/events"
+)
+
+func TestBusUnsubscribe(t *testing.T) {
+	bus := events.NewBus()
+	var first, second int
+	unsubscribe := bus.Subscribe(func(events.Event) { first++ })
+	bus.Subscribe(func(events.Event) { second++ })
+
+	bus.Publish(events.Event{Type: events.UserCreated})
+	unsubscribe()
+	bus.Publish(events.Event{Type: events.UserUpdated})
+
+	if first != 1 {
+		t.Errorf("unsubscribed handler saw %d events; want 1", first)
+	}
+	if second != 2 {
+		t.Errorf("remaining handler saw %d events; want 2", second)
+	}
+}
@@ -0,0 +1,424 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/server"
+	"users/internal/storage"
+	"users/internal/tenant"
+)
+
+// exportService holds one export job of users user-0 to user-<users-1>
+// and queues its job once. EachUser fails after failAt users, if set; the
+// export is deleted once it has written deleteAt users, if set.
+type exportService struct {
+	database.Service
+	users    int
+	failAt   int
+	deleteAt int64
+	// attempts is the attempt of MaxAttempts the job is claimed at.
+	attempts, maxAttempts int
+
+	mu      sync.Mutex
+	export  *models.ExportJob
+	queued  []models.Job
+	updates []models.ExportJob
+	// done receives the outcome of the job: empty when it completed, its
+	// error when it failed.
+	done chan string
+}
+
+func newExportService(users, attempts, maxAttempts int) *exportService {
+	return &exportService{users: users, attempts: attempts, maxAttempts: maxAttempts, done: make(chan string, 1)}
+}
+
+func (s *exportService) CreateExportJob(ctx context.Context, job *models.ExportJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.ID, job.TenantID, job.Status = 1, tenant.FromContext(ctx), models.ExportPending
+	export := *job
+	s.export = &export
+	return nil
+}
+
+func (s *exportService) GetExportJob(ctx context.Context, id int64) (*models.ExportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.export == nil || s.export.ID != id {
+		return nil, sql.ErrNoRows
+	}
+	export := *s.export
+	return &export, nil
+}
+
+func (s *exportService) UpdateExportJob(ctx context.Context, job *models.ExportJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.deleteAt > 0 && job.Exported >= s.deleteAt {
+		s.export = nil
+	}
+	if s.export == nil {
+		return sql.ErrNoRows
+	}
+	s.updates = append(s.updates, *job)
+	export := *job
+	s.export = &export
+	return nil
+}
+
+func (s *exportService) DeleteExportJob(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.export = nil
+	return nil
+}
+
+func (s *exportService) CountUsers(ctx context.Context, filter database.UserFilter) (int64, error) {
+	return int64(s.users), nil
+}
+
+func (s *exportService) EachUser(ctx context.Context, filter database.UserFilter, fn func(models.User) error) error {
+	for i := 0; i < s.users; i++ {
+		if s.failAt > 0 && i == s.failAt {
+			return errors.New("connection reset")
+		}
+		if err := fn(models.User{ID: fmt.Sprintf("user-%d", i), Status: models.StatusActive}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *exportService) EnqueueJob(ctx context.Context, job *models.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.ID, job.TenantID = 1, tenant.FromContext(ctx)
+	job.Attempts, job.MaxAttempts = s.attempts, s.maxAttempts
+	s.queued = append(s.queued, *job)
+	return nil
+}
+
+func (s *exportService) ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := s.queued
+	s.queued = nil
+	return jobs, nil
+}
+
+func (s *exportService) CompleteJob(ctx context.Context, id int64) error {
+	s.done <- ""
+	return nil
+}
+
+func (s *exportService) FailJob(ctx context.Context, id int64, message string, retryIn time.Duration) error {
+	s.done <- message
+	return nil
+}
+
+// exportServer returns the routes of a server keeping export files in
+// store and a function running the queued export, which returns its
+// outcome as exportService.done reports it.
+func exportServer(t *testing.T, db *exportService, store storage.Store) (http.Handler, func() string) {
+	t.Helper()
+	t.Setenv("WORKER_POLL_INTERVAL", "1ms")
+	s, err := server.New(db, server.WithAdminToken(testAdminToken), server.WithExportStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func() string {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		finished := make(chan struct{})
+		go func() {
+			s.RunExports(ctx)
+			close(finished)
+		}()
+		defer func() {
+			cancel()
+			<-finished
+		}()
+		select {
+		case outcome := <-db.done:
+			return outcome
+		case <-time.After(5 * time.Second):
+			t.Fatal("the export did not finish")
+			return ""
+		}
+	}
+	return s.RegisterRoutes(), run
+}
+
+// storedFiles lists the files under dir.
+func storedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestExportRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"unknown format", `{"format":"xml"}`, http.StatusBadRequest},
+		{"unknown filter", `{"filter":{"colour":"red"}}`, http.StatusBadRequest},
+		{"invalid filter", `{"filter":{"status":"asleep"}}`, http.StatusBadRequest},
+		{"valid", `{"format":"ndjson","filter":{"status":"active","metadata.plan":"pro"}}`, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		db := newExportService(0, 1, 3)
+		h, _ := exportServer(t, db, &storage.Local{Dir: t.TempDir()})
+		rec := request(h, http.MethodPost, "/api/v1/admin/exports", tt.body, asAdmin...)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d %s; want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+		if rec.Code != http.StatusAccepted {
+			if len(db.queued) != 0 {
+				t.Errorf("%s: queued %v; want nothing", tt.name, db.queued)
+			}
+			continue
+		}
+		if got := rec.Header().Get("Location"); got != "/api/v1/admin/exports/1" {
+			t.Errorf("Location = %q; want /api/v1/admin/exports/1", got)
+		}
+		if len(db.queued) != 1 || db.queued[0].Key != "export:1" || string(db.queued[0].Payload) != `{"export_id":1}` {
+			t.Errorf("queued %+v; want the job of export 1", db.queued)
+		}
+		if rec := request(h, http.MethodGet, "/api/v1/admin/exports/1/download", "", asAdmin...); rec.Code != http.StatusConflict {
+			t.Errorf("downloading a pending export: %d; want 409", rec.Code)
+		}
+	}
+}
+
+func TestRunExport(t *testing.T) {
+	dir := t.TempDir()
+	db := newExportService(2500, 1, 3)
+	h, run := exportServer(t, db, &storage.Local{Dir: dir})
+	if rec := request(h, http.MethodPost, "/api/v1/admin/exports", `{"format":"ndjson"}`, asAdmin...); rec.Code != http.StatusAccepted {
+		t.Fatalf("create: %d %s; want 202", rec.Code, rec.Body)
+	}
+	if outcome := run(); outcome != "" {
+		t.Fatalf("export failed: %s", outcome)
+	}
+
+	// Progress is recorded as it starts, every 1000 users and when it
+	// is done
+	var progress []string
+	for _, u := range db.updates {
+		progress = append(progress, fmt.Sprintf("%s %d/%d", u.Status, u.Exported, u.Total))
+	}
+	want := []string{"running 0/2500", "running 1000/2500", "running 2000/2500", "done 2500/2500"}
+	if !slices.Equal(progress, want) {
+		t.Errorf("progress = %v; want %v", progress, want)
+	}
+
+	rec := request(h, http.MethodGet, "/api/v1/admin/exports/1", "", asAdmin...)
+	var export models.ExportJob
+	if err := json.NewDecoder(rec.Body).Decode(&export); err != nil {
+		t.Fatal(err)
+	}
+	if export.Status != models.ExportDone || export.DownloadURL != "/api/v1/admin/exports/1/download" || export.Size == 0 {
+		t.Errorf("export = %+v; want done with a download URL", export)
+	}
+	// The legacy paths link to v1 too
+	rec = request(h, http.MethodGet, "/admin/exports/1", "", asAdmin...)
+	if err := json.NewDecoder(rec.Body).Decode(&export); err != nil {
+		t.Fatal(err)
+	}
+	if export.DownloadURL != "/api/v1/admin/exports/1/download" {
+		t.Errorf("download URL through the legacy path = %q; want the v1 one", export.DownloadURL)
+	}
+	rec = request(h, http.MethodGet, "/api/v1/admin/exports/1/download", "", asAdmin...)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("download: %d %s; want 200 with NDJSON", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	lines := 0
+	for scanner := bufio.NewScanner(rec.Body); scanner.Scan(); lines++ {
+		var u models.User
+		if err := json.Unmarshal(scanner.Bytes(), &u); err != nil || u.ID != fmt.Sprintf("user-%d", lines) {
+			t.Fatalf("line %d: %s, %v; want user-%d", lines+1, scanner.Bytes(), err, lines)
+		}
+	}
+	if lines != 2500 {
+		t.Errorf("downloaded %d users; want 2500", lines)
+	}
+
+	if rec := request(h, http.MethodDelete, "/api/v1/admin/exports/1", "", asAdmin...); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d %s; want 204", rec.Code, rec.Body)
+	}
+	if files := storedFiles(t, dir); len(files) != 0 {
+		t.Errorf("files left after deleting the export: %v", files)
+	}
+}
+
+func TestRunExportFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		attempts   int
+		wantStatus models.ExportStatus
+		// wantExported is where the export was last recorded: at its
+		// last progress update while retried, where it failed once not
+		wantExported int64
+	}{
+		{"retried", 1, models.ExportRunning, 1000},
+		{"last attempt", 3, models.ExportFailed, 1500},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		db := newExportService(2500, tt.attempts, 3)
+		db.failAt = 1500
+		h, run := exportServer(t, db, &storage.Local{Dir: dir})
+		if rec := request(h, http.MethodPost, "/api/v1/admin/exports", `{}`, asAdmin...); rec.Code != http.StatusAccepted {
+			t.Fatalf("%s: create: %d %s; want 202", tt.name, rec.Code, rec.Body)
+		}
+		if outcome := run(); outcome != "connection reset" {
+			t.Errorf("%s: job outcome = %q; want it failed by the error", tt.name, outcome)
+		}
+		export, _ := db.GetExportJob(context.Background(), 1)
+		if export.Status != tt.wantStatus || export.Exported != tt.wantExported {
+			t.Errorf("%s: export is %s at %d users; want %s at %d", tt.name, export.Status, export.Exported, tt.wantStatus, tt.wantExported)
+		}
+		if tt.wantStatus == models.ExportFailed && export.Error != "connection reset" {
+			t.Errorf("%s: export error = %q; want the failure", tt.name, export.Error)
+		}
+		if files := storedFiles(t, dir); len(files) != 0 {
+			t.Errorf("%s: a failed export stored %v", tt.name, files)
+		}
+	}
+}
+
+func TestExportDeletedWhileRunning(t *testing.T) {
+	tests := []struct {
+		name     string
+		deleteAt int64
+	}{
+		{"while writing", 1000},
+		{"while storing", 2500},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		db := newExportService(2500, 1, 3)
+		db.deleteAt = tt.deleteAt
+		h, run := exportServer(t, db, &storage.Local{Dir: dir})
+		if rec := request(h, http.MethodPost, "/api/v1/admin/exports", `{}`, asAdmin...); rec.Code != http.StatusAccepted {
+			t.Fatalf("%s: create: %d %s; want 202", tt.name, rec.Code, rec.Body)
+		}
+		// The export stops without being retried
+		if outcome := run(); outcome != "" {
+			t.Errorf("%s: job failed with %q; want it completed", tt.name, outcome)
+		}
+		if files := storedFiles(t, dir); len(files) != 0 {
+			t.Errorf("%s: files left of the deleted export: %v", tt.name, files)
+		}
+	}
+}
+
+func TestExportJobs(t *testing.T) {
+	db, ctx := testDB(t)
+	job := &models.ExportJob{Format: models.ExportCSV, Filter: map[string]string{"status": "active"}, CreatedBy: "admin"}
+	if err := db.CreateExportJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if job.ID == 0 || job.Status != models.ExportPending {
+		t.Fatalf("created %+v; want a pending job with an ID", job)
+	}
+
+	job.Status, job.Total, job.Exported = models.ExportRunning, 10, 4
+	if err := db.UpdateExportJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.GetExportJob(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.ExportRunning || got.Exported != 4 || got.Filter["status"] != "active" || got.CompletedAt != nil {
+		t.Errorf("running job = %+v; want 4 of 10 exported, not completed", got)
+	}
+	job.Status, job.Exported, job.StorageKey, job.Size = models.ExportDone, 10, "exports/test/1.csv", 512
+	if err := db.UpdateExportJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = db.GetExportJob(ctx, job.ID); err != nil || got.StorageKey != job.StorageKey || got.CompletedAt == nil {
+		t.Errorf("finished job = %+v, %v; want its file and completion time", got, err)
+	}
+
+	if jobs, err := db.ListExportJobs(ctx, database.Page{Limit: 10}); err != nil || len(jobs) != 1 || jobs[0].ID != job.ID {
+		t.Errorf("jobs = %v, %v; want %d", jobs, err, job.ID)
+	}
+	other := tenant.WithTenant(context.Background(), fmt.Sprintf("other-%d", time.Now().UnixNano()))
+	if _, err := db.GetExportJob(other, job.ID); err != sql.ErrNoRows {
+		t.Errorf("reading another tenant's export: %v; want sql.ErrNoRows", err)
+	}
+
+	if err := db.DeleteExportJob(ctx, job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateExportJob(ctx, job); err != sql.ErrNoRows {
+		t.Errorf("updating a deleted export: %v; want sql.ErrNoRows", err)
+	}
+	if err := db.DeleteExportJob(ctx, job.ID); err != sql.ErrNoRows {
+		t.Errorf("deleting again: %v; want sql.ErrNoRows", err)
+	}
+}
+
+func TestEachUser(t *testing.T) {
+	db, ctx := testDB(t)
+	// One more than a batch
+	users := make([]*models.User, 1001)
+	for i := range users {
+		users[i] = testUser("Ada")
+	}
+	if err := db.CreateUsers(ctx, users); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	err := db.EachUser(ctx, database.UserFilter{}, func(u models.User) error {
+		if seen[u.ID] {
+			return fmt.Errorf("user %s seen twice", u.ID)
+		}
+		seen[u.ID] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != len(users) {
+		t.Errorf("saw %d users; want %d", len(seen), len(users))
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = db.EachUser(ctx, database.UserFilter{}, func(u models.User) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("stopping: %v after %d calls; want the error after 1", err, calls)
+	}
+}
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"users/internal/database"
+)
+
+func TestInjectedConnectionErrorsOpenTheCircuit(t *testing.T) {
+	t.Setenv("DB_RETRY_MAX_ATTEMPTS", "1")
+	faults := &database.Faults{ConnectionErrorRate: 1, Operations: []string{"GetUserByID"}}
+	db, ctx := testDB(t, database.WithFaultInjection(faults))
+	breaker := database.WithCircuitBreaker(db)
+	breaker.Threshold = 2
+
+	for i := 0; i < 2; i++ {
+		_, err := breaker.GetUserByID(ctx, "1")
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != "08006" {
+			t.Fatalf("expected an injected connection error; got %v", err)
+		}
+	}
+	if _, err := breaker.GetUserByID(ctx, "1"); err != database.ErrUnavailable {
+		t.Fatalf("expected the circuit to open; got %v", err)
+	}
+}
+
+func TestInjectedLatencyHonoursDeadlines(t *testing.T) {
+	faults := &database.Faults{Latency: time.Second, LatencyRate: 1, Operations: []string{"GetUserByID"}}
+	db, ctx := testDB(t, database.WithFaultInjection(faults))
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := db.GetUserByID(ctx, "1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to cut the delay short; got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("expected the call to end at the deadline; took %v", elapsed)
+	}
+}
+
+func TestFaultsOnlyHitTheirOperations(t *testing.T) {
+	faults := &database.Faults{SerializationRate: 1, Operations: []string{"UpdateUserByID"}}
+	db, ctx := testDB(t, database.WithFaultInjection(faults))
+	user, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatalf("expected CreateUser to be spared; got %v", err)
+	}
+	if _, err := db.GetUserByID(ctx, user.ID); err != nil {
+		t.Fatalf("expected GetUserByID to be spared; got %v", err)
+	}
+}
+
+func TestFaultsFromEnv(t *testing.T) {
+	t.Setenv("DB_FAULT_LATENCY", "200ms")
+	t.Setenv("DB_FAULT_LATENCY_RATE", "0.5")
+	t.Setenv("DB_FAULT_OPERATIONS", "GetUserByID, ListUsers")
+	if _, err := database.FaultsFromEnv(); err == nil {
+		t.Fatal("expected faults without DB_FAULTS_ENABLED to be rejected")
+	}
+
+	t.Setenv("DB_FAULTS_ENABLED", "true")
+	faults, err := database.FaultsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if faults.Latency != 200*time.Millisecond || faults.LatencyRate != 0.5 || len(faults.Operations) != 2 || !faults.Enabled() {
+		t.Fatalf("unexpected faults %+v", faults)
+	}
+
+	t.Setenv("APP_ENV", "production")
+	if _, err := database.FaultsFromEnv(); err == nil {
+		t.Fatal("expected faults to be refused in production")
+	}
+	t.Setenv("APP_ENV", "")
+
+	t.Setenv("DB_FAULT_CONNECTION_ERROR_RATE", "5")
+	if _, err := database.FaultsFromEnv(); err == nil {
+		t.Fatal("expected a rate above 1 to be rejected")
+	}
+}
+
+func TestFaultsHitTransactionsInDryRunsOnce(t *testing.T) {
+	const latency = 200 * time.Millisecond
+	faults := &database.Faults{Latency: latency, LatencyRate: 1, Operations: []string{"SnapshotUser"}}
+	db, ctx := testDB(t, database.WithFaultInjection(faults))
+
+	start := time.Now()
+	err := db.DryRun(ctx, func(ctx context.Context) error {
+		_, err := db.SnapshotUser(ctx, "no-such-user")
+		return err
+	})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("snapshot of an unknown user: %v; want sql.ErrNoRows", err)
+	}
+	if elapsed := time.Since(start); elapsed < latency || elapsed >= 2*latency {
+		t.Errorf("the dry run took %v; want the latency injected once", elapsed)
+	}
+}
@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"users/internal/flags"
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+type flagStore []models.FeatureFlag
+
+func (s flagStore) ListFeatureFlags(context.Context) ([]models.FeatureFlag, error) {
+	return s, nil
+}
+
+func TestFlagPrecedence(t *testing.T) {
+	store := flagStore{{TenantID: "beta", Name: flags.WelcomeEmail, Enabled: false}}
+	f := flags.New(store, flags.Config{
+		Defaults: map[string]bool{flags.WelcomeEmail: true},
+		Tenants:  map[string]map[string]bool{"beta": {flags.WelcomeEmail: true, flags.EmailVerificationRequired: true}},
+	})
+	if err := f.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tenant, flag string
+		want         bool
+		source       flags.Source
+	}{
+		{"acme", flags.WelcomeEmail, true, flags.SourceConfig},
+		{"acme", flags.EmailVerificationRequired, false, flags.SourceBuiltin},
+		{"beta", flags.WelcomeEmail, false, flags.SourceOverride},
+		{"beta", flags.EmailVerificationRequired, true, flags.SourceConfig},
+	}
+	for _, tt := range tests {
+		if got, source := f.Resolve(tt.tenant, tt.flag); got != tt.want || source != tt.source {
+			t.Errorf("%s/%s = %v from %s; want %v from %s", tt.tenant, tt.flag, got, source, tt.want, tt.source)
+		}
+	}
+
+	ctx := flags.NewContext(tenant.WithTenant(context.Background(), "beta"), f)
+	if !flags.Enabled(ctx, flags.EmailVerificationRequired) {
+		t.Error("Enabled does not use the tenant of the context")
+	}
+	if flags.Enabled(context.Background(), flags.EmailVerificationRequired) {
+		t.Error("a context without flags should get the built-in default")
+	}
+}
+
+func TestParseFlagList(t *testing.T) {
+	got, err := flags.ParseList("welcome_email, -email_verification_required")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got[flags.WelcomeEmail] || got[flags.EmailVerificationRequired] || len(got) != 2 {
+		t.Errorf("ParseList = %v", got)
+	}
+	if _, err := flags.ParseList("no_such_flag"); err == nil {
+		t.Error("unknown flag accepted")
+	}
+}
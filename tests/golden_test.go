@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/testutil"
+)
+
+func TestFixturesAreDeterministic(t *testing.T) {
+	a := testutil.New(testutil.Seed).Users(3)
+	b := testutil.New(testutil.Seed).Users(3)
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("builders with the same seed built different users:\n%+v\n%+v", a, b)
+	}
+	if a[0].ID == a[1].ID || a[0].Email == a[1].Email || !a[0].Created.Before(a[1].Created) {
+		t.Fatalf("expected distinct users in creation order; got %+v and %+v", a[0], a[1])
+	}
+	if other := testutil.New(testutil.Seed + 1).User(); other.ID == a[0].ID {
+		t.Fatal("expected another seed to build other users")
+	}
+}
+
+// goldenService answers from the fixtures the wire format tests render
+// and records the updates it is given.
+type goldenService struct {
+	database.Service
+	users    map[string]*models.User
+	snapshot *models.UserSnapshot
+	export   *models.ExportJob
+	updates  []models.UserUpdate
+}
+
+func (s *goldenService) GetUserByID(ctx context.Context, id string, fields ...string) (*models.User, error) {
+	if user, ok := s.users[id]; ok {
+		return user, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *goldenService) UpdateUserByID(ctx context.Context, id string, updates models.UserUpdate) (*models.User, error) {
+	s.updates = append(s.updates, updates)
+	return s.GetUserByID(ctx, id)
+}
+
+func (s *goldenService) SnapshotUser(ctx context.Context, id string) (*models.UserSnapshot, error) {
+	return s.snapshot, nil
+}
+
+func (s *goldenService) GetExportJob(ctx context.Context, id int64) (*models.ExportJob, error) {
+	return s.export, nil
+}
+
+// getGolden requests path from a server answering from db and compares the
+// response body with the golden file name.
+func getGolden(t *testing.T, db database.Service, name, path string) {
+	t.Helper()
+	rec := request(testServer(t, db), http.MethodGet, path, "", asAdmin...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d; want 200: %s", path, rec.Code, rec.Body)
+	}
+	testutil.AssertGolden(t, name, rec.Body.Bytes())
+}
+
+// The golden files pin the JSON the API answers with. A test failing here
+// means a change to the models or handlers changes what clients receive;
+// rerun with -update if that is intended and review the diff of testdata.
+func TestUserWireFormat(t *testing.T) {
+	f := testutil.New(testutil.Seed)
+	seen := testutil.Epoch.Add(48 * time.Hour)
+
+	full := f.User(
+		testutil.WithUsername("jsmith"),
+		testutil.WithLocale("en-GB", "Europe/London"),
+		testutil.WithTags("beta", "vip"),
+		testutil.WithVersion(3),
+		func(u *models.User) { u.LastLoginAt, u.LastSeenAt = &seen, &seen },
+	)
+	// Optional fields a new user does not have are left out
+	minimal := f.User(testutil.WithBirthdate(""))
+	db := &goldenService{users: map[string]*models.User{full.ID: full, minimal.ID: minimal}}
+
+	getGolden(t, db, "user", "/api/v1/users/"+full.ID)
+	getGolden(t, db, "user_minimal", "/api/v1/users/"+minimal.ID)
+}
+
+// The update golden file is a request body: the handler must decode it into
+// exactly the update it pins.
+func TestUserUpdateWireFormat(t *testing.T) {
+	user := testutil.New(testutil.Seed).User()
+	db := &goldenService{users: map[string]*models.User{user.ID: user}}
+	body, err := os.ReadFile("testdata/user_update.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := request(testServer(t, db), http.MethodPatch, "/api/v1/users/"+user.ID, string(body), append(asAdmin, "If-Match", `W/"2"`)...)
+	if rec.Code != http.StatusOK || len(db.updates) != 1 {
+		t.Fatalf("PATCH = %d with %d updates; want 200 with one: %s", rec.Code, len(db.updates), rec.Body)
+	}
+	testutil.AssertGoldenJSON(t, "user_update", &db.updates[0])
+	if want := testutil.Update(testutil.SetFirstName("Ada"), testutil.SetBirthdate(""), testutil.IfVersion(2)); !reflect.DeepEqual(&db.updates[0], want) {
+		t.Errorf("decoded update = %+v; want %+v", db.updates[0], want)
+	}
+}
+
+func TestSnapshotWireFormat(t *testing.T) {
+	user := testutil.New(testutil.Seed).User()
+	prefs := models.DefaultPreferences()
+	db := &goldenService{snapshot: &models.UserSnapshot{
+		TakenAt:     testutil.Epoch.Add(time.Hour),
+		User:        user,
+		Metadata:    models.Metadata{"crm_id": 42},
+		Preferences: &prefs,
+	}}
+	getGolden(t, db, "user_snapshot", "/api/v1/admin/users/"+user.ID+"/snapshot")
+}
+
+func TestExportJobWireFormat(t *testing.T) {
+	done := testutil.Epoch.Add(10 * time.Minute)
+	db := &goldenService{export: &models.ExportJob{
+		ID:          7,
+		TenantID:    "default",
+		Format:      models.ExportCSV,
+		Filter:      map[string]string{"status": "active"},
+		Status:      models.ExportDone,
+		Total:       1200,
+		Exported:    1200,
+		StorageKey:  "exports/default/7.csv",
+		Size:        98304,
+		CreatedBy:   "admin",
+		Created:     testutil.Epoch,
+		UpdatedAt:   done,
+		CompletedAt: &done,
+	}}
+	// The handler adds the download link of a finished export
+	getGolden(t, db, "export_job", "/api/v1/admin/exports/7")
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// groupService knows no groups.
+type groupService struct {
+	database.Service
+}
+
+func (s *groupService) CreateGroup(ctx context.Context, group *models.Group) error {
+	group.ID = "group-1"
+	return nil
+}
+
+func (s *groupService) AddUserToGroup(ctx context.Context, groupID, userID string) error {
+	return sql.ErrNoRows
+}
+
+func TestGroupRequests(t *testing.T) {
+	tests := []struct {
+		name         string
+		method, path string
+		body         string
+		want         int
+	}{
+		{"create", http.MethodPost, "/api/v1/groups", `{"name":"Engineering"}`, http.StatusCreated},
+		{"blank name", http.MethodPost, "/api/v1/groups", `{"name":"  "}`, http.StatusBadRequest},
+		{"long name", http.MethodPost, "/api/v1/groups", `{"name":"` + strings.Repeat("x", 1000) + `"}`, http.StatusBadRequest},
+		{"unknown group or user", http.MethodPut, "/api/v1/groups/group-2/members/user-1", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		h := testServer(t, &groupService{})
+		if rec := request(h, tt.method, tt.path, tt.body, asAdmin...); rec.Code != tt.want {
+			t.Errorf("%s: status = %d %s; want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+	}
+}
+
+func TestGroups(t *testing.T) {
+	db, ctx := testDB(t)
+	group := &models.Group{Name: "Engineering", Description: "Builds things"}
+	if err := db.CreateGroup(ctx, group); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateGroup(ctx, &models.Group{Name: "ENGINEERING"}); err != database.ErrGroupNameTaken {
+		t.Errorf("creating a taken name: %v; want ErrGroupNameTaken", err)
+	}
+	if _, err := db.UpdateGroup(ctx, group.ID, models.GroupUpdate{}); err != database.ErrNoFieldsToUpdate {
+		t.Errorf("updating nothing: %v; want ErrNoFieldsToUpdate", err)
+	}
+	name := "Platform"
+	updated, err := db.UpdateGroup(ctx, group.ID, models.GroupUpdate{Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != name || updated.Description != group.Description {
+		t.Errorf("updated group = %+v; want %s keeping its description", updated, name)
+	}
+
+	var members []*models.User
+	for _, name := range []string{"Ada", "Grace"} {
+		user, err := db.CreateUser(ctx, testUser(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, user)
+		// Adding a member twice changes nothing
+		for i := 0; i < 2; i++ {
+			if err := db.AddUserToGroup(ctx, group.ID, user.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.AddUserToGroup(ctx, group.ID, "no-such-user"); err != sql.ErrNoRows {
+		t.Errorf("adding an unknown user: %v; want sql.ErrNoRows", err)
+	}
+	if n, err := db.CountGroupMembers(ctx, group.ID); err != nil || n != 2 {
+		t.Errorf("members = %d, %v; want 2", n, err)
+	}
+	list, err := db.ListGroupMembers(ctx, group.ID, database.Page{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != members[0].ID || list[1].ID != members[1].ID {
+		t.Errorf("members = %v; want Ada then Grace", list)
+	}
+	groups, err := db.ListUserGroups(ctx, members[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].ID != group.ID {
+		t.Errorf("groups of Ada = %v; want %s", groups, group.ID)
+	}
+
+	if err := db.RemoveUserFromGroup(ctx, group.ID, members[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RemoveUserFromGroup(ctx, group.ID, members[0].ID); err != sql.ErrNoRows {
+		t.Errorf("removing a former member: %v; want sql.ErrNoRows", err)
+	}
+	if err := db.DeleteGroup(ctx, group.ID); err != nil {
+		t.Fatal(err)
+	}
+	if groups, err := db.ListUserGroups(ctx, members[1].ID); err != nil || len(groups) != 0 {
+		t.Errorf("groups of Grace after deleting the group: %v, %v; want none", groups, err)
+	}
+	if _, err := db.CountGroupMembers(ctx, group.ID); err != sql.ErrNoRows {
+		t.Errorf("counting the members of a deleted group: %v; want sql.ErrNoRows", err)
+	}
+}
+
+func TestGroupsStayWithinTheirTenant(t *testing.T) {
+	db, ctx := testDB(t)
+	group := &models.Group{Name: "Engineering"}
+	if err := db.CreateGroup(ctx, group); err != nil {
+		t.Fatal(err)
+	}
+	other := tenant.WithTenant(context.Background(), fmt.Sprintf("other-%d", time.Now().UnixNano()))
+	outsider, err := db.CreateUser(other, testUser("Eve"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.GetGroup(other, group.ID); err != sql.ErrNoRows {
+		t.Errorf("reading another tenant's group: %v; want sql.ErrNoRows", err)
+	}
+	if err := db.AddUserToGroup(other, group.ID, outsider.ID); err != sql.ErrNoRows {
+		t.Errorf("joining another tenant's group: %v; want sql.ErrNoRows", err)
+	}
+	if err := db.AddUserToGroup(ctx, group.ID, outsider.ID); err != sql.ErrNoRows {
+		t.Errorf("adding another tenant's user: %v; want sql.ErrNoRows", err)
+	}
+	if err := db.CreateGroup(other, &models.Group{Name: "Engineering"}); err != nil {
+		t.Errorf("another tenant using the same name: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+func TestGrowthStatsCountEachActiveUserOnce(t *testing.T) {
+	db, ctx := testDB(t)
+	var users []*models.User
+	for _, name := range []string{"Ada", "Grace", "Linus"} {
+		u, err := db.CreateUser(ctx, testUser(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+	}
+	if _, err := db.DeleteUserByID(ctx, users[2].ID); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := db.RecordLogin(ctx, users[0].ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	seen := []models.Activity{
+		{TenantID: tenant.FromContext(ctx), UserID: users[0].ID, SeenAt: now},
+		{TenantID: tenant.FromContext(ctx), UserID: users[1].ID, SeenAt: now},
+		{TenantID: tenant.FromContext(ctx), UserID: users[1].ID, SeenAt: now},
+	}
+	if err := db.TouchLastSeen(ctx, seen); err != nil {
+		t.Fatal(err)
+	}
+
+	want := models.GrowthDay{Signups: 3, Deletions: 1, ActiveUsers: 2}
+	// A second refresh recounts the same rows
+	for run := 0; run < 2; run++ {
+		if _, err := db.RefreshGrowthStats(ctx); err != nil {
+			t.Fatal(err)
+		}
+		stats, err := db.GetGrowthStats(ctx, now, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stats.Days) != 1 {
+			t.Fatalf("got %d days; want 1", len(stats.Days))
+		}
+		got := stats.Days[0]
+		if got.Signups != want.Signups || got.Deletions != want.Deletions || got.ActiveUsers != want.ActiveUsers {
+			t.Errorf("run %d: got %+v; want %+v", run, got, want)
+		}
+	}
+}
+
+func TestGrowthStatsIncludeQuietDays(t *testing.T) {
+	db, ctx := testDB(t)
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -6)
+	stats, err := db.GetGrowthStats(ctx, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Days) != 7 {
+		t.Fatalf("got %d days; want 7", len(stats.Days))
+	}
+	for i, d := range stats.Days {
+		if want := from.Truncate(24*time.Hour).AddDate(0, 0, i); !d.Day.Equal(want) {
+			t.Errorf("day %d is %v; want %v", i, d.Day, want)
+		}
+		if d.Signups != 0 || d.Deletions != 0 || d.ActiveUsers != 0 {
+			t.Errorf("day %v of a new tenant counts %+v", d.Day, d)
+		}
+	}
+}
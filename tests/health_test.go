@@ -0,0 +1,42 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"users/internal/health"
+)
+
+func TestHealthRegistry(t *testing.T) {
+	ok := func(ctx context.Context) (any, error) { return "fine", nil }
+	fail := func(ctx context.Context) (any, error) { return nil, errors.New("unreachable") }
+	hang := func(ctx context.Context) (any, error) {
+		time.Sleep(time.Second)
+		return nil, nil
+	}
+
+	registry := health.NewRegistry()
+	registry.Register(health.Check{Name: "db", Run: ok})
+	registry.Register(health.Check{Name: "cache", Optional: true, Run: fail})
+	report := registry.Run(context.Background())
+	if report.Status != health.StatusDegraded {
+		t.Fatalf("expected failing optional check to degrade the report; got %s", report.Status)
+	}
+	if r := report.Checks["db"]; r.Status != health.StatusUp || r.Details != "fine" {
+		t.Fatalf("unexpected db result %+v", r)
+	}
+	if r := report.Checks["cache"]; r.Status != health.StatusDown || r.Error != "unreachable" {
+		t.Fatalf("unexpected cache result %+v", r)
+	}
+
+	registry.Register(health.Check{Name: "db", Timeout: 20 * time.Millisecond, Run: hang})
+	start := time.Now()
+	report = registry.Run(context.Background())
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("expected hanging check to be cut off at its timeout; took %s", time.Since(start))
+	}
+	if report.Status != health.StatusDown || report.Checks["db"].Status != health.StatusDown {
+		t.Fatalf("expected timed out required check to take the report down; got %+v", report)
+	}
+}
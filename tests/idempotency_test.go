@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// idempotencyService keeps idempotency records in memory and holds every
+// CreateUser call until release is closed.
+type idempotencyService struct {
+	database.Service
+	mu      sync.Mutex
+	records map[string]models.IdempotencyRecord
+	creates int
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *idempotencyService) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.records[record.Key]; ok {
+		return &existing, nil
+	}
+	s.records[record.Key] = *record
+	return nil, nil
+}
+
+func (s *idempotencyService) SaveIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[record.Key] = *record
+	return nil
+}
+
+func (s *idempotencyService) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *idempotencyService) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	s.mu.Lock()
+	s.creates++
+	s.mu.Unlock()
+	s.entered <- struct{}{}
+	<-s.release
+	created := *user
+	created.ID = "user-1"
+	return &created, nil
+}
+
+func (s *idempotencyService) FindPotentialDuplicates(ctx context.Context, user *models.User) ([]models.DuplicateCandidate, error) {
+	return nil, nil
+}
+
+func TestIdempotentRequestsRunOnce(t *testing.T) {
+	db := &idempotencyService{
+		records: map[string]models.IdempotencyRecord{},
+		entered: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+	h := testServer(t, db)
+	const body = `{"first_name": "Ada", "last_name": "Lovelace", "email": "ada@example.com", "age": 36}`
+	key := []string{"Idempotency-Key", "create-ada"}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- request(h, http.MethodPost, "/api/v1/users", body, key...) }()
+	<-db.entered
+
+	// While the first request runs, the key is reserved
+	rec := request(h, http.MethodPost, "/api/v1/users", body, key...)
+	if rec.Code != http.StatusConflict || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("request while the first is running: %d %s; want 409 with Retry-After", rec.Code, rec.Body)
+	}
+	rec = request(h, http.MethodPost, "/api/v1/users", `{"first_name": "Grace"}`, key...)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("other request with the key: %d %s; want 422", rec.Code, rec.Body)
+	}
+
+	close(db.release)
+	created := <-first
+	if created.Code != http.StatusCreated {
+		t.Fatalf("first request: %d %s", created.Code, created.Body)
+	}
+
+	rec = request(h, http.MethodPost, "/api/v1/users", body, key...)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Idempotent-Replayed") != "true" || rec.Body.String() != created.Body.String() {
+		t.Errorf("retry after the first request: %d %q %s; want the replayed 201", rec.Code, rec.Header().Get("Idempotent-Replayed"), rec.Body)
+	}
+	if db.creates != 1 {
+		t.Errorf("user created %d times; want once", db.creates)
+	}
+}
+
+func TestReserveIdempotencyKeyConcurrently(t *testing.T) {
+	db, ctx := testDB(t)
+	key := fmt.Sprintf("test:%d", time.Now().UnixNano())
+	reservation := &models.IdempotencyRecord{Key: key, RequestHash: "hash", ExpiresAt: time.Now().Add(time.Minute)}
+
+	const attempts = 10
+	var wg sync.WaitGroup
+	held := make([]*models.IdempotencyRecord, attempts)
+	errs := make([]error, attempts)
+	for i := range held {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			held[i], errs[i] = db.ReserveIdempotencyKey(ctx, reservation)
+		}()
+	}
+	wg.Wait()
+
+	reserved := 0
+	for i, record := range held {
+		switch {
+		case errs[i] != nil:
+			t.Fatalf("reserving concurrently: %v", errs[i])
+		case record == nil:
+			reserved++
+		case record.StatusCode != 0:
+			t.Errorf("concurrent reservation found status %d; want a pending record", record.StatusCode)
+		}
+	}
+	if reserved != 1 {
+		t.Fatalf("%d of %d concurrent reservations succeeded; want 1", reserved, attempts)
+	}
+
+	err := db.SaveIdempotencyRecord(ctx, &models.IdempotencyRecord{
+		Key: key, RequestHash: "hash", StatusCode: http.StatusCreated, Body: []byte(`{}`), ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A completed record is replayed, and not released
+	if err := db.ReleaseIdempotencyKey(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	record, err := db.ReserveIdempotencyKey(ctx, reservation)
+	if err != nil || record == nil || record.StatusCode != http.StatusCreated {
+		t.Errorf("reserving a completed key: %+v, %v; want the stored 201", record, err)
+	}
+}
+
+func TestAnonymizingForgetsOnlyTheTenantsResponses(t *testing.T) {
+	db, _ := testDB(t)
+	// An underscore in the tenant's ID matches only itself
+	n := time.Now().UnixNano()
+	own, other := fmt.Sprintf("a_b-%d", n), fmt.Sprintf("axb-%d", n)
+	ctx := tenant.WithTenant(context.Background(), own)
+	user, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"id":"` + user.ID + `"}`)
+	for _, key := range []string{own + ":k1", other + ":k2"} {
+		err := db.SaveIdempotencyRecord(ctx, &models.IdempotencyRecord{
+			Key: key, RequestHash: "hash", StatusCode: http.StatusCreated, Body: body, ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := db.AnonymizeUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if record, err := db.GetIdempotencyRecord(ctx, own+":k1"); err == nil {
+		t.Errorf("response of the tenant after anonymizing = %+v; want it gone", record)
+	}
+	if _, err := db.GetIdempotencyRecord(ctx, other+":k2"); err != nil {
+		t.Errorf("response of another tenant after anonymizing: %v; want it kept", err)
+	}
+}
@@ -0,0 +1,31 @@
+package tests
+
+import (
+	"testing"
+	"time"
+	"users/internal/database"
+	"users/internal/validator"
+)
+
+func TestIDGenerators(t *testing.T) {
+	for name, gen := range map[string]database.IDGenerator{"uuidv7": database.UUIDv7, "ulid": database.ULID} {
+		first := gen()
+		time.Sleep(2 * time.Millisecond)
+		second := gen()
+		if second <= first {
+			t.Errorf("%s: expected %s to sort after %s", name, second, first)
+		}
+		if err := validator.ValidateID(first); err != nil {
+			t.Errorf("%s: expected %s to be a valid ID: %v", name, first, err)
+		}
+	}
+	if id := database.ULID(); len(id) != 26 || id[0] > '7' {
+		t.Errorf("expected a 26 character ULID starting with at most 7; got %s", id)
+	}
+
+	for _, id := range []string{"", "has space", "a/b", string(make([]byte, 65))} {
+		if validator.ValidateID(id) == nil {
+			t.Errorf("expected %q to be rejected", id)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// jobService knows one user and records the jobs queued for it.
+type jobService struct {
+	database.Service
+	queued []models.Job
+	// tenants records the tenant each job listing was made for.
+	tenants []string
+}
+
+func (s *jobService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return &models.User{ID: "user-1", Email: email}, nil
+}
+
+func (s *jobService) EnqueueJob(ctx context.Context, job *models.Job) error {
+	s.queued = append(s.queued, *job)
+	return nil
+}
+
+func (s *jobService) ListJobs(ctx context.Context, status models.JobStatus, page database.Page) ([]models.Job, error) {
+	s.tenants = append(s.tenants, tenant.FromContext(ctx))
+	return s.queued, nil
+}
+
+func TestJobsKeepTokensOutOfTheQueue(t *testing.T) {
+	db := &jobService{}
+	h := testServer(t, db)
+
+	rec := request(h, http.MethodPost, "/api/v1/password/reset", `{"email": "ada@example.com"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST /password/reset: %d %s", rec.Code, rec.Body)
+	}
+	if len(db.queued) != 1 {
+		t.Fatalf("queued %d jobs; want 1", len(db.queued))
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(db.queued[0].Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) != 2 || payload["template"] != "password_reset" || payload["user_id"] != "user-1" {
+		t.Errorf("mail job payload %s; want only the template and the user", db.queued[0].Payload)
+	}
+
+	rec = request(h, http.MethodGet, "/api/v1/admin/jobs", "", append(asAdmin, "X-Tenant-ID", "acme")...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /admin/jobs: %d %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "payload") {
+		t.Errorf("job listing includes payloads: %s", rec.Body)
+	}
+	if len(db.tenants) != 1 || db.tenants[0] != "acme" {
+		t.Errorf("jobs listed for tenants %v; want [acme]", db.tenants)
+	}
+}
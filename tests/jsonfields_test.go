@@ -0,0 +1,37 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+
+	"users/internal/jsonfields"
+	"users/internal/models"
+)
+
+func TestUnknownFields(t *testing.T) {
+	type create struct {
+		models.User
+		Password string `json:"password"`
+	}
+	type bulk struct {
+		IDs     []string          `json:"ids"`
+		Updates models.UserUpdate `json:"updates"`
+		Users   []models.User     `json:"users"`
+	}
+	tests := []struct {
+		body string
+		v    any
+		want []string
+	}{
+		{`{"first_name": "Ada", "password": "secret", "tags": ["vip"], "last_seen_at": null}`, &create{}, nil},
+		{`{"frist_name": "Ada", "email": "ada@example.com", "pasword": "x"}`, &create{}, []string{"frist_name", "pasword"}},
+		{`{"First_Name": "Ada"}`, &create{}, nil},
+		{`{"ids": ["1"], "updates": {"frist_name": "Ada"}, "users": [{}, {"emial": "x"}]}`, &bulk{}, []string{"updates.frist_name", "users[1].emial"}},
+		{`{"ids": [`, &bulk{}, nil},
+	}
+	for _, tt := range tests {
+		if got := jsonfields.Unknown([]byte(tt.body), tt.v); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Unknown(%s) = %q; want %q", tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/totp"
+)
+
+const testPassword = "correct horse battery staple"
+
+// loginService knows one user with a password and two-factor
+// authentication enabled, who is locked after lockAt failed logins.
+type loginService struct {
+	database.Service
+	hash     string
+	secret   string
+	lockAt   int
+	failures int
+	locked   *time.Time
+}
+
+func newLoginService(t *testing.T, lockAt int) *loginService {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &loginService{hash: string(hash), secret: secret, lockAt: lockAt}
+}
+
+func (s *loginService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	if email != "ada@example.com" {
+		return nil, sql.ErrNoRows
+	}
+	return &models.User{ID: "user-1", Email: email, Status: models.StatusActive}, nil
+}
+
+func (s *loginService) GetLockedUntil(ctx context.Context, userID string) (*time.Time, error) {
+	return s.locked, nil
+}
+
+func (s *loginService) GetPasswordHash(ctx context.Context, userID string) (string, error) {
+	return s.hash, nil
+}
+
+func (s *loginService) ResetFailedLogins(ctx context.Context, userID string) error { return nil }
+
+func (s *loginService) RecordFailedLogin(ctx context.Context, userID string, policy database.LockoutPolicy) (*time.Time, error) {
+	s.failures++
+	if s.lockAt > 0 && s.failures >= s.lockAt {
+		until := time.Now().Add(policy.Duration)
+		s.locked = &until
+		return s.locked, nil
+	}
+	return nil, nil
+}
+
+func (s *loginService) GetTOTP(ctx context.Context, userID string) (*models.TOTP, error) {
+	enabled := time.Now().Add(-time.Hour)
+	return &models.TOTP{UserID: userID, Secret: s.secret, EnabledAt: &enabled}, nil
+}
+
+// startPendingLogin logs in with the password and returns the cookie of
+// the login waiting for its second factor.
+func startPendingLogin(t *testing.T, h http.Handler) []string {
+	t.Helper()
+	rec := request(h, http.MethodPost, "/api/v1/login", `{"email": "ada@example.com", "password": "`+testPassword+`"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST /login: %d %s; want 202", rec.Code, rec.Body)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("POST /login set no session cookie")
+	}
+	return []string{"Cookie", cookies[0].Name + "=" + cookies[0].Value}
+}
+
+func TestWrongSecondFactorCodesEndThePendingLogin(t *testing.T) {
+	db := newLoginService(t, 0)
+	h := testServer(t, db)
+	cookie := startPendingLogin(t, h)
+
+	const wrong = `{"code": "abcdef"}`
+	for i := 1; i < 5; i++ {
+		if rec := request(h, http.MethodPost, "/api/v1/auth/2fa", wrong, cookie...); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: %d %s; want 401", i, rec.Code, rec.Body)
+		}
+	}
+	rec := request(h, http.MethodPost, "/api/v1/auth/2fa", wrong, cookie...)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong code 5: %d %s; want 401", rec.Code, rec.Body)
+	}
+	if db.failures != 5 {
+		t.Errorf("%d failed logins recorded for 5 wrong codes", db.failures)
+	}
+
+	// Not even the right code completes the login now
+	code, err := totp.Code(db.secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = request(h, http.MethodPost, "/api/v1/auth/2fa", `{"code": "`+code+`"}`, cookie...)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("right code after 5 wrong ones: %d %s; want 401", rec.Code, rec.Body)
+	}
+}
+
+func TestWrongSecondFactorCodesLockTheAccount(t *testing.T) {
+	db := newLoginService(t, 2)
+	h := testServer(t, db)
+	cookie := startPendingLogin(t, h)
+
+	const wrong = `{"code": "abcdef"}`
+	if rec := request(h, http.MethodPost, "/api/v1/auth/2fa", wrong, cookie...); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong code 1: %d %s; want 401", rec.Code, rec.Body)
+	}
+	rec := request(h, http.MethodPost, "/api/v1/auth/2fa", wrong, cookie...)
+	if rec.Code != http.StatusLocked || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("wrong code reaching the lockout: %d %s; want 423 with Retry-After", rec.Code, rec.Body)
+	}
+	if rec := request(h, http.MethodPost, "/api/v1/auth/2fa", wrong, cookie...); rec.Code != http.StatusUnauthorized {
+		t.Errorf("code for a login ended by the lockout: %d %s; want 401", rec.Code, rec.Body)
+	}
+}
+
+func TestLockedAccountsAnswerLikeUnknownOnes(t *testing.T) {
+	db := newLoginService(t, 2)
+	h := testServer(t, db)
+	login := func(email, password string) (int, string) {
+		rec := request(h, http.MethodPost, "/api/v1/login", `{"email": "`+email+`", "password": "`+password+`"}`)
+		if rec.Header().Get("Retry-After") != "" {
+			t.Errorf("login as %s told when to retry", email)
+		}
+		return rec.Code, rec.Body.String()
+	}
+
+	unknownCode, unknownBody := login("nobody@example.com", "wrong")
+	if unknownCode != http.StatusUnauthorized {
+		t.Fatalf("unknown email: %d; want 401", unknownCode)
+	}
+	for i, password := range []string{"wrong", "wrong", testPassword} {
+		code, body := login("ada@example.com", password)
+		if code != unknownCode || body != unknownBody {
+			t.Errorf("login %d: %d %s; want %d %s as for an unknown email", i+1, code, body, unknownCode, unknownBody)
+		}
+	}
+	if db.locked == nil {
+		t.Fatal("expected two wrong passwords to lock the account")
+	}
+	if db.failures != 2 {
+		t.Errorf("%d failed logins recorded; logins to a locked account should not count", db.failures)
+	}
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"users/internal/mail"
+	"users/internal/models"
+)
+
+func TestRenderEscapesHTML(t *testing.T) {
+	user := &models.User{FirstName: "<b>Ada</b>", Email: "ada@example.com"}
+	msg, err := mail.Render(mail.TemplateWelcome, user.Email, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.To != "ada@example.com" || msg.Subject != "Welcome, <b>Ada</b>" {
+		t.Errorf("got to %q, subject %q", msg.To, msg.Subject)
+	}
+	if !strings.Contains(msg.Body, "Hi <b>Ada</b>,") {
+		t.Errorf("text body %q does not greet the user", msg.Body)
+	}
+	if strings.Contains(msg.HTML, "<b>Ada</b>") || !strings.Contains(msg.HTML, "&lt;b&gt;Ada&lt;/b&gt;") {
+		t.Errorf("html body %q does not escape the name", msg.HTML)
+	}
+}
+
+func TestRenderTokenLink(t *testing.T) {
+	data := mail.TokenData{Token: "tok", Link: "https://app.example.com/reset?token=tok", ExpiresAt: time.Now().Add(time.Hour)}
+	msg, err := mail.Render(mail.TemplatePasswordReset, "ada@example.com", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(msg.Body, data.Link) || !strings.Contains(msg.HTML, `href="https://app.example.com/reset?token=tok"`) {
+		t.Errorf("reset mail does not link to %s:\n%s\n%s", data.Link, msg.Body, msg.HTML)
+	}
+}
+
+func TestTemplateValidate(t *testing.T) {
+	ok := mail.Template{Subject: "Willkommen, {{.FirstName}}", Text: "Hallo {{.FirstName}}"}
+	if err := ok.Validate(mail.TemplateWelcome); err != nil {
+		t.Errorf("valid template rejected: %v", err)
+	}
+	for name, tmpl := range map[string]mail.Template{
+		"syntax":        {Subject: "{{.FirstName", Text: "Hallo"},
+		"unknown field": {Subject: "Hallo", Text: "{{.Nickname}}"},
+		"wrong data":    {Subject: "Hallo", Text: "{{.Token}}"},
+		"no text":       {Subject: "Hallo"},
+	} {
+		if err := tmpl.Validate(mail.TemplateWelcome); err == nil {
+			t.Errorf("%s: template accepted", name)
+		}
+	}
+}
+
+func TestSendGridSender(t *testing.T) {
+	var got struct {
+		Subject string `json:"subject"`
+		Content []struct {
+			Type string `json:"type"`
+		} `json:"content"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	s := &mail.SendGridSender{APIKey: "key", From: "noreply@example.com", Endpoint: srv.URL, Client: srv.Client()}
+	err := s.Send(context.Background(), mail.Message{To: "ada@example.com", Subject: "Hi", Body: "text", HTML: "<p>html</p>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Subject != "Hi" || len(got.Content) != 2 || got.Content[0].Type != "text/plain" || got.Content[1].Type != "text/html" {
+		t.Errorf("unexpected request %+v", got)
+	}
+}
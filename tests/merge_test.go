@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"users/internal/database"
+	"users/internal/events"
+	"users/internal/models"
+	"users/internal/server"
+	"users/internal/session"
+)
+
+// mergeService merges user-2 into user-1, after which user-2 is merged.
+type mergeService struct {
+	database.Service
+	merged bool
+}
+
+func (s *mergeService) MergeUsers(ctx context.Context, primaryID, duplicateID string) (*models.User, error) {
+	if primaryID == duplicateID {
+		return nil, database.ErrMergeSelf
+	}
+	if s.merged {
+		return nil, database.ErrNotMergeable
+	}
+	s.merged = true
+	return &models.User{ID: primaryID, Status: models.StatusActive, Version: 2}, nil
+}
+
+func (s *mergeService) GetUserByID(ctx context.Context, id string, fields ...string) (*models.User, error) {
+	if id == "user-2" && s.merged {
+		return &models.User{ID: id, Status: models.StatusMerged, MergedInto: "user-1"}, nil
+	}
+	return &models.User{ID: id, Status: models.StatusActive}, nil
+}
+
+func TestMergeRequests(t *testing.T) {
+	store := session.NewMemoryStore()
+	bus := events.NewBus()
+	var published []string
+	bus.Subscribe(func(e events.Event) { published = append(published, e.Type) })
+	h := testServer(t, &mergeService{}, server.WithSessionStore(store), server.WithEvents(bus))
+	startSession(t, store, "default", "user-2")
+
+	if rec := request(h, http.MethodPost, "/api/v1/admin/users/user-1/merge", `{}`, asAdmin...); rec.Code != http.StatusBadRequest {
+		t.Errorf("no duplicate: %d; want 400", rec.Code)
+	}
+	if rec := request(h, http.MethodPost, "/api/v1/admin/users/user-1/merge", `{"duplicate_id":"user-1"}`, asAdmin...); rec.Code != http.StatusBadRequest {
+		t.Errorf("merging into itself: %d; want 400", rec.Code)
+	}
+	rec := request(h, http.MethodPost, "/api/v1/admin/users/user-1/merge", `{"duplicate_id":"user-2"}`, asAdmin...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("merge: %d %s; want 200", rec.Code, rec.Body)
+	}
+	if want := []string{events.UserUpdated, events.UserMerged}; !slices.Equal(published, want) {
+		t.Errorf("events = %v; want %v", published, want)
+	}
+	if sessions, err := store.ListByUser(context.Background(), "default", "user-2"); err != nil || len(sessions) != 0 {
+		t.Errorf("sessions of the merged user: %v, %v; want none", sessions, err)
+	}
+	if rec := request(h, http.MethodPost, "/api/v1/admin/users/user-1/merge", `{"duplicate_id":"user-2"}`, asAdmin...); rec.Code != http.StatusConflict {
+		t.Errorf("merging again: %d; want 409", rec.Code)
+	}
+
+	// A session the merged user started meanwhile is turned away
+	cookie := startSession(t, store, "default", "user-2")
+	if rec := request(h, http.MethodGet, "/api/v1/me", "", cookie...); rec.Code != http.StatusForbidden {
+		t.Errorf("session of the merged user: %d %s; want 403", rec.Code, rec.Body)
+	}
+}
+
+func TestMergeUsers(t *testing.T) {
+	db, ctx := testDB(t)
+	primary, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dup, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group := &models.Group{Name: "Engineering"}
+	if err := db.CreateGroup(ctx, group); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddUserToGroup(ctx, group.ID, dup.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddUserTags(ctx, primary.ID, []string{"vip"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddUserTags(ctx, dup.ID, []string{"beta"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.SetMetadata(ctx, primary.ID, models.Metadata{"plan": "pro"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.SetMetadata(ctx, dup.ID, models.Metadata{"plan": "free", "crm_id": "42"}); err != nil {
+		t.Fatal(err)
+	}
+	dark := models.ThemeDark
+	if _, err := db.UpdatePreferences(ctx, dup.ID, models.PreferencesUpdate{Theme: &dark}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RecordConsent(ctx, &models.Consent{UserID: dup.ID, Kind: models.ConsentMarketing, Granted: true}); err != nil {
+		t.Fatal(err)
+	}
+	subject := fmt.Sprintf("subject-%d", testSeq.Add(1))
+	if err := db.LinkIdentity(ctx, &models.Identity{UserID: dup.ID, Provider: "github", Subject: subject}); err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := db.MergeUsers(ctx, primary.ID, dup.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(merged.Tags, []string{"beta", "vip"}) {
+		t.Errorf("tags = %v; want both users' tags", merged.Tags)
+	}
+	metadata, err := db.GetMetadata(ctx, primary.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata["plan"] != "pro" || metadata["crm_id"] != "42" {
+		t.Errorf("metadata = %v; want the primary's plan and the duplicate's crm_id", metadata)
+	}
+	if groups, err := db.ListUserGroups(ctx, primary.ID); err != nil || len(groups) != 1 || groups[0].ID != group.ID {
+		t.Errorf("groups of the primary = %v, %v; want the duplicate's", groups, err)
+	}
+	if prefs, err := db.GetPreferences(ctx, primary.ID); err != nil || prefs.Theme != dark {
+		t.Errorf("preferences of the primary = %+v, %v; want the duplicate's", prefs, err)
+	}
+	if consents, err := db.GetConsents(ctx, primary.ID); err != nil || len(consents) != 1 {
+		t.Errorf("consents of the primary = %v, %v; want the duplicate's", consents, err)
+	}
+	if owner, err := db.GetUserByIdentity(ctx, "github", subject); err != nil || owner.ID != primary.ID {
+		t.Errorf("identity now logs in as %v, %v; want the primary", owner, err)
+	}
+
+	got, err := db.GetUserByID(ctx, dup.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.StatusMerged || got.MergedInto != primary.ID {
+		t.Errorf("duplicate is %s into %q; want merged into %s", got.Status, got.MergedInto, primary.ID)
+	}
+	reuse := testUser("Ada")
+	reuse.Email = dup.Email
+	if _, err := db.CreateUser(ctx, reuse); err != nil {
+		t.Errorf("reusing the merged user's email: %v", err)
+	}
+
+	if _, err := db.MergeUsers(ctx, primary.ID, dup.ID); err != database.ErrNotMergeable {
+		t.Errorf("merging a merged user: %v; want ErrNotMergeable", err)
+	}
+	if _, err := db.MergeUsers(ctx, primary.ID, primary.ID); err != database.ErrMergeSelf {
+		t.Errorf("merging a user into itself: %v; want ErrMergeSelf", err)
+	}
+	if _, err := db.MergeUsers(ctx, primary.ID, "no-such-user"); err != sql.ErrNoRows {
+		t.Errorf("merging an unknown user: %v; want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,32 @@
+package tests
+
+import (
+	"testing"
+
+	"users/internal/models"
+)
+
+func TestMetadataChangesMoveTheVersion(t *testing.T) {
+	db, ctx := testDB(t)
+	user, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.SetMetadata(ctx, user.ID, models.Metadata{"crm_id": "C-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.MergeMetadata(ctx, user.ID, models.Metadata{"newsletter": true}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != user.Version+2 {
+		t.Errorf("version %d after two metadata changes; want %d", got.Version, user.Version+2)
+	}
+	if !got.UpdatedAt.After(user.UpdatedAt) {
+		t.Errorf("updated_at %v did not move past %v", got.UpdatedAt, user.UpdatedAt)
+	}
+}
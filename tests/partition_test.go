@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// testSchemaDB is testDB migrated into a schema of its own, for tests that
+// change the tables themselves. The schema is dropped afterwards.
+func testSchemaDB(t *testing.T) (database.Service, context.Context) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	conn, err := pgx.Connect(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := conn.Exec(context.Background(), `CREATE SCHEMA `+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn, err := pgx.Connect(context.Background(), dsn)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close(context.Background())
+		if _, err := conn.Exec(context.Background(), `DROP SCHEMA `+schema+` CASCADE`); err != nil {
+			t.Error(err)
+		}
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema+",public")
+	u.RawQuery = q.Encode()
+	db, err := database.New(database.WithDSN(u.String()), database.WithLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db, tenant.WithTenant(context.Background(), fmt.Sprintf("test-%d", time.Now().UnixNano()))
+}
+
+func TestPartitionCountIsBounded(t *testing.T) {
+	db, ctx := testDB(t)
+	for _, n := range []int{1, 257} {
+		if err := db.PartitionUsers(ctx, n); err == nil || err == database.ErrAlreadyPartitioned {
+			t.Errorf("%d partitions: %v; want the count refused", n, err)
+		}
+	}
+}
+
+func TestDeletingUsersCascadesWithinTheTenant(t *testing.T) {
+	db, ctx := testDB(t)
+	primary, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dup, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := &models.Group{Name: "Engineering"}
+	if err := db.CreateGroup(ctx, group); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddUserToGroup(ctx, group.ID, dup.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.MergeUsers(ctx, primary.ID, dup.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The merge moved the membership to the primary, whose deletion takes
+	// it along and leaves the duplicate merged into no one
+	if _, err := db.DeleteUserByID(ctx, primary.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.CountGroupMembers(ctx, group.ID); err != nil || n != 0 {
+		t.Errorf("members after deleting the member = %d, %v; want 0", n, err)
+	}
+	got, err := db.GetUserByID(ctx, dup.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.MergedInto != "" {
+		t.Errorf("duplicate is still merged into %q after deleting it", got.MergedInto)
+	}
+}
+
+func TestPartitionUsers(t *testing.T) {
+	db, ctx := testSchemaDB(t)
+	other := tenant.WithTenant(context.Background(), fmt.Sprintf("other-%d", time.Now().UnixNano()))
+	ada, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	eve, err := db.CreateUser(other, testUser("Eve"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := &models.Group{Name: "Engineering"}
+	if err := db.CreateGroup(ctx, group); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddUserToGroup(ctx, group.ID, ada.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if partitions, err := db.UserPartitions(ctx); err != nil || len(partitions) != 0 {
+		t.Fatalf("partitions before partitioning = %v, %v; want none", partitions, err)
+	}
+	if err := db.PartitionUsers(ctx, 4); err != nil {
+		t.Fatal(err)
+	}
+	partitions, err := db.UserPartitions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range partitions {
+		names = append(names, p.Name)
+	}
+	if want := []string{"users_p0", "users_p1", "users_p2", "users_p3"}; !slices.Equal(names, want) {
+		t.Errorf("partitions = %v; want %v", names, want)
+	}
+	if err := db.PartitionUsers(ctx, 4); err != database.ErrAlreadyPartitioned {
+		t.Errorf("partitioning again: %v; want ErrAlreadyPartitioned", err)
+	}
+	if err := db.MaintainUserPartitions(ctx); err != nil {
+		t.Errorf("maintaining the partitions: %v", err)
+	}
+
+	// The users, their keys and the references to them were carried over
+	for _, u := range []struct {
+		ctx context.Context
+		id  string
+	}{{ctx, ada.ID}, {other, eve.ID}} {
+		if _, err := db.GetUserByID(u.ctx, u.id); err != nil {
+			t.Errorf("user %s after partitioning: %v", u.id, err)
+		}
+	}
+	taken := testUser("Ada")
+	taken.Email = ada.Email
+	if _, err := db.CreateUser(ctx, taken); err != database.ErrEmailTaken {
+		t.Errorf("creating a taken email: %v; want ErrEmailTaken", err)
+	}
+	if _, err := db.CreateUser(ctx, testUser("Grace")); err != nil {
+		t.Errorf("creating a user after partitioning: %v", err)
+	}
+	if _, err := db.DeleteUserByID(ctx, ada.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.CountGroupMembers(ctx, group.ID); err != nil || n != 0 {
+		t.Errorf("members after deleting the member = %d, %v; want 0", n, err)
+	}
+}
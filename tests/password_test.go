@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"users/internal/validator"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := validator.DefaultPasswordPolicy()
+	policy.RequireDigit = true
+	policy.Banned["correcthorse1battery"] = true
+
+	cases := map[string]bool{
+		"short1":                false,
+		"longenoughbutnodigits": false,
+		"Password123456":        true,
+		"CorrectHorse1Battery":  false,
+	}
+	for password, valid := range cases {
+		err := policy.Validate(context.Background(), password)
+		if valid && err != nil {
+			t.Errorf("expected %q to be accepted; got %v", password, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("expected %q to be rejected", password)
+		}
+	}
+}
+
+func TestPasswordPolicyPwned(t *testing.T) {
+	sum := sha1.Sum([]byte("breached password 1"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if prefix := strings.TrimPrefix(r.URL.Path, "/range/"); len(prefix) != 5 {
+			t.Errorf("expected only a five character hash prefix to be sent; got %s", prefix)
+		}
+		fmt.Fprintf(w, "0000000000000000000000000000000000A:0\r\n%s:42\r\n", hash[5:])
+	}))
+	defer server.Close()
+
+	policy := validator.DefaultPasswordPolicy()
+	policy.CheckPwned = true
+	policy.PwnedURL = server.URL + "/range/"
+
+	if err := policy.Validate(context.Background(), "breached password 1"); err == nil {
+		t.Errorf("expected breached password to be rejected")
+	}
+	if err := policy.Validate(context.Background(), "unbreached password 1"); err != nil {
+		t.Errorf("expected unbreached password to be accepted; got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"testing"
+	"users/internal/models"
+	"users/internal/patch"
+)
+
+func TestMergePatch(t *testing.T) {
+	updates, err := patch.MergePatch([]byte(`{"first_name":"Jane","age":31}`))
+	if err != nil {
+		t.Fatalf("unexpected error. Err: %v", err)
+	}
+	if updates.FirstName == nil || *updates.FirstName != "Jane" {
+		t.Errorf("expected first_name Jane; got %v", updates.FirstName)
+	}
+	if updates.Age == nil || *updates.Age != 31 {
+		t.Errorf("expected age 31; got %v", updates.Age)
+	}
+	if updates.LastName != nil || updates.Email != nil {
+		t.Errorf("expected untouched fields to stay nil")
+	}
+
+	if _, err := patch.MergePatch([]byte(`{"email":null}`)); err == nil {
+		t.Errorf("expected removing a required field to fail")
+	}
+	if _, err := patch.MergePatch([]byte(`{"id":"x"}`)); err == nil {
+		t.Errorf("expected patching id to fail")
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	current := &models.User{ID: "1", FirstName: "John", LastName: "Smith", Email: "john@example.com", Age: 30}
+	doc := `[
+		{"op":"test","path":"/first_name","value":"John"},
+		{"op":"replace","path":"/email","value":"js@example.com"},
+		{"op":"copy","from":"/first_name","path":"/last_name"}
+	]`
+
+	updates, err := patch.JSONPatch([]byte(doc), current)
+	if err != nil {
+		t.Fatalf("unexpected error. Err: %v", err)
+	}
+	if updates.Email == nil || *updates.Email != "js@example.com" {
+		t.Errorf("expected email to be replaced; got %v", updates.Email)
+	}
+	if updates.LastName == nil || *updates.LastName != "John" {
+		t.Errorf("expected last_name to be copied; got %v", updates.LastName)
+	}
+	if updates.FirstName != nil || updates.Age != nil {
+		t.Errorf("expected unchanged fields to stay nil")
+	}
+
+	failing := []string{
+		`[{"op":"test","path":"/first_name","value":"Jane"}]`,
+		`[{"op":"remove","path":"/email"}]`,
+		`[{"op":"replace","path":"/id","value":"2"}]`,
+		`[{"op":"replace","path":"/unknown","value":"2"}]`,
+	}
+	for _, doc := range failing {
+		if _, err := patch.JSONPatch([]byte(doc), current); err == nil {
+			t.Errorf("expected %s to fail", doc)
+		}
+	}
+}
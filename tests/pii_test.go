@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"users/internal/pii"
+)
+
+func TestPIIKeyRotation(t *testing.T) {
+	key := func(b byte) []byte { return bytes.Repeat([]byte{b}, 32) }
+	indexKey := key(9)
+	old, err := pii.New(map[int][]byte{1: key(1)}, 1, indexKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := old.Encrypt("ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "ada") || !pii.Encrypted(sealed) {
+		t.Fatalf("expected an encrypted value; got %s", sealed)
+	}
+	if again, _ := old.Encrypt("ada@example.com"); again == sealed {
+		t.Error("expected encrypting twice to use different nonces")
+	}
+
+	rotated, err := pii.New(map[int][]byte{1: key(1), 2: key(2)}, 2, indexKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := rotated.Decrypt(sealed); err != nil || got != "ada@example.com" {
+		t.Fatalf("expected the old key to still decrypt; got %q, %v", got, err)
+	}
+	if rotated.Current(sealed) {
+		t.Error("expected a value under the old key not to be current")
+	}
+	resealed, _ := rotated.Encrypt("ada@example.com")
+	if !rotated.Current(resealed) {
+		t.Errorf("expected %s to be under the current key", resealed)
+	}
+	if _, err := old.Decrypt(resealed); !errors.Is(err, pii.ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey for a newer key; got %v", err)
+	}
+	if got, err := old.Decrypt("ada@example.com"); err != nil || got != "ada@example.com" {
+		t.Errorf("expected plaintext to pass through; got %q, %v", got, err)
+	}
+
+	if old.BlindIndex("ada@example.com") != rotated.BlindIndex("ada@example.com") {
+		t.Error("expected blind indexes to survive a key rotation")
+	}
+	if old.BlindIndex("ada@example.com") == old.BlindIndex("bob@example.com") {
+		t.Error("expected different values to have different blind indexes")
+	}
+}
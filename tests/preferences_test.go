@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/validator"
+)
+
+// prefsService knows the preferences of user-1 and exports its data.
+type prefsService struct {
+	database.Service
+	prefs models.Preferences
+}
+
+func (s *prefsService) GetPreferences(ctx context.Context, userID string) (*models.Preferences, error) {
+	if userID != "user-1" {
+		return nil, sql.ErrNoRows
+	}
+	prefs := s.prefs
+	return &prefs, nil
+}
+
+func (s *prefsService) UpdatePreferences(ctx context.Context, userID string, updates models.PreferencesUpdate) (*models.Preferences, error) {
+	if updates.Theme != nil {
+		s.prefs.Theme = *updates.Theme
+	}
+	return s.GetPreferences(ctx, userID)
+}
+
+func (s *prefsService) ExportUserData(ctx context.Context, id string) (*models.UserExport, error) {
+	if id != "user-1" {
+		return nil, sql.ErrNoRows
+	}
+	prefs := s.prefs
+	return &models.UserExport{User: &models.User{ID: id}, Preferences: &prefs, Metadata: models.Metadata{}}, nil
+}
+
+func TestPreferencesRequests(t *testing.T) {
+	db := &prefsService{prefs: models.DefaultPreferences()}
+	h := testServer(t, db)
+
+	if rec := request(h, http.MethodGet, "/api/v1/users/user-2/preferences", "", asAdmin...); rec.Code != http.StatusNotFound {
+		t.Errorf("preferences of an unknown user: %d; want 404", rec.Code)
+	}
+	rec := request(h, http.MethodPatch, "/api/v1/users/user-1/preferences", `{"theme":"neon"}`, asAdmin...)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid theme: %d %s; want 400", rec.Code, rec.Body)
+	}
+	var problem struct {
+		Errors []validator.ValidationError `json:"errors"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "theme" || problem.Errors[0].Code != validator.CodeThemeInvalid {
+		t.Errorf("errors = %+v; want THEME_INVALID at theme", problem.Errors)
+	}
+
+	rec = request(h, http.MethodPatch, "/api/v1/users/user-1/preferences", `{"theme":"dark"}`, asAdmin...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("valid update: %d %s; want 200", rec.Code, rec.Body)
+	}
+	var prefs models.Preferences
+	if err := json.NewDecoder(rec.Body).Decode(&prefs); err != nil {
+		t.Fatal(err)
+	}
+	if prefs.Theme != models.ThemeDark || !prefs.SecurityAlerts {
+		t.Errorf("preferences = %+v; want the dark theme and the other defaults", prefs)
+	}
+}
+
+func TestExportUserRequests(t *testing.T) {
+	h := testServer(t, &prefsService{prefs: models.DefaultPreferences()})
+	if rec := request(h, http.MethodGet, "/api/v1/admin/users/user-2/export", "", asAdmin...); rec.Code != http.StatusNotFound {
+		t.Errorf("exporting an unknown user: %d; want 404", rec.Code)
+	}
+	rec := request(h, http.MethodGet, "/api/v1/admin/users/user-1/export", "", asAdmin...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: %d %s; want 200", rec.Code, rec.Body)
+	}
+	if got, want := rec.Header().Get("Content-Disposition"), `attachment; filename="user-user-1.json"`; got != want {
+		t.Errorf("Content-Disposition = %q; want %q", got, want)
+	}
+	var export models.UserExport
+	if err := json.NewDecoder(rec.Body).Decode(&export); err != nil {
+		t.Fatal(err)
+	}
+	if export.User == nil || export.User.ID != "user-1" || export.Preferences == nil {
+		t.Errorf("export = %+v; want user-1 with preferences", export)
+	}
+}
+
+func TestPreferences(t *testing.T) {
+	db, ctx := testDB(t)
+	user, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefs, err := db.GetPreferences(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := models.DefaultPreferences()
+	if *prefs != def {
+		t.Errorf("preferences of a new user = %+v; want the defaults %+v", prefs, def)
+	}
+
+	off, dark := false, models.ThemeDark
+	if _, err := db.UpdatePreferences(ctx, user.ID, models.PreferencesUpdate{EmailNotifications: &off}); err != nil {
+		t.Fatal(err)
+	}
+	prefs, err = db.UpdatePreferences(ctx, user.ID, models.PreferencesUpdate{Theme: &dark})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefs.EmailNotifications || prefs.Theme != dark || !prefs.SecurityAlerts || prefs.UpdatedAt == nil {
+		t.Errorf("preferences = %+v; want notifications off and the dark theme kept together", prefs)
+	}
+
+	if _, err := db.GetPreferences(ctx, "no-such-user"); err != sql.ErrNoRows {
+		t.Errorf("preferences of an unknown user: %v; want sql.ErrNoRows", err)
+	}
+	if _, err := db.UpdatePreferences(ctx, "no-such-user", models.PreferencesUpdate{Theme: &dark}); err != sql.ErrNoRows {
+		t.Errorf("updating the preferences of an unknown user: %v; want sql.ErrNoRows", err)
+	}
+}
+
+func TestExportUserData(t *testing.T) {
+	db, ctx := testDB(t)
+	user, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dark := models.ThemeDark
+	if _, err := db.UpdatePreferences(ctx, user.ID, models.PreferencesUpdate{Theme: &dark}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RecordConsent(ctx, &models.Consent{UserID: user.ID, Kind: models.ConsentMarketing, Granted: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	export, err := db.ExportUserData(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if export.User.ID != user.ID || export.User.Email != user.Email {
+		t.Errorf("exported user = %+v; want %s", export.User, user.Email)
+	}
+	if export.Preferences.Theme != dark {
+		t.Errorf("exported preferences = %+v; want the dark theme", export.Preferences)
+	}
+	if len(export.Consents) != 1 || export.Consents[0].Kind != models.ConsentMarketing {
+		t.Errorf("exported consents = %+v; want the marketing consent", export.Consents)
+	}
+	if export.Identities == nil || export.AuditEntries == nil {
+		t.Errorf("export lists no identities or audit entries rather than empty ones: %+v", export)
+	}
+
+	if _, err := db.ExportUserData(ctx, "no-such-user"); err != sql.ErrNoRows {
+		t.Errorf("exporting an unknown user: %v; want sql.ErrNoRows", err)
+	}
+}
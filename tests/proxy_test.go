@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"users/internal/proxy"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	trusted, err := proxy.Parse("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name, peer, forwardedFor, realIP, want string
+	}{
+		{"untrusted peer", "203.0.113.7:4000", "198.51.100.1", "", "203.0.113.7"},
+		{"trusted peer", "10.1.2.3:4000", "198.51.100.1", "", "198.51.100.1"},
+		{"spoofed entries", "10.1.2.3:4000", "1.2.3.4, 198.51.100.1, 192.168.1.1", "", "198.51.100.1"},
+		{"malformed entry", "10.1.2.3:4000", "198.51.100.1, bogus, 10.0.0.9", "", "10.0.0.9"},
+		{"entry with port", "10.1.2.3:4000", "198.51.100.1:5555", "", "198.51.100.1"},
+		{"real ip", "192.168.1.1:4000", "", "198.51.100.2", "198.51.100.2"},
+		{"real ip from untrusted peer", "203.0.113.7:4000", "", "198.51.100.2", "203.0.113.7"},
+		{"no headers", "10.1.2.3:4000", "", "", "10.1.2.3"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tc.peer
+			if tc.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+			if tc.realIP != "" {
+				r.Header.Set("X-Real-IP", tc.realIP)
+			}
+			if got := trusted.Resolve(r); got != tc.want {
+				t.Errorf("expected %s; got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsGarbage(t *testing.T) {
+	if _, err := proxy.Parse("10.0.0.0/8,proxy.internal"); err == nil {
+		t.Fatal("expected an error for a host name")
+	}
+}
@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"users/internal/models"
+	"users/internal/purge"
+)
+
+func TestScheduleNext(t *testing.T) {
+	from := time.Date(2026, 3, 14, 10, 30, 0, 0, time.UTC) // a Saturday
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"0 3 * * *", time.Date(2026, 3, 15, 3, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 3, 14, 10, 45, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2026, 3, 15, 10, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2026, 3, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := purge.ParseSchedule(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q): %v", tt.spec, err)
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: Next = %v; want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 5-2 * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := purge.ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded; want an error", spec)
+		}
+	}
+}
+
+func TestRetentionPolicies(t *testing.T) {
+	due := int64(5)
+	var batches []int64
+	policy := purge.Policy{
+		Class:        "audit_log",
+		Retention:    90 * 24 * time.Hour,
+		MinRetention: 30 * 24 * time.Hour,
+		Purge: func(ctx context.Context, before time.Time, limit int64, dryRun bool) (int64, error) {
+			if dryRun {
+				return due, nil
+			}
+			n := due
+			if limit > 0 {
+				n = min(due, limit)
+			}
+			due -= n
+			batches = append(batches, n)
+			return n, nil
+		},
+	}
+	forever := purge.Policy{Class: "tombstones", MinRetention: 24 * time.Hour, Purge: policy.Purge}
+
+	s, err := purge.NewScheduler(purge.Schedule{}, []purge.Policy{policy, forever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Jobs) != 1 || s.Jobs[0].Name != "audit_log" {
+		t.Fatalf("Jobs = %+v; want only audit_log", s.Jobs)
+	}
+
+	var runs []models.PurgeRun
+	s.Report = func(ctx context.Context, run models.PurgeRun) error {
+		runs = append(runs, run)
+		return nil
+	}
+	s.MaxRows = 2
+	if err := s.RunJob(context.Background(), "audit_log"); err != nil {
+		t.Fatalf("RunJob over MaxRows = %v", err)
+	}
+	if !slices.Equal(batches, []int64{2, 2, 1}) || due != 0 {
+		t.Fatalf("batches = %v, %d rows left; want [2 2 1], none left", batches, due)
+	}
+	if len(runs) != 1 || runs[0].Rows != 5 || runs[0].Error != "" {
+		t.Fatalf("reported runs = %+v", runs)
+	}
+
+	policy.Retention = 7 * 24 * time.Hour
+	if _, err := purge.NewScheduler(purge.Schedule{}, []purge.Policy{policy}); err == nil {
+		t.Fatal("NewScheduler accepted a retention below the minimum")
+	}
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"users/internal/database"
+)
+
+func TestEnforceQuotaAtTheLimit(t *testing.T) {
+	db, ctx := testDB(t)
+	if _, err := db.SetQuota(ctx, database.QuotaUsers, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := db.CreateUser(ctx, testUser("Ada")); err != nil {
+			t.Fatalf("user %d of a quota of 2: %v", i+1, err)
+		}
+	}
+	_, err := db.CreateUser(ctx, testUser("Ada"))
+	var quotaErr *database.QuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.Quota != database.QuotaUsers || quotaErr.Limit != 2 {
+		t.Fatalf("user 3 of a quota of 2: %v; want a users quota error of 2", err)
+	}
+
+	// Lifting the quota admits the user again
+	if _, err := db.SetQuota(ctx, database.QuotaUsers, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreateUser(ctx, testUser("Ada")); err != nil {
+		t.Fatalf("user 3 without a quota: %v", err)
+	}
+}
+
+func TestEnforceQuotaUnderConcurrentCreates(t *testing.T) {
+	db, ctx := testDB(t)
+	const limit, attempts = 3, 12
+	if _, err := db.SetQuota(ctx, database.QuotaUsers, limit); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, attempts)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = db.CreateUser(ctx, testUser("Ada"))
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, database.ErrQuotaExceeded):
+			t.Errorf("concurrent create: %v", err)
+		}
+	}
+	if created != limit {
+		t.Errorf("%d concurrent creates under a quota of %d created %d users", attempts, limit, created)
+	}
+	quotas, err := db.ListQuotas(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range quotas {
+		if q.Name == database.QuotaUsers && (q.Used == nil || *q.Used != limit) {
+			t.Errorf("users quota used %v; want %d", q.Used, limit)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"users/internal/redact"
+)
+
+func TestRedact(t *testing.T) {
+	rules := redact.New(append(redact.DefaultRules, "ssn")...)
+
+	q := url.Values{"status": {"active"}, "email": {"ada@example.com"}, "reset_token": {"abc"}, "note": {"mail ada@example.com"}}
+	got := rules.Query(q)
+	for _, leak := range []string{"ada@example.com", "abc"} {
+		if strings.Contains(got, leak) {
+			t.Errorf("expected %q to be redacted from %s", leak, got)
+		}
+	}
+	if !strings.Contains(got, "status=active") {
+		t.Errorf("expected status to be kept in %s", got)
+	}
+
+	body := `{"first_name":"Ada","age":36,"SSN":"123","tags":["vip"],"groups":[{"name":"x","id":"g1"}],"bio":"write to ada@example.com"}`
+	got = string(rules.JSON([]byte(body)))
+	for _, leak := range []string{"Ada", "123", `"x"`, "ada@example.com"} {
+		if strings.Contains(got, leak) {
+			t.Errorf("expected %s to be redacted from %s", leak, got)
+		}
+	}
+	for _, kept := range []string{`"age":36`, `"vip"`, `"g1"`} {
+		if !strings.Contains(got, kept) {
+			t.Errorf("expected %s to be kept in %s", kept, got)
+		}
+	}
+	if got := string(rules.JSON([]byte("not json ada"))); got != redact.Placeholder {
+		t.Errorf("expected a body that is not JSON to be redacted whole; got %s", got)
+	}
+}
+
+func TestRedactURIs(t *testing.T) {
+	rules := redact.New(redact.DefaultRules...)
+	uri := "otpauth://totp/users:ada%40example.com?secret=JBSWY3DPEHPK3PXP&issuer=users"
+
+	body := `{"secret":"JBSWY3DPEHPK3PXP","provisioning_uri":"` + uri + `","note":"scan ` + uri + `"}`
+	got := string(rules.JSON([]byte(body)))
+	for _, leak := range []string{"JBSWY3DPEHPK3PXP", "ada%40example.com"} {
+		if strings.Contains(got, leak) {
+			t.Errorf("expected %s to be redacted from %s", leak, got)
+		}
+	}
+
+	// Parameters of URLs in free text are redacted by name
+	got = rules.String("see https://example.com/reset?token=abc&lang=en")
+	if strings.Contains(got, "abc") || !strings.Contains(got, "lang=en") {
+		t.Errorf("expected only the token to be redacted from %s", got)
+	}
+}
@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"users/internal/database"
+	"users/internal/server"
+)
+
+func TestReloadSwapsValidSettingsOnly(t *testing.T) {
+	t.Setenv("JSON_UNKNOWN_FIELDS", "reject")
+	s, err := server.New(struct{ database.Service }{}, server.WithAdminToken(testAdminToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.RegisterRoutes()
+	const body = `{"frist_name": "Ada"}`
+	rejected := func() bool {
+		rec := request(h, http.MethodPost, "/api/v1/users", body, asAdmin...)
+		return strings.Contains(rec.Body.String(), "frist_name")
+	}
+	if !rejected() {
+		t.Fatal("expected the unknown field to be rejected")
+	}
+
+	t.Setenv("JSON_UNKNOWN_FIELDS", "sometimes")
+	if err := s.Reload(); err == nil {
+		t.Fatal("expected an invalid setting to fail the reload")
+	}
+	if !rejected() {
+		t.Fatal("expected a failed reload to keep the running settings")
+	}
+
+	t.Setenv("JSON_UNKNOWN_FIELDS", "ignore")
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if rejected() {
+		t.Fatal("expected the reloaded setting to ignore the unknown field")
+	}
+}
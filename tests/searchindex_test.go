@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"users/internal/models"
+	"users/internal/searchindex"
+)
+
+func TestSearchIndexApply(t *testing.T) {
+	var created, bulk string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/_alias/people":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPut:
+			created = string(body)
+			w.Write([]byte(`{"acknowledged":true}`))
+		case r.URL.Path == "/_bulk":
+			bulk = string(body)
+			w.Write([]byte(`{"errors":true,"items":[{"index":{"_id":"1","status":201}},{"delete":{"_id":"2","status":404}}]}`))
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("SEARCH_INDEX_URL", srv.URL)
+	t.Setenv("SEARCH_INDEX_NAME", "people")
+	index := searchindex.FromEnv()
+
+	batch := models.FeedBatch{
+		Users:   []models.TenantUser{{TenantID: "acme", User: models.User{ID: "1", FirstName: "Ada", Email: "ada@example.com"}}},
+		Deleted: []string{"2"},
+	}
+	if err := index.Apply(context.Background(), batch); err != nil {
+		t.Fatalf("expected a missing document's delete to be ignored; got %v", err)
+	}
+	if !strings.Contains(created, `"people":{}`) {
+		t.Fatalf("expected the first index to be created behind the alias; got %s", created)
+	}
+	lines := strings.Split(strings.TrimSpace(bulk), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], `"tenant_id":"acme"`) || !strings.Contains(lines[2], `"delete"`) {
+		t.Fatalf("unexpected bulk request %s", bulk)
+	}
+}
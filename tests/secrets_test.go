@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"users/internal/secrets"
+)
+
+func TestVaultCredentialsCache(t *testing.T) {
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/users-db" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		fetches++
+		fmt.Fprintf(w, `{"data":{"data":{"username":"app","password":"pw%d"},"metadata":{}}}`, fetches)
+	}))
+	defer server.Close()
+
+	cache := &secrets.Cache{
+		Provider: &secrets.Vault{Addr: server.URL, Token: "token", Path: "secret/data/users-db", Client: server.Client()},
+		TTL:      time.Hour,
+	}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		creds, err := cache.Credentials(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds.Username != "app" || creds.Password != "pw1" {
+			t.Fatalf("expected the cached credentials app/pw1; got %s/%s", creds.Username, creds.Password)
+		}
+	}
+
+	cache.Invalidate()
+	creds, err := cache.Credentials(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.Password != "pw2" {
+		t.Fatalf("expected rotated password pw2 after invalidation; got %s", creds.Password)
+	}
+}
+
+func TestAWSSecretsManagerCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" {
+			t.Errorf("unexpected target %q", r.Header.Get("X-Amz-Target"))
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/eu-west-1/secretsmanager/aws4_request") {
+			t.Errorf("expected a SigV4 authorization header; got %q", auth)
+		}
+		if r.Header.Get("X-Amz-Security-Token") != "session" {
+			t.Errorf("expected the session token to be sent")
+		}
+		fmt.Fprint(w, `{"SecretString":"{\"username\":\"app\",\"password\":\"s3cret\"}"}`)
+	}))
+	defer server.Close()
+
+	provider := &secrets.AWSSecretsManager{
+		Region:          "eu-west-1",
+		SecretID:        "users-db",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		SessionToken:    "session",
+		Endpoint:        server.URL,
+		Client:          server.Client(),
+	}
+	creds, err := provider.Credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.Username != "app" || creds.Password != "s3cret" {
+		t.Fatalf("expected app/s3cret; got %s/%s", creds.Username, creds.Password)
+	}
+}
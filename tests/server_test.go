@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"users/internal/database"
+	"users/internal/server"
+)
+
+// testAdminToken is the ADMIN_TOKEN of the servers the tests build.
+const testAdminToken = "test-admin-token"
+
+// testServer returns the routes of a server answering from db, with
+// testAdminToken as its admin token unless opts replace it.
+func testServer(t *testing.T, db database.Service, opts ...server.Option) http.Handler {
+	t.Helper()
+	s, err := server.New(db, append([]server.Option{server.WithAdminToken(testAdminToken)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.RegisterRoutes()
+}
+
+// request sends a request with body to h, setting headers given as name
+// and value pairs, and returns the response.
+func request(h http.Handler, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// asAdmin are the headers of a request made with the operator's token.
+var asAdmin = []string{"Authorization", "Bearer " + testAdminToken}
@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"users/internal/session"
+)
+
+func TestSessionLifecycle(t *testing.T) {
+	m := &session.Manager{Store: session.NewMemoryStore(), TTL: time.Hour, CookieName: "session"}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	started, err := m.Start(context.Background(), rec, req, "default", "user-1")
+	if err != nil {
+		t.Fatalf("error starting session. Err: %v", err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value == "" {
+		t.Fatalf("expected a session cookie; got %v", cookies)
+	}
+	if cookies[0].Value == started.ID {
+		t.Errorf("expected the cookie token to differ from the public session id")
+	}
+
+	var seen *session.Session
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = session.FromContext(r.Context())
+	}))
+
+	req = httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(cookies[0])
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if seen == nil || seen.ID != started.ID || seen.UserID != "user-1" {
+		t.Fatalf("expected the session to be resolved; got %v", seen)
+	}
+
+	list, err := m.Store.ListByUser(context.Background(), "default", "user-1")
+	if err != nil || len(list) != 1 {
+		t.Fatalf("expected one active session; got %v (err %v)", list, err)
+	}
+
+	if err := m.Store.DeleteByUser(context.Background(), "default", "user-1"); err != nil {
+		t.Fatalf("error revoking sessions. Err: %v", err)
+	}
+	seen = nil
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if seen != nil {
+		t.Errorf("expected revoked session to be rejected")
+	}
+}
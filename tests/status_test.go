@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/server"
+	"users/internal/session"
+	"users/internal/tenant"
+)
+
+// statusService knows every user as having status.
+type statusService struct {
+	database.Service
+	status models.UserStatus
+}
+
+func (s *statusService) GetUserByID(ctx context.Context, id string, fields ...string) (*models.User, error) {
+	return &models.User{ID: id, Status: s.status}, nil
+}
+
+// statusLogin is a loginService whose user has status.
+type statusLogin struct {
+	*loginService
+	status models.UserStatus
+}
+
+func (s *statusLogin) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	user, err := s.loginService.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	user.Status = s.status
+	return user, nil
+}
+
+// startSession starts a session of the user in store and returns the
+// cookie header sending it.
+func startSession(t *testing.T, store session.Store, tenantID, userID string) []string {
+	t.Helper()
+	m := &session.Manager{Store: store, TTL: time.Hour, CookieName: "session"}
+	rec := httptest.NewRecorder()
+	if _, err := m.Start(context.Background(), rec, httptest.NewRequest(http.MethodPost, "/login", nil), tenantID, userID); err != nil {
+		t.Fatal(err)
+	}
+	cookie := rec.Result().Cookies()[0]
+	return []string{"Cookie", cookie.Name + "=" + cookie.Value}
+}
+
+func TestStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from, to models.UserStatus
+		want     bool
+	}{
+		{models.StatusPending, models.StatusActive, true},
+		{models.StatusPending, models.StatusSuspended, true},
+		{models.StatusActive, models.StatusSuspended, true},
+		{models.StatusSuspended, models.StatusActive, true},
+		{models.StatusActive, models.StatusActive, false},
+		{models.StatusSuspended, models.StatusSuspended, false},
+		{models.StatusActive, models.StatusPending, false},
+		{models.StatusMerged, models.StatusActive, false},
+		{models.StatusActive, models.StatusMerged, false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.CanTransitionTo(tt.to); got != tt.want {
+			t.Errorf("%s -> %s allowed = %v; want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestSuspendedUsersCannotLogIn(t *testing.T) {
+	for _, status := range []models.UserStatus{models.StatusSuspended, models.StatusMerged} {
+		h := testServer(t, &statusLogin{newLoginService(t, 0), status})
+		rec := request(h, http.MethodPost, "/api/v1/login", `{"email": "ada@example.com", "password": "`+testPassword+`"}`)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("login of a %s user: %d %s; want 403", status, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestSessionsOfSuspendedUsersAreRejected(t *testing.T) {
+	for _, status := range []models.UserStatus{models.StatusSuspended, models.StatusMerged} {
+		store := session.NewMemoryStore()
+		h := testServer(t, &statusService{status: status}, server.WithSessionStore(store))
+		cookie := startSession(t, store, "default", "user-1")
+		if rec := request(h, http.MethodGet, "/api/v1/me", "", cookie...); rec.Code != http.StatusForbidden {
+			t.Errorf("session of a %s user: %d %s; want 403", status, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestSuspendAndActivateUser(t *testing.T) {
+	db, ctx := testDB(t)
+	user, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ActivateUser(ctx, user.ID); err != database.ErrInvalidTransition {
+		t.Errorf("activating an active user: %v; want ErrInvalidTransition", err)
+	}
+	if _, err := db.SuspendUser(ctx, "no-such-user"); err != sql.ErrNoRows {
+		t.Errorf("suspending an unknown user: %v; want sql.ErrNoRows", err)
+	}
+
+	store := session.NewMemoryStore()
+	h := testServer(t, db, server.WithSessionStore(store))
+	startSession(t, store, tenant.FromContext(ctx), user.ID)
+	headers := append(asAdmin, "X-Tenant-ID", tenant.FromContext(ctx))
+
+	rec := request(h, http.MethodPost, "/api/v1/admin/users/"+user.ID+"/suspend", "", headers...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("suspend: %d %s; want 200", rec.Code, rec.Body)
+	}
+	got, err := db.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.StatusSuspended || got.Version != user.Version+1 {
+		t.Errorf("after suspending: status %s version %d; want suspended version %d", got.Status, got.Version, user.Version+1)
+	}
+	if sessions, err := store.ListByUser(ctx, tenant.FromContext(ctx), user.ID); err != nil || len(sessions) != 0 {
+		t.Errorf("sessions after suspending: %v (err %v); want none", sessions, err)
+	}
+	if rec := request(h, http.MethodPost, "/api/v1/admin/users/"+user.ID+"/suspend", "", headers...); rec.Code != http.StatusConflict {
+		t.Errorf("suspending again: %d %s; want 409", rec.Code, rec.Body)
+	}
+
+	if rec := request(h, http.MethodPost, "/api/v1/admin/users/"+user.ID+"/activate", "", headers...); rec.Code != http.StatusOK {
+		t.Fatalf("activate: %d %s; want 200", rec.Code, rec.Body)
+	}
+	if got, err = db.GetUserByID(ctx, user.ID); err != nil || got.Status != models.StatusActive {
+		t.Errorf("after activating: %v (err %v); want active", got, err)
+	}
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"users/internal/awsv4"
+	"users/internal/storage"
+)
+
+func TestLocalStorageRoundTrip(t *testing.T) {
+	store := &storage.Local{Dir: t.TempDir()}
+	ctx := context.Background()
+
+	body := "id,email\n1,ada@example.com\n"
+	if err := store.Put(ctx, "exports/acme/1.csv", strings.NewReader(body), int64(len(body))); err != nil {
+		t.Fatal(err)
+	}
+	f, err := store.Open(ctx, "exports/acme/1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(f)
+	f.Close()
+	if string(got) != body {
+		t.Fatalf("read %q, want %q", got, body)
+	}
+
+	if err := store.Delete(ctx, "exports/acme/1.csv"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Open(ctx, "exports/acme/1.csv"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("open after delete: %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "exports/acme/1.csv"); err != nil {
+		t.Fatalf("deleting a missing file: %v", err)
+	}
+}
+
+func TestLocalStorageRejectsKeysOutsideDir(t *testing.T) {
+	store := &storage.Local{Dir: t.TempDir()}
+	err := store.Put(context.Background(), "../escape.csv", strings.NewReader("x"), 1)
+	if err == nil {
+		t.Fatal("expected an error for a key leaving the directory")
+	}
+}
+
+func TestS3StorageSignsUnsignedPayload(t *testing.T) {
+	var got *http.Request
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer srv.Close()
+
+	store := &storage.S3{
+		Bucket:   "exports",
+		Endpoint: srv.URL,
+		Signer:   awsv4.Signer{Region: "eu-west-1", Service: "s3", AccessKeyID: "AKID", SecretAccessKey: "secret"},
+		Client:   srv.Client(),
+	}
+	if err := store.Put(context.Background(), "exports/acme/1.ndjson", strings.NewReader("{}\n"), 3); err != nil {
+		t.Fatal(err)
+	}
+	if got.Method != http.MethodPut || got.URL.Path != "/exports/exports/acme/1.ndjson" || body != "{}\n" {
+		t.Fatalf("got %s %s with %q", got.Method, got.URL.Path, body)
+	}
+	if got.Header.Get("X-Amz-Content-Sha256") != "UNSIGNED-PAYLOAD" {
+		t.Fatalf("X-Amz-Content-Sha256 = %q", got.Header.Get("X-Amz-Content-Sha256"))
+	}
+	if auth := got.Header.Get("Authorization"); !strings.Contains(auth, "x-amz-content-sha256") {
+		t.Fatalf("content hash not signed: %s", auth)
+	}
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/validator"
+)
+
+// tagService tags its one user, refusing to go past full tags.
+type tagService struct {
+	database.Service
+	full bool
+}
+
+func (s *tagService) AddUserTags(ctx context.Context, id string, tags []string) (*models.User, error) {
+	if s.full {
+		return nil, database.ErrTooManyTags
+	}
+	return &models.User{ID: id, Tags: tags}, nil
+}
+
+func TestTagRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		full bool
+		want int
+	}{
+		{"valid", "/api/v1/users/user-1/tags/beta", false, http.StatusOK},
+		{"invalid", "/api/v1/users/user-1/tags/-beta", false, http.StatusBadRequest},
+		{"too many", "/api/v1/users/user-1/tags/beta", true, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		h := testServer(t, &tagService{full: tt.full})
+		rec := request(h, http.MethodPut, tt.path, "", asAdmin...)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d %s; want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+		if rec.Code != http.StatusBadRequest {
+			continue
+		}
+		var problem struct {
+			Errors []validator.ValidationError `json:"errors"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+			t.Fatal(err)
+		}
+		if len(problem.Errors) != 1 || problem.Errors[0].Field != "tag" || problem.Errors[0].Code != validator.CodeTagInvalid {
+			t.Errorf("%s: errors = %+v; want TAG_INVALID at tag", tt.name, problem.Errors)
+		}
+	}
+}
+
+func TestTagFiltersMustBeValid(t *testing.T) {
+	h := testServer(t, &tagService{})
+	for _, query := range []string{"tags_any=beta,no%20spaces", "tags_all=" + strings.Repeat("a", 33)} {
+		if rec := request(h, http.MethodGet, "/api/v1/users?"+query, "", asAdmin...); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d; want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestTagUsers(t *testing.T) {
+	db, ctx := testDB(t)
+	user, err := db.CreateUser(ctx, testUser("Ada"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagged, err := db.AddUserTags(ctx, user.ID, []string{"VIP", "beta", "vip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"beta", "vip"}; !slices.Equal(tagged.Tags, want) || tagged.Version != user.Version+1 {
+		t.Errorf("tags = %v at version %d; want %v at %d", tagged.Tags, tagged.Version, want, user.Version+1)
+	}
+	untagged, err := db.RemoveUserTags(ctx, user.ID, []string{"beta", "unknown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"vip"}; !slices.Equal(untagged.Tags, want) {
+		t.Errorf("tags after removing = %v; want %v", untagged.Tags, want)
+	}
+
+	many := make([]string, database.MaxUserTags)
+	for i := range many {
+		many[i] = "tag-" + string(rune('a'+i/26)) + string(rune('a'+i%26))
+	}
+	if _, err := db.AddUserTags(ctx, user.ID, many); err != database.ErrTooManyTags {
+		t.Errorf("tagging past the maximum: %v; want ErrTooManyTags", err)
+	}
+	if _, err := db.AddUserTags(ctx, "no-such-user", []string{"beta"}); err == nil {
+		t.Error("tagging an unknown user succeeded")
+	}
+}
+
+func TestListUsersByTags(t *testing.T) {
+	db, ctx := testDB(t)
+	tags := map[string][]string{"Ada": {"beta", "vip"}, "Grace": {"beta"}, "Linus": nil}
+	ids := map[string]string{}
+	for name, tagged := range tags {
+		user, err := db.CreateUser(ctx, testUser(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[user.ID] = name
+		if len(tagged) > 0 {
+			if _, err := db.AddUserTags(ctx, user.ID, tagged); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter database.UserFilter
+		want   []string
+	}{
+		{"any", database.UserFilter{TagsAny: []string{"vip", "beta"}}, []string{"Ada", "Grace"}},
+		{"all", database.UserFilter{TagsAll: []string{"vip", "beta"}}, []string{"Ada"}},
+		{"any and all", database.UserFilter{TagsAny: []string{"beta"}, TagsAll: []string{"VIP"}}, []string{"Ada"}},
+		{"none carry it", database.UserFilter{TagsAny: []string{"staff"}}, nil},
+	}
+	for _, tt := range tests {
+		users, err := db.ListUsers(ctx, tt.filter, database.Page{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, u := range users {
+			got = append(got, ids[u.ID])
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: listed %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
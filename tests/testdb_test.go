@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"users/internal/database"
+	"users/internal/models"
+	"users/internal/tenant"
+)
+
+// The database tests run against the database in TEST_DATABASE_URL, which
+// they migrate and write to; they are skipped when it is not set. Point
+// it at a throwaway database.
+
+// testSeq keeps emails unique across the users the tests create.
+var testSeq atomic.Int64
+
+// testDB returns the service of the test database and a context scoped to
+// a tenant of the test's own, so tests do not see each other's rows.
+func testDB(t *testing.T, opts ...database.Option) (database.Service, context.Context) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	opts = append([]database.Option{database.WithDSN(dsn), database.WithLogger(log.New(io.Discard, "", 0))}, opts...)
+	db, err := database.New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db, tenant.WithTenant(context.Background(), fmt.Sprintf("test-%d", time.Now().UnixNano()))
+}
+
+// testUser returns a new user with a unique email.
+func testUser(first string) *models.User {
+	n := testSeq.Add(1)
+	return &models.User{FirstName: first, LastName: "Test", Age: 30, Email: fmt.Sprintf("test.%d@example.com", n)}
+}
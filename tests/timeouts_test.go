@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"users/internal/database"
+	"users/internal/models"
+)
+
+func TestAuditExportsOutliveTheTimeouts(t *testing.T) {
+	t.Setenv("DB_QUERY_TIMEOUT", "20ms")
+	t.Setenv("DB_STATEMENT_TIMEOUT", "100ms")
+	faults := &database.Faults{Latency: 100 * time.Millisecond, LatencyRate: 1, Operations: []string{"QueryAudit"}}
+	db, ctx := testDB(t, database.WithFaultInjection(faults))
+	// One more than a batch
+	const entries = 1001
+	for i := 0; i < entries; i++ {
+		if err := db.RecordAudit(ctx, &models.AuditEntry{Actor: "admin", Action: models.AuditUserSuspended}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A client reading slower than both timeouts still gets every entry
+	seen := map[int64]bool{}
+	err := db.EachAuditEntry(ctx, database.AuditFilter{}, func(e models.AuditEntry) error {
+		if len(seen)%1000 == 0 {
+			time.Sleep(150 * time.Millisecond)
+		}
+		if seen[e.ID] {
+			return fmt.Errorf("entry %d seen twice", e.ID)
+		}
+		seen[e.ID] = true
+		return nil
+	})
+	if err != nil {
+		t.Errorf("export cut short: %v", err)
+	}
+	if len(seen) != entries {
+		t.Errorf("exported %d entries; want %d", len(seen), entries)
+	}
+	if _, err := db.QueryAudit(ctx, database.AuditFilter{}, database.Page{Limit: 10}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected listing the audit log to hit the query timeout; got %v", err)
+	}
+}
+
+func TestOperationTimeouts(t *testing.T) {
+	tests := []struct {
+		name       string
+		operations string
+		wantErr    bool
+	}{
+		{"default", "", true},
+		{"longer", "GetUserByID=1s", false},
+		{"disabled", "GetUserByID=0", false},
+		{"shorter", "CreateUser=1s, GetUserByID=5ms", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DB_QUERY_TIMEOUT", "20ms")
+			t.Setenv("DB_OPERATION_TIMEOUTS", tt.operations)
+			faults := &database.Faults{Latency: 50 * time.Millisecond, LatencyRate: 1, Operations: []string{"GetUserByID"}}
+			db, ctx := testDB(t, database.WithFaultInjection(faults))
+			user, err := db.CreateUser(ctx, testUser("Ada"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.GetUserByID(ctx, user.ID)
+			if got := errors.Is(err, context.DeadlineExceeded); got != tt.wantErr {
+				t.Errorf("GetUserByID: %v; want timing out %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInvalidTimeoutsAreRefused(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	for _, env := range [][2]string{
+		{"DB_QUERY_TIMEOUT", "soon"},
+		{"DB_QUERY_TIMEOUT", "-1s"},
+		{"DB_OPERATION_TIMEOUTS", "GetUserByID"},
+		{"DB_OPERATION_TIMEOUTS", "GetUserByID=-5s"},
+		{"DB_STATEMENT_TIMEOUT", "-1s"},
+	} {
+		t.Run(env[0]+"="+env[1], func(t *testing.T) {
+			t.Setenv(env[0], env[1])
+			db, err := database.New(database.WithDSN(dsn), database.WithLogger(log.New(io.Discard, "", 0)))
+			if err == nil {
+				db.Close()
+				t.Errorf("New accepted %s=%s", env[0], env[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+	"users/internal/totp"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range cases {
+		code, err := totp.Code(secret, totp.Step(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("unexpected error. Err: %v", err)
+		}
+		if code != expected {
+			t.Errorf("at %d expected %s; got %s", unix, expected, code)
+		}
+	}
+}
+
+func TestTOTPValidate(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatalf("error generating secret. Err: %v", err)
+	}
+	now := time.Now()
+
+	previous, _ := totp.Code(secret, totp.Step(now)-1)
+	if _, ok := totp.Validate(secret, previous, now); !ok {
+		t.Errorf("expected code of the previous period to be accepted")
+	}
+	stale, _ := totp.Code(secret, totp.Step(now)-3)
+	if _, ok := totp.Validate(secret, stale, now); ok {
+		t.Errorf("expected stale code to be rejected")
+	}
+
+	uri := totp.ProvisioningURI("users", "jane@example.com", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("unexpected provisioning uri %s", uri)
+	}
+}
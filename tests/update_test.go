@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"users/internal/database"
+	"users/internal/models"
+)
+
+func TestUpdateSet(t *testing.T) {
+	first, last, username, locale, timezone, email := "Ada", "Lovelace", "ada", "en-GB", "Europe/London", " Ada@Example.com "
+	age := uint(36)
+
+	// Every field in the order the clause assigns it, with the assignment
+	// and parameter it must produce.
+	fields := []struct {
+		set    func(*models.UserUpdate)
+		assign string
+		param  any
+	}{
+		{func(u *models.UserUpdate) { u.FirstName = &first }, "first_name = $%d", first},
+		{func(u *models.UserUpdate) { u.LastName = &last }, "last_name = $%d", last},
+		{func(u *models.UserUpdate) { u.Username = &username }, "username = NULLIF($%d, '')", username},
+		{func(u *models.UserUpdate) { u.Locale = &locale }, "locale = NULLIF($%d, '')", locale},
+		{func(u *models.UserUpdate) { u.Timezone = &timezone }, "timezone = NULLIF($%d, '')", timezone},
+		{func(u *models.UserUpdate) { u.Age = &age }, "age = $%d, birthdate = NULL", age},
+		{func(u *models.UserUpdate) { u.Email = &email },
+			"pending_email = NULLIF($%d, email), email_token_hash = NULL, email_token_expires_at = NULL", "ada@example.com"},
+	}
+
+	for mask := 0; mask < 1<<len(fields); mask++ {
+		var updates models.UserUpdate
+		var assigns []string
+		var params []any
+		for i, f := range fields {
+			if mask&(1<<i) == 0 {
+				continue
+			}
+			f.set(&updates)
+			params = append(params, f.param)
+			assigns = append(assigns, fmt.Sprintf(f.assign, len(params)))
+		}
+
+		set, got, err := database.UpdateSet(context.Background(), nil, updates)
+		if mask == 0 {
+			if !errors.Is(err, database.ErrNoFieldsToUpdate) {
+				t.Errorf("empty update: err = %v; want ErrNoFieldsToUpdate", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("fields %07b: %v", mask, err)
+			continue
+		}
+		want := strings.Join(append(assigns, "version = version + 1", "updated_at = now()"), ", ")
+		if set != want {
+			t.Errorf("fields %07b:\n got %s\nwant %s", mask, set, want)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(params) {
+			t.Errorf("fields %07b: params %v; want %v", mask, got, params)
+		}
+	}
+}
+
+func TestUpdateSetVersionOnly(t *testing.T) {
+	version := 3
+	if _, _, err := database.UpdateSet(context.Background(), nil, models.UserUpdate{Version: &version}); !errors.Is(err, database.ErrNoFieldsToUpdate) {
+		t.Errorf("err = %v; want ErrNoFieldsToUpdate", err)
+	}
+}
+
+func TestUpdateSetBirthdate(t *testing.T) {
+	age := uint(36)
+	birthdate, none := "1990-04-01", ""
+	tests := []struct {
+		updates models.UserUpdate
+		want    string
+		params  int
+	}{
+		{models.UserUpdate{Birthdate: &birthdate, Age: &age}, "birthdate = $1::date, age = date_part('year', age($1::date))", 1},
+		{models.UserUpdate{Birthdate: &none, Age: &age}, "birthdate = NULL, age = COALESCE(date_part('year', age(birthdate)), age)", 0},
+	}
+	for _, tt := range tests {
+		set, params, err := database.UpdateSet(context.Background(), nil, tt.updates)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tt.want + ", version = version + 1, updated_at = now()"; set != want {
+			t.Errorf("got %s\nwant %s", set, want)
+		}
+		if len(params) != tt.params {
+			t.Errorf("%s: %d params; want %d", set, len(params), tt.params)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"users/internal/models"
+	"users/internal/validator"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email     string
+		canonical bool
+		want      string
+	}{
+		{"  Ada@Example.COM ", false, "ada@example.com"},
+		{"A.Da+news@Gmail.com", false, "a.da+news@gmail.com"},
+		{"A.Da+news@Gmail.com", true, "ada@gmail.com"},
+		{"a.da@googlemail.com", true, "ada@gmail.com"},
+		{"a.da+x@example.com", true, "a.da+x@example.com"},
+		{"+x@gmail.com", true, "+x@gmail.com"},
+		{"not-an-email", true, "not-an-email"},
+	}
+	for _, tt := range tests {
+		if got := validator.NormalizeEmail(tt.email, tt.canonical); got != tt.want {
+			t.Errorf("NormalizeEmail(%q, %v) = %q; want %q", tt.email, tt.canonical, got, tt.want)
+		}
+	}
+}
+
+func TestValidationErrorCodes(t *testing.T) {
+	user := &models.User{FirstName: "", LastName: "Lovelace", Email: "not-an-email", Username: "admin", Age: 200, Birthdate: "2999-01-01"}
+	err := validator.ValidateUser(user)
+	var errs validator.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("ValidateUser = %v; want validator.Errors", err)
+	}
+	got := map[string]validator.Code{}
+	for _, e := range errs {
+		got[e.Field] = e.Code
+	}
+	want := map[string]validator.Code{
+		"first_name": validator.CodeNameRequired,
+		"email":      validator.CodeEmailInvalid,
+		"username":   validator.CodeUsernameReserved,
+		"birthdate":  validator.CodeBirthdateInFuture,
+		"age":        validator.CodeAgeOutOfRange,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("codes = %v; want %v", got, want)
+	}
+
+	err = validator.ValidateMetadata(models.Metadata{"crm id": 1})
+	if !errors.As(err, &errs) || errs[0].Field != "metadata.crm id" || errs[0].Code != validator.CodeMetadataKeyInvalid {
+		t.Fatalf("ValidateMetadata = %#v; want METADATA_KEY_INVALID at metadata.crm id", err)
+	}
+	if code := validator.CodeOf(validator.ValidateTimezone("Mars/Olympus")); code != validator.CodeTimezoneInvalid {
+		t.Fatalf("CodeOf(ValidateTimezone) = %s", code)
+	}
+}
+
+func TestValidateMetadata(t *testing.T) {
+	if err := validator.ValidateMetadata(models.Metadata{"crm_id": "42", "newsletter": true}); err != nil {
+		t.Errorf("valid metadata: %v", err)
+	}
+	tooMany := models.Metadata{}
+	for i := 0; i <= validator.MaxMetadataKeys; i++ {
+		tooMany[fmt.Sprintf("k%d", i)] = i
+	}
+	for name, md := range map[string]models.Metadata{
+		"bad key":   {"crm id": "42"},
+		"empty key": {"": 1},
+		"too many":  tooMany,
+		"too large": {"blob": strings.Repeat("x", validator.MaxMetadataBytes)},
+	} {
+		if err := validator.ValidateMetadata(md); err == nil {
+			t.Errorf("%s: ValidateMetadata succeeded; want an error", name)
+		}
+	}
+}
+
+func TestValidateUserSnapshot(t *testing.T) {
+	snapshot := func() *models.UserSnapshot {
+		return &models.UserSnapshot{
+			User:        &models.User{ID: "42", FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Tags: []string{"vip"}, Status: models.StatusSuspended},
+			Metadata:    models.Metadata{"crm_id": "42"},
+			Preferences: &models.Preferences{Theme: models.ThemeDark},
+		}
+	}
+	// Suspended users can be restored, their status is left alone
+	if err := validator.ValidateUserSnapshot(snapshot()); err != nil {
+		t.Errorf("valid snapshot: %v", err)
+	}
+	for name, change := range map[string]func(*models.UserSnapshot){
+		"no user":   func(s *models.UserSnapshot) { s.User = nil },
+		"bad email": func(s *models.UserSnapshot) { s.User.Email = "ada" },
+		"bad tag":   func(s *models.UserSnapshot) { s.User.Tags = []string{"not a tag"} },
+		"bad key":   func(s *models.UserSnapshot) { s.Metadata = models.Metadata{"crm id": "42"} },
+		"bad theme": func(s *models.UserSnapshot) { s.Preferences.Theme = "neon" },
+	} {
+		s := snapshot()
+		change(s)
+		if err := validator.ValidateUserSnapshot(s); err == nil {
+			t.Errorf("%s: ValidateUserSnapshot succeeded; want an error", name)
+		}
+	}
+
+	// Errors name the path of the invalid value within the snapshot
+	s := snapshot()
+	s.User.Email = "ada"
+	s.Metadata = models.Metadata{"crm id": "42"}
+	var errs validator.Errors
+	if !errors.As(validator.ValidateUserSnapshot(s), &errs) {
+		t.Fatal("ValidateUserSnapshot did not return validator.Errors")
+	}
+	got := map[string]validator.Code{}
+	for _, e := range errs {
+		got[e.Field] = e.Code
+	}
+	want := map[string]validator.Code{
+		"user.email":      validator.CodeEmailInvalid,
+		"metadata.crm id": validator.CodeMetadataKeyInvalid,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot codes = %v; want %v", got, want)
+	}
+}
+
+func TestValidateLocaleAndTimezone(t *testing.T) {
+	for _, locale := range []string{"en", "pt-BR", "zh-Hant-TW", "es-419", "de-CH-1996"} {
+		if err := validator.ValidateLocale(locale); err != nil {
+			t.Errorf("ValidateLocale(%q): %v", locale, err)
+		}
+	}
+	for _, locale := range []string{"english", "en_US", "e", "en-", "pt-BR-x"} {
+		if validator.ValidateLocale(locale) == nil {
+			t.Errorf("ValidateLocale(%q) succeeded; want an error", locale)
+		}
+	}
+	for _, tz := range []string{"UTC", "Europe/Berlin", "America/Argentina/Buenos_Aires"} {
+		if err := validator.ValidateTimezone(tz); err != nil {
+			t.Errorf("ValidateTimezone(%q): %v", tz, err)
+		}
+	}
+	for _, tz := range []string{"Local", "Mars/Olympus", "+02:00", "../etc/passwd"} {
+		if validator.ValidateTimezone(tz) == nil {
+			t.Errorf("ValidateTimezone(%q) succeeded; want an error", tz)
+		}
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{
+		"María-José O'Connor", "Zoë", "王秀英", "山田 太郎", "Nguyễn Thị Minh Khai", "Σωκράτης",
+		"Jean-Luc", "St. John", "D’Angelo", "हिन्दी", "김민준", "Mary Jr.", "Jose\u0301", validator.NoName,
+	} {
+		if err := validator.ValidateName(name); err != nil {
+			t.Errorf("ValidateName(%q): %v", name, err)
+		}
+	}
+	for _, name := range []string{
+		"", "   ", "Ada\x00", "Ada 😀", "Ad\u200bà", "Ada\u200d", "\u202eecalevoL",
+		"Ada\ufeff", "R2-D2", "-Ada", "\u0301Ada", "Zo\u0336\u0336\u0336\u0336\u0336", "<script>", "Ada\xff",
+		strings.Repeat("a", validator.MaxNameLength+1),
+	} {
+		if validator.ValidateName(name) == nil {
+			t.Errorf("ValidateName(%q) succeeded; want an error", name)
+		}
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	if got := validator.NormalizeName(" Jose\u0301 \t Maria\n"); got != "José Maria" {
+		t.Errorf("NormalizeName = %q; want %q", got, "José Maria")
+	}
+}
+
+// TestNameProperties checks over random input that normalizing is stable,
+// that accepted names hold no invisible or symbol characters and that
+// sanitized names are always accepted.
+func TestNameProperties(t *testing.T) {
+	// Mix random runes with the ones names trip over most
+	tricky := []rune("aZéü王 -'.’\u0301\u0308\u200b\u200c\u200d\u202e\ufeff\x00\t\n😀1")
+	gen := func(raw []rune, picks []uint8) string {
+		var b strings.Builder
+		for i, r := range raw {
+			if i < len(picks) && picks[i]%2 == 0 {
+				r = tricky[int(picks[i])%len(tricky)]
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	}
+
+	property := func(raw []rune, picks []uint8) bool {
+		name := gen(raw, picks)
+		normalized := validator.NormalizeName(name)
+		if validator.NormalizeName(normalized) != normalized || !norm.NFC.IsNormalString(normalized) {
+			t.Logf("NormalizeName(%q) = %q is not stable", name, normalized)
+			return false
+		}
+		if validator.ValidateName(name) == nil {
+			for _, r := range normalized {
+				if unicode.In(r, unicode.Cc, unicode.Cf, unicode.S, unicode.N) {
+					t.Logf("ValidateName accepted %q containing %U", name, r)
+					return false
+				}
+			}
+		}
+		if sanitized := validator.SanitizeName(name); sanitized != "" && validator.ValidateName(sanitized) != nil {
+			t.Logf("SanitizeName(%q) = %q is not a valid name", name, sanitized)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 5000}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"users/internal/models"
+	"users/internal/worker"
+)
+
+// jobStore hands out its queued jobs once and records their outcome.
+type jobStore struct {
+	mu        sync.Mutex
+	queued    []models.Job
+	completed []int64
+	failed    map[int64]string
+	done      chan struct{}
+}
+
+func (s *jobStore) EnqueueJob(ctx context.Context, job *models.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.ID = int64(len(s.queued) + 1)
+	job.Attempts, job.MaxAttempts = 1, 5
+	s.queued = append(s.queued, *job)
+	return nil
+}
+
+func (s *jobStore) ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := min(limit, len(s.queued))
+	jobs := s.queued[:n]
+	s.queued = s.queued[n:]
+	return jobs, nil
+}
+
+func (s *jobStore) CompleteJob(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	s.completed = append(s.completed, id)
+	s.mu.Unlock()
+	s.done <- struct{}{}
+	return nil
+}
+
+func (s *jobStore) FailJob(ctx context.Context, id int64, message string, retryIn time.Duration) error {
+	s.mu.Lock()
+	s.failed[id] = message
+	s.mu.Unlock()
+	s.done <- struct{}{}
+	return nil
+}
+
+func TestWorkerPool(t *testing.T) {
+	store := &jobStore{failed: map[int64]string{}, done: make(chan struct{}, 3)}
+	pool := worker.NewPool(store)
+	pool.PollInterval = time.Millisecond
+	pool.Register("test", func(ctx context.Context, job models.Job) error {
+		switch string(job.Payload) {
+		case `"fail"`:
+			return errors.New("boom")
+		case `"panic"`:
+			panic("bad job")
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, payload := range []string{"ok", "fail", "panic"} {
+		if err := pool.Enqueue(ctx, "test", payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	finished := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(finished)
+	}()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-store.done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("jobs did not finish")
+		}
+	}
+	cancel()
+	<-finished
+
+	if len(store.completed) != 1 || store.completed[0] != 1 {
+		t.Errorf("completed = %v; want [1]", store.completed)
+	}
+	if store.failed[2] != "boom" {
+		t.Errorf("failure of job 2 = %q; want boom", store.failed[2])
+	}
+	if store.failed[3] != "panic: bad job" {
+		t.Errorf("failure of job 3 = %q; want the recovered panic", store.failed[3])
+	}
+}